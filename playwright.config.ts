@@ -21,7 +21,7 @@ export default defineConfig({
     { name: 'firefox', use: { browserName: 'firefox' }, }
   ],
   webServer: {
-    command: 'cd server && go build -o babytrackd && ./babytrackd',
+    command: 'cd server && go build -o babytrackd ./cmd/babytrackd && ./babytrackd',
     url: 'http://localhost:8081/health',
     timeout: 15000,
     reuseExistingServer: !process.env.CI,
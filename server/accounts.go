@@ -0,0 +1,514 @@
+package babytrack
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Accounts are optional, for caregivers who help more than one family: an
+// account signs in with an email address and password, in its own
+// account_session cookie, and remembers one link per family. Opening a
+// family from the account signs the browser in to it with a new session
+// for the remembered link, as opening the link would (see sessions.go), so
+// moving between families needs no second browser, and everything past
+// the client_session cookie works as it does without an account.
+//
+// An account only ever has the links its owner had: a link is remembered
+// from a browser signed in with it, and forgotten when it is revoked,
+// expires or its family is archived. Signing a device out (see devices.go)
+// doesn't sign its account out; logging out everywhere does.
+
+const (
+	minPasswordLen    = 10
+	maxPasswordLen    = 72 // bcrypt's limit, in bytes
+	accountSessionTTL = 30 * 24 * time.Hour
+)
+
+const accountIDKey ctxKey = "account_id"
+
+var errEmailTaken = errors.New("an account with that email already exists")
+
+// accountLimiter counts sign-ups and logins per IP and logins per address.
+var accountLimiter = newRateLimiter(10, 15*time.Minute)
+
+// dummyPasswordHash is compared against for unknown addresses, so a login
+// takes as long whether or not the account exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// Account is a caregiver's account.
+type Account struct {
+	ID          string          `json:"id"`
+	Email       string          `json:"email"`
+	CreatedAt   int64           `json:"created_at"`
+	LastLoginAt *int64          `json:"last_login_at"`
+	Families    []AccountFamily `json:"families"`
+}
+
+// AccountFamily is a family an account has a link for.
+type AccountFamily struct {
+	FamilyID   string `json:"family_id"`
+	FamilyName string `json:"family_name"`
+	LinkID     string `json:"link_id"`
+	Label      string `json:"label"` // the link's
+	Role       string `json:"role"`
+	AddedAt    int64  `json:"added_at"`
+	Current    bool   `json:"current"` // the family the browser is signed in to
+}
+
+// CreateAccount creates an account, or returns errEmailTaken.
+func (db *DB) CreateAccount(email, password string) (*Account, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	a := &Account{ID: generateToken(8), Email: strings.ToLower(email), CreatedAt: time.Now().UnixMilli()}
+	res, err := db.Exec(
+		"INSERT INTO accounts (id, email, password_hash, created_at) VALUES (?, ?, ?, ?) ON CONFLICT(email) DO NOTHING",
+		a.ID, a.Email, string(hash), a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, errEmailTaken
+	}
+	return a, nil
+}
+
+// GetAccountByEmail returns the account and its password hash, or
+// sql.ErrNoRows.
+func (db *DB) GetAccountByEmail(email string) (*Account, string, error) {
+	var a Account
+	var hash string
+	var lastLogin sql.NullInt64
+	err := db.QueryRow(
+		"SELECT id, email, password_hash, created_at, last_login_at FROM accounts WHERE email = ?",
+		strings.ToLower(email),
+	).Scan(&a.ID, &a.Email, &hash, &a.CreatedAt, &lastLogin)
+	if err != nil {
+		return nil, "", err
+	}
+	if lastLogin.Valid {
+		a.LastLoginAt = &lastLogin.Int64
+	}
+	return &a, hash, nil
+}
+
+// GetAccount returns the account, or sql.ErrNoRows.
+func (db *DB) GetAccount(id string) (*Account, error) {
+	var a Account
+	var lastLogin sql.NullInt64
+	err := db.QueryRow(
+		"SELECT id, email, created_at, last_login_at FROM accounts WHERE id = ?", id,
+	).Scan(&a.ID, &a.Email, &a.CreatedAt, &lastLogin)
+	if err != nil {
+		return nil, err
+	}
+	if lastLogin.Valid {
+		a.LastLoginAt = &lastLogin.Int64
+	}
+	return &a, nil
+}
+
+// DeleteAccount deletes the account, its sessions and the links it
+// remembers. The links themselves are untouched.
+func (db *DB) DeleteAccount(id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"account_links", "account_sessions"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE account_id = ?", id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM accounts WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateAccountSession signs the account in and returns the session token.
+func (db *DB) CreateAccountSession(accountID string, now time.Time) (string, error) {
+	token := generateToken(32)
+	if _, err := db.Exec(
+		"INSERT INTO account_sessions (id, account_id, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		hashToken(token), accountID, now.UnixMilli(), now.Add(accountSessionTTL).UnixMilli(),
+	); err != nil {
+		return "", err
+	}
+	_, err := db.Exec("UPDATE accounts SET last_login_at = ? WHERE id = ?", now.UnixMilli(), accountID)
+	return token, err
+}
+
+// ValidateAccountSession returns the ID of the account signed in with
+// token, or sql.ErrNoRows.
+func (db *DB) ValidateAccountSession(token string, now int64) (string, error) {
+	var id string
+	err := db.QueryRow(
+		"SELECT account_id FROM account_sessions WHERE id = ? AND expires_at > ?", hashToken(token), now,
+	).Scan(&id)
+	return id, err
+}
+
+// DeleteAccountSessions ends the session with token, or with everywhere,
+// all of its account's.
+func (db *DB) DeleteAccountSessions(token string, everywhere bool) error {
+	if everywhere {
+		_, err := db.Exec(
+			"DELETE FROM account_sessions WHERE account_id = (SELECT account_id FROM account_sessions WHERE id = ?)",
+			hashToken(token),
+		)
+		return err
+	}
+	_, err := db.Exec("DELETE FROM account_sessions WHERE id = ?", hashToken(token))
+	return err
+}
+
+// PurgeAccountSessions deletes account sessions that expired before now.
+func (db *DB) PurgeAccountSessions(now int64) error {
+	_, err := db.Exec("DELETE FROM account_sessions WHERE expires_at <= ?", now)
+	return err
+}
+
+// AddAccountLink remembers the link for the account, replacing any it had
+// for the link's family.
+func (db *DB) AddAccountLink(accountID string, link *AccessLink, now int64) error {
+	_, err := db.Exec(
+		`INSERT INTO account_links (account_id, family_id, link_id, added_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(account_id, family_id) DO UPDATE SET link_id = excluded.link_id, added_at = excluded.added_at`,
+		accountID, link.FamilyID, link.ID, now,
+	)
+	return err
+}
+
+// RemoveAccountLink forgets the account's link for the family. Returns
+// sql.ErrNoRows if it had none.
+func (db *DB) RemoveAccountLink(accountID, familyID string) error {
+	res, err := db.Exec("DELETE FROM account_links WHERE account_id = ? AND family_id = ?", accountID, familyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AccountFamilies returns the families the account has a usable link for,
+// by name.
+func (db *DB) AccountFamilies(accountID string, now int64) ([]AccountFamily, error) {
+	rows, err := db.Query(
+		`SELECT f.id, f.name, l.token, COALESCE(l.label, ''), l.role, a.added_at
+		 FROM account_links a
+		 JOIN access_links l ON l.token = a.link_id
+		 JOIN families f ON f.id = a.family_id
+		 WHERE a.account_id = ? AND f.archived = 0 AND (l.expires_at IS NULL OR l.expires_at > ?)
+		 ORDER BY f.name`,
+		accountID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	families := []AccountFamily{}
+	for rows.Next() {
+		var f AccountFamily
+		if err := rows.Scan(&f.FamilyID, &f.FamilyName, &f.LinkID, &f.Label, &f.Role, &f.AddedAt); err != nil {
+			return nil, err
+		}
+		families = append(families, f)
+	}
+	return families, rows.Err()
+}
+
+// AccountLink returns the account's usable link for the family, or
+// sql.ErrNoRows.
+func (db *DB) AccountLink(accountID, familyID string, now int64) (*AccessLink, error) {
+	link, err := scanAccessLink(db.QueryRow(
+		`SELECT `+accessLinkColumns+` FROM access_links
+		 WHERE token = (SELECT link_id FROM account_links WHERE account_id = ? AND family_id = ?)
+		 AND family_id IN (SELECT id FROM families WHERE archived = 0)`,
+		accountID, familyID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if link.ExpiresAt != nil && now > *link.ExpiresAt {
+		return nil, sql.ErrNoRows
+	}
+	return link, nil
+}
+
+// accountRequired authenticates requests by their account_session cookie
+// and makes the account's ID available via accountIDFrom.
+func (s *Server) accountRequired(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("account_session")
+		if err != nil {
+			jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "not signed in to an account")
+			return
+		}
+		id, err := s.db.ValidateAccountSession(cookie.Value, time.Now().UnixMilli())
+		if err != nil {
+			jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "not signed in to an account")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), accountIDKey, id)))
+	}
+}
+
+// accountIDFrom returns the account authenticated by accountRequired.
+func accountIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(accountIDKey).(string)
+	return id
+}
+
+func (s *Server) accountCookie(r *http.Request, token string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     "account_session",
+		Value:    token,
+		Path:     s.cookiePath(),
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   maxAge,
+	}
+}
+
+// startAccountSession signs the browser in to the account and, if it is
+// signed in to a family, remembers that family's link.
+func (s *Server) startAccountSession(w http.ResponseWriter, r *http.Request, accountID string) error {
+	now := time.Now()
+	token, err := s.db.CreateAccountSession(accountID, now)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, s.accountCookie(r, token, int(accountSessionTTL/time.Second)))
+	if link := s.currentLink(r); link != nil {
+		return s.db.AddAccountLink(accountID, link, now.UnixMilli())
+	}
+	return nil
+}
+
+// currentLink returns the link the browser is signed in to a family with,
+// if any.
+func (s *Server) currentLink(r *http.Request) *AccessLink {
+	cookie, err := r.Cookie("client_session")
+	if err != nil {
+		return nil
+	}
+	link, err := s.db.ValidateAccessLink(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	return link
+}
+
+// accountCredentials decodes and checks a sign-up or login body, writing
+// the error response if it's no good.
+func accountCredentials(w http.ResponseWriter, r *http.Request, signup bool) (email, password string, ok bool) {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return "", "", false
+	}
+	fields := map[string]string{}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil {
+		fields["email"] = "must be an email address"
+	}
+	if signup && (len(req.Password) < minPasswordLen || len(req.Password) > maxPasswordLen) {
+		fields["password"] = "must be 10-72 characters"
+	}
+	if len(fields) > 0 {
+		validationError(w, fields)
+		return "", "", false
+	}
+	return strings.ToLower(addr.Address), req.Password, true
+}
+
+// handleAccountSignup handles POST /api/v1/account: {"email", "password"}
+// creates an account and signs in to it, remembering the family the
+// browser is signed in to, if any.
+func (s *Server) handleAccountSignup(w http.ResponseWriter, r *http.Request) {
+	email, password, ok := accountCredentials(w, r, true)
+	if !ok {
+		return
+	}
+	if !accountLimiter.Allow("ip:" + clientIP(r)) {
+		w.Header().Set("Retry-After", "900")
+		jsonError(w, http.StatusTooManyRequests, errCodeRateLimited, "too many attempts")
+		return
+	}
+	a, err := s.db.CreateAccount(email, password)
+	if err == errEmailTaken {
+		jsonError(w, http.StatusConflict, errCodeConflict, err.Error())
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to create account", err)
+		return
+	}
+	if err := s.startAccountSession(w, r, a.ID); err != nil {
+		serverError(w, "failed to sign in", err)
+		return
+	}
+	loggerFromCtx(r.Context()).Info("account created", "account_id", a.ID)
+	s.writeAccount(w, r, a.ID, http.StatusCreated)
+}
+
+// handleAccountLogin handles POST /api/v1/account/login: {"email",
+// "password"} signs in to the account, remembering the family the browser
+// is signed in to, if any.
+func (s *Server) handleAccountLogin(w http.ResponseWriter, r *http.Request) {
+	email, password, ok := accountCredentials(w, r, false)
+	if !ok {
+		return
+	}
+	if !accountLimiter.Allow("ip:"+clientIP(r)) || !accountLimiter.Allow("email:"+email) {
+		w.Header().Set("Retry-After", "900")
+		jsonError(w, http.StatusTooManyRequests, errCodeRateLimited, "too many attempts")
+		return
+	}
+	a, hash, err := s.db.GetAccountByEmail(email)
+	if err != nil && err != sql.ErrNoRows {
+		serverError(w, "failed to look up account", err)
+		return
+	}
+	if err != nil {
+		hash = string(dummyPasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil || a == nil {
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid credentials")
+		return
+	}
+	if err := s.startAccountSession(w, r, a.ID); err != nil {
+		serverError(w, "failed to sign in", err)
+		return
+	}
+	loggerFromCtx(r.Context()).Info("account signed in", "account_id", a.ID)
+	s.writeAccount(w, r, a.ID, http.StatusOK)
+}
+
+// handleAccountLogout handles POST /api/v1/account/logout, ending the
+// browser's account session, or with {"everywhere": true} all of them.
+// The family the browser is signed in to stays signed in.
+func (s *Server) handleAccountLogout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Everywhere bool `json:"everywhere"`
+	}
+	json.NewDecoder(r.Body).Decode(&req) // the body is optional
+	if cookie, err := r.Cookie("account_session"); err == nil {
+		if err := s.db.DeleteAccountSessions(cookie.Value, req.Everywhere); err != nil {
+			serverError(w, "failed to sign out", err)
+			return
+		}
+	}
+	http.SetCookie(w, s.accountCookie(r, "", -1))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetAccount handles GET /api/v1/account: the account and its
+// families.
+func (s *Server) handleGetAccount(w http.ResponseWriter, r *http.Request) {
+	s.writeAccount(w, r, accountIDFrom(r.Context()), http.StatusOK)
+}
+
+func (s *Server) writeAccount(w http.ResponseWriter, r *http.Request, id string, status int) {
+	a, err := s.db.GetAccount(id)
+	if err != nil {
+		serverError(w, "failed to get account", err)
+		return
+	}
+	if a.Families, err = s.db.AccountFamilies(id, time.Now().UnixMilli()); err != nil {
+		serverError(w, "failed to list account families", err)
+		return
+	}
+	if link := s.currentLink(r); link != nil {
+		for i := range a.Families {
+			a.Families[i].Current = a.Families[i].FamilyID == link.FamilyID
+		}
+	}
+	jsonResponse(w, status, a)
+}
+
+// handleDeleteAccount handles DELETE /api/v1/account. The families'
+// links keep working.
+func (s *Server) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	id := accountIDFrom(r.Context())
+	if err := s.db.DeleteAccount(id); err != nil {
+		serverError(w, "failed to delete account", err)
+		return
+	}
+	http.SetCookie(w, s.accountCookie(r, "", -1))
+	loggerFromCtx(r.Context()).Info("account deleted", "account_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAddAccountFamily handles POST /api/v1/account/families: remembers
+// the family the browser is signed in to.
+func (s *Server) handleAddAccountFamily(w http.ResponseWriter, r *http.Request) {
+	id := accountIDFrom(r.Context())
+	if err := s.db.AddAccountLink(id, accessLinkFrom(r.Context()), time.Now().UnixMilli()); err != nil {
+		serverError(w, "failed to add family", err)
+		return
+	}
+	s.writeAccount(w, r, id, http.StatusOK)
+}
+
+// handleRemoveAccountFamily handles DELETE
+// /api/v1/account/families/{family_id}: forgets the account's link for the
+// family. The link keeps working.
+func (s *Server) handleRemoveAccountFamily(w http.ResponseWriter, r *http.Request) {
+	err := s.db.RemoveAccountLink(accountIDFrom(r.Context()), r.PathValue("family_id"))
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to remove family", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleOpenAccountFamily handles POST
+// /api/v1/account/families/{family_id}/open: signs the browser in to the
+// family with a new session for the account's link, and says where the
+// app for it is.
+func (s *Server) handleOpenAccountFamily(w http.ResponseWriter, r *http.Request) {
+	id := accountIDFrom(r.Context())
+	link, err := s.db.AccountLink(id, r.PathValue("family_id"), time.Now().UnixMilli())
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to get account link", err)
+		return
+	}
+	if err := s.startSession(w, r, link); err != nil {
+		serverError(w, "failed to start session", err)
+		return
+	}
+	loggerFromCtx(r.Context()).Info("family opened from account", "account_id", id, "family_id", link.FamilyID, "link_id", link.ID)
+	url := s.basePath + "/?family=" + link.FamilyID
+	if link.Role == roleSummary {
+		url = s.basePath + "/summary"
+	}
+	jsonOK(w, map[string]string{"family_id": link.FamilyID, "role": link.Role, "url": url})
+}
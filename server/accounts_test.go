@@ -0,0 +1,120 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAccounts(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	mux := s.routes()
+	smiths, _ := s.db.CreateFamily("Smith", "")
+	smithLink, _ := s.db.CreateAccessLink(smiths.ID, "Nanny", nil)
+	jones, _ := s.db.CreateFamily("Jones", "")
+	jonesLink, _ := s.db.CreateAccessLinkRole(jones.ID, "Nanny", roleSummary, nil)
+
+	// The browser's cookies, as it would keep them
+	jar := map[string]string{}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for name, value := range jar {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		for _, c := range w.Result().Cookies() {
+			if c.MaxAge < 0 {
+				delete(jar, c.Name)
+			} else {
+				jar[c.Name] = c.Value
+			}
+		}
+		return w
+	}
+	account := func() Account {
+		w := do("GET", "/api/v1/account", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("get account: %d %s", w.Code, w.Body)
+		}
+		var a Account
+		json.NewDecoder(w.Body).Decode(&a)
+		return a
+	}
+
+	// Signing up from a family remembers it
+	do("POST", "/t/"+smithLink.Token, "")
+	if w := do("POST", "/api/v1/account", `{"email": "nanny@example.com", "password": "short"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("short password: %d", w.Code)
+	}
+	if w := do("POST", "/api/v1/account", `{"email": "Nanny@example.com", "password": "correct horse"}`); w.Code != http.StatusCreated {
+		t.Fatalf("sign up: %d %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/api/v1/account", `{"email": "nanny@example.com", "password": "correct horse"}`); w.Code != http.StatusConflict {
+		t.Errorf("second sign up: %d", w.Code)
+	}
+	if a := account(); a.Email != "nanny@example.com" || len(a.Families) != 1 || !a.Families[0].Current {
+		t.Fatalf("account = %+v", a)
+	}
+
+	// Adding another from its link
+	do("POST", "/t/"+jonesLink.Token, "")
+	if w := do("POST", "/api/v1/account/families", ""); w.Code != http.StatusOK {
+		t.Fatalf("add family: %d %s", w.Code, w.Body)
+	}
+	a := account()
+	if len(a.Families) != 2 || a.Families[0].FamilyName != "Jones" || !a.Families[0].Current || a.Families[1].Current {
+		t.Fatalf("families = %+v", a.Families)
+	}
+
+	// Moving between them without the links
+	w := do("POST", "/api/v1/account/families/"+smiths.ID+"/open", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "?family="+smiths.ID) {
+		t.Fatalf("open: %d %s", w.Code, w.Body)
+	}
+	if link, err := s.db.ValidateAccessLink(jar["client_session"]); err != nil || link.ID != smithLink.ID || link.sess == nil {
+		t.Errorf("signed in to %+v, %v", link, err)
+	}
+	if w := do("POST", "/api/v1/account/families/nope/open", ""); w.Code != http.StatusNotFound {
+		t.Errorf("open unknown family: %d", w.Code)
+	}
+
+	// Revoking a link forgets it
+	s.db.DeleteAccessLink(jones.ID, jonesLink.ID)
+	if a := account(); len(a.Families) != 1 || a.Families[0].FamilyID != smiths.ID {
+		t.Errorf("after revoke = %+v", a.Families)
+	}
+	if w := do("POST", "/api/v1/account/families/"+jones.ID+"/open", ""); w.Code != http.StatusNotFound {
+		t.Errorf("open revoked: %d", w.Code)
+	}
+
+	// Logging out keeps the family signed in
+	if w := do("POST", "/api/v1/account/logout", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("logout: %d", w.Code)
+	}
+	if w := do("GET", "/api/v1/account", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("after logout: %d", w.Code)
+	}
+	if w := do("GET", "/api/v1/state", ""); w.Code != http.StatusOK {
+		t.Errorf("family after logout: %d", w.Code)
+	}
+
+	if w := do("POST", "/api/v1/account/login", `{"email": "nanny@example.com", "password": "wrong horse"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: %d", w.Code)
+	}
+	if w := do("POST", "/api/v1/account/login", `{"email": "nobody@example.com", "password": "correct horse"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown address: %d", w.Code)
+	}
+	if w := do("POST", "/api/v1/account/login", `{"email": "NANNY@example.com", "password": "correct horse"}`); w.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	if w := do("DELETE", "/api/v1/account", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", w.Code)
+	}
+	if _, _, err := s.db.GetAccountByEmail("nanny@example.com"); err == nil {
+		t.Error("account not deleted")
+	}
+}
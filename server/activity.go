@@ -0,0 +1,195 @@
+package babytrack
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// A family's activity feed, for support questions like "it stopped syncing
+// on Tuesday": entry writes, device connections and errors, warnings, the
+// app's own error and warning logs, and access link changes, newest first.
+// Hub activity other than entries is recorded as it happens and capped per
+// family; the rest is read from where it already lives.
+
+const (
+	maxActivityPerFamily = 2000
+	defaultActivityLimit = 200
+	maxActivityLimit     = 1000
+)
+
+// ActivityItem is one line of the feed.
+type ActivityItem struct {
+	Ts        int64  `json:"ts"`
+	Kind      string `json:"kind"` // entry, connect, disconnect, error, warning, log, link_created, link_rotated
+	Label     string `json:"label,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Action    string `json:"action,omitempty"` // entry: save or delete
+	EntryType string `json:"entry_type,omitempty"`
+	Value     string `json:"value,omitempty"`
+	EntryTs   int64  `json:"entry_ts,omitempty"` // entry: when it happened, as opposed to was written
+	Clients   *int   `json:"clients,omitempty"`  // connect/disconnect: family clients after
+}
+
+// RecordActivity stores a hub event and trims the family's history to
+// maxActivityPerFamily rows.
+func (db *DB) RecordActivity(ev ActivityEvent) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO activity_events (family_id, ts, type, label, message, clients) VALUES (?, ?, ?, ?, ?, ?)",
+		ev.FamilyID, ev.Ts, ev.Type, ev.Label, ev.Message, ev.Clients,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`DELETE FROM activity_events WHERE family_id = ? AND id <= (
+			SELECT id FROM activity_events WHERE family_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?
+		)`,
+		ev.FamilyID, ev.FamilyID, maxActivityPerFamily,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FamilyActivity returns up to limit items of the family's feed in
+// [from, to), newest first.
+func (db *DB) FamilyActivity(familyID string, from, to int64, limit int) ([]ActivityItem, error) {
+	items := []ActivityItem{}
+
+	rows, err := db.Query(
+		`SELECT updated_at, COALESCE(author, ''), deleted, type, value, ts FROM entries
+		 WHERE family_id = ? AND updated_at >= ? AND updated_at < ?
+		 ORDER BY updated_at DESC LIMIT ?`,
+		familyID, from, to, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		it := ActivityItem{Kind: "entry", Action: "save"}
+		var deleted bool
+		if err := rows.Scan(&it.Ts, &it.Label, &deleted, &it.EntryType, &it.Value, &it.EntryTs); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if deleted {
+			it.Action = "delete"
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(
+		`SELECT ts, type, label, message, clients FROM activity_events
+		 WHERE family_id = ? AND ts >= ? AND ts < ?
+		 ORDER BY ts DESC LIMIT ?`,
+		familyID, from, to, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var it ActivityItem
+		var clients int
+		if err := rows.Scan(&it.Ts, &it.Kind, &it.Label, &it.Message, &clients); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if it.Kind == "connect" || it.Kind == "disconnect" {
+			it.Clients = &clients
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	logs, err := db.ListClientLogs(familyID, clientLogLevels["warn"], from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range logs {
+		items = append(items, ActivityItem{Ts: l.Ts, Kind: "log", Label: l.Label, Message: l.Level + ": " + l.Message})
+	}
+
+	links, err := db.ListAccessLinks(familyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		if l.CreatedAt >= from && l.CreatedAt < to {
+			items = append(items, ActivityItem{Ts: l.CreatedAt, Kind: "link_created", Label: l.Label})
+		}
+		if l.RotatedAt != nil && *l.RotatedAt >= from && *l.RotatedAt < to {
+			items = append(items, ActivityItem{Ts: *l.RotatedAt, Kind: "link_rotated", Label: l.Label})
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Ts > items[j].Ts })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+// getFamilyActivity handles GET /admin/families/{id}/activity?from=&to=&limit=,
+// from and to in ms and defaulting to the last week. The response also has
+// each link's last contact, for what the feed doesn't show.
+func (s *Server) getFamilyActivity(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	from, to, ok := parseRangeParams(w, r, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	limit := defaultActivityLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxActivityLimit {
+			validationError(w, map[string]string{"limit": "must be between 1 and " + strconv.Itoa(maxActivityLimit)})
+			return
+		}
+		limit = n
+	}
+	if _, err := s.db.GetFamily(familyID); err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+
+	items, err := s.db.FamilyActivity(familyID, from, to, limit)
+	if err != nil {
+		serverError(w, "failed to load activity", err)
+		return
+	}
+	links, err := s.db.ListAccessLinks(familyID)
+	if err != nil {
+		serverError(w, "failed to list access links", err)
+		return
+	}
+	if seq, err := s.db.FamilySeq(familyID); err == nil {
+		setLinkLag(links, seq)
+	}
+	type linkUsage struct {
+		ID          string `json:"id"`
+		Label       string `json:"label"`
+		LastSeenAt  *int64 `json:"last_seen_at"`
+		LastEntryAt *int64 `json:"last_entry_at"`
+		AckedAt     *int64 `json:"acked_at"`
+		Behind      *int64 `json:"behind,omitempty"`
+	}
+	usage := make([]linkUsage, len(links))
+	for i, l := range links {
+		usage[i] = linkUsage{ID: l.ID, Label: l.Label, LastSeenAt: l.LastSeenAt, LastEntryAt: l.LastEntryAt, AckedAt: l.AckedAt, Behind: l.Behind}
+	}
+	jsonOK(w, map[string]any{"from": from, "to": to, "items": items, "links": usage})
+}
@@ -0,0 +1,104 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFamilyActivity(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	now := time.Now().UnixMilli()
+	s.db.UpsertEntry(&Entry{ID: "e1", FamilyID: family.ID, Ts: now - 3600_000, Type: "feed", Value: "bf", Author: "Dad"})
+	s.db.InsertClientLogs(family.ID, "Mum", []ClientLog{
+		{Ts: now, Level: "error", Message: "sync stopped"},
+		{Ts: now, Level: "info", Message: "connected"},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	skipUntilType(t, conn, "init")
+	conn.Close()
+
+	get := func() (resp struct {
+		Items []ActivityItem `json:"items"`
+		Links []struct {
+			Label      string `json:"label"`
+			LastSeenAt *int64 `json:"last_seen_at"`
+		} `json:"links"`
+	}) {
+		req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/activity", nil)
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.getFamilyActivity(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("activity: %d %s", w.Code, w.Body)
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// Connections are recorded in the background
+	kinds := map[string]int{}
+	for deadline := time.Now().Add(2 * time.Second); kinds["disconnect"] == 0 && time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		kinds = map[string]int{}
+		for _, it := range get().Items {
+			kinds[it.Kind]++
+		}
+	}
+	if kinds["entry"] != 1 || kinds["connect"] != 1 || kinds["disconnect"] != 1 || kinds["log"] != 1 || kinds["link_created"] != 1 {
+		t.Errorf("kinds = %v", kinds)
+	}
+	resp := get()
+	for i := 1; i < len(resp.Items); i++ {
+		if resp.Items[i].Ts > resp.Items[i-1].Ts {
+			t.Errorf("not newest first: %+v", resp.Items)
+		}
+	}
+	for _, it := range resp.Items {
+		if it.Kind == "entry" && (it.Label != "Dad" || it.Action != "save" || it.EntryTs != now-3600_000) {
+			t.Errorf("entry item = %+v", it)
+		}
+	}
+	if len(resp.Links) != 1 || resp.Links[0].Label != "Mum" || resp.Links[0].LastSeenAt == nil {
+		t.Errorf("links = %+v", resp.Links)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/activity?limit=0", nil)
+	req.SetPathValue("id", family.ID)
+	w := httptest.NewRecorder()
+	s.getFamilyActivity(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("limit=0: %d", w.Code)
+	}
+}
+
+func TestRecordActivityCapped(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+	for i := range maxActivityPerFamily + 3 {
+		db.RecordActivity(ActivityEvent{Type: "warning", FamilyID: family.ID, Ts: int64(i + 1), Message: "w"})
+	}
+	var n, oldest int64
+	db.QueryRow("SELECT COUNT(*), MIN(ts) FROM activity_events WHERE family_id = ?", family.ID).Scan(&n, &oldest)
+	if n != maxActivityPerFamily || oldest != 4 {
+		t.Errorf("kept %d from %d", n, oldest)
+	}
+}
@@ -1,11 +1,13 @@
-package main
+package babytrack
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -17,18 +19,18 @@ func (s *Server) adminLogin(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
 		return
 	}
 
 	admin, err := s.db.GetAdminByUsername(req.Username)
 	if err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid credentials")
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(req.Password)); err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid credentials")
 		return
 	}
 
@@ -41,9 +43,9 @@ func (s *Server) adminLogin(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "admin_session",
 		Value:    token,
-		Path:     "/",
+		Path:     s.cookiePath(),
 		HttpOnly: true,
-		Secure:   r.TLS != nil,
+		Secure:   isSecure(r),
 		SameSite: http.SameSiteStrictMode,
 		MaxAge:   86400,
 	})
@@ -60,7 +62,7 @@ func (s *Server) adminLogout(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "admin_session",
 		Value:    "",
-		Path:     "/",
+		Path:     s.cookiePath(),
 		HttpOnly: true,
 		MaxAge:   -1,
 	})
@@ -72,17 +74,27 @@ func (s *Server) adminRequired(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie("admin_session")
 		if err != nil {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
 			return
 		}
 
 		adminID, err := s.db.ValidateAdminSession(cookie.Value)
 		if err != nil {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+			return
+		}
+
+		orgID, err := s.db.AdminOrg(adminID)
+		if err != nil {
+			jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+			return
+		}
+		if orgID != "" && !s.orgAllows(w, r, orgID) {
 			return
 		}
 
 		r.Header.Set("X-Admin-ID", adminID)
+		r.Header.Set("X-Admin-Org", orgID)
 		next(w, r)
 	}
 }
@@ -91,17 +103,18 @@ func (s *Server) adminRequired(next http.HandlerFunc) http.HandlerFunc {
 func (s *Server) validateSession(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("admin_session")
 	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
 		return
 	}
 
 	adminID, err := s.db.ValidateAdminSession(cookie.Value)
 	if err != nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
 		return
 	}
 
-	jsonOK(w, map[string]string{"status": "ok", "admin_id": adminID})
+	orgID, _ := s.db.AdminOrg(adminID)
+	jsonOK(w, map[string]string{"status": "ok", "admin_id": adminID, "org_id": orgID})
 }
 
 // Family handlers
@@ -113,22 +126,34 @@ type FamilyWithStats struct {
 	LinkCount      int   `json:"link_count"`
 }
 
+// familiesWithStats lists families with their stats, limited to orgID's if
+// it's set.
+func (s *Server) familiesWithStats(includeArchived bool, orgID string) ([]FamilyWithStats, error) {
+	families, err := s.db.ListFamilies(includeArchived)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]FamilyWithStats, 0, len(families))
+	for _, f := range families {
+		if orgID != "" && f.OrgID != orgID {
+			continue
+		}
+		fs := FamilyWithStats{Family: f}
+		fs.EntryCount, _ = s.db.GetEntryCount(f.ID)
+		fs.LatestActivity, _ = s.db.GetLatestActivity(f.ID)
+		fs.LinkCount, _ = s.db.GetLinkCount(f.ID)
+		result = append(result, fs)
+	}
+	return result, nil
+}
+
 func (s *Server) listFamilies(w http.ResponseWriter, r *http.Request) {
-	families, err := s.db.ListFamilies(r.URL.Query().Get("archived") == "true")
+	result, err := s.familiesWithStats(r.URL.Query().Get("archived") == "true", adminOrg(r))
 	if err != nil {
 		serverError(w, "failed to list families", err)
 		return
 	}
 
-	// Enrich with stats
-	result := make([]FamilyWithStats, len(families))
-	for i, f := range families {
-		result[i].Family = f
-		result[i].EntryCount, _ = s.db.GetEntryCount(f.ID)
-		result[i].LatestActivity, _ = s.db.GetLatestActivity(f.ID)
-		result[i].LinkCount, _ = s.db.GetLinkCount(f.ID)
-	}
-
 	jsonOK(w, result)
 }
 
@@ -136,18 +161,27 @@ func (s *Server) createFamily(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name  string `json:"name"`
 		Notes string `json:"notes"`
+		OrgID string `json:"org_id"` // server admins only; org admins create in their own
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
 		return
 	}
 
 	if req.Name == "" {
-		http.Error(w, "name required", http.StatusBadRequest)
+		validationError(w, map[string]string{"name": "required"})
 		return
 	}
+	if orgID := adminOrg(r); orgID != "" {
+		req.OrgID = orgID
+	} else if req.OrgID != "" {
+		if _, err := s.db.GetOrg(req.OrgID); err != nil {
+			validationError(w, map[string]string{"org_id": "no such org"})
+			return
+		}
+	}
 
-	family, err := s.db.CreateFamily(req.Name, req.Notes)
+	family, err := s.db.CreateOrgFamily(req.OrgID, req.Name, req.Notes)
 	if err != nil {
 		serverError(w, "failed to create family", err)
 		return
@@ -160,7 +194,7 @@ func (s *Server) getFamily(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	family, err := s.db.GetFamily(id)
 	if err != nil {
-		http.Error(w, "not found", http.StatusNotFound)
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
 		return
 	}
 
@@ -174,16 +208,35 @@ func (s *Server) updateFamily(w http.ResponseWriter, r *http.Request) {
 		Name     *string `json:"name"`
 		Notes    *string `json:"notes"`
 		Archived *bool   `json:"archived"`
+		OrgID    *string `json:"org_id"` // server admins only; "" removes it from its org
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
 		return
 	}
+	if req.OrgID != nil {
+		if adminOrg(r) != "" {
+			jsonError(w, http.StatusForbidden, errCodeForbidden, "only server admins can move families between orgs")
+			return
+		}
+		if *req.OrgID != "" {
+			if _, err := s.db.GetOrg(*req.OrgID); err != nil {
+				validationError(w, map[string]string{"org_id": "no such org"})
+				return
+			}
+		}
+	}
 
 	if err := s.db.UpdateFamily(id, req.Name, req.Notes, req.Archived); err != nil {
 		serverError(w, "failed to update family", err)
 		return
 	}
+	if req.OrgID != nil {
+		if err := s.db.SetFamilyOrg(id, *req.OrgID); err != nil {
+			serverError(w, "failed to update family", err)
+			return
+		}
+	}
 
 	family, _ := s.db.GetFamily(id)
 	jsonOK(w, family)
@@ -198,6 +251,9 @@ func (s *Server) listAccessLinks(w http.ResponseWriter, r *http.Request) {
 		serverError(w, "failed to list access links", err)
 		return
 	}
+	if seq, err := s.db.FamilySeq(familyID); err == nil {
+		setLinkLag(links, seq)
+	}
 
 	jsonOK(w, links)
 }
@@ -207,14 +263,32 @@ func (s *Server) createAccessLink(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		Label     string `json:"label"`
+		Role      string `json:"role"` // default full
 		ExpiresAt *int64 `json:"expires_at"`
+		permissionsRequest
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	if req.Role == "" {
+		req.Role = roleFull
+	}
+	if !linkRoles[req.Role] {
+		validationError(w, map[string]string{"role": "must be full or summary"})
+		return
+	}
+
+	if err := s.checkLinkQuota(familyID); err != nil {
+		if qe, ok := err.(*QuotaError); ok {
+			jsonError(w, http.StatusForbidden, errCodeQuota, qe.Error())
+			return
+		}
+		serverError(w, "failed to check link quota", err)
 		return
 	}
 
-	link, err := s.db.CreateAccessLink(familyID, req.Label, req.ExpiresAt)
+	link, err := s.db.CreateAccessLinkWith(familyID, req.Label, req.Role, req.apply(allPermissions), req.ExpiresAt)
 	if err != nil {
 		serverError(w, "failed to create access link", err)
 		return
@@ -223,40 +297,168 @@ func (s *Server) createAccessLink(w http.ResponseWriter, r *http.Request) {
 	jsonCreated(w, link)
 }
 
+// deleteAccessLink revokes the link named in the path by ID, or by its
+// token for callers that kept it.
 func (s *Server) deleteAccessLink(w http.ResponseWriter, r *http.Request) {
-	token := r.PathValue("token")
-
-	if err := s.db.DeleteAccessLink(token); err != nil {
+	id, err := s.db.DeleteAccessLink(r.PathValue("id"), r.PathValue("token"))
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "link not found")
+		return
+	}
+	if err != nil {
 		serverError(w, "failed to delete access link", err)
 		return
 	}
+	s.hub.RevokeLink(id, "revoked")
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// Client token handler
+// permissionsRequest is the optional capability flags in a link request;
+// omitted ones are left as they are.
+type permissionsRequest struct {
+	CanDelete     *bool `json:"can_delete"`
+	CanEditConfig *bool `json:"can_edit_config"`
+	CanExport     *bool `json:"can_export"`
+}
+
+func (req permissionsRequest) apply(p LinkPermissions) LinkPermissions {
+	if req.CanDelete != nil {
+		p.CanDelete = *req.CanDelete
+	}
+	if req.CanEditConfig != nil {
+		p.CanEditConfig = *req.CanEditConfig
+	}
+	if req.CanExport != nil {
+		p.CanExport = *req.CanExport
+	}
+	return p
+}
+
+// updateAccessLink handles PATCH /admin/families/{id}/links/{token}, which
+// changes a link's capabilities. Its connected devices reconnect to pick
+// them up.
+func (s *Server) updateAccessLink(w http.ResponseWriter, r *http.Request) {
+	var req permissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	link, err := s.findAccessLink(r.PathValue("id"), r.PathValue("token"))
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "link not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to load access link", err)
+		return
+	}
+	link.LinkPermissions = req.apply(link.LinkPermissions)
+	if err := s.db.SetLinkPermissions(link.ID, link.LinkPermissions); err != nil {
+		serverError(w, "failed to update access link", err)
+		return
+	}
+	s.hub.CloseLink(link.ID, websocket.CloseServiceRestart, "link permissions changed")
+	jsonOK(w, link)
+}
+
+// findAccessLink returns the family's link with the given ID.
+func (s *Server) findAccessLink(familyID, id string) (*AccessLink, error) {
+	links, err := s.db.ListAccessLinks(familyID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range links {
+		if links[i].ID == id {
+			return &links[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Client token handlers
 
+// handleClientToken handles GET /t/{token}: the page to open the app with
+// an access link, which posts back to useClientToken, so a link preview's
+// GET doesn't sign a device in.
 func (s *Server) handleClientToken(w http.ResponseWriter, r *http.Request) {
-	token := r.PathValue("token")
+	if s.maintenance.State().Enabled {
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		http.Error(w, "The server is under maintenance. Open the link again later.", http.StatusServiceUnavailable)
+		return
+	}
+	if _, err := s.db.ValidateAccessLink(r.PathValue("token")); err != nil {
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid or expired link")
+		return
+	}
+	s.serveConfirm(w, confirmPage{
+		Title:   "Open " + s.appName(""),
+		Message: "Sign in on the phone you'll use to keep track.",
+		Button:  "Open",
+	})
+}
 
+// useClientToken handles POST /t/{token}: signs the device in with a new
+// session for the link and opens the app.
+func (s *Server) useClientToken(w http.ResponseWriter, r *http.Request) {
+	if s.maintenance.State().Enabled {
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		http.Error(w, "The server is under maintenance. Open the link again later.", http.StatusServiceUnavailable)
+		return
+	}
+	token := r.PathValue("token")
 	link, err := s.db.ValidateAccessLink(token)
 	if err != nil {
-		http.Error(w, "invalid or expired link", http.StatusUnauthorized)
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid or expired link")
+		return
+	}
+	// The device gets a session, not the token, but the link still rotates
+	// when due
+	if _, err := s.nextLinkToken(link, token, time.Now()); err != nil {
+		loggerFromCtx(r.Context()).Error("failed to rotate access link", "error", err)
+	}
+
+	if err := s.startSession(w, r, link); err != nil {
+		serverError(w, "failed to start session", err)
 		return
 	}
+	s.openApp(w, r, link)
+}
 
+// openApp redirects a device just signed in with link to the app, with
+// family context, or the summary page for summary links.
+func (s *Server) openApp(w http.ResponseWriter, r *http.Request, link *AccessLink) {
+	if link.Role == roleSummary {
+		http.Redirect(w, r, s.basePath+"/summary", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, s.basePath+"/?family="+link.FamilyID, http.StatusFound)
+}
+
+// setClientSession sets the cookie that authenticates a client with token,
+// for as long as a session lasts unused.
+func (s *Server) setClientSession(w http.ResponseWriter, r *http.Request, token string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "client_session",
 		Value:    token,
-		Path:     "/",
+		Path:     s.cookiePath(),
 		HttpOnly: true,
-		Secure:   r.TLS != nil,
+		Secure:   isSecure(r),
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   86400 * 30, // 30 days
+		MaxAge:   int(s.sessionTTL() / time.Second),
 	})
+}
 
-	// Redirect to app with family context
-	http.Redirect(w, r, "/?family="+link.FamilyID, http.StatusFound)
+// clearClientSession removes the client_session cookie.
+func (s *Server) clearClientSession(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "client_session",
+		Path:     s.cookiePath(),
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
 }
 
 // Summary handler
@@ -267,78 +469,118 @@ type HourlySummary struct {
 }
 
 type EntrySummary struct {
-	Time  string `json:"time"`
-	Type  string `json:"type"`
-	Value string `json:"value"`
+	Time       string          `json:"time"`
+	Type       string          `json:"type"`
+	Value      string          `json:"value"`
+	TypeLabel  string          `json:"type_label"`
+	ValueLabel string          `json:"value_label"`
+	Author     string          `json:"author,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
 }
 
 type DailySummary struct {
-	Date       string          `json:"date"`
-	Hours      []HourlySummary `json:"hours"`
-	Totals     map[string]int  `json:"totals"`
-	TotalSleep string          `json:"total_sleep"`
+	Date       string                    `json:"date"`
+	DateLabel  string                    `json:"date_label"` // localized, e.g. "Sunday 25 January 2026"
+	Locale     string                    `json:"locale"`
+	Hours      []HourlySummary           `json:"hours"`
+	Totals     map[string]int            `json:"totals"`
+	Labels     map[string]string         `json:"labels"` // localized names for the Totals keys
+	TotalSleep string                    `json:"total_sleep"`
+	Authors    map[string]*AuthorSummary `json:"authors,omitempty"` // by link label
+	Feeding    *FeedingSummary           `json:"feeding,omitempty"`
+	Pumping    *PumpingSummary           `json:"pumping,omitempty"`
 }
 
+// AuthorSummary counts one caregiver's entries for the day, with those
+// logged overnight (before nightEndHour or from nightStartHour) broken out
+// so night shifts can be compared.
+type AuthorSummary struct {
+	Entries int `json:"entries"`
+	Night   int `json:"night"`
+}
+
+const (
+	nightStartHour = 22
+	nightEndHour   = 6
+)
+
 func (s *Server) getFamilySummary(w http.ResponseWriter, r *http.Request) {
-	familyID := r.PathValue("id")
-	dateStr := r.URL.Query().Get("date")
-	offsetStr := r.URL.Query().Get("offset")
+	s.summaryReport(w, r, r.PathValue("id"))
+}
 
-	// Parse offset in minutes (default to 0 = UTC)
-	offsetMins := 0
-	if offsetStr != "" {
-		parsed, err := strconv.Atoi(offsetStr)
-		if err != nil {
-			http.Error(w, "invalid offset", http.StatusBadRequest)
-			return
-		}
-		offsetMins = parsed
+// handleSummary serves GET /api/v1/summary for the link's family.
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	s.summaryReport(w, r, accessLinkFrom(r.Context()).FamilyID)
+}
+
+func (s *Server) summaryReport(w http.ResponseWriter, r *http.Request, familyID string) {
+	startTime, _, ok := parseDayParams(w, r)
+	if !ok {
+		return
 	}
-	loc := time.FixedZone("client", offsetMins*60)
 
-	// Parse date (default to today in client's timezone)
-	var startTime time.Time
-	if dateStr != "" {
-		parsed, err := time.ParseInLocation("2006-01-02", dateStr, loc)
-		if err != nil {
-			http.Error(w, "invalid date format (use YYYY-MM-DD)", http.StatusBadRequest)
-			return
-		}
-		startTime = parsed
-	} else {
-		now := time.Now().In(loc)
-		startTime = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	settings, _ := s.db.GetFamilySettings(familyID) // unknown family: defaults
+	childID := r.URL.Query().Get("child")
+	summary, err := s.dailySummary(familyID, childID, startTime, resolveLocale(r, settings.Locale))
+	if err != nil {
+		serverError(w, "failed to build summary", err)
+		return
 	}
+	jsonOK(w, summary)
+}
 
+// buildDailySummary summarises the day starting at startTime, in its
+// location.
+func buildDailySummary(db EntryStore, familyID, childID string, startTime time.Time, locale *Locale) (*DailySummary, error) {
+	loc := startTime.Location()
 	endTime := startTime.Add(24 * time.Hour)
 	startMs := startTime.UnixMilli()
 	endMs := endTime.UnixMilli()
 
-	entries, err := s.db.GetEntriesForDate(familyID, startMs, endMs)
+	entries, err := db.GetEntriesForDate(familyID, startMs, endMs)
 	if err != nil {
-		serverError(w, "failed to get entries", err)
-		return
+		return nil, err
 	}
+	entries = entriesForChild(entries, childID)
 
 	// Calculate total sleep time
-	totalSleepMins := calculateSleepMinutes(s.db, familyID, entries, startTime, endTime)
+	totalSleepMins := calculateSleepMinutes(db, familyID, childID, entries, startTime, endTime)
 
 	// Group by hour
 	hourlyMap := make(map[int][]EntrySummary)
 	totals := make(map[string]int)
+	labels := make(map[string]string)
+	authors := make(map[string]*AuthorSummary)
 
 	for _, e := range entries {
 		t := time.UnixMilli(e.Ts).In(loc)
 		hour := t.Hour()
 
 		hourlyMap[hour] = append(hourlyMap[hour], EntrySummary{
-			Time:  t.Format("15:04"),
-			Type:  e.Type,
-			Value: e.Value,
+			Time:       locale.FormatTime(t),
+			Type:       e.Type,
+			Value:      e.Value,
+			TypeLabel:  locale.TypeLabel(e.Type),
+			ValueLabel: locale.ValueLabel(e.Value),
+			Author:     e.Author,
+			Data:       e.Data,
 		})
 
+		if e.Author != "" {
+			a := authors[e.Author]
+			if a == nil {
+				a = &AuthorSummary{}
+				authors[e.Author] = a
+			}
+			a.Entries++
+			if hour < nightEndHour || hour >= nightStartHour {
+				a.Night++
+			}
+		}
+
 		// Count by type
 		totals[e.Type]++
+		labels[e.Type] = locale.TypeLabel(e.Type)
 	}
 
 	// Build hours array (only hours with data)
@@ -352,18 +594,89 @@ func (s *Server) getFamilySummary(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	summary := DailySummary{
+	pumping, err := pumpingSummary(db, familyID, startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DailySummary{
 		Date:       startTime.Format("2006-01-02"),
+		DateLabel:  locale.FormatDate(startTime),
+		Locale:     locale.Tag,
 		Hours:      hours,
 		Totals:     totals,
-		TotalSleep: formatDuration(totalSleepMins),
+		Labels:     labels,
+		TotalSleep: locale.FormatDuration(totalSleepMins),
+		Authors:    authors,
+		Feeding:    feedingSummary(entries),
+		Pumping:    pumping,
+	}, nil
+}
+
+// parseDayParams reads the date (YYYY-MM-DD, default today) and offset
+// (minutes east of UTC, default 0) query parameters shared by day-based admin
+// views. It writes a validation error and returns ok=false on bad input.
+func parseDayParams(w http.ResponseWriter, r *http.Request) (time.Time, *time.Location, bool) {
+	dateStr := r.URL.Query().Get("date")
+	offsetStr := r.URL.Query().Get("offset")
+
+	// Parse offset in minutes (default to 0 = UTC)
+	offsetMins := 0
+	if offsetStr != "" {
+		parsed, err := strconv.Atoi(offsetStr)
+		if err != nil {
+			validationError(w, map[string]string{"offset": "must be an integer number of minutes"})
+			return time.Time{}, nil, false
+		}
+		offsetMins = parsed
 	}
+	loc := time.FixedZone("client", offsetMins*60)
 
-	jsonOK(w, summary)
+	// Parse date (default to today in client's timezone)
+	var startTime time.Time
+	if dateStr != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", dateStr, loc)
+		if err != nil {
+			validationError(w, map[string]string{"date": "invalid format (use YYYY-MM-DD)"})
+			return time.Time{}, nil, false
+		}
+		startTime = parsed
+	} else {
+		now := time.Now().In(loc)
+		startTime = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	}
+
+	return startTime, loc, true
+}
+
+// parseRangeParams reads ?from= and ?to= as ms timestamps, defaulting to the
+// span up to now. On failure it writes a validation error and returns false.
+func parseRangeParams(w http.ResponseWriter, r *http.Request, span time.Duration) (from, to int64, ok bool) {
+	now := time.Now()
+	from, to = now.Add(-span).UnixMilli(), now.UnixMilli()+1
+	fields := map[string]string{}
+	for name, dst := range map[string]*int64{"from": &from, "to": &to} {
+		if v := r.URL.Query().Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				fields[name] = "must be a timestamp in milliseconds"
+				continue
+			}
+			*dst = n
+		}
+	}
+	if len(fields) == 0 && to <= from {
+		fields["to"] = "must be after from"
+	}
+	if len(fields) > 0 {
+		validationError(w, fields)
+		return 0, 0, false
+	}
+	return from, to, true
 }
 
 // calculateSleepMinutes calculates total sleep minutes for a day, handling cross-day sleep
-func calculateSleepMinutes(db *DB, familyID string, entries []Entry, dayStart, dayEnd time.Time) int {
+func calculateSleepMinutes(db EntryStore, familyID, childID string, entries []Entry, dayStart, dayEnd time.Time) int {
 	// Filter sleep events
 	var sleepEvents []Entry
 	for _, e := range entries {
@@ -376,7 +689,7 @@ func calculateSleepMinutes(db *DB, familyID string, entries []Entry, dayStart, d
 	var currentSleepStart *time.Time
 
 	// Check if day starts during a sleep period
-	lastSleepBefore, err := db.GetLastSleepEventBefore(familyID, dayStart.UnixMilli())
+	lastSleepBefore, err := db.GetLastChildEntryBefore(familyID, childID, "sleep", dayStart.UnixMilli())
 	if err == nil && lastSleepBefore != nil {
 		if lastSleepBefore.Value == "sleeping" || lastSleepBefore.Value == "nap" {
 			t := time.UnixMilli(lastSleepBefore.Ts)
@@ -439,3 +752,45 @@ func formatDuration(mins int) string {
 	minutes := mins % 60
 	return strconv.Itoa(hours) + "h " + strconv.Itoa(minutes) + "m"
 }
+
+// Client log handlers
+
+// clientLogLevels maps a minimum level filter to the levels it includes.
+var clientLogLevels = map[string][]string{
+	"error": {"error"},
+	"warn":  {"warn", "error"},
+	"info":  nil, // everything
+}
+
+func (s *Server) listClientLogs(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	q := r.URL.Query()
+
+	levels, ok := clientLogLevels[q.Get("level")]
+	if q.Get("level") != "" && !ok {
+		validationError(w, map[string]string{"level": "must be one of error, warn, info"})
+		return
+	}
+
+	startMs, endMs := int64(0), time.Now().Add(time.Hour).UnixMilli()
+	if q.Get("date") != "" {
+		startTime, _, ok := parseDayParams(w, r)
+		if !ok {
+			return
+		}
+		startMs, endMs = startTime.UnixMilli(), startTime.Add(24*time.Hour).UnixMilli()
+	}
+
+	limit := 200
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= maxClientLogsPerFamily {
+		limit = l
+	}
+
+	logs, err := s.db.ListClientLogs(familyID, levels, startMs, endMs, limit)
+	if err != nil {
+		serverError(w, "failed to list client logs", err)
+		return
+	}
+
+	jsonOK(w, logs)
+}
@@ -1,8 +1,9 @@
-package main
+package babytrack
 
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -23,7 +24,7 @@ func setupTestServer(t *testing.T) (*Server, func()) {
 		t.Fatalf("failed to create admin: %v", err)
 	}
 
-	s := &Server{db: db}
+	s := &Server{db: db, hub: NewHub(db)}
 	cleanup := func() {
 		db.Close()
 		os.Remove(path)
@@ -200,17 +201,49 @@ func TestAccessLinks(t *testing.T) {
 		t.Errorf("expected 1 link, got %d", len(links))
 	}
 
-	// Client can use the token
+	// Client can use the token, confirming first, but not in maintenance
 	req = httptest.NewRequest("GET", "/t/"+link.Token, nil)
 	req.SetPathValue("token", link.Token)
 	w = httptest.NewRecorder()
 
 	s.handleClientToken(w, req)
 
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 0 {
+		t.Errorf("expected a confirm page, got %d %v", w.Code, w.Result().Cookies())
+	}
+
+	s.maintenance.Set(MaintenanceState{Enabled: true})
+	w = httptest.NewRecorder()
+	s.handleClientToken(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("in maintenance expected 503, got %d", w.Code)
+	}
+	s.maintenance.Set(MaintenanceState{})
+
+	req = httptest.NewRequest("POST", "/t/"+link.Token, nil)
+	req.SetPathValue("token", link.Token)
+	w = httptest.NewRecorder()
+
+	s.useClientToken(w, req)
+
 	if w.Code != http.StatusFound {
 		t.Errorf("expected 302 redirect, got %d", w.Code)
 	}
 
+	// Another family's path doesn't reach it
+	other, _ := s.db.CreateFamily("Other Baby", "")
+	req = httptest.NewRequest("DELETE", "/admin/families/"+other.ID+"/links/"+link.Token, nil)
+	req.SetPathValue("id", other.ID)
+	req.SetPathValue("token", link.Token)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+
+	s.adminRequired(s.deleteAccessLink)(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("delete from another family expected 404, got %d", w.Code)
+	}
+
 	// Delete link
 	req = httptest.NewRequest("DELETE", "/admin/families/"+family.ID+"/links/"+link.Token, nil)
 	req.SetPathValue("id", family.ID)
@@ -391,3 +424,87 @@ func TestSummaryTotalSleep(t *testing.T) {
 		t.Errorf("expected '6h 0m' total sleep (midnight to 06:00), got '%s'", summary.TotalSleep)
 	}
 }
+
+func TestSummaryAuthors(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	day, _ := time.Parse("2006-01-02", "2026-01-25")
+	for i, e := range []struct {
+		hour   int
+		author string
+	}{{3, "Dad"}, {4, "Dad"}, {10, "Mum"}, {23, "Mum"}, {12, ""}} {
+		s.db.UpsertEntry(&Entry{
+			ID: fmt.Sprintf("e%d", i), FamilyID: family.ID, Type: "feed", Value: "bf",
+			Ts: day.Add(time.Duration(e.hour) * time.Hour).UnixMilli(), Author: e.author,
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/summary?date=2026-01-25&offset=0", nil)
+	req.SetPathValue("id", family.ID)
+	w := httptest.NewRecorder()
+	s.getFamilySummary(w, req)
+
+	var summary DailySummary
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	want := map[string]AuthorSummary{"Dad": {Entries: 2, Night: 2}, "Mum": {Entries: 2, Night: 1}}
+	if len(summary.Authors) != len(want) {
+		t.Fatalf("authors = %v", summary.Authors)
+	}
+	for label, a := range want {
+		if got := summary.Authors[label]; got == nil || *got != a {
+			t.Errorf("%s: got %+v, want %+v", label, got, a)
+		}
+	}
+	if author := summary.Hours[0].Entries[0].Author; author != "Dad" {
+		t.Errorf("first entry author = %q", author)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	token, _ := s.db.CreateAdminSession("admin", 24*3600*1000)
+	cookie := &http.Cookie{Name: "admin_session", Value: token}
+
+	// Missing name is a field-level validation error
+	req := httptest.NewRequest("POST", "/admin/families", bytes.NewBufferString(`{"notes":"x"}`))
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+
+	s.adminRequired(s.createFamily)(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+
+	var resp struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse error envelope: %v (%s)", err, w.Body.String())
+	}
+	if resp.Error.Code != errCodeValidation {
+		t.Errorf("expected code %s, got %s", errCodeValidation, resp.Error.Code)
+	}
+	if resp.Error.Fields["name"] == "" {
+		t.Errorf("expected field error for name, got %+v", resp.Error.Fields)
+	}
+
+	// Unauthenticated requests get the unauthorized code
+	req = httptest.NewRequest("GET", "/admin/families", nil)
+	w = httptest.NewRecorder()
+
+	s.adminRequired(s.listFamilies)(w, req)
+
+	resp.Error = APIError{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Error.Code != errCodeUnauthorized {
+		t.Errorf("expected code %s, got %q", errCodeUnauthorized, resp.Error.Code)
+	}
+}
@@ -0,0 +1,209 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Announcements are notices from the admin, e.g. "server maintenance
+// tonight at 2am", to one family or all of them. Connected clients get them
+// straight away and clients connecting later get them after init, until
+// they expire. Clients show each once and remember which were dismissed.
+
+const (
+	defaultAnnouncementTTL = 24 * time.Hour
+	maxAnnouncementLen     = 500
+)
+
+type Announcement struct {
+	ID        string `json:"id"`
+	FamilyID  string `json:"family_id,omitempty"` // empty for all families
+	Message   string `json:"message"`
+	AdminID   string `json:"admin_id,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// CreateAnnouncement stores a.
+func (db *DB) CreateAnnouncement(a *Announcement) error {
+	_, err := db.Exec(
+		`INSERT INTO announcements (id, family_id, message, admin_id, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		a.ID, nullString(a.FamilyID), a.Message, nullString(a.AdminID), a.CreatedAt, a.ExpiresAt,
+	)
+	return err
+}
+
+// ActiveAnnouncements returns the announcements for familyID that haven't
+// expired by now, oldest first. With familyID empty it returns every
+// family's.
+func (db *DB) ActiveAnnouncements(familyID string, now int64) ([]Announcement, error) {
+	rows, err := db.Query(
+		`SELECT id, family_id, message, admin_id, created_at, expires_at FROM announcements
+		 WHERE expires_at > ? AND (? = '' OR family_id IS NULL OR family_id = ?)
+		 ORDER BY created_at`,
+		now, familyID, familyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	announcements := []Announcement{}
+	for rows.Next() {
+		var a Announcement
+		var familyID, adminID sql.NullString
+		if err := rows.Scan(&a.ID, &familyID, &a.Message, &adminID, &a.CreatedAt, &a.ExpiresAt); err != nil {
+			return nil, err
+		}
+		a.FamilyID, a.AdminID = familyID.String, adminID.String
+		announcements = append(announcements, a)
+	}
+	return announcements, rows.Err()
+}
+
+// DeleteAnnouncement withdraws an announcement. Returns sql.ErrNoRows if
+// there is no such announcement.
+func (db *DB) DeleteAnnouncement(id string) error {
+	res, err := db.Exec("DELETE FROM announcements WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func announcementMessage(a Announcement) []byte {
+	msg, _ := json.Marshal(map[string]any{
+		"type":       "announcement",
+		"id":         a.ID,
+		"message":    a.Message,
+		"created_at": a.CreatedAt,
+		"expires_at": a.ExpiresAt,
+	})
+	return msg
+}
+
+// sendAnnouncements sends a newly connected client its family's active
+// announcements.
+func (s *Server) sendAnnouncements(c *Client) {
+	announcements, err := s.db.ActiveAnnouncements(c.familyID, time.Now().UnixMilli())
+	if err != nil {
+		return
+	}
+	for _, a := range announcements {
+		c.trySend(announcementMessage(a))
+	}
+}
+
+// BroadcastAll sends msg to every connected client of every family.
+func (h *Hub) BroadcastAll(msg []byte) {
+	h.broadcastAll(msg)
+	h.relay(busMessage{Kind: "broadcast_all", Msg: msg})
+}
+
+func (h *Hub) broadcastAll(msg []byte) {
+	h.mu.RLock()
+	families := make([]string, 0, len(h.families))
+	for familyID := range h.families {
+		families = append(families, familyID)
+	}
+	h.mu.RUnlock()
+
+	for _, familyID := range families {
+		h.broadcast(familyID, msg, nil)
+	}
+}
+
+// handleAnnounce handles POST /admin/announce: {message, family_id?,
+// expires_at?}. Without family_id it goes to every family.
+func (s *Server) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message   string `json:"message"`
+		FamilyID  string `json:"family_id"`
+		ExpiresAt int64  `json:"expires_at"` // ms; default a day from now
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	now := time.Now()
+	if req.ExpiresAt == 0 {
+		req.ExpiresAt = now.Add(defaultAnnouncementTTL).UnixMilli()
+	}
+	fields := map[string]string{}
+	switch {
+	case req.Message == "":
+		fields["message"] = "required"
+	case len(req.Message) > maxAnnouncementLen:
+		fields["message"] = "at most " + strconv.Itoa(maxAnnouncementLen) + " bytes"
+	}
+	if req.ExpiresAt <= now.UnixMilli() {
+		fields["expires_at"] = "must be in the future"
+	}
+	if len(fields) > 0 {
+		validationError(w, fields)
+		return
+	}
+	if req.FamilyID == "" && adminOrg(r) != "" {
+		jsonError(w, http.StatusForbidden, errCodeForbidden, "org admins can only announce to one of their families")
+		return
+	}
+	if req.FamilyID != "" {
+		if _, err := s.db.GetFamily(req.FamilyID); err != nil || !s.familyInOrg(req.FamilyID, adminOrg(r)) {
+			jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+			return
+		}
+	}
+
+	a := Announcement{
+		ID:        generateToken(8),
+		FamilyID:  req.FamilyID,
+		Message:   req.Message,
+		AdminID:   r.Header.Get("X-Admin-ID"),
+		CreatedAt: now.UnixMilli(),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.db.CreateAnnouncement(&a); err != nil {
+		serverError(w, "failed to save announcement", err)
+		return
+	}
+	if a.FamilyID != "" {
+		s.hub.Broadcast(a.FamilyID, announcementMessage(a), nil)
+	} else {
+		s.hub.BroadcastAll(announcementMessage(a))
+	}
+	jsonCreated(w, a)
+}
+
+// listAnnouncements handles GET /admin/announcements, the ones not yet
+// expired.
+func (s *Server) listAnnouncements(w http.ResponseWriter, r *http.Request) {
+	announcements, err := s.db.ActiveAnnouncements("", time.Now().UnixMilli())
+	if err != nil {
+		serverError(w, "failed to list announcements", err)
+		return
+	}
+	jsonOK(w, announcements)
+}
+
+// deleteAnnouncement handles DELETE /admin/announcements/{id}. Clients
+// connecting later won't get it; ones already showing it keep it until
+// dismissed.
+func (s *Server) deleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	err := s.db.DeleteAnnouncement(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "announcement not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to delete announcement", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAnnounce(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	ada, _ := db.CreateFamily("Ada", "")
+	bob, _ := db.CreateFamily("Bob", "")
+	adaLink, _ := db.CreateAccessLink(ada.ID, "Mum", nil)
+	bobLink, _ := db.CreateAccessLinkRole(bob.ID, "Grandma", roleSummary, nil)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	dial := func(token string) *websocket.Conn {
+		header := http.Header{"Cookie": {"client_session=" + token}}
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		skipUntilType(t, conn, "init")
+		return conn
+	}
+	announce := func(body string) (int, Announcement) {
+		req := httptest.NewRequest("POST", "/admin/announce", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.handleAnnounce(w, req)
+		var a Announcement
+		json.Unmarshal(w.Body.Bytes(), &a)
+		return w.Code, a
+	}
+
+	adaConn := dial(adaLink.Token)
+	defer adaConn.Close()
+	bobConn := dial(bobLink.Token)
+	defer bobConn.Close()
+
+	// To everyone, summary links included
+	code, all := announce(`{"message":"Maintenance at 2am"}`)
+	if code != http.StatusCreated || all.ExpiresAt <= time.Now().UnixMilli() {
+		t.Fatalf("announce: %d %+v", code, all)
+	}
+	for _, conn := range []*websocket.Conn{adaConn, bobConn} {
+		if m := skipUntilType(t, conn, "announcement"); m["id"] != all.ID || m["message"] != "Maintenance at 2am" {
+			t.Errorf("got %v", m)
+		}
+	}
+
+	// To one family
+	code, one := announce(`{"message":"Hi Ada","family_id":"` + ada.ID + `"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("announce to family: %d", code)
+	}
+	if m := skipUntilType(t, adaConn, "announcement"); m["id"] != one.ID {
+		t.Errorf("got %v", m)
+	}
+
+	// Clients connecting later get what's still active
+	later := dial(adaLink.Token)
+	defer later.Close()
+	for _, want := range []string{all.ID, one.ID} {
+		if m := skipUntilType(t, later, "announcement"); m["id"] != want {
+			t.Errorf("got %v, want %s", m["id"], want)
+		}
+	}
+	if got, _ := db.ActiveAnnouncements(bob.ID, time.Now().UnixMilli()); len(got) != 1 || got[0].ID != all.ID {
+		t.Errorf("bob's announcements = %+v", got)
+	}
+	if got, _ := db.ActiveAnnouncements(ada.ID, one.ExpiresAt); len(got) != 0 {
+		t.Errorf("expired announcements still active: %+v", got)
+	}
+
+	req := httptest.NewRequest("DELETE", "/admin/announcements/"+one.ID, nil)
+	req.SetPathValue("id", one.ID)
+	w := httptest.NewRecorder()
+	s.deleteAnnouncement(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("delete: %d", w.Code)
+	}
+	if got, _ := db.ActiveAnnouncements(ada.ID, time.Now().UnixMilli()); len(got) != 1 {
+		t.Errorf("after delete: %+v", got)
+	}
+
+	for body, want := range map[string]int{
+		`{}`:                             http.StatusBadRequest,
+		`{"message":"x","expires_at":1}`: http.StatusBadRequest,
+		`{"message":"` + strings.Repeat("x", maxAnnouncementLen+1) + `"}`: http.StatusBadRequest,
+		`{"message":"x","family_id":"nope"}`:                              http.StatusNotFound,
+	} {
+		if code, _ := announce(body); code != want {
+			t.Errorf("%.40s: got %d, want %d", body, code, want)
+		}
+	}
+}
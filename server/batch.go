@@ -0,0 +1,219 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// POST /api/v1/entries/batch saves many entries in one request and one
+// transaction, for a device or script with a large offline backlog. Each
+// entry is checked as a WS entry message would be and gets its own result;
+// rejected entries don't stop the rest being saved.
+
+const (
+	maxBatchEntries = 5000
+	maxBatchBytes   = 16 << 20
+
+	// maxBatchBroadcast is the most entries a batch sends connected
+	// clients one by one; after a bigger batch they reconnect and resync.
+	maxBatchBroadcast = 100
+)
+
+// BatchResult is the outcome for one entry of a batch.
+type BatchResult struct {
+	ID     string      `json:"id"`
+	Status string      `json:"status"` // "saved" or "rejected"
+	Seq    int64       `json:"seq,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Quota  *QuotaError `json:"quota,omitempty"`
+}
+
+// batchQuota tracks a family's quota usage across a batch, since entries
+// in it aren't counted by QuotaUsage until it's committed.
+type batchQuota struct {
+	quotas Quotas
+	usage  QuotaUsage
+}
+
+// add counts e, replacing old if it's an update, or returns a *QuotaError
+// if that would take the family over a quota. Updates count only the
+// growth in data.
+func (b *batchQuota) add(old, e *Entry) *QuotaError {
+	if old == nil && b.quotas.EntriesPerDay > 0 && b.usage.EntriesPerDay >= b.quotas.EntriesPerDay {
+		return &QuotaError{Quota: "entries_per_day", Limit: int64(b.quotas.EntriesPerDay)}
+	}
+	growth := dataGrowth(old, e)
+	if b.quotas.DataBytes > 0 && growth > 0 && b.usage.DataBytes+growth > b.quotas.DataBytes {
+		return &QuotaError{Quota: "data_bytes", Limit: b.quotas.DataBytes}
+	}
+	if old == nil {
+		b.usage.EntriesPerDay++
+	}
+	b.usage.DataBytes += growth
+	return nil
+}
+
+// checkBatchEntry validates e from link as handleEntryMessage would,
+// except that invalid fields reject the entry rather than being dropped.
+func (s *Server) checkBatchEntry(e *Entry, link *AccessLink) error {
+	if e.ID == "" {
+		return errors.New("id is required")
+	}
+	if e.Type == "" {
+		return errors.New("type is required")
+	}
+	if e.Deleted && !link.CanDelete {
+		return errors.New("this link can't delete entries")
+	}
+	if be := s.entryBounds().check(e, time.Now()); be != nil {
+		return be
+	}
+	if err := validateDuration(e); err != nil {
+		return err
+	}
+	if err := validateChildID(e, ""); err != nil {
+		return err
+	}
+	if err := validatePumpSide(e); err != nil {
+		return err
+	}
+	return validateEntryData(e)
+}
+
+// handleEntryBatch handles POST /api/v1/entries/batch: {"entries": [...]}.
+// Entries are saved like bulk sync entries, new or updated, except that med
+// doses aren't checked against their intervals: they were already given.
+func (s *Server) handleEntryBatch(w http.ResponseWriter, r *http.Request) {
+	link := accessLinkFrom(r.Context())
+	var req struct {
+		Entries []Entry `json:"entries"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBytes)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	if len(req.Entries) == 0 {
+		validationError(w, map[string]string{"entries": "required"})
+		return
+	}
+	if len(req.Entries) > maxBatchEntries {
+		validationError(w, map[string]string{"entries": fmt.Sprintf("at most %d per batch", maxBatchEntries)})
+		return
+	}
+
+	settings, _ := s.db.GetFamilySettings(link.FamilyID)
+	quota := batchQuota{quotas: s.quotasFor(settings)}
+	if quota.quotas.EntriesPerDay > 0 || quota.quotas.DataBytes > 0 {
+		u, err := s.db.QuotaUsage(link.FamilyID, time.Now())
+		if err != nil {
+			serverError(w, "failed to check entry quota", err)
+			return
+		}
+		quota.usage = u
+	}
+
+	results := make([]BatchResult, len(req.Entries))
+	var valid []Entry
+	var validIdx []int
+	seen := make(map[string]bool, len(req.Entries))
+	isNew := map[string]bool{}
+	for i := range req.Entries {
+		e := req.Entries[i]
+		e.FamilyID, e.Author = link.FamilyID, link.Label
+		results[i] = BatchResult{ID: e.ID, Status: "rejected"}
+		if err := s.checkBatchEntry(&e, link); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		normalizeEntryValue(&e)
+		if seen[e.ID] {
+			results[i].Error = "duplicate id in batch"
+			continue
+		}
+		seen[e.ID] = true
+		old, err := s.db.GetEntry(link.FamilyID, e.ID)
+		if err != nil && err != sql.ErrNoRows {
+			serverError(w, "failed to look up entry", err)
+			return
+		}
+		isNew[e.ID] = old == nil
+		if qe := quota.add(old, &e); qe != nil {
+			results[i].Error, results[i].Quota = qe.Error(), qe
+			continue
+		}
+		valid = append(valid, e)
+		validIdx = append(validIdx, i)
+	}
+
+	if len(valid) > 0 {
+		if err := s.db.UpsertEntries(valid); err != nil {
+			serverError(w, "failed to save entries", err)
+			return
+		}
+	}
+	for j, e := range valid {
+		results[validIdx[j]] = BatchResult{ID: e.ID, Status: "saved", Seq: e.Seq}
+	}
+
+	if len(valid) > 0 {
+		slog.Info("entry batch saved", "family_id", link.FamilyID, "label", link.Label, "saved", len(valid), "rejected", len(req.Entries)-len(valid))
+		s.hub.publishActivity(ActivityEvent{
+			Type: "entry", FamilyID: link.FamilyID, Label: link.Label,
+			Action: "batch", Seq: valid[len(valid)-1].Seq,
+			Message: fmt.Sprintf("%d entries in a batch", len(valid)),
+		})
+		now := time.Now().UnixMilli()
+		if err := s.db.RecordLinkEntry(link.ID, now); err != nil {
+			slog.Error("failed to record link entry", "error", err, "family_id", link.FamilyID)
+		}
+		s.broadcastBatch(link.FamilyID, valid)
+		for i := range valid {
+			if isNew[valid[i].ID] {
+				s.checkFever(link.FamilyID, link.Label, &valid[i])
+			}
+		}
+		s.publishState(link.FamilyID)
+	}
+
+	jsonOK(w, map[string]any{
+		"saved":    len(valid),
+		"rejected": len(req.Entries) - len(valid),
+		"results":  results,
+	})
+}
+
+// broadcastBatch tells connected clients about a saved batch: entry by
+// entry if it's small, otherwise by having them reconnect and resync from
+// their cursor.
+func (s *Server) broadcastBatch(familyID string, entries []Entry) {
+	if len(entries) > maxBatchBroadcast {
+		s.hub.CloseFamily(familyID, websocket.CloseServiceRestart, "entries imported")
+		return
+	}
+	for _, e := range entries {
+		var msg []byte
+		if e.Deleted {
+			msg, _ = json.Marshal(map[string]any{
+				"type":     "entry",
+				"action":   "delete",
+				"id":       e.ID,
+				"seq":      e.Seq,
+				"child_id": e.ChildID,
+			})
+		} else {
+			msg, _ = json.Marshal(map[string]any{
+				"type":   "entry",
+				"action": "add",
+				"entry":  e,
+			})
+		}
+		s.hub.Broadcast(familyID, msg, nil)
+	}
+}
@@ -0,0 +1,79 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEntryBatch(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLinkWith(family.ID, "Mum", roleFull, LinkPermissions{CanExport: true}, nil)
+	handler := s.routes()
+	post := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest("POST", "/api/v1/entries/batch", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "client_session", Value: link.Token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	ts := time.Now().UnixMilli()
+	s.db.UpsertEntry(&Entry{ID: "old", FamilyID: family.ID, Ts: ts, Type: "feed", Value: "bf"})
+	code, resp := post(fmt.Sprintf(`{"entries":[
+		{"id":"a","ts":%d,"type":"feed","value":"bf"},
+		{"id":"b","ts":%d,"type":"nappy","value":"wet"},
+		{"id":"a","ts":%d,"type":"feed","value":"bf"},
+		{"id":"c","ts":%d,"type":"sleep","ended_ts":1},
+		{"id":"","ts":%d,"type":"feed"},
+		{"id":"old","ts":%d,"type":"feed","deleted":true}
+	]}`, ts, ts, ts, ts, ts, ts))
+	if code != http.StatusOK || resp["saved"] != 2.0 || resp["rejected"] != 4.0 {
+		t.Fatalf("batch: %d %v", code, resp)
+	}
+	results := resp["results"].([]any)
+	for i, want := range []string{"saved", "saved", "rejected", "rejected", "rejected", "rejected"} {
+		if got := results[i].(map[string]any)["status"]; got != want {
+			t.Errorf("result %d = %v, want %s", i, results[i], want)
+		}
+	}
+	if e, err := s.db.GetEntry(family.ID, "b"); err != nil || e.Author != "Mum" || e.Seq == 0 {
+		t.Errorf("saved entry = %+v, %v", e, err)
+	}
+	if e, _ := s.db.GetEntry(family.ID, "old"); e.Deleted {
+		t.Error("deleted without permission")
+	}
+
+	// Quotas count entries earlier in the same batch
+	s.quotas.EntriesPerDay = 4 // three written above
+	_, resp = post(fmt.Sprintf(`{"entries":[
+		{"id":"d","ts":%d,"type":"feed"},
+		{"id":"e","ts":%d,"type":"feed"},
+		{"id":"a","ts":%d,"type":"feed","value":"formula"}
+	]}`, ts, ts, ts))
+	if resp["saved"] != 2.0 {
+		t.Errorf("over quota: %v", resp)
+	}
+	if q := resp["results"].([]any)[1].(map[string]any)["quota"]; q == nil {
+		t.Errorf("no quota in rejection: %v", resp)
+	}
+
+	var many []string
+	for i := range maxBatchEntries + 1 {
+		many = append(many, fmt.Sprintf(`{"id":"m%d","ts":%d,"type":"feed"}`, i, ts))
+	}
+	if code, _ := post(`{"entries":[` + strings.Join(many, ",") + `]}`); code != http.StatusBadRequest {
+		t.Errorf("oversized batch: %d", code)
+	}
+	if code, _ := post(`{"entries":[]}`); code != http.StatusBadRequest {
+		t.Errorf("empty batch: %d", code)
+	}
+}
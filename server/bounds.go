@@ -0,0 +1,111 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// EntryBounds are sanity limits on entries written by devices, so one with a
+// broken clock or a buggy client can't scatter entries into 2090 or fill
+// values with junk. Entries outside them are rejected rather than fixed up,
+// since the server can't know what was meant. Zero fields are unchecked.
+type EntryBounds struct {
+	MaxFuture   time.Duration // how far ahead of the server's clock ts may be
+	MaxAge      time.Duration // how far behind
+	MaxValueLen int           // bytes
+	MaxTypeLen  int           // bytes
+}
+
+// defaultEntryBounds leave room for back-filling a child's early months and
+// for devices a little fast, while catching clocks that are years out.
+var defaultEntryBounds = EntryBounds{
+	MaxFuture:   time.Hour,
+	MaxAge:      5 * 365 * 24 * time.Hour,
+	MaxValueLen: 200,
+	MaxTypeLen:  64,
+}
+
+// entryIDPattern is what clients, imports and the demo generate: UUIDs and
+// prefixed hex, with some room for integrations' own schemes.
+var entryIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,63}$`)
+
+// BoundsError says which field of an entry is out of bounds.
+type BoundsError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *BoundsError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// checkEntryID reports whether id has the known entry ID format.
+func checkEntryID(id string) *BoundsError {
+	if !entryIDPattern.MatchString(id) {
+		return &BoundsError{Field: "id", Message: "must be 1-64 letters, digits, '_', '.', ':' or '-'"}
+	}
+	return nil
+}
+
+// check returns a *BoundsError for the first field of e out of bounds as of
+// now, or nil. Deleted entries only need a valid ID.
+func (b EntryBounds) check(e *Entry, now time.Time) *BoundsError {
+	if err := checkEntryID(e.ID); err != nil {
+		return err
+	}
+	if e.Deleted {
+		return nil
+	}
+	nowMs := now.UnixMilli()
+	inRange := func(field string, ts int64) *BoundsError {
+		if b.MaxFuture > 0 && ts > nowMs+b.MaxFuture.Milliseconds() {
+			return &BoundsError{Field: field, Message: fmt.Sprintf("is more than %s in the future", formatBound(b.MaxFuture))}
+		}
+		if b.MaxAge > 0 && ts < nowMs-b.MaxAge.Milliseconds() {
+			return &BoundsError{Field: field, Message: fmt.Sprintf("is more than %s in the past", formatBound(b.MaxAge))}
+		}
+		return nil
+	}
+	if err := inRange("ts", e.Ts); err != nil {
+		return err
+	}
+	if e.EndedTs != nil {
+		if err := inRange("ended_ts", *e.EndedTs); err != nil {
+			return err
+		}
+	}
+	if b.MaxTypeLen > 0 && len(e.Type) > b.MaxTypeLen {
+		return &BoundsError{Field: "type", Message: fmt.Sprintf("is longer than %d bytes", b.MaxTypeLen)}
+	}
+	if b.MaxValueLen > 0 && len(e.Value) > b.MaxValueLen {
+		return &BoundsError{Field: "value", Message: fmt.Sprintf("is longer than %d bytes", b.MaxValueLen)}
+	}
+	return nil
+}
+
+// formatBound writes d in days, hours or minutes, whichever reads best.
+func formatBound(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return d.String()
+}
+
+// boundsRejection is the entry_rejected message for an entry out of bounds.
+func boundsRejection(id string, be *BoundsError) []byte {
+	msg, _ := json.Marshal(map[string]any{
+		"type":    "entry_rejected",
+		"id":      id,
+		"reason":  "out_of_bounds",
+		"field":   be.Field,
+		"message": be.Error(),
+	})
+	return msg
+}
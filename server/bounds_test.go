@@ -0,0 +1,91 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestEntryBoundsCheck(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ms := func(d time.Duration) int64 { return now.Add(d).UnixMilli() }
+	ended := ms(2 * time.Hour)
+	for _, tc := range []struct {
+		name  string
+		e     Entry
+		field string
+	}{
+		{"ok", Entry{ID: "7c9e6679-7425-40de-944b-e07fc1f90ae7", Ts: ms(0), Type: "feed", Value: "bf"}, ""},
+		{"slightly fast clock", Entry{ID: "e1", Ts: ms(30 * time.Minute), Type: "feed"}, ""},
+		{"future", Entry{ID: "e1", Ts: ms(64 * 365 * 24 * time.Hour), Type: "feed"}, "ts"},
+		{"ancient", Entry{ID: "e1", Ts: 0, Type: "feed"}, "ts"},
+		{"ended in future", Entry{ID: "e1", Ts: ms(0), EndedTs: &ended, Type: "feed"}, "ended_ts"},
+		{"long value", Entry{ID: "e1", Ts: ms(0), Type: "feed", Value: strings.Repeat("x", 201)}, "value"},
+		{"long type", Entry{ID: "e1", Ts: ms(0), Type: strings.Repeat("x", 65)}, "type"},
+		{"bad id", Entry{ID: "../etc", Ts: ms(0), Type: "feed"}, "id"},
+		{"long id", Entry{ID: strings.Repeat("a", 65), Ts: ms(0), Type: "feed"}, "id"},
+		{"deleted ignores ts", Entry{ID: "e1", Ts: 0, Deleted: true}, ""},
+	} {
+		be := defaultEntryBounds.check(&tc.e, now)
+		if tc.field == "" && be != nil {
+			t.Errorf("%s: unexpected %v", tc.name, be)
+		} else if tc.field != "" && (be == nil || be.Field != tc.field) {
+			t.Errorf("%s: got %v, want field %s", tc.name, be, tc.field)
+		}
+	}
+
+	if got := (EntryBounds{}).check(&Entry{ID: "e1"}, now); got != nil {
+		t.Errorf("zero bounds checked ts: %v", got)
+	}
+	if got := formatBound(time.Hour); got != "1h" {
+		t.Errorf("formatBound = %q", got)
+	}
+}
+
+func TestEntryBoundsWebSocket(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+
+	s := &Server{db: db, hub: NewHub(db), bounds: defaultEntryBounds}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+
+	future := time.Date(2090, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	conn.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "e1", "ts": future, "type": "feed", "value": "bf"}})
+	m := skipUntilType(t, conn, "entry_rejected")
+	if m["id"] != "e1" || m["reason"] != "out_of_bounds" || m["field"] != "ts" {
+		t.Errorf("got %v", m)
+	}
+
+	// Bulk sync rejects the bad entry and saves the rest
+	conn.WriteJSON(map[string]any{"type": "sync", "entries": []map[string]any{
+		{"id": "e2", "ts": future, "type": "feed"},
+		{"id": "e3", "ts": time.Now().UnixMilli(), "type": "feed"},
+	}})
+	if m := skipUntilType(t, conn, "entry_rejected"); m["id"] != "e2" {
+		t.Errorf("got %v", m)
+	}
+	if m := skipUntilType(t, conn, "entry_ack"); m["id"] != "e3" {
+		t.Errorf("got %v", m)
+	}
+	if db.EntryExists(family.ID, "e1") || db.EntryExists(family.ID, "e2") {
+		t.Error("out of bounds entry saved")
+	}
+}
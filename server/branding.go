@@ -0,0 +1,296 @@
+package babytrack
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"html"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// White-label branding: an app name, colors and a logo for practices that
+// deploy babytrack for their clients. Instance branding is set by server
+// admins; an org's branding (set by its admins) overrides it field by field
+// for that org's families and admins. Pages get it injected when served, and
+// scripts can read it from window.BRANDING or GET /api/v1/branding.
+
+const (
+	defaultAppName = "Baby Log"
+	maxAppNameLen  = 64
+	maxLogoURLLen  = 512
+)
+
+var brandColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Branding is a set of overrides; empty fields keep the default look.
+type Branding struct {
+	AppName         string `json:"app_name,omitempty"`
+	PrimaryColor    string `json:"primary_color,omitempty"`    // #rgb or #rrggbb
+	BackgroundColor string `json:"background_color,omitempty"` // #rgb or #rrggbb
+	LogoURL         string `json:"logo_url,omitempty"`         // a path on this server or an https URL
+}
+
+// validate returns a field error map, or nil if b is fine.
+func (b Branding) validate() map[string]string {
+	fields := map[string]string{}
+	if len(b.AppName) > maxAppNameLen {
+		fields["app_name"] = "at most 64 bytes"
+	}
+	if b.PrimaryColor != "" && !brandColor.MatchString(b.PrimaryColor) {
+		fields["primary_color"] = "must be #rgb or #rrggbb"
+	}
+	if b.BackgroundColor != "" && !brandColor.MatchString(b.BackgroundColor) {
+		fields["background_color"] = "must be #rgb or #rrggbb"
+	}
+	if u := b.LogoURL; u != "" {
+		local := strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "//")
+		switch {
+		case len(u) > maxLogoURLLen:
+			fields["logo_url"] = "at most 512 bytes"
+		case !local && !strings.HasPrefix(u, "https://"):
+			fields["logo_url"] = "must be a path on this server or an https URL"
+		case strings.ContainsAny(u, " \t\r\n\"'<>\\"):
+			fields["logo_url"] = "contains characters that aren't allowed"
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// over returns base with b's set fields replacing its own.
+func (b Branding) over(base Branding) Branding {
+	if b.AppName != "" {
+		base.AppName = b.AppName
+	}
+	if b.PrimaryColor != "" {
+		base.PrimaryColor = b.PrimaryColor
+	}
+	if b.BackgroundColor != "" {
+		base.BackgroundColor = b.BackgroundColor
+	}
+	if b.LogoURL != "" {
+		base.LogoURL = b.LogoURL
+	}
+	return base
+}
+
+// InstanceBranding returns the server-wide branding.
+func (db *DB) InstanceBranding() (Branding, error) {
+	var b Branding
+	var data string
+	err := db.QueryRow("SELECT value FROM server_settings WHERE name = 'branding'").Scan(&data)
+	if err == sql.ErrNoRows {
+		return b, nil
+	}
+	if err != nil {
+		return b, err
+	}
+	return b, json.Unmarshal([]byte(data), &b)
+}
+
+// SetInstanceBranding replaces the server-wide branding; an empty Branding
+// clears it.
+func (db *DB) SetInstanceBranding(b Branding) error {
+	if b == (Branding{}) {
+		_, err := db.Exec("DELETE FROM server_settings WHERE name = 'branding'")
+		return err
+	}
+	data, _ := json.Marshal(b)
+	_, err := db.Exec(
+		`INSERT INTO server_settings (name, value, updated_at) VALUES ('branding', ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		string(data), time.Now().UnixMilli(),
+	)
+	return err
+}
+
+// OrgBranding returns an org's own branding, without the instance's.
+func (db *DB) OrgBranding(orgID string) (Branding, error) {
+	var b Branding
+	var data sql.NullString
+	if err := db.QueryRow("SELECT branding FROM orgs WHERE id = ?", orgID).Scan(&data); err != nil {
+		return b, err
+	}
+	if !data.Valid {
+		return b, nil
+	}
+	return b, json.Unmarshal([]byte(data.String), &b)
+}
+
+// SetOrgBranding replaces an org's branding; an empty Branding clears it.
+func (db *DB) SetOrgBranding(orgID string, b Branding) error {
+	var data any
+	if b != (Branding{}) {
+		j, _ := json.Marshal(b)
+		data = string(j)
+	}
+	_, err := db.Exec("UPDATE orgs SET branding = ? WHERE id = ?", data, orgID)
+	return err
+}
+
+// brandingFor returns the branding the request's visitor should see: the
+// instance's, under their org's if their access link or admin session
+// belongs to one. Lookup errors fall back to the defaults rather than
+// breaking the page.
+func (s *Server) brandingFor(r *http.Request) Branding {
+	b, _ := s.db.InstanceBranding()
+	var orgID string
+	if c, err := r.Cookie("client_session"); err == nil {
+		if link, err := s.db.ValidateAccessLink(c.Value); err == nil {
+			if f, err := s.db.GetFamily(link.FamilyID); err == nil {
+				orgID = f.OrgID
+			}
+		}
+	} else if c, err := r.Cookie("admin_session"); err == nil {
+		if adminID, err := s.db.ValidateAdminSession(c.Value); err == nil {
+			orgID, _ = s.db.AdminOrg(adminID)
+		}
+	}
+	if orgID != "" {
+		if ob, err := s.db.OrgBranding(orgID); err == nil {
+			b = ob.over(b)
+		}
+	}
+	if b.AppName == "" {
+		b.AppName = defaultAppName
+	}
+	return b
+}
+
+// appName is the app's name for an org's families ("" for none), for
+// text sent outside the app such as emails.
+func (s *Server) appName(orgID string) string {
+	b, _ := s.db.InstanceBranding()
+	if orgID != "" {
+		if ob, err := s.db.OrgBranding(orgID); err == nil {
+			b = ob.over(b)
+		}
+	}
+	if b.AppName == "" {
+		return defaultAppName
+	}
+	return b.AppName
+}
+
+// brandPage puts b into an HTML page: the app name in the title, the colors
+// over the page's CSS variables, a logo favicon, and window.BRANDING for
+// scripts. Values are validated when saved, and escaped here as well.
+func brandPage(page []byte, b Branding) []byte {
+	if b.AppName != defaultAppName {
+		title := []byte("<title>" + defaultAppName)
+		page = bytes.Replace(page, title, []byte("<title>"+html.EscapeString(b.AppName)), 1)
+	}
+
+	var head strings.Builder
+	data, _ := json.Marshal(b) // escapes <, > and &
+	head.WriteString("  <script>window.BRANDING = " + string(data) + ";</script>\n")
+	if b.PrimaryColor != "" || b.BackgroundColor != "" {
+		head.WriteString("  <style>:root {")
+		if b.PrimaryColor != "" {
+			head.WriteString(" --primary: " + b.PrimaryColor + "; --primary-dark: " + b.PrimaryColor + ";")
+		}
+		if b.BackgroundColor != "" {
+			head.WriteString(" --bg: " + b.BackgroundColor + ";")
+		}
+		head.WriteString(" }</style>\n")
+	}
+	if b.LogoURL != "" {
+		head.WriteString(`  <link rel="icon" href="` + html.EscapeString(b.LogoURL) + "\" />\n")
+	}
+	return bytes.Replace(page, []byte("</head>"), []byte(head.String()+"</head>"), 1)
+}
+
+// serveBranded is serveFile for HTML pages, with the visitor's branding.
+func (s *Server) serveBranded(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := os.ReadFile(s.staticPath(name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache") // branding depends on the visitor
+		w.Write(brandPage(page, s.brandingFor(r)))
+	}
+}
+
+// handleBranding handles GET /api/v1/branding.
+func (s *Server) handleBranding(w http.ResponseWriter, r *http.Request) {
+	jsonOK(w, s.brandingFor(r))
+}
+
+// getBranding handles GET /admin/branding: the instance's branding for
+// server admins, or their own org's for org admins.
+func (s *Server) getBranding(w http.ResponseWriter, r *http.Request) {
+	var b Branding
+	var err error
+	if orgID := adminOrg(r); orgID != "" {
+		b, err = s.db.OrgBranding(orgID)
+	} else {
+		b, err = s.db.InstanceBranding()
+	}
+	if err != nil {
+		serverError(w, "failed to load branding", err)
+		return
+	}
+	jsonOK(w, b)
+}
+
+// setBranding handles PUT /admin/branding, replacing what getBranding
+// returns. An empty body object restores the defaults.
+func (s *Server) setBranding(w http.ResponseWriter, r *http.Request) {
+	b, ok := decodeBranding(w, r)
+	if !ok {
+		return
+	}
+	var err error
+	if orgID := adminOrg(r); orgID != "" {
+		err = s.db.SetOrgBranding(orgID, b)
+	} else {
+		err = s.db.SetInstanceBranding(b)
+	}
+	if err != nil {
+		serverError(w, "failed to save branding", err)
+		return
+	}
+	jsonOK(w, b)
+}
+
+// setOrgBranding handles PUT /admin/orgs/{org}/branding, for server admins
+// setting up an org.
+func (s *Server) setOrgBranding(w http.ResponseWriter, r *http.Request) {
+	orgID := r.PathValue("org")
+	b, ok := decodeBranding(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.db.GetOrg(orgID); err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "org not found")
+		return
+	}
+	if err := s.db.SetOrgBranding(orgID, b); err != nil {
+		serverError(w, "failed to save branding", err)
+		return
+	}
+	jsonOK(w, b)
+}
+
+func decodeBranding(w http.ResponseWriter, r *http.Request) (Branding, bool) {
+	var b Branding
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return b, false
+	}
+	b.AppName = strings.TrimSpace(b.AppName)
+	if fields := b.validate(); fields != nil {
+		validationError(w, fields)
+		return b, false
+	}
+	return b, true
+}
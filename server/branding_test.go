@@ -0,0 +1,128 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBrandingValidate(t *testing.T) {
+	valid := []Branding{
+		{},
+		{AppName: "Little Steps", PrimaryColor: "#0a0", BackgroundColor: "#fafafa", LogoURL: "/logo.png"},
+		{LogoURL: "https://example.com/logo.svg"},
+	}
+	for _, b := range valid {
+		if f := b.validate(); f != nil {
+			t.Errorf("%+v: %v", b, f)
+		}
+	}
+	invalid := []Branding{
+		{AppName: strings.Repeat("x", 65)},
+		{PrimaryColor: "red"},
+		{BackgroundColor: "#ffff; } body { display: none"},
+		{LogoURL: "http://example.com/logo.png"},
+		{LogoURL: "//evil.example/logo.png"},
+		{LogoURL: `/logo.png" onerror="alert(1)`},
+		{LogoURL: "javascript:alert(1)"},
+	}
+	for _, b := range invalid {
+		if b.validate() == nil {
+			t.Errorf("accepted %+v", b)
+		}
+	}
+}
+
+func TestBrandPage(t *testing.T) {
+	page := []byte("<html><head><title>Baby Log Admin</title></head><body></body></html>")
+	got := string(brandPage(page, Branding{AppName: "<Tiny> & Co", PrimaryColor: "#123456", LogoURL: "/logo.png"}))
+	for _, want := range []string{
+		"<title>&lt;Tiny&gt; &amp; Co Admin</title>",
+		`window.BRANDING = {"app_name":"\u003cTiny\u003e \u0026 Co"`,
+		"--primary: #123456;",
+		`<link rel="icon" href="/logo.png" />`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %s", want, got)
+		}
+	}
+	if strings.Contains(got, "--bg") {
+		t.Errorf("unset background injected: %s", got)
+	}
+	if got := string(brandPage(page, Branding{AppName: defaultAppName})); !strings.Contains(got, "<title>Baby Log Admin</title>") || strings.Contains(got, "<style>") {
+		t.Errorf("default branding = %s", got)
+	}
+}
+
+func TestBrandingForOrg(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	mux := s.routes()
+
+	org, _ := s.db.CreateOrg("Little Steps")
+	orgFamily, _ := s.db.CreateOrgFamily(org.ID, "Client", "")
+	plain, _ := s.db.CreateFamily("Plain", "")
+	orgLink, _ := s.db.CreateAccessLink(orgFamily.ID, "Mum", nil)
+	plainLink, _ := s.db.CreateAccessLink(plain.ID, "Mum", nil)
+	orgAdmin, _ := s.db.CreateOrgAdmin(org.ID, "kim", "password1")
+	orgToken, _ := s.db.CreateAdminSession(orgAdmin.ID, time.Hour)
+	serverToken, _ := s.db.CreateAdminSession("admin", time.Hour)
+
+	do := func(cookie *http.Cookie, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	server := &http.Cookie{Name: "admin_session", Value: serverToken}
+	orgCookie := &http.Cookie{Name: "admin_session", Value: orgToken}
+
+	if w := do(server, "PUT", "/admin/branding", `{"app_name": "Midwives Inc", "primary_color": "#ff0000"}`); w.Code != http.StatusOK {
+		t.Fatalf("set instance: %d %s", w.Code, w.Body)
+	}
+	if w := do(orgCookie, "PUT", "/admin/branding", `{"primary_color": "nope"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid org branding: %d", w.Code)
+	}
+	if w := do(orgCookie, "PUT", "/admin/branding", `{"app_name": "Little Steps"}`); w.Code != http.StatusOK {
+		t.Fatalf("set org: %d %s", w.Code, w.Body)
+	}
+	if w := do(orgCookie, "PUT", "/admin/orgs/"+org.ID+"/branding", `{}`); w.Code != http.StatusForbidden {
+		t.Errorf("org admin setting via orgs: %d", w.Code)
+	}
+
+	branding := func(cookie *http.Cookie) (b Branding) {
+		json.Unmarshal(do(cookie, "GET", "/api/v1/branding", "").Body.Bytes(), &b)
+		return b
+	}
+	if b := branding(nil); b.AppName != "Midwives Inc" || b.PrimaryColor != "#ff0000" {
+		t.Errorf("anonymous = %+v", b)
+	}
+	if b := branding(&http.Cookie{Name: "client_session", Value: plainLink.Token}); b.AppName != "Midwives Inc" {
+		t.Errorf("family without org = %+v", b)
+	}
+	// The org's name, over the instance's color
+	if b := branding(&http.Cookie{Name: "client_session", Value: orgLink.Token}); b.AppName != "Little Steps" || b.PrimaryColor != "#ff0000" {
+		t.Errorf("org family = %+v", b)
+	}
+	if b := branding(orgCookie); b.AppName != "Little Steps" {
+		t.Errorf("org admin = %+v", b)
+	}
+
+	w := do(&http.Cookie{Name: "client_session", Value: orgLink.Token}, "GET", "/", "")
+	if !strings.Contains(w.Body.String(), "<title>Little Steps</title>") || !strings.Contains(w.Body.String(), "--primary: #ff0000;") {
+		t.Errorf("page not branded: %.300s", w.Body)
+	}
+
+	// Clearing restores the defaults
+	do(server, "PUT", "/admin/branding", `{}`)
+	do(server, "PUT", "/admin/orgs/"+org.ID+"/branding", `{}`)
+	if b := branding(&http.Cookie{Name: "client_session", Value: orgLink.Token}); b != (Branding{AppName: defaultAppName}) {
+		t.Errorf("cleared = %+v", b)
+	}
+}
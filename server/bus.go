@@ -0,0 +1,223 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// Running several babytrackd instances against one database (behind a load
+// balancer) needs the Hubs to share their traffic: a family's devices may
+// be connected to different instances, and an entry written through one has
+// to reach the others. With HUB_BUS_URL set, every Hub relays what it
+// delivers locally over a Bus, and delivers what the others relay to its
+// own clients. Methods returning counts (RevokeLink, CloseFamily, ...)
+// count only this instance's clients.
+//
+// Presence is shared too: each instance relays its own connections to a
+// family when they change, and again every RunExpiry interval, and merges
+// the others' into the presence it sends. An instance that stops relaying
+// drops out of presence after remotePresenceTTL.
+
+// busQueue bounds relayed messages waiting to be published. When the bus
+// can't keep up, messages are dropped and devices on other instances catch
+// up on their next sync.
+const busQueue = 1024
+
+// remotePresenceTTL is how long another instance's presence counts without
+// a refresh.
+const remotePresenceTTL = 3 * time.Minute
+
+const (
+	defaultBusChannel = "babytrackd.hub" // Redis channel or NATS subject
+	busDialTimeout    = 5 * time.Second
+	maxBusBackoff     = 30 * time.Second
+)
+
+// Bus carries Hub messages between instances. Every instance receives every
+// message published, including its own.
+type Bus interface {
+	Publish(data []byte) error
+	// Run passes received messages to handle until Close, reconnecting
+	// as needed.
+	Run(handle func(data []byte))
+	Close() error
+}
+
+// newBus returns the Bus for a HUB_BUS_URL.
+func newBus(rawURL string) (Bus, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		return newRedisBus(u)
+	case "nats", "tls":
+		return newNATSBus(u)
+	}
+	return nil, fmt.Errorf("unsupported bus %q: want redis://, rediss://, nats:// or tls://", u.Scheme)
+}
+
+// busMessage is a Hub call relayed to the other instances.
+type busMessage struct {
+	Node     string `json:"node"`
+	Kind     string `json:"kind"` // broadcast, broadcast_all, revoke_link, revoke_device, device_settings, notify, close_link, close_family, rotation, activity, presence, maintenance, relabel_link
+	FamilyID string `json:"family_id,omitempty"`
+	LinkID   string `json:"link_id,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+	Code     int    `json:"code,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Msg      []byte `json:"msg,omitempty"`
+}
+
+// UseBus connects the Hub to other instances. Call before serving.
+func (h *Hub) UseBus(b Bus) {
+	h.bus = b
+	h.node = generateToken(8)
+	h.busOut = make(chan []byte, busQueue)
+	go func() {
+		for data := range h.busOut {
+			if err := b.Publish(data); err != nil {
+				slog.Warn("hub bus publish failed", "error", err)
+			}
+		}
+	}()
+	go b.Run(h.receive)
+}
+
+// relay queues m for the other instances. Safe to call with h.mu held.
+func (h *Hub) relay(m busMessage) {
+	if h.bus == nil {
+		return
+	}
+	m.Node = h.node
+	data, _ := json.Marshal(m)
+	select {
+	case h.busOut <- data:
+	default:
+		slog.Warn("hub bus queue full, dropping message", "kind", m.Kind, "family_id", m.FamilyID)
+	}
+}
+
+// receive delivers a message relayed by another instance to this one's
+// clients.
+func (h *Hub) receive(data []byte) {
+	var m busMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		slog.Warn("invalid hub bus message", "error", err)
+		return
+	}
+	if m.Node == h.node {
+		return
+	}
+	switch m.Kind {
+	case "broadcast":
+		h.broadcast(m.FamilyID, m.Msg, nil)
+	case "broadcast_all":
+		h.broadcastAll(m.Msg)
+	case "revoke_link":
+		h.revokeLink(m.LinkID, m.Reason)
+	case "revoke_device":
+		h.revokeDevice(m.DeviceID, m.Reason)
+	case "device_settings":
+		h.sendDeviceSettings(m.DeviceID, m.Msg, nil)
+	case "notify":
+		h.notify(m.FamilyID, m.DeviceID, m.Msg, nil)
+	case "close_link":
+		h.closeLink(m.LinkID, m.Code, m.Reason)
+	case "close_family":
+		h.closeFamily(m.FamilyID, m.Code, m.Reason)
+	case "rotation":
+		h.sendRotation(m.LinkID, m.Token)
+	case "relabel_link":
+		h.relabelLink(m.LinkID, m.Label)
+	case "activity":
+		h.fanOutActivity(m.Msg)
+	case "maintenance":
+		h.receiveMaintenance(m.Msg)
+	case "presence":
+		var p remotePresence
+		if err := json.Unmarshal(m.Msg, &p); err != nil {
+			return
+		}
+		p.at, p.raw = time.Now(), string(m.Msg)
+		h.presenceMu.Lock()
+		if h.remote == nil {
+			h.remote = map[string]map[string]remotePresence{}
+		}
+		// A refresh with nothing new needs no presence sent
+		changed := h.remote[m.FamilyID][m.Node].raw != p.raw
+		if len(p.Devices) == 0 {
+			delete(h.remote[m.FamilyID], m.Node)
+		} else {
+			if h.remote[m.FamilyID] == nil {
+				h.remote[m.FamilyID] = map[string]remotePresence{}
+			}
+			h.remote[m.FamilyID][m.Node] = p
+		}
+		h.presenceMu.Unlock()
+
+		if !changed {
+			return
+		}
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		if len(h.families[m.FamilyID]) > 0 {
+			members, devices := h.localPresenceLocked(m.FamilyID)
+			h.sendPresenceLocked(m.FamilyID, members, devices)
+		}
+	}
+}
+
+// remotePresence is another instance's connections to a family.
+type remotePresence struct {
+	Members []string         `json:"members"`
+	Devices []PresenceDevice `json:"devices"`
+	at      time.Time        // when received
+	raw     string           // as received, to tell refreshes from changes
+}
+
+// relayPresence tells other instances this one's connections to a family;
+// none once its last client leaves.
+func (h *Hub) relayPresence(familyID string, members []string, devices []PresenceDevice) {
+	if h.bus == nil {
+		return
+	}
+	msg, _ := json.Marshal(remotePresence{Members: members, Devices: devices})
+	h.relay(busMessage{Kind: "presence", FamilyID: familyID, Msg: msg})
+}
+
+// withRemotePresence adds other instances' connections to a family to this
+// one's, dropping any that have gone quiet.
+func (h *Hub) withRemotePresence(familyID string, members []string, devices []PresenceDevice) ([]string, []PresenceDevice) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	for node, p := range h.remote[familyID] {
+		if time.Since(p.at) > remotePresenceTTL {
+			delete(h.remote[familyID], node)
+			continue
+		}
+		members = append(members, p.Members...)
+		devices = append(devices, p.Devices...)
+	}
+	return members, devices
+}
+
+// refreshPresence relays this instance's connections to every family with
+// clients here, so other instances know it's still there.
+func (h *Hub) refreshPresence() {
+	if h.bus == nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for familyID := range h.families {
+		members, devices := h.localPresenceLocked(familyID)
+		h.relayPresence(familyID, members, devices)
+	}
+}
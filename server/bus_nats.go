@@ -0,0 +1,206 @@
+package babytrack
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsBus relays Hub messages over a NATS subject, speaking just enough of
+// the client protocol for CONNECT, SUB and PUB on one connection. The URL
+// is nats://[USER:PASSWORD@|TOKEN@]HOST[:PORT][?subject=NAME], or tls://
+// to require TLS; servers that require it are upgraded either way.
+type natsBus struct {
+	addr     string
+	host     string
+	user     string
+	password string
+	token    string
+	tls      bool
+	subject  string
+
+	mu     sync.Mutex // guards conn and closed, and is held while writing
+	conn   net.Conn
+	closed bool
+}
+
+func newNATSBus(u *url.URL) (*natsBus, error) {
+	b := &natsBus{addr: u.Host, host: u.Hostname(), subject: u.Query().Get("subject"), tls: u.Scheme == "tls"}
+	if b.host == "" {
+		return nil, errors.New("nats bus: host is required")
+	}
+	if u.Port() == "" {
+		b.addr = net.JoinHostPort(b.host, "4222")
+	}
+	if b.subject == "" {
+		b.subject = defaultBusChannel
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			b.user, b.password = u.User.Username(), password
+		} else {
+			b.token = u.User.Username()
+		}
+	}
+	return b, nil
+}
+
+// connect dials, authenticates and subscribes.
+func (b *natsBus) connect() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", b.addr, busDialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(busDialTimeout))
+	r := bufio.NewReader(conn)
+	line, err := readNATSLine(r)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if !strings.HasPrefix(line, "INFO ") || json.Unmarshal([]byte(line[5:]), &info) != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	if b.tls || info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: b.host})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		conn, r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	opts, _ := json.Marshal(map[string]any{
+		"verbose": false, "pedantic": false, "protocol": 1,
+		"name": "babytrackd", "lang": "go", "version": version,
+		"user": b.user, "pass": b.password, "auth_token": b.token,
+	})
+	fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", opts)
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return nil, nil, fmt.Errorf("nats: %s", strings.TrimSpace(line[4:]))
+		}
+		if line == "PONG" {
+			break
+		}
+	}
+	if _, err := fmt.Fprintf(conn, "SUB %s 1\r\n", b.subject); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, r, nil
+}
+
+// Publish sends data on the subject. It fails while disconnected; Run is
+// reconnecting.
+func (b *natsBus) Publish(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		return errors.New("nats: not connected")
+	}
+	b.conn.SetWriteDeadline(time.Now().Add(busDialTimeout))
+	_, err := fmt.Fprintf(b.conn, "PUB %s %d\r\n%s\r\n", b.subject, len(data), data)
+	return err
+}
+
+// Run reads messages and passes them to handle until Close.
+func (b *natsBus) Run(handle func([]byte)) {
+	backoff := time.Second
+	for {
+		err := b.read(handle, func() { backoff = time.Second })
+		b.mu.Lock()
+		b.conn = nil
+		closed := b.closed
+		b.mu.Unlock()
+		if closed {
+			return
+		}
+		slog.Warn("hub bus connection lost, reconnecting", "error", err, "retry_in", backoff)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxBusBackoff)
+	}
+}
+
+func (b *natsBus) read(handle func([]byte), connected func()) error {
+	conn, r, err := b.connect()
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	b.conn = conn
+	b.mu.Unlock()
+	defer conn.Close()
+	connected()
+
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || n < 0 {
+				return fmt.Errorf("nats: malformed %q", line)
+			}
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return err
+			}
+			handle(data[:n])
+		case line == "PING":
+			b.mu.Lock()
+			_, err := io.WriteString(conn, "PONG\r\n")
+			b.mu.Unlock()
+			if err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(line[4:]))
+		}
+	}
+}
+
+func (b *natsBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	return nil
+}
+
+func readNATSLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
@@ -0,0 +1,172 @@
+package babytrack
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATS is enough of a NATS server for the bus: CONNECT with a
+// password, PING, SUB and PUB. It pings each subscriber once.
+type fakeNATS struct {
+	ln       net.Listener
+	password string
+
+	mu    sync.Mutex
+	subs  map[string][]natsSub
+	pongs int
+}
+
+type natsSub struct {
+	conn net.Conn
+	sid  string
+}
+
+func startFakeNATS(t *testing.T, password string) *fakeNATS {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeNATS{ln: ln, password: password, subs: map[string][]natsSub{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	io.WriteString(conn, `INFO {"server_id":"fake","auth_required":true}`+"\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(line, " ")
+		switch op {
+		case "CONNECT":
+			var opts struct {
+				Pass string `json:"pass"`
+			}
+			json.Unmarshal([]byte(args), &opts)
+			if opts.Pass != f.password {
+				io.WriteString(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case "PONG":
+			f.mu.Lock()
+			f.pongs++
+			f.mu.Unlock()
+		case "SUB":
+			fields := strings.Fields(args)
+			f.mu.Lock()
+			f.subs[fields[0]] = append(f.subs[fields[0]], natsSub{conn, fields[1]})
+			f.mu.Unlock()
+			io.WriteString(conn, "PING\r\n")
+		case "PUB":
+			fields := strings.Fields(args)
+			n, _ := strconv.Atoi(fields[len(fields)-1])
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			f.mu.Lock()
+			for _, sub := range f.subs[fields[0]] {
+				fmt.Fprintf(sub.conn, "MSG %s %s %d\r\n%s\r\n", fields[0], sub.sid, n, data[:n])
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+func (f *fakeNATS) subscribers(subject string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs[subject])
+}
+
+func TestNATSBus(t *testing.T) {
+	f := startFakeNATS(t, "secret")
+	u, _ := url.Parse("nats://bt:secret@" + f.ln.Addr().String() + "?subject=bt.test")
+
+	received := make(chan string, 4)
+	var buses []*natsBus
+	for range 2 {
+		b, err := newNATSBus(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+		go b.Run(func(data []byte) { received <- string(data) })
+		buses = append(buses, b)
+	}
+	for deadline := time.Now().Add(time.Second); f.subscribers("bt.test") < 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("buses didn't subscribe")
+		}
+	}
+
+	if err := buses[0].Publish([]byte("hello\r\nworld")); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		select {
+		case got := <-received:
+			if got != "hello\r\nworld" {
+				t.Errorf("received %q", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not received")
+		}
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		f.mu.Lock()
+		pongs := f.pongs
+		f.mu.Unlock()
+		if pongs == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("answered %d pings", pongs)
+		}
+	}
+
+	bad, _ := url.Parse("nats://bt:wrong@" + f.ln.Addr().String())
+	b, _ := newNATSBus(bad)
+	if _, _, err := b.connect(); err == nil || !strings.Contains(err.Error(), "Authorization") {
+		t.Errorf("connect with a wrong password: %v", err)
+	}
+	if err := b.Publish([]byte("x")); err == nil {
+		t.Error("published while disconnected")
+	}
+}
+
+func TestNewNATSBus(t *testing.T) {
+	bus, err := newBus("tls://s3cr3t@nats.lan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nb := bus.(*natsBus)
+	if nb.addr != "nats.lan:4222" || nb.token != "s3cr3t" || nb.user != "" || !nb.tls || nb.subject != defaultBusChannel {
+		t.Errorf("nats bus = %+v", nb)
+	}
+}
@@ -0,0 +1,257 @@
+package babytrack
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// redisBus relays Hub messages over Redis pub/sub, speaking just enough of
+// the protocol (RESP) for AUTH, PUBLISH and SUBSCRIBE. The URL is
+// redis://[[USER]:PASSWORD@]HOST[:PORT][?channel=NAME], or rediss:// for
+// TLS; instances sharing a Redis for different deployments need their own
+// channel.
+type redisBus struct {
+	addr     string
+	user     string
+	password string
+	tls      *tls.Config
+	channel  string
+
+	pubMu sync.Mutex
+	pub   net.Conn
+	pubR  *bufio.Reader
+
+	subMu  sync.Mutex
+	sub    net.Conn
+	closed bool
+}
+
+func newRedisBus(u *url.URL) (*redisBus, error) {
+	b := &redisBus{addr: u.Host, channel: u.Query().Get("channel")}
+	if u.Hostname() == "" {
+		return nil, errors.New("redis bus: host is required")
+	}
+	if u.Port() == "" {
+		b.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if b.channel == "" {
+		b.channel = defaultBusChannel
+	}
+	if u.User != nil {
+		b.user = u.User.Username()
+		b.password, _ = u.User.Password()
+	}
+	if u.Scheme == "rediss" {
+		b.tls = &tls.Config{ServerName: u.Hostname()}
+	}
+	return b, nil
+}
+
+// dial connects and authenticates.
+func (b *redisBus) dial() (net.Conn, *bufio.Reader, error) {
+	dialer := &net.Dialer{Timeout: busDialTimeout}
+	var conn net.Conn
+	var err error
+	if b.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", b.addr, b.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", b.addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	if b.password != "" {
+		args := []string{"AUTH", b.password}
+		if b.user != "" {
+			args = []string{"AUTH", b.user, b.password}
+		}
+		conn.SetDeadline(time.Now().Add(busDialTimeout))
+		if _, err := redisCall(conn, r, args...); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("redis auth: %w", err)
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return conn, r, nil
+}
+
+// Publish sends data on the channel, reconnecting once if the connection
+// has gone.
+func (b *redisBus) Publish(data []byte) error {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	var err error
+	for range 2 {
+		if b.pub == nil {
+			if b.pub, b.pubR, err = b.dial(); err != nil {
+				return err
+			}
+		}
+		b.pub.SetDeadline(time.Now().Add(busDialTimeout))
+		if _, err = redisCall(b.pub, b.pubR, "PUBLISH", b.channel, string(data)); err == nil {
+			return nil
+		}
+		var re redisError
+		if errors.As(err, &re) {
+			return err
+		}
+		b.pub.Close()
+		b.pub = nil
+	}
+	return err
+}
+
+// Run subscribes and passes messages to handle until Close.
+func (b *redisBus) Run(handle func([]byte)) {
+	backoff := time.Second
+	for {
+		err := b.subscribe(handle, func() { backoff = time.Second })
+		b.subMu.Lock()
+		closed := b.closed
+		b.subMu.Unlock()
+		if closed {
+			return
+		}
+		slog.Warn("hub bus subscription lost, reconnecting", "error", err, "retry_in", backoff)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxBusBackoff)
+	}
+}
+
+func (b *redisBus) subscribe(handle func([]byte), subscribed func()) error {
+	conn, r, err := b.dial()
+	if err != nil {
+		return err
+	}
+	b.subMu.Lock()
+	if b.closed {
+		b.subMu.Unlock()
+		conn.Close()
+		return nil
+	}
+	b.sub = conn
+	b.subMu.Unlock()
+	defer conn.Close()
+
+	if err := writeRedisCommand(conn, "SUBSCRIBE", b.channel); err != nil {
+		return err
+	}
+	for {
+		reply, err := readRedisReply(r)
+		if err != nil {
+			return err
+		}
+		msg, ok := reply.([]any)
+		if !ok || len(msg) < 3 {
+			continue
+		}
+		switch kind, _ := msg[0].(string); kind {
+		case "subscribe":
+			subscribed()
+		case "message":
+			if data, ok := msg[2].(string); ok {
+				handle([]byte(data))
+			}
+		}
+	}
+}
+
+func (b *redisBus) Close() error {
+	b.subMu.Lock()
+	b.closed = true
+	if b.sub != nil {
+		b.sub.Close()
+	}
+	b.subMu.Unlock()
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	if b.pub != nil {
+		b.pub.Close()
+		b.pub = nil
+	}
+	return nil
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func redisCall(w io.Writer, r *bufio.Reader, args ...string) (any, error) {
+	if err := writeRedisCommand(w, args...); err != nil {
+		return nil, err
+	}
+	reply, err := readRedisReply(r)
+	if err == nil {
+		if re, ok := reply.(redisError); ok {
+			return nil, re
+		}
+	}
+	return reply, err
+}
+
+// writeRedisCommand sends a command as an array of bulk strings.
+func writeRedisCommand(w io.Writer, args ...string) error {
+	buf := make([]byte, 0, 64)
+	buf = fmt.Appendf(buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// readRedisReply reads one reply: a string for simple and bulk strings
+// (nil if null), an int64, a redisError, or a []any for arrays.
+func readRedisReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return redisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,156 @@
+package babytrack
+
+import (
+	"bufio"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is enough of a Redis server for the bus: AUTH, SUBSCRIBE and
+// PUBLISH on any channel.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu   sync.Mutex
+	subs map[string][]net.Conn
+}
+
+func startFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, password: password, subs: map[string][]net.Conn{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	for {
+		reply, err := readRedisReply(r)
+		if err != nil {
+			return
+		}
+		args, _ := reply.([]any)
+		if len(args) == 0 {
+			return
+		}
+		cmd, _ := args[0].(string)
+		switch {
+		case cmd == "AUTH":
+			if args[len(args)-1] == f.password {
+				authed = true
+				conn.Write([]byte("+OK\r\n"))
+			} else {
+				conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+			}
+		case !authed:
+			conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+		case cmd == "SUBSCRIBE":
+			channel := args[1].(string)
+			f.mu.Lock()
+			f.subs[channel] = append(f.subs[channel], conn)
+			f.mu.Unlock()
+			writeRedisCommand(conn, "subscribe", channel)
+		case cmd == "PUBLISH":
+			channel, data := args[1].(string), args[2].(string)
+			f.mu.Lock()
+			subs := f.subs[channel]
+			for _, sub := range subs {
+				writeRedisCommand(sub, "message", channel, data)
+			}
+			f.mu.Unlock()
+			conn.Write([]byte(":" + strconv.Itoa(len(subs)) + "\r\n"))
+		}
+	}
+}
+
+func (f *fakeRedis) subscribers(channel string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs[channel])
+}
+
+func TestRedisBus(t *testing.T) {
+	f := startFakeRedis(t, "secret")
+	u, _ := url.Parse("redis://:secret@" + f.ln.Addr().String())
+
+	received := make(chan string, 4)
+	var buses []*redisBus
+	for range 2 {
+		b, err := newRedisBus(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+		go b.Run(func(data []byte) { received <- string(data) })
+		buses = append(buses, b)
+	}
+	for deadline := time.Now().Add(time.Second); f.subscribers(defaultBusChannel) < 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("buses didn't subscribe")
+		}
+	}
+
+	if err := buses[0].Publish([]byte("hello\r\nworld")); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		select {
+		case got := <-received:
+			if got != "hello\r\nworld" {
+				t.Errorf("received %q", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not received")
+		}
+	}
+
+	bad, _ := url.Parse("redis://:wrong@" + f.ln.Addr().String())
+	b, _ := newRedisBus(bad)
+	if err := b.Publish([]byte("x")); err == nil {
+		t.Error("published with a wrong password")
+	}
+}
+
+func TestRedisBusLinksHubs(t *testing.T) {
+	f := startFakeRedis(t, "")
+	hubs := make([]*Hub, 2)
+	for i := range hubs {
+		bus, err := newBus("redis://" + f.ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer bus.Close()
+		hubs[i] = NewHub(nil)
+		hubs[i].UseBus(bus)
+	}
+	for deadline := time.Now().Add(time.Second); f.subscribers(defaultBusChannel) < 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("hubs didn't subscribe")
+		}
+	}
+
+	c := &Client{hub: hubs[1], send: make(chan []byte, 16), familyID: "f1"}
+	hubs[1].Register(c)
+	hubs[0].Broadcast("f1", []byte(`{"type":"entry"}`), nil)
+	nextOfType(t, c, "entry")
+}
@@ -0,0 +1,255 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memBus links Hubs in one process, as a broker would.
+type memBus struct {
+	broker *memBroker
+	done   chan struct{}
+}
+
+type memBroker struct {
+	mu   sync.Mutex
+	subs []func([]byte)
+}
+
+func (b *memBroker) bus() *memBus { return &memBus{broker: b, done: make(chan struct{})} }
+
+func (b *memBus) Publish(data []byte) error {
+	b.broker.mu.Lock()
+	subs := b.broker.subs
+	b.broker.mu.Unlock()
+	for _, handle := range subs {
+		handle(data)
+	}
+	return nil
+}
+
+func (b *memBus) Run(handle func([]byte)) {
+	b.broker.mu.Lock()
+	b.broker.subs = append(b.broker.subs, handle)
+	b.broker.mu.Unlock()
+	<-b.done
+}
+
+func (b *memBus) Close() error {
+	close(b.done)
+	return nil
+}
+
+// linkedHubs returns n Hubs sharing a bus.
+func linkedHubs(t *testing.T, n int) []*Hub {
+	t.Helper()
+	broker := &memBroker{}
+	hubs := make([]*Hub, n)
+	for i := range hubs {
+		hubs[i] = NewHub(nil)
+		bus := broker.bus()
+		hubs[i].UseBus(bus)
+		t.Cleanup(func() { bus.Close() })
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		broker.mu.Lock()
+		ready := len(broker.subs) == n
+		broker.mu.Unlock()
+		if ready {
+			return hubs
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("hubs didn't subscribe")
+		}
+	}
+}
+
+// nextOfType waits for a message on c with the given type, skipping others.
+func nextOfType(t *testing.T, c *Client, wantType string) []byte {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case msg := <-c.send:
+			var m struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(msg, &m)
+			if m.Type == wantType {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("no %s message", wantType)
+			return nil
+		}
+	}
+}
+
+func TestBusRelaysBroadcasts(t *testing.T) {
+	hubs := linkedHubs(t, 2)
+	a := &Client{hub: hubs[0], send: make(chan []byte, 16), familyID: "f1", linkID: "la"}
+	b := &Client{hub: hubs[1], send: make(chan []byte, 16), familyID: "f1", linkID: "lb"}
+	other := &Client{hub: hubs[1], send: make(chan []byte, 16), familyID: "f2", linkID: "lc"}
+	hubs[0].Register(a)
+	hubs[1].Register(b)
+	hubs[1].Register(other)
+
+	hubs[0].Broadcast("f1", []byte(`{"type":"entry","id":"e1"}`), a)
+	if msg := nextOfType(t, b, "entry"); !strings.Contains(string(msg), "e1") {
+		t.Errorf("relayed = %s", msg)
+	}
+
+	hubs[1].BroadcastAll([]byte(`{"type":"announcement"}`))
+	nextOfType(t, a, "announcement")
+	nextOfType(t, b, "announcement")
+	nextOfType(t, other, "announcement")
+
+	hubs[1].SendRotation("la", "new-token")
+	nextOfType(t, a, "token_rotated")
+
+	// A revoked link is dropped on every instance
+	if n := hubs[1].RevokeLink("la", "revoked"); n != 0 {
+		t.Errorf("revoked %d locally", n)
+	}
+	nextOfType(t, a, "session_revoked")
+
+	// Nothing comes back to the sender's own instance
+	select {
+	case msg := <-b.send:
+		t.Errorf("b got %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBusRelaysMaintenance(t *testing.T) {
+	hubs := linkedHubs(t, 3)
+	var states [3]maintenance
+	clients := make([]*Client, 3)
+	for i, h := range hubs {
+		h.maintenance = &states[i]
+		clients[i] = &Client{hub: h, send: make(chan []byte, 16), familyID: "f1", linkID: "l"}
+		h.Register(clients[i])
+	}
+
+	states[0].Set(MaintenanceState{Enabled: true, Message: "Restoring"})
+	hubs[0].relayMaintenance()
+	for _, c := range clients[1:] {
+		if msg := nextOfType(t, c, "maintenance"); !strings.Contains(string(msg), "Restoring") {
+			t.Errorf("told %s", msg)
+		}
+	}
+	if got := states[1].State(); !got.Enabled || got.Message != "Restoring" {
+		t.Errorf("relayed state = %+v", got)
+	}
+
+	// Turned off elsewhere, a stale refresh doesn't turn it back on
+	states[2].Set(MaintenanceState{})
+	hubs[2].relayMaintenance()
+	nextOfType(t, clients[0], "maintenance")
+	nextOfType(t, clients[1], "maintenance")
+	hubs[0].relayMaintenance()
+	timeout := time.After(50 * time.Millisecond)
+wait:
+	for {
+		select {
+		case msg := <-clients[2].send:
+			if strings.Contains(string(msg), `"maintenance"`) {
+				t.Errorf("stale state sent: %s", msg)
+			}
+		case <-timeout:
+			break wait
+		}
+	}
+	for i := range states {
+		if states[i].State().Enabled {
+			t.Errorf("instance %d still in maintenance", i)
+		}
+	}
+}
+
+func TestBusRelaysActivity(t *testing.T) {
+	hubs := linkedHubs(t, 2)
+	feed := hubs[1].SubscribeActivity()
+	defer hubs[1].UnsubscribeActivity(feed)
+
+	hubs[0].publishActivity(ActivityEvent{Type: "warning", FamilyID: "f1", Message: "disk"})
+	select {
+	case msg := <-feed:
+		if !strings.Contains(string(msg), `"disk"`) {
+			t.Errorf("activity = %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("activity not relayed")
+	}
+}
+
+func TestBusSharesPresence(t *testing.T) {
+	hubs := linkedHubs(t, 2)
+	a := withLabel(&Client{hub: hubs[0], send: make(chan []byte, 16), familyID: "f1", linkID: "la", connectedAt: time.Now()}, "Mum")
+	b := withLabel(&Client{hub: hubs[1], send: make(chan []byte, 16), familyID: "f1", linkID: "lb", connectedAt: time.Now()}, "Dad")
+	hubs[0].Register(a)
+	hubs[1].Register(b)
+
+	presence := func(c *Client, want int) []PresenceDevice {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+			var p struct {
+				Devices []PresenceDevice `json:"devices"`
+			}
+			json.Unmarshal(nextOfType(t, c, "presence"), &p)
+			if len(p.Devices) == want {
+				return p.Devices
+			}
+		}
+		t.Fatalf("no presence with %d devices", want)
+		return nil
+	}
+	if d := presence(a, 2); d[0].Label != "Dad" || d[1].Label != "Mum" {
+		t.Errorf("a sees %+v", d)
+	}
+
+	// A rename through either instance reaches the link's clients and both
+	// instances' presence
+	hubs[1].RelabelLink("la", "Mummy")
+	for d := presence(b, 2); d[1].Label != "Mummy"; d = presence(b, 2) {
+		// sent before the rename
+	}
+	if a.linkLabel() != "Mummy" {
+		t.Errorf("a is %q", a.linkLabel())
+	}
+
+	// Leaving on one instance updates the other
+	hubs[1].Unregister(b)
+	presence(a, 1)
+
+	// An instance that stops refreshing drops out
+	hubs[1].Register(withLabel(&Client{hub: hubs[1], send: make(chan []byte, 16), familyID: "f1", linkID: "lb", connectedAt: time.Now()}, "Dad"))
+	presence(a, 2)
+	hubs[0].presenceMu.Lock()
+	for node, p := range hubs[0].remote["f1"] {
+		p.at = time.Now().Add(-2 * remotePresenceTTL)
+		hubs[0].remote["f1"][node] = p
+	}
+	hubs[0].presenceMu.Unlock()
+	hubs[0].mu.RLock()
+	hubs[0].broadcastPresenceLocked("f1")
+	hubs[0].mu.RUnlock()
+	presence(a, 1)
+}
+
+func TestNewBus(t *testing.T) {
+	if _, err := newBus("kafka://localhost"); err == nil {
+		t.Error("accepted kafka")
+	}
+	bus, err := newBus("rediss://:secret@cache.internal?channel=bt-prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb := bus.(*redisBus)
+	if rb.addr != "cache.internal:6379" || rb.password != "secret" || rb.channel != "bt-prod" || rb.tls == nil {
+		t.Errorf("redis bus = %+v", rb)
+	}
+}
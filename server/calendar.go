@@ -0,0 +1,253 @@
+package babytrack
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The calendar feed is an iCalendar (RFC 5545) export of a family's recent
+// feeds and sleeps, plus the predicted next nap, for overlaying on a
+// caregiver's own calendar. It's read-only and authenticated by a secret
+// in the URL, separate from access links, since calendar apps can't send
+// cookies and the URL ends up in third-party services.
+
+const (
+	defaultCalendarDays = 14
+	maxCalendarDays     = 60
+	calendarPointMin    = 15 // display length for point events like a feed
+)
+
+var defaultCalendarTypes = []string{"feed", "sleep"}
+
+// CalendarToken returns the family's calendar token, creating one if
+// create is set and there is none.
+func (db *DB) CalendarToken(familyID string, create bool) (string, error) {
+	var token sql.NullString
+	if err := db.QueryRow("SELECT calendar_token FROM families WHERE id = ?", familyID).Scan(&token); err != nil {
+		return "", err
+	}
+	if token.Valid || !create {
+		return token.String, nil
+	}
+	return db.RotateCalendarToken(familyID)
+}
+
+// RotateCalendarToken replaces the family's calendar token, invalidating
+// subscriptions to the old URL.
+func (db *DB) RotateCalendarToken(familyID string) (string, error) {
+	token := generateToken(16)
+	res, err := db.Exec("UPDATE families SET calendar_token = ? WHERE id = ?", token, familyID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", sql.ErrNoRows
+	}
+	return token, nil
+}
+
+// DisableCalendar removes the family's calendar token.
+func (db *DB) DisableCalendar(familyID string) error {
+	_, err := db.Exec("UPDATE families SET calendar_token = NULL WHERE id = ?", familyID)
+	return err
+}
+
+func (db *DB) FamilyByCalendarToken(token string) (*Family, error) {
+	var id string
+	if err := db.QueryRow("SELECT id FROM families WHERE calendar_token = ? AND archived = 0", token).Scan(&id); err != nil {
+		return nil, err
+	}
+	return db.GetFamily(id)
+}
+
+// icsEscape escapes a TEXT value.
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// icsLine folds a content line to 75 octets, without splitting UTF-8
+// sequences, and terminates it with CRLF.
+func icsLine(b *strings.Builder, line string) {
+	for len(line) > 75 {
+		cut := 75
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+	}
+	b.WriteString(line + "\r\n")
+}
+
+func icsTime(ms int64) string {
+	return time.UnixMilli(ms).UTC().Format("20060102T150405Z")
+}
+
+// buildCalendar renders the timeline items of the given types as events.
+func buildCalendar(f *Family, locale *Locale, items []TimelineItem, types []string, prediction *NapPrediction, now time.Time) string {
+	var b strings.Builder
+	icsLine(&b, "BEGIN:VCALENDAR")
+	icsLine(&b, "VERSION:2.0")
+	icsLine(&b, "PRODID:-//babytrack//calendar//EN")
+	icsLine(&b, "CALSCALE:GREGORIAN")
+	icsLine(&b, "X-WR-CALNAME:"+icsEscape(f.Name))
+	icsLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:PT15M")
+	icsLine(&b, "X-PUBLISHED-TTL:PT15M")
+
+	stamp := icsTime(now.UnixMilli())
+	event := func(uid string, start, end int64, summary, status string) {
+		icsLine(&b, "BEGIN:VEVENT")
+		icsLine(&b, "UID:"+uid+"@babytrack")
+		icsLine(&b, "DTSTAMP:"+stamp)
+		icsLine(&b, "DTSTART:"+icsTime(start))
+		icsLine(&b, "DTEND:"+icsTime(end))
+		icsLine(&b, "SUMMARY:"+icsEscape(summary))
+		if status != "" {
+			icsLine(&b, "STATUS:"+status)
+		}
+		icsLine(&b, "END:VEVENT")
+	}
+
+	for _, it := range items {
+		if !slices.Contains(types, it.Type) {
+			continue
+		}
+		// Awake periods would fill the calendar between sleeps
+		if it.Type == "sleep" && it.Value == "awake" {
+			continue
+		}
+		summary := locale.TypeLabel(it.Type)
+		if v := locale.ValueLabel(it.Value); v != "" && v != summary {
+			summary += ": " + v
+		}
+		end := it.Start + calendarPointMin*time.Minute.Milliseconds()
+		status := ""
+		if it.Kind == "block" {
+			end = it.Start + int64(*it.DurationMin)*time.Minute.Milliseconds()
+			if it.End != nil {
+				end = *it.End
+			}
+			if it.Ongoing {
+				status = "TENTATIVE"
+			}
+		}
+		event(it.ID, it.Start, end, summary, status)
+	}
+
+	if prediction != nil && prediction.NextNapStart != 0 {
+		event("next-nap-"+strconv.FormatInt(prediction.NextNapStart, 10), prediction.NextNapStart, prediction.NextNapEnd,
+			locale.T("calendar.next_nap", "Next nap window"), "TENTATIVE")
+	}
+
+	icsLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// handleCalendar serves GET /cal/{token}.ics. ?days= sets how far back to
+// go and ?types= which entry types become events (default feed,sleep).
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutSuffix(r.PathValue("file"), ".ics")
+	if !ok {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "not found")
+		return
+	}
+	f, err := s.db.FamilyByCalendarToken(token)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "not found")
+		return
+	}
+
+	days := defaultCalendarDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxCalendarDays {
+			validationError(w, map[string]string{"days": fmt.Sprintf("must be between 1 and %d", maxCalendarDays)})
+			return
+		}
+		days = n
+	}
+	types := defaultCalendarTypes
+	if v := r.URL.Query().Get("types"); v != "" {
+		types = strings.Split(v, ",")
+	}
+
+	now := time.Now()
+	tl, err := buildTimeline(s.db, f.ID, now.AddDate(0, 0, -days).UnixMilli(), now.UnixMilli()+1, now)
+	if err != nil {
+		serverError(w, "failed to build calendar", err)
+		return
+	}
+	settings, _ := s.db.GetFamilySettings(f.ID)
+	prediction, err := predictNap(s.db, f.ID, settings, now)
+	if err != nil {
+		serverError(w, "failed to predict next nap", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	fmt.Fprint(w, buildCalendar(f, resolveLocale(r, settings.Locale), tl.Items, types, prediction, now))
+}
+
+// calendarPath is where a family's feed is served, relative to BASE_PATH.
+func calendarPath(token string) string {
+	return "/cal/" + token + ".ics"
+}
+
+// getCalendar serves GET /admin/families/{id}/calendar.
+func (s *Server) getCalendar(w http.ResponseWriter, r *http.Request) {
+	token, err := s.db.CalendarToken(r.PathValue("id"), false)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to get calendar", err)
+		return
+	}
+	if token == "" {
+		jsonOK(w, map[string]any{"enabled": false})
+		return
+	}
+	jsonOK(w, map[string]any{"enabled": true, "path": calendarPath(token)})
+}
+
+// rotateCalendar serves POST /admin/families/{id}/calendar, which enables
+// the feed or replaces its URL.
+func (s *Server) rotateCalendar(w http.ResponseWriter, r *http.Request) {
+	token, err := s.db.RotateCalendarToken(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to create calendar", err)
+		return
+	}
+	jsonOK(w, map[string]any{"enabled": true, "path": calendarPath(token)})
+}
+
+// disableCalendar serves DELETE /admin/families/{id}/calendar.
+func (s *Server) disableCalendar(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.DisableCalendar(r.PathValue("id")); err != nil {
+		serverError(w, "failed to disable calendar", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleClientCalendar serves GET /api/v1/calendar, giving caregivers their
+// family's feed URL (enabling it on first use).
+func (s *Server) handleClientCalendar(w http.ResponseWriter, r *http.Request) {
+	token, err := s.db.CalendarToken(accessLinkFrom(r.Context()).FamilyID, true)
+	if err != nil {
+		serverError(w, "failed to get calendar", err)
+		return
+	}
+	jsonOK(w, map[string]any{"enabled": true, "path": calendarPath(token)})
+}
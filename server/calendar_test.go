@@ -0,0 +1,98 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICSFolding(t *testing.T) {
+	var b strings.Builder
+	icsLine(&b, "SUMMARY:"+strings.Repeat("ü", 60))
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 || !utf8.ValidString(strings.TrimPrefix(line, " ")) {
+			t.Errorf("bad folded line %q", line)
+		}
+	}
+	if got := icsEscape("a,b;c\\d\ne"); got != `a\,b\;c\\d\ne` {
+		t.Errorf("escape = %q", got)
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Baby, Smith", "")
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	now := time.Now()
+	s.db.SaveFamilySettings(family.ID, FamilySettings{BirthDate: now.AddDate(0, -2, 0).Format("2006-01-02")})
+	for _, e := range []*Entry{
+		{ID: "s1", Ts: now.Add(-5 * time.Hour).UnixMilli(), Type: "sleep", Value: "sleeping"},
+		{ID: "s2", Ts: now.Add(-3 * time.Hour).UnixMilli(), Type: "sleep", Value: "awake"},
+		{ID: "f1", Ts: now.Add(-2 * time.Hour).UnixMilli(), Type: "feed", Value: "bf"},
+		{ID: "n1", Ts: now.Add(-time.Hour).UnixMilli(), Type: "nappy", Value: "wet"},
+	} {
+		e.FamilyID = family.ID
+		s.db.UpsertEntry(e)
+	}
+
+	enable := func() string {
+		req := httptest.NewRequest("POST", "/admin/families/"+family.ID+"/calendar", nil)
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.rotateCalendar(w, req)
+		var resp struct{ Path string }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Path
+	}
+	fetch := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	path := enable()
+	code, body := fetch(path)
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %s", code, body)
+	}
+	if n := strings.Count(body, "BEGIN:VEVENT"); n != 3 { // sleep, feed, predicted nap
+		t.Errorf("got %d events:\n%s", n, body)
+	}
+	for _, want := range []string{"X-WR-CALNAME:Baby\\, Smith\r\n", "UID:s1@babytrack", "SUMMARY:Sleep: Sleeping", "SUMMARY:Feed: Breastfeed", "SUMMARY:Next nap window"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("feed missing %q", want)
+		}
+	}
+	if strings.Contains(body, "UID:s2@") || strings.Contains(body, "UID:n1@") {
+		t.Error("awake periods and nappies should not be events")
+	}
+
+	if code, body := fetch(path + "?types=nappy"); code != http.StatusOK || !strings.Contains(body, "UID:n1@") {
+		t.Errorf("types=nappy: %d %s", code, body)
+	}
+
+	// Rotating invalidates the old URL
+	newPath := enable()
+	if code, _ := fetch(path); code != http.StatusNotFound {
+		t.Errorf("old URL: status %d", code)
+	}
+	if code, _ := fetch(strings.TrimSuffix(newPath, ".ics")); code != http.StatusNotFound {
+		t.Errorf("missing .ics: status %d", code)
+	}
+	s.db.DisableCalendar(family.ID)
+	if code, _ := fetch(newPath); code != http.StatusNotFound {
+		t.Errorf("disabled: status %d", code)
+	}
+}
@@ -0,0 +1,152 @@
+package babytrack
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestJSONToCBOR(t *testing.T) {
+	// Vectors from RFC 8949 appendix A
+	for in, want := range map[string]string{
+		`0`:                 "00",
+		`23`:                "17",
+		`24`:                "1818",
+		`1000`:              "1903e8",
+		`1000000000000`:     "1b000000e8d4a51000",
+		`-1`:                "20",
+		`-1000`:             "3903e7",
+		`1.1`:               "fb3ff199999999999a",
+		`true`:              "f5",
+		`null`:              "f6",
+		`"IETF"`:            "6449455446",
+		`"ü"`:               "62c3bc",
+		`[1,[2,3],[4,5]]`:   "8301820203820405",
+		`{"a":1,"b":[2,3]}`: "a26161016162820203",
+		`{"b":"x","a":"y"}`: "a26161617961626178", // keys sorted
+	} {
+		got, err := jsonToCBOR([]byte(in))
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if hex.EncodeToString(got) != want {
+			t.Errorf("%s = %x, want %s", in, got, want)
+		}
+	}
+}
+
+func TestCBORToJSON(t *testing.T) {
+	for in, want := range map[string]string{
+		"00":         `0`,
+		"3903e7":     `-1000`,
+		"f93e00":     `1.5`,
+		"fa47c35000": `100000`,
+		"f4":         `false`,
+		"f7":         `null`,
+		"4401020304": `"\u0001\u0002\u0003\u0004"`,
+		"c074323031332d30332d32315432303a30343a30305a": `"2013-03-21T20:04:00Z"`,
+		"a26161016162820203":                           `{"a":1,"b":[2,3]}`,
+	} {
+		data, _ := hex.DecodeString(in)
+		got, err := cborToJSON(data)
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %s, %v; want %s", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{
+		"",           // empty
+		"18",         // truncated argument
+		"62c3",       // truncated string
+		"9a7fffffff", // array longer than the input
+		"5f",         // indefinite length
+		"a10102",     // non-string key
+		"0000",       // trailing bytes
+		"62c328",     // invalid UTF-8
+	} {
+		data, _ := hex.DecodeString(in)
+		if got, err := cborToJSON(data); err == nil {
+			t.Errorf("%s decoded to %s", in, got)
+		}
+	}
+
+	deep, _ := hex.DecodeString(strings.Repeat("81", cborMaxDepth+2) + "00")
+	if _, err := cborToJSON(deep); err == nil {
+		t.Error("decoded past the depth limit")
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	msg := `{"entry":{"data":{"volume_ml":90.5},"deleted":false,"id":"e1","seq":42,"ts":1700000000000,"value":"bf"},"type":"entry"}`
+	b, err := jsonToCBOR([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) >= len(msg) {
+		t.Errorf("CBOR is %d bytes, JSON %d", len(b), len(msg))
+	}
+	back, err := cborToJSON(b)
+	if err != nil || string(back) != msg {
+		t.Errorf("round trip = %s, %v", back, err)
+	}
+}
+
+func TestCBOREncodingNegotiated(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?hello=1", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]any{"type": "hello", "protocol_version": protocolVersion, "encodings": []string{"msgpack", "cbor", "json"}})
+
+	// Like skipUntilType, for binary frames
+	readUntil := func(wantType string) map[string]any {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("failed to read message while waiting for %s: %v", wantType, err)
+			}
+			if typ != websocket.BinaryMessage {
+				t.Fatalf("got a text frame: %s", data)
+			}
+			j, err := cborToJSON(data)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			var m map[string]any
+			json.Unmarshal(j, &m)
+			if m["type"] == wantType {
+				return m
+			}
+		}
+	}
+	if m := readUntil("hello"); m["encoding"] != encodingCBOR {
+		t.Errorf("hello = %v", m)
+	}
+	readUntil("init")
+
+	// Binary frames from the client are understood too
+	ping, _ := jsonToCBOR([]byte(`{"type":"ping"}`))
+	conn.WriteMessage(websocket.BinaryMessage, ping)
+	readUntil("pong")
+}
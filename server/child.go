@@ -0,0 +1,40 @@
+package babytrack
+
+import "errors"
+
+// Multi-child families tag entries with a child_id. A device can follow just
+// one child by connecting to the WebSocket with ?child=ID: its init, sync
+// responses and broadcasts then only carry that child's entries, and entries
+// it logs without a child_id are stamped with it. Summaries take the same
+// ?child= filter.
+
+const maxChildIDLen = 64
+
+var errChildIDTooLong = errors.New("child_id too long")
+
+// entriesForChild returns the entries about childID, or all of them if
+// childID is empty. The slice is filtered in place.
+func entriesForChild(entries []Entry, childID string) []Entry {
+	if childID == "" {
+		return entries
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if e.ChildID == childID {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// validateChildID stamps e with the connection's child if it has none, and
+// checks its length.
+func validateChildID(e *Entry, connChild string) error {
+	if e.ChildID == "" {
+		e.ChildID = connChild
+	}
+	if len(e.ChildID) > maxChildIDLen {
+		return errChildIDTooLong
+	}
+	return nil
+}
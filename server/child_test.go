@@ -0,0 +1,132 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestChildEntriesSinceCursor(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Twins", "")
+	for i, child := range []string{"ada", "bea", "ada", ""} {
+		db.UpsertEntry(&Entry{ID: "e" + string(rune('1'+i)), FamilyID: family.ID, Ts: int64(i), Type: "feed", Value: "bf", ChildID: child})
+	}
+
+	ada, _, _ := db.GetChildEntriesSinceCursor(family.ID, "ada", 0, 10)
+	if len(ada) != 2 || ada[0].ID != "e1" || ada[1].ID != "e3" {
+		t.Errorf("ada entries = %+v", ada)
+	}
+	ada, _, _ = db.GetChildEntriesSinceCursor(family.ID, "ada", ada[0].Seq, 10)
+	if len(ada) != 1 || ada[0].ID != "e3" {
+		t.Errorf("ada after cursor = %+v", ada)
+	}
+	if all, _, _ := db.GetEntriesSinceCursor(family.ID, 0, 10); len(all) != 4 {
+		t.Errorf("unfiltered got %d entries", len(all))
+	}
+
+	// Updates from clients that don't know about children keep the tag
+	db.UpsertEntry(&Entry{ID: "e2", FamilyID: family.ID, Ts: 1, Type: "feed", Value: "bottle"})
+	if e, _ := db.GetEntry(family.ID, "e2"); e.ChildID != "bea" || e.Value != "bottle" {
+		t.Errorf("after untagged update: %+v", e)
+	}
+}
+
+func TestChildScopedWebSocket(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Twins", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	now := time.Now().UnixMilli()
+	db.UpsertEntry(&Entry{ID: "old-ada", FamilyID: family.ID, Ts: now, Type: "feed", Value: "bf", ChildID: "ada"})
+	db.UpsertEntry(&Entry{ID: "old-bea", FamilyID: family.ID, Ts: now, Type: "feed", Value: "bf", ChildID: "bea"})
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	dial := func(query string) *websocket.Conn {
+		header := http.Header{"Cookie": {"client_session=" + link.Token}}
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+query, header)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return conn
+	}
+
+	adaDevice := dial("?child=ada")
+	defer adaDevice.Close()
+	init := skipUntilType(t, adaDevice, "init")
+	if entries := init["entries"].([]any); len(entries) != 1 || entries[0].(map[string]any)["id"] != "old-ada" {
+		t.Errorf("init entries = %v", entries)
+	}
+
+	// Entries logged on a scoped device are stamped with its child
+	adaDevice.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "new-ada", "ts": now, "type": "nappy", "value": "wet"}})
+	skipUntilType(t, adaDevice, "entry_ack")
+	if e, _ := db.GetEntry(family.ID, "new-ada"); e.ChildID != "ada" {
+		t.Errorf("child_id = %q, want ada", e.ChildID)
+	}
+
+	// Another device logs for each twin; only Ada's reaches the Ada device
+	other := dial("")
+	defer other.Close()
+	skipUntilType(t, other, "init")
+	for _, child := range []string{"bea", "ada"} {
+		other.WriteJSON(map[string]any{"type": "entry", "action": "add",
+			"entry": map[string]any{"id": "from-other-" + child, "ts": now, "type": "feed", "value": "bf", "child_id": child}})
+		skipUntilType(t, other, "entry_ack")
+	}
+	msg := skipUntilType(t, adaDevice, "entry")
+	if id := msg["entry"].(map[string]any)["id"]; id != "from-other-ada" {
+		t.Errorf("ada device got %v", id)
+	}
+
+	adaDevice.WriteJSON(map[string]any{"type": "sync_request", "cursor": 0})
+	resp := skipUntilType(t, adaDevice, "sync_response")
+	var synced []Entry
+	raw, _ := json.Marshal(resp["entries"])
+	json.Unmarshal(raw, &synced)
+	for _, e := range synced {
+		if e.ChildID != "ada" {
+			t.Errorf("sync returned %s for %q", e.ID, e.ChildID)
+		}
+	}
+	if len(synced) != 3 {
+		t.Errorf("synced %d entries, want 3", len(synced))
+	}
+}
+
+func TestChildSummary(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Twins", "")
+	day := time.Date(2026, 1, 25, 0, 0, 0, 0, time.UTC)
+	for i, child := range []string{"ada", "ada", "bea"} {
+		s.db.UpsertEntry(&Entry{ID: "f" + string(rune('1'+i)), FamilyID: family.ID, Ts: day.Add(time.Duration(i+8) * time.Hour).UnixMilli(), Type: "feed", Value: "bf", ChildID: child})
+	}
+
+	for child, want := range map[string]int{"": 3, "ada": 2, "bea": 1} {
+		req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/summary?date=2026-01-25&offset=0&child="+child, nil)
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.getFamilySummary(w, req)
+		var summary DailySummary
+		json.Unmarshal(w.Body.Bytes(), &summary)
+		if summary.Totals["feed"] != want {
+			t.Errorf("child %q: %d feeds, want %d", child, summary.Totals["feed"], want)
+		}
+	}
+}
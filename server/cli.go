@@ -0,0 +1,274 @@
+package babytrack
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const cliUsage = `usage: babytrackd [flags] [command]
+
+With no command, runs the server. Commands operate directly on DB_PATH and
+can be used while the server is stopped:
+
+  family create [--notes TEXT] [--org ORG_ID] NAME
+  link create [--label TEXT] [--expires DURATION] [--role full|summary] FAMILY_ID
+  admin reset-password USERNAME     (reads the new password from stdin;
+                                     generates one if stdin is empty)
+  org create NAME                   (prints the new org's ID)
+  org add-admin ORG_ID USERNAME     (reads the password from stdin;
+                                     generates one if stdin is empty)
+  db status                         (lists migrations and whether each
+                                     is applied)
+  db migrate [--dry-run]            (--dry-run applies pending migrations
+                                     in a transaction and rolls it back)
+  db rekey                          (reads the new key from stdin; empty
+                                     decrypts. Needs a SQLCipher build)
+
+  loadtest [--clients N] [--families N] [--duration DURATION]
+           [--rate WRITES_PER_MIN] [--url URL] ADMIN_USERNAME
+                                    (runs against a live server, BASE_URL by
+                                     default; reads the password from stdin)
+`
+
+// runCLI executes an administrative subcommand against the database at
+// dbPath, opened with dbKey. baseURL (origin plus any BASE_PATH, no
+// trailing slash) prefixes printed access links.
+func runCLI(args []string, dbPath, dbKey, baseURL string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) > 0 && args[0] == "loadtest" {
+		return runLoadtestCLI(args[1:], baseURL, stdin, stdout)
+	}
+	if len(args) < 2 {
+		return errors.New(cliUsage)
+	}
+	cmd, args := args[0]+" "+args[1], args[2:]
+
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var notes, label, role, org string
+	var expires time.Duration
+	var dryRun bool
+	switch cmd {
+	case "family create":
+		fs.StringVar(&notes, "notes", "", "family notes")
+		fs.StringVar(&org, "org", "", "org the family belongs to")
+	case "link create":
+		fs.StringVar(&label, "label", "", "link label, e.g. the device or person")
+		fs.DurationVar(&expires, "expires", 0, "link lifetime, e.g. 720h; 0 never expires")
+		fs.StringVar(&role, "role", roleFull, "full, or summary for a read-only summary link")
+	case "db migrate":
+		fs.BoolVar(&dryRun, "dry-run", false, "list pending migrations without applying them")
+	case "org create", "org add-admin", "admin reset-password", "db status", "db rekey":
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", cmd, cliUsage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", cmd, err)
+	}
+
+	if cmd == "db status" || dryRun {
+		return runMigrationCLI(cmd, dbPath, dbKey, dryRun, stdout)
+	}
+
+	// Opening the database applies pending migrations, which is all
+	// "db migrate" needs to do.
+	db, err := NewKeyedDB(dbPath, dbKey)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", dbPath, err)
+	}
+	defer db.Close()
+
+	switch cmd {
+	case "family create":
+		name := strings.TrimSpace(strings.Join(fs.Args(), " "))
+		if name == "" {
+			return errors.New("family create: name is required")
+		}
+		if org != "" {
+			if _, err := db.GetOrg(org); err != nil {
+				return fmt.Errorf("family create: org %q not found", org)
+			}
+		}
+		f, err := db.CreateOrgFamily(org, name, notes)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, f.ID)
+
+	case "org create":
+		name := strings.TrimSpace(strings.Join(fs.Args(), " "))
+		if name == "" {
+			return errors.New("org create: name is required")
+		}
+		o, err := db.CreateOrg(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, o.ID)
+
+	case "org add-admin":
+		if fs.NArg() != 2 {
+			return errors.New("org add-admin: ORG_ID and USERNAME are required")
+		}
+		if _, err := db.GetOrg(fs.Arg(0)); err != nil {
+			return fmt.Errorf("org add-admin: org %q not found", fs.Arg(0))
+		}
+		password, _ := bufio.NewReader(stdin).ReadString('\n')
+		password = strings.TrimRight(password, "\r\n")
+		generated := password == ""
+		if generated {
+			password = generateToken(12)
+		}
+		if _, err := db.CreateOrgAdmin(fs.Arg(0), fs.Arg(1), password); err == errAdminExists {
+			return fmt.Errorf("org add-admin: %q is already an admin", fs.Arg(1))
+		} else if err != nil {
+			return err
+		}
+		if generated {
+			fmt.Fprintln(stdout, password)
+		}
+
+	case "link create":
+		if fs.NArg() != 1 {
+			return errors.New("link create: exactly one FAMILY_ID is required")
+		}
+		if !linkRoles[role] {
+			return fmt.Errorf("link create: unknown role %q", role)
+		}
+		if _, err := db.GetFamily(fs.Arg(0)); err != nil {
+			return fmt.Errorf("link create: family %q not found", fs.Arg(0))
+		}
+		var expiresAt *int64
+		if expires > 0 {
+			t := time.Now().Add(expires).UnixMilli()
+			expiresAt = &t
+		}
+		link, err := db.CreateAccessLinkRole(fs.Arg(0), label, role, expiresAt)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, baseURL+"/t/"+link.Token)
+
+	case "admin reset-password":
+		if fs.NArg() != 1 {
+			return errors.New("admin reset-password: exactly one USERNAME is required")
+		}
+		password, _ := bufio.NewReader(stdin).ReadString('\n')
+		password = strings.TrimRight(password, "\r\n")
+		generated := password == ""
+		if generated {
+			password = generateToken(12)
+		}
+		if err := db.SetAdminPassword(fs.Arg(0), password); err == sql.ErrNoRows {
+			return fmt.Errorf("admin reset-password: no admin named %q", fs.Arg(0))
+		} else if err != nil {
+			return err
+		}
+		if generated {
+			fmt.Fprintln(stdout, password)
+		}
+
+	case "db migrate":
+		var version int
+		if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "schema version %d\n", version)
+
+	case "db rekey":
+		newKey, _ := bufio.NewReader(stdin).ReadString('\n')
+		newKey = strings.TrimRight(newKey, "\r\n")
+		if err := db.Rekey(newKey); err != nil {
+			return fmt.Errorf("db rekey: %w", err)
+		}
+		if newKey == "" {
+			fmt.Fprintln(stdout, "database decrypted; unset DB_KEY")
+		} else {
+			fmt.Fprintln(stdout, "database re-encrypted; set DB_KEY to the new key")
+		}
+	}
+	return nil
+}
+
+// runMigrationCLI runs the db commands that mustn't migrate the database by
+// opening it: "db status" and "db migrate --dry-run".
+func runMigrationCLI(cmd, dbPath, dbKey string, dryRun bool, stdout io.Writer) error {
+	db, err := openSQL(dbPath, dbKey)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", dbPath, err)
+	}
+	defer db.Close()
+
+	if dryRun {
+		pending, err := applyMigrations(db, true)
+		for _, m := range pending {
+			fmt.Fprintf(stdout, "would apply %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("db migrate: %w", err)
+		}
+		if len(pending) == 0 {
+			fmt.Fprintln(stdout, "up to date")
+		}
+		return nil
+	}
+
+	status, err := migrationStatus(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range status {
+		state := "pending"
+		if m.AppliedAt > 0 {
+			state = "applied " + time.UnixMilli(m.AppliedAt).UTC().Format(time.RFC3339)
+		} else if m.Applied {
+			state = "applied"
+		}
+		fmt.Fprintf(stdout, "%03d_%-24s %s\n", m.Version, m.Name, state)
+	}
+	return nil
+}
+
+// runLoadtestCLI parses "loadtest" and prints its report. It talks to the
+// server over HTTP and never opens the database.
+func runLoadtestCLI(args []string, baseURL string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg := loadtestConfig{URL: baseURL}
+	fs.IntVar(&cfg.Clients, "clients", 20, "simulated devices")
+	fs.IntVar(&cfg.Families, "families", 5, "families to spread the devices across")
+	fs.DurationVar(&cfg.Duration, "duration", time.Minute, "how long to generate traffic")
+	fs.Float64Var(&cfg.Rate, "rate", 6, "entries each device writes per minute, on average")
+	fs.StringVar(&cfg.URL, "url", cfg.URL, "server origin plus any base path")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("loadtest: %w", err)
+	}
+	cfg.Username = fs.Arg(0)
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	switch {
+	case cfg.Username == "":
+		return errors.New("loadtest: admin username is required")
+	case cfg.URL == "":
+		return errors.New("loadtest: --url or BASE_URL is required")
+	case cfg.Clients < 1 || cfg.Families < 1 || cfg.Families > cfg.Clients:
+		return errors.New("loadtest: need at least one client per family")
+	case cfg.Duration <= 0 || cfg.Rate <= 0:
+		return errors.New("loadtest: duration and rate must be positive")
+	}
+	password, _ := bufio.NewReader(stdin).ReadString('\n')
+	cfg.Password = strings.TrimRight(password, "\r\n")
+
+	report, err := runLoadtest(cfg)
+	if report != nil {
+		report.print(stdout)
+	}
+	if err != nil {
+		return fmt.Errorf("loadtest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package babytrack
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCLI(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	run := func(stdin string, args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runCLI(args, path, "", "https://example.com/bt", strings.NewReader(stdin), &out)
+		return strings.TrimSpace(out.String()), err
+	}
+
+	if out, err := run("", "db", "migrate"); err != nil || out != fmt.Sprintf("schema version %d", len(migrations)) {
+		t.Fatalf("db migrate: %q, %v", out, err)
+	}
+
+	familyID, err := run("", "family", "create", "--notes", "twins", "The", "Smiths")
+	if err != nil {
+		t.Fatalf("family create: %v", err)
+	}
+
+	url, err := run("", "link", "create", "--label", "Grandma", "--expires", "24h", familyID)
+	if err != nil {
+		t.Fatalf("link create: %v", err)
+	}
+	if !strings.HasPrefix(url, "https://example.com/bt/t/") {
+		t.Fatalf("link url = %q", url)
+	}
+	if _, err := run("", "link", "create", "nope"); err == nil {
+		t.Error("expected error for unknown family")
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	f, err := db.GetFamily(familyID)
+	if err != nil || f.Name != "The Smiths" || f.Notes != "twins" {
+		t.Fatalf("family = %+v, %v", f, err)
+	}
+	link, err := db.ValidateAccessLink(strings.TrimPrefix(url, "https://example.com/bt/t/"))
+	if err != nil || link.Label != "Grandma" || link.ExpiresAt == nil {
+		t.Fatalf("link = %+v, %v", link, err)
+	}
+
+	if err := db.EnsureAdmin("jane", "old"); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := run("new-secret\n", "admin", "reset-password", "jane"); err != nil || out != "" {
+		t.Fatalf("reset-password: %q, %v", out, err)
+	}
+	admin, _ := db.GetAdminByUsername("jane")
+	if bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte("new-secret")) != nil {
+		t.Error("password not updated")
+	}
+	generated, err := run("", "admin", "reset-password", "jane")
+	if err != nil || generated == "" {
+		t.Fatalf("generated reset: %q, %v", generated, err)
+	}
+	admin, _ = db.GetAdminByUsername("jane")
+	if bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(generated)) != nil {
+		t.Error("generated password not stored")
+	}
+	if _, err := run("x\n", "admin", "reset-password", "nobody"); err == nil {
+		t.Error("expected error for unknown admin")
+	}
+
+	if _, err := run("", "bogus", "cmd"); err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
@@ -0,0 +1,85 @@
+package babytrack
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	accessLinkKey ctxKey = "access_link"
+	deviceIDKey   ctxKey = "device_id"
+)
+
+// Access link roles. Full links can read and write everything; summary
+// links are for extended family who only want to see how the day is going,
+// and get the summary, status, state and prediction endpoints plus a
+// pared-down WS feed (see summaryBroadcast), with no entry history and no
+// writes.
+const (
+	roleFull    = "full"
+	roleSummary = "summary"
+)
+
+var linkRoles = map[string]bool{roleFull: true, roleSummary: true}
+
+// LinkPermissions narrows what a full link may do, e.g. a babysitter's link
+// that logs feeds but can't delete history or redesign the buttons. Adding
+// and editing entries is always allowed.
+type LinkPermissions struct {
+	CanDelete     bool `json:"can_delete"`
+	CanEditConfig bool `json:"can_edit_config"`
+	CanExport     bool `json:"can_export"`
+}
+
+var allPermissions = LinkPermissions{CanDelete: true, CanEditConfig: true, CanExport: true}
+
+// clientRequired authenticates client API requests by their client_session
+// cookie and makes the access link available via accessLinkFrom. Summary
+// links are refused; use summaryAllowed for endpoints they may read.
+func (s *Server) clientRequired(next http.HandlerFunc) http.HandlerFunc {
+	return s.linkRequired(next, false)
+}
+
+// summaryAllowed is clientRequired, but also accepts summary links.
+func (s *Server) summaryAllowed(next http.HandlerFunc) http.HandlerFunc {
+	return s.linkRequired(next, true)
+}
+
+func (s *Server) linkRequired(next http.HandlerFunc, allowSummary bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("client_session")
+		if err != nil {
+			jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
+			return
+		}
+		link, err := s.db.ValidateAccessLink(cookie.Value)
+		if err != nil {
+			jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid or expired link")
+			return
+		}
+		deviceID, ok := s.checkDevice(w, r, link)
+		if !ok {
+			return
+		}
+		s.renewHTTPSession(w, r, link, deviceID)
+		if link.Role != roleFull && !allowSummary {
+			jsonError(w, http.StatusForbidden, errCodeForbidden, "this link can only view the summary")
+			return
+		}
+		ctx := context.WithValue(r.Context(), accessLinkKey, link)
+		next(w, r.WithContext(context.WithValue(ctx, deviceIDKey, deviceID)))
+	}
+}
+
+// accessLinkFrom returns the link authenticated by clientRequired.
+func accessLinkFrom(ctx context.Context) *AccessLink {
+	link, _ := ctx.Value(accessLinkKey).(*AccessLink)
+	return link
+}
+
+// deviceIDFrom returns the ID of the device making a request authenticated
+// by clientRequired, or "" if it has no record; see checkDevice.
+func deviceIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(deviceIDKey).(string)
+	return id
+}
@@ -0,0 +1,264 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSummaryLinkEndpoints(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	full, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	grandma, _ := s.db.CreateAccessLinkRole(family.ID, "Grandma", roleSummary, nil)
+	handler := s.routes()
+
+	get := func(path, token string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.AddCookie(&http.Cookie{Name: "client_session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	for path, want := range map[string]int{
+		"/api/v1/summary":  http.StatusOK,
+		"/api/v1/status":   http.StatusOK,
+		"/api/v1/state":    http.StatusOK,
+		"/api/v1/timeline": http.StatusForbidden,
+		"/api/v1/calendar": http.StatusForbidden,
+	} {
+		if code := get(path, grandma.Token); code != want {
+			t.Errorf("summary link %s: got %d, want %d", path, code, want)
+		}
+		if code := get(path, full.Token); code != http.StatusOK {
+			t.Errorf("full link %s: got %d", path, code)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/t/"+grandma.Token, nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if loc := w.Header().Get("Location"); loc != "/summary" {
+		t.Errorf("summary link redirects to %q", loc)
+	}
+
+	// Roles are validated on create
+	req = httptest.NewRequest("POST", "/admin/families/"+family.ID+"/links", strings.NewReader(`{"role":"owner"}`))
+	req.SetPathValue("id", family.ID)
+	w = httptest.NewRecorder()
+	s.createAccessLink(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown role: got %d", w.Code)
+	}
+}
+
+func TestSummaryLinkWebSocket(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	mum, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	grandma, _ := db.CreateAccessLinkRole(family.ID, "Grandma", roleSummary, nil)
+	db.UpsertEntry(&Entry{ID: "old", FamilyID: family.ID, Ts: time.Now().UnixMilli(), Type: "feed", Value: "bf"})
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	dial := func(token string) *websocket.Conn {
+		header := http.Header{"Cookie": {"client_session=" + token}}
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return conn
+	}
+
+	viewer := dial(grandma.Token)
+	defer viewer.Close()
+	init := skipUntilType(t, viewer, "init")
+	if _, ok := init["entries"]; ok {
+		t.Error("summary init should not include entries")
+	}
+	if init["role"] != roleSummary {
+		t.Errorf("init role = %v", init["role"])
+	}
+
+	viewer.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "sneaky", "ts": time.Now().UnixMilli(), "type": "feed", "value": "bf"}})
+	if m := skipUntilType(t, viewer, "entry_rejected"); m["id"] != "sneaky" {
+		t.Errorf("rejected %v", m["id"])
+	}
+	if db.EntryExists(family.ID, "sneaky") {
+		t.Error("summary link wrote an entry")
+	}
+
+	writer := dial(mum.Token)
+	defer writer.Close()
+	skipUntilType(t, writer, "init")
+	writer.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "s1", "ts": time.Now().UnixMilli(), "type": "sleep", "value": "sleeping"}})
+
+	// The viewer learns something changed and sees the new state, but never
+	// the entry itself or who is connected.
+	viewer.SetReadDeadline(time.Now().Add(time.Second))
+	var gotChanged, gotState bool
+	for !gotChanged || !gotState {
+		_, msg, err := viewer.ReadMessage()
+		if err != nil {
+			t.Fatalf("changed=%v state=%v: %v", gotChanged, gotState, err)
+		}
+		var m map[string]any
+		json.Unmarshal(msg, &m)
+		switch m["type"] {
+		case "changed":
+			gotChanged = true
+		case "state":
+			gotState = m["state"].(map[string]any)["sleeping"] == true
+		case "entry", "presence":
+			t.Errorf("summary link got %s message", m["type"])
+		}
+	}
+}
+
+func TestLinkTokensHashed(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+
+	var stored string
+	db.QueryRow("SELECT token FROM access_links").Scan(&stored)
+	if stored == link.Token || stored != link.ID || stored != hashToken(link.Token) {
+		t.Errorf("stored %q for token %q", stored, link.Token)
+	}
+	if got, err := db.ValidateAccessLink(link.Token); err != nil || got.ID != link.ID || got.Token != "" {
+		t.Errorf("validate = %+v, %v", got, err)
+	}
+	if _, err := db.ValidateAccessLink(link.ID); err == nil {
+		t.Error("the stored hash worked as a token")
+	}
+
+	// Tokens from before hashing are hashed on the next open
+	db.Exec("INSERT INTO access_links (token, family_id, label, created_at) VALUES ('legacy', ?, 'Old', 0)", family.ID)
+	db.Close()
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got, err := db.ValidateAccessLink("legacy"); err != nil || got.ID != hashToken("legacy") {
+		t.Errorf("legacy token after reopen = %+v, %v", got, err)
+	}
+	if id, err := db.DeleteAccessLink(family.ID, "legacy"); err != nil || id != hashToken("legacy") {
+		t.Errorf("delete by token = %q, %v", id, err)
+	}
+	if id, err := db.DeleteAccessLink(family.ID, link.ID); err != nil || id != link.ID {
+		t.Errorf("delete by id = %q, %v", id, err)
+	}
+}
+
+func TestLinkPermissions(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	s.db.UpsertEntry(&Entry{ID: "old", FamilyID: family.ID, Ts: time.Now().UnixMilli(), Type: "feed", Value: "bf"})
+
+	// Created with everything but deleting
+	req := httptest.NewRequest("POST", "/admin/families/"+family.ID+"/links",
+		strings.NewReader(`{"label":"Sitter","can_delete":false}`))
+	req.SetPathValue("id", family.ID)
+	w := httptest.NewRecorder()
+	s.createAccessLink(w, req)
+	var sitter AccessLink
+	json.Unmarshal(w.Body.Bytes(), &sitter)
+	if w.Code != http.StatusCreated || sitter.CanDelete || !sitter.CanEditConfig || !sitter.CanExport {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + sitter.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	init := skipUntilType(t, conn, "init")
+	if perms := init["permissions"].(map[string]any); perms["can_delete"] != false || perms["can_export"] != true {
+		t.Errorf("init permissions = %v", perms)
+	}
+
+	conn.WriteJSON(map[string]any{"type": "entry", "action": "delete", "id": "old"})
+	if m := skipUntilType(t, conn, "entry_rejected"); m["id"] != "old" || m["reason"] != "forbidden" {
+		t.Errorf("delete rejected with %v", m)
+	}
+	conn.WriteJSON(map[string]any{"type": "entry", "action": "update",
+		"entry": map[string]any{"id": "old", "ts": time.Now().UnixMilli(), "type": "feed", "value": "bf", "deleted": true}})
+	skipUntilType(t, conn, "entry_rejected")
+	if e, _ := s.db.GetEntry(family.ID, "old"); e == nil || e.Deleted {
+		t.Error("sitter link deleted an entry")
+	}
+
+	// Taking away config editing reconnects the link's devices
+	req = httptest.NewRequest("PATCH", "/admin/families/"+family.ID+"/links/"+sitter.ID,
+		strings.NewReader(`{"can_edit_config":false,"can_export":false}`))
+	req.SetPathValue("id", family.ID)
+	req.SetPathValue("token", sitter.ID)
+	w = httptest.NewRecorder()
+	s.updateAccessLink(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+				t.Errorf("closed with %v", err)
+			}
+			break
+		}
+	}
+
+	conn, _, err = websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("redial: %v", err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+	before, _ := s.db.GetConfig(family.ID)
+	conn.WriteJSON(map[string]any{"type": "config", "data": map[string]any{"buttons": []string{}}})
+	if m := skipUntilType(t, conn, "config_rejected"); m["reason"] != "forbidden" {
+		t.Errorf("config rejected with %v", m)
+	}
+	if config, _ := s.db.GetConfig(family.ID); config != before {
+		t.Errorf("sitter link saved config %q", config)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/takeout", nil)
+	req.AddCookie(&http.Cookie{Name: "client_session", Value: sitter.Token})
+	w = httptest.NewRecorder()
+	s.routes().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("takeout: got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("PATCH", "/admin/families/"+family.ID+"/links/nope", strings.NewReader(`{}`))
+	req.SetPathValue("id", family.ID)
+	req.SetPathValue("token", "nope")
+	w = httptest.NewRecorder()
+	s.updateAccessLink(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown link: got %d", w.Code)
+	}
+}
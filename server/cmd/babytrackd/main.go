@@ -0,0 +1,8 @@
+// Command babytrackd is the babytrack server; see docs/backend.md.
+package main
+
+import babytrack "babytrackd"
+
+func main() {
+	babytrack.Main()
+}
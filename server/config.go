@@ -0,0 +1,132 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+)
+
+// A family's button config is a JSON array of groups, each a category of
+// buttons, saved by any device and broadcast to the rest. Every device
+// renders it as sent, so a malformed one breaks the app for the whole
+// family: validateConfig checks the shape the app relies on before it is
+// saved. Fields it doesn't know are kept, for newer clients.
+
+const (
+	maxConfigBytes   = 64 << 10
+	maxConfigGroups  = 50
+	maxGroupButtons  = 50
+	maxConfigNameLen = 64
+	maxEmojiLen      = 32
+)
+
+var errInvalidConfig = errors.New("invalid config")
+
+type configGroup struct {
+	Category string          `json:"category"`
+	Stateful bool            `json:"stateful"`
+	Buttons  *[]configButton `json:"buttons"`
+}
+
+type configButton struct {
+	Value          string  `json:"value"`
+	Label          string  `json:"label"`
+	Emoji          string  `json:"emoji"`
+	CountDaily     bool    `json:"countDaily"`
+	MinIntervalMin float64 `json:"minIntervalMin"`
+}
+
+// validateConfig checks a button config before it is saved.
+func validateConfig(data []byte) error {
+	if len(data) > maxConfigBytes {
+		return fmt.Errorf("config is over %d KB", maxConfigBytes>>10)
+	}
+	var groups []configGroup
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return errors.New("config must be a list of button groups: " + err.Error())
+	}
+	if groups == nil {
+		return errors.New("config must be a list of button groups")
+	}
+	if len(groups) > maxConfigGroups {
+		return fmt.Errorf("config has over %d groups", maxConfigGroups)
+	}
+	categories := make(map[string]bool, len(groups))
+	for i, g := range groups {
+		if g.Category == "" || len(g.Category) > maxConfigNameLen {
+			return fmt.Errorf("group %d: category must be 1-%d characters", i+1, maxConfigNameLen)
+		}
+		if categories[g.Category] {
+			return fmt.Errorf("group %d: category %q is used twice", i+1, g.Category)
+		}
+		categories[g.Category] = true
+		if g.Buttons == nil {
+			return fmt.Errorf("group %q has no buttons list", g.Category)
+		}
+		if len(*g.Buttons) > maxGroupButtons {
+			return fmt.Errorf("group %q has over %d buttons", g.Category, maxGroupButtons)
+		}
+		values := make(map[string]bool, len(*g.Buttons))
+		for _, b := range *g.Buttons {
+			if b.Value == "" || len(b.Value) > maxConfigNameLen || len(b.Label) > maxConfigNameLen {
+				return fmt.Errorf("group %q: button values and labels must be 1-%d characters", g.Category, maxConfigNameLen)
+			}
+			if values[b.Value] {
+				return fmt.Errorf("group %q: button %q is used twice", g.Category, b.Value)
+			}
+			values[b.Value] = true
+			if len(b.Emoji) > maxEmojiLen {
+				return fmt.Errorf("group %q: emoji of %q is too long", g.Category, b.Value)
+			}
+			if b.MinIntervalMin < 0 || math.IsNaN(b.MinIntervalMin) {
+				return fmt.Errorf("group %q: minIntervalMin of %q must not be negative", g.Category, b.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// copyConfig handles POST /admin/families/{id}/config/copy?from={otherId},
+// giving the family the other's config (or the default, if it has none).
+// A family's own config is only replaced with &overwrite=true; without it
+// the answer is 409. The family's devices are sent the new config.
+func (s *Server) copyConfig(w http.ResponseWriter, r *http.Request) {
+	familyID, from := r.PathValue("id"), r.URL.Query().Get("from")
+	if from == "" || from == familyID {
+		validationError(w, map[string]string{"from": "must be another family"})
+		return
+	}
+	for _, id := range []string{familyID, from} {
+		if _, err := s.db.GetFamily(id); err != nil || !s.familyInOrg(id, adminOrg(r)) {
+			jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+			return
+		}
+	}
+	has, err := s.db.HasConfig(familyID)
+	if err != nil {
+		serverError(w, "failed to load config", err)
+		return
+	}
+	if has && r.URL.Query().Get("overwrite") != "true" {
+		jsonError(w, http.StatusConflict, errCodeConflict, "family has its own config; copy with overwrite=true to replace it")
+		return
+	}
+	config, err := s.db.GetConfig(from)
+	if err != nil {
+		serverError(w, "failed to load config", err)
+		return
+	}
+	if err := s.db.SaveConfigBy(familyID, config, "admin"); errors.Is(err, errInvalidConfig) {
+		validationError(w, map[string]string{"from": err.Error()})
+		return
+	} else if err != nil {
+		serverError(w, "failed to save config", err)
+		return
+	}
+	slog.Info("config copied", "family_id", familyID, "from", from)
+	s.publishConfig(familyID, json.RawMessage(config), nil)
+	jsonOK(w, map[string]any{"config": json.RawMessage(config)})
+}
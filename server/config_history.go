@@ -0,0 +1,165 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Config history: every saved config is kept as a revision, with who saved
+// it and when, so a bad save (say, every button deleted) can be undone by
+// restoring an earlier one. Only the latest maxConfigRevisions per family
+// are kept.
+
+const maxConfigRevisions = 50
+
+// ConfigRevision is one saved config. Data is only filled in when a single
+// revision is asked for; lists carry the counts instead.
+type ConfigRevision struct {
+	ID      int64           `json:"id"`
+	SavedAt int64           `json:"saved_at"`
+	SavedBy string          `json:"saved_by,omitempty"`
+	Groups  int             `json:"groups"`
+	Buttons int             `json:"buttons"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// countButtons counts the groups and buttons in a config.
+func (rev *ConfigRevision) countButtons(data string) {
+	var groups []struct {
+		Buttons []json.RawMessage `json:"buttons"`
+	}
+	json.Unmarshal([]byte(data), &groups)
+	rev.Groups = len(groups)
+	for _, g := range groups {
+		rev.Buttons += len(g.Buttons)
+	}
+}
+
+// addConfigRevision records a saved config and drops the family's oldest
+// revisions past maxConfigRevisions.
+func addConfigRevision(q dbtx, familyID, data, savedBy string, now int64) error {
+	if _, err := q.Exec(
+		"INSERT INTO config_revisions (family_id, data, saved_at, saved_by) VALUES (?, ?, ?, ?)",
+		familyID, data, now, savedBy,
+	); err != nil {
+		return err
+	}
+	_, err := q.Exec(
+		`DELETE FROM config_revisions WHERE family_id = ? AND id NOT IN
+		   (SELECT id FROM config_revisions WHERE family_id = ? ORDER BY id DESC LIMIT ?)`,
+		familyID, familyID, maxConfigRevisions,
+	)
+	return err
+}
+
+// ListConfigRevisions returns the family's config revisions, newest first.
+func (db *DB) ListConfigRevisions(familyID string) ([]ConfigRevision, error) {
+	rows, err := db.Query(
+		"SELECT id, saved_at, saved_by, data FROM config_revisions WHERE family_id = ? ORDER BY id DESC",
+		familyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revs := []ConfigRevision{}
+	for rows.Next() {
+		var rev ConfigRevision
+		var data string
+		if err := rows.Scan(&rev.ID, &rev.SavedAt, &rev.SavedBy, &data); err != nil {
+			return nil, err
+		}
+		rev.countButtons(data)
+		revs = append(revs, rev)
+	}
+	return revs, rows.Err()
+}
+
+// GetConfigRevision returns one of the family's revisions, with its data.
+func (db *DB) GetConfigRevision(familyID string, id int64) (*ConfigRevision, error) {
+	rev := &ConfigRevision{ID: id}
+	var data string
+	err := db.QueryRow(
+		"SELECT saved_at, saved_by, data FROM config_revisions WHERE family_id = ? AND id = ?",
+		familyID, id,
+	).Scan(&rev.SavedAt, &rev.SavedBy, &data)
+	if err != nil {
+		return nil, err
+	}
+	rev.countButtons(data)
+	rev.Data = json.RawMessage(data)
+	return rev, nil
+}
+
+// publishConfig sends a newly saved config to the family's devices, except
+// exclude if set.
+func (s *Server) publishConfig(familyID string, config json.RawMessage, exclude *Client) {
+	broadcast, _ := json.Marshal(map[string]any{
+		"type": "config",
+		"data": config,
+	})
+	s.hub.Broadcast(familyID, broadcast, exclude)
+	s.publishState(familyID) // stateful categories may have changed
+}
+
+// listConfigRevisions handles GET /admin/families/{id}/config/revisions.
+func (s *Server) listConfigRevisions(w http.ResponseWriter, r *http.Request) {
+	revs, err := s.db.ListConfigRevisions(r.PathValue("id"))
+	if err != nil {
+		serverError(w, "failed to list config revisions", err)
+		return
+	}
+	jsonOK(w, revs)
+}
+
+// configRevision loads the revision in the request path, writing an error
+// and returning nil if it can't.
+func (s *Server) configRevision(w http.ResponseWriter, r *http.Request) *ConfigRevision {
+	id, err := strconv.ParseInt(r.PathValue("rev"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "revision not found")
+		return nil
+	}
+	rev, err := s.db.GetConfigRevision(r.PathValue("id"), id)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "revision not found")
+		return nil
+	}
+	if err != nil {
+		serverError(w, "failed to load config revision", err)
+		return nil
+	}
+	return rev
+}
+
+// getConfigRevision handles GET /admin/families/{id}/config/revisions/{rev}.
+func (s *Server) getConfigRevision(w http.ResponseWriter, r *http.Request) {
+	if rev := s.configRevision(w, r); rev != nil {
+		jsonOK(w, rev)
+	}
+}
+
+// restoreConfigRevision handles
+// POST /admin/families/{id}/config/revisions/{rev}/restore. The restored
+// config is saved as a new revision and sent to the family's devices.
+func (s *Server) restoreConfigRevision(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	rev := s.configRevision(w, r)
+	if rev == nil {
+		return
+	}
+	if err := s.db.SaveConfigBy(familyID, string(rev.Data), "admin"); errors.Is(err, errInvalidConfig) {
+		validationError(w, map[string]string{"rev": err.Error()})
+		return
+	} else if err != nil {
+		serverError(w, "failed to save config", err)
+		return
+	}
+	slog.Info("config restored", "family_id", familyID, "revision", rev.ID)
+	s.publishConfig(familyID, rev.Data, nil)
+	jsonOK(w, map[string]any{"config": rev.Data})
+}
@@ -0,0 +1,91 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConfigHistory(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+
+	// A good config, then one with every button deleted
+	good := `[{"category": "feed", "buttons": [{"value": "bf"}, {"value": "bottle"}]}]`
+	conn.WriteJSON(map[string]any{"type": "config", "data": json.RawMessage(good)})
+	conn.WriteJSON(map[string]any{"type": "config", "data": json.RawMessage(`[]`)})
+	conn.WriteJSON(map[string]any{"type": "ping"})
+	skipUntilType(t, conn, "pong")
+
+	revs, err := s.db.ListConfigRevisions(family.ID)
+	if err != nil || len(revs) != 2 {
+		t.Fatalf("revisions = %+v, %v", revs, err)
+	}
+	if revs[0].Buttons != 0 || revs[1].Buttons != 2 || revs[1].Groups != 1 || revs[1].SavedBy != "Mum" || revs[1].Data != nil {
+		t.Errorf("revisions = %+v", revs)
+	}
+
+	req := httptest.NewRequest("POST", "/admin/families/"+family.ID+"/config/revisions/x/restore", nil)
+	req.SetPathValue("id", family.ID)
+	req.SetPathValue("rev", strconv.FormatInt(revs[1].ID, 10))
+	w := httptest.NewRecorder()
+	s.restoreConfigRevision(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore: %d %s", w.Code, w.Body)
+	}
+	if m := skipUntilType(t, conn, "config"); !strings.Contains(mustJSON(m["data"]), `"bottle"`) {
+		t.Errorf("broadcast = %v", m)
+	}
+	if config, _ := s.db.GetConfig(family.ID); !strings.Contains(config, `"bottle"`) {
+		t.Errorf("config = %s", config)
+	}
+	if revs, _ := s.db.ListConfigRevisions(family.ID); len(revs) != 3 || revs[0].SavedBy != "admin" {
+		t.Errorf("after restore = %+v", revs)
+	}
+
+	// Another family's revisions aren't reachable through this one
+	other, _ := s.db.CreateFamily("Other", "")
+	req.SetPathValue("id", other.ID)
+	w = httptest.NewRecorder()
+	s.getConfigRevision(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("other family: %d", w.Code)
+	}
+}
+
+func TestConfigRevisionsCapped(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+	for i := range maxConfigRevisions + 5 {
+		db.SaveConfig(family.ID, `[{"category": "c`+strconv.Itoa(i)+`", "buttons": []}]`)
+	}
+	revs, _ := db.ListConfigRevisions(family.ID)
+	if len(revs) != maxConfigRevisions {
+		t.Fatalf("kept %d", len(revs))
+	}
+	oldest, _ := db.GetConfigRevision(family.ID, revs[len(revs)-1].ID)
+	if !strings.Contains(string(oldest.Data), `"c5"`) {
+		t.Errorf("oldest kept = %s", oldest.Data)
+	}
+}
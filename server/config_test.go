@@ -0,0 +1,137 @@
+package babytrack
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestValidateConfig(t *testing.T) {
+	valid := []string{
+		`[]`,
+		`[{"category": "default", "stateful": false, "buttons": []}]`,
+		`[{"category": "sleep", "stateful": true, "buttons": [{"value": "awake", "label": "Awake", "emoji": ""}, {"value": "sleeping"}]},
+		  {"category": "med", "buttons": [{"value": "paracetamol", "minIntervalMin": 240, "color": "red"}]}]`,
+	}
+	for _, c := range valid {
+		if err := validateConfig([]byte(c)); err != nil {
+			t.Errorf("%s: %v", c, err)
+		}
+	}
+	invalid := []string{
+		`null`,
+		`{"buttons": []}`,
+		`[{"category": "feed"}]`,
+		`[{"category": "", "buttons": []}]`,
+		`[{"category": "feed", "buttons": []}, {"category": "feed", "buttons": []}]`,
+		`[{"category": "feed", "buttons": [{"value": ""}]}]`,
+		`[{"category": "feed", "buttons": [{"value": "bf"}, {"value": "bf"}]}]`,
+		`[{"category": "feed", "buttons": [{"value": 3}]}]`,
+		`[{"category": "feed", "stateful": "yes", "buttons": []}]`,
+		`[{"category": "med", "buttons": [{"value": "x", "minIntervalMin": -1}]}]`,
+		`[{"category": "feed", "buttons": [{"value": "bf", "label": "` + strings.Repeat("x", 65) + `"}]}]`,
+		`[` + strings.Repeat(`{"category": "x", "buttons": []},`, 51) + `]`,
+	}
+	for _, c := range invalid {
+		if err := validateConfig([]byte(c)); err == nil {
+			t.Errorf("accepted %.80s", c)
+		}
+	}
+}
+
+func TestInvalidConfigRejected(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	before, _ := s.db.GetConfig(family.ID)
+
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+
+	conn.WriteJSON(map[string]any{"type": "config", "data": map[string]any{"buttons": []string{}}})
+	if m := skipUntilType(t, conn, "config_rejected"); m["reason"] != "invalid" || m["message"] == "" {
+		t.Errorf("rejection = %v", m)
+	}
+	if after, _ := s.db.GetConfig(family.ID); after != before {
+		t.Errorf("config saved: %s", after)
+	}
+}
+
+func TestCopyConfig(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	first, _ := s.db.CreateFamily("First", "")
+	second, _ := s.db.CreateFamily("Second", "")
+	s.db.SaveConfig(first.ID, `[{"category": "feed", "buttons": [{"value": "bf"}]}]`)
+	link, _ := s.db.CreateAccessLink(second.ID, "Mum", nil)
+
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+
+	copyFrom := func(id, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/families/"+id+"/config/copy?"+query, nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		s.copyConfig(w, req)
+		return w
+	}
+	if w := copyFrom(second.ID, "from="+second.ID); w.Code != http.StatusBadRequest {
+		t.Errorf("from itself: %d", w.Code)
+	}
+	if w := copyFrom(second.ID, "from=nope"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown family: %d", w.Code)
+	}
+
+	// Second has no config of its own yet
+	if w := copyFrom(second.ID, "from="+first.ID); w.Code != http.StatusOK {
+		t.Fatalf("copy: %d %s", w.Code, w.Body)
+	}
+	if m := skipUntilType(t, conn, "config"); !strings.Contains(mustJSON(m["data"]), `"bf"`) {
+		t.Errorf("broadcast = %v", m)
+	}
+
+	// Now it has, so overwriting it needs confirming
+	s.db.SaveConfig(first.ID, `[]`)
+	if w := copyFrom(second.ID, "from="+first.ID); w.Code != http.StatusConflict {
+		t.Errorf("unconfirmed overwrite: %d", w.Code)
+	}
+	if w := copyFrom(second.ID, "from="+first.ID+"&overwrite=true"); w.Code != http.StatusOK {
+		t.Errorf("overwrite: %d", w.Code)
+	}
+	if config, _ := s.db.GetConfig(second.ID); config != `[]` {
+		t.Errorf("config = %s", config)
+	}
+}
+
+func TestSaveConfigValidates(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	before, _ := s.db.GetConfig(family.ID)
+	err := s.db.SaveConfig(family.ID, `[{"category": "feed", "buttons": [{"value": "new"}, {"value": "new"}]}]`)
+	if !errors.Is(err, errInvalidConfig) {
+		t.Errorf("err = %v", err)
+	}
+	if after, _ := s.db.GetConfig(family.ID); after != before {
+		t.Errorf("config saved: %s", after)
+	}
+}
@@ -0,0 +1,53 @@
+package babytrack
+
+import (
+	"time"
+)
+
+// Clients keep their sync cursor in local storage, which can be cleared,
+// restored from another device's backup, or left pointing past a server
+// restored from an older backup. So devices also acknowledge the cursor
+// they have actually applied with {"type":"sync_ack","cursor":N}, and the
+// server remembers the latest per access link. On reconnect, a hello
+// cursor is only trusted as far as the link's acked cursor, and the admin
+// panel can show how many changes behind each device is.
+
+// resumeCursor is where to resume a client that says it has everything up
+// to cursor: no further than its link last acknowledged, and from scratch
+// if the cursor is ahead of the family.
+func resumeCursor(cursor, familySeq int64, link *AccessLink) int64 {
+	if cursor > familySeq {
+		return 0
+	}
+	if link.AckedCursor != nil && cursor > *link.AckedCursor {
+		return *link.AckedCursor
+	}
+	return cursor
+}
+
+// handleSyncAck records the cursor a client says it has applied. Acks that
+// don't move the cursor are dropped before they reach the database.
+func (s *Server) handleSyncAck(c *Client, msg WSMessage) {
+	if msg.Cursor < 0 || msg.Cursor == c.ackedCursor.Load() {
+		return
+	}
+	ok, err := s.db.AckLinkCursor(c.linkID, msg.Cursor, time.Now().UnixMilli())
+	if err != nil {
+		c.log().Error("failed to record sync ack", "error", err)
+		return
+	}
+	if ok {
+		c.ackedCursor.Store(msg.Cursor)
+	}
+}
+
+// setLinkLag fills in how many changes behind the family each link's
+// devices last acknowledged being.
+func setLinkLag(links []AccessLink, familySeq int64) {
+	for i := range links {
+		if ack := links[i].AckedCursor; ack != nil {
+			behind := max(familySeq-*ack, 0)
+			links[i].Behind = &behind
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestResumeCursor(t *testing.T) {
+	acked := int64(5)
+	for _, tc := range []struct {
+		cursor, seq int64
+		acked       *int64
+		want        int64
+	}{
+		{3, 10, nil, 3},
+		{8, 10, nil, 8},
+		{8, 10, &acked, 5}, // more than the link confirmed
+		{3, 10, &acked, 3},
+		{12, 10, &acked, 0}, // ahead of the family
+	} {
+		if got := resumeCursor(tc.cursor, tc.seq, &AccessLink{AckedCursor: tc.acked}); got != tc.want {
+			t.Errorf("resumeCursor(%d, %d, %v) = %d, want %d", tc.cursor, tc.seq, tc.acked, got, tc.want)
+		}
+	}
+}
+
+func TestSyncAck(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	ts := time.Now().UnixMilli()
+	for _, id := range []string{"e1", "e2", "e3"} {
+		db.UpsertEntry(&Entry{ID: id, FamilyID: family.ID, Ts: ts, Type: "feed"})
+	}
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	dial := func(cursor int64) (*websocket.Conn, map[string]any) {
+		header := http.Header{"Cookie": {"client_session=" + link.Token}}
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?hello=1", header)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		conn.WriteJSON(map[string]any{"type": "hello", "protocol_version": 1, "cursor": cursor})
+		return conn, skipUntilType(t, conn, "init")
+	}
+
+	conn, _ := dial(0)
+	conn.WriteJSON(map[string]any{"type": "sync_ack", "cursor": 99}) // never sent
+	conn.WriteJSON(map[string]any{"type": "sync_ack", "cursor": 1})
+	conn.WriteJSON(map[string]any{"type": "ping"})
+	skipUntilType(t, conn, "pong")
+	conn.Close()
+
+	l, _ := db.ValidateAccessLink(link.Token)
+	if l.AckedCursor == nil || *l.AckedCursor != 1 || l.AckedAt == nil {
+		t.Fatalf("acked cursor = %v", l.AckedCursor)
+	}
+
+	// A device claiming more than it acked is resumed from its ack
+	conn, init := dial(3)
+	defer conn.Close()
+	if init["resumed_from"] != 1.0 || len(init["entries"].([]any)) != 2 {
+		t.Errorf("init = %v", init)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/links", nil)
+	req.SetPathValue("id", family.ID)
+	w := httptest.NewRecorder()
+	s.listAccessLinks(w, req)
+	var links []AccessLink
+	json.Unmarshal(w.Body.Bytes(), &links)
+	if len(links) != 1 || links[0].Behind == nil || *links[0].Behind != 2 {
+		t.Errorf("links = %s", w.Body)
+	}
+
+	// Another device on the link catching up overwrites the stored ack, but
+	// the connected devices still show the one behind
+	other, _ := dial(0)
+	defer other.Close()
+	other.WriteJSON(map[string]any{"type": "sync_ack", "cursor": 3})
+	other.WriteJSON(map[string]any{"type": "ping"})
+	skipUntilType(t, other, "pong")
+	req = httptest.NewRequest("GET", "/admin/families/"+family.ID+"/devices", nil)
+	req.SetPathValue("id", family.ID)
+	w = httptest.NewRecorder()
+	s.listDevices(w, req)
+	var devices []DeviceDiagnostics
+	json.Unmarshal(w.Body.Bytes(), &devices)
+	if len(devices) != 1 || devices[0].Connections != 2 || devices[0].AckedCursor != 1 || devices[0].Behind != 2 {
+		t.Errorf("devices = %s", w.Body)
+	}
+}
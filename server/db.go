@@ -1,7 +1,14 @@
-package main
+package babytrack
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -11,118 +18,71 @@ import (
 
 type DB struct {
 	*sql.DB
+	path string
+	// fileConfig is the default config from DEFAULT_CONFIG_FILE, if set
+	fileConfig string
 }
 
 func NewDB(path string) (*DB, error) {
-	db, err := sql.Open("sqlite3", path+"?_journal=WAL&_busy_timeout=5000")
+	return NewKeyedDB(path, "")
+}
+
+// NewKeyedDB opens the database encrypted with key, or unencrypted if key
+// is empty.
+func NewKeyedDB(path, key string) (*DB, error) {
+	db, err := openSQL(path, key)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
+	if _, err := applyMigrations(db, false); err != nil {
+		db.Close()
 		return nil, err
 	}
-
-	if err := migrate(db); err != nil {
+	if err := hashLinkTokens(db); err != nil {
+		return nil, err
+	}
+	if err := structureEntryValues(db); err != nil {
 		return nil, err
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db, path: path}, nil
 }
 
-func migrate(db *sql.DB) error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS schema_version (
-			version INTEGER PRIMARY KEY
-		);
-	`)
-	if err != nil {
-		return err
+// openSQL opens and checks the database at path without migrating it.
+func openSQL(path, key string) (*sql.DB, error) {
+	var db *sql.DB
+	if key == "" {
+		var err error
+		if db, err = sql.Open("sqlite3", path+"?_journal=WAL&_busy_timeout=5000"); err != nil {
+			return nil, err
+		}
+	} else {
+		db = openKeyed(path, key)
 	}
 
-	var version int
-	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
-	if err != nil {
-		return err
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
 	}
-
-	migrations := []string{
-		// v1: initial schema
-		`CREATE TABLE admins (
-			id TEXT PRIMARY KEY,
-			username TEXT UNIQUE NOT NULL,
-			password_hash TEXT NOT NULL,
-			created_at INTEGER NOT NULL
-		);
-
-		CREATE TABLE families (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			notes TEXT,
-			created_at INTEGER NOT NULL,
-			archived INTEGER DEFAULT 0
-		);
-
-		CREATE TABLE access_links (
-			token TEXT PRIMARY KEY,
-			family_id TEXT NOT NULL REFERENCES families(id),
-			label TEXT,
-			expires_at INTEGER,
-			created_at INTEGER NOT NULL
-		);
-
-		CREATE TABLE admin_sessions (
-			token TEXT PRIMARY KEY,
-			admin_id TEXT NOT NULL REFERENCES admins(id),
-			expires_at INTEGER NOT NULL
-		);
-
-		CREATE TABLE entries (
-			id TEXT PRIMARY KEY,
-			family_id TEXT NOT NULL REFERENCES families(id),
-			ts INTEGER NOT NULL,
-			type TEXT NOT NULL,
-			value TEXT NOT NULL,
-			deleted INTEGER DEFAULT 0,
-			updated_at INTEGER NOT NULL
-		);
-
-		CREATE TABLE configs (
-			family_id TEXT PRIMARY KEY REFERENCES families(id),
-			data TEXT NOT NULL,
-			updated_at INTEGER NOT NULL
-		);
-
-		CREATE INDEX idx_entries_family ON entries(family_id);
-		CREATE INDEX idx_entries_updated ON entries(family_id, updated_at);
-		CREATE INDEX idx_entries_ts ON entries(family_id, ts);`,
-
-		// v2: Add seq columns for cursor-based sync
-		`ALTER TABLE families ADD COLUMN seq INTEGER DEFAULT 0;
-		ALTER TABLE entries ADD COLUMN seq INTEGER DEFAULT 0;
-		CREATE INDEX idx_entries_seq ON entries(family_id, seq);
-		UPDATE entries SET seq = rowid;
-		UPDATE families SET seq = COALESCE((SELECT MAX(seq) FROM entries WHERE family_id = families.id), 0);`,
-	}
-
-	for i, m := range migrations {
-		v := i + 1
-		if v <= version {
-			continue
-		}
-
-		if _, err := db.Exec(m); err != nil {
-			return err
-		}
-
-		if _, err := db.Exec("INSERT INTO schema_version (version) VALUES (?)", v); err != nil {
-			return err
+	if key != "" {
+		if err := checkCipher(db); err != nil {
+			db.Close()
+			return nil, err
 		}
 	}
+	return db, nil
+}
 
-	return nil
+// Ready checks the database answers within ctx.
+func (db *DB) Ready(ctx context.Context) error {
+	var one int
+	return db.QueryRowContext(ctx, "SELECT 1 FROM schema_version LIMIT 1").Scan(&one)
 }
 
+// Path is the database file.
+func (db *DB) Path() string { return db.path }
+
 // Types
 
 type Admin struct {
@@ -139,14 +99,29 @@ type Family struct {
 	CreatedAt int64  `json:"created_at"`
 	Archived  bool   `json:"archived"`
 	Seq       int64  `json:"seq"`
+	OrgID     string `json:"org_id,omitempty"`
 }
 
 type AccessLink struct {
-	Token     string `json:"token"`
-	FamilyID  string `json:"family_id"`
-	Label     string `json:"label"`
-	ExpiresAt *int64 `json:"expires_at"`
-	CreatedAt int64  `json:"created_at"`
+	ID          string `json:"id"`              // hash of the token, as stored
+	Token       string `json:"token,omitempty"` // only when just created
+	FamilyID    string `json:"family_id"`
+	Label       string `json:"label"`
+	Role        string `json:"role"` // roleFull or roleSummary
+	ExpiresAt   *int64 `json:"expires_at"`
+	CreatedAt   int64  `json:"created_at"`
+	LastSeenAt  *int64 `json:"last_seen_at"`
+	LastEntryAt *int64 `json:"last_entry_at"`
+	RotatedAt   *int64 `json:"rotated_at,omitempty"`
+	AckedCursor *int64 `json:"acked_cursor"` // last sync cursor a device confirmed; see cursor.go
+	AckedAt     *int64 `json:"acked_at"`
+	Email       string `json:"email,omitempty"`  // verified by claiming an invite; see magic.go
+	Behind      *int64 `json:"behind,omitempty"` // changes since AckedCursor, in admin listings
+	LinkPermissions
+
+	currentHash string       // hash of the token now in force
+	superseded  bool         // validated with the previous token, in its grace period
+	sess        *linkSession // the session it was validated with, if not its token; see sessions.go
 }
 
 type Entry struct {
@@ -158,6 +133,26 @@ type Entry struct {
 	Deleted   bool   `json:"deleted"`
 	UpdatedAt int64  `json:"updated_at"`
 	Seq       int64  `json:"seq"`
+
+	// Data is an optional JSON object for kinds with structured details,
+	// e.g. PumpData for "pump" entries. Clients that don't know it pass it
+	// through untouched.
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// Duration entries have an EndedTs once stopped and are Ongoing until
+	// then. Point events have neither; stateful categories like sleep are
+	// still mostly point events paired by value (see buildTimeline).
+	EndedTs *int64 `json:"ended_ts,omitempty"`
+	Ongoing bool   `json:"ongoing,omitempty"`
+
+	// ChildID says which child of a multi-child family the entry is about.
+	// It is a free-form ID chosen by the family's devices; empty means
+	// unspecified.
+	ChildID string `json:"child_id,omitempty"`
+
+	// Author is the label of the access link that logged the entry. The
+	// server sets it from the connection; it never changes on update.
+	Author string `json:"author,omitempty"`
 }
 
 // Admin methods
@@ -184,6 +179,24 @@ func (db *DB) EnsureAdmin(username, password string) error {
 	return err
 }
 
+// SetAdminPassword replaces an existing admin's password and signs out their
+// sessions. Returns sql.ErrNoRows if there is no such admin.
+func (db *DB) SetAdminPassword(username, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	var id string
+	if err := db.QueryRow("SELECT id FROM admins WHERE username = ?", username).Scan(&id); err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE admins SET password_hash = ? WHERE id = ?", string(hash), id); err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM admin_sessions WHERE admin_id = ?", id)
+	return err
+}
+
 func (db *DB) GetAdminByUsername(username string) (*Admin, error) {
 	var a Admin
 	err := db.QueryRow(
@@ -231,7 +244,7 @@ func (db *DB) DeleteAdminSession(token string) error {
 // Family methods
 
 func (db *DB) ListFamilies(includeArchived bool) ([]Family, error) {
-	query := "SELECT id, name, notes, created_at, archived FROM families"
+	query := "SELECT id, name, notes, created_at, archived, COALESCE(org_id, '') FROM families"
 	if !includeArchived {
 		query += " WHERE archived = 0"
 	}
@@ -247,7 +260,7 @@ func (db *DB) ListFamilies(includeArchived bool) ([]Family, error) {
 	for rows.Next() {
 		var f Family
 		var notes sql.NullString
-		if err := rows.Scan(&f.ID, &f.Name, &notes, &f.CreatedAt, &f.Archived); err != nil {
+		if err := rows.Scan(&f.ID, &f.Name, &notes, &f.CreatedAt, &f.Archived, &f.OrgID); err != nil {
 			return nil, err
 		}
 		f.Notes = notes.String
@@ -257,25 +270,31 @@ func (db *DB) ListFamilies(includeArchived bool) ([]Family, error) {
 }
 
 func (db *DB) CreateFamily(name, notes string) (*Family, error) {
+	return db.CreateOrgFamily("", name, notes)
+}
+
+// CreateOrgFamily creates a family belonging to orgID, or to no org if it's
+// empty.
+func (db *DB) CreateOrgFamily(orgID, name, notes string) (*Family, error) {
 	id := generateToken(4) // 8 hex chars
 	now := time.Now().UnixMilli()
 	_, err := db.Exec(
-		"INSERT INTO families (id, name, notes, created_at, archived) VALUES (?, ?, ?, ?, 0)",
-		id, name, notes, now,
+		"INSERT INTO families (id, name, notes, created_at, archived, org_id) VALUES (?, ?, ?, ?, 0, NULLIF(?, ''))",
+		id, name, notes, now, orgID,
 	)
 	if err != nil {
 		return nil, err
 	}
-	return &Family{ID: id, Name: name, Notes: notes, CreatedAt: now, Archived: false}, nil
+	return &Family{ID: id, Name: name, Notes: notes, CreatedAt: now, Archived: false, OrgID: orgID}, nil
 }
 
 func (db *DB) GetFamily(id string) (*Family, error) {
 	var f Family
 	var notes sql.NullString
 	err := db.QueryRow(
-		"SELECT id, name, notes, created_at, archived FROM families WHERE id = ?",
+		"SELECT id, name, notes, created_at, archived, COALESCE(org_id, '') FROM families WHERE id = ?",
 		id,
-	).Scan(&f.ID, &f.Name, &notes, &f.CreatedAt, &f.Archived)
+	).Scan(&f.ID, &f.Name, &notes, &f.CreatedAt, &f.Archived, &f.OrgID)
 	if err != nil {
 		return nil, err
 	}
@@ -299,7 +318,13 @@ func (db *DB) UpdateFamily(id string, name, notes *string, archived *bool) error
 		if *archived {
 			a = 1
 		}
-		if _, err := db.Exec("UPDATE families SET archived = ? WHERE id = ?", a, id); err != nil {
+		// archived_at keeps the first archiving until the family is unarchived
+		if _, err := db.Exec(
+			`UPDATE families SET archived = ?,
+			   archived_at = CASE WHEN ? = 0 THEN NULL ELSE COALESCE(archived_at, ?) END
+			 WHERE id = ?`,
+			a, a, time.Now().UnixMilli(), id,
+		); err != nil {
 			return err
 		}
 	}
@@ -310,7 +335,7 @@ func (db *DB) UpdateFamily(id string, name, notes *string, archived *bool) error
 
 func (db *DB) ListAccessLinks(familyID string) ([]AccessLink, error) {
 	rows, err := db.Query(
-		"SELECT token, family_id, label, expires_at, created_at FROM access_links WHERE family_id = ? ORDER BY created_at DESC",
+		"SELECT "+accessLinkColumns+" FROM access_links WHERE family_id = ? ORDER BY created_at DESC",
 		familyID,
 	)
 	if err != nil {
@@ -320,65 +345,279 @@ func (db *DB) ListAccessLinks(familyID string) ([]AccessLink, error) {
 
 	var links []AccessLink
 	for rows.Next() {
-		var l AccessLink
-		var label sql.NullString
-		var expiresAt sql.NullInt64
-		if err := rows.Scan(&l.Token, &l.FamilyID, &label, &expiresAt, &l.CreatedAt); err != nil {
+		l, err := scanAccessLink(rows)
+		if err != nil {
 			return nil, err
 		}
-		l.Label = label.String
-		if expiresAt.Valid {
-			l.ExpiresAt = &expiresAt.Int64
-		}
-		links = append(links, l)
+		links = append(links, *l)
 	}
 	return links, rows.Err()
 }
 
 func (db *DB) CreateAccessLink(familyID, label string, expiresAt *int64) (*AccessLink, error) {
+	return db.CreateAccessLinkRole(familyID, label, roleFull, expiresAt)
+}
+
+// CreateAccessLinkRole creates a link with the given permission level.
+func (db *DB) CreateAccessLinkRole(familyID, label, role string, expiresAt *int64) (*AccessLink, error) {
+	return db.CreateAccessLinkWith(familyID, label, role, allPermissions, expiresAt)
+}
+
+// CreateAccessLinkWith creates a link with the given role and capabilities.
+func (db *DB) CreateAccessLinkWith(familyID, label, role string, perms LinkPermissions, expiresAt *int64) (*AccessLink, error) {
+	return insertAccessLink(db.Exec, familyID, label, role, perms, expiresAt)
+}
+
+// insertAccessLink creates a link with exec, which may be a transaction's.
+func insertAccessLink(exec func(string, ...any) (sql.Result, error), familyID, label, role string, perms LinkPermissions, expiresAt *int64) (*AccessLink, error) {
 	token := generateToken(16) // 32 hex chars
+	id := hashToken(token)
 	now := time.Now().UnixMilli()
-	_, err := db.Exec(
-		"INSERT INTO access_links (token, family_id, label, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
-		token, familyID, label, expiresAt, now,
+	_, err := exec(
+		`INSERT INTO access_links (token, family_id, label, role, expires_at, created_at, hashed, can_delete, can_edit_config, can_export)
+		 VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?, ?)`,
+		id, familyID, label, role, expiresAt, now, perms.CanDelete, perms.CanEditConfig, perms.CanExport,
 	)
 	if err != nil {
 		return nil, err
 	}
-	return &AccessLink{Token: token, FamilyID: familyID, Label: label, ExpiresAt: expiresAt, CreatedAt: now}, nil
+	return &AccessLink{ID: id, Token: token, FamilyID: familyID, Label: label, Role: role, ExpiresAt: expiresAt, CreatedAt: now, LinkPermissions: perms}, nil
+}
+
+// SetLinkPermissions replaces the link's capabilities. Returns sql.ErrNoRows
+// if there is no such link.
+func (db *DB) SetLinkPermissions(id string, perms LinkPermissions) error {
+	res, err := db.Exec(
+		"UPDATE access_links SET can_delete = ?, can_edit_config = ?, can_export = ? WHERE token = ?",
+		perms.CanDelete, perms.CanEditConfig, perms.CanExport, id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// hashToken is how an access link token is stored: only its holder has the
+// token itself, so a copy of the database can't be used to sign in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashLinkTokens hashes access link tokens stored before they were hashed.
+func hashLinkTokens(db *sql.DB) error {
+	rows, err := db.Query("SELECT token FROM access_links WHERE hashed = 0")
+	if err != nil {
+		return err
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if _, err := db.Exec("UPDATE access_links SET token = ?, hashed = 1 WHERE token = ?", hashToken(token), token); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (db *DB) ValidateAccessLink(token string) (*AccessLink, error) {
+	hash := hashToken(token)
+	l, err := scanAccessLink(db.QueryRow(
+		`SELECT `+accessLinkColumns+` FROM access_links
+		 WHERE hashed = 1 AND ((token_hash IS NULL AND token = ?) OR token_hash = ?
+		   OR (prev_token_hash = ? AND prev_expires_at > ?))`,
+		hash, hash, hash, time.Now().UnixMilli(),
+	))
+	if err == sql.ErrNoRows {
+		// Or a device's session; see sessions.go
+		sess := linkSession{id: hash}
+		var linkID string
+		err = db.QueryRow(
+			"SELECT link_id, COALESCE(device_id, ''), issued_at, expires_at FROM link_sessions WHERE id = ? AND expires_at > ?",
+			hash, time.Now().UnixMilli(),
+		).Scan(&linkID, &sess.deviceID, &sess.issuedAt, &sess.expiresAt)
+		if err == nil {
+			l, err = scanAccessLink(db.QueryRow("SELECT "+accessLinkColumns+" FROM access_links WHERE token = ?", linkID))
+		}
+		if err == nil {
+			l.sess, hash = &sess, l.currentHash
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Anything but the current token matched as the previous one
+	l.superseded = subtle.ConstantTimeCompare([]byte(l.currentHash), []byte(hash)) != 1
+	if l.ExpiresAt != nil && time.Now().UnixMilli() > *l.ExpiresAt {
+		return nil, sql.ErrNoRows // expired
+	}
+	return l, nil
+}
+
+// RotateAccessLink makes newHash the link's current token hash, if the
+// current one is still fromHash, and keeps accepting fromHash until
+// graceUntil.
+func (db *DB) RotateAccessLink(id, fromHash, newHash string, graceUntil, now int64) error {
+	_, err := db.Exec(
+		`UPDATE access_links
+		 SET prev_token_hash = COALESCE(token_hash, token), prev_expires_at = ?, token_hash = ?, rotated_at = ?
+		 WHERE token = ? AND COALESCE(token_hash, token) = ?`,
+		graceUntil, newHash, now, id, fromHash,
+	)
+	return err
+}
+
+const accessLinkColumns = "token, family_id, label, role, expires_at, created_at, last_seen_at, last_entry_at, rotated_at, COALESCE(token_hash, token), " +
+	"can_delete, can_edit_config, can_export, acked_cursor, acked_at, COALESCE(email, '')"
+
+// scanAccessLink scans a row selected with accessLinkColumns.
+func scanAccessLink(row interface{ Scan(...any) error }) (*AccessLink, error) {
 	var l AccessLink
 	var label sql.NullString
-	var expiresAt sql.NullInt64
-	err := db.QueryRow(
-		"SELECT token, family_id, label, expires_at, created_at FROM access_links WHERE token = ?",
-		token,
-	).Scan(&l.Token, &l.FamilyID, &label, &expiresAt, &l.CreatedAt)
-	if err != nil {
+	var expiresAt, lastSeen, lastEntry, rotatedAt, ackedCursor, ackedAt sql.NullInt64
+	if err := row.Scan(&l.ID, &l.FamilyID, &label, &l.Role, &expiresAt, &l.CreatedAt, &lastSeen, &lastEntry, &rotatedAt, &l.currentHash,
+		&l.CanDelete, &l.CanEditConfig, &l.CanExport, &ackedCursor, &ackedAt, &l.Email); err != nil {
 		return nil, err
 	}
 	l.Label = label.String
 	if expiresAt.Valid {
-		if time.Now().UnixMilli() > expiresAt.Int64 {
-			return nil, sql.ErrNoRows // expired
-		}
 		l.ExpiresAt = &expiresAt.Int64
 	}
+	if lastSeen.Valid {
+		l.LastSeenAt = &lastSeen.Int64
+	}
+	if lastEntry.Valid {
+		l.LastEntryAt = &lastEntry.Int64
+	}
+	if rotatedAt.Valid {
+		l.RotatedAt = &rotatedAt.Int64
+	}
+	if ackedCursor.Valid {
+		l.AckedCursor, l.AckedAt = &ackedCursor.Int64, &ackedAt.Int64
+	}
 	return &l, nil
 }
 
-func (db *DB) DeleteAccessLink(token string) error {
-	_, err := db.Exec("DELETE FROM access_links WHERE token = ?", token)
+// TouchAccessLink records that a device using this link was seen at ts.
+func (db *DB) TouchAccessLink(id string, ts int64) error {
+	_, err := db.Exec("UPDATE access_links SET last_seen_at = ? WHERE token = ?", ts, id)
+	return err
+}
+
+// RecordLinkEntry records that a device using this link wrote an entry at ts.
+func (db *DB) RecordLinkEntry(id string, ts int64) error {
+	_, err := db.Exec("UPDATE access_links SET last_seen_at = ?, last_entry_at = ? WHERE token = ?", ts, ts, id)
 	return err
 }
 
+// AckLinkCursor records that a device using this link has every change up
+// to cursor, as of ts. Cursors past the family's seq are ignored, since no
+// device can have seen them. Reports whether the ack was recorded.
+func (db *DB) AckLinkCursor(id string, cursor, ts int64) (bool, error) {
+	res, err := db.Exec(
+		`UPDATE access_links SET acked_cursor = ?, acked_at = ?
+		 WHERE token = ? AND ? <= (SELECT seq FROM families WHERE id = access_links.family_id)`,
+		cursor, ts, id, cursor,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// FamilySeq returns the family's latest change seq.
+func (db *DB) FamilySeq(familyID string) (int64, error) {
+	var seq int64
+	err := db.QueryRow("SELECT COALESCE(seq, 0) FROM families WHERE id = ?", familyID).Scan(&seq)
+	return seq, err
+}
+
+// DeleteAccessLink deletes the family's link with the given ID, or whose
+// current token is id, for callers that still have it, with its sessions
+// and devices. Returns the deleted link's ID, or sql.ErrNoRows if the
+// family has no such link.
+func (db *DB) DeleteAccessLink(familyID, id string) (string, error) {
+	var deleted string
+	hash := hashToken(id)
+	err := db.QueryRow(
+		`DELETE FROM access_links
+		 WHERE family_id = ?
+		   AND (token = ? OR (token_hash IS NULL AND token = ?) OR token_hash = ?)
+		 RETURNING token`,
+		familyID, id, hash, hash,
+	).Scan(&deleted)
+	if err != nil {
+		return "", err
+	}
+	if _, err := db.Exec("DELETE FROM link_sessions WHERE link_id = ?", deleted); err != nil {
+		return "", err
+	}
+	if _, err := db.Exec("DELETE FROM devices WHERE link_id = ?", deleted); err != nil {
+		return "", err
+	}
+	_, err = db.Exec("DELETE FROM account_links WHERE link_id = ?", deleted)
+	return deleted, err
+}
+
 // Entry methods
 
+const entryColumns = "id, family_id, ts, type, value, deleted, updated_at, seq, data, ended_ts, ongoing, child_id, author"
+
+// scanEntry scans a row selected with entryColumns.
+func scanEntry(row interface{ Scan(...any) error }) (*Entry, error) {
+	var e Entry
+	var data, childID, author sql.NullString
+	var endedTs sql.NullInt64
+	var ongoing sql.NullBool
+	if err := row.Scan(&e.ID, &e.FamilyID, &e.Ts, &e.Type, &e.Value, &e.Deleted, &e.UpdatedAt, &e.Seq, &data, &endedTs, &ongoing, &childID, &author); err != nil {
+		return nil, err
+	}
+	e.ChildID = childID.String
+	e.Author = author.String
+	if data.Valid {
+		e.Data = json.RawMessage(data.String)
+	}
+	if endedTs.Valid {
+		e.EndedTs = &endedTs.Int64
+	}
+	e.Ongoing = ongoing.Bool
+	return &e, nil
+}
+
+// entryData converts Data to a nullable column value.
+func entryData(e *Entry) any {
+	if len(e.Data) == 0 {
+		return nil
+	}
+	return string(e.Data)
+}
+
+// nullString converts an optional string to a nullable column value.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 func (db *DB) GetEntries(familyID string, sinceUpdatedAt int64) ([]Entry, error) {
 	rows, err := db.Query(
-		`SELECT id, family_id, ts, type, value, deleted, updated_at, seq 
+		`SELECT `+entryColumns+`
 		 FROM entries 
 		 WHERE family_id = ? AND updated_at > ? 
 		 ORDER BY updated_at ASC`,
@@ -391,11 +630,11 @@ func (db *DB) GetEntries(familyID string, sinceUpdatedAt int64) ([]Entry, error)
 
 	var entries []Entry
 	for rows.Next() {
-		var e Entry
-		if err := rows.Scan(&e.ID, &e.FamilyID, &e.Ts, &e.Type, &e.Value, &e.Deleted, &e.UpdatedAt, &e.Seq); err != nil {
+		e, err := scanEntry(rows)
+		if err != nil {
 			return nil, err
 		}
-		entries = append(entries, e)
+		entries = append(entries, *e)
 	}
 	return entries, rows.Err()
 }
@@ -403,17 +642,24 @@ func (db *DB) GetEntries(familyID string, sinceUpdatedAt int64) ([]Entry, error)
 // GetEntriesSinceCursor returns entries where seq > cursor, ordered by seq.
 // Returns up to limit entries plus a has_more flag for pagination.
 func (db *DB) GetEntriesSinceCursor(familyID string, cursor int64, limit int) ([]Entry, bool, error) {
+	return db.GetChildEntriesSinceCursor(familyID, "", cursor, limit)
+}
+
+// GetChildEntriesSinceCursor is GetEntriesSinceCursor limited to one child's
+// entries, or all entries if childID is empty. The cursor is still the
+// family seq, so a device keeps one cursor per child it follows.
+func (db *DB) GetChildEntriesSinceCursor(familyID, childID string, cursor int64, limit int) ([]Entry, bool, error) {
 	if limit <= 0 {
 		limit = 500 // default batch size
 	}
 	// Fetch one extra to detect has_more
 	rows, err := db.Query(
-		`SELECT id, family_id, ts, type, value, deleted, updated_at, seq 
+		`SELECT `+entryColumns+`
 		 FROM entries 
-		 WHERE family_id = ? AND seq > ? 
+		 WHERE family_id = ? AND seq > ? AND (? = '' OR child_id = ?)
 		 ORDER BY seq ASC
 		 LIMIT ?`,
-		familyID, cursor, limit+1,
+		familyID, cursor, childID, childID, limit+1,
 	)
 	if err != nil {
 		return nil, false, err
@@ -422,11 +668,11 @@ func (db *DB) GetEntriesSinceCursor(familyID string, cursor int64, limit int) ([
 
 	var entries []Entry
 	for rows.Next() {
-		var e Entry
-		if err := rows.Scan(&e.ID, &e.FamilyID, &e.Ts, &e.Type, &e.Value, &e.Deleted, &e.UpdatedAt, &e.Seq); err != nil {
+		e, err := scanEntry(rows)
+		if err != nil {
 			return nil, false, err
 		}
-		entries = append(entries, e)
+		entries = append(entries, *e)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, false, err
@@ -439,12 +685,67 @@ func (db *DB) GetEntriesSinceCursor(familyID string, cursor int64, limit int) ([
 	return entries, hasMore, nil
 }
 
+// GetDeletedSinceCursor is GetChildEntriesSinceCursor for deleted entries
+// only, returning their IDs and the seq of the last one. lastSeq is cursor
+// if there are none.
+func (db *DB) GetDeletedSinceCursor(familyID, childID string, cursor int64, limit int) (ids []string, lastSeq int64, hasMore bool, err error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	rows, err := db.Query(
+		`SELECT id, seq
+		 FROM entries
+		 WHERE family_id = ? AND seq > ? AND deleted = 1 AND (? = '' OR child_id = ?)
+		 ORDER BY seq ASC
+		 LIMIT ?`,
+		familyID, cursor, childID, childID, limit+1,
+	)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	defer rows.Close()
+
+	ids, lastSeq = []string{}, cursor
+	for rows.Next() {
+		if len(ids) == limit {
+			hasMore = true
+			break
+		}
+		var id string
+		if err := rows.Scan(&id, &lastSeq); err != nil {
+			return nil, 0, false, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, lastSeq, hasMore, rows.Err()
+}
+
 func (db *DB) UpsertEntry(e *Entry) error {
+	return upsertEntry(db.DB, e)
+}
+
+// UpsertEntries upserts entries of one family in a single transaction, as
+// UpsertEntry would one at a time: either all are saved or none are.
+func (db *DB) UpsertEntries(entries []Entry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for i := range entries {
+		if err := upsertEntry(tx, &entries[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func upsertEntry(q dbtx, e *Entry) error {
 	e.UpdatedAt = time.Now().UnixMilli()
 
 	// Increment family seq and get the new value
 	var newSeq int64
-	err := db.QueryRow(
+	err := q.QueryRow(
 		`UPDATE families SET seq = seq + 1 WHERE id = ? RETURNING seq`,
 		e.FamilyID,
 	).Scan(&newSeq)
@@ -453,19 +754,79 @@ func (db *DB) UpsertEntry(e *Entry) error {
 	}
 	e.Seq = newSeq
 
-	_, err = db.Exec(
-		`INSERT INTO entries (id, family_id, ts, type, value, deleted, updated_at, seq)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	// An edit may move the entry to another day
+	var oldTs sql.NullInt64
+	if err := q.QueryRow("SELECT ts FROM entries WHERE id = ?", e.ID).Scan(&oldTs); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	// The stored child and author may differ from e's; hand them back so
+	// broadcasts of e are accurate.
+	var childID, author sql.NullString
+	err = q.QueryRow(
+		`INSERT INTO entries (id, family_id, ts, type, value, deleted, updated_at, seq, data, ended_ts, ongoing, child_id, author)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT(id) DO UPDATE SET
 		   ts = excluded.ts,
 		   type = excluded.type,
 		   value = excluded.value,
 		   deleted = excluded.deleted,
 		   updated_at = excluded.updated_at,
-		   seq = excluded.seq`,
-		e.ID, e.FamilyID, e.Ts, e.Type, e.Value, e.Deleted, e.UpdatedAt, e.Seq,
-	)
-	return err
+		   seq = excluded.seq,
+		   data = excluded.data,
+		   ended_ts = excluded.ended_ts,
+		   ongoing = excluded.ongoing,
+		   child_id = COALESCE(excluded.child_id, entries.child_id), -- older clients don't send it
+		   author = COALESCE(entries.author, excluded.author)
+		 RETURNING child_id, author`,
+		e.ID, e.FamilyID, e.Ts, e.Type, e.Value, e.Deleted, e.UpdatedAt, e.Seq, entryData(e), e.EndedTs, e.Ongoing, nullString(e.ChildID), nullString(e.Author),
+	).Scan(&childID, &author)
+	e.ChildID, e.Author = childID.String, author.String
+	if err != nil {
+		return err
+	}
+	if oldTs.Valid {
+		return touchRollups(q, e.FamilyID, e.Ts, oldTs.Int64)
+	}
+	return touchRollups(q, e.FamilyID, e.Ts)
+}
+
+// ImportEntries inserts entries in one transaction, leaving any with an
+// existing ID untouched. Returns the number actually inserted.
+func (db *DB) ImportEntries(familyID string, entries []Entry) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var seq int64
+	if err := tx.QueryRow("SELECT seq FROM families WHERE id = ?", familyID).Scan(&seq); err != nil {
+		return 0, err
+	}
+	now := time.Now().UnixMilli()
+	inserted := 0
+	for _, e := range entries {
+		res, err := tx.Exec(
+			`INSERT OR IGNORE INTO entries (id, family_id, ts, type, value, deleted, updated_at, seq, data)
+			 VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+			e.ID, familyID, e.Ts, e.Type, e.Value, now, seq+1, entryData(&e),
+		)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			seq++
+			inserted++
+		}
+	}
+	if _, err := tx.Exec("UPDATE families SET seq = ? WHERE id = ?", seq, familyID); err != nil {
+		return 0, err
+	}
+	if err := invalidateRollups(tx, familyID); err != nil {
+		return 0, err
+	}
+	return inserted, tx.Commit()
 }
 
 func (db *DB) DeleteEntry(familyID, id string) (int64, error) {
@@ -481,42 +842,78 @@ func (db *DB) DeleteEntry(familyID, id string) (int64, error) {
 		return 0, err
 	}
 
-	_, err = db.Exec(
-		"UPDATE entries SET deleted = 1, updated_at = ?, seq = ? WHERE id = ? AND family_id = ?",
+	var ts int64
+	err = db.QueryRow(
+		"UPDATE entries SET deleted = 1, updated_at = ?, seq = ? WHERE id = ? AND family_id = ? RETURNING ts",
 		now, newSeq, id, familyID,
-	)
-	return newSeq, err
+	).Scan(&ts)
+	if err == sql.ErrNoRows {
+		return newSeq, nil
+	}
+	if err != nil {
+		return newSeq, err
+	}
+	return newSeq, touchRollups(db, familyID, ts)
 }
 
 // Config methods
 
+// GetConfig returns the family's button config, or the server's default
+// if it hasn't saved one.
 func (db *DB) GetConfig(familyID string) (string, error) {
 	var data string
 	err := db.QueryRow("SELECT data FROM configs WHERE family_id = ?", familyID).Scan(&data)
 	if err == sql.ErrNoRows {
-		// Return default config structure if no config exists
-		return `[{"category": "default", "stateful": false, "buttons": []}]`, nil
+		data, _, err = db.DefaultConfig()
 	}
 	return data, err
 }
 
+// HasConfig reports whether the family has saved a config of its own.
+func (db *DB) HasConfig(familyID string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM configs WHERE family_id = ?", familyID).Scan(&n)
+	return n > 0, err
+}
+
 func (db *DB) SaveConfig(familyID, data string) error {
+	return db.SaveConfigBy(familyID, data, "")
+}
+
+// SaveConfigBy saves the family's config and records it as a revision
+// saved by savedBy (a link label, or "admin"). A config validateConfig
+// refuses isn't saved, and the error wraps errInvalidConfig.
+func (db *DB) SaveConfigBy(familyID, data, savedBy string) error {
+	if err := validateConfig([]byte(data)); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidConfig, err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	now := time.Now().UnixMilli()
-	_, err := db.Exec(
+	if _, err := tx.Exec(
 		`INSERT INTO configs (family_id, data, updated_at)
 		 VALUES (?, ?, ?)
 		 ON CONFLICT(family_id) DO UPDATE SET
 		   data = excluded.data,
 		   updated_at = excluded.updated_at`,
 		familyID, data, now,
-	)
-	return err
+	); err != nil {
+		return err
+	}
+	if err := addConfigRevision(tx, familyID, data, savedBy, now); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetEntriesForDate returns all non-deleted entries for a family within a date range
 func (db *DB) GetEntriesForDate(familyID string, startMs, endMs int64) ([]Entry, error) {
 	rows, err := db.Query(
-		`SELECT id, family_id, ts, type, value, deleted, updated_at, seq 
+		`SELECT `+entryColumns+`
 		 FROM entries 
 		 WHERE family_id = ? AND ts >= ? AND ts < ? AND deleted = 0
 		 ORDER BY ts ASC`,
@@ -529,29 +926,173 @@ func (db *DB) GetEntriesForDate(familyID string, startMs, endMs int64) ([]Entry,
 
 	var entries []Entry
 	for rows.Next() {
-		var e Entry
-		if err := rows.Scan(&e.ID, &e.FamilyID, &e.Ts, &e.Type, &e.Value, &e.Deleted, &e.UpdatedAt, &e.Seq); err != nil {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+// GetEntry returns one of a family's entries, including deleted ones.
+func (db *DB) GetEntry(familyID, id string) (*Entry, error) {
+	return scanEntry(db.QueryRow(
+		`SELECT `+entryColumns+` FROM entries WHERE id = ? AND family_id = ?`, id, familyID,
+	))
+}
+
+// EntryExists reports whether the family has an entry with this ID,
+// including deleted ones.
+func (db *DB) EntryExists(familyID, id string) bool {
+	var one int
+	return db.QueryRow("SELECT 1 FROM entries WHERE id = ? AND family_id = ?", id, familyID).Scan(&one) == nil
+}
+
+// GetEntriesOfType returns live entries of one type with startMs <= ts < endMs.
+func (db *DB) GetEntriesOfType(familyID, typ string, startMs, endMs int64) ([]Entry, error) {
+	rows, err := db.Query(
+		`SELECT `+entryColumns+`
+		 FROM entries
+		 WHERE family_id = ? AND type = ? AND ts >= ? AND ts < ? AND deleted = 0
+		 ORDER BY ts ASC`,
+		familyID, typ, startMs, endMs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
 			return nil, err
 		}
-		entries = append(entries, e)
+		entries = append(entries, *e)
 	}
 	return entries, rows.Err()
 }
 
 // GetLastSleepEventBefore returns the most recent sleep event before a timestamp
 func (db *DB) GetLastSleepEventBefore(familyID string, beforeMs int64) (*Entry, error) {
-	var e Entry
-	err := db.QueryRow(
-		`SELECT id, family_id, ts, type, value, deleted, updated_at, seq 
-		 FROM entries 
-		 WHERE family_id = ? AND ts < ? AND type = 'sleep' AND deleted = 0
+	return db.GetLastEntryBefore(familyID, "sleep", beforeMs)
+}
+
+// GetLastEntryBefore returns the most recent live entry of a type before a
+// timestamp.
+func (db *DB) GetLastEntryBefore(familyID, typ string, beforeMs int64) (*Entry, error) {
+	return db.GetLastChildEntryBefore(familyID, "", typ, beforeMs)
+}
+
+// GetLastChildEntryBefore is GetLastEntryBefore for one child, or any child
+// if childID is empty.
+func (db *DB) GetLastChildEntryBefore(familyID, childID, typ string, beforeMs int64) (*Entry, error) {
+	return scanEntry(db.QueryRow(
+		`SELECT `+entryColumns+`
+		 FROM entries
+		 WHERE family_id = ? AND ts < ? AND type = ? AND deleted = 0 AND (? = '' OR child_id = ?)
+		 ORDER BY ts DESC LIMIT 1`,
+		familyID, beforeMs, typ, childID, childID,
+	))
+}
+
+// GetDurationEntriesSpanning returns live duration entries that started
+// before ms and were still running at ms.
+func (db *DB) GetDurationEntriesSpanning(familyID string, ms int64) ([]Entry, error) {
+	rows, err := db.Query(
+		`SELECT `+entryColumns+`
+		 FROM entries
+		 WHERE family_id = ? AND ts < ? AND deleted = 0 AND (ongoing = 1 OR ended_ts > ?)
+		 ORDER BY ts ASC`,
+		familyID, ms, ms,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+// GetOngoingEntries returns a family's started but unstopped duration
+// entries, oldest first.
+func (db *DB) GetOngoingEntries(familyID string) ([]Entry, error) {
+	rows, err := db.Query(
+		`SELECT `+entryColumns+`
+		 FROM entries
+		 WHERE family_id = ? AND ongoing = 1 AND deleted = 0
+		 ORDER BY ts ASC`,
+		familyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+// GetFirstEntryFrom returns the earliest live entry of a type at or after a
+// timestamp.
+func (db *DB) GetFirstEntryFrom(familyID, typ string, fromMs int64) (*Entry, error) {
+	return scanEntry(db.QueryRow(
+		`SELECT `+entryColumns+`
+		 FROM entries
+		 WHERE family_id = ? AND ts >= ? AND type = ? AND deleted = 0
+		 ORDER BY ts ASC LIMIT 1`,
+		familyID, fromMs, typ,
+	))
+}
+
+// GetLastEntry returns the most recent live entry of a type, optionally
+// restricted to one value ("" matches any).
+func (db *DB) GetLastEntry(familyID, typ, value string) (*Entry, error) {
+	return scanEntry(db.QueryRow(
+		`SELECT `+entryColumns+`
+		 FROM entries
+		 WHERE family_id = ? AND type = ? AND (? = '' OR value = ?) AND deleted = 0
 		 ORDER BY ts DESC LIMIT 1`,
-		familyID, beforeMs,
-	).Scan(&e.ID, &e.FamilyID, &e.Ts, &e.Type, &e.Value, &e.Deleted, &e.UpdatedAt, &e.Seq)
+		familyID, typ, value, value,
+	))
+}
+
+// GetEntryTypes returns the distinct types of a family's live entries.
+func (db *DB) GetEntryTypes(familyID string) ([]string, error) {
+	rows, err := db.Query(
+		"SELECT DISTINCT type FROM entries WHERE family_id = ? AND deleted = 0 ORDER BY type",
+		familyID,
+	)
 	if err != nil {
 		return nil, err
 	}
-	return &e, nil
+	defer rows.Close()
+
+	var types []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
 }
 
 // GetLatestActivity returns the most recent entry timestamp for a family
@@ -590,3 +1131,82 @@ func (db *DB) GetLinkCount(familyID string) (int, error) {
 	).Scan(&count)
 	return count, err
 }
+
+// Client log methods
+
+// maxClientLogsPerFamily caps the client_logs table; older rows are trimmed on insert.
+const maxClientLogsPerFamily = 2000
+
+type ClientLog struct {
+	ID      int64  `json:"id"`
+	Label   string `json:"label"`
+	Ts      int64  `json:"ts"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"`
+	URL     string `json:"url"`
+}
+
+// InsertClientLogs stores frontend log lines for a family and trims the
+// family's history to maxClientLogsPerFamily rows.
+func (db *DB) InsertClientLogs(familyID, label string, logs []ClientLog) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, l := range logs {
+		_, err := tx.Exec(
+			"INSERT INTO client_logs (family_id, label, ts, level, message, data, url) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			familyID, label, l.Ts, l.Level, l.Message, l.Data, l.URL,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`DELETE FROM client_logs WHERE family_id = ? AND id <= (
+			SELECT id FROM client_logs WHERE family_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?
+		)`,
+		familyID, familyID, maxClientLogsPerFamily,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListClientLogs returns a family's stored frontend logs within [startMs, endMs),
+// newest first, restricted to the given levels (all levels if empty).
+func (db *DB) ListClientLogs(familyID string, levels []string, startMs, endMs int64, limit int) ([]ClientLog, error) {
+	query := "SELECT id, label, ts, level, message, data, url FROM client_logs WHERE family_id = ? AND ts >= ? AND ts < ?"
+	args := []any{familyID, startMs, endMs}
+	if len(levels) > 0 {
+		query += " AND level IN (?" + strings.Repeat(", ?", len(levels)-1) + ")"
+		for _, l := range levels {
+			args = append(args, l)
+		}
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []ClientLog{}
+	for rows.Next() {
+		var l ClientLog
+		var label, data, url sql.NullString
+		if err := rows.Scan(&l.ID, &label, &l.Ts, &l.Level, &l.Message, &data, &url); err != nil {
+			return nil, err
+		}
+		l.Label, l.Data, l.URL = label.String, data.String, url.String
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
@@ -0,0 +1,200 @@
+package babytrack
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Database checks for after a crash, a restore or hand-editing: SQLite's own
+// integrity and foreign key checks, and the seq invariants cursor sync relies
+// on. Within a family, every entry needs its own positive seq, and the
+// family's seq must be at least the highest, or new writes reuse seqs that
+// devices have already synced past. Seq problems can be repaired by giving
+// the affected entries fresh seqs, which devices pick up on their next sync;
+// anything else is only reported, since the fix is a restore.
+
+const maxIntegrityMessages = 100
+
+// ForeignKeyViolation is a row of PRAGMA foreign_key_check.
+type ForeignKeyViolation struct {
+	Table  string `json:"table"`
+	RowID  *int64 `json:"rowid"`
+	Parent string `json:"parent"`
+}
+
+// SeqProblem describes one family's broken seq invariants.
+type SeqProblem struct {
+	FamilyID    string `json:"family_id"`
+	FamilySeq   int64  `json:"family_seq"`
+	MaxEntrySeq int64  `json:"max_entry_seq"`
+	Duplicates  int    `json:"duplicates"`  // entries sharing a seq with an earlier one
+	Unsequenced int    `json:"unsequenced"` // entries with no seq
+	Repaired    bool   `json:"repaired"`
+}
+
+// DBCheck is the result of CheckDB.
+type DBCheck struct {
+	OK          bool                  `json:"ok"`
+	Integrity   []string              `json:"integrity"` // ["ok"] when fine
+	ForeignKeys []ForeignKeyViolation `json:"foreign_keys"`
+	Seq         []SeqProblem          `json:"seq"`
+}
+
+// CheckDB runs the checks, repairing seq problems if repair is set.
+func (db *DB) CheckDB(repair bool) (*DBCheck, error) {
+	c := &DBCheck{Integrity: []string{}, ForeignKeys: []ForeignKeyViolation{}, Seq: []SeqProblem{}}
+
+	rows, err := db.Query("PRAGMA integrity_check(" + strconv.Itoa(maxIntegrityMessages) + ")")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.Integrity = append(c.Integrity, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var v ForeignKeyViolation
+		var rowID sql.NullInt64
+		var fkid int
+		if err := rows.Scan(&v.Table, &rowID, &v.Parent, &fkid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if rowID.Valid {
+			v.RowID = &rowID.Int64
+		}
+		c.ForeignKeys = append(c.ForeignKeys, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(
+		`SELECT f.id, COALESCE(f.seq, 0), COALESCE(MAX(e.seq), 0),
+			COUNT(CASE WHEN e.seq > 0 THEN 1 END) - COUNT(DISTINCT CASE WHEN e.seq > 0 THEN e.seq END),
+			COUNT(CASE WHEN e.id IS NOT NULL AND COALESCE(e.seq, 0) <= 0 THEN 1 END)
+		 FROM families f LEFT JOIN entries e ON e.family_id = f.id
+		 GROUP BY f.id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var p SeqProblem
+		if err := rows.Scan(&p.FamilyID, &p.FamilySeq, &p.MaxEntrySeq, &p.Duplicates, &p.Unsequenced); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if p.FamilySeq < p.MaxEntrySeq || p.Duplicates > 0 || p.Unsequenced > 0 {
+			c.Seq = append(c.Seq, p)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if repair {
+		for i := range c.Seq {
+			if err := db.repairSeq(c.Seq[i].FamilyID); err != nil {
+				return nil, err
+			}
+			c.Seq[i].Repaired = true
+		}
+	}
+
+	c.OK = len(c.Integrity) == 1 && c.Integrity[0] == "ok" && len(c.ForeignKeys) == 0 && len(c.Seq) == 0
+	return c, nil
+}
+
+// repairSeq moves the family's seq up to its entries' and gives entries
+// without a seq of their own new ones past it.
+func (db *DB) repairSeq(familyID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var seq int64
+	if err := tx.QueryRow(
+		`SELECT MAX(COALESCE(f.seq, 0), COALESCE((SELECT MAX(seq) FROM entries WHERE family_id = f.id), 0))
+		 FROM families f WHERE f.id = ?`,
+		familyID,
+	).Scan(&seq); err != nil {
+		return err
+	}
+
+	// Of entries sharing a seq, the first written keeps it
+	rows, err := tx.Query(
+		`SELECT id FROM entries e WHERE family_id = ? AND (
+			COALESCE(seq, 0) <= 0 OR EXISTS (
+				SELECT 1 FROM entries d WHERE d.family_id = e.family_id AND d.seq = e.seq AND d.rowid < e.rowid))
+		 ORDER BY rowid`,
+		familyID,
+	)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		seq++
+		if _, err := tx.Exec("UPDATE entries SET seq = ? WHERE id = ?", seq, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE families SET seq = ? WHERE id = ?", seq, familyID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// adminCheckDB handles POST /admin/db/check; with ?repair=true it also repairs
+// seq problems.
+func (s *Server) adminCheckDB(w http.ResponseWriter, r *http.Request) {
+	repair := r.URL.Query().Get("repair") == "true"
+	c, err := s.db.CheckDB(repair)
+	if err != nil {
+		serverError(w, "database check failed", err)
+		return
+	}
+	if !c.OK {
+		slog.Warn("database check found problems",
+			"integrity", c.Integrity, "foreign_keys", len(c.ForeignKeys), "seq", len(c.Seq), "repair", repair)
+	}
+	if repair {
+		for _, p := range c.Seq {
+			s.summaries.invalidate(p.FamilyID)
+		}
+	}
+	jsonOK(w, c)
+}
@@ -0,0 +1,69 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckDB(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+	healthy, _ := s.db.CreateFamily("Healthy", "")
+	for _, id := range []string{"a", "b", "c", "d"} {
+		s.db.UpsertEntry(&Entry{ID: id, FamilyID: family.ID, Ts: 1000, Type: "feed", Value: "bf"})
+	}
+	s.db.UpsertEntry(&Entry{ID: "h", FamilyID: healthy.ID, Ts: 1000, Type: "feed", Value: "bf"})
+
+	check := func(query string) *DBCheck {
+		req := httptest.NewRequest("POST", "/admin/db/check"+query, nil)
+		w := httptest.NewRecorder()
+		s.adminCheckDB(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("check: %d %s", w.Code, w.Body)
+		}
+		var c DBCheck
+		json.Unmarshal(w.Body.Bytes(), &c)
+		return &c
+	}
+	if c := check(""); !c.OK || len(c.Integrity) != 1 || c.Integrity[0] != "ok" {
+		t.Fatalf("clean db = %+v", c)
+	}
+
+	// A restore that lost the family's seq, a duplicated seq and an entry
+	// written without one
+	s.db.(*DB).Exec("UPDATE families SET seq = 1 WHERE id = ?", family.ID)
+	s.db.(*DB).Exec("UPDATE entries SET seq = 2 WHERE id = 'c'")
+	s.db.(*DB).Exec("UPDATE entries SET seq = 0 WHERE id = 'd'")
+
+	c := check("")
+	if c.OK || len(c.Seq) != 1 {
+		t.Fatalf("broken db = %+v", c)
+	}
+	if p := c.Seq[0]; p.FamilyID != family.ID || p.FamilySeq != 1 || p.MaxEntrySeq != 2 || p.Duplicates != 1 || p.Unsequenced != 1 || p.Repaired {
+		t.Errorf("problem = %+v", p)
+	}
+	if seq, _ := s.db.FamilySeq(family.ID); seq != 1 {
+		t.Error("check without repair changed the family")
+	}
+
+	if c := check("?repair=true"); !c.Seq[0].Repaired {
+		t.Errorf("repair = %+v", c)
+	}
+	if c := check(""); !c.OK {
+		t.Errorf("after repair = %+v", c)
+	}
+	entries, _, _ := s.db.GetEntriesSinceCursor(family.ID, 0, 100)
+	seqs := map[int64]bool{}
+	for _, e := range entries {
+		seqs[e.Seq] = true
+	}
+	if len(entries) != 4 || len(seqs) != 4 {
+		t.Errorf("entries after repair = %+v", entries)
+	}
+	if seq, _ := s.db.FamilySeq(family.ID); seq != 4 {
+		t.Errorf("family seq = %d", seq)
+	}
+}
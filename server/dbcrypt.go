@@ -0,0 +1,97 @@
+package babytrack
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// DB_KEY encrypts the database at rest with SQLCipher. That needs a binary
+// linked against libsqlcipher instead of the bundled SQLite (see the
+// Dockerfile's SQLCIPHER build arg). A plain build refuses a key rather
+// than quietly writing plaintext.
+
+var errNoSQLCipher = errors.New("DB_KEY is set but this build has no SQLCipher support")
+
+// sqlQuote quotes s as an SQL string literal, for PRAGMAs that can't take
+// bound parameters.
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// keyedConnector opens connections with a driver whose ConnectHook sets
+// the key, which SQLCipher needs before anything else touches the file.
+type keyedConnector struct {
+	driver *sqlite3.SQLiteDriver
+	dsn    string
+}
+
+func (c keyedConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c keyedConnector) Driver() driver.Driver                        { return c.driver }
+
+// openKeyed opens an encrypted database. Journal mode is set in the hook
+// rather than the DSN because the driver applies DSN pragmas first.
+func openKeyed(path, key string) *sql.DB {
+	d := &sqlite3.SQLiteDriver{ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+		if _, err := conn.Exec("PRAGMA key = "+sqlQuote(key), nil); err != nil {
+			return err
+		}
+		_, err := conn.Exec("PRAGMA journal_mode = WAL", nil)
+		return err
+	}}
+	return sql.OpenDB(keyedConnector{driver: d, dsn: path + "?_busy_timeout=5000"})
+}
+
+// checkCipher returns errNoSQLCipher unless db is running on SQLCipher.
+// Plain SQLite ignores unknown pragmas, so PRAGMA key alone proves nothing.
+func checkCipher(db *sql.DB) error {
+	var version string
+	err := db.QueryRow("PRAGMA cipher_version").Scan(&version)
+	if err == sql.ErrNoRows || (err == nil && version == "") {
+		return errNoSQLCipher
+	}
+	return err
+}
+
+// Rekey re-encrypts the database with newKey, or decrypts it if newKey is
+// empty, and closes db. It exports into a new file and swaps it in, so it
+// also encrypts a plaintext database; run it with the server stopped.
+func (db *DB) Rekey(newKey string) error {
+	if err := checkCipher(db.DB); err != nil {
+		return err
+	}
+	tmp := db.path + ".rekey"
+	os.Remove(tmp)
+
+	// ATTACH is per connection, so keep to one
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "ATTACH DATABASE ? AS rekeyed KEY ?", tmp, newKey)
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "SELECT sqlcipher_export('rekeyed')")
+		if _, derr := conn.ExecContext(ctx, "DETACH DATABASE rekeyed"); err == nil {
+			err = derr
+		}
+	}
+	conn.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(db.path + suffix)
+	}
+	return os.Rename(tmp, db.path)
+}
@@ -0,0 +1,45 @@
+package babytrack
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSQLQuote(t *testing.T) {
+	if got := sqlQuote("it's"); got != "'it''s'" {
+		t.Errorf("sqlQuote = %s", got)
+	}
+}
+
+// The test binary uses the bundled SQLite, so a key must be refused rather
+// than ignored.
+func TestKeyedDBWithoutSQLCipher(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	if db, err := NewKeyedDB(path, "secret"); !errors.Is(err, errNoSQLCipher) {
+		if db != nil {
+			db.Close()
+		}
+		t.Fatalf("NewKeyedDB = %v, want errNoSQLCipher", err)
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Rekey("new"); !errors.Is(err, errNoSQLCipher) {
+		t.Errorf("Rekey = %v, want errNoSQLCipher", err)
+	}
+	if _, err := db.GetFamily("x"); err == nil {
+		t.Error("expected no rows from the still-open database")
+	} else if !strings.Contains(err.Error(), "no rows") {
+		t.Errorf("database unusable after refused rekey: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runCLI([]string{"db", "rekey"}, path, "", "", strings.NewReader("new\n"), &out); !errors.Is(err, errNoSQLCipher) {
+		t.Errorf("db rekey = %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Families that haven't saved a button config get the server's default.
+// The admin can set one, kept in server_settings; failing that, the one in
+// DEFAULT_CONFIG_FILE is used, and failing that, a single empty group.
+
+const builtinConfig = `[{"category": "default", "stateful": false, "buttons": []}]`
+
+// DefaultConfig returns the config for families without one, and where it
+// came from: "admin", "file" or "builtin".
+func (db *DB) DefaultConfig() (config, source string, err error) {
+	err = db.QueryRow("SELECT value FROM server_settings WHERE name = 'default_config'").Scan(&config)
+	switch {
+	case err == nil:
+		return config, "admin", nil
+	case err != sql.ErrNoRows:
+		return "", "", err
+	case db.fileConfig != "":
+		return db.fileConfig, "file", nil
+	}
+	return builtinConfig, "builtin", nil
+}
+
+// SetDefaultConfig sets the admin's default config, or clears it if config
+// is empty.
+func (db *DB) SetDefaultConfig(config string) error {
+	if config == "" {
+		_, err := db.Exec("DELETE FROM server_settings WHERE name = 'default_config'")
+		return err
+	}
+	_, err := db.Exec(
+		`INSERT INTO server_settings (name, value, updated_at) VALUES ('default_config', ?, ?)
+		 ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		config, time.Now().UnixMilli(),
+	)
+	return err
+}
+
+// LoadConfigFile sets the file default config from path.
+func (db *DB) LoadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := validateConfig(data); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	db.fileConfig = string(data)
+	return nil
+}
+
+// getDefaultConfig handles GET /admin/config/default.
+func (s *Server) getDefaultConfig(w http.ResponseWriter, r *http.Request) {
+	config, source, err := s.db.DefaultConfig()
+	if err != nil {
+		serverError(w, "failed to load default config", err)
+		return
+	}
+	jsonOK(w, map[string]any{"config": json.RawMessage(config), "source": source})
+}
+
+// setDefaultConfig handles PUT /admin/config/default; the body is the
+// config.
+func (s *Server) setDefaultConfig(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigBytes+1))
+	if err != nil {
+		validationError(w, map[string]string{"config": fmt.Sprintf("must be at most %d KB", maxConfigBytes>>10)})
+		return
+	}
+	if err := validateConfig(data); err != nil {
+		validationError(w, map[string]string{"config": err.Error()})
+		return
+	}
+	if err := s.db.SetDefaultConfig(string(data)); err != nil {
+		serverError(w, "failed to save default config", err)
+		return
+	}
+	s.getDefaultConfig(w, r)
+}
+
+// clearDefaultConfig handles DELETE /admin/config/default, going back to
+// the file or built-in default.
+func (s *Server) clearDefaultConfig(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.SetDefaultConfig(""); err != nil {
+		serverError(w, "failed to clear default config", err)
+		return
+	}
+	s.getDefaultConfig(w, r)
+}
@@ -0,0 +1,72 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	get := func() (string, string) {
+		w := httptest.NewRecorder()
+		s.getDefaultConfig(w, httptest.NewRequest("GET", "/admin/config/default", nil))
+		var resp struct {
+			Config json.RawMessage `json:"config"`
+			Source string          `json:"source"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return string(resp.Config), resp.Source
+	}
+
+	if config, source := get(); source != "builtin" || !strings.Contains(config, `"default"`) {
+		t.Errorf("builtin: %s %s", source, config)
+	}
+
+	path := t.TempDir() + "/buttons.json"
+	os.WriteFile(path, []byte(`[{"category": "feed", "buttons": [{"value": "bf"}]}]`), 0o644)
+	if err := s.db.(*DB).LoadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, source := get(); source != "file" {
+		t.Errorf("source = %s", source)
+	}
+	if config, _ := s.db.GetConfig(family.ID); !strings.Contains(config, `"bf"`) {
+		t.Errorf("family config = %s", config)
+	}
+	os.WriteFile(path, []byte(`{"buttons": []}`), 0o644)
+	if err := s.db.(*DB).LoadConfigFile(path); err == nil {
+		t.Error("loaded an invalid file")
+	}
+
+	w := httptest.NewRecorder()
+	s.setDefaultConfig(w, httptest.NewRequest("PUT", "/admin/config/default", strings.NewReader(`[{"category": "sleep", "buttons": []}, {"category": "sleep", "buttons": []}]`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid: %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.setDefaultConfig(w, httptest.NewRequest("PUT", "/admin/config/default", strings.NewReader(`[{"category": "sleep", "stateful": true, "buttons": []}]`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("set: %d %s", w.Code, w.Body)
+	}
+	if config, _ := s.db.GetConfig(family.ID); !strings.Contains(config, `"sleep"`) {
+		t.Errorf("family config = %s", config)
+	}
+
+	// A family's own config wins
+	s.db.SaveConfig(family.ID, `[]`)
+	if config, _ := s.db.GetConfig(family.ID); config != `[]` {
+		t.Errorf("own config = %s", config)
+	}
+
+	w = httptest.NewRecorder()
+	s.clearDefaultConfig(w, httptest.NewRequest("DELETE", "/admin/config/default", nil))
+	if _, source := get(); w.Code != http.StatusOK || source != "file" {
+		t.Errorf("cleared: %d %s", w.Code, source)
+	}
+}
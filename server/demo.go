@@ -0,0 +1,211 @@
+package babytrack
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Demo mode (--demo) seeds a sample family so the app and admin UI can be
+// tried without real data. The family and its access link use fixed IDs so
+// /t/demo always works and reseeding replaces rather than accumulates.
+const (
+	demoFamilyID = "demo"
+	demoToken    = "demo"
+	demoDays     = 14
+)
+
+// demoConfig mirrors defaultButtonGroups in babytrack.js.
+const demoConfig = `[{"category":"feed","stateful":false,"buttons":[{"value":"bf","label":"Feed","emoji":"🤱","countDaily":true},{"value":"play","label":"Play","emoji":"🎾","countDaily":false},{"value":"spew","label":"Spew","emoji":"🤮","countDaily":false}]},` +
+	`{"category":"sleep","stateful":true,"buttons":[{"value":"awake","label":"Awake","emoji":"","countDaily":false},{"value":"sleeping","label":"Sleeping","emoji":"","countDaily":false}]},` +
+	`{"category":"nappy","stateful":false,"buttons":[{"value":"wet","label":"Wet","emoji":"💧","countDaily":true},{"value":"dirty","label":"Dirty","emoji":"💩","countDaily":true}]},` +
+	`{"category":"soothe","stateful":false,"buttons":[{"value":"pram","label":"Pram","emoji":"🎢","countDaily":false},{"value":"rocking","label":"Rocking","emoji":"🪑","countDaily":false},{"value":"car","label":"Car","emoji":"🚗","countDaily":false},{"value":"wearing","label":"Wearing","emoji":"🤗","countDaily":false},{"value":"feed-to-sleep","label":"Feed to Sleep","emoji":"🍼😴","countDaily":false}]},` +
+	`{"category":"5s","stateful":false,"buttons":[{"value":"swaddle","label":"Swaddle","emoji":"🌯","countDaily":false},{"value":"side-lying","label":"Side/Stomach","emoji":"🛏️","countDaily":false},{"value":"shush","label":"Shush","emoji":"🤫","countDaily":false},{"value":"swing","label":"Swing","emoji":"🎢","countDaily":false},{"value":"suck","label":"Suck","emoji":"🍭","countDaily":false}]}]`
+
+// demoEntries generates plausible entries for the demoDays days up to now:
+// a long night sleep with a couple of wakings, three or four daytime naps,
+// feeds every two to four hours and regular nappy changes. Nothing is
+// generated after now.
+func demoEntries(now time.Time, rng *rand.Rand) []Entry {
+	var entries []Entry
+	add := func(t time.Time, typ, value string) {
+		if t.After(now) {
+			return
+		}
+		entries = append(entries, Entry{
+			ID:       "demo-" + generateToken(8),
+			FamilyID: demoFamilyID,
+			Ts:       t.UnixMilli(),
+			Type:     typ,
+			Value:    value,
+		})
+	}
+	jitter := func(max time.Duration) time.Duration {
+		return time.Duration(rng.Int64N(int64(max)))
+	}
+
+	y, m, d := now.Date()
+	for day := demoDays - 1; day >= 0; day-- {
+		midnight := time.Date(y, m, d-day, 0, 0, 0, 0, now.Location())
+
+		// Night sleep from ~7pm the previous evening, waking ~6-7am
+		bedtime := midnight.Add(-5*time.Hour + jitter(time.Hour))
+		add(bedtime.Add(-10*time.Minute), "soothe", "feed-to-sleep")
+		add(bedtime, "sleep", "sleeping")
+		for _, after := range []time.Duration{3 * time.Hour, 7 * time.Hour} {
+			waking := bedtime.Add(after + jitter(time.Hour))
+			add(waking, "sleep", "awake")
+			add(waking.Add(5*time.Minute), "feed", "bf")
+			add(waking.Add(30*time.Minute+jitter(15*time.Minute)), "sleep", "sleeping")
+		}
+		wake := midnight.Add(6*time.Hour + jitter(time.Hour))
+		add(wake, "sleep", "awake")
+
+		// Daytime naps
+		t := wake
+		for nap, naps := 0, 3+rng.IntN(2); nap < naps; nap++ {
+			t = t.Add(90*time.Minute + jitter(time.Hour))
+			if rng.IntN(2) == 0 {
+				add(t.Add(-5*time.Minute), "soothe", []string{"pram", "rocking", "wearing", "car"}[rng.IntN(4)])
+			}
+			add(t, "sleep", "sleeping")
+			t = t.Add(30*time.Minute + jitter(90*time.Minute))
+			add(t, "sleep", "awake")
+		}
+
+		// Daytime feeds every 2-4 hours, with the odd spew and some play
+		for t := wake.Add(10 * time.Minute); t.Before(midnight.Add(19 * time.Hour)); t = t.Add(2*time.Hour + jitter(2*time.Hour)) {
+			add(t, "feed", "bf")
+			if rng.IntN(10) < 3 {
+				add(t.Add(10*time.Minute+jitter(30*time.Minute)), "feed", "spew")
+			}
+			if rng.IntN(10) < 4 {
+				add(t.Add(40*time.Minute), "feed", "play")
+			}
+		}
+
+		// Nappies: 6-9 wet, about half of them also dirty
+		for i, n := 0, 6+rng.IntN(4); i < n; i++ {
+			nt := midnight.Add(time.Duration(i) * 24 * time.Hour / time.Duration(n)).Add(jitter(90 * time.Minute))
+			add(nt, "nappy", "wet")
+			if rng.IntN(2) == 0 {
+				add(nt, "nappy", "dirty")
+			}
+		}
+	}
+	return entries
+}
+
+// SeedDemo creates or resets the demo family. Previously seeded entries are
+// tombstoned rather than removed so connected clients sync the deletions;
+// tombstones from earlier resets are purged so the table doesn't grow.
+func (db *DB) SeedDemo(now time.Time, rng *rand.Rand) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	ms := now.UnixMilli()
+	if _, err := tx.Exec(
+		`INSERT OR IGNORE INTO families (id, name, notes, created_at, archived) VALUES (?, ?, ?, ?, 0)`,
+		demoFamilyID, "Demo family", "Sample data generated by --demo", ms,
+	); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(
+		`INSERT OR IGNORE INTO access_links (token, family_id, label, created_at, hashed) VALUES (?, ?, ?, ?, 1)`,
+		hashToken(demoToken), demoFamilyID, "Demo", ms,
+	); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM entries WHERE family_id = ? AND deleted = 1`, demoFamilyID); err != nil {
+		return 0, err
+	}
+
+	var seq int64
+	if err := tx.QueryRow(`SELECT seq FROM families WHERE id = ?`, demoFamilyID).Scan(&seq); err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(`SELECT id FROM entries WHERE family_id = ?`, demoFamilyID)
+	if err != nil {
+		return 0, err
+	}
+	var stale []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		stale = append(stale, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, id := range stale {
+		seq++
+		if _, err := tx.Exec(
+			`UPDATE entries SET deleted = 1, updated_at = ?, seq = ? WHERE id = ?`, ms, seq, id,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	entries := demoEntries(now, rng)
+	for _, e := range entries {
+		seq++
+		if _, err := tx.Exec(
+			`INSERT INTO entries (id, family_id, ts, type, value, deleted, updated_at, seq) VALUES (?, ?, ?, ?, ?, 0, ?, ?)`,
+			e.ID, e.FamilyID, e.Ts, e.Type, e.Value, ms, seq,
+		); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE families SET seq = ?, rollup_tz = NULL WHERE id = ?`, seq, demoFamilyID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO configs (family_id, data, updated_at) VALUES (?, ?, ?)
+		 ON CONFLICT(family_id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		demoFamilyID, demoConfig, ms,
+	); err != nil {
+		return 0, err
+	}
+	return len(entries), tx.Commit()
+}
+
+// seedDemo reseeds the demo family and asks its connected clients to
+// reconnect, so they pick up the new data through the normal cursor sync.
+func (s *Server) seedDemo() error {
+	n, err := s.db.SeedDemo(time.Now(), rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())))
+	if err != nil {
+		return err
+	}
+	s.hub.CloseFamily(demoFamilyID, websocket.CloseServiceRestart, "demo data reset")
+	slog.Info("demo family seeded", "family", demoFamilyID, "entries", n)
+	return nil
+}
+
+// runDemoReset reseeds the demo family every night at local midnight
+// until ctx is done.
+func (s *Server) runDemoReset(ctx context.Context) {
+	for {
+		now := time.Now()
+		y, m, d := now.Date()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()))):
+		}
+		if err := s.seedDemo(); err != nil {
+			slog.Error("failed to reset demo family", "error", err)
+		}
+	}
+}
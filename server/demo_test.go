@@ -0,0 +1,84 @@
+package babytrack
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestDemoEntries(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	entries := demoEntries(now, rand.New(rand.NewPCG(1, 2)))
+
+	counts := map[string]int{}
+	for _, e := range entries {
+		if e.Ts > now.UnixMilli() {
+			t.Fatalf("entry in the future: %+v", e)
+		}
+		if e.Ts < now.AddDate(0, 0, -demoDays).UnixMilli() {
+			t.Fatalf("entry older than %d days: %+v", demoDays, e)
+		}
+		counts[e.Type+"/"+e.Value]++
+	}
+	perDay := func(k string) float64 { return float64(counts[k]) / demoDays }
+	if f := perDay("feed/bf"); f < 5 || f > 10 {
+		t.Errorf("feeds per day = %.1f", f)
+	}
+	if f := perDay("nappy/wet"); f < 5 || f > 10 {
+		t.Errorf("wet nappies per day = %.1f", f)
+	}
+	if counts["sleep/sleeping"] == 0 || counts["sleep/awake"] == 0 {
+		t.Errorf("no sleep entries: %v", counts)
+	}
+}
+
+func TestSeedDemo(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	now := time.Now()
+
+	n, err := db.SeedDemo(now, rand.New(rand.NewPCG(1, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("no entries seeded")
+	}
+	if _, err := db.ValidateAccessLink(demoToken); err != nil {
+		t.Fatalf("demo link not usable: %v", err)
+	}
+	if cfg, _ := db.GetConfig(demoFamilyID); cfg != demoConfig {
+		t.Errorf("config not seeded: %s", cfg)
+	}
+	first, _, _ := db.GetEntriesSinceCursor(demoFamilyID, 0, 10000)
+
+	// Reseeding tombstones the old entries with fresh seqs so clients sync
+	// the deletions, and replaces them with a new set.
+	n2, err := db.SeedDemo(now, rand.New(rand.NewPCG(3, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, _, _ := db.GetEntriesSinceCursor(demoFamilyID, first[len(first)-1].Seq, 10000)
+	deleted := 0
+	for _, e := range all {
+		if e.Deleted {
+			deleted++
+		}
+	}
+	if deleted != n || len(all)-deleted != n2 {
+		t.Errorf("after reseed: %d tombstones (want %d), %d live (want %d)", deleted, n, len(all)-deleted, n2)
+	}
+
+	// A third reseed purges the first round of tombstones.
+	if _, err := db.SeedDemo(now, rand.New(rand.NewPCG(5, 6))); err != nil {
+		t.Fatal(err)
+	}
+	var total int
+	db.QueryRow("SELECT COUNT(*) FROM entries WHERE family_id = ?", demoFamilyID).Scan(&total)
+	if total >= n+n2+n2 {
+		t.Errorf("old tombstones not purged: %d rows", total)
+	}
+}
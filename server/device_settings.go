@@ -0,0 +1,205 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Device settings are a device's own preferences (night mode, which child
+// it opens on, the quick buttons it shows first), kept per device record
+// rather than in the family's config so one caregiver's choices don't
+// overwrite another's. They are a JSON object the server doesn't
+// interpret, but for "notifications" (see notifications.go): a change
+// names the keys to set, null removing one, and the result is sent to the
+// device's other connections, such as a second tab.
+// Devices without a record (scripts, or ones that haven't connected with
+// hello since records were added) have none.
+
+const (
+	maxDeviceSettingsBytes = 4 << 10
+	maxDeviceSettingsKeys  = 50
+	maxDeviceSettingKeyLen = 64
+)
+
+var errNoDevice = errors.New("this device has no record to keep settings in; reconnect the app")
+
+// settingsError says what's wrong with a settings change.
+type settingsError string
+
+func (e settingsError) Error() string { return string(e) }
+
+// GetDeviceSettings returns the device's settings, or sql.ErrNoRows.
+func (db *DB) GetDeviceSettings(id string) (json.RawMessage, error) {
+	var settings string
+	err := db.QueryRow("SELECT settings FROM devices WHERE id = ?", id).Scan(&settings)
+	return json.RawMessage(settings), err
+}
+
+// UpdateDeviceSettings applies patch to the device's settings and returns
+// the result. Keys set to null are removed. Returns sql.ErrNoRows if there
+// is no such device, or a settingsError saying what's wrong if the result
+// is invalid, in which case nothing is saved.
+func (db *DB) UpdateDeviceSettings(id string, patch json.RawMessage) (json.RawMessage, error) {
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return nil, settingsError("settings must be an object")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow("SELECT settings FROM devices WHERE id = ?", id).Scan(&current); err != nil {
+		return nil, err
+	}
+	settings := map[string]json.RawMessage{}
+	json.Unmarshal([]byte(current), &settings)
+	for k, v := range changes {
+		if string(v) == "null" {
+			delete(settings, k)
+		} else {
+			settings[k] = v
+		}
+	}
+	data, _ := json.Marshal(settings)
+	if err := checkDeviceSettings(settings, data); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE devices SET settings = ? WHERE id = ?", string(data), id); err != nil {
+		return nil, err
+	}
+	return data, tx.Commit()
+}
+
+func checkDeviceSettings(settings map[string]json.RawMessage, data []byte) error {
+	if len(settings) > maxDeviceSettingsKeys {
+		return settingsError(fmt.Sprintf("settings have over %d keys", maxDeviceSettingsKeys))
+	}
+	for k := range settings {
+		if k == "" || len(k) > maxDeviceSettingKeyLen {
+			return settingsError(fmt.Sprintf("setting names must be 1-%d characters", maxDeviceSettingKeyLen))
+		}
+	}
+	if len(data) > maxDeviceSettingsBytes {
+		return settingsError(fmt.Sprintf("settings are over %d KB", maxDeviceSettingsBytes>>10))
+	}
+	if v, ok := settings["notifications"]; ok {
+		if _, err := parseNotifyPrefs(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleGetDeviceSettings handles GET /api/v1/device/settings: the asking
+// device's settings.
+func (s *Server) handleGetDeviceSettings(w http.ResponseWriter, r *http.Request) {
+	id := deviceIDFrom(r.Context())
+	if id == "" {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, errNoDevice.Error())
+		return
+	}
+	settings, err := s.db.GetDeviceSettings(id)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, errNoDevice.Error())
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to get device settings", err)
+		return
+	}
+	jsonOK(w, settings)
+}
+
+// handleUpdateDeviceSettings handles PATCH /api/v1/device/settings: sets
+// the keys given, removing those that are null, and returns the result.
+// The device's connections are sent it.
+func (s *Server) handleUpdateDeviceSettings(w http.ResponseWriter, r *http.Request) {
+	id := deviceIDFrom(r.Context())
+	if id == "" {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, errNoDevice.Error())
+		return
+	}
+	patch, err := io.ReadAll(io.LimitReader(r.Body, maxDeviceSettingsBytes*2))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	settings, err := s.db.UpdateDeviceSettings(id, patch)
+	if _, ok := err.(settingsError); ok {
+		validationError(w, map[string]string{"settings": err.Error()})
+		return
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		jsonError(w, http.StatusNotFound, errCodeNotFound, errNoDevice.Error())
+		return
+	case err != nil:
+		serverError(w, "failed to save device settings", err)
+		return
+	}
+	s.hub.SendDeviceSettings(id, settings, nil)
+	jsonOK(w, settings)
+}
+
+// handleDeviceSettingsMessage handles {"type": "device_settings", "data":
+// {...}}, as PATCH /api/v1/device/settings. The device's other connections
+// are sent the result; this one gets device_settings_rejected if it can't
+// be saved.
+func (s *Server) handleDeviceSettingsMessage(c *Client, msg WSMessage) {
+	reject := func(reason, message string) {
+		rejected, _ := json.Marshal(map[string]any{"type": "device_settings_rejected", "reason": reason, "message": message})
+		c.send <- rejected
+	}
+	if c.deviceID == "" {
+		reject("no_device", errNoDevice.Error())
+		return
+	}
+	settings, err := s.db.UpdateDeviceSettings(c.deviceID, msg.Data)
+	if _, ok := err.(settingsError); ok {
+		reject("invalid", err.Error())
+		return
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		reject("no_device", errNoDevice.Error())
+		return
+	case err != nil:
+		c.log().Error("failed to save device settings", "error", err)
+		reject("error", "couldn't save the settings")
+		return
+	}
+	s.hub.SendDeviceSettings(c.deviceID, settings, c)
+}
+
+// SendDeviceSettings sends the device's connections, but exclude, its
+// changed settings, and applies those the server uses.
+func (h *Hub) SendDeviceSettings(deviceID string, settings json.RawMessage, exclude *Client) {
+	h.sendDeviceSettings(deviceID, settings, exclude)
+	h.relay(busMessage{Kind: "device_settings", DeviceID: deviceID, Msg: settings})
+}
+
+func (h *Hub) sendDeviceSettings(deviceID string, settings json.RawMessage, exclude *Client) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	msg, _ := json.Marshal(map[string]any{"type": "device_settings", "settings": settings})
+	prefs := notifyPrefsFrom(settings)
+	for _, clients := range h.families {
+		for c := range clients {
+			if c.deviceID != deviceID {
+				continue
+			}
+			c.notify.Store(prefs)
+			if c != exclude {
+				c.trySend(msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDeviceSettings(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Smith", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	// Two devices on the one link
+	var phone, tablet []*http.Cookie
+	for _, cookies := range []*[]*http.Cookie{&phone, &tablet} {
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, httptest.NewRequest("POST", "/t/"+link.Token, nil))
+		*cookies = w.Result().Cookies()
+	}
+	do := func(method string, cookies []*http.Cookie, body string) (int, map[string]any) {
+		req, _ := http.NewRequest(method, server.URL+"/api/v1/device/settings", strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var got map[string]any
+		json.NewDecoder(resp.Body).Decode(&got)
+		return resp.StatusCode, got
+	}
+
+	header := http.Header{}
+	for _, c := range phone {
+		header.Add("Cookie", c.String())
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/ws", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if m := skipUntilType(t, conn, "init"); m["device_settings"] == nil {
+		t.Errorf("init without device_settings: %v", m)
+	}
+
+	if code, got := do("PATCH", phone, `{"night_mode": true, "default_child": "a"}`); code != http.StatusOK || got["night_mode"] != true {
+		t.Fatalf("set: %d %v", code, got)
+	}
+	// The device's connections are sent the result
+	if m := skipUntilType(t, conn, "device_settings"); m["settings"].(map[string]any)["default_child"] != "a" {
+		t.Errorf("sent %v", m)
+	}
+	if code, got := do("PATCH", phone, `{"default_child": null}`); code != http.StatusOK || len(got) != 1 {
+		t.Errorf("remove: %d %v", code, got)
+	}
+	// The other device's are its own
+	if code, got := do("GET", tablet, ""); code != http.StatusOK || len(got) != 0 {
+		t.Errorf("tablet: %d %v", code, got)
+	}
+
+	if code, _ := do("PATCH", phone, `[1, 2]`); code != http.StatusBadRequest {
+		t.Errorf("not an object: %d", code)
+	}
+	if code, _ := do("PATCH", phone, `{"big": "`+strings.Repeat("x", maxDeviceSettingsBytes)+`"}`); code != http.StatusBadRequest {
+		t.Errorf("too big: %d", code)
+	}
+	// Scripts on the link's token have nowhere to keep them
+	if code, _ := do("GET", []*http.Cookie{{Name: "client_session", Value: link.Token}}, ""); code != http.StatusNotFound {
+		t.Errorf("no device: %d", code)
+	}
+
+	// And over the WebSocket
+	conn.WriteJSON(map[string]any{"type": "device_settings", "data": map[string]any{"": 1}})
+	if m := skipUntilType(t, conn, "device_settings_rejected"); m["reason"] != "invalid" {
+		t.Errorf("rejected %v", m)
+	}
+	conn.WriteJSON(map[string]any{"type": "device_settings", "data": map[string]any{"quick_buttons": []string{"bf"}}})
+	conn.WriteJSON(map[string]any{"type": "ping"}) // handled in order
+	skipUntilType(t, conn, "pong")
+	if _, got := do("GET", phone, ""); got["quick_buttons"] == nil || got["night_mode"] != true {
+		t.Errorf("after WS change = %v", got)
+	}
+}
@@ -0,0 +1,354 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Devices. Every device that signs in with a link, or connects without
+// having done so since this was added, is given a client_device cookie and
+// a record in devices, so caregivers can list the family's phones and sign
+// a lost one out themselves. Signing a device out disconnects it and ends
+// its sessions (see sessions.go); a device still on its link's token is
+// refused and made to clear its cookies on its next request. Its link, and
+// the family's other devices, keep working. To shut out someone who has
+// copied the link itself, an admin revokes the link.
+
+// Device is a signed-in device as its family sees it.
+type Device struct {
+	ID         string `json:"id"` // hash of the client_device cookie
+	LinkID     string `json:"link_id"`
+	Label      string `json:"label"` // its link's
+	Platform   string `json:"platform"`
+	CreatedAt  int64  `json:"created_at"`
+	LastSeenAt int64  `json:"last_seen_at"`
+	RevokedAt  *int64 `json:"revoked_at,omitempty"`
+	Connected  bool   `json:"connected"`
+	Current    bool   `json:"current"` // the device asking
+}
+
+const deviceCookieMaxAge = 86400 * 365 // seconds
+
+// deviceSeenEvery limits how often a device's last_seen_at is written.
+const deviceSeenEvery = time.Minute
+
+// CreateDevice records a device signed in with the link and returns the
+// token for its cookie.
+func (db *DB) CreateDevice(link *AccessLink, platform string, now int64) (string, error) {
+	token := generateToken(16)
+	_, err := db.Exec(
+		"INSERT INTO devices (id, link_id, family_id, platform, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?, ?)",
+		hashToken(token), link.ID, link.FamilyID, platform, now, now,
+	)
+	return token, err
+}
+
+// GetDevice returns the device with the cookie token, or sql.ErrNoRows.
+func (db *DB) GetDevice(token string) (*Device, error) {
+	var d Device
+	var revokedAt sql.NullInt64
+	err := db.QueryRow(
+		"SELECT id, link_id, platform, created_at, last_seen_at, revoked_at FROM devices WHERE id = ?",
+		hashToken(token),
+	).Scan(&d.ID, &d.LinkID, &d.Platform, &d.CreatedAt, &d.LastSeenAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		d.RevokedAt = &revokedAt.Int64
+	}
+	return &d, nil
+}
+
+// TouchDevice records that the device was seen at now, at most once per
+// deviceSeenEvery.
+func (db *DB) TouchDevice(id string, now int64) error {
+	_, err := db.Exec(
+		"UPDATE devices SET last_seen_at = ? WHERE id = ? AND last_seen_at < ?",
+		now, id, now-deviceSeenEvery.Milliseconds(),
+	)
+	return err
+}
+
+// ListDevices returns the family's signed-in devices, most recently seen
+// first.
+func (db *DB) ListDevices(familyID string) ([]Device, error) {
+	rows, err := db.Query(
+		`SELECT d.id, d.link_id, COALESCE(l.label, ''), d.platform, d.created_at, d.last_seen_at
+		 FROM devices d JOIN access_links l ON l.token = d.link_id
+		 WHERE d.family_id = ? AND d.revoked_at IS NULL
+		 ORDER BY d.last_seen_at DESC`,
+		familyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []Device{}
+	for rows.Next() {
+		var d Device
+		if err := rows.Scan(&d.ID, &d.LinkID, &d.Label, &d.Platform, &d.CreatedAt, &d.LastSeenAt); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// RevokeDevice signs the family's device out, ending its sessions. Returns
+// sql.ErrNoRows if it has no such device, or it is already signed out.
+func (db *DB) RevokeDevice(familyID, id string, now int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"UPDATE devices SET revoked_at = ? WHERE id = ? AND family_id = ? AND revoked_at IS NULL",
+		now, id, familyID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("DELETE FROM link_sessions WHERE device_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// startDevice records a device that just signed in with link and sets its
+// cookie, replacing any it had, and returns its ID. Failing to is logged,
+// not fatal: the device works, it just can't be listed.
+func (s *Server) startDevice(w http.ResponseWriter, r *http.Request, link *AccessLink) string {
+	token, err := s.db.CreateDevice(link, platformFromUserAgent(r.UserAgent()), time.Now().UnixMilli())
+	if err != nil {
+		loggerFromCtx(r.Context()).Error("failed to record device", "error", err)
+		return ""
+	}
+	http.SetCookie(w, s.deviceCookie(r, token, deviceCookieMaxAge))
+	return hashToken(token)
+}
+
+func (s *Server) deviceCookie(r *http.Request, token string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     "client_device",
+		Value:    token,
+		Path:     s.cookiePath(),
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   maxAge,
+	}
+}
+
+// checkDevice looks up the device making a request with link. A device
+// that was signed out gets a 401 and its cookies cleared, and ok is false.
+// id is "" for devices without a record, e.g. scripts or devices whose
+// record went with an earlier link.
+func (s *Server) checkDevice(w http.ResponseWriter, r *http.Request, link *AccessLink) (id string, ok bool) {
+	cookie, err := r.Cookie("client_device")
+	if err != nil {
+		return "", true
+	}
+	d, err := s.db.GetDevice(cookie.Value)
+	if err != nil || d.LinkID != link.ID {
+		return "", true
+	}
+	if d.RevokedAt != nil {
+		http.SetCookie(w, s.deviceCookie(r, "", -1))
+		s.clearClientSession(w, r)
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "this device was signed out")
+		return "", false
+	}
+	if err := s.db.TouchDevice(d.ID, time.Now().UnixMilli()); err != nil {
+		loggerFromCtx(r.Context()).Error("failed to record device last seen", "error", err)
+	}
+	return d.ID, true
+}
+
+// handleListDevices handles GET /api/v1/devices: the family's signed-in
+// devices, marking the connected ones and the one asking.
+func (s *Server) handleListDevices(w http.ResponseWriter, r *http.Request) {
+	link := accessLinkFrom(r.Context())
+	devices, err := s.db.ListDevices(link.FamilyID)
+	if err != nil {
+		serverError(w, "failed to list devices", err)
+		return
+	}
+	connected := s.hub.ConnectedDevices(link.FamilyID)
+	var current string
+	if c, err := r.Cookie("client_device"); err == nil {
+		current = hashToken(c.Value)
+	}
+	for i := range devices {
+		devices[i].Connected = connected[devices[i].ID]
+		devices[i].Current = devices[i].ID == current
+	}
+	// Connected devices first, then as last seen
+	slices.SortStableFunc(devices, func(a, b Device) int {
+		switch {
+		case a.Connected == b.Connected:
+			return 0
+		case a.Connected:
+			return -1
+		}
+		return 1
+	})
+	jsonOK(w, devices)
+}
+
+// handleRevokeDevice handles DELETE /api/v1/devices/{id}: signs one of the
+// family's devices out, this one included, and disconnects it.
+func (s *Server) handleRevokeDevice(w http.ResponseWriter, r *http.Request) {
+	link := accessLinkFrom(r.Context())
+	id := r.PathValue("id")
+	err := s.db.RevokeDevice(link.FamilyID, id, time.Now().UnixMilli())
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "device not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to sign device out", err)
+		return
+	}
+	n := s.hub.RevokeDevice(id, "signed_out")
+	loggerFromCtx(r.Context()).Info("device signed out", "family_id", link.FamilyID, "device_id", id,
+		"by_link", link.ID, "disconnected", n)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listSignedInDevices handles GET /admin/families/{id}/devices/signed-in:
+// the family's device records, for choosing its primary device.
+func (s *Server) listSignedInDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := s.db.ListDevices(r.PathValue("id"))
+	if err != nil {
+		serverError(w, "failed to list devices", err)
+		return
+	}
+	jsonOK(w, devices)
+}
+
+// ConnectedDevices returns the IDs of the family's connected devices.
+func (h *Hub) ConnectedDevices(familyID string) map[string]bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := map[string]bool{}
+	for c := range h.families[familyID] {
+		if c.deviceID != "" {
+			ids[c.deviceID] = true
+		}
+	}
+	return ids
+}
+
+// RevokeDevice disconnects the device's clients, sending a session_revoked
+// message first. Returns the number of clients disconnected.
+func (h *Hub) RevokeDevice(deviceID, reason string) int {
+	h.relay(busMessage{Kind: "revoke_device", DeviceID: deviceID, Reason: reason})
+	return h.revokeDevice(deviceID, reason)
+}
+
+func (h *Hub) revokeDevice(deviceID, reason string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	msg, _ := json.Marshal(map[string]any{"type": "session_revoked", "reason": reason})
+	n := 0
+	for _, clients := range h.families {
+		for c := range clients {
+			if c.deviceID == deviceID {
+				c.disconnect(msg, closeSessionRevoked, reason)
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// A family can name one device as its primary, such as the tablet by the
+// cot, and be alerted (sync_failure) when it falls out of sync: not seen
+// for sync_failure_min while entries were logged elsewhere. Connected
+// devices are seen with each ping. The alert goes once per outage,
+// whichever instance notices, and waits out quiet hours.
+
+const (
+	defaultSyncFailure = time.Hour
+	maxSyncFailureMin  = 24 * 60
+)
+
+// syncFailureAfter is how long the primary device can go unseen.
+func (fs FamilySettings) syncFailureAfter() time.Duration {
+	if fs.SyncFailureMin == 0 {
+		return defaultSyncFailure
+	}
+	return time.Duration(fs.SyncFailureMin) * time.Minute
+}
+
+// checkPrimaryDevice alerts if the family's primary device has missed
+// entries for too long.
+func (s *Server) checkPrimaryDevice(familyID string, settings FamilySettings, now time.Time) {
+	if settings.PrimaryDevice == "" || settings.quiet("sync_failure", now) {
+		return
+	}
+	devices, err := s.db.ListDevices(familyID)
+	if err != nil {
+		slog.Error("failed to list devices", "error", err, "family_id", familyID)
+		return
+	}
+	i := slices.IndexFunc(devices, func(d Device) bool { return d.ID == settings.PrimaryDevice })
+	if i < 0 {
+		return // signed out
+	}
+	d := devices[i]
+	if now.Sub(time.UnixMilli(d.LastSeenAt)) < settings.syncFailureAfter() {
+		return
+	}
+	latest, err := s.db.GetLatestActivity(familyID)
+	if err != nil {
+		slog.Error("failed to get latest activity", "error", err, "family_id", familyID)
+		return
+	}
+	if latest <= d.LastSeenAt {
+		return // nothing to miss
+	}
+	ok, err := s.db.claimSyncAlert(familyID, d.LastSeenAt)
+	if err != nil {
+		slog.Error("failed to claim sync failure alert", "error", err, "family_id", familyID)
+	}
+	if !ok {
+		return
+	}
+	name := d.Label
+	if name == "" {
+		name = d.Platform
+	}
+	s.sendAlert(Alert{
+		FamilyID: familyID,
+		Kind:     "sync_failure",
+		Message: fmt.Sprintf("Primary device (%s) hasn't synced for %s and has missed entries",
+			name, locales[defaultLocale].FormatDuration(int(now.Sub(time.UnixMilli(d.LastSeenAt))/time.Minute))),
+		Data: map[string]any{"device_id": d.ID, "last_seen_at": d.LastSeenAt},
+		Ts:   now.UnixMilli(),
+	})
+}
+
+func (db *DB) claimSyncAlert(familyID string, lastSeen int64) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE families SET sync_alerted_seen = ? WHERE id = ? AND sync_alerted_seen IS NOT ?",
+		lastSeen, familyID, lastSeen)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
@@ -0,0 +1,111 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDevices(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	mux := s.routes()
+	family, _ := s.db.CreateFamily("Smith", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	other, _ := s.db.CreateFamily("Jones", "")
+	otherLink, _ := s.db.CreateAccessLink(other.ID, "Dad", nil)
+
+	// signIn opens the link and returns the cookies it set
+	signIn := func(token, ua string) []*http.Cookie {
+		req := httptest.NewRequest("POST", "/t/"+token, nil)
+		req.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("sign in: %d", w.Code)
+		}
+		return w.Result().Cookies()
+	}
+	do := func(method, path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	list := func(cookies []*http.Cookie) []Device {
+		w := do("GET", "/api/v1/devices", cookies)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: %d %s", w.Code, w.Body)
+		}
+		var devices []Device
+		json.NewDecoder(w.Body).Decode(&devices)
+		return devices
+	}
+
+	phone := signIn(link.Token, "Mozilla/5.0 (iPhone)")
+	tablet := signIn(link.Token, "Mozilla/5.0 (Linux; Android 14)")
+	devices := list(phone)
+	if len(devices) != 2 {
+		t.Fatalf("devices = %+v", devices)
+	}
+	var tabletID string
+	for _, d := range devices {
+		if d.Label != "Mum" || d.LinkID != link.ID || d.Connected {
+			t.Errorf("device = %+v", d)
+		}
+		if d.Platform == "android" {
+			tabletID = d.ID
+			if d.Current {
+				t.Error("tablet marked current for the phone")
+			}
+		}
+	}
+
+	// Another family can't see or sign out this one's devices
+	dad := signIn(otherLink.Token, "Mozilla/5.0 (iPhone)")
+	if got := list(dad); len(got) != 1 {
+		t.Errorf("other family's devices = %+v", got)
+	}
+	if w := do("DELETE", "/api/v1/devices/"+tabletID, dad); w.Code != http.StatusNotFound {
+		t.Errorf("other family's revoke: %d", w.Code)
+	}
+
+	if w := do("DELETE", "/api/v1/devices/"+tabletID, phone); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body)
+	}
+	if w := do("DELETE", "/api/v1/devices/"+tabletID, phone); w.Code != http.StatusNotFound {
+		t.Errorf("second revoke: %d", w.Code)
+	}
+	if w := do("GET", "/api/v1/state", tablet); w.Code != http.StatusUnauthorized {
+		t.Errorf("signed-out device: %d", w.Code)
+	}
+	if devices := list(phone); len(devices) != 1 || !devices[0].Current {
+		t.Errorf("after revoke = %+v", devices)
+	}
+
+	// A device still on the link's token is made to forget it
+	token, _ := s.db.CreateDevice(link, "ios", 0)
+	legacy := []*http.Cookie{{Name: "client_session", Value: link.Token}, {Name: "client_device", Value: token}}
+	s.db.RevokeDevice(family.ID, hashToken(token), 1)
+	w := do("GET", "/api/v1/state", legacy)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("signed-out legacy device: %d", w.Code)
+	}
+	cleared := map[string]bool{}
+	for _, c := range w.Result().Cookies() {
+		cleared[c.Name] = c.MaxAge < 0
+	}
+	if !cleared["client_session"] || !cleared["client_device"] {
+		t.Errorf("cookies cleared = %v", cleared)
+	}
+
+	// Revoking the link forgets its devices
+	s.db.DeleteAccessLink(family.ID, link.ID)
+	if devices, _ := s.db.ListDevices(family.ID); len(devices) != 0 {
+		t.Errorf("after link revoked = %+v", devices)
+	}
+}
@@ -0,0 +1,186 @@
+package babytrack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// The daily digest gives operators of a shared instance one message a day
+// about every family instead of watching the activity feed: entries
+// written, new access links, frontend errors, and families that have just
+// gone quiet. It's posted to DIGEST_WEBHOOK_URL, if set, at DIGEST_HOUR
+// server time; like the lifecycle webhook, there's no email delivery. The
+// webhook can be changed on reload. With several instances, whichever
+// claims the day first sends it.
+
+// DigestFamily is one family's day, if anything happened in it.
+type DigestFamily struct {
+	FamilyID string `json:"family_id"`
+	Name     string `json:"name"`
+	Entries  int    `json:"entries"`   // written: added, edited or deleted
+	NewLinks int    `json:"new_links"` // access links created
+	Errors   int    `json:"errors"`    // frontend error logs
+}
+
+// Digest is the roll-up for the day to To.
+type Digest struct {
+	From     int64            `json:"from"`
+	To       int64            `json:"to"`
+	Entries  int              `json:"entries"`
+	NewLinks int              `json:"new_links"`
+	Errors   int              `json:"errors"`
+	Families []DigestFamily   `json:"families"` // busiest first
+	Quiet    []InactiveFamily `json:"quiet"`    // crossed QuietDays without entries during the day
+}
+
+// DigestFamilies counts each family's entries written, links created and
+// error logs between from and to (ms), leaving out families with none.
+func (db *DB) DigestFamilies(from, to int64) ([]DigestFamily, error) {
+	rows, err := db.Query(
+		`SELECT f.id, f.name,
+		   (SELECT COUNT(*) FROM entries WHERE family_id = f.id AND updated_at >= ? AND updated_at < ?) AS n,
+		   (SELECT COUNT(*) FROM access_links WHERE family_id = f.id AND created_at >= ? AND created_at < ?),
+		   (SELECT COUNT(*) FROM client_logs WHERE family_id = f.id AND level = 'error' AND ts >= ? AND ts < ?)
+		 FROM families f
+		 ORDER BY n DESC, f.created_at`,
+		from, to, from, to, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	families := []DigestFamily{}
+	for rows.Next() {
+		var f DigestFamily
+		if err := rows.Scan(&f.FamilyID, &f.Name, &f.Entries, &f.NewLinks, &f.Errors); err != nil {
+			return nil, err
+		}
+		if f.Entries+f.NewLinks+f.Errors > 0 {
+			families = append(families, f)
+		}
+	}
+	return families, rows.Err()
+}
+
+// buildDigest rolls up the 24 hours to now. Families count as gone quiet
+// when their latest entry passed quietDays old during those hours.
+func (s *Server) buildDigest(now time.Time, quietDays int) (*Digest, error) {
+	from := now.Add(-24 * time.Hour)
+	d := &Digest{From: from.UnixMilli(), To: now.UnixMilli(), Quiet: []InactiveFamily{}}
+	var err error
+	if d.Families, err = s.db.DigestFamilies(d.From, d.To); err != nil {
+		return nil, err
+	}
+	for _, f := range d.Families {
+		d.Entries += f.Entries
+		d.NewLinks += f.NewLinks
+		d.Errors += f.Errors
+	}
+	if quietDays > 0 {
+		cutoff := now.AddDate(0, 0, -quietDays)
+		inactive, err := s.db.InactiveFamilies(cutoff.UnixMilli(), "")
+		if err != nil {
+			return nil, err
+		}
+		since := from.AddDate(0, 0, -quietDays).UnixMilli()
+		for _, f := range inactive {
+			if f.LatestActivity >= since {
+				d.Quiet = append(d.Quiet, f)
+			}
+		}
+	}
+	return d, nil
+}
+
+// message is the digest as one line, for chat bridges.
+func (d *Digest) message() string {
+	msg := fmt.Sprintf("%d entries in %d families, %d new links, %d errors.", d.Entries, len(d.Families), d.NewLinks, d.Errors)
+	if len(d.Quiet) > 0 {
+		msg += fmt.Sprintf(" %d families gone quiet:", len(d.Quiet))
+		for i, f := range d.Quiet {
+			if i > 0 {
+				msg += ","
+			}
+			msg += " " + f.Name
+		}
+		msg += "."
+	}
+	return msg
+}
+
+func (db *DB) claimDigest(date string, now int64) (bool, error) {
+	res, err := db.Exec("INSERT OR IGNORE INTO digests (date, sent_at) VALUES (?, ?)", date, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *Server) digestWebhook() string {
+	s.tuning.RLock()
+	defer s.tuning.RUnlock()
+	return s.digest
+}
+
+// RunDigest posts the digest every day at hour (server time), while there's
+// a webhook to post it to, until ctx is done.
+func (s *Server) RunDigest(ctx context.Context, hour, quietDays int) {
+	for {
+		now := time.Now()
+		y, m, d := now.Date()
+		next := time.Date(y, m, d, hour, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = time.Date(y, m, d+1, hour, 0, 0, 0, now.Location())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		webhook := s.digestWebhook()
+		if webhook == "" {
+			continue
+		}
+		now = time.Now()
+		ok, err := s.db.claimDigest(next.Format("2006-01-02"), now.UnixMilli())
+		if err != nil {
+			slog.Error("failed to claim digest", "error", err)
+			continue
+		}
+		if !ok {
+			continue // sent by another instance
+		}
+		if err := s.sendDigest(now, webhook, quietDays); err != nil {
+			slog.Error("digest failed", "error", err)
+		}
+	}
+}
+
+// sendDigest builds the digest to now and posts it as a "digest" alert.
+func (s *Server) sendDigest(now time.Time, webhook string, quietDays int) error {
+	d, err := s.buildDigest(now, quietDays)
+	if err != nil {
+		return err
+	}
+	if err := postWebhook(webhook, Alert{Kind: "digest", Message: d.message(), Ts: d.To, Data: d}); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	slog.Info("digest sent", "families", len(d.Families), "entries", d.Entries, "quiet", len(d.Quiet))
+	return nil
+}
+
+// getDigest handles GET /admin/digest: the digest for the last 24 hours,
+// whether or not it's being sent.
+func (s *Server) getDigest(w http.ResponseWriter, r *http.Request) {
+	d, err := s.buildDigest(time.Now(), s.opts.DigestQuietDays)
+	if err != nil {
+		serverError(w, "failed to build digest", err)
+		return
+	}
+	jsonOK(w, d)
+}
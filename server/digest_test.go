@@ -0,0 +1,70 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDigest(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	now := time.Now()
+	family := func(name string, idle time.Duration) *Family {
+		f, _ := s.db.CreateFamily(name, "")
+		ts := now.Add(-idle).UnixMilli()
+		s.db.(*DB).Exec("UPDATE families SET created_at = ? WHERE id = ?", now.AddDate(0, -1, 0).UnixMilli(), f.ID)
+		s.db.UpsertEntry(&Entry{ID: name, FamilyID: f.ID, Ts: ts, Type: "feed", Value: "bf"})
+		s.db.(*DB).Exec("UPDATE entries SET updated_at = ? WHERE id = ?", ts, name)
+		return f
+	}
+	busy := family("busy", time.Hour)
+	s.db.UpsertEntry(&Entry{ID: "busy2", FamilyID: busy.ID, Ts: now.UnixMilli(), Type: "nappy", Value: "wet"})
+	s.db.CreateAccessLink(busy.ID, "Grandma", nil)
+	s.db.InsertClientLogs(busy.ID, "Mum", []ClientLog{
+		{Ts: now.UnixMilli(), Level: "error", Message: "boom"},
+		{Ts: now.UnixMilli(), Level: "info", Message: "fine"},
+	})
+	family("quiet", 84*time.Hour)
+	family("long quiet", 10*24*time.Hour)
+
+	var got Alert
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer hook.Close()
+	// A moment on, so everything above is inside the window
+	if err := s.sendDigest(time.Now().Add(time.Second), hook.URL, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Kind != "digest" || got.Message != "2 entries in 1 families, 1 new links, 1 errors. 1 families gone quiet: quiet." {
+		t.Errorf("alert = %+v", got)
+	}
+	var d Digest
+	b, _ := json.Marshal(got.Data)
+	json.Unmarshal(b, &d)
+	if len(d.Families) != 1 || d.Families[0] != (DigestFamily{FamilyID: busy.ID, Name: "busy", Entries: 2, NewLinks: 1, Errors: 1}) {
+		t.Errorf("families = %+v", d.Families)
+	}
+	if len(d.Quiet) != 1 || d.Quiet[0].Name != "quiet" {
+		t.Errorf("quiet = %+v", d.Quiet)
+	}
+}
+
+func TestClaimDigest(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	if ok, err := s.db.claimDigest("2026-10-16", 1); !ok || err != nil {
+		t.Errorf("first claim = %v, %v", ok, err)
+	}
+	if ok, _ := s.db.claimDigest("2026-10-16", 2); ok {
+		t.Error("day claimed twice")
+	}
+	if ok, _ := s.db.claimDigest("2026-10-17", 3); !ok {
+		t.Error("next day not claimed")
+	}
+}
@@ -0,0 +1,60 @@
+package babytrack
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Duration entries are started with the "start" WS action and finished with
+// "stop", rather than by logging a second entry whose value ends the
+// first. They're broadcast as ordinary add/update entries so older clients
+// still see them.
+
+var (
+	errNotOngoing = errors.New("entry is not an ongoing activity")
+	errEndedEarly = errors.New("ended_ts is before the entry's ts")
+)
+
+// validateDuration checks the duration fields of an entry: an ended entry
+// is never ongoing and can't end before it started.
+func validateDuration(e *Entry) error {
+	if e.EndedTs == nil {
+		return nil
+	}
+	e.Ongoing = false
+	if *e.EndedTs < e.Ts {
+		return errEndedEarly
+	}
+	return nil
+}
+
+// stoppedEntry returns an ongoing activity as it should be saved once
+// finished at stop.EndedTs (now if unset). stop may carry the whole entry,
+// so a start that never reached the server (e.g. superseded in an offline
+// queue) is saved as a finished activity.
+func (db *DB) stoppedEntry(familyID string, stop *Entry) (*Entry, error) {
+	ended := time.Now().UnixMilli()
+	if stop.EndedTs != nil {
+		ended = *stop.EndedTs
+	}
+
+	e, err := db.GetEntry(familyID, stop.ID)
+	switch {
+	case err == sql.ErrNoRows && stop.Type != "":
+		e = stop
+		e.FamilyID = familyID
+	case err == sql.ErrNoRows:
+		return nil, errNotOngoing
+	case err != nil:
+		return nil, err
+	case e.Deleted || (!e.Ongoing && e.EndedTs == nil):
+		return nil, errNotOngoing
+	}
+
+	e.EndedTs = &ended
+	if err := validateDuration(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
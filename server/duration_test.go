@@ -0,0 +1,128 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStartStopEntry(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	family, _ := db.CreateFamily("Test Baby", "")
+	mum, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	dad, _ := db.CreateAccessLink(family.ID, "Dad", nil)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+
+	dial := func(token string) *websocket.Conn {
+		header := http.Header{}
+		header.Add("Cookie", "client_session="+token)
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		skipUntilType(t, conn, "init")
+		return conn
+	}
+	mumConn := dial(mum.Token)
+	defer mumConn.Close()
+	dadConn := dial(dad.Token)
+	defer dadConn.Close()
+
+	now := time.Now().UnixMilli()
+	ts := strconv.FormatInt(now-20*time.Minute.Milliseconds(), 10)
+	send := func(action, entry string) {
+		mumConn.WriteMessage(websocket.TextMessage, []byte(`{"type":"entry","action":"`+action+`","entry":`+entry+`}`))
+	}
+
+	send("start", `{"id":"feed-1","ts":`+ts+`,"type":"feed","value":"bf","ended_ts":1}`)
+	skipUntilType(t, mumConn, "entry_ack")
+	msg := skipUntilType(t, dadConn, "entry")
+	entry := msg["entry"].(map[string]any)
+	if msg["action"] != "add" || entry["ongoing"] != true || entry["ended_ts"] != nil {
+		t.Errorf("start broadcast = %v", msg)
+	}
+
+	// Ending before it started is refused
+	send("stop", `{"id":"feed-1","ended_ts":`+strconv.FormatInt(now-time.Hour.Milliseconds(), 10)+`}`)
+	if r := skipUntilType(t, mumConn, "entry_rejected"); r["reason"] != errEndedEarly.Error() {
+		t.Errorf("rejection = %v", r)
+	}
+
+	send("stop", `{"id":"feed-1","ended_ts":`+strconv.FormatInt(now, 10)+`}`)
+	skipUntilType(t, mumConn, "entry_ack")
+	msg = skipUntilType(t, dadConn, "entry")
+	entry = msg["entry"].(map[string]any)
+	if msg["action"] != "update" || entry["ongoing"] != nil || entry["ended_ts"] != float64(now) || entry["value"] != "bf" {
+		t.Errorf("stop broadcast = %v", msg)
+	}
+
+	// A second stop of a finished entry just moves its end
+	send("stop", `{"id":"feed-1"}`)
+	skipUntilType(t, mumConn, "entry_ack")
+
+	send("stop", `{"id":"nope"}`)
+	if r := skipUntilType(t, mumConn, "entry_rejected"); r["reason"] != errNotOngoing.Error() || r["id"] != "nope" {
+		t.Errorf("rejection = %v", r)
+	}
+
+	// A stop carrying the whole entry saves it even if the start was lost
+	send("stop", `{"id":"sleep-1","ts":`+ts+`,"type":"sleep","value":"sleeping","ended_ts":`+strconv.FormatInt(now, 10)+`}`)
+	skipUntilType(t, mumConn, "entry_ack")
+	e, err := db.GetEntry(family.ID, "sleep-1")
+	if err != nil || e.Ongoing || e.EndedTs == nil || *e.EndedTs != now {
+		t.Errorf("sleep-1 = %+v, %v", e, err)
+	}
+}
+
+func TestTimelineDurationEntries(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+
+	base := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	ms := func(d time.Duration) int64 { return base.Add(d).UnixMilli() }
+	ended := ms(30 * time.Minute)
+	for _, e := range []*Entry{
+		{ID: "walk", Ts: ms(-time.Hour), Type: "play", Value: "walk", EndedTs: &ended}, // spans from
+		{ID: "old", Ts: ms(-3 * time.Hour), Type: "play", Value: "mat", EndedTs: ptr(ms(-2 * time.Hour))},
+		{ID: "feed", Ts: ms(time.Hour), Type: "feed", Value: "bf", Ongoing: true},
+	} {
+		e.FamilyID = family.ID
+		if err := db.UpsertEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tl, err := buildTimeline(db, family.ID, ms(0), ms(2*time.Hour), base.Add(90*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tl.Items) != 2 {
+		t.Fatalf("items = %+v", tl.Items)
+	}
+	walk, feed := tl.Items[0], tl.Items[1]
+	if walk.ID != "walk" || walk.Kind != "block" || *walk.End != ended || *walk.DurationMin != 90 {
+		t.Errorf("walk = %+v", walk)
+	}
+	if feed.ID != "feed" || !feed.Ongoing || feed.End != nil || *feed.DurationMin != 30 {
+		t.Errorf("feed = %+v", feed)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,150 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Structured values: an entry's data may carry an EntryValue, so amounts,
+// sides and durations can be added up instead of read out of the value
+// text. Kinds with their own payloads (pump, med, temp) keep those. Clients
+// that predate data still only send and show the value, so
+// normalizeEntryValue keeps the two in step: an empty value is filled in
+// from the data, and a value such as "120ml" is copied into the data.
+// structureEntryValues does the same for entries saved before.
+
+// EntryValue is the structured payload shared by entry kinds without
+// their own.
+type EntryValue struct {
+	Amount      *float64 `json:"amount,omitempty"`
+	Unit        string   `json:"unit,omitempty"`
+	Side        string   `json:"side,omitempty"`
+	DurationMin *float64 `json:"duration_min,omitempty"`
+}
+
+const maxEntryAmount = 100000
+
+var entryUnits = map[string]bool{"ml": true, "oz": true, "g": true}
+
+// ownDataTypes have a payload schema of their own.
+var ownDataTypes = map[string]bool{"pump": true, "med": true, "temp": true}
+
+var quantityRe = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*(ml|mls|oz|fl ?oz|g)\s*$`)
+
+func validateEntryValue(e *Entry) error {
+	var v EntryValue
+	if err := json.Unmarshal(e.Data, &v); err != nil {
+		return errors.New("data: " + err.Error())
+	}
+	if v.Amount != nil {
+		if *v.Amount < 0 || *v.Amount > maxEntryAmount || math.IsNaN(*v.Amount) {
+			return errors.New("amount out of range")
+		}
+		if !entryUnits[v.Unit] {
+			return errors.New("amount needs a unit of ml, oz or g")
+		}
+	} else if v.Unit != "" {
+		return errors.New("unit without an amount")
+	}
+	if v.Side != "" && !pumpSides[v.Side] {
+		return errors.New("side must be left, right or both")
+	}
+	if v.DurationMin != nil && (*v.DurationMin < 0 || *v.DurationMin > 24*60) {
+		return errors.New("duration_min out of range")
+	}
+	return nil
+}
+
+// parseQuantity reads a value such as "120ml", "4 oz" or "30g".
+func parseQuantity(s string) (amount float64, unit string, ok bool) {
+	m := quantityRe.FindStringSubmatch(strings.ToLower(s))
+	if m == nil {
+		return 0, "", false
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || n <= 0 || n > maxEntryAmount {
+		return 0, "", false
+	}
+	switch m[2] {
+	case "ml", "mls":
+		unit = "ml"
+	case "g":
+		unit = "g"
+	default:
+		unit = "oz"
+	}
+	return n, unit, true
+}
+
+// formatQuantity is the value text for an amount, e.g. "120ml".
+func formatQuantity(amount float64, unit string) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64) + unit
+}
+
+// normalizeEntryValue fills e's value from its structured data, or its data
+// from a value that is a quantity. Data must already be valid.
+func normalizeEntryValue(e *Entry) {
+	if ownDataTypes[e.Type] {
+		return
+	}
+	if len(e.Data) == 0 {
+		if amount, unit, ok := parseQuantity(e.Value); ok {
+			e.Data, _ = json.Marshal(EntryValue{Amount: &amount, Unit: unit})
+		}
+		return
+	}
+	if e.Value != "" {
+		return
+	}
+	var v EntryValue
+	if json.Unmarshal(e.Data, &v) != nil {
+		return
+	}
+	switch {
+	case v.Amount != nil:
+		e.Value = formatQuantity(*v.Amount, v.Unit)
+	case v.Side != "":
+		e.Value = v.Side
+	}
+}
+
+// structureEntryValues gives entries saved before structured values, whose
+// value is a quantity, the matching data. Their seq is left alone: clients
+// already have the value, and the server reads the data.
+func structureEntryValues(db *sql.DB) error {
+	rows, err := db.Query(
+		`SELECT id, family_id, type, value FROM entries
+		 WHERE data IS NULL AND deleted = 0 AND value GLOB '[0-9]*'
+		   AND (value LIKE '%ml' OR value LIKE '%oz' OR value LIKE '%g')`,
+	)
+	if err != nil {
+		return err
+	}
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.FamilyID, &e.Type, &e.Value); err != nil {
+			rows.Close()
+			return err
+		}
+		normalizeEntryValue(&e)
+		if len(e.Data) > 0 {
+			entries = append(entries, e)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := db.Exec("UPDATE entries SET data = ? WHERE family_id = ? AND id = ?", string(e.Data), e.FamilyID, e.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateEntryValue(t *testing.T) {
+	for data, ok := range map[string]bool{
+		`{"amount":120,"unit":"ml"}`:             true,
+		`{"side":"left","duration_min":12}`:      true,
+		`{"note":"anything else is left alone"}`: true,
+		`{"amount":120}`:                         false,
+		`{"unit":"ml"}`:                          false,
+		`{"amount":-1,"unit":"ml"}`:              false,
+		`{"amount":5,"unit":"cups"}`:             false,
+		`{"side":"middle"}`:                      false,
+		`{"duration_min":2000}`:                  false,
+		`{"amount":"lots","unit":"ml"}`:          false,
+	} {
+		err := validateEntryData(&Entry{Type: "solids", Value: "x", Data: json.RawMessage(data)})
+		if (err == nil) != ok {
+			t.Errorf("%s: %v", data, err)
+		}
+	}
+	// Kinds with their own schema aren't held to this one
+	if err := validateEntryData(&Entry{Type: "temp", Value: "37.2", Data: json.RawMessage(`{"value":37.2,"unit":"C"}`)}); err != nil {
+		t.Errorf("temp: %v", err)
+	}
+}
+
+func TestNormalizeEntryValue(t *testing.T) {
+	// Old client: the value is copied into data
+	e := &Entry{Type: "feed", Value: "4 oz"}
+	normalizeEntryValue(e)
+	if string(e.Data) != `{"amount":4,"unit":"oz"}` || e.Value != "4 oz" {
+		t.Errorf("from value: %q %s", e.Value, e.Data)
+	}
+
+	// New client: the value is filled in for old ones
+	e = &Entry{Type: "feed", Data: json.RawMessage(`{"amount":90,"unit":"ml"}`)}
+	normalizeEntryValue(e)
+	if e.Value != "90ml" {
+		t.Errorf("from amount: %q", e.Value)
+	}
+	e = &Entry{Type: "feed", Data: json.RawMessage(`{"side":"left","duration_min":10}`)}
+	normalizeEntryValue(e)
+	if e.Value != "left" {
+		t.Errorf("from side: %q", e.Value)
+	}
+
+	// Neither touched otherwise
+	for _, e := range []*Entry{
+		{Type: "feed", Value: "bf"},
+		{Type: "feed", Value: "bottle", Data: json.RawMessage(`{"amount":90,"unit":"ml"}`)},
+		{Type: "med", Value: "5ml"},
+	} {
+		before := *e
+		normalizeEntryValue(e)
+		if e.Value != before.Value || string(e.Data) != string(before.Data) {
+			t.Errorf("changed %+v to %+v", before, e)
+		}
+	}
+}
+
+func TestStructureEntryValues(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	family, _ := db.CreateFamily("Test", "")
+	for _, e := range []Entry{
+		{ID: "a", FamilyID: family.ID, Ts: 1, Type: "feed", Value: "120ml"},
+		{ID: "b", FamilyID: family.ID, Ts: 2, Type: "feed", Value: "bf"},
+		{ID: "c", FamilyID: family.ID, Ts: 3, Type: "solids", Value: "30g"},
+	} {
+		db.UpsertEntry(&e)
+	}
+	db.Close()
+
+	// Reopening gives the old entries their data
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for id, want := range map[string]string{"a": `{"amount":120,"unit":"ml"}`, "b": "", "c": `{"amount":30,"unit":"g"}`} {
+		var data sql.NullString
+		db.QueryRow("SELECT data FROM entries WHERE id = ?", id).Scan(&data)
+		if data.String != want {
+			t.Errorf("%s: data = %q", id, data.String)
+		}
+	}
+}
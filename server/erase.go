@@ -0,0 +1,227 @@
+package babytrack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Erasure hard-deletes everything a family has stored: entries (including
+// tombstones and their data payloads, and any snapshot or rollup of them),
+// button config and its history, frontend logs and access links. The
+// family row stays, renamed and archived, so the erasure receipt has
+// something to point at. It takes two steps: the admin asks for a
+// confirmation token, which says what will go, then confirms with it
+// within eraseTokenTTL.
+
+const eraseTokenTTL = 10 * time.Minute
+
+// ErasureCounts is what an erasure removes, or would remove.
+type ErasureCounts struct {
+	Entries int `json:"entries"`
+	Configs int `json:"configs"`
+	Logs    int `json:"logs"`
+	Links   int `json:"links"`
+}
+
+// Erasure is the receipt kept after a family's data is erased.
+type Erasure struct {
+	ID       string        `json:"id"`
+	FamilyID string        `json:"family_id"`
+	AdminID  string        `json:"admin_id,omitempty"`
+	ErasedAt int64         `json:"erased_at"`
+	Counts   ErasureCounts `json:"counts"`
+}
+
+// erasedFamilyName replaces the family's name, which is often the baby's.
+const erasedFamilyName = "(erased)"
+
+// ErasureCounts counts what erasing the family would remove.
+func (db *DB) ErasureCounts(familyID string) (ErasureCounts, error) {
+	var c ErasureCounts
+	err := db.QueryRow(
+		`SELECT
+		   (SELECT COUNT(*) FROM entries WHERE family_id = ?),
+		   (SELECT COUNT(*) FROM configs WHERE family_id = ?),
+		   (SELECT COUNT(*) FROM client_logs WHERE family_id = ?),
+		   (SELECT COUNT(*) FROM access_links WHERE family_id = ?)`,
+		familyID, familyID, familyID, familyID,
+	).Scan(&c.Entries, &c.Configs, &c.Logs, &c.Links)
+	return c, err
+}
+
+// EraseFamily deletes the family's data in one transaction and records a
+// receipt.
+func (db *DB) EraseFamily(familyID, adminID string) (*Erasure, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	e := &Erasure{ID: generateToken(8), FamilyID: familyID, AdminID: adminID, ErasedAt: time.Now().UnixMilli()}
+	for _, d := range []struct {
+		table string
+		n     *int
+	}{
+		{"entries", &e.Counts.Entries},
+		{"configs", &e.Counts.Configs},
+		{"client_logs", &e.Counts.Logs},
+		{"access_links", &e.Counts.Links},
+	} {
+		res, err := tx.Exec("DELETE FROM "+d.table+" WHERE family_id = ?", familyID)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := res.RowsAffected()
+		*d.n = int(n)
+	}
+	for _, table := range []string{"snapshots", "daily_rollups", "config_revisions", "activity_events", "invites", "magic_links", "link_sessions", "devices", "account_links", "sms_sent", "announcements"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE family_id = ?", familyID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(
+		`UPDATE families SET name = ?, notes = NULL, settings = NULL, calendar_token = NULL, rollup_tz = NULL, archived = 1,
+		   archived_at = COALESCE(archived_at, ?)
+		 WHERE id = ?`,
+		erasedFamilyName, time.Now().UnixMilli(), familyID,
+	); err != nil {
+		return nil, err
+	}
+	counts, _ := json.Marshal(e.Counts)
+	if _, err := tx.Exec(
+		"INSERT INTO erasures (id, family_id, admin_id, erased_at, counts) VALUES (?, ?, ?, ?, ?)",
+		e.ID, familyID, nullString(adminID), e.ErasedAt, string(counts),
+	); err != nil {
+		return nil, err
+	}
+	return e, tx.Commit()
+}
+
+// ListErasures returns the family's erasure receipts, newest first.
+func (db *DB) ListErasures(familyID string) ([]Erasure, error) {
+	rows, err := db.Query(
+		`SELECT id, family_id, admin_id, erased_at, counts FROM erasures
+		 WHERE family_id = ? ORDER BY erased_at DESC`,
+		familyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	erasures := []Erasure{}
+	for rows.Next() {
+		var e Erasure
+		var adminID sql.NullString
+		var counts string
+		if err := rows.Scan(&e.ID, &e.FamilyID, &adminID, &e.ErasedAt, &counts); err != nil {
+			return nil, err
+		}
+		e.AdminID = adminID.String
+		json.Unmarshal([]byte(counts), &e.Counts)
+		erasures = append(erasures, e)
+	}
+	return erasures, rows.Err()
+}
+
+// eraseToken returns a confirmation token for erasing familyID, valid until
+// exp: the expiry and an HMAC over it and the family.
+func eraseToken(key []byte, familyID string, exp int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "erase\n%s\n%d", familyID, exp)
+	return strconv.FormatInt(exp, 10) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validEraseToken reports whether token confirms erasing familyID now.
+func validEraseToken(key []byte, familyID, token string, now time.Time) bool {
+	expStr, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	exp, err := strconv.ParseInt(expStr, 10, 64)
+	if err != nil || now.Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(eraseToken(key, familyID, exp)))
+}
+
+// requestErasure handles POST /admin/families/{id}/erase, the first step:
+// it returns a confirmation token and what confirming it would delete.
+func (s *Server) requestErasure(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	if _, err := s.db.GetFamily(familyID); err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	counts, err := s.db.ErasureCounts(familyID)
+	if err != nil {
+		serverError(w, "failed to count family data", err)
+		return
+	}
+	key, err := s.db.Secret("erase")
+	if err != nil {
+		serverError(w, "failed to sign erasure token", err)
+		return
+	}
+	exp := time.Now().Add(eraseTokenTTL)
+	jsonOK(w, map[string]any{
+		"token":      eraseToken(key, familyID, exp.Unix()),
+		"expires_at": exp.UnixMilli(),
+		"counts":     counts,
+	})
+}
+
+// confirmErasure handles POST /admin/families/{id}/erase/confirm. The body
+// carries the token from requestErasure; the response is the receipt.
+func (s *Server) confirmErasure(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	key, err := s.db.Secret("erase")
+	if err != nil {
+		serverError(w, "failed to check erasure token", err)
+		return
+	}
+	if !validEraseToken(key, familyID, req.Token, time.Now()) {
+		validationError(w, map[string]string{"token": "invalid or expired; request a new one"})
+		return
+	}
+	if _, err := s.db.GetFamily(familyID); err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+
+	erasure, err := s.db.EraseFamily(familyID, r.Header.Get("X-Admin-ID"))
+	if err != nil {
+		serverError(w, "failed to erase family data", err)
+		return
+	}
+	s.summaries.invalidate(familyID)
+	// Its links are gone; don't let open sessions keep writing
+	s.hub.CloseFamily(familyID, closeSessionRevoked, "family data erased")
+	jsonOK(w, erasure)
+}
+
+// listErasures handles GET /admin/families/{id}/erasures.
+func (s *Server) listErasures(w http.ResponseWriter, r *http.Request) {
+	erasures, err := s.db.ListErasures(r.PathValue("id"))
+	if err != nil {
+		serverError(w, "failed to list erasures", err)
+		return
+	}
+	jsonOK(w, erasures)
+}
@@ -0,0 +1,90 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEraseToken(t *testing.T) {
+	key := []byte("k")
+	now := time.Unix(1_700_000_000, 0)
+	token := eraseToken(key, "fam", now.Add(eraseTokenTTL).Unix())
+	if !validEraseToken(key, "fam", token, now) {
+		t.Error("fresh token rejected")
+	}
+	if validEraseToken(key, "other", token, now) {
+		t.Error("token accepted for another family")
+	}
+	if validEraseToken(key, "fam", token, now.Add(eraseTokenTTL+time.Second)) {
+		t.Error("expired token accepted")
+	}
+	if validEraseToken(key, "fam", "garbage", now) {
+		t.Error("garbage accepted")
+	}
+}
+
+func TestEraseFamily(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Ada", "twins")
+	other, _ := s.db.CreateFamily("Other", "")
+	s.db.UpsertEntry(&Entry{ID: "e1", FamilyID: family.ID, Ts: 1, Type: "feed", Value: "bf"})
+	s.db.UpsertEntry(&Entry{ID: "e2", FamilyID: other.ID, Ts: 1, Type: "feed", Value: "bf"})
+	s.db.SaveConfig(family.ID, "[]")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	future := time.Now().Add(time.Hour).UnixMilli()
+	s.db.CreateAnnouncement(&Announcement{ID: "a1", FamilyID: family.ID, Message: "hi Ada", ExpiresAt: future})
+	s.db.CreateAnnouncement(&Announcement{ID: "a2", Message: "hi all", ExpiresAt: future})
+
+	post := func(h http.HandlerFunc, path, body string) (int, map[string]any) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.SetPathValue("id", family.ID)
+		req.Header.Set("X-Admin-ID", "admin1")
+		w := httptest.NewRecorder()
+		h(w, req)
+		var resp map[string]any
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	code, resp := post(s.requestErasure, "/admin/families/"+family.ID+"/erase", "")
+	if code != http.StatusOK {
+		t.Fatalf("request: status %d", code)
+	}
+	counts := resp["counts"].(map[string]any)
+	if counts["entries"] != float64(1) || counts["links"] != float64(1) || counts["configs"] != float64(1) {
+		t.Errorf("counts = %v", counts)
+	}
+	if !s.db.EntryExists(family.ID, "e1") {
+		t.Fatal("requesting a token erased data")
+	}
+
+	if code, _ := post(s.confirmErasure, "/admin/families/"+family.ID+"/erase/confirm", `{"token": "1.bad"}`); code != http.StatusBadRequest {
+		t.Errorf("bad token: status %d, want 400", code)
+	}
+	code, receipt := post(s.confirmErasure, "/admin/families/"+family.ID+"/erase/confirm", `{"token": "`+resp["token"].(string)+`"}`)
+	if code != http.StatusOK || receipt["admin_id"] != "admin1" {
+		t.Fatalf("confirm: %d %v", code, receipt)
+	}
+
+	if s.db.EntryExists(family.ID, "e1") || !s.db.EntryExists(other.ID, "e2") {
+		t.Error("wrong entries erased")
+	}
+	if _, err := s.db.ValidateAccessLink(link.Token); err == nil {
+		t.Error("access link survived erasure")
+	}
+	if got, _ := s.db.ActiveAnnouncements(family.ID, time.Now().UnixMilli()); len(got) != 1 || got[0].ID != "a2" {
+		t.Errorf("announcements after erasure = %+v", got)
+	}
+	if f, _ := s.db.GetFamily(family.ID); f.Name != erasedFamilyName || f.Notes != "" || !f.Archived {
+		t.Errorf("family after erasure = %+v", f)
+	}
+	erasures, _ := s.db.ListErasures(family.ID)
+	if len(erasures) != 1 || erasures[0].Counts.Entries != 1 || erasures[0].ID != receipt["id"] {
+		t.Errorf("receipts = %+v", erasures)
+	}
+}
@@ -0,0 +1,94 @@
+package babytrack
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The families export is for records kept outside the server and for
+// access audits: every family, archived ones included, with its stats and
+// one row per unexpired access link, so a spreadsheet shows who can get at
+// what. Families without links get a single row with the link columns
+// empty. Times are UTC RFC 3339; tokens aren't stored, so only link IDs
+// (token hashes) appear.
+
+var familiesCSVHeader = []string{
+	"family_id", "family_name", "org_id", "archived", "created_at",
+	"entry_count", "latest_activity", "link_count",
+	"link_id", "link_label", "link_role", "link_created_at", "link_expires_at",
+	"link_last_seen_at", "link_last_entry_at", "can_delete", "can_edit_config", "can_export",
+}
+
+// csvTime formats a ms timestamp for the export; 0 is empty.
+func csvTime(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+}
+
+func csvTimePtr(ms *int64) string {
+	if ms == nil {
+		return ""
+	}
+	return csvTime(*ms)
+}
+
+// csvText keeps names and labels from being read as formulas by
+// spreadsheets.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// exportFamiliesCSV handles GET /admin/export/families.csv (an org
+// admin's: only their org's families).
+func (s *Server) exportFamiliesCSV(w http.ResponseWriter, r *http.Request) {
+	families, err := s.familiesWithStats(true, adminOrg(r))
+	if err != nil {
+		serverError(w, "failed to list families", err)
+		return
+	}
+	now := time.Now()
+	rows := [][]string{familiesCSVHeader}
+	for _, f := range families {
+		links, err := s.db.ListAccessLinks(f.ID)
+		if err != nil {
+			serverError(w, "failed to list access links", err)
+			return
+		}
+		family := []string{
+			f.ID, csvText(f.Name), f.OrgID, strconv.FormatBool(f.Archived), csvTime(f.CreatedAt),
+			strconv.Itoa(f.EntryCount), csvTime(f.LatestActivity), strconv.Itoa(f.LinkCount),
+		}
+		n := len(rows)
+		for _, l := range links {
+			if l.ExpiresAt != nil && *l.ExpiresAt <= now.UnixMilli() {
+				continue
+			}
+			rows = append(rows, append(family[:len(family):len(family)],
+				l.ID, csvText(l.Label), l.Role, csvTime(l.CreatedAt), csvTimePtr(l.ExpiresAt),
+				csvTimePtr(l.LastSeenAt), csvTimePtr(l.LastEntryAt),
+				strconv.FormatBool(l.CanDelete), strconv.FormatBool(l.CanEditConfig), strconv.FormatBool(l.CanExport),
+			))
+		}
+		if len(rows) == n {
+			rows = append(rows, append(family, make([]string, len(familiesCSVHeader)-len(family))...))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="babytrack-families-%s.csv"`, now.UTC().Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	if err := csv.NewWriter(w).WriteAll(rows); err != nil {
+		// Headers are sent; the client gets a truncated file
+		slog.Error("failed to write families export", "error", err)
+	}
+}
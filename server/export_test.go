@@ -0,0 +1,76 @@
+package babytrack
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExportFamiliesCSV(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	mux := s.routes()
+
+	org, _ := s.db.CreateOrg("Daycare")
+	linked, _ := s.db.CreateOrgFamily(org.ID, "=Linked", "")
+	s.db.CreateAccessLink(linked.ID, "Mum", nil)
+	s.db.CreateAccessLinkRole(linked.ID, "Grandma", roleSummary, nil)
+	expired := time.Now().Add(-time.Hour).UnixMilli()
+	s.db.CreateAccessLink(linked.ID, "Old", &expired)
+	bare, _ := s.db.CreateFamily("Bare", "")
+	archived := true
+	s.db.UpdateFamily(bare.ID, nil, nil, &archived)
+
+	admin, _ := s.db.CreateOrgAdmin(org.ID, "doula", "password1")
+	orgToken, _ := s.db.CreateAdminSession(admin.ID, time.Hour)
+	serverToken, _ := s.db.CreateAdminSession("admin", time.Hour)
+	export := func(token string) [][]string {
+		req := httptest.NewRequest("GET", "/admin/export/families.csv", nil)
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: token})
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+			t.Fatalf("export: %d %s", w.Code, w.Body)
+		}
+		rows, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	rows := export(serverToken)
+	if len(rows) != 4 || len(rows[0]) != len(familiesCSVHeader) {
+		t.Fatalf("rows = %v", rows)
+	}
+	col := func(row []string, name string) string {
+		for i, h := range familiesCSVHeader {
+			if h == name {
+				return row[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+	labels := map[string]string{}
+	for _, row := range rows[1:] {
+		labels[col(row, "family_name")+"/"+col(row, "link_label")] = col(row, "link_role")
+	}
+	if len(labels) != 3 || labels["'=Linked/Mum"] != roleFull || labels["'=Linked/Grandma"] != roleSummary || labels["Bare/"] != "" {
+		t.Errorf("family/link rows = %v", labels)
+	}
+	for _, row := range rows[1:] {
+		if col(row, "family_id") == bare.ID && col(row, "archived") != "true" {
+			t.Errorf("bare row = %v", row)
+		}
+		if col(row, "family_id") == linked.ID && col(row, "link_count") != "2" {
+			t.Errorf("linked row = %v", row)
+		}
+	}
+
+	if rows := export(orgToken); len(rows) != 3 || col(rows[1], "family_id") != linked.ID {
+		t.Errorf("org admin rows = %v", rows)
+	}
+}
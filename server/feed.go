@@ -0,0 +1,101 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Feed volumes: a "feed" entry's data may carry a FeedData volume or an
+// EntryValue amount in ml or oz, and older or free-text entries may give
+// one in the value instead ("120ml", "4 oz"). Feeds with none, such as
+// breastfeeds, count as feeds but not towards intake.
+
+const (
+	mlPerOz   = 29.5735
+	maxFeedML = 1000
+)
+
+// FeedData is the structured payload of a "feed" entry, alongside the
+// EntryValue fields.
+type FeedData struct {
+	VolumeML float64 `json:"volume_ml"`
+}
+
+func validateFeedData(e *Entry) error {
+	var f FeedData
+	if err := json.Unmarshal(e.Data, &f); err != nil {
+		return errors.New("feed data: " + err.Error())
+	}
+	if f.VolumeML < 0 || f.VolumeML > maxFeedML {
+		return errors.New("feed volume out of range")
+	}
+	return nil
+}
+
+// volumeML converts an amount in ml or oz to millilitres.
+func volumeML(amount float64, unit string) (float64, bool) {
+	switch unit {
+	case "ml":
+	case "oz":
+		amount *= mlPerOz
+	default:
+		return 0, false
+	}
+	return amount, amount > 0 && amount <= maxFeedML
+}
+
+// parseVolumeML reads a volume such as "120ml" or "4oz" as millilitres.
+func parseVolumeML(s string) (float64, bool) {
+	amount, unit, ok := parseQuantity(s)
+	if !ok {
+		return 0, false
+	}
+	return volumeML(amount, unit)
+}
+
+// feedVolumeML returns the volume of a feed entry, from its data or else
+// its value, and whether it has one.
+func feedVolumeML(e *Entry) (float64, bool) {
+	if len(e.Data) > 0 {
+		var f FeedData
+		if json.Unmarshal(e.Data, &f) == nil && f.VolumeML > 0 {
+			return f.VolumeML, true
+		}
+		var v EntryValue
+		if json.Unmarshal(e.Data, &v) == nil && v.Amount != nil {
+			return volumeML(*v.Amount, v.Unit)
+		}
+	}
+	return parseVolumeML(e.Value)
+}
+
+// FeedingSummary totals a day's feeds and the intake of those with a
+// volume.
+type FeedingSummary struct {
+	Feeds    int     `json:"feeds"`
+	Measured int     `json:"measured"` // feeds with a volume
+	TotalML  float64 `json:"total_ml"`
+	AvgML    float64 `json:"avg_ml"` // per measured feed
+}
+
+// feedingSummary summarises the feeds among entries, or returns nil if
+// none has a volume.
+func feedingSummary(entries []Entry) *FeedingSummary {
+	sum := &FeedingSummary{}
+	for i := range entries {
+		e := &entries[i]
+		if e.Type != "feed" {
+			continue
+		}
+		sum.Feeds++
+		if ml, ok := feedVolumeML(e); ok {
+			sum.Measured++
+			sum.TotalML += ml
+		}
+	}
+	if sum.Measured == 0 {
+		return nil
+	}
+	sum.AvgML = sum.TotalML / float64(sum.Measured)
+	return sum
+}
@@ -0,0 +1,56 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseVolumeML(t *testing.T) {
+	for in, want := range map[string]float64{
+		"120ml":   120,
+		"90 mL":   90,
+		"4oz":     4 * mlPerOz,
+		"2.5 oz":  2.5 * mlPerOz,
+		"3 fl oz": 3 * mlPerOz,
+	} {
+		if got, ok := parseVolumeML(in); !ok || math.Abs(got-want) > 0.001 {
+			t.Errorf("parseVolumeML(%q) = %v, %v", in, got, ok)
+		}
+	}
+	for _, in := range []string{"bf", "left", "0ml", "ml", "120", "5000ml"} {
+		if got, ok := parseVolumeML(in); ok {
+			t.Errorf("parseVolumeML(%q) = %v", in, got)
+		}
+	}
+}
+
+func TestFeedingSummary(t *testing.T) {
+	if feedingSummary([]Entry{{Type: "feed", Value: "bf"}}) != nil {
+		t.Error("summary without volumes")
+	}
+	sum := feedingSummary([]Entry{
+		{Type: "feed", Value: "bottle", Data: json.RawMessage(`{"volume_ml":100}`)},
+		{Type: "feed", Value: "60ml"},
+		{Type: "feed", Value: "bf"},
+		{Type: "pump", Value: "left", Data: json.RawMessage(`{"volume_ml":90}`)},
+	})
+	if sum == nil || sum.Feeds != 3 || sum.Measured != 2 || sum.TotalML != 160 || sum.AvgML != 80 {
+		t.Errorf("summary = %+v", sum)
+	}
+}
+
+func TestValidateFeedData(t *testing.T) {
+	for data, ok := range map[string]bool{
+		`{"volume_ml":120}`:  true,
+		`{}`:                 true,
+		`{"volume_ml":-1}`:   false,
+		`{"volume_ml":5000}`: false,
+		`{"volume_ml":"a"}`:  false,
+	} {
+		err := validateEntryData(&Entry{Type: "feed", Value: "bottle", Data: json.RawMessage(data)})
+		if (err == nil) != ok {
+			t.Errorf("%s: %v", data, err)
+		}
+	}
+}
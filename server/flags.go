@@ -0,0 +1,72 @@
+package babytrack
+
+import (
+	"flag"
+	"os"
+	"sync"
+)
+
+// Flags for the settings most often changed on an ad-hoc run, so it
+// doesn't take a pile of exported variables. Each stands in for an
+// environment variable, with precedence: flag, then ENV_FILE (-config),
+// then the environment, then the default. The process environment itself
+// is never changed, so rereading ENV_FILE starts again from it, and a line
+// removed from the file goes back to the environment's value or the
+// default.
+
+var settingFlags = []struct{ name, env, usage string }{
+	{"port", "PORT", "listen on `port` (default 8080)"},
+	{"db", "DB_PATH", "SQLite database `path` (default babytrack.db)"},
+	{"log-level", "LOG_LEVEL", "log `level`, debug or info"},
+	{"config", "ENV_FILE", "`file` of KEY=value settings, reread on SIGHUP"},
+}
+
+// flagSettings are the settings given as flags, by environment variable.
+var flagSettings = map[string]string{}
+
+// defineSettingFlags adds the setting flags to fs.
+func defineSettingFlags(fs *flag.FlagSet) {
+	for _, f := range settingFlags {
+		fs.Func(f.name, f.usage+" ($"+f.env+")", func(v string) error {
+			flagSettings[f.env] = v
+			return nil
+		})
+	}
+}
+
+// fileSettings are the settings last read from ENV_FILE.
+var fileSettings struct {
+	sync.RWMutex
+	vars map[string]string
+}
+
+// setting returns the named setting, as os.Getenv would with the setting
+// flags and ENV_FILE applied.
+func setting(name string) string {
+	if v, ok := flagSettings[name]; ok {
+		return v
+	}
+	fileSettings.RLock()
+	v, ok := fileSettings.vars[name]
+	fileSettings.RUnlock()
+	if ok {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+// loadSettings rereads ENV_FILE, if set. A file that can't be read leaves
+// the settings as they were.
+func loadSettings() error {
+	vars := map[string]string{}
+	if path := setting("ENV_FILE"); path != "" {
+		var err error
+		if vars, err = loadEnvFile(path); err != nil {
+			return err
+		}
+	}
+	fileSettings.Lock()
+	fileSettings.vars = vars
+	fileSettings.Unlock()
+	return nil
+}
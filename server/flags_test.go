@@ -0,0 +1,44 @@
+package babytrack
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSettingFlags(t *testing.T) {
+	env := filepath.Join(t.TempDir(), "babytrack.env")
+	os.WriteFile(env, []byte("PORT=9000\nDB_PATH=/from/file.db\n"), 0o600)
+	for _, name := range []string{"PORT", "DB_PATH", "LOG_LEVEL", "ENV_FILE"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("LOG_LEVEL", "info")
+	t.Setenv("DB_PATH", "/from/env.db")
+	t.Cleanup(func() {
+		clear(flagSettings)
+		fileSettings.vars = nil
+	})
+
+	fs := flag.NewFlagSet("babytrackd", flag.ContinueOnError)
+	defineSettingFlags(fs)
+	if err := fs.Parse([]string{"-config", env, "-db", "/from/flag.db"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flag over file over environment
+	want := map[string]string{"DB_PATH": "/from/flag.db", "PORT": "9000", "LOG_LEVEL": "info", "ENV_FILE": env}
+	for name, v := range want {
+		if got := setting(name); got != v {
+			t.Errorf("%s = %q, want %q", name, got, v)
+		}
+	}
+	// ... and on reload too
+	os.WriteFile(env, []byte("DB_PATH=/changed.db\nLOG_LEVEL=debug\n"), 0o600)
+	if opts := optionsFromEnvFile(); opts.DBPath != "/from/flag.db" || opts.LogLevel != "debug" {
+		t.Errorf("reloaded DBPath = %q, LogLevel = %q", opts.DBPath, opts.LogLevel)
+	}
+}
@@ -0,0 +1,477 @@
+package babytrack
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"babytrackd/pb"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc -I proto --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative babytrack.proto
+
+// The gRPC API (proto/babytrack.proto) is for companion apps and bridges
+// that would rather have typed RPC than speak the WebSocket protocol. It is
+// served on GRPC_PORT, off by default. EntryService calls act as a device
+// on an access link: writes go through the same path as WS entry messages,
+// so permissions, quotas, dose checks and broadcasts all apply, and Sync
+// registers with the hub like a WS client. AdminService covers the family
+// and link admin that integrations need.
+
+const grpcEntryService = "/babytrack.v1.EntryService/"
+
+// newGRPCServer returns a gRPC server with both services registered.
+func (s *Server) newGRPCServer() *grpc.Server {
+	g := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := s.grpcAuth(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := s.grpcAuth(ss.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+		}),
+	)
+	pb.RegisterEntryServiceServer(g, &entryService{s: s})
+	pb.RegisterAdminServiceServer(g, &adminService{s: s})
+	return g
+}
+
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *authedStream) Context() context.Context { return a.ctx }
+
+// grpcAuth checks the call's bearer token: an access link for
+// EntryService, which is added to the context, or an admin session for
+// AdminService, apart from Login.
+func (s *Server) grpcAuth(ctx context.Context, method string) (context.Context, error) {
+	if method == "/babytrack.v1.AdminService/Login" {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if auth := md.Get("authorization"); len(auth) > 0 {
+		token, _ = strings.CutPrefix(auth[0], "Bearer ")
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	if !strings.HasPrefix(method, grpcEntryService) {
+		adminID, err := s.db.ValidateAdminSession(token)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "unauthorized")
+		}
+		// The admin API isn't org-aware, so it's for server admins only
+		if orgID, err := s.db.AdminOrg(adminID); err != nil || orgID != "" {
+			return nil, status.Error(codes.PermissionDenied, "server admins only")
+		}
+		return ctx, nil
+	}
+	link, err := s.db.ValidateAccessLink(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	if link.Role == roleSummary {
+		return nil, status.Error(codes.PermissionDenied, "summary links can't use the entries API")
+	}
+	return context.WithValue(ctx, accessLinkKey, link), nil
+}
+
+// grpcWritable refuses writes during maintenance.
+func (s *Server) grpcWritable() error {
+	if state := s.maintenance.State(); state.Enabled {
+		msg := "server is in maintenance; try again later"
+		if state.Message != "" {
+			msg = state.Message
+		}
+		return status.Error(codes.Unavailable, msg)
+	}
+	return nil
+}
+
+// grpcClient returns a connectionless Client acting for link, whose send
+// channel collects what the server would have sent a WS client.
+func (s *Server) grpcClient(link *AccessLink) *Client {
+	c := &Client{
+		hub:         s.hub,
+		send:        make(chan []byte, 256),
+		familyID:    link.FamilyID,
+		role:        link.Role,
+		linkID:      link.ID,
+		perms:       link.LinkPermissions,
+		platform:    "grpc",
+		protocol:    protocolVersion,
+		connectedAt: time.Now(),
+	}
+	c.setLabel(link.Label)
+	if link.LastEntryAt != nil {
+		c.lastEntryAt.Store(*link.LastEntryAt)
+	}
+	if link.ExpiresAt != nil {
+		c.expiresAt = *link.ExpiresAt
+	}
+	return c
+}
+
+func entryToPB(e *Entry) *pb.Entry {
+	return &pb.Entry{
+		Id:        e.ID,
+		Ts:        e.Ts,
+		Type:      e.Type,
+		Value:     e.Value,
+		Deleted:   e.Deleted,
+		UpdatedAt: e.UpdatedAt,
+		Seq:       e.Seq,
+		DataJson:  string(e.Data),
+		EndedTs:   e.EndedTs,
+		Ongoing:   e.Ongoing,
+		ChildId:   e.ChildID,
+		Author:    e.Author,
+	}
+}
+
+func entryFromPB(e *pb.Entry) Entry {
+	entry := Entry{
+		ID:        e.Id,
+		Ts:        e.Ts,
+		Type:      e.Type,
+		Value:     e.Value,
+		Deleted:   e.Deleted,
+		UpdatedAt: e.UpdatedAt,
+		EndedTs:   e.EndedTs,
+		Ongoing:   e.Ongoing,
+		ChildID:   e.ChildId,
+	}
+	if e.DataJson != "" {
+		entry.Data = json.RawMessage(e.DataJson)
+	}
+	return entry
+}
+
+type entryService struct {
+	pb.UnimplementedEntryServiceServer
+	s *Server
+}
+
+func (es *entryService) ListEntries(ctx context.Context, req *pb.ListEntriesRequest) (*pb.ListEntriesResponse, error) {
+	link := accessLinkFrom(ctx)
+	entries, hasMore, err := es.s.db.GetEntriesSinceCursor(link.FamilyID, req.Cursor, int(req.Limit))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list entries")
+	}
+	resp := &pb.ListEntriesResponse{Cursor: req.Cursor, HasMore: hasMore}
+	for i := range entries {
+		resp.Entries = append(resp.Entries, entryToPB(&entries[i]))
+		resp.Cursor = entries[i].Seq
+	}
+	return resp, nil
+}
+
+func (es *entryService) PutEntry(ctx context.Context, req *pb.PutEntryRequest) (*pb.PutEntryResponse, error) {
+	if err := es.s.grpcWritable(); err != nil {
+		return nil, err
+	}
+	if req.Entry == nil || req.Entry.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "entry id is required")
+	}
+	if req.Entry.DataJson != "" && !json.Valid([]byte(req.Entry.DataJson)) {
+		return nil, status.Error(codes.InvalidArgument, "data_json is not valid JSON")
+	}
+
+	link := accessLinkFrom(ctx)
+	entry := entryFromPB(req.Entry)
+	raw, _ := json.Marshal(entry)
+	action := "add"
+	if es.s.db.EntryExists(link.FamilyID, entry.ID) {
+		action = "update"
+	}
+	c := es.s.grpcClient(link)
+	es.s.handleEntryMessage(c, WSMessage{Type: "entry", Action: action, Entry: raw})
+	seq, err := entryResult(c, entry.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PutEntryResponse{Seq: seq}, nil
+}
+
+func (es *entryService) DeleteEntry(ctx context.Context, req *pb.DeleteEntryRequest) (*pb.DeleteEntryResponse, error) {
+	if err := es.s.grpcWritable(); err != nil {
+		return nil, err
+	}
+	link := accessLinkFrom(ctx)
+	if !es.s.db.EntryExists(link.FamilyID, req.Id) {
+		return nil, status.Error(codes.NotFound, "entry not found")
+	}
+	c := es.s.grpcClient(link)
+	es.s.handleEntryMessage(c, WSMessage{Type: "entry", Action: "delete", ID: req.Id})
+	seq, err := entryResult(c, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DeleteEntryResponse{Seq: seq}, nil
+}
+
+// entryResult reads the ack or rejection handleEntryMessage sent c for
+// entry id, as a seq or a gRPC status.
+func entryResult(c *Client, id string) (int64, error) {
+	for {
+		select {
+		case msg := <-c.send:
+			var m struct {
+				Type    string `json:"type"`
+				ID      string `json:"id"`
+				Seq     int64  `json:"seq"`
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			}
+			if json.Unmarshal(msg, &m) != nil || m.ID != id {
+				continue
+			}
+			switch m.Type {
+			case "entry_ack":
+				return m.Seq, nil
+			case "entry_rejected":
+				if m.Message == "" {
+					m.Message = m.Reason
+				}
+				switch m.Reason {
+				case "forbidden":
+					return 0, status.Error(codes.PermissionDenied, m.Message)
+				case "quota_exceeded":
+					return 0, status.Error(codes.ResourceExhausted, m.Message)
+				case "out_of_bounds":
+					return 0, status.Error(codes.InvalidArgument, m.Message)
+				}
+				return 0, status.Error(codes.FailedPrecondition, m.Message)
+			}
+		default:
+			return 0, status.Error(codes.Internal, "entry not saved")
+		}
+	}
+}
+
+func (es *entryService) Sync(req *pb.SyncRequest, stream grpc.ServerStreamingServer[pb.SyncEvent]) error {
+	s := es.s
+	link := accessLinkFrom(stream.Context())
+	c := s.grpcClient(link)
+	if err := s.hub.Register(c); err != nil {
+		if errors.Is(err, ErrTooManyConnections) {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return status.Error(codes.Internal, "failed to register")
+	}
+	defer func() {
+		s.hub.Unregister(c)
+		s.db.TouchAccessLink(c.linkID, time.Now().UnixMilli())
+	}()
+	s.db.TouchAccessLink(c.linkID, c.connectedAt.UnixMilli())
+
+	// Registered first, so nothing is missed between the backlog and live
+	// changes; an entry in both is sent twice.
+	cursor := req.Cursor
+	for {
+		entries, hasMore, err := s.db.GetEntriesSinceCursor(c.familyID, cursor, 0)
+		if err != nil {
+			return status.Error(codes.Internal, "failed to list entries")
+		}
+		for i := range entries {
+			if err := stream.Send(&pb.SyncEvent{Event: &pb.SyncEvent_Entry{Entry: entryToPB(&entries[i])}}); err != nil {
+				return err
+			}
+			cursor = entries[i].Seq
+		}
+		if !hasMore {
+			break
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case msg := <-c.send:
+			if msg == nil {
+				// Sentinel from disconnect
+				if c.closeCode == closeSessionRevoked {
+					return status.Error(codes.Unauthenticated, c.closeReason)
+				}
+				return status.Error(codes.Unavailable, c.closeReason)
+			}
+			ev := syncEvent(msg)
+			if ev == nil {
+				continue
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// syncEvent converts an entry or config broadcast to a SyncEvent, or
+// returns nil for other messages.
+func syncEvent(msg []byte) *pb.SyncEvent {
+	var m struct {
+		Type    string          `json:"type"`
+		Action  string          `json:"action"`
+		Entry   *Entry          `json:"entry"`
+		ID      string          `json:"id"`
+		Seq     int64           `json:"seq"`
+		ChildID string          `json:"child_id"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(msg, &m) != nil {
+		return nil
+	}
+	switch {
+	case m.Type == "entry" && m.Action == "delete":
+		return &pb.SyncEvent{Event: &pb.SyncEvent_Deleted{Deleted: &pb.Deletion{Id: m.ID, Seq: m.Seq, ChildId: m.ChildID}}}
+	case m.Type == "entry" && m.Entry != nil:
+		return &pb.SyncEvent{Event: &pb.SyncEvent_Entry{Entry: entryToPB(m.Entry)}}
+	case m.Type == "config":
+		// Config is broadcast as the JSON string clients sent
+		var data string
+		if json.Unmarshal(m.Data, &data) != nil {
+			data = string(m.Data)
+		}
+		return &pb.SyncEvent{Event: &pb.SyncEvent_ConfigJson{ConfigJson: data}}
+	}
+	return nil
+}
+
+type adminService struct {
+	pb.UnimplementedAdminServiceServer
+	s *Server
+}
+
+// Login returns an admin session token for the other AdminService calls.
+func (as *adminService) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	admin, err := as.s.db.GetAdminByUsername(req.Username)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(req.Password)); err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+	const ttl = 24 * time.Hour
+	token, err := as.s.db.CreateAdminSession(admin.ID, ttl)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create session")
+	}
+	return &pb.LoginResponse{Token: token, ExpiresAt: time.Now().Add(ttl).UnixMilli()}, nil
+}
+
+func familyToPB(f *Family) *pb.Family {
+	return &pb.Family{Id: f.ID, Name: f.Name, Notes: f.Notes, CreatedAt: f.CreatedAt, Archived: f.Archived}
+}
+
+func (as *adminService) ListFamilies(ctx context.Context, req *pb.ListFamiliesRequest) (*pb.ListFamiliesResponse, error) {
+	families, err := as.s.db.ListFamilies(req.IncludeArchived)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list families")
+	}
+	resp := &pb.ListFamiliesResponse{}
+	for i := range families {
+		resp.Families = append(resp.Families, familyToPB(&families[i]))
+	}
+	return resp, nil
+}
+
+func (as *adminService) GetFamily(ctx context.Context, req *pb.GetFamilyRequest) (*pb.Family, error) {
+	family, err := as.s.db.GetFamily(req.Id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, "family not found")
+	}
+	return familyToPB(family), nil
+}
+
+func (as *adminService) CreateFamily(ctx context.Context, req *pb.CreateFamilyRequest) (*pb.Family, error) {
+	if err := as.s.grpcWritable(); err != nil {
+		return nil, err
+	}
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	family, err := as.s.db.CreateFamily(req.Name, req.Notes)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create family")
+	}
+	return familyToPB(family), nil
+}
+
+func (as *adminService) CreateAccessLink(ctx context.Context, req *pb.CreateAccessLinkRequest) (*pb.AccessLink, error) {
+	if err := as.s.grpcWritable(); err != nil {
+		return nil, err
+	}
+	role := req.Role
+	if role == "" {
+		role = roleFull
+	}
+	if !linkRoles[role] {
+		return nil, status.Error(codes.InvalidArgument, "role must be full or summary")
+	}
+	if _, err := as.s.db.GetFamily(req.FamilyId); err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "family not found")
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get family")
+	}
+	if err := as.s.checkLinkQuota(req.FamilyId); err != nil {
+		if qe, ok := err.(*QuotaError); ok {
+			return nil, status.Error(codes.ResourceExhausted, qe.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to check link quota")
+	}
+
+	link, err := as.s.db.CreateAccessLinkWith(req.FamilyId, req.Label, role, allPermissions, req.ExpiresAt)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to create access link")
+	}
+	return &pb.AccessLink{
+		Id:        link.ID,
+		Token:     link.Token,
+		FamilyId:  link.FamilyID,
+		Label:     link.Label,
+		Role:      link.Role,
+		ExpiresAt: link.ExpiresAt,
+		CreatedAt: link.CreatedAt,
+	}, nil
+}
+
+// serveGRPC serves the gRPC API on port in the background. The returned
+// func stops it once in-flight calls finish; Sync streams end when the hub
+// closes its clients.
+func (s *Server) serveGRPC(port string) (stop func(), err error) {
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	g := s.newGRPCServer()
+	slog.Info("grpc listening", "addr", ln.Addr().String())
+	go func() {
+		if err := g.Serve(ln); err != nil {
+			slog.Error("grpc server error", "error", err)
+		}
+	}()
+	return g.GracefulStop, nil
+}
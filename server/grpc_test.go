@@ -0,0 +1,164 @@
+package babytrack
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"babytrackd/pb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func setupGRPC(t *testing.T) (*Server, *grpc.ClientConn) {
+	t.Helper()
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := &Server{db: db, hub: NewHub(db)}
+
+	ln := bufconn.Listen(1 << 20)
+	g := s.newGRPCServer()
+	go g.Serve(ln)
+	t.Cleanup(g.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, conn
+}
+
+func bearer(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPCEntries(t *testing.T) {
+	s, conn := setupGRPC(t)
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Bridge", nil)
+	summary, _ := s.db.CreateAccessLinkRole(family.ID, "Grandma", roleSummary, nil)
+	entries := pb.NewEntryServiceClient(conn)
+	ctx := bearer(link.Token)
+
+	if _, err := entries.ListEntries(context.Background(), &pb.ListEntriesRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("no token: %v", err)
+	}
+	if _, err := entries.ListEntries(bearer(summary.Token), &pb.ListEntriesRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("summary link: %v", err)
+	}
+
+	syncCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := entries.Sync(syncCtx, &pb.SyncRequest{})
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(s.hub.ConnectionCounts()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond) // until Sync has registered
+	}
+
+	ts := time.Now().UnixMilli()
+	put, err := entries.PutEntry(ctx, &pb.PutEntryRequest{Entry: &pb.Entry{Id: "e1", Ts: ts, Type: "feed", Value: "bf"}})
+	if err != nil || put.Seq == 0 {
+		t.Fatalf("put: %v %v", put, err)
+	}
+	ev, err := stream.Recv()
+	if err != nil || ev.GetEntry().GetId() != "e1" || ev.GetEntry().GetAuthor() != "Bridge" {
+		t.Fatalf("sync event: %v %v", ev, err)
+	}
+
+	list, err := entries.ListEntries(ctx, &pb.ListEntriesRequest{})
+	if err != nil || len(list.Entries) != 1 || list.Cursor != put.Seq || list.HasMore {
+		t.Fatalf("list: %v %v", list, err)
+	}
+
+	del, err := entries.DeleteEntry(ctx, &pb.DeleteEntryRequest{Id: "e1"})
+	if err != nil || del.Seq <= put.Seq {
+		t.Fatalf("delete: %v %v", del, err)
+	}
+	if ev, err := stream.Recv(); err != nil || ev.GetDeleted().GetId() != "e1" {
+		t.Errorf("sync delete: %v %v", ev, err)
+	}
+	if _, err := entries.DeleteEntry(ctx, &pb.DeleteEntryRequest{Id: "nope"}); status.Code(err) != codes.NotFound {
+		t.Errorf("delete missing: %v", err)
+	}
+
+	// A resumed Sync starts with the backlog
+	resumed, err := entries.Sync(syncCtx, &pb.SyncRequest{Cursor: put.Seq})
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if ev, err := resumed.Recv(); err != nil || !ev.GetEntry().GetDeleted() {
+		t.Errorf("backlog: %v %v", ev, err)
+	}
+
+	// Link permissions and maintenance apply
+	s.db.SetLinkPermissions(link.ID, LinkPermissions{CanEditConfig: true, CanExport: true})
+	if _, err := entries.DeleteEntry(ctx, &pb.DeleteEntryRequest{Id: "e1"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("delete without permission: %v", err)
+	}
+	s.maintenance.Set(MaintenanceState{Enabled: true})
+	if _, err := entries.PutEntry(ctx, &pb.PutEntryRequest{Entry: &pb.Entry{Id: "e2", Ts: ts, Type: "feed"}}); status.Code(err) != codes.Unavailable {
+		t.Errorf("put in maintenance: %v", err)
+	}
+	s.maintenance.Set(MaintenanceState{})
+
+	if _, err := entries.PutEntry(ctx, &pb.PutEntryRequest{Entry: &pb.Entry{Id: "e2", Ts: ts, Type: "feed", DataJson: "{"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad data: %v", err)
+	}
+}
+
+func TestGRPCAdmin(t *testing.T) {
+	s, conn := setupGRPC(t)
+	s.db.EnsureAdmin("admin", "secret")
+	admin := pb.NewAdminServiceClient(conn)
+
+	if _, err := admin.Login(context.Background(), &pb.LoginRequest{Username: "admin", Password: "wrong"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("bad password: %v", err)
+	}
+	login, err := admin.Login(context.Background(), &pb.LoginRequest{Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	ctx := bearer(login.Token)
+
+	if _, err := admin.ListFamilies(bearer("nope"), &pb.ListFamiliesRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("bad session: %v", err)
+	}
+	family, err := admin.CreateFamily(ctx, &pb.CreateFamilyRequest{Name: "Ada"})
+	if err != nil {
+		t.Fatalf("create family: %v", err)
+	}
+	if got, err := admin.GetFamily(ctx, &pb.GetFamilyRequest{Id: family.Id}); err != nil || got.Name != "Ada" {
+		t.Errorf("get family: %v %v", got, err)
+	}
+	if list, err := admin.ListFamilies(ctx, &pb.ListFamiliesRequest{}); err != nil || len(list.Families) != 1 {
+		t.Errorf("list families: %v %v", list, err)
+	}
+
+	link, err := admin.CreateAccessLink(ctx, &pb.CreateAccessLinkRequest{FamilyId: family.Id, Label: "Bridge"})
+	if err != nil || link.Role != roleFull {
+		t.Fatalf("create link: %v %v", link, err)
+	}
+	if l, err := s.db.ValidateAccessLink(link.Token); err != nil || l.FamilyID != family.Id {
+		t.Errorf("new link doesn't validate: %v", err)
+	}
+	if _, err := admin.CreateAccessLink(ctx, &pb.CreateAccessLinkRequest{FamilyId: family.Id, Role: "owner"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad role: %v", err)
+	}
+	if _, err := admin.CreateAccessLink(ctx, &pb.CreateAccessLinkRequest{FamilyId: "nope"}); status.Code(err) != codes.NotFound {
+		t.Errorf("missing family: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Clients that connect with ?hello=1 send a hello before anything else:
+//
+//	{"type":"hello","protocol_version":1,"app_version":"0.1.0","cursor":42,"encodings":["cbor","json"],"client_time":1700000000000}
+//
+// The server answers with its own hello, carrying the protocol version the
+// connection will use (the lower of the two) and the frame encoding (the
+// first of the client's it supports; see cbor.go), then init. With a cursor,
+// init only carries entries changed since it, instead of the whole history.
+// Clients without ?hello=1 get init straight away, as before.
+
+const (
+	// minProtocolVersion is the oldest client protocol still served.
+	minProtocolVersion = 1
+
+	helloTimeout = 10 * time.Second
+
+	// maxResumeEntries caps a resumed init; further behind than this gets
+	// the full history instead.
+	maxResumeEntries = 1000
+
+	closeProtocolUnsupported = 4003
+)
+
+type helloMessage struct {
+	Type            string   `json:"type"`
+	ProtocolVersion int      `json:"protocol_version"`
+	AppVersion      string   `json:"app_version"`
+	Cursor          int64    `json:"cursor"`
+	Encodings       []string `json:"encodings"`   // in order of preference
+	ClientTime      int64    `json:"client_time"` // the client's clock, ms; see skew.go
+}
+
+var errNoHello = errors.New("no hello before timeout")
+
+// readHello reads the client's first message. If it isn't a hello the
+// client is treated as one without the handshake, and the message is
+// returned for normal handling.
+func readHello(conn *websocket.Conn) (*helloMessage, []byte, error) {
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	typ, msg, err := conn.ReadMessage()
+	if err != nil {
+		if ne, ok := err.(interface{ Timeout() bool }); ok && ne.Timeout() {
+			return nil, nil, errNoHello
+		}
+		return nil, nil, err
+	}
+	if typ == websocket.BinaryMessage {
+		if msg, err = cborToJSON(msg); err != nil {
+			return nil, nil, err
+		}
+	}
+	var hello helloMessage
+	if json.Unmarshal(msg, &hello) != nil || hello.Type != "hello" {
+		return nil, msg, nil
+	}
+	return &hello, nil, nil
+}
+
+// negotiateProtocol returns the protocol version to use with a client that
+// speaks up to clientVersion, or 0 if it is too old.
+func negotiateProtocol(clientVersion int) int {
+	v := min(clientVersion, protocolVersion)
+	if v < minProtocolVersion {
+		return 0
+	}
+	return v
+}
+
+// negotiateEncoding returns the first of the client's encodings the server
+// supports, or JSON.
+func negotiateEncoding(encodings []string) string {
+	for _, e := range encodings {
+		if e == encodingCBOR || e == encodingJSON {
+			return e
+		}
+	}
+	return encodingJSON
+}
+
+// sendHello answers a client's hello.
+func (c *Client) sendHello() {
+	msg, _ := json.Marshal(map[string]any{
+		"type":             "hello",
+		"protocol_version": c.protocol,
+		"server_version":   version,
+		"encoding":         c.encoding,
+	})
+	c.send <- msg
+}
+
+// AppVersions counts connected clients by the app version they reported in
+// hello, "unknown" for clients without one.
+func (h *Hub) AppVersions() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	counts := map[string]int{}
+	for _, clients := range h.families {
+		for c := range clients {
+			v := c.appVersion
+			if v == "" {
+				v = "unknown"
+			}
+			counts[v]++
+		}
+	}
+	return counts
+}
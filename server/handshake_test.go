@@ -0,0 +1,99 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	for client, want := range map[int]int{
+		protocolVersion:     protocolVersion,
+		protocolVersion + 5: protocolVersion,
+		0:                   0,
+	} {
+		if got := negotiateProtocol(client); got != want {
+			t.Errorf("negotiateProtocol(%d) = %d, want %d", client, got, want)
+		}
+	}
+}
+
+func TestHelloHandshake(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	now := time.Now().UnixMilli()
+	old := &Entry{ID: "old", FamilyID: family.ID, Ts: now, Type: "feed", Value: "bf"}
+	db.UpsertEntry(old)
+	db.UpsertEntry(&Entry{ID: "new", FamilyID: family.ID, Ts: now, Type: "feed", Value: "bottle"})
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	dial := func(query string) *websocket.Conn {
+		header := http.Header{"Cookie": {"client_session=" + link.Token}}
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+query, header)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return conn
+	}
+
+	// Resuming from a cursor only gets what changed since
+	conn := dial("?hello=1")
+	defer conn.Close()
+	conn.WriteJSON(map[string]any{"type": "hello", "protocol_version": protocolVersion, "app_version": "9.9.9", "cursor": old.Seq})
+	if m := skipUntilType(t, conn, "hello"); m["protocol_version"] != float64(protocolVersion) || m["server_version"] != version {
+		t.Errorf("hello = %v", m)
+	}
+	init := skipUntilType(t, conn, "init")
+	entries := init["entries"].([]any)
+	if len(entries) != 1 || entries[0].(map[string]any)["id"] != "new" || init["resumed_from"] != float64(old.Seq) {
+		t.Errorf("resumed init = %v", init)
+	}
+	if v := s.hub.AppVersions(); v["9.9.9"] != 1 {
+		t.Errorf("app versions = %v", v)
+	}
+
+	// A client asking for the handshake but opening with something else is
+	// served as before, and that message still handled
+	legacy := dial("?hello=1")
+	defer legacy.Close()
+	legacy.WriteJSON(map[string]any{"type": "ping"})
+	if init := skipUntilType(t, legacy, "init"); len(init["entries"].([]any)) != 2 {
+		t.Errorf("legacy init = %v", init)
+	}
+	skipUntilType(t, legacy, "pong")
+	if v := s.hub.AppVersions(); v["unknown"] != 1 {
+		t.Errorf("app versions = %v", v)
+	}
+
+	// Clients without the handshake can resume from the URL
+	byURL := dial("?cursor=" + strconv.FormatInt(old.Seq, 10))
+	defer byURL.Close()
+	if init := skipUntilType(t, byURL, "init"); init["resumed_from"] != float64(old.Seq) || len(init["entries"].([]any)) != 1 {
+		t.Errorf("init resumed from the URL = %v", init)
+	}
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	if _, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?cursor=-1", header); err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("negative cursor: %v", err)
+	}
+
+	// Too old
+	tooOld := dial("?hello=1")
+	defer tooOld.Close()
+	tooOld.WriteJSON(map[string]any{"type": "hello", "protocol_version": 0})
+	tooOld.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := tooOld.ReadMessage(); !websocket.IsCloseError(err, closeProtocolUnsupported) {
+		t.Errorf("too old: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package babytrack
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readiness tracks whether the server should receive traffic. The zero value
+// is "not started".
+type readiness struct {
+	mu      sync.RWMutex
+	started bool   // startup (migrations, bootstrap) finished
+	reason  string // why we're not ready: starting, migrating, restoring, draining
+}
+
+// Set marks the server not ready for the given reason; "" marks it ready.
+func (r *readiness) Set(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reason = reason
+}
+
+// MarkStarted records that startup finished and the server is ready.
+func (r *readiness) MarkStarted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = true
+	r.reason = ""
+}
+
+func (r *readiness) State() (started bool, reason string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.started, r.reason
+}
+
+// handleLive reports that the process is up; it never touches dependencies.
+func handleLive(w http.ResponseWriter, r *http.Request) {
+	jsonOK(w, map[string]bool{"ok": true})
+}
+
+// handleReadyz reports whether the server should receive traffic.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	started, reason := s.ready.State()
+	if !started && reason == "" {
+		reason = "starting"
+	}
+	if reason != "" {
+		jsonResponse(w, http.StatusServiceUnavailable, map[string]any{"ok": false, "reason": reason})
+		return
+	}
+	jsonOK(w, map[string]bool{"ok": true})
+}
+
+// handleStartupz succeeds once startup has finished, regardless of later
+// readiness changes, so orchestrators can give slow migrations time.
+func (s *Server) handleStartupz(w http.ResponseWriter, r *http.Request) {
+	if started, reason := s.ready.State(); !started {
+		jsonResponse(w, http.StatusServiceUnavailable, map[string]any{"ok": false, "reason": reason})
+		return
+	}
+	jsonOK(w, map[string]bool{"ok": true})
+}
+
+// startupGate answers 503 for everything except probes until startup has
+// finished, since handlers need the database.
+func (s *Server) startupGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if started, reason := s.ready.State(); !started {
+			switch r.URL.Path {
+			case "/livez", "/readyz", "/startupz", "/health":
+			default:
+				w.Header().Set("Retry-After", "5")
+				jsonError(w, http.StatusServiceUnavailable, errCodeUnavailable, "server is "+strings.TrimSpace(reason))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Health thresholds; a zero value disables the corresponding check.
+type healthLimits struct {
+	maxWALBytes  int64
+	minFreeBytes int64
+}
+
+// handleReadyHealth is the deep health check: it verifies the database,
+// WAL size, free disk space and Hub state, returning 503 with per-check
+// details when anything is degraded. The WAL and disk checks are left out
+// for stores without a database file.
+func (s *Server) handleReadyHealth(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]map[string]any{
+		"db":  s.checkDB(r.Context()),
+		"hub": s.checkHub(),
+	}
+	if s.db.Path() != "" {
+		checks["wal"] = s.checkWAL()
+		checks["disk"] = s.checkDisk()
+	}
+
+	ok := true
+	for _, c := range checks {
+		ok = ok && c["ok"] == true
+	}
+
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	jsonResponse(w, status, map[string]any{
+		"ok":      ok,
+		"version": version,
+		"checks":  checks,
+	})
+}
+
+func (s *Server) checkDB(ctx context.Context) map[string]any {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := s.db.Ready(ctx); err != nil {
+		return map[string]any{"ok": false, "error": err.Error()}
+	}
+	return map[string]any{"ok": true, "latency_ms": time.Since(start).Milliseconds()}
+}
+
+func (s *Server) checkWAL() map[string]any {
+	fi, err := os.Stat(s.db.Path() + "-wal")
+	if os.IsNotExist(err) {
+		return map[string]any{"ok": true, "bytes": 0}
+	}
+	if err != nil {
+		return map[string]any{"ok": false, "error": err.Error()}
+	}
+	s.tuning.RLock()
+	limit := s.health.maxWALBytes
+	s.tuning.RUnlock()
+	c := map[string]any{"ok": true, "bytes": fi.Size()}
+	if limit > 0 && fi.Size() > limit {
+		c["ok"] = false
+		c["error"] = "WAL larger than limit; checkpoints may be failing"
+	}
+	return c
+}
+
+func (s *Server) checkDisk() map[string]any {
+	free, err := diskFreeBytes(filepath.Dir(s.db.Path()))
+	if err != nil {
+		return map[string]any{"ok": false, "error": err.Error()}
+	}
+	s.tuning.RLock()
+	limit := s.health.minFreeBytes
+	s.tuning.RUnlock()
+	c := map[string]any{"ok": true, "free_bytes": free}
+	if limit > 0 && free < limit {
+		c["ok"] = false
+		c["error"] = "free disk space below limit"
+	}
+	return c
+}
+
+func (s *Server) checkHub() map[string]any {
+	counts := s.hub.ConnectionCounts()
+	conns := 0
+	for _, n := range counts {
+		conns += n
+	}
+	return map[string]any{"ok": true, "families": len(counts), "connections": conns, "app_versions": s.hub.AppVersions()}
+}
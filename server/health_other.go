@@ -0,0 +1,9 @@
+//go:build !unix
+
+package babytrack
+
+import "errors"
+
+func diskFreeBytes(dir string) (int64, error) {
+	return 0, errors.New("disk space check not supported on this platform")
+}
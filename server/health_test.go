@@ -0,0 +1,113 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyHealth(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/healthz/ready", nil)
+	w := httptest.NewRecorder()
+	s.handleReadyHealth(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		OK     bool                      `json:"ok"`
+		Checks map[string]map[string]any `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	for _, name := range []string{"db", "wal", "disk", "hub"} {
+		if resp.Checks[name]["ok"] != true {
+			t.Errorf("expected %s check ok, got %v", name, resp.Checks[name])
+		}
+	}
+	if resp.Checks["disk"]["free_bytes"].(float64) <= 0 {
+		t.Errorf("expected free disk space to be reported, got %v", resp.Checks["disk"])
+	}
+}
+
+func TestReadyHealthDegraded(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// Impossible free-space requirement
+	s.health.minFreeBytes = 1 << 62
+	s.db.(*DB).Close()
+
+	req := httptest.NewRequest("GET", "/healthz/ready", nil)
+	w := httptest.NewRecorder()
+	s.handleReadyHealth(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+
+	var resp struct {
+		OK     bool                      `json:"ok"`
+		Checks map[string]map[string]any `json:"checks"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.OK {
+		t.Error("expected ok=false")
+	}
+	if resp.Checks["db"]["ok"] != false || resp.Checks["disk"]["ok"] != false {
+		t.Errorf("expected db and disk checks to fail, got %v", resp.Checks)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	s := &Server{}
+	handler := s.startupGate(s.routes())
+
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	// Before startup: alive, not ready, and other routes are gated
+	s.ready.Set("migrating")
+	if code := get("/livez"); code != http.StatusOK {
+		t.Errorf("livez: expected 200, got %d", code)
+	}
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz during migration: expected 503, got %d", code)
+	}
+	if code := get("/startupz"); code != http.StatusServiceUnavailable {
+		t.Errorf("startupz during migration: expected 503, got %d", code)
+	}
+	if code := get("/admin/families"); code != http.StatusServiceUnavailable {
+		t.Errorf("gated route during migration: expected 503, got %d", code)
+	}
+
+	s.ready.MarkStarted()
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Errorf("readyz after startup: expected 200, got %d", code)
+	}
+	if code := get("/startupz"); code != http.StatusOK {
+		t.Errorf("startupz after startup: expected 200, got %d", code)
+	}
+
+	// Draining flips readiness but not startup
+	s.ready.Set("draining")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	var resp map[string]any
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusServiceUnavailable || resp["reason"] != "draining" {
+		t.Errorf("readyz while draining: expected 503 draining, got %d %v", w.Code, resp)
+	}
+	if code := get("/startupz"); code != http.StatusOK {
+		t.Errorf("startupz while draining: expected 200, got %d", code)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package babytrack
+
+import "syscall"
+
+// diskFreeBytes returns the space available to unprivileged users on the
+// filesystem containing dir.
+func diskFreeBytes(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,128 @@
+package babytrack
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The heatmap shows when in the week things happen: a day-of-week by hour
+// matrix of how many entries started in each hour and how many minutes of
+// activity fell in it, over the last few weeks in the family's timezone.
+// Blocks are paired as on the timeline, so a night's sleep fills every
+// hour it spans.
+
+const (
+	defaultHeatmapWeeks = 4
+	maxHeatmapWeeks     = 26
+)
+
+type Heatmap struct {
+	Type     string `json:"type,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Weeks    int    `json:"weeks"`
+	Timezone string `json:"timezone"`
+	From     int64  `json:"from"`
+	To       int64  `json:"to"`
+	// Indexed [weekday][hour], Sunday first
+	Counts  [7][24]int `json:"counts"`
+	Minutes [7][24]int `json:"minutes"`
+	Days    [7]int     `json:"days"` // how many of each weekday the window has, for averages
+}
+
+// buildHeatmap covers the weeks up to now, ending with today, in loc. typ
+// and value narrow it to one type and value; for sleep without a value,
+// only time asleep counts.
+func buildHeatmap(db Store, familyID, typ, value string, weeks int, loc *time.Location, now time.Time) (*Heatmap, error) {
+	today := now.In(loc)
+	start := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1-weeks*7)
+	h := &Heatmap{Type: typ, Value: value, Weeks: weeks, Timezone: loc.String(), From: start.UnixMilli(), To: now.UnixMilli()}
+	for d := start; d.Before(now); d = d.AddDate(0, 0, 1) {
+		h.Days[d.Weekday()]++
+	}
+
+	tl, err := buildTimeline(db, familyID, h.From, h.To, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range tl.Items {
+		if typ != "" && item.Type != typ {
+			continue
+		}
+		if value != "" && item.Value != value {
+			continue
+		}
+		if typ == "sleep" && value == "" && item.Kind == "block" && !sleepValues[item.Value] {
+			continue
+		}
+		if item.Start >= h.From {
+			t := time.UnixMilli(item.Start).In(loc)
+			h.Counts[t.Weekday()][t.Hour()]++
+		}
+		if item.Kind != "block" {
+			continue
+		}
+		end := h.To
+		if item.End != nil {
+			end = min(*item.End, h.To)
+		}
+		h.addMinutes(max(item.Start, h.From), end, loc)
+	}
+	return h, nil
+}
+
+// addMinutes spreads the span [from, to) (ms) over the hours it covers.
+func (h *Heatmap) addMinutes(from, to int64, loc *time.Location) {
+	t := time.UnixMilli(from).In(loc)
+	end := time.UnixMilli(to)
+	for t.Before(end) {
+		next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		if next.After(end) {
+			next = end
+		}
+		h.Minutes[t.Weekday()][t.Hour()] += int(next.Sub(t) / time.Minute)
+		t = next.In(loc)
+	}
+}
+
+// heatmapReport writes the heatmap for ?weeks=&type=&value= in the
+// family's timezone.
+func (s *Server) heatmapReport(w http.ResponseWriter, r *http.Request, familyID string) {
+	q := r.URL.Query()
+	weeks := defaultHeatmapWeeks
+	if v := q.Get("weeks"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHeatmapWeeks {
+			validationError(w, map[string]string{"weeks": "must be between 1 and " + strconv.Itoa(maxHeatmapWeeks)})
+			return
+		}
+		weeks = n
+	}
+
+	settings, err := s.db.GetFamilySettings(familyID)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to load family settings", err)
+		return
+	}
+	h, err := buildHeatmap(s.db, familyID, q.Get("type"), q.Get("value"), weeks, settings.Location(), time.Now())
+	if err != nil {
+		serverError(w, "failed to build heatmap", err)
+		return
+	}
+	jsonOK(w, h)
+}
+
+// handleHeatmap serves GET /api/v1/analytics/heatmap for the caller's family.
+func (s *Server) handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	s.heatmapReport(w, r, accessLinkFrom(r.Context()).FamilyID)
+}
+
+// adminHeatmap serves GET /admin/families/{id}/analytics/heatmap.
+func (s *Server) adminHeatmap(w http.ResponseWriter, r *http.Request) {
+	s.heatmapReport(w, r, r.PathValue("id"))
+}
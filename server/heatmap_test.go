@@ -0,0 +1,90 @@
+package babytrack
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHeatmap(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+
+	loc, _ := time.LoadLocation("Australia/Sydney")
+	at := func(day, hour, min int) time.Time { return time.Date(2025, 6, day, hour, min, 0, 0, loc) }
+	add := func(ts time.Time, typ, value string) {
+		e := &Entry{ID: generateToken(8), FamilyID: family.ID, Ts: ts.UnixMilli(), Type: typ, Value: value}
+		if err := db.UpsertEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Tue 10 June: asleep 19:30 to 01:15, then awake. Wed 11: two feeds at 6am.
+	add(at(10, 19, 30), "sleep", "sleeping")
+	add(at(11, 1, 15), "sleep", "awake")
+	add(at(11, 6, 5), "feed", "bf")
+	add(at(11, 6, 40), "feed", "bf")
+	// Before the window
+	add(at(1, 6, 0), "feed", "bf")
+
+	now := at(12, 9, 0) // Thursday
+	h, err := buildHeatmap(db, family.ID, "sleep", "", 1, loc, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tue, wed := time.Tuesday, time.Wednesday
+	if h.Counts[tue][19] != 1 || h.Counts[wed][1] != 0 {
+		t.Errorf("sleep counts: tue 19h %d, wed 1h %d", h.Counts[tue][19], h.Counts[wed][1])
+	}
+	if h.Minutes[tue][19] != 30 || h.Minutes[tue][23] != 60 || h.Minutes[wed][1] != 15 || h.Minutes[wed][2] != 0 {
+		t.Errorf("sleep minutes: %v %v", h.Minutes[tue], h.Minutes[wed])
+	}
+	// 6 to 12 June: one of each weekday
+	if h.Days != [7]int{1, 1, 1, 1, 1, 1, 1} {
+		t.Errorf("days = %v", h.Days)
+	}
+
+	h, _ = buildHeatmap(db, family.ID, "feed", "", 1, loc, now)
+	total := 0
+	for _, row := range h.Counts {
+		for _, n := range row {
+			total += n
+		}
+	}
+	if h.Counts[wed][6] != 2 || total != 2 {
+		t.Errorf("feed counts: wed 6h %d, total %d", h.Counts[wed][6], total)
+	}
+
+	// An ongoing sleep runs up to now
+	add(at(12, 7, 0), "sleep", "nap")
+	h, _ = buildHeatmap(db, family.ID, "sleep", "", 1, loc, now)
+	if h.Minutes[time.Thursday][7] != 60 || h.Minutes[time.Thursday][8] != 60 || h.Minutes[time.Thursday][9] != 0 {
+		t.Errorf("ongoing: %v", h.Minutes[time.Thursday])
+	}
+}
+
+func TestHeatmapReportValidation(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+
+	for _, weeks := range []string{"0", "27", "x"} {
+		req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/analytics/heatmap?weeks="+weeks, nil)
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.adminHeatmap(w, req)
+		if w.Code != 400 {
+			t.Errorf("weeks=%s: %d", weeks, w.Code)
+		}
+	}
+	req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/analytics/heatmap", nil)
+	req.SetPathValue("id", family.ID)
+	w := httptest.NewRecorder()
+	s.adminHeatmap(w, req)
+	if w.Code != 200 {
+		t.Errorf("default: %d %s", w.Code, w.Body)
+	}
+}
@@ -1,9 +1,10 @@
-package main
+package babytrack
 
 import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
 )
@@ -34,9 +35,50 @@ func jsonCreated(w http.ResponseWriter, data any) {
 	jsonResponse(w, http.StatusCreated, data)
 }
 
+// Error codes used in the error envelope. Clients switch on these, so treat
+// them as part of the API: add new ones freely but don't rename.
+const (
+	errCodeBadRequest   = "bad_request"
+	errCodeValidation   = "validation_failed"
+	errCodeUnauthorized = "unauthorized"
+	errCodeForbidden    = "forbidden"
+	errCodeNotFound     = "not_found"
+	errCodeConflict     = "conflict"
+	errCodeRateLimited  = "rate_limited"
+	errCodeQuota        = "quota_exceeded"
+	errCodeUnavailable  = "unavailable"
+	errCodeMaintenance  = "maintenance"
+	errCodeInternal     = "internal"
+)
+
+// APIError is the body of every error response, wrapped as {"error": {...}}.
+// Fields maps request field names to per-field problems for validation errors.
+type APIError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// jsonError writes an error envelope with the given status code.
+func jsonError(w http.ResponseWriter, status int, code, msg string) {
+	jsonResponse(w, status, map[string]APIError{"error": {Code: code, Message: msg}})
+}
+
+// validationError writes a 400 error envelope listing the invalid fields.
+func validationError(w http.ResponseWriter, fields map[string]string) {
+	jsonResponse(w, http.StatusBadRequest, map[string]APIError{"error": {
+		Code:    errCodeValidation,
+		Message: "invalid request fields",
+		Fields:  fields,
+	}})
+}
+
 // serverError logs the error and returns a generic 500 response.
 // Use this for unexpected errors that shouldn't expose details to clients.
 func serverError(w http.ResponseWriter, msg string, err error) {
 	slog.Error(msg, "error", err)
-	http.Error(w, "internal error", http.StatusInternalServerError)
+	if lrw, ok := w.(*loggingResponseWriter); ok {
+		lrw.errMsg = fmt.Sprintf("%s: %v", msg, err)
+	}
+	jsonError(w, http.StatusInternalServerError, errCodeInternal, "internal error")
 }
@@ -0,0 +1,261 @@
+package babytrack
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locales for generated reports. Each locale has a message catalog keyed
+// by "type.<type>" and "value.<value>" for entry labels plus a few
+// formatting keys; anything missing falls back to English, then to the raw
+// key. Add a locale by calling registerLocale from an init function.
+
+const defaultLocale = "en"
+
+type Locale struct {
+	Tag      string
+	Messages map[string]string
+	Months   [12]string
+	Weekdays [7]string // Sunday first, as time.Weekday
+}
+
+var locales = map[string]*Locale{}
+
+func registerLocale(l *Locale) {
+	locales[l.Tag] = l
+}
+
+// T returns the message for key, falling back to English and then to
+// fallback.
+func (l *Locale) T(key, fallback string) string {
+	if m, ok := l.Messages[key]; ok {
+		return m
+	}
+	if m, ok := locales[defaultLocale].Messages[key]; ok {
+		return m
+	}
+	return fallback
+}
+
+// TypeLabel and ValueLabel translate entry types and values, leaving
+// custom ones from a family's config as they are.
+func (l *Locale) TypeLabel(typ string) string { return l.T("type."+typ, typ) }
+
+func (l *Locale) ValueLabel(value string) string { return l.T("value."+value, value) }
+
+// FormatDate formats a day using the locale's "date" pattern, in which
+// {weekday}, {day}, {month} and {year} are replaced.
+func (l *Locale) FormatDate(t time.Time) string {
+	return strings.NewReplacer(
+		"{weekday}", l.Weekdays[t.Weekday()],
+		"{day}", strconv.Itoa(t.Day()),
+		"{month}", l.Months[t.Month()-1],
+		"{year}", strconv.Itoa(t.Year()),
+	).Replace(l.T("date", "{weekday} {day} {month} {year}"))
+}
+
+// FormatTime formats a time of day with the locale's Go layout.
+func (l *Locale) FormatTime(t time.Time) string {
+	return t.Format(l.T("time", "15:04"))
+}
+
+// FormatDuration formats minutes as hours and minutes, e.g. "6h 0m".
+func (l *Locale) FormatDuration(mins int) string {
+	return fmt.Sprintf(l.T("duration", "%dh %dm"), mins/60, mins%60)
+}
+
+// resolveLocale picks a report locale: an explicit ?lang= wins, then the
+// family's setting, then the browser's Accept-Language, then English.
+func resolveLocale(r *http.Request, familyLocale string) *Locale {
+	candidates := append([]string{r.URL.Query().Get("lang"), familyLocale}, acceptLanguages(r.Header.Get("Accept-Language"))...)
+	for _, tag := range candidates {
+		if l := lookupLocale(tag); l != nil {
+			return l
+		}
+	}
+	return locales[defaultLocale]
+}
+
+// lookupLocale matches a language tag like "de-AT" to a registered locale
+// by its primary language.
+func lookupLocale(tag string) *Locale {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	base, _, _ = strings.Cut(base, "_")
+	return locales[base]
+}
+
+// acceptLanguages returns the tags of an Accept-Language header, most
+// preferred first.
+func acceptLanguages(header string) []string {
+	type pref struct {
+		tag string
+		q   float64
+	}
+	var prefs []pref
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		prefs = append(prefs, pref{tag, q})
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	tags := make([]string, len(prefs))
+	for i, p := range prefs {
+		tags[i] = p.tag
+	}
+	return tags
+}
+
+func init() {
+	registerLocale(&Locale{
+		Tag: "en",
+		Messages: map[string]string{
+			"date":     "{weekday} {day} {month} {year}",
+			"time":     "15:04",
+			"duration": "%dh %dm",
+
+			"calendar.next_nap":   "Next nap window",
+			"notify.logged":       "%s logged %s",
+			"notify.someone":      "Someone",
+			"notify.feed_due":     "Feed due: last fed %s ago",
+			"summary.nothing":     "Nothing logged",
+			"voice.logged":        "Logged %s",
+			"voice.unmatched":     "Sorry, I didn't catch that. Try saying %s",
+			"voice.no_buttons":    "There are no buttons to log yet",
+			"voice.dose_conflict": "%s was last given at %s",
+
+			"type.feed":   "Feed",
+			"type.sleep":  "Sleep",
+			"type.nappy":  "Nappy",
+			"type.soothe": "Soothe",
+			"type.5s":     "5 S's",
+			"type.pump":   "Pumping",
+			"type.med":    "Medication",
+			"type.temp":   "Temperature",
+			"type.note":   "Note",
+
+			"value.bf":            "Breastfeed",
+			"value.play":          "Play",
+			"value.spew":          "Spew",
+			"value.awake":         "Awake",
+			"value.sleeping":      "Sleeping",
+			"value.wet":           "Wet",
+			"value.dirty":         "Dirty",
+			"value.pram":          "Pram",
+			"value.rocking":       "Rocking",
+			"value.car":           "Car",
+			"value.wearing":       "Wearing",
+			"value.feed-to-sleep": "Feed to sleep",
+			"value.swaddle":       "Swaddle",
+			"value.side-lying":    "Side/stomach",
+			"value.shush":         "Shush",
+			"value.swing":         "Swing",
+			"value.suck":          "Suck",
+			"value.left":          "Left",
+			"value.right":         "Right",
+			"value.both":          "Both",
+		},
+		Months:   [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		Weekdays: [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	})
+
+	registerLocale(&Locale{
+		Tag: "de",
+		Messages: map[string]string{
+			"date":     "{weekday}, {day}. {month} {year}",
+			"duration": "%d Std. %d Min.",
+
+			"calendar.next_nap":   "Nächstes Schläfchen",
+			"notify.logged":       "%s hat %s eingetragen",
+			"notify.someone":      "Jemand",
+			"notify.feed_due":     "Zeit zum Füttern: letzte Mahlzeit vor %s",
+			"summary.nothing":     "Nichts eingetragen",
+			"voice.logged":        "%s eingetragen",
+			"voice.unmatched":     "Das habe ich nicht verstanden. Sag zum Beispiel %s",
+			"voice.no_buttons":    "Es gibt noch keine Knöpfe zum Eintragen",
+			"voice.dose_conflict": "%s wurde zuletzt um %s gegeben",
+
+			"type.feed":   "Mahlzeit",
+			"type.sleep":  "Schlaf",
+			"type.nappy":  "Windel",
+			"type.soothe": "Beruhigen",
+			"type.pump":   "Abpumpen",
+			"type.med":    "Medikament",
+			"type.temp":   "Temperatur",
+			"type.note":   "Notiz",
+
+			"value.bf":       "Stillen",
+			"value.play":     "Spielen",
+			"value.spew":     "Spucken",
+			"value.awake":    "Wach",
+			"value.sleeping": "Schläft",
+			"value.wet":      "Nass",
+			"value.dirty":    "Voll",
+			"value.pram":     "Kinderwagen",
+			"value.rocking":  "Schaukeln",
+			"value.car":      "Auto",
+			"value.wearing":  "Tragen",
+			"value.left":     "Links",
+			"value.right":    "Rechts",
+			"value.both":     "Beide",
+		},
+		Months:   [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		Weekdays: [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+	})
+
+	registerLocale(&Locale{
+		Tag: "fr",
+		Messages: map[string]string{
+			"date":     "{weekday} {day} {month} {year}",
+			"time":     "15h04",
+			"duration": "%d h %d min",
+
+			"calendar.next_nap":   "Prochaine sieste",
+			"notify.logged":       "%s a noté %s",
+			"notify.someone":      "Quelqu'un",
+			"notify.feed_due":     "Repas prévu : dernière tétée il y a %s",
+			"summary.nothing":     "Rien de noté",
+			"voice.logged":        "%s noté",
+			"voice.unmatched":     "Désolé, je n'ai pas compris. Essayez de dire %s",
+			"voice.no_buttons":    "Il n'y a pas encore de boutons",
+			"voice.dose_conflict": "Dernière prise de %s à %s",
+
+			"type.feed":   "Tétée",
+			"type.sleep":  "Sommeil",
+			"type.nappy":  "Couche",
+			"type.soothe": "Apaisement",
+			"type.pump":   "Tire-lait",
+			"type.med":    "Médicament",
+			"type.temp":   "Température",
+			"type.note":   "Note",
+
+			"value.bf":       "Allaitement",
+			"value.play":     "Jeu",
+			"value.spew":     "Régurgitation",
+			"value.awake":    "Éveillé",
+			"value.sleeping": "Endormi",
+			"value.wet":      "Mouillée",
+			"value.dirty":    "Selles",
+			"value.pram":     "Poussette",
+			"value.rocking":  "Bercement",
+			"value.car":      "Voiture",
+			"value.wearing":  "Portage",
+			"value.left":     "Gauche",
+			"value.right":    "Droite",
+			"value.both":     "Les deux",
+		},
+		Months:   [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		Weekdays: [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+	})
+}
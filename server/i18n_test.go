@@ -0,0 +1,80 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResolveLocale(t *testing.T) {
+	tests := []struct {
+		query, family, accept, want string
+	}{
+		{"", "", "", "en"},
+		{"", "", "fr-CA,fr;q=0.9,en;q=0.8", "fr"},
+		{"", "", "en;q=0.5, de-AT", "de"},
+		{"", "", "ja, *", "en"},
+		{"", "de", "fr", "de"},
+		{"fr", "de", "en", "fr"},
+		{"xx", "", "de", "de"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/?lang="+tt.query, nil)
+		r.Header.Set("Accept-Language", tt.accept)
+		if got := resolveLocale(r, tt.family).Tag; got != tt.want {
+			t.Errorf("lang=%q family=%q accept=%q: got %s, want %s", tt.query, tt.family, tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestLocaleFormatting(t *testing.T) {
+	day := time.Date(2026, 1, 25, 14, 5, 0, 0, time.UTC)
+	de, fr, en := locales["de"], locales["fr"], locales["en"]
+
+	if got := de.FormatDate(day); got != "Sonntag, 25. Januar 2026" {
+		t.Errorf("de date = %q", got)
+	}
+	if got := fr.FormatTime(day); got != "14h05" {
+		t.Errorf("fr time = %q", got)
+	}
+	if got := de.FormatTime(day); got != "14:05" {
+		t.Errorf("de time (English fallback) = %q", got)
+	}
+	if got := de.FormatDuration(125); got != "2 Std. 5 Min." {
+		t.Errorf("de duration = %q", got)
+	}
+	if de.ValueLabel("swaddle") != en.ValueLabel("swaddle") || de.ValueLabel("custom-thing") != "custom-thing" {
+		t.Error("missing labels should fall back to English, then the raw value")
+	}
+}
+
+func TestLocalizedSummary(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+	s.db.SaveFamilySettings(family.ID, FamilySettings{Locale: "de"})
+	s.db.UpsertEntry(&Entry{ID: "e1", FamilyID: family.ID, Ts: time.Date(2026, 1, 25, 8, 0, 0, 0, time.UTC).UnixMilli(), Type: "nappy", Value: "wet"})
+
+	req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/summary?date=2026-01-25", nil)
+	req.SetPathValue("id", family.ID)
+	req.Header.Set("Accept-Language", "fr")
+	w := httptest.NewRecorder()
+	s.getFamilySummary(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	var summary DailySummary
+	json.Unmarshal(w.Body.Bytes(), &summary)
+	if summary.Locale != "de" || summary.DateLabel != "Sonntag, 25. Januar 2026" || summary.Labels["nappy"] != "Windel" {
+		t.Errorf("summary = %+v", summary)
+	}
+	if e := summary.Hours[0].Entries[0]; e.TypeLabel != "Windel" || e.ValueLabel != "Nass" || e.Value != "wet" {
+		t.Errorf("entry = %+v", e)
+	}
+	if summary.TotalSleep != "0 Std. 0 Min." {
+		t.Errorf("total sleep = %q", summary.TotalSleep)
+	}
+}
@@ -0,0 +1,108 @@
+package babytrack
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Presence says more than who is connected: each device is active, idle or
+// away, so a family can tell whether anyone is actually looking at the app
+// (say, the monitor page left open on a tablet) rather than just holding a
+// connection. The app's pings report how long since its user last touched
+// it (idle_ms) and whether its page is hidden, and it pings early when
+// either changes; writing an entry counts as activity too. A connection is
+// away while its page is hidden, or once its pings stop; idle after
+// idleAfter without activity; and active otherwise. Clients that don't
+// report activity go idle idleAfter after their last entry or connecting.
+// Presence is sent again when a connection's status changes, checked as
+// pings arrive and every RunExpiry interval.
+
+const (
+	statusActive = "active"
+	statusIdle   = "idle"
+	statusAway   = "away"
+)
+
+const (
+	idleAfter = 2 * time.Minute
+	// awayAfterSilence is two of the app's pings missed, as when a phone
+	// sleeps with the app open.
+	awayAfterSilence = 11 * time.Minute
+)
+
+// statusRank orders statuses, for a link's best.
+var statusRank = map[string]int{statusAway: 0, statusIdle: 1, statusActive: 2}
+
+// connActivity is what a connection has reported about its user.
+type connActivity struct {
+	activeAt atomic.Int64 // ms, server clock; last input or entry, 0 = not reported
+	pingedAt atomic.Int64 // ms; last ping reporting activity, 0 = never
+	hidden   atomic.Bool
+	status   string // as last sent in presence; guarded by Hub.mu, written under Lock
+}
+
+// noteActivity records a ping's report that the user last touched the app
+// idleMs ago, and whether its page is hidden.
+func (c *Client) noteActivity(idleMs int64, hidden bool) {
+	now := time.Now().UnixMilli()
+	c.activity.pingedAt.Store(now)
+	c.activity.hidden.Store(hidden)
+	c.activity.activeAt.Store(now - max(idleMs, 0))
+	c.hub.refreshStatuses(c.familyID, now)
+}
+
+// presenceStatus is the connection's status at now.
+func (c *Client) presenceStatus(now int64) string {
+	pinged := c.activity.pingedAt.Load()
+	if c.activity.hidden.Load() || (pinged != 0 && now-pinged > awayAfterSilence.Milliseconds()) {
+		return statusAway
+	}
+	if now-c.lastActiveAt() > idleAfter.Milliseconds() {
+		return statusIdle
+	}
+	return statusActive
+}
+
+// lastActiveAt is when the connection was last active, as far as it has
+// said: connecting counts, until it reports otherwise.
+func (c *Client) lastActiveAt() int64 {
+	if at := c.activity.activeAt.Load(); at != 0 {
+		return at
+	}
+	return c.connectedAt.UnixMilli()
+}
+
+// refreshStatuses sends the family presence if any of its connections'
+// statuses changed since it was last sent.
+func (h *Hub) refreshStatuses(familyID string, now int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.statusesChangedLocked(familyID, now) {
+		h.broadcastPresenceLocked(familyID)
+	}
+}
+
+// refreshAllStatuses is refreshStatuses for every family with clients,
+// for connections that went idle or quiet without saying so.
+func (h *Hub) refreshAllStatuses(now int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for familyID := range h.families {
+		if h.statusesChangedLocked(familyID, now) {
+			h.broadcastPresenceLocked(familyID)
+		}
+	}
+}
+
+// statusesChangedLocked notes the family's connections' statuses, reporting
+// whether any changed. Must be called with h.mu held for writing.
+func (h *Hub) statusesChangedLocked(familyID string, now int64) bool {
+	changed := false
+	for c := range h.families[familyID] {
+		if status := c.presenceStatus(now); status != c.activity.status {
+			c.activity.status = status
+			changed = true
+		}
+	}
+	return changed
+}
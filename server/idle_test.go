@@ -0,0 +1,93 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPresenceStatus(t *testing.T) {
+	now := time.Now()
+	ms := func(d time.Duration) int64 { return now.Add(-d).UnixMilli() }
+	tests := []struct {
+		name     string
+		activeAt int64
+		pingedAt int64
+		hidden   bool
+		want     string
+	}{
+		{"just connected", 0, 0, false, statusActive},
+		{"recent input", ms(time.Minute), ms(time.Minute), false, statusActive},
+		{"no input", ms(3 * time.Minute), ms(time.Minute), false, statusIdle},
+		{"hidden", ms(0), ms(0), true, statusAway},
+		{"pings stopped", ms(0), ms(12 * time.Minute), false, statusAway},
+	}
+	for _, tt := range tests {
+		c := &Client{connectedAt: now.Add(-time.Minute)}
+		c.activity.activeAt.Store(tt.activeAt)
+		c.activity.pingedAt.Store(tt.pingedAt)
+		c.activity.hidden.Store(tt.hidden)
+		if got := c.presenceStatus(now.UnixMilli()); got != tt.want {
+			t.Errorf("%s: status = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// Clients that never report activity go idle after connecting
+	c := &Client{connectedAt: now.Add(-3 * time.Minute)}
+	if got := c.presenceStatus(now.UnixMilli()); got != statusIdle {
+		t.Errorf("silent client = %s", got)
+	}
+}
+
+func TestPresenceActivity(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	dad, _ := s.db.CreateAccessLink(family.ID, "Dad", nil)
+	mum, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+
+	dial := func(token string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"),
+			http.Header{"Cookie": {"client_session=" + token}})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		skipUntilType(t, conn, "init")
+		return conn
+	}
+	watching := dial(mum.Token)
+	defer watching.Close()
+	conn := dial(dad.Token)
+	defer conn.Close()
+	skipUntilType(t, watching, "presence")
+
+	status := func() map[string]string {
+		devices := skipUntilType(t, watching, "presence")["devices"].([]any)
+		got := map[string]string{}
+		for _, d := range devices {
+			d := d.(map[string]any)
+			got[d["label"].(string)], _ = d["status"].(string)
+		}
+		return got
+	}
+
+	// Hiding the page sends presence straight away
+	conn.WriteJSON(map[string]any{"type": "ping", "idle_ms": 0, "hidden": true})
+	if got := status(); got["Dad"] != statusAway || got["Mum"] != statusActive {
+		t.Errorf("hidden: %v", got)
+	}
+	conn.WriteJSON(map[string]any{"type": "ping", "idle_ms": (3 * time.Minute).Milliseconds()})
+	if got := status(); got["Dad"] != statusIdle {
+		t.Errorf("idle: %v", got)
+	}
+	conn.WriteJSON(map[string]any{"type": "ping", "idle_ms": 1000})
+	if got := status(); got["Dad"] != statusActive {
+		t.Errorf("back: %v", got)
+	}
+}
@@ -0,0 +1,279 @@
+package babytrack
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Importers for other trackers' CSV exports. Each row maps onto one or more
+// babytrack entries (a sleep with start and end becomes sleeping + awake).
+// Entry IDs are derived from the row contents, so importing the same file
+// twice is harmless.
+
+const (
+	maxImportBytes   = 10 << 20
+	importPreviewLen = 20
+)
+
+// importFormats maps a format name to its row parser. Parsers return nil
+// for rows they don't understand; those are counted as skipped.
+var importFormats = map[string]func(row map[string]string, loc *time.Location) []Entry{
+	"huckleberry":         parseHuckleberryRow,
+	"babytracker-nursing": parseBabyTrackerFeedRow,
+	"babytracker-bottle":  parseBabyTrackerFeedRow,
+	"babytracker-sleep":   parseBabyTrackerSleepRow,
+	"babytracker-diaper":  parseBabyTrackerDiaperRow,
+}
+
+// detectImportFormat guesses the export format from the CSV header.
+// Baby Tracker exports one file per activity, told apart by their columns.
+func detectImportFormat(header []string) string {
+	has := func(col string) bool {
+		return slices.ContainsFunc(header, func(h string) bool { return strings.EqualFold(h, col) })
+	}
+	switch {
+	case has("Type") && has("Start") && has("End") && has("Start Condition"):
+		return "huckleberry"
+	case has("Baby") && has("Time") && has("Status"):
+		return "babytracker-diaper"
+	case has("Baby") && has("Time") && (has("Start Side") || has("Left duration")):
+		return "babytracker-nursing"
+	case has("Baby") && has("Time") && has("Amount"):
+		return "babytracker-bottle"
+	case has("Baby") && has("Time") && has("Duration(minutes)"):
+		return "babytracker-sleep"
+	}
+	return ""
+}
+
+// importTimeLayouts covers the timestamp styles seen in exports, which are
+// always in the exporting phone's local time.
+var importTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"1/2/06, 3:04 PM",
+	"1/2/2006, 3:04 PM",
+	"1/2/06 15:04",
+	"2006-01-02T15:04:05",
+}
+
+func parseImportTime(s string, loc *time.Location) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range importTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseDurationMinutes reads durations written as minutes ("45") or as
+// h:mm ("1:30"), returning 0 if the field is empty or unparseable.
+func parseDurationMinutes(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err == nil {
+		return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+	}
+	if _, err := fmt.Sscanf(s, "%d", &m); err == nil {
+		return time.Duration(m) * time.Minute
+	}
+	return 0
+}
+
+func importEntry(t time.Time, typ, value string) Entry {
+	return Entry{Ts: t.UnixMilli(), Type: typ, Value: value}
+}
+
+// nappyEntries maps a free-text nappy description onto wet/dirty entries.
+func nappyEntries(t time.Time, desc string) []Entry {
+	desc = strings.ToLower(desc)
+	wet := strings.Contains(desc, "pee") || strings.Contains(desc, "wet") || strings.Contains(desc, "both") || strings.Contains(desc, "mixed")
+	dirty := strings.Contains(desc, "poo") || strings.Contains(desc, "dirty") || strings.Contains(desc, "both") || strings.Contains(desc, "mixed")
+	var entries []Entry
+	if wet {
+		entries = append(entries, importEntry(t, "nappy", "wet"))
+	}
+	if dirty {
+		entries = append(entries, importEntry(t, "nappy", "dirty"))
+	}
+	return entries
+}
+
+func sleepEntries(start, end time.Time) []Entry {
+	entries := []Entry{importEntry(start, "sleep", "sleeping")}
+	if end.After(start) {
+		entries = append(entries, importEntry(end, "sleep", "awake"))
+	}
+	return entries
+}
+
+// parseHuckleberryRow handles Huckleberry's single combined export:
+// Type,Start,End,Duration,Start Condition,Start Location,End Condition,Notes.
+func parseHuckleberryRow(row map[string]string, loc *time.Location) []Entry {
+	start, ok := parseImportTime(row["start"], loc)
+	if !ok {
+		return nil
+	}
+	switch strings.ToLower(row["type"]) {
+	case "sleep":
+		end, _ := parseImportTime(row["end"], loc)
+		return sleepEntries(start, end)
+	case "feed":
+		return []Entry{importEntry(start, "feed", "bf")}
+	case "diaper":
+		return nappyEntries(start, row["start condition"]+" "+row["end condition"])
+	}
+	return nil
+}
+
+func parseBabyTrackerFeedRow(row map[string]string, loc *time.Location) []Entry {
+	t, ok := parseImportTime(row["time"], loc)
+	if !ok {
+		return nil
+	}
+	return []Entry{importEntry(t, "feed", "bf")}
+}
+
+func parseBabyTrackerSleepRow(row map[string]string, loc *time.Location) []Entry {
+	t, ok := parseImportTime(row["time"], loc)
+	if !ok {
+		return nil
+	}
+	return sleepEntries(t, t.Add(parseDurationMinutes(row["duration(minutes)"])))
+}
+
+func parseBabyTrackerDiaperRow(row map[string]string, loc *time.Location) []Entry {
+	t, ok := parseImportTime(row["time"], loc)
+	if !ok {
+		return nil
+	}
+	return nappyEntries(t, row["status"])
+}
+
+// ImportResult summarises a parsed export. Preview holds the first few
+// entries so the admin can sanity-check times before committing.
+type ImportResult struct {
+	Format   string         `json:"format"`
+	Entries  int            `json:"entries"`
+	Skipped  int            `json:"skipped"`
+	Counts   map[string]int `json:"counts"`
+	FirstTs  int64          `json:"first_ts,omitempty"`
+	LastTs   int64          `json:"last_ts,omitempty"`
+	Preview  []Entry        `json:"preview"`
+	DryRun   bool           `json:"dry_run"`
+	Imported int            `json:"imported"`
+}
+
+// parseImport reads a CSV export for familyID. format may be empty to
+// auto-detect. Returns the entries with stable IDs assigned.
+func parseImport(r io.Reader, format, familyID string, loc *time.Location) ([]Entry, *ImportResult, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+	if format == "" {
+		format = detectImportFormat(header)
+		if format == "" {
+			return nil, nil, errors.New("unrecognised export format")
+		}
+	}
+	parse, ok := importFormats[format]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	res := &ImportResult{Format: format, Counts: map[string]int{}, Preview: []Entry{}}
+	var entries []Entry
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		row := make(map[string]string, len(header))
+		for i, h := range header {
+			if i < len(rec) {
+				row[strings.ToLower(h)] = strings.TrimSpace(rec[i])
+			}
+		}
+		parsed := parse(row, loc)
+		if len(parsed) == 0 {
+			res.Skipped++
+			continue
+		}
+		for i := range parsed {
+			e := &parsed[i]
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%d", familyID, format, strings.Join(rec, "\x1f"), i)))
+			e.ID = "import-" + hex.EncodeToString(sum[:12])
+			e.FamilyID = familyID
+			res.Counts[e.Type+"/"+e.Value]++
+			if res.FirstTs == 0 || e.Ts < res.FirstTs {
+				res.FirstTs = e.Ts
+			}
+			res.LastTs = max(res.LastTs, e.Ts)
+		}
+		entries = append(entries, parsed...)
+	}
+	res.Entries = len(entries)
+	res.Preview = append(res.Preview, entries[:min(len(entries), importPreviewLen)]...)
+	return entries, res, nil
+}
+
+// importEntries handles POST /admin/families/{id}/import. The body is the raw
+// CSV; ?format= overrides detection, ?offset= gives the export's UTC offset in
+// minutes and ?dry_run=true returns the summary without writing anything.
+func (s *Server) importEntries(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	if _, err := s.db.GetFamily(familyID); err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	_, loc, ok := parseDayParams(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	if f := q.Get("format"); f != "" {
+		if _, ok := importFormats[f]; !ok {
+			validationError(w, map[string]string{"format": "unknown format"})
+			return
+		}
+	}
+
+	entries, res, err := parseImport(http.MaxBytesReader(w, r.Body, maxImportBytes), q.Get("format"), familyID, loc)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, err.Error())
+		return
+	}
+
+	res.DryRun = q.Get("dry_run") == "true"
+	if !res.DryRun && len(entries) > 0 {
+		res.Imported, err = s.db.ImportEntries(familyID, entries)
+		if err != nil {
+			serverError(w, "failed to import entries", err)
+			return
+		}
+		// Connected clients resync from their cursor on reconnect
+		s.hub.CloseFamily(familyID, websocket.CloseServiceRestart, "history imported")
+	}
+	jsonOK(w, res)
+}
@@ -0,0 +1,130 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const huckleberryCSV = "\ufeffType,Start,End,Duration,Start Condition,Start Location,End Condition,Notes\n" +
+	"Sleep,2024-05-01 19:30,2024-05-02 02:10,06:40,,Crib,,\n" +
+	"Feed,2024-05-02 02:15,2024-05-02 02:35,00:20,00:10L,Breast,00:10R,\n" +
+	"Diaper,2024-05-02 02:40,,,Both,,,\n" +
+	"Pump,2024-05-02 08:00,,,,,,\n"
+
+func TestParseImportHuckleberry(t *testing.T) {
+	loc := time.FixedZone("client", 10*60*60)
+	entries, res, err := parseImport(strings.NewReader(huckleberryCSV), "", "fam", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Format != "huckleberry" {
+		t.Errorf("format = %q", res.Format)
+	}
+	want := []string{"sleep/sleeping", "sleep/awake", "feed/bf", "nappy/wet", "nappy/dirty"}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		if got := entries[i].Type + "/" + entries[i].Value; got != w {
+			t.Errorf("entry %d = %s, want %s", i, got, w)
+		}
+	}
+	if res.Skipped != 1 {
+		t.Errorf("skipped = %d, want 1 (pump)", res.Skipped)
+	}
+	if wantTs := time.Date(2024, 5, 1, 19, 30, 0, 0, loc).UnixMilli(); entries[0].Ts != wantTs || res.FirstTs != wantTs {
+		t.Errorf("first ts = %d, want %d", entries[0].Ts, wantTs)
+	}
+
+	// IDs are stable so a second import of the same file is a no-op
+	again, _, _ := parseImport(strings.NewReader(huckleberryCSV), "", "fam", loc)
+	if again[0].ID != entries[0].ID || entries[0].ID == entries[1].ID {
+		t.Errorf("IDs not stable/unique: %s %s %s", entries[0].ID, again[0].ID, entries[1].ID)
+	}
+}
+
+func TestParseImportBabyTracker(t *testing.T) {
+	tests := []struct {
+		csv    string
+		format string
+		want   []string
+	}{
+		{"Baby,Time,Status,Note\nAda,\"5/2/24, 7:05 AM\",Mixed,\nAda,\"5/2/24, 9:00 AM\",Wet,\n",
+			"babytracker-diaper", []string{"nappy/wet", "nappy/dirty", "nappy/wet"}},
+		{"Baby,Time,Start Side,Left duration,Right duration,Total Duration,Note\nAda,\"5/2/24, 7:05 AM\",Left,10,12,22,\n",
+			"babytracker-nursing", []string{"feed/bf"}},
+		{"Baby,Time,Duration(minutes),Note\nAda,\"5/2/24, 1:00 PM\",45,\n",
+			"babytracker-sleep", []string{"sleep/sleeping", "sleep/awake"}},
+	}
+	for _, tt := range tests {
+		entries, res, err := parseImport(strings.NewReader(tt.csv), "", "fam", time.UTC)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if res.Format != tt.format {
+			t.Errorf("detected %q, want %q", res.Format, tt.format)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Type+"/"+e.Value)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got %v, want %v", tt.format, got, tt.want)
+		}
+	}
+
+	if _, _, err := parseImport(strings.NewReader("a,b,c\n1,2,3\n"), "", "fam", time.UTC); err == nil {
+		t.Error("expected error for unrecognised header")
+	}
+}
+
+func TestImportEndpoint(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+
+	post := func(query string) ImportResult {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/admin/families/"+family.ID+"/import"+query, strings.NewReader(huckleberryCSV))
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.importEntries(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var res ImportResult
+		json.NewDecoder(w.Body).Decode(&res)
+		return res
+	}
+
+	res := post("?dry_run=true&offset=600")
+	if !res.DryRun || res.Entries != 5 || res.Imported != 0 || len(res.Preview) != 5 {
+		t.Errorf("dry run = %+v", res)
+	}
+	if n, _ := s.db.GetEntryCount(family.ID); n != 0 {
+		t.Fatalf("dry run wrote %d entries", n)
+	}
+
+	if res := post("?offset=600"); res.Imported != 5 {
+		t.Errorf("imported = %d, want 5", res.Imported)
+	}
+	if res := post("?offset=600"); res.Imported != 0 {
+		t.Errorf("re-import inserted %d entries", res.Imported)
+	}
+	entries, _, _ := s.db.GetEntriesSinceCursor(family.ID, 0, 100)
+	if len(entries) != 5 || entries[4].Seq != 5 {
+		t.Errorf("entries after import: %d, last seq %d", len(entries), entries[len(entries)-1].Seq)
+	}
+
+	req := httptest.NewRequest("POST", "/admin/families/"+family.ID+"/import?format=bogus", strings.NewReader(huckleberryCSV))
+	req.SetPathValue("id", family.ID)
+	w := httptest.NewRecorder()
+	s.importEntries(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bogus format: status %d", w.Code)
+	}
+}
@@ -0,0 +1,78 @@
+package babytrack
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Housekeeping for long-lived instances: families whose engagement ended
+// without anyone archiving them. A family is inactive if it has had no
+// entries (by when they happened) for some number of days; families younger
+// than that aren't, entries or not.
+
+const maxInactiveDays = 3650
+
+// InactiveFamily is an unarchived family with no recent entries.
+type InactiveFamily struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	OrgID          string `json:"org_id,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+	LatestActivity int64  `json:"latest_activity"` // 0 if it never had entries
+}
+
+// InactiveFamilies returns the unarchived families created before cutoff
+// (ms) with no entries since, limited to orgID's if it's set.
+func (db *DB) InactiveFamilies(cutoff int64, orgID string) ([]InactiveFamily, error) {
+	families, err := db.ListFamilies(false)
+	if err != nil {
+		return nil, err
+	}
+	inactive := []InactiveFamily{}
+	for _, f := range families {
+		if (orgID != "" && f.OrgID != orgID) || f.CreatedAt >= cutoff {
+			continue
+		}
+		latest, err := db.GetLatestActivity(f.ID)
+		if err != nil {
+			return nil, err
+		}
+		if latest >= cutoff {
+			continue
+		}
+		inactive = append(inactive, InactiveFamily{ID: f.ID, Name: f.Name, OrgID: f.OrgID, CreatedAt: f.CreatedAt, LatestActivity: latest})
+	}
+	return inactive, nil
+}
+
+// archiveInactive handles POST /admin/families/archive-inactive?days=N,
+// archiving every family with no entries for N days (an org admin's: only
+// their org's). With &dry_run=true it only reports which it would archive.
+func (s *Server) archiveInactive(w http.ResponseWriter, r *http.Request) {
+	days, err := strconv.Atoi(r.URL.Query().Get("days"))
+	if err != nil || days < 1 || days > maxInactiveDays {
+		validationError(w, map[string]string{"days": "must be between 1 and " + strconv.Itoa(maxInactiveDays)})
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	cutoff := time.Now().AddDate(0, 0, -days).UnixMilli()
+
+	families, err := s.db.InactiveFamilies(cutoff, adminOrg(r))
+	if err != nil {
+		serverError(w, "failed to find inactive families", err)
+		return
+	}
+	if !dryRun {
+		archived := true
+		for _, f := range families {
+			if err := s.db.UpdateFamily(f.ID, nil, nil, &archived); err != nil {
+				serverError(w, "failed to archive family", err)
+				return
+			}
+		}
+		slog.Info("inactive families archived", "count", len(families), "days", days, "admin_id", r.Header.Get("X-Admin-ID"))
+	}
+	jsonOK(w, map[string]any{"days": days, "cutoff": cutoff, "dry_run": dryRun, "families": families})
+}
@@ -0,0 +1,71 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestArchiveInactive(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	now := time.Now()
+	old := now.AddDate(0, 0, -200).UnixMilli()
+
+	idle, _ := s.db.CreateFamily("Idle", "")
+	active, _ := s.db.CreateFamily("Active", "")
+	empty, _ := s.db.CreateFamily("Never used", "")
+	fresh, _ := s.db.CreateFamily("Just created", "")
+	for _, id := range []string{idle.ID, active.ID, empty.ID} {
+		s.db.(*DB).Exec("UPDATE families SET created_at = ? WHERE id = ?", old, id)
+	}
+	s.db.UpsertEntry(&Entry{ID: "e1", FamilyID: idle.ID, Ts: now.AddDate(0, 0, -100).UnixMilli(), Type: "feed", Value: "bf"})
+	s.db.UpsertEntry(&Entry{ID: "e2", FamilyID: active.ID, Ts: now.AddDate(0, 0, -100).UnixMilli(), Type: "feed", Value: "bf"})
+	s.db.UpsertEntry(&Entry{ID: "e3", FamilyID: active.ID, Ts: now.AddDate(0, 0, -2).UnixMilli(), Type: "feed", Value: "bf"})
+
+	run := func(query string) (int, []InactiveFamily) {
+		req := httptest.NewRequest("POST", "/admin/families/archive-inactive?"+query, nil)
+		w := httptest.NewRecorder()
+		s.archiveInactive(w, req)
+		var resp struct {
+			Families []InactiveFamily `json:"families"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Families
+	}
+
+	for _, q := range []string{"", "days=0", "days=x", "days=4000"} {
+		if code, _ := run(q); code != http.StatusBadRequest {
+			t.Errorf("%q: %d", q, code)
+		}
+	}
+
+	code, families := run("days=30&dry_run=true")
+	if code != http.StatusOK || len(families) != 2 {
+		t.Fatalf("dry run: %d %+v", code, families)
+	}
+	got := map[string]InactiveFamily{}
+	for _, f := range families {
+		got[f.ID] = f
+	}
+	if got[idle.ID].LatestActivity == 0 || got[empty.ID].ID == "" || got[empty.ID].LatestActivity != 0 {
+		t.Errorf("inactive = %+v", families)
+	}
+	if f, _ := s.db.GetFamily(idle.ID); f.Archived {
+		t.Error("dry run archived")
+	}
+
+	if code, families = run("days=30"); code != http.StatusOK || len(families) != 2 {
+		t.Fatalf("archive: %d %+v", code, families)
+	}
+	for id, want := range map[string]bool{idle.ID: true, empty.ID: true, active.ID: false, fresh.ID: false} {
+		if f, _ := s.db.GetFamily(id); f.Archived != want {
+			t.Errorf("%s archived = %v", f.Name, f.Archived)
+		}
+	}
+	if _, families = run("days=30"); len(families) != 0 {
+		t.Errorf("archived again: %+v", families)
+	}
+}
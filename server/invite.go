@@ -0,0 +1,290 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Invitations save copying a link token into a message by hand: an admin
+// names a caregiver's email address and the server mails them a claim URL.
+// Opening it shows a page to accept the invitation, so mail scanners and
+// link previews that fetch the URL don't use it up; accepting mints the
+// caregiver their own access link, sets the cookie as /t/{token} does, and
+// lands them in the app. Claim URLs work once and expire; the link they
+// mint is an ordinary one, listed, rotated and revoked like any other, that
+// also remembers the address for signing back in (see magic.go).
+
+const (
+	defaultInviteTTL = 72 * time.Hour
+	maxInviteTTL     = 30 * 24 * time.Hour
+)
+
+var (
+	errInviteClaimed = errors.New("invite already claimed")
+	errInviteExpired = errors.New("invite expired")
+)
+
+// Invite is a pending or claimed invitation. The claim token itself is
+// only ever in the email.
+type Invite struct {
+	ID        string `json:"id"` // hash of the claim token
+	FamilyID  string `json:"family_id"`
+	Email     string `json:"email"`
+	Label     string `json:"label"`
+	Role      string `json:"role"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+	ClaimedAt *int64 `json:"claimed_at,omitempty"`
+	LinkID    string `json:"link_id,omitempty"` // the link minted on claiming
+	LinkPermissions
+}
+
+// CreateInvite stores inv, filling in its ID and CreatedAt, and returns the
+// claim token.
+func (db *DB) CreateInvite(inv *Invite) (string, error) {
+	token := generateToken(16)
+	inv.ID = hashToken(token)
+	inv.CreatedAt = time.Now().UnixMilli()
+	_, err := db.Exec(
+		`INSERT INTO invites (id, family_id, email, label, role, can_delete, can_edit_config, can_export, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		inv.ID, inv.FamilyID, inv.Email, inv.Label, inv.Role,
+		inv.CanDelete, inv.CanEditConfig, inv.CanExport, inv.CreatedAt, inv.ExpiresAt,
+	)
+	return token, err
+}
+
+func (db *DB) DeleteInvite(id string) error {
+	_, err := db.Exec("DELETE FROM invites WHERE id = ?", id)
+	return err
+}
+
+// ClaimInvite marks the invite claimed and creates its access link, in one
+// transaction so a claim URL can't mint two. Returns sql.ErrNoRows for an
+// unknown token, errInviteClaimed or errInviteExpired.
+func (db *DB) ClaimInvite(token string, now int64) (*Invite, *AccessLink, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var inv Invite
+	var claimedAt sql.NullInt64
+	err = tx.QueryRow(
+		`SELECT id, family_id, email, label, role, can_delete, can_edit_config, can_export, created_at, expires_at, claimed_at
+		 FROM invites WHERE id = ?`,
+		hashToken(token),
+	).Scan(&inv.ID, &inv.FamilyID, &inv.Email, &inv.Label, &inv.Role,
+		&inv.CanDelete, &inv.CanEditConfig, &inv.CanExport, &inv.CreatedAt, &inv.ExpiresAt, &claimedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case claimedAt.Valid:
+		return nil, nil, errInviteClaimed
+	case inv.ExpiresAt <= now:
+		return nil, nil, errInviteExpired
+	}
+
+	link, err := insertAccessLink(tx.Exec, inv.FamilyID, inv.Label, inv.Role, inv.LinkPermissions, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Claiming proves the address reaches this caregiver
+	link.Email = strings.ToLower(inv.Email)
+	if _, err := tx.Exec("UPDATE access_links SET email = ? WHERE token = ?", link.Email, link.ID); err != nil {
+		return nil, nil, err
+	}
+	res, err := tx.Exec(
+		"UPDATE invites SET claimed_at = ?, link_id = ? WHERE id = ? AND claimed_at IS NULL",
+		now, link.ID, inv.ID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil, errInviteClaimed
+	}
+	inv.ClaimedAt, inv.LinkID = &now, link.ID
+	return &inv, link, tx.Commit()
+}
+
+// createInvite handles POST /admin/families/{id}/invite, emailing the
+// claim URL. Nothing is kept if the email can't be sent.
+func (s *Server) createInvite(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	var req struct {
+		Email    string  `json:"email"`
+		Label    string  `json:"label"` // default the address's local part
+		Role     string  `json:"role"`  // default full
+		TTLHours float64 `json:"ttl_hours"`
+		permissionsRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	fields := map[string]string{}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil {
+		fields["email"] = "must be an email address"
+	} else if req.Label == "" {
+		req.Label, _, _ = strings.Cut(addr.Address, "@")
+	}
+	if req.Role == "" {
+		req.Role = roleFull
+	}
+	if !linkRoles[req.Role] {
+		fields["role"] = "must be full or summary"
+	}
+	ttl := defaultInviteTTL
+	if req.TTLHours != 0 {
+		ttl = time.Duration(req.TTLHours * float64(time.Hour))
+		if ttl <= 0 || ttl > maxInviteTTL {
+			fields["ttl_hours"] = "must be between 0 and 720"
+		}
+	}
+	if len(fields) > 0 {
+		validationError(w, fields)
+		return
+	}
+	if s.opts.Mailer == nil {
+		jsonError(w, http.StatusNotImplemented, errCodeUnavailable, "this server has no email configured")
+		return
+	}
+	family, err := s.db.GetFamily(familyID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err := s.checkLinkQuota(familyID); err != nil {
+		if qe, ok := err.(*QuotaError); ok {
+			jsonError(w, http.StatusForbidden, errCodeQuota, qe.Error())
+			return
+		}
+		serverError(w, "failed to check link quota", err)
+		return
+	}
+
+	inv := &Invite{
+		FamilyID: familyID, Email: addr.Address, Label: req.Label, Role: req.Role,
+		ExpiresAt: time.Now().Add(ttl).UnixMilli(), LinkPermissions: req.apply(allPermissions),
+	}
+	token, err := s.db.CreateInvite(inv)
+	if err != nil {
+		serverError(w, "failed to create invite", err)
+		return
+	}
+	subject, body := s.inviteEmail(r, family, token, inv.ExpiresAt)
+	if err := s.opts.Mailer.SendMail(inv.Email, subject, body); err != nil {
+		s.db.DeleteInvite(inv.ID)
+		loggerFromCtx(r.Context()).Warn("failed to send invite", "error", err, "family_id", familyID)
+		jsonError(w, http.StatusBadGateway, errCodeUnavailable, "the invitation email couldn't be sent")
+		return
+	}
+	slog.Info("invite sent", "family_id", familyID, "invite_id", inv.ID, "admin_id", r.Header.Get("X-Admin-ID"))
+	jsonCreated(w, inv)
+}
+
+// inviteEmail is the subject and body of an invitation. The claim URL is
+// on BASE_URL, or the origin the admin is using if that isn't set.
+func (s *Server) inviteEmail(r *http.Request, f *Family, token string, expiresAt int64) (string, string) {
+	origin := s.opts.BaseURL
+	if origin == "" {
+		scheme := "http"
+		if isSecure(r) {
+			scheme = "https"
+		}
+		origin = scheme + "://" + r.Host
+	}
+	app := s.appName(f.OrgID)
+	subject := fmt.Sprintf("You're invited to %s on %s", f.Name, app)
+	body := fmt.Sprintf(
+		"You've been invited to help keep track of %s on %s.\n\n"+
+			"Open this link on the phone you'll use:\n\n%s\n\n"+
+			"It works once and expires %s. If you weren't expecting this, you can ignore it.\n",
+		f.Name, app, origin+s.basePath+"/invite/"+token,
+		time.UnixMilli(expiresAt).UTC().Format("Mon 2 Jan 2006 15:04 MST"),
+	)
+	return subject, body
+}
+
+// handleInvite handles GET /invite/{token}: the page to accept the
+// invitation, which posts back to claimInvite.
+func (s *Server) handleInvite(w http.ResponseWriter, r *http.Request) {
+	if s.maintenance.State().Enabled {
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		http.Error(w, "The server is under maintenance. Open the invitation again later.", http.StatusServiceUnavailable)
+		return
+	}
+	s.serveConfirm(w, confirmPage{
+		Title:   "You're invited",
+		Message: "Accept the invitation on the phone you'll use to keep track. It works once.",
+		Button:  "Accept invitation",
+	})
+}
+
+// claimInvite handles POST /invite/{token}: claims the invite, sets the new
+// link's cookie and opens the app.
+func (s *Server) claimInvite(w http.ResponseWriter, r *http.Request) {
+	if s.maintenance.State().Enabled {
+		// Claiming writes; keep the invitation for later
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		http.Error(w, "The server is under maintenance. Open the invitation again later.", http.StatusServiceUnavailable)
+		return
+	}
+	inv, link, err := s.db.ClaimInvite(r.PathValue("token"), time.Now().UnixMilli())
+	switch {
+	case err == sql.ErrNoRows:
+		http.Error(w, "This invitation is not valid.", http.StatusNotFound)
+		return
+	case err == errInviteClaimed:
+		http.Error(w, "This invitation has already been used. Ask for a new one.", http.StatusGone)
+		return
+	case err == errInviteExpired:
+		http.Error(w, "This invitation has expired. Ask for a new one.", http.StatusGone)
+		return
+	case err != nil:
+		serverError(w, "failed to claim invite", err)
+		return
+	}
+	slog.Info("invite claimed", "family_id", inv.FamilyID, "invite_id", inv.ID, "link_id", link.ID)
+
+	if err := s.startSession(w, r, link); err != nil {
+		serverError(w, "failed to start session", err)
+		return
+	}
+	s.openApp(w, r, link)
+}
+
+// confirmPage is a page with one button that posts back to its own URL, for
+// one-time links a mail scanner's GET mustn't use up.
+type confirmPage struct {
+	Title   string
+	Message string
+	Button  string
+}
+
+func (s *Server) serveConfirm(w http.ResponseWriter, page confirmPage) {
+	tmpl, err := template.ParseFiles(s.staticPath("confirm.html"))
+	if err != nil {
+		serverError(w, "failed to load confirm page", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if err := tmpl.Execute(w, page); err != nil {
+		slog.Error("failed to render confirm page", "error", err)
+	}
+}
@@ -0,0 +1,130 @@
+package babytrack
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sentMail struct{ to, subject, body string }
+
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []sentMail
+	err  error
+}
+
+func (m *fakeMailer) SendMail(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, sentMail{to, subject, body})
+	return nil
+}
+
+// waitSent waits for n mails sent in the background.
+func (m *fakeMailer) waitSent(t *testing.T, n int) []sentMail {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		m.mu.Lock()
+		sent := append([]sentMail(nil), m.sent...)
+		m.mu.Unlock()
+		if len(sent) >= n {
+			return sent
+		}
+	}
+	t.Fatalf("waited for %d mails", n)
+	return nil
+}
+
+func TestInvite(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	mux := s.routes()
+	token, _ := s.db.CreateAdminSession("admin", time.Hour)
+	family, _ := s.db.CreateFamily("Smith", "")
+
+	invite := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/families/"+family.ID+"/invite", strings.NewReader(body))
+		req.Host = "babytrack.example"
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: token})
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	claim := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		return w
+	}
+
+	if w := invite(`{"email": "nan@example.com"}`); w.Code != http.StatusNotImplemented {
+		t.Errorf("without a mailer: %d", w.Code)
+	}
+	mailer := &fakeMailer{}
+	s.opts.Mailer = mailer
+	if w := invite(`{"email": "not an address"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("bad address: %d", w.Code)
+	}
+	if w := invite(`{"email": "Nan <nan@example.com>", "can_delete": false}`); w.Code != http.StatusCreated {
+		t.Fatalf("invite: %d %s", w.Code, w.Body)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].to != "nan@example.com" || !strings.Contains(mailer.sent[0].subject, "Smith") {
+		t.Fatalf("sent %+v", mailer.sent)
+	}
+	path := regexp.MustCompile(`http://babytrack\.example(/invite/\w+)`).FindStringSubmatch(mailer.sent[0].body)
+	if path == nil {
+		t.Fatalf("no claim URL in %q", mailer.sent[0].body)
+	}
+
+	// Opening the URL only asks; a link preview fetching it doesn't claim it
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", path[1], nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post">`) || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("invite page: %d %s", w.Code, w.Body)
+	}
+
+	w = claim(path[1])
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/?family="+family.ID {
+		t.Fatalf("claim: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "client_session" {
+			cookie = c
+		}
+	}
+	link, err := s.db.ValidateAccessLink(cookie.Value)
+	if err != nil || link.FamilyID != family.ID || link.Label != "nan" || link.CanDelete || !link.CanExport {
+		t.Errorf("claimed link = %+v, %v", link, err)
+	}
+	if w := claim(path[1]); w.Code != http.StatusGone {
+		t.Errorf("second claim: %d", w.Code)
+	}
+	if w := claim("/invite/nope"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown invite: %d", w.Code)
+	}
+
+	// Expired, and not kept if the email fails
+	inv := &Invite{FamilyID: family.ID, Email: "a@example.com", Label: "a", Role: roleFull, ExpiresAt: time.Now().UnixMilli() - 1}
+	expired, _ := s.db.CreateInvite(inv)
+	if w := claim("/invite/" + expired); w.Code != http.StatusGone {
+		t.Errorf("expired invite: %d", w.Code)
+	}
+	mailer.err = errors.New("connection refused")
+	if w := invite(`{"email": "b@example.com"}`); w.Code != http.StatusBadGateway {
+		t.Errorf("failed send: %d", w.Code)
+	}
+	var n int
+	s.db.(*DB).QueryRow("SELECT COUNT(*) FROM invites").Scan(&n)
+	if n != 2 {
+		t.Errorf("%d invites stored", n)
+	}
+}
@@ -0,0 +1,132 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Devices can rename their own link ("Dad's old phone" → "Dad's Pixel"),
+// over HTTP or the WebSocket. The label is the link's, so it changes for
+// all of the link's connected devices, on every instance, without them
+// reconnecting, and presence shows the new name. Entries already logged
+// keep the author they were logged with.
+
+const maxLabelLen = 40 // runes
+
+var errBadLabel = errors.New("label must be 1-40 characters, without control characters")
+
+// cleanLabel trims a requested label and checks it.
+func cleanLabel(label string) (string, error) {
+	label = strings.TrimSpace(label)
+	if label == "" || utf8.RuneCountInString(label) > maxLabelLen {
+		return "", errBadLabel
+	}
+	for _, r := range label {
+		if unicode.IsControl(r) {
+			return "", errBadLabel
+		}
+	}
+	return label, nil
+}
+
+// linkLabel is the client's link's label as it is now.
+func (c *Client) linkLabel() string {
+	if label := c.label.Load(); label != nil {
+		return *label
+	}
+	return ""
+}
+
+func (c *Client) setLabel(label string) {
+	c.label.Store(&label)
+}
+
+// RelabelLink gives the link's clients its new label and sends their
+// families' presence.
+func (h *Hub) RelabelLink(linkID, label string) {
+	h.relay(busMessage{Kind: "relabel_link", LinkID: linkID, Label: label})
+	h.relabelLink(linkID, label)
+}
+
+func (h *Hub) relabelLink(linkID, label string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for familyID, clients := range h.families {
+		relabeled := false
+		for c := range clients {
+			if c.linkID == linkID {
+				c.setLabel(label)
+				relabeled = true
+			}
+		}
+		if relabeled {
+			h.broadcastPresenceLocked(familyID)
+		}
+	}
+}
+
+// RenameAccessLink sets the link's label.
+func (db *DB) RenameAccessLink(id, label string) error {
+	_, err := db.Exec("UPDATE access_links SET label = ? WHERE token = ?", label, id)
+	return err
+}
+
+// handleRenameLink handles PATCH /api/v1/link: {"label"} renames the
+// device's link.
+func (s *Server) handleRenameLink(w http.ResponseWriter, r *http.Request) {
+	link := accessLinkFrom(r.Context())
+	var req struct {
+		Label string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	label, err := cleanLabel(req.Label)
+	if err != nil {
+		validationError(w, map[string]string{"label": err.Error()})
+		return
+	}
+	if label != link.Label {
+		if err := s.db.RenameAccessLink(link.ID, label); err != nil {
+			serverError(w, "failed to rename link", err)
+			return
+		}
+		s.hub.RelabelLink(link.ID, label)
+		loggerFromCtx(r.Context()).Info("link renamed", "family_id", link.FamilyID, "link_id", link.ID, "from", link.Label, "to", label)
+	}
+	jsonOK(w, map[string]string{"label": label})
+}
+
+// handleLabelMessage handles {"type": "set_label", "data": {"label"}}.
+// The client is told label_set, or label_rejected.
+func (s *Server) handleLabelMessage(c *Client, msg WSMessage) {
+	var req struct {
+		Label string `json:"label"`
+	}
+	json.Unmarshal(msg.Data, &req)
+	label, err := cleanLabel(req.Label)
+	if err != nil {
+		rejected, _ := json.Marshal(map[string]any{"type": "label_rejected", "reason": "invalid", "message": err.Error()})
+		c.send <- rejected
+		return
+	}
+	done, _ := json.Marshal(map[string]any{"type": "label_set", "label": label})
+	if label == c.linkLabel() {
+		c.send <- done
+		return
+	}
+	if err := s.db.RenameAccessLink(c.linkID, label); err != nil {
+		c.log().Error("failed to rename link", "error", err)
+		rejected, _ := json.Marshal(map[string]any{"type": "label_rejected", "reason": "error", "message": "couldn't save the label"})
+		c.send <- rejected
+		return
+	}
+	c.log().Info("link renamed", "link_id", c.linkID, "to", label)
+	c.send <- done
+	s.hub.RelabelLink(c.linkID, label)
+}
@@ -0,0 +1,92 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCleanLabel(t *testing.T) {
+	for in, want := range map[string]string{
+		"  Dad's Pixel ":        "Dad's Pixel",
+		"":                      "",
+		"   ":                   "",
+		"tab\there":             "",
+		strings.Repeat("é", 40): strings.Repeat("é", 40),
+		strings.Repeat("é", 41): "",
+	} {
+		got, err := cleanLabel(in)
+		if got != want || (err == nil) != (want != "") {
+			t.Errorf("cleanLabel(%q) = %q, %v", in, got, err)
+		}
+	}
+}
+
+func TestRenameLink(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Smith", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Dad's old phone", nil)
+	grandma, _ := s.db.CreateAccessLinkRole(family.ID, "Grandma", roleSummary, nil)
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	rename := func(token, body string) int {
+		req, _ := http.NewRequest("PATCH", server.URL+"/api/v1/link", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "client_session", Value: token})
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	label := func(token string) string {
+		l, _ := s.db.ValidateAccessLink(token)
+		return l.Label
+	}
+
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/ws", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+
+	if code := rename(link.Token, `{"label": "  "}`); code != http.StatusBadRequest {
+		t.Errorf("blank label: %d", code)
+	}
+	if code := rename(link.Token, `{"label": "Dad's Pixel"}`); code != http.StatusOK || label(link.Token) != "Dad's Pixel" {
+		t.Errorf("rename: %d, %q", code, label(link.Token))
+	}
+	// The link's devices stay connected, and presence shows the new name
+	if m := skipUntilType(t, conn, "presence"); !strings.Contains(strings.Join(anyStrings(m["members"]), ","), "Dad's Pixel") {
+		t.Errorf("presence = %v", m)
+	}
+	if code := rename(grandma.Token, `{"label": "Nana"}`); code != http.StatusOK || label(grandma.Token) != "Nana" {
+		t.Errorf("summary link rename: %d", code)
+	}
+
+	// And over the WebSocket
+	conn.WriteJSON(map[string]any{"type": "set_label", "data": map[string]string{"label": "Dad"}})
+	if m := skipUntilType(t, conn, "label_set"); m["label"] != "Dad" || label(link.Token) != "Dad" {
+		t.Errorf("label_set = %v, stored %q", m, label(link.Token))
+	}
+	if m := skipUntilType(t, conn, "presence"); strings.Join(anyStrings(m["members"]), ",") != "Dad" {
+		t.Errorf("presence = %v", m)
+	}
+}
+
+func anyStrings(v any) []string {
+	var out []string
+	list, _ := v.([]any)
+	for _, x := range list {
+		s, _ := x.(string)
+		out = append(out, s)
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package babytrack
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Background jobs that act on every family (the lifecycle policy, snapshot
+// compaction) should run on one instance at a time when several share the
+// database. Each run first takes the job's lease, which its holder renews
+// every run; another instance takes it over once it lapses, as when the
+// holder stops. Jobs that only touch this instance's clients, like link
+// rotation, run everywhere.
+
+// claimLease takes the named lease for holder until until, or renews it,
+// unless another holder's is unexpired at now.
+func (db *DB) claimLease(name, holder string, now, until int64) (bool, error) {
+	res, err := db.Exec(
+		`INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		 ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		 WHERE leases.holder = excluded.holder OR leases.expires_at <= ?`,
+		name, holder, until, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// holdsLease reports whether this instance should run the named job now,
+// taking or renewing its lease for ttl. Jobs renew every interval, so a
+// ttl of two intervals lets a late run keep it.
+func (s *Server) holdsLease(name string, ttl time.Duration) bool {
+	now := time.Now()
+	ok, err := s.db.claimLease(name, s.instance, now.UnixMilli(), now.Add(ttl).UnixMilli())
+	if err != nil {
+		slog.Error("failed to claim lease", "error", err, "lease", name)
+		return false
+	}
+	return ok
+}
@@ -0,0 +1,38 @@
+package babytrack
+
+import "testing"
+
+func TestClaimLease(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	claim := func(holder string, now int64) bool {
+		t.Helper()
+		ok, err := db.claimLease("lifecycle", holder, now, now+100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	if !claim("a", 0) {
+		t.Error("free lease not taken")
+	}
+	if claim("b", 50) {
+		t.Error("b took a's unexpired lease")
+	}
+	if !claim("a", 90) {
+		t.Error("a couldn't renew")
+	}
+	if claim("b", 150) {
+		t.Error("b took the renewed lease")
+	}
+	if !claim("b", 190) {
+		t.Error("b couldn't take the lapsed lease")
+	}
+	if ok, _ := db.claimLease("snapshots", "a", 190, 290); !ok {
+		t.Error("leases aren't separate")
+	}
+}
@@ -0,0 +1,232 @@
+package babytrack
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// The lifecycle policy keeps a long-lived instance tidy without an admin
+// going through families by hand: after some days without entries a family
+// is warned about, later archived, and later still, if archived, erased.
+// Each step is off unless configured (LIFECYCLE_*_DAYS), and families can
+// override each one in their settings. Every step's days are idle time,
+// counted from the family's latest entry, or its creation if it has none.
+// purge_days must be more than archive_days, and a purge also waits until
+// the family has been archived for the days between them (all of
+// purge_days if archiving is off), so one archived by hand, or idle long
+// before the policy was set, isn't erased on the next run.
+//
+// Warnings go out as an "inactive" alert (the family's devices and webhook,
+// and the admin activity feed); every step is also posted to
+// LIFECYCLE_WEBHOOK_URL if set, for the admin's own notifications.
+
+const lifecycleAdmin = "lifecycle" // erasures made by the policy, in receipts
+
+// LifecyclePolicy is the days idle before each step; 0 is off.
+type LifecyclePolicy struct {
+	WarnDays    int `json:"warn_days"`
+	ArchiveDays int `json:"archive_days"`
+	PurgeDays   int `json:"purge_days"`
+}
+
+// forFamily applies a family's overrides, where 0 keeps the policy's and -1
+// turns the step off.
+func (p LifecyclePolicy) forFamily(fs FamilySettings) LifecyclePolicy {
+	override := func(days *int, v int) {
+		switch {
+		case v == -1:
+			*days = 0
+		case v > 0:
+			*days = v
+		}
+	}
+	override(&p.WarnDays, fs.InactiveWarnDays)
+	override(&p.ArchiveDays, fs.InactiveArchiveDays)
+	override(&p.PurgeDays, fs.InactivePurgeDays)
+	if !p.purgeAfterArchive() {
+		p.PurgeDays = 0
+	}
+	return p
+}
+
+// purgeAfterArchive reports whether purging, if on, comes after archiving.
+func (p LifecyclePolicy) purgeAfterArchive() bool {
+	return p.PurgeDays <= 0 || p.ArchiveDays <= 0 || p.PurgeDays > p.ArchiveDays
+}
+
+type lifecycle struct {
+	policy  LifecyclePolicy
+	webhook string
+}
+
+func (s *Server) lifecycleConfig() lifecycle {
+	s.tuning.RLock()
+	defer s.tuning.RUnlock()
+	return s.lifecycle
+}
+
+// LifecycleAction is a step taken, or due on a dry run, for one family.
+type LifecycleAction struct {
+	FamilyID     string `json:"family_id"`
+	Name         string `json:"name"`
+	Action       string `json:"action"` // warn, archive or purge
+	IdleDays     int    `json:"idle_days"`
+	LastActivity int64  `json:"last_activity"`
+	Error        string `json:"error,omitempty"`
+}
+
+// lifecycleState is what the policy needs to know about a family beyond
+// Family itself.
+func (db *DB) lifecycleState(familyID string) (warnedAt, archivedAt, erasedAt int64, err error) {
+	var warned, archived, erased sql.NullInt64
+	err = db.QueryRow(
+		`SELECT inactive_warned_at, archived_at, (SELECT MAX(erased_at) FROM erasures WHERE family_id = families.id)
+		 FROM families WHERE id = ?`,
+		familyID,
+	).Scan(&warned, &archived, &erased)
+	return warned.Int64, archived.Int64, erased.Int64, err
+}
+
+func (db *DB) setInactiveWarned(familyID string, at int64) error {
+	_, err := db.Exec("UPDATE families SET inactive_warned_at = ? WHERE id = ?", at, familyID)
+	return err
+}
+
+// RunLifecycle applies the lifecycle policy every interval until ctx is
+// done, skipping runs in maintenance mode.
+func (s *Server) RunLifecycle(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if s.maintenance.State().Enabled {
+			slog.Info("lifecycle run skipped in maintenance")
+			continue
+		}
+		if !s.holdsLease("lifecycle", 2*interval) {
+			continue // another instance runs it
+		}
+		if _, err := s.applyLifecycle(time.Now(), false); err != nil {
+			slog.Error("lifecycle run failed", "error", err)
+		}
+	}
+}
+
+// applyLifecycle takes each family's next due step, or with dryRun only
+// lists them. A family takes at most one step per run. Failures on one
+// family are recorded in its action and don't stop the others.
+func (s *Server) applyLifecycle(now time.Time, dryRun bool) ([]LifecycleAction, error) {
+	families, err := s.db.ListFamilies(true)
+	if err != nil {
+		return nil, err
+	}
+	policy := s.lifecycleConfig().policy
+	actions := []LifecycleAction{}
+	for _, f := range families {
+		settings, err := s.db.GetFamilySettings(f.ID)
+		if err != nil {
+			return nil, err
+		}
+		p := policy.forFamily(settings)
+		if p == (LifecyclePolicy{}) {
+			continue
+		}
+		last, err := s.db.GetLatestActivity(f.ID)
+		if err != nil {
+			return nil, err
+		}
+		last = max(last, f.CreatedAt)
+		warnedAt, archivedAt, erasedAt, err := s.db.lifecycleState(f.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		days := func(since int64) int { return int(now.Sub(time.UnixMilli(since)) / (24 * time.Hour)) }
+		idleDays := days(last)
+		a := LifecycleAction{FamilyID: f.ID, Name: f.Name, IdleDays: idleDays, LastActivity: last}
+		switch {
+		case f.Archived && p.PurgeDays > 0 && idleDays >= p.PurgeDays && archivedAt > 0 &&
+			days(archivedAt) >= p.PurgeDays-p.ArchiveDays && erasedAt < last:
+			a.Action = "purge"
+		case !f.Archived && p.ArchiveDays > 0 && idleDays >= p.ArchiveDays:
+			a.Action = "archive"
+		case !f.Archived && p.WarnDays > 0 && idleDays >= p.WarnDays && warnedAt < last:
+			a.Action = "warn"
+		default:
+			continue
+		}
+		if a.Action == "warn" && !dryRun && settings.quiet("inactive", now) {
+			continue // warned on the first run after quiet hours
+		}
+		if !dryRun {
+			if err := s.lifecycleStep(a, p, now); err != nil {
+				slog.Error("lifecycle step failed", "error", err, "family_id", f.ID, "action", a.Action)
+				a.Error = err.Error()
+			}
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// lifecycleStep carries out one action and tells whoever should know.
+func (s *Server) lifecycleStep(a LifecycleAction, p LifecyclePolicy, now time.Time) error {
+	var message string
+	switch a.Action {
+	case "warn":
+		message = fmt.Sprintf("No entries for %d days.", a.IdleDays)
+		if p.ArchiveDays > 0 {
+			message += fmt.Sprintf(" The family will be archived after %d.", p.ArchiveDays)
+		}
+		if err := s.db.setInactiveWarned(a.FamilyID, now.UnixMilli()); err != nil {
+			return err
+		}
+		s.sendAlert(Alert{FamilyID: a.FamilyID, Kind: "inactive", Message: message})
+
+	case "archive":
+		archived := true
+		if err := s.db.UpdateFamily(a.FamilyID, nil, nil, &archived); err != nil {
+			return err
+		}
+		message = fmt.Sprintf("Archived after %d days without entries.", a.IdleDays)
+		s.hub.publishActivity(ActivityEvent{Type: "warning", FamilyID: a.FamilyID, Message: message})
+
+	case "purge":
+		if _, err := s.db.EraseFamily(a.FamilyID, lifecycleAdmin); err != nil {
+			return err
+		}
+		s.summaries.invalidate(a.FamilyID)
+		s.hub.CloseFamily(a.FamilyID, closeSessionRevoked, "family data erased")
+		message = fmt.Sprintf("Erased after %d days without entries.", a.IdleDays)
+	}
+	slog.Info("lifecycle step", "family_id", a.FamilyID, "action", a.Action, "idle_days", a.IdleDays)
+
+	if webhook := s.lifecycleConfig().webhook; webhook != "" {
+		alert := Alert{FamilyID: a.FamilyID, Kind: "lifecycle_" + a.Action, Message: a.Name + ": " + message, Ts: now.UnixMilli(), Data: a}
+		go func() {
+			if err := postWebhook(webhook, alert); err != nil {
+				slog.Warn("lifecycle webhook delivery failed", "error", err, "family_id", a.FamilyID)
+			}
+		}()
+	}
+	return nil
+}
+
+// getLifecycle handles GET /admin/lifecycle: the server policy and the
+// steps the next run would take.
+func (s *Server) getLifecycle(w http.ResponseWriter, r *http.Request) {
+	due, err := s.applyLifecycle(time.Now(), true)
+	if err != nil {
+		serverError(w, "failed to check lifecycle policy", err)
+		return
+	}
+	jsonOK(w, map[string]any{"policy": s.lifecycleConfig().policy, "due": due})
+}
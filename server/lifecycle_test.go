@@ -0,0 +1,169 @@
+package babytrack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLifecyclePolicyForFamily(t *testing.T) {
+	p := LifecyclePolicy{WarnDays: 30, ArchiveDays: 60}
+	got := p.forFamily(FamilySettings{InactiveWarnDays: -1, InactiveArchiveDays: 90, InactivePurgeDays: 365})
+	if got != (LifecyclePolicy{ArchiveDays: 90, PurgeDays: 365}) {
+		t.Errorf("forFamily = %+v", got)
+	}
+	if got := p.forFamily(FamilySettings{}); got != p {
+		t.Errorf("no overrides = %+v", got)
+	}
+	if (FamilySettings{InactivePurgeDays: -2}).validate() == nil {
+		t.Error("accepted -2")
+	}
+	if (FamilySettings{InactiveArchiveDays: 90, InactivePurgeDays: 90}).validate() == nil {
+		t.Error("accepted purging with archiving")
+	}
+	// An override that puts purging before the server's archiving turns it off
+	if got := (LifecyclePolicy{ArchiveDays: 60, PurgeDays: 90}).forFamily(FamilySettings{InactivePurgeDays: 30}); got.PurgeDays != 0 {
+		t.Errorf("purge before archive = %+v", got)
+	}
+}
+
+func TestApplyLifecycle(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	var hooked []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		json.NewDecoder(r.Body).Decode(&a)
+		mu.Lock()
+		hooked = append(hooked, a.Kind)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+	s.lifecycle = lifecycle{policy: LifecyclePolicy{WarnDays: 30, ArchiveDays: 60, PurgeDays: 90}, webhook: hook.URL}
+
+	now := time.Now()
+	family := func(name string, idleDays int, archived bool) *Family {
+		f, _ := s.db.CreateFamily(name, "")
+		s.db.(*DB).Exec("UPDATE families SET created_at = ? WHERE id = ?", now.AddDate(0, -6, 0).UnixMilli(), f.ID)
+		if archived {
+			s.db.UpdateFamily(f.ID, nil, nil, &archived)
+			s.db.(*DB).Exec("UPDATE families SET archived_at = ? WHERE id = ?", now.AddDate(0, 0, -40).UnixMilli(), f.ID)
+		}
+		s.db.UpsertEntry(&Entry{ID: name, FamilyID: f.ID, Ts: now.AddDate(0, 0, -idleDays).UnixMilli(), Type: "feed", Value: "bf"})
+		return f
+	}
+	warn := family("warn", 40, false)
+	archive := family("archive", 70, false)
+	purge := family("purge", 100, true)
+	family("active", 2, false)
+	kept := family("kept", 100, true)
+	s.db.SaveFamilySettings(kept.ID, FamilySettings{InactivePurgeDays: -1})
+	// Archived by hand only days ago, so not yet archived for 90-60 days
+	recent := family("recent", 100, false)
+	archived := true
+	s.db.UpdateFamily(recent.ID, nil, nil, &archived)
+	// Archiving is off for this one, so it's warned about instead
+	stays := family("stays", 70, false)
+	s.db.SaveFamilySettings(stays.ID, FamilySettings{InactiveArchiveDays: -1})
+
+	actionsOf := func(actions []LifecycleAction) map[string]string {
+		got := map[string]string{}
+		for _, a := range actions {
+			if a.Error != "" {
+				t.Errorf("%s: %s", a.Name, a.Error)
+			}
+			got[a.Name] = a.Action
+		}
+		return got
+	}
+	want := map[string]string{"warn": "warn", "archive": "archive", "purge": "purge", "stays": "warn"}
+
+	due, err := s.applyLifecycle(now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := actionsOf(due)
+	for name, action := range want {
+		if got[name] != action || len(got) != len(want) {
+			t.Fatalf("dry run = %v", got)
+		}
+	}
+	if f, _ := s.db.GetFamily(archive.ID); f.Archived {
+		t.Error("dry run archived")
+	}
+
+	done, err := s.applyLifecycle(now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actionsOf(done); len(got) != len(want) {
+		t.Fatalf("run = %v", got)
+	}
+	if f, _ := s.db.GetFamily(archive.ID); !f.Archived {
+		t.Error("not archived")
+	}
+	if erasures, _ := s.db.ListErasures(purge.ID); len(erasures) != 1 || erasures[0].AdminID != lifecycleAdmin {
+		t.Errorf("erasures = %+v", erasures)
+	}
+	if n, _ := s.db.GetEntryCount(kept.ID); n != 1 {
+		t.Error("opted-out family erased")
+	}
+	if n, _ := s.db.GetEntryCount(recent.ID); n != 1 {
+		t.Error("recently archived family erased")
+	}
+	if warnedAt, _, _, _ := s.db.lifecycleState(warn.ID); warnedAt != now.UnixMilli() {
+		t.Errorf("warned at %d", warnedAt)
+	}
+
+	// Nothing is repeated: warnings wait for new activity and erasures are done
+	again, _ := s.applyLifecycle(now.Add(time.Hour), false)
+	if got := actionsOf(again); len(got) != 0 {
+		t.Errorf("second run = %v", got)
+	}
+
+	// A family warned, used again and then idle again is warned again
+	s.db.UpsertEntry(&Entry{ID: "warn2", FamilyID: warn.ID, Ts: now.UnixMilli() + 1, Type: "feed", Value: "bf"})
+	later, _ := s.applyLifecycle(now.AddDate(0, 0, 35), true)
+	if got := actionsOf(later); got["warn"] != "warn" {
+		t.Errorf("after new activity = %v", got)
+	}
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		n := len(hooked)
+		mu.Unlock()
+		if n == len(want) {
+			break
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(hooked)
+	if len(hooked) != 4 || hooked[0] != "lifecycle_archive" || hooked[1] != "lifecycle_purge" || hooked[3] != "lifecycle_warn" {
+		t.Errorf("webhook got %v", hooked)
+	}
+}
+
+func TestRunLifecycleSkipsMaintenance(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	s.lifecycle = lifecycle{policy: LifecyclePolicy{WarnDays: 1}}
+	f, _ := s.db.CreateFamily("idle", "")
+	s.db.(*DB).Exec("UPDATE families SET created_at = ? WHERE id = ?", time.Now().AddDate(0, 0, -10).UnixMilli(), f.ID)
+	s.maintenance.Set(MaintenanceState{Enabled: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.RunLifecycle(ctx, 10*time.Millisecond)
+
+	if warnedAt, _, _, _ := s.db.(*DB).lifecycleState(f.ID); warnedAt != 0 {
+		t.Errorf("warned in maintenance at %d", warnedAt)
+	}
+}
@@ -0,0 +1,392 @@
+package babytrack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// `babytrackd loadtest` generates traffic against a running server, to
+// compare Hub and SQLite changes under the same load. It signs in as an
+// admin, creates throwaway families with a link per simulated device, and
+// has each device add, update and delete entries over its own WebSocket at
+// a steady random pace. It reports how long the server took to ack each
+// write and to fan it out to the family's other devices, and how many never
+// arrived. The families are archived afterwards.
+
+// loadtestDrain is how long to wait after the run for outstanding acks and
+// broadcasts before counting them as dropped.
+const loadtestDrain = 5 * time.Second
+
+type loadtestConfig struct {
+	URL      string // origin plus any BASE_PATH
+	Username string
+	Password string
+	Clients  int
+	Families int
+	Duration time.Duration
+	Rate     float64 // writes per client per minute
+}
+
+// loadtestEntries are the kinds of entry simulated devices write.
+var loadtestEntries = [][2]string{
+	{"feed", "bf"}, {"feed", "bottle"}, {"nappy", "wet"}, {"nappy", "dirty"}, {"sleep", "sleeping"}, {"sleep", "awake"},
+}
+
+// LoadReport is the outcome of a load test.
+type LoadReport struct {
+	Clients       int
+	Families      int
+	Duration      time.Duration
+	ConnectFailed int
+	Disconnected  int
+	Writes        int
+	Acked         int
+	Rejected      int
+	AckLatency    []time.Duration // sorted
+	FanoutWant    int             // broadcasts the other devices should have received
+	FanoutLatency []time.Duration // sorted, one per broadcast received
+}
+
+// loadOp is one write, waiting for its ack.
+type loadOp struct {
+	id     string
+	others int // devices that should receive it
+	sent   time.Time
+}
+
+type loadClient struct {
+	family int
+	conn   *websocket.Conn
+
+	mu      sync.Mutex
+	pending map[string][]*loadOp // by entry ID, oldest first
+	entries []string             // this device's live entries, for updates and deletes
+}
+
+// loadRun collects results from every client.
+type loadRun struct {
+	mu       sync.Mutex
+	report   LoadReport
+	sent     map[string]time.Time // acked writes by ID and seq
+	fanout   map[string]int       // expected receivers by ID and seq
+	received map[string][]time.Time
+	outcome  chan struct{} // signalled on each ack and broadcast
+	closing  atomic.Bool   // connections closed by us don't count as disconnects
+}
+
+func opKey(id string, seq int64) string { return fmt.Sprintf("%s/%d", id, seq) }
+
+// runLoadtest runs the test described by cfg.
+func runLoadtest(cfg loadtestConfig) (*LoadReport, error) {
+	admin := &loadtestAdmin{url: cfg.URL, client: &http.Client{Timeout: 10 * time.Second}}
+	if err := admin.login(cfg.Username, cfg.Password); err != nil {
+		return nil, err
+	}
+
+	runID := generateToken(3)
+	familyIDs := make([]string, cfg.Families)
+	for i := range familyIDs {
+		var f Family
+		body := map[string]string{"name": fmt.Sprintf("loadtest %s %d", runID, i+1), "notes": "created by babytrackd loadtest"}
+		if err := admin.do("POST", "/admin/families", body, &f); err != nil {
+			return nil, fmt.Errorf("create family: %w", err)
+		}
+		familyIDs[i] = f.ID
+	}
+	defer func() {
+		for _, id := range familyIDs {
+			admin.do("PATCH", "/admin/families/"+id, map[string]bool{"archived": true}, nil)
+		}
+	}()
+
+	run := &loadRun{
+		report:   LoadReport{Clients: cfg.Clients, Families: cfg.Families, Duration: cfg.Duration},
+		sent:     map[string]time.Time{},
+		fanout:   map[string]int{},
+		received: map[string][]time.Time{},
+		outcome:  make(chan struct{}, 1),
+	}
+	wsURL := "ws" + strings.TrimPrefix(cfg.URL, "http") + apiPrefix + "/ws"
+	connected := make([]int, cfg.Families)
+	var clients []*loadClient
+	for i := range cfg.Clients {
+		family := i % cfg.Families
+		var link AccessLink
+		if err := admin.do("POST", "/admin/families/"+familyIDs[family]+"/links", map[string]string{"label": fmt.Sprintf("loadtest %d", i+1)}, &link); err != nil {
+			return nil, fmt.Errorf("create link: %w", err)
+		}
+		header := http.Header{}
+		header.Add("Cookie", "client_session="+link.Token)
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if err != nil {
+			run.report.ConnectFailed++
+			continue
+		}
+		clients = append(clients, &loadClient{family: family, conn: conn, pending: map[string][]*loadOp{}})
+		connected[family]++
+	}
+	if len(clients) == 0 {
+		return &run.report, errors.New("no clients connected")
+	}
+
+	var readers sync.WaitGroup
+	for _, c := range clients {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			run.read(c)
+		}()
+	}
+
+	var writers sync.WaitGroup
+	stop := time.Now().Add(cfg.Duration)
+	for i, c := range clients {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			run.write(c, i, runID, cfg.Rate, stop, connected[c.family]-1)
+		}()
+	}
+	writers.Wait()
+
+	// Give the server time to catch up before counting what's missing
+	for deadline := time.Now().Add(loadtestDrain); time.Now().Before(deadline) && !run.settled(); {
+		select {
+		case <-run.outcome:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	run.closing.Store(true)
+	for _, c := range clients {
+		c.conn.Close()
+	}
+	readers.Wait()
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	r := run.report
+	for key, want := range run.fanout {
+		r.FanoutWant += want
+		for _, at := range run.received[key] {
+			r.FanoutLatency = append(r.FanoutLatency, at.Sub(run.sent[key]))
+		}
+	}
+	sort.Slice(r.AckLatency, func(i, j int) bool { return r.AckLatency[i] < r.AckLatency[j] })
+	sort.Slice(r.FanoutLatency, func(i, j int) bool { return r.FanoutLatency[i] < r.FanoutLatency[j] })
+	return &r, nil
+}
+
+// write sends a client's entries until stop. others is how many other
+// devices in the family should receive each one.
+func (run *loadRun) write(c *loadClient, n int, runID string, rate float64, stop time.Time, others int) {
+	count := 0
+	for {
+		wait := time.Duration(rand.ExpFloat64() / rate * float64(time.Minute))
+		if time.Now().Add(wait).After(stop) {
+			return
+		}
+		time.Sleep(wait)
+
+		kind := loadtestEntries[rand.IntN(len(loadtestEntries))]
+		msg := map[string]any{"type": "entry"}
+		c.mu.Lock()
+		switch r := rand.IntN(10); {
+		case r < 7 || len(c.entries) == 0:
+			count++
+			id := fmt.Sprintf("loadtest-%s-%d-%d", runID, n, count)
+			c.entries = append(c.entries, id)
+			msg["action"] = "add"
+			msg["entry"] = map[string]any{"id": id, "ts": time.Now().UnixMilli(), "type": kind[0], "value": kind[1]}
+		case r < 9:
+			id := c.entries[rand.IntN(len(c.entries))]
+			msg["action"] = "update"
+			msg["entry"] = map[string]any{"id": id, "ts": time.Now().UnixMilli(), "type": kind[0], "value": kind[1]}
+		default:
+			i := rand.IntN(len(c.entries))
+			msg["action"] = "delete"
+			msg["id"] = c.entries[i]
+			c.entries = append(c.entries[:i], c.entries[i+1:]...)
+		}
+		id, _ := msg["id"].(string)
+		if entry, ok := msg["entry"].(map[string]any); ok {
+			id = entry["id"].(string)
+		}
+		op := &loadOp{id: id, others: others, sent: time.Now()}
+		c.pending[id] = append(c.pending[id], op)
+		c.mu.Unlock()
+
+		data, _ := json.Marshal(msg)
+		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return
+		}
+		run.mu.Lock()
+		run.report.Writes++
+		run.mu.Unlock()
+	}
+}
+
+// read handles a client's messages until its connection closes.
+func (run *loadRun) read(c *loadClient) {
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if !run.closing.Load() {
+				run.mu.Lock()
+				run.report.Disconnected++
+				run.mu.Unlock()
+			}
+			return
+		}
+		now := time.Now()
+		var msg struct {
+			Type  string `json:"type"`
+			ID    string `json:"id"`
+			Seq   int64  `json:"seq"`
+			Entry *Entry `json:"entry"`
+		}
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		switch msg.Type {
+		case "entry_ack", "entry_rejected":
+			c.mu.Lock()
+			queue := c.pending[msg.ID]
+			var op *loadOp
+			if len(queue) > 0 {
+				op, c.pending[msg.ID] = queue[0], queue[1:]
+			}
+			c.mu.Unlock()
+			if op == nil {
+				continue
+			}
+			run.mu.Lock()
+			if msg.Type == "entry_ack" {
+				run.report.Acked++
+				run.report.AckLatency = append(run.report.AckLatency, now.Sub(op.sent))
+				key := opKey(msg.ID, msg.Seq)
+				run.sent[key] = op.sent
+				run.fanout[key] = op.others
+			} else {
+				run.report.Rejected++
+			}
+			run.mu.Unlock()
+
+		case "entry":
+			id, seq := msg.ID, msg.Seq
+			if msg.Entry != nil {
+				id, seq = msg.Entry.ID, msg.Entry.Seq
+			}
+			if !strings.HasPrefix(id, "loadtest-") {
+				continue
+			}
+			run.mu.Lock()
+			key := opKey(id, seq)
+			run.received[key] = append(run.received[key], now)
+			run.mu.Unlock()
+
+		default:
+			continue
+		}
+		select {
+		case run.outcome <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// settled reports whether every write has been acked or rejected and every
+// broadcast received.
+func (run *loadRun) settled() bool {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if run.report.Acked+run.report.Rejected < run.report.Writes {
+		return false
+	}
+	for key, want := range run.fanout {
+		if len(run.received[key]) < want {
+			return false
+		}
+	}
+	return true
+}
+
+// print writes the report for people.
+func (r *LoadReport) print(w io.Writer) {
+	fmt.Fprintf(w, "%d clients in %d families for %s: %d failed to connect, %d disconnected\n",
+		r.Clients, r.Families, r.Duration, r.ConnectFailed, r.Disconnected)
+	fmt.Fprintf(w, "writes   %d sent (%.1f/s), %d acked, %d rejected, %d dropped\n",
+		r.Writes, float64(r.Writes)/r.Duration.Seconds(), r.Acked, r.Rejected, r.Writes-r.Acked-r.Rejected)
+	fmt.Fprintf(w, "ack      %s\n", latencySummary(r.AckLatency))
+	fmt.Fprintf(w, "fan-out  %d of %d delivered, %d dropped\n",
+		len(r.FanoutLatency), r.FanoutWant, r.FanoutWant-len(r.FanoutLatency))
+	fmt.Fprintf(w, "fan-out  %s\n", latencySummary(r.FanoutLatency))
+}
+
+// latencySummary formats percentiles of sorted latencies.
+func latencySummary(d []time.Duration) string {
+	if len(d) == 0 {
+		return "no samples"
+	}
+	p := func(q float64) time.Duration { return d[int(q*float64(len(d)-1))].Round(10 * time.Microsecond) }
+	return fmt.Sprintf("p50 %s  p95 %s  p99 %s  max %s", p(0.5), p(0.95), p(0.99), d[len(d)-1].Round(10*time.Microsecond))
+}
+
+// loadtestAdmin is a signed-in admin API client.
+type loadtestAdmin struct {
+	url     string
+	client  *http.Client
+	session string
+}
+
+func (a *loadtestAdmin) login(username, password string) error {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	resp, err := a.client.Post(a.url+"/admin/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin login: %s", resp.Status)
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name == "admin_session" {
+			a.session = c.Value
+		}
+	}
+	return nil
+}
+
+func (a *loadtestAdmin) do(method, path string, body, out any) error {
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequest(method, a.url+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "admin_session", Value: a.session})
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,59 @@
+package babytrack
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadtest(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	report, err := runLoadtest(loadtestConfig{
+		URL: server.URL, Username: "testadmin", Password: "testpass",
+		Clients: 6, Families: 2, Duration: 500 * time.Millisecond, Rate: 600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Writes == 0 || report.Acked != report.Writes || len(report.AckLatency) != report.Acked {
+		t.Errorf("writes %d, acked %d, rejected %d", report.Writes, report.Acked, report.Rejected)
+	}
+	// Each write reaches the two other devices in its family
+	if report.FanoutWant != 2*report.Acked || len(report.FanoutLatency) != report.FanoutWant {
+		t.Errorf("fan-out %d of %d", len(report.FanoutLatency), report.FanoutWant)
+	}
+	if report.ConnectFailed != 0 || report.Disconnected != 0 {
+		t.Errorf("connect failed %d, disconnected %d", report.ConnectFailed, report.Disconnected)
+	}
+
+	families, _ := s.db.ListFamilies(true)
+	for _, f := range families {
+		if !f.Archived || !strings.HasPrefix(f.Name, "loadtest ") {
+			t.Errorf("family %q left behind, archived %v", f.Name, f.Archived)
+		}
+	}
+
+	var out bytes.Buffer
+	report.print(&out)
+	if !strings.Contains(out.String(), "0 dropped") || !strings.Contains(out.String(), "p99") {
+		t.Errorf("report = %s", out.String())
+	}
+}
+
+func TestLoadtestCLI(t *testing.T) {
+	run := func(args ...string) error {
+		return runCLI(args, "", "", "", strings.NewReader(""), &bytes.Buffer{})
+	}
+	if err := run("loadtest", "admin"); err == nil || !strings.Contains(err.Error(), "--url") {
+		t.Errorf("no url: %v", err)
+	}
+	if err := run("loadtest", "--url", "http://localhost:1", "--families", "3", "--clients", "2", "admin"); err == nil {
+		t.Error("accepted more families than clients")
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package babytrack
 
 import (
 	"bufio"
@@ -9,6 +9,10 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,16 +22,24 @@ const requestIDKey ctxKey = "request_id"
 
 var logger *slog.Logger
 
-func initLogger() {
-	level := slog.LevelInfo
-	if os.Getenv("LOG_LEVEL") == "debug" {
-		level = slog.LevelDebug
+// logLevel is the level of the logger initLogger sets up. Reload changes it.
+var logLevel = new(slog.LevelVar)
+
+// parseLogLevel reads LOG_LEVEL: "debug", or info for anything else.
+func parseLogLevel(s string) slog.Level {
+	if s == "debug" {
+		return slog.LevelDebug
 	}
+	return slog.LevelInfo
+}
+
+func initLogger() {
+	logLevel.Set(parseLogLevel(setting("LOG_LEVEL")))
 
-	opts := &slog.HandlerOptions{Level: level}
+	opts := &slog.HandlerOptions{Level: logLevel, ReplaceAttr: redactAttr}
 
 	var handler slog.Handler
-	if os.Getenv("LOG_FORMAT") == "text" {
+	if setting("LOG_FORMAT") == "text" {
 		handler = slog.NewTextHandler(os.Stdout, opts)
 	} else {
 		handler = slog.NewJSONHandler(os.Stdout, opts)
@@ -37,6 +49,37 @@ func initLogger() {
 	slog.SetDefault(logger)
 }
 
+const redacted = "[REDACTED]"
+
+// secretPattern matches credentials embedded in paths, cookies and query
+// strings: /t/{token}, /links/{token}, /cal/{token}, /invite/{token},
+// /magic/{token}, client_session=..., token=..., sig=...
+var secretPattern = regexp.MustCompile(`(/t/|/links/|/cal/|/invite/|/magic/|(?:client_session|admin_session|token|password|sig)=)[^/?&\s";,]+`)
+
+// redactAttr is the slog ReplaceAttr hook that keeps secrets out of logs.
+// Attributes with credential-like keys are masked outright; other string
+// values (including the message) have embedded tokens masked.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	if strings.Contains(key, "token") || strings.Contains(key, "password") ||
+		strings.Contains(key, "secret") || strings.Contains(key, "cookie") ||
+		strings.HasSuffix(key, "session") || key == "authorization" || key == "dsn" {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Value.Kind() == slog.KindString {
+		a.Value = slog.StringValue(redactString(a.Value.String()))
+	}
+	return a
+}
+
+// redactString masks the tokens secretPattern finds in s.
+func redactString(s string) string {
+	if !strings.ContainsAny(s, "/=") {
+		return s
+	}
+	return secretPattern.ReplaceAllString(s, "${1}"+redacted)
+}
+
 // requestID generates a short unique ID for request tracing
 func requestID() string {
 	return generateToken(8)
@@ -58,12 +101,24 @@ func getRequestID(ctx context.Context) string {
 // loggerFromCtx returns a logger with request context
 func loggerFromCtx(ctx context.Context) *slog.Logger {
 	if id := getRequestID(ctx); id != "" {
-		return logger.With("req_id", id)
+		return baseLogger().With("req_id", id)
+	}
+	return baseLogger()
+}
+
+// baseLogger is the logger initLogger set up, or slog's default for
+// servers embedded without it.
+func baseLogger() *slog.Logger {
+	if logger != nil {
+		return logger
 	}
-	return logger
+	return slog.Default()
 }
 
-// loggingMiddleware adds request ID and logs request timing
+// loggingMiddleware adds request ID and logs request timing. It also recovers
+// panics, and reports panics and serverError responses to the error tracker.
+// Other 5xx responses, such as the 503s of readiness checks and maintenance,
+// are intentional and logged as warnings.
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -75,37 +130,72 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		// Wrap response writer to capture status
 		lrw := &loggingResponseWriter{ResponseWriter: w, status: 200}
 
-		next.ServeHTTP(lrw, r)
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				lrw.errMsg = fmt.Sprint("panic: ", p)
+				reporter.Report(ReportEvent{
+					Message: lrw.errMsg,
+					Level:   "fatal",
+					Tags:    map[string]string{"req_id": reqID, "source": "server"},
+					Extra:   map[string]any{"stack": string(debug.Stack()), "path": r.URL.Path},
+				})
+				if !lrw.wroteHeader {
+					jsonError(lrw, http.StatusInternalServerError, errCodeInternal, "internal error")
+				} else {
+					lrw.status = http.StatusInternalServerError
+				}
+			} else if lrw.errMsg != "" {
+				reporter.Report(ReportEvent{
+					Message: lrw.errMsg,
+					Tags:    map[string]string{"req_id": reqID, "source": "server"},
+					Extra:   map[string]any{"method": r.Method, "path": r.URL.Path, "status": lrw.status},
+				})
+			}
 
-		duration := time.Since(start)
-		log := logger.With(
-			"req_id", reqID,
-			"method", r.Method,
-			"path", r.URL.Path,
-			"status", lrw.status,
-			"duration_ms", duration.Milliseconds(),
-		)
-
-		if lrw.status >= 500 {
-			log.Error("request completed")
-		} else if lrw.status >= 400 {
-			log.Warn("request completed")
-		} else {
-			log.Info("request completed")
-		}
+			duration := time.Since(start)
+			log := baseLogger().With(
+				"req_id", reqID,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"remote_ip", clientIP(r),
+				"status", lrw.status,
+				"duration_ms", duration.Milliseconds(),
+			)
+
+			if lrw.errMsg != "" {
+				log.With("error", lrw.errMsg).Error("request completed")
+			} else if lrw.status >= 400 {
+				log.Warn("request completed")
+			} else {
+				log.Info("request completed")
+			}
+		}()
+
+		next.ServeHTTP(lrw, r)
 	})
 }
 
 type loggingResponseWriter struct {
 	http.ResponseWriter
-	status int
+	status      int
+	wroteHeader bool
+	errMsg      string // set by serverError for logging and error reports
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.status = code
+	lrw.wroteHeader = true
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+	lrw.wroteHeader = true
+	return lrw.ResponseWriter.Write(b)
+}
+
 // Hijack implements http.Hijacker for WebSocket support
 func (lrw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hijacker, ok := lrw.ResponseWriter.(http.Hijacker); ok {
@@ -130,28 +220,141 @@ type ClientLogEntry struct {
 	Family  string `json:"family"`
 }
 
-// handleClientLog receives frontend console errors and logs them server-side
-func handleClientLog(w http.ResponseWriter, r *http.Request) {
+// Client log limits. A frontend error loop on one phone can otherwise emit
+// thousands of identical lines per minute. The per-window limits are the
+// defaults for CLIENT_LOG_IP_LIMIT and CLIENT_LOG_FAMILY_LIMIT.
+const (
+	clientLogIPLimit     = 30  // requests per IP per window
+	clientLogFamilyLimit = 120 // entries per family per window (per IP unauthenticated)
+	clientLogWindow      = time.Minute
+)
+
+var (
+	clientLogIPLimiter     = newRateLimiter(clientLogIPLimit, clientLogWindow)
+	clientLogFamilyLimiter = newRateLimiter(clientLogFamilyLimit, clientLogWindow)
+	clientLogDedup         = newLogDeduper(clientLogWindow)
+)
+
+// logDeduper collapses identical messages within a window. The first
+// occurrence is logged; repeats are counted and reported on the first
+// occurrence after the window ends.
+type logDeduper struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]*dupState
+}
+
+type dupState struct {
+	start      time.Time
+	suppressed int
+}
+
+func newLogDeduper(window time.Duration) *logDeduper {
+	return &logDeduper{window: window, seen: make(map[string]*dupState)}
+}
+
+// Check reports whether a message with this key should be emitted, and if so
+// how many copies were suppressed since it was last emitted.
+func (d *logDeduper) Check(key string, now time.Time) (emit bool, repeated int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st, ok := d.seen[key]
+	if ok && now.Sub(st.start) < d.window {
+		st.suppressed++
+		return false, 0
+	}
+
+	if !ok && len(d.seen) >= maxRateKeys {
+		for k, v := range d.seen {
+			if now.Sub(v.start) >= d.window {
+				delete(d.seen, k)
+			}
+		}
+	}
+
+	if ok {
+		repeated = st.suppressed
+	}
+	d.seen[key] = &dupState{start: now}
+	return true, repeated
+}
+
+// handleClientLog receives frontend console errors and logs them server-side.
+// Requests carrying a valid client_session are also persisted per family so
+// admins can inspect them later; the family in the body is not trusted, so
+// the per-family limit falls back to the IP without a session.
+func (s *Server) handleClientLog(w http.ResponseWriter, r *http.Request) {
+	log := loggerFromCtx(r.Context())
+
+	ip := clientIP(r)
+	if !clientLogIPLimiter.Allow(ip) {
+		w.Header().Set("Retry-After", "60")
+		jsonError(w, http.StatusTooManyRequests, errCodeRateLimited, "too many log requests")
+		return
+	}
+
 	var entries []ClientLogEntry
 	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid json")
 		return
 	}
 
-	log := loggerFromCtx(r.Context())
+	var link *AccessLink
+	if cookie, err := r.Cookie("client_session"); err == nil {
+		link, _ = s.db.ValidateAccessLink(cookie.Value)
+	}
+
+	limitKey := "ip:" + ip
+	if link != nil {
+		limitKey = link.FamilyID
+	}
+
+	now := time.Now()
+	dropped := 0
+	var persist []ClientLog
 	for _, e := range entries {
+		if !clientLogFamilyLimiter.Allow(limitKey) {
+			dropped++
+			continue
+		}
+		family := e.Family
+		if link != nil {
+			family = link.FamilyID
+		}
+		emit, repeated := clientLogDedup.Check(family+"\x00"+e.Level+"\x00"+e.Message, now)
+		if !emit {
+			continue
+		}
 		attrs := []any{
 			"source", "frontend",
-			"family", e.Family,
+			"family", family,
 			"url", e.URL,
 		}
 		if e.Data != nil {
 			attrs = append(attrs, "data", e.Data)
 		}
+		if repeated > 0 {
+			attrs = append(attrs, "repeated", repeated)
+		}
+
+		if link != nil {
+			cl := ClientLog{Ts: now.UnixMilli(), Level: e.Level, Message: e.Message, URL: e.URL}
+			if e.Data != nil {
+				data, _ := json.Marshal(e.Data)
+				cl.Data = string(data)
+			}
+			persist = append(persist, cl)
+		}
 
 		switch e.Level {
 		case "error":
 			log.Error(e.Message, attrs...)
+			reporter.Report(ReportEvent{
+				Message: e.Message,
+				Tags:    map[string]string{"family": family, "req_id": getRequestID(r.Context()), "source": "frontend"},
+				Extra:   map[string]any{"url": e.URL, "data": e.Data},
+			})
 		case "warn":
 			log.Warn(e.Message, attrs...)
 		default:
@@ -159,5 +362,15 @@ func handleClientLog(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if len(persist) > 0 {
+		if err := s.db.InsertClientLogs(link.FamilyID, link.Label, persist); err != nil {
+			log.Error("failed to persist client logs", "error", err, "family_id", link.FamilyID)
+		}
+	}
+
+	if dropped > 0 {
+		log.Debug("client log entries dropped by rate limit", "ip", ip, "dropped", dropped)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
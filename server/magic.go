@@ -0,0 +1,192 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Signing back in without a new link. A device whose client_session is
+// gone (the cookie lapsed, storage was cleared, or it was offline past a
+// rotation's grace period) can ask for a magic link by email, if its link
+// was claimed from an invitation and so has a verified address. A magic
+// link works once, for 15 minutes, and signs the device in with a session
+// of its own for the link, as opening the link would (see sessions.go):
+// the link's token and its other devices are untouched. As with invites,
+// opening it shows a page whose button signs in, so a mail scanner fetching
+// it doesn't use it up.
+//
+// Magic links go to BASE_URL only, never the origin a request claims, so a
+// forged Host header can't send someone a link to another server.
+
+const magicLinkTTL = 15 * time.Minute
+
+// magicLinkLimiter counts requests per IP and per address.
+var magicLinkLimiter = newRateLimiter(5, 15*time.Minute)
+
+// LinksByEmail returns the unexpired links with the verified address.
+func (db *DB) LinksByEmail(email string, now int64) ([]AccessLink, error) {
+	rows, err := db.Query(
+		"SELECT "+accessLinkColumns+" FROM access_links WHERE email = ? AND (expires_at IS NULL OR expires_at > ?)",
+		strings.ToLower(email), now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []AccessLink
+	for rows.Next() {
+		l, err := scanAccessLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *l)
+	}
+	return links, rows.Err()
+}
+
+// CreateMagicLink returns a one-time token for signing in to the link.
+func (db *DB) CreateMagicLink(link *AccessLink, now time.Time) (string, error) {
+	token := generateToken(16)
+	_, err := db.Exec(
+		"INSERT INTO magic_links (id, link_id, family_id, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		hashToken(token), link.ID, link.FamilyID, now.UnixMilli(), now.Add(magicLinkTTL).UnixMilli(),
+	)
+	return token, err
+}
+
+// UseMagicLink spends a magic link and returns its link. Unknown, used and
+// expired magic links, and ones whose link is gone, are all sql.ErrNoRows.
+func (db *DB) UseMagicLink(token string, now int64) (*AccessLink, error) {
+	var linkID string
+	if err := db.QueryRow(
+		`UPDATE magic_links SET used_at = ?
+		 WHERE id = ? AND used_at IS NULL AND expires_at > ?
+		 RETURNING link_id`,
+		now, hashToken(token), now,
+	).Scan(&linkID); err != nil {
+		return nil, err
+	}
+	link, err := scanAccessLink(db.QueryRow("SELECT "+accessLinkColumns+" FROM access_links WHERE token = ?", linkID))
+	if err != nil {
+		return nil, err
+	}
+	if link.ExpiresAt != nil && now > *link.ExpiresAt {
+		return nil, sql.ErrNoRows
+	}
+	return link, nil
+}
+
+// handleMagicLinkRequest handles POST /api/v1/session/magic: {"email"}
+// mails a magic link for each link with that verified address. The answer
+// is the same whether or not there are any, and the mail goes out in the
+// background, so addresses can't be probed.
+func (s *Server) handleMagicLinkRequest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil {
+		validationError(w, map[string]string{"email": "must be an email address"})
+		return
+	}
+	if s.opts.Mailer == nil || s.opts.BaseURL == "" {
+		jsonError(w, http.StatusNotImplemented, errCodeUnavailable, "this server can't send sign-in links")
+		return
+	}
+	email := strings.ToLower(addr.Address)
+	if !magicLinkLimiter.Allow("ip:"+clientIP(r)) || !magicLinkLimiter.Allow("email:"+email) {
+		w.Header().Set("Retry-After", "900")
+		jsonError(w, http.StatusTooManyRequests, errCodeRateLimited, "too many sign-in requests")
+		return
+	}
+
+	now := time.Now()
+	links, err := s.db.LinksByEmail(email, now.UnixMilli())
+	if err != nil {
+		serverError(w, "failed to look up links", err)
+		return
+	}
+	var lines []string
+	for i := range links {
+		f, err := s.db.GetFamily(links[i].FamilyID)
+		if err != nil || f.Archived {
+			continue
+		}
+		token, err := s.db.CreateMagicLink(&links[i], now)
+		if err != nil {
+			serverError(w, "failed to create magic link", err)
+			return
+		}
+		lines = append(lines, f.Name+":\n"+s.opts.BaseURL+s.basePath+"/magic/"+token)
+	}
+	if len(lines) > 0 {
+		body := "Open the link for the family you want to sign back in to, on the device to sign in:\n\n" +
+			strings.Join(lines, "\n\n") +
+			fmt.Sprintf("\n\nEach works once, within %d minutes. If you didn't ask for this, you can ignore it.\n", int(magicLinkTTL/time.Minute))
+		go func() {
+			if err := s.opts.Mailer.SendMail(email, "Sign back in to "+s.appName(""), body); err != nil {
+				slog.Warn("failed to send magic link", "error", err)
+			}
+		}()
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]string{"status": "sent if known"})
+}
+
+// handleMagicLink handles GET /magic/{token}: the page to sign in, which
+// posts back to useMagicLink.
+func (s *Server) handleMagicLink(w http.ResponseWriter, r *http.Request) {
+	if s.maintenance.State().Enabled {
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		http.Error(w, "The server is under maintenance. Open the link again later.", http.StatusServiceUnavailable)
+		return
+	}
+	s.serveConfirm(w, confirmPage{
+		Title:   "Sign back in",
+		Message: fmt.Sprintf("Sign in to %s on this device. The link works once.", s.appName("")),
+		Button:  "Sign in",
+	})
+}
+
+// useMagicLink handles POST /magic/{token}: signs the device in with a new
+// session for the link and opens the app.
+func (s *Server) useMagicLink(w http.ResponseWriter, r *http.Request) {
+	if s.maintenance.State().Enabled {
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		http.Error(w, "The server is under maintenance. Open the link again later.", http.StatusServiceUnavailable)
+		return
+	}
+	link, err := s.db.UseMagicLink(r.PathValue("token"), time.Now().UnixMilli())
+	if err == sql.ErrNoRows {
+		http.Error(w, "This sign-in link has expired or was already used. Ask for a new one.", http.StatusGone)
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to use magic link", err)
+		return
+	}
+	slog.Info("signed in by magic link", "family_id", link.FamilyID, "link_id", link.ID)
+
+	if err := s.startSession(w, r, link); err != nil {
+		serverError(w, "failed to start session", err)
+		return
+	}
+	s.openApp(w, r, link)
+}
+
+// handleSessionCheck handles GET /api/v1/session: 204 if the device's
+// session is good, else 401, so clients can tell an expired session from
+// a dropped connection.
+func (s *Server) handleSessionCheck(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
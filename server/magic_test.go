@@ -0,0 +1,94 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMagicLink(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	mux := s.routes()
+	family, _ := s.db.CreateFamily("Smith", "")
+	inv := &Invite{FamilyID: family.ID, Email: "Nan@Example.com", Label: "nan", Role: roleFull, ExpiresAt: time.Now().Add(time.Hour).UnixMilli()}
+	claim, _ := s.db.CreateInvite(inv)
+	_, link, err := s.db.ClaimInvite(claim, time.Now().UnixMilli())
+	if err != nil || link.Email != "nan@example.com" {
+		t.Fatalf("claimed %+v, %v", link, err)
+	}
+
+	request := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/session/magic", strings.NewReader(body)))
+		return w
+	}
+	get := func(path, session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: "client_session", Value: session})
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request(`{"email": "nan@example.com"}`); w.Code != http.StatusNotImplemented {
+		t.Errorf("without a mailer: %d", w.Code)
+	}
+	mailer := &fakeMailer{}
+	s.opts.Mailer, s.opts.BaseURL = mailer, "https://babytrack.example"
+	if w := request(`{"email": "nobody@example.com"}`); w.Code != http.StatusAccepted {
+		t.Errorf("unknown address: %d", w.Code)
+	}
+	if w := request(`{"email": "NAN@example.com"}`); w.Code != http.StatusAccepted {
+		t.Fatalf("request: %d %s", w.Code, w.Body)
+	}
+	sent := mailer.waitSent(t, 1)
+	path := regexp.MustCompile(`https://babytrack\.example(/magic/\w+)`).FindStringSubmatch(sent[0].body)
+	if len(sent) != 1 || sent[0].to != "nan@example.com" || path == nil {
+		t.Fatalf("sent %+v", sent)
+	}
+
+	// Opening the link only asks; a mail scanner fetching it doesn't use it
+	if w := get(path[1], ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post">`) {
+		t.Fatalf("magic link page: %d %s", w.Code, w.Body)
+	}
+	use := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		return w
+	}
+
+	w := use(path[1])
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/?family="+family.ID {
+		t.Fatalf("magic link: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	var session string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "client_session" {
+			session = c.Value
+		}
+	}
+	if session == "" || session == link.Token {
+		t.Fatalf("session cookie %q", session)
+	}
+	if got, err := s.db.ValidateAccessLink(session); err != nil || got.ID != link.ID || got.sess == nil {
+		t.Errorf("session link = %+v, %v", got, err)
+	}
+	if w := use(path[1]); w.Code != http.StatusGone {
+		t.Errorf("second use: %d", w.Code)
+	}
+	if w := get("/api/v1/session", session); w.Code != http.StatusNoContent {
+		t.Errorf("session check: %d", w.Code)
+	}
+
+	// Revoking the link ends its sessions
+	s.db.DeleteAccessLink(family.ID, link.ID)
+	if w := get("/api/v1/session", session); w.Code != http.StatusUnauthorized {
+		t.Errorf("session check after revoke: %d", w.Code)
+	}
+}
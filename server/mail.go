@@ -0,0 +1,66 @@
+package babytrack
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Mailer sends plain-text email. babytrackd sends through the SMTP server
+// in SMTP_URL; embedders can supply their own in Options.
+type Mailer interface {
+	SendMail(to, subject, body string) error
+}
+
+// smtpMailer submits mail with STARTTLS where the server offers it. Login
+// credentials are only sent over TLS or to localhost.
+type smtpMailer struct {
+	addr string
+	from mail.Address
+	auth smtp.Auth
+}
+
+// newSMTPMailer parses smtp://[user:pass@]host[:port] (port 587 by
+// default) and the From address.
+func newSMTPMailer(rawURL, from string) (*smtpMailer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "smtp" || u.Hostname() == "" {
+		return nil, errors.New("expected smtp://[user:pass@]host[:port]")
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("MAIL_FROM: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "587"
+	}
+	m := &smtpMailer{addr: net.JoinHostPort(u.Hostname(), port), from: *sender}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		m.auth = smtp.PlainAuth("", u.User.Username(), pass, u.Hostname())
+	}
+	return m, nil
+}
+
+func (m *smtpMailer) SendMail(to, subject, body string) error {
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return err
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n",
+		m.from.String(), rcpt.String(), mime.QEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(m.addr, m.auth, m.from.Address, []string{rcpt.Address}, []byte(msg.String()))
+}
@@ -1,63 +1,318 @@
-package main
+package babytrack
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const version = "0.1.0"
 
+// apiPrefix is the path prefix for versioned client-facing endpoints.
+// Bump together with protocolVersion when making breaking changes.
+const apiPrefix = "/api/v1"
+
+// protocolVersion is sent in the WS init message so clients can detect
+// servers that speak a newer or older protocol than they were built for.
+const protocolVersion = 1
+
+// Server is babytrackd's HTTP server; see New and NewServer in server.go
+// for embedding it, and Main for running it as a daemon.
 type Server struct {
-	db  *DB
-	hub *Hub
+	db          Store
+	hub         *Hub
+	health      healthLimits
+	quotas      Quotas        // per-family defaults; see quota.go
+	bounds      EntryBounds   // sanity limits on entries; see bounds.go
+	rotation    linkRotation  // access link token rotation; see rotate.go
+	sessions    sessionPolicy // device session expiry and rotation; see sessions.go
+	lifecycle   lifecycle     // idle family warnings, archiving and erasure; see lifecycle.go
+	digest      string        // DIGEST_WEBHOOK_URL; see digest.go
+	tuning      sync.RWMutex  // guards the settings above that Reload changes; see reload.go
+	ready       readiness
+	maintenance maintenance   // read-only mode; see maintenance.go
+	summaries   summaryCache  // built daily summaries; see summary_cache.go
+	reminders   feedReminders // see reminders.go
+	basePath    string        // e.g. "/babytrack"; empty when served at the root
+	staticDir   string        // pages, scripts and stylesheets; "static" if empty
+	instance    string        // this process, as a lease holder; see lease.go
+
+	opts    Options
+	handler http.Handler       // routes with middleware; see New
+	stop    context.CancelFunc // stops background work
+	closers []func() error     // what Start opened, for Close
 }
 
-func main() {
+// Main runs babytrackd: a CLI command if given one, else the server,
+// configured from flags and the environment, until SIGINT or SIGTERM.
+func Main() {
+	demo := flag.Bool("demo", false, "seed a demo family with two weeks of sample data at /t/demo")
+	demoReset := flag.Bool("demo-reset", false, "with --demo, reseed the demo family every night")
+	defineSettingFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), cliUsage, "\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	envFileErr := loadSettings()
 	initLogger()
+	if envFileErr != nil {
+		slog.Error("failed to read ENV_FILE", "error", envFileErr)
+		os.Exit(1)
+	}
+	initReporter()
 
-	port := os.Getenv("PORT")
+	port := setting("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "babytrack.db"
+	proxies, err := parseTrustedProxies(setting("TRUSTED_PROXIES"))
+	if err != nil {
+		slog.Error("invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	trustedProxies = proxies
+
+	opts := OptionsFromEnv()
+	opts.Demo, opts.DemoReset = *demo, *demoReset
+	opts.ReloadOptions = optionsFromEnvFile
+
+	if flag.NArg() > 0 {
+		if err := runCLI(flag.Args(), opts.DBPath, opts.DBKey, opts.BaseURL+opts.BasePath, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	db, err := NewDB(dbPath)
+	s := New(opts)
+
+	// Listen before migrating so probes can observe startup progress.
+	// Under systemd socket activation the listening socket is inherited.
+	ln, err := systemdListener()
 	if err != nil {
-		slog.Error("failed to open database", "error", err)
+		slog.Error("failed to use activated socket", "error", err)
+		os.Exit(1)
+	}
+	if ln == nil {
+		ln, err = net.Listen("tcp", ":"+port)
+		if err != nil {
+			slog.Error("failed to listen", "error", err)
+			os.Exit(1)
+		}
+	}
+	srv := &http.Server{Handler: s}
+	slog.Info("babytrackd starting", "version", version, "addr", ln.Addr().String())
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("server error", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	sdNotify("STATUS=migrating database")
+	if err := s.Start(); err != nil {
+		slog.Error("failed to start", "error", err)
+		s.Close()
 		os.Exit(1)
 	}
-	defer db.Close()
+	defer s.Close()
 
-	// Bootstrap admin if configured
-	adminUser := os.Getenv("ADMIN_USER")
-	adminPass := os.Getenv("ADMIN_PASS")
-	if adminUser != "" && adminPass != "" {
-		if err := db.EnsureAdmin(adminUser, adminPass); err != nil {
-			slog.Error("failed to create admin", "error", err)
+	stopGRPC := func() {}
+	if port := setting("GRPC_PORT"); port != "" {
+		if stopGRPC, err = s.serveGRPC(port); err != nil {
+			slog.Error("failed to listen for grpc", "error", err)
 			os.Exit(1)
 		}
 	}
 
-	s := &Server{db: db, hub: NewHub(db)}
+	slog.Info("babytrackd ready")
+	if _, err := sdNotify("READY=1\nSTATUS=serving"); err != nil {
+		slog.Warn("sd_notify failed", "error", err)
+	}
+	if interval := sdWatchdogInterval(); interval > 0 {
+		go func() {
+			for range time.Tick(interval) {
+				sdNotify("WATCHDOG=1")
+			}
+		}()
+	}
+
+	// SIGHUP reloads settings; see reload.go
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			s.reloadFromOptions()
+		}
+	}()
+
+	// Graceful shutdown: fail readiness, give load balancers time to notice,
+	// then drain HTTP requests and close WebSockets.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-stop
+	slog.Info("shutting down", "signal", sig.String())
+
+	s.ready.Set("draining")
+	sdNotify("STOPPING=1")
+	time.Sleep(time.Duration(envInt("SHUTDOWN_DRAIN_SECONDS", 5)) * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.hub.CloseAll()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("shutdown error", "error", err)
+	}
+	stopGRPC()
+}
+
+// OptionsFromEnv returns DefaultOptions with the environment's settings;
+// see the environment variables in docs/backend.md.
+func OptionsFromEnv() Options {
+	opts := DefaultOptions()
+	if path := setting("DB_PATH"); path != "" {
+		opts.DBPath = path
+	}
+	opts.DBKey = setting("DB_KEY")
+	opts.DefaultConfigFile = setting("DEFAULT_CONFIG_FILE")
+	opts.AdminUser, opts.AdminPass = setting("ADMIN_USER"), setting("ADMIN_PASS")
+	opts.BasePath = parseBasePath(setting("BASE_PATH"))
+	opts.BaseURL = strings.TrimSuffix(setting("BASE_URL"), "/")
+	if smtpURL := setting("SMTP_URL"); smtpURL != "" {
+		if m, err := newSMTPMailer(smtpURL, setting("MAIL_FROM")); err != nil {
+			slog.Error("ignoring invalid SMTP_URL or MAIL_FROM", "error", err)
+		} else {
+			opts.Mailer = m
+		}
+	}
+	if sid := setting("TWILIO_ACCOUNT_SID"); sid != "" {
+		if t, err := newTwilioSender(sid, setting("TWILIO_AUTH_TOKEN"), setting("TWILIO_FROM")); err != nil {
+			slog.Error("ignoring invalid Twilio settings", "error", err)
+		} else {
+			opts.SMS = t
+		}
+	}
+	opts.BusURL = setting("HUB_BUS_URL")
+	opts.MaxConnsPerFamily = envInt("MAX_CONNS_PER_FAMILY", opts.MaxConnsPerFamily)
+	opts.MaxConnsPerLink = envInt("MAX_CONNS_PER_LINK", opts.MaxConnsPerLink)
+	opts.MaxWALBytes = int64(envInt("HEALTH_MAX_WAL_MB", int(opts.MaxWALBytes>>20))) << 20
+	opts.MinFreeBytes = int64(envInt("HEALTH_MIN_FREE_MB", int(opts.MinFreeBytes>>20))) << 20
+	opts.Quotas = Quotas{
+		EntriesPerDay: envInt("QUOTA_ENTRIES_PER_DAY", opts.Quotas.EntriesPerDay),
+		DataBytes:     int64(envInt("QUOTA_DATA_MB", int(opts.Quotas.DataBytes>>20))) << 20,
+		Links:         envInt("QUOTA_LINKS", opts.Quotas.Links),
+	}
+	opts.Bounds.MaxFuture = time.Duration(envInt("ENTRY_MAX_FUTURE_MINUTES", int(opts.Bounds.MaxFuture/time.Minute))) * time.Minute
+	opts.Bounds.MaxAge = time.Duration(envInt("ENTRY_MAX_AGE_DAYS", int(opts.Bounds.MaxAge/(24*time.Hour)))) * 24 * time.Hour
+	opts.Bounds.MaxValueLen = envInt("ENTRY_MAX_VALUE_LEN", opts.Bounds.MaxValueLen)
+	opts.LinkRotation = time.Duration(envInt("LINK_ROTATION_HOURS", 0)) * time.Hour
+	opts.LinkRotationGrace = time.Duration(envInt("LINK_ROTATION_GRACE_HOURS", int(opts.LinkRotationGrace/time.Hour))) * time.Hour
+	opts.SessionTTL = time.Duration(envInt("SESSION_TTL_DAYS", int(opts.SessionTTL/(24*time.Hour)))) * 24 * time.Hour
+	opts.SessionRotation = time.Duration(envInt("SESSION_ROTATION_HOURS", int(opts.SessionRotation/time.Hour))) * time.Hour
+	opts.Lifecycle = LifecyclePolicy{
+		WarnDays:    envInt("LIFECYCLE_WARN_DAYS", 0),
+		ArchiveDays: envInt("LIFECYCLE_ARCHIVE_DAYS", 0),
+		PurgeDays:   envInt("LIFECYCLE_PURGE_DAYS", 0),
+	}
+	if !opts.Lifecycle.purgeAfterArchive() {
+		slog.Error("ignoring LIFECYCLE_PURGE_DAYS not more than LIFECYCLE_ARCHIVE_DAYS",
+			"purge_days", opts.Lifecycle.PurgeDays, "archive_days", opts.Lifecycle.ArchiveDays)
+		opts.Lifecycle.PurgeDays = 0
+	}
+	opts.LifecycleWebhook = setting("LIFECYCLE_WEBHOOK_URL")
+	opts.DigestWebhook = setting("DIGEST_WEBHOOK_URL")
+	opts.DigestHour = envInt("DIGEST_HOUR", opts.DigestHour)
+	opts.DigestQuietDays = envInt("DIGEST_QUIET_DAYS", opts.DigestQuietDays)
+	opts.SnapshotInterval = time.Duration(envInt("SNAPSHOT_INTERVAL_MINUTES", int(opts.SnapshotInterval/time.Minute))) * time.Minute
+	opts.LogLevel = setting("LOG_LEVEL")
+	opts.ClientLogIPLimit = envInt("CLIENT_LOG_IP_LIMIT", opts.ClientLogIPLimit)
+	opts.ClientLogFamilyLimit = envInt("CLIENT_LOG_FAMILY_LIMIT", opts.ClientLogFamilyLimit)
+	return opts
+}
+
+func (s *Server) routes() *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Static files
-	mux.HandleFunc("GET /admin", serveFile("admin.html"))
-	mux.HandleFunc("GET /", serveFile("babytrack.html"))
-	mux.HandleFunc("GET /babytrack.css", serveFile("babytrack.css"))
-	mux.HandleFunc("GET /babytrack.js", serveFile("babytrack.js"))
-	mux.HandleFunc("GET /sync-client.js", serveFile("sync-client.js"))
+	mux.HandleFunc("GET /admin", s.serveBranded("admin.html"))
+	mux.HandleFunc("GET /", s.serveBranded("babytrack.html"))
+	mux.HandleFunc("GET /summary", s.serveFile("summary.html"))
+	mux.HandleFunc("GET /babytrack.css", s.serveFile("babytrack.css"))
+	mux.HandleFunc("GET /babytrack.js", s.serveFile("babytrack.js"))
+	mux.HandleFunc("GET /sync-client.js", s.serveFile("sync-client.js"))
 
 	// Public
-	mux.HandleFunc("GET /health", healthHandler)
-	mux.HandleFunc("POST /log", handleClientLog)
+	mux.HandleFunc("GET "+apiPrefix+"/health", s.handleHealth)
+	mux.HandleFunc("GET "+apiPrefix+"/branding", s.handleBranding)
+	mux.HandleFunc("GET /healthz/ready", s.handleReadyHealth)
+	mux.HandleFunc("GET /livez", handleLive)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	mux.HandleFunc("GET /startupz", s.handleStartupz)
+	mux.HandleFunc("POST "+apiPrefix+"/log", s.handleClientLog)
+	mux.HandleFunc("GET "+apiPrefix+"/ws", s.handleWebSocket)
 	mux.HandleFunc("GET /t/{token}", s.handleClientToken)
+	mux.HandleFunc("POST /t/{token}", s.useClientToken)
+	mux.HandleFunc("GET /invite/{token}", s.handleInvite)
+	mux.HandleFunc("POST /invite/{token}", s.claimInvite)
+	mux.HandleFunc("POST "+apiPrefix+"/session", s.handleSession)
+	mux.HandleFunc("GET "+apiPrefix+"/session", s.summaryAllowed(s.handleSessionCheck))
+	mux.HandleFunc("POST "+apiPrefix+"/session/magic", s.handleMagicLinkRequest)
+	mux.HandleFunc("GET /magic/{token}", s.handleMagicLink)
+	mux.HandleFunc("POST /magic/{token}", s.useMagicLink)
+	mux.HandleFunc("PATCH "+apiPrefix+"/link", s.summaryAllowed(s.handleRenameLink))
+	mux.HandleFunc("GET "+apiPrefix+"/device/settings", s.summaryAllowed(s.handleGetDeviceSettings))
+	mux.HandleFunc("PATCH "+apiPrefix+"/device/settings", s.summaryAllowed(s.handleUpdateDeviceSettings))
+	mux.HandleFunc("POST "+apiPrefix+"/account", s.handleAccountSignup)
+	mux.HandleFunc("GET "+apiPrefix+"/account", s.accountRequired(s.handleGetAccount))
+	mux.HandleFunc("DELETE "+apiPrefix+"/account", s.accountRequired(s.handleDeleteAccount))
+	mux.HandleFunc("POST "+apiPrefix+"/account/login", s.handleAccountLogin)
+	mux.HandleFunc("POST "+apiPrefix+"/account/logout", s.handleAccountLogout)
+	mux.HandleFunc("POST "+apiPrefix+"/account/families", s.accountRequired(s.summaryAllowed(s.handleAddAccountFamily)))
+	mux.HandleFunc("DELETE "+apiPrefix+"/account/families/{family_id}", s.accountRequired(s.handleRemoveAccountFamily))
+	mux.HandleFunc("POST "+apiPrefix+"/account/families/{family_id}/open", s.accountRequired(s.handleOpenAccountFamily))
+	mux.HandleFunc("GET "+apiPrefix+"/devices", s.clientRequired(s.handleListDevices))
+	mux.HandleFunc("DELETE "+apiPrefix+"/devices/{id}", s.clientRequired(s.handleRevokeDevice))
+	mux.HandleFunc("GET "+apiPrefix+"/temperature", s.clientRequired(s.handleTemperature))
+	mux.HandleFunc("GET "+apiPrefix+"/analytics/nappies", s.clientRequired(s.handleNappyAnalytics))
+	mux.HandleFunc("GET "+apiPrefix+"/analytics/heatmap", s.clientRequired(s.handleHeatmap))
+	mux.HandleFunc("GET "+apiPrefix+"/analytics/series", s.clientRequired(s.handleSeries))
+	mux.HandleFunc("GET "+apiPrefix+"/predictions", s.summaryAllowed(s.handlePredictions))
+	mux.HandleFunc("GET "+apiPrefix+"/reminders/feed", s.summaryAllowed(s.handleFeedReminder))
+	mux.HandleFunc("GET "+apiPrefix+"/status", s.summaryAllowed(s.handleStatus))
+	mux.HandleFunc("GET "+apiPrefix+"/summary", s.summaryAllowed(s.handleSummary))
+	mux.HandleFunc("GET "+apiPrefix+"/timeline", s.clientRequired(s.handleTimeline))
+	mux.HandleFunc("GET "+apiPrefix+"/state", s.summaryAllowed(s.handleState))
+	mux.HandleFunc("GET "+apiPrefix+"/calendar", s.clientRequired(s.handleClientCalendar))
+	mux.HandleFunc("GET /cal/{file}", s.handleCalendar)
+	mux.HandleFunc("POST "+apiPrefix+"/entries/batch", s.clientRequired(s.handleEntryBatch))
+	mux.HandleFunc("POST "+apiPrefix+"/voice", bearerSession(s.clientRequired(s.handleVoice)))
+	mux.HandleFunc("GET "+apiPrefix+"/tombstones", s.clientRequired(s.handleTombstones))
+	mux.HandleFunc("GET "+apiPrefix+"/snapshot", s.clientRequired(s.handleSnapshot))
+	mux.HandleFunc("POST "+apiPrefix+"/share", s.clientRequired(s.handleCreateShare))
+	mux.HandleFunc("GET "+apiPrefix+"/takeout", s.clientRequired(s.handleTakeout))
+	mux.HandleFunc("GET /share/{family}/{date}", s.handleShare)
+
+	// Legacy unversioned paths, kept for PWAs installed before /api/v1
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("POST /log", s.handleClientLog)
 	mux.HandleFunc("GET /ws", s.handleWebSocket)
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		mux.Handle(method+" /api/", apiLatest(mux))
+	}
 
 	// Admin auth
 	mux.HandleFunc("POST /admin/login", s.adminLogin)
@@ -66,30 +321,115 @@ func main() {
 	// Admin API (protected)
 	mux.HandleFunc("GET /admin/families", s.adminRequired(s.listFamilies))
 	mux.HandleFunc("POST /admin/families", s.adminRequired(s.createFamily))
+	mux.HandleFunc("POST /admin/families/archive-inactive", s.adminRequired(s.archiveInactive))
+	mux.HandleFunc("GET /admin/export/families.csv", s.adminRequired(s.exportFamiliesCSV))
 	mux.HandleFunc("GET /admin/families/{id}", s.adminRequired(s.getFamily))
 	mux.HandleFunc("PATCH /admin/families/{id}", s.adminRequired(s.updateFamily))
 	mux.HandleFunc("GET /admin/families/{id}/summary", s.adminRequired(s.getFamilySummary))
 	mux.HandleFunc("GET /admin/families/{id}/links", s.adminRequired(s.listAccessLinks))
 	mux.HandleFunc("POST /admin/families/{id}/links", s.adminRequired(s.createAccessLink))
+	mux.HandleFunc("POST /admin/families/{id}/invite", s.adminRequired(s.createInvite))
+	mux.HandleFunc("PATCH /admin/families/{id}/links/{token}", s.adminRequired(s.updateAccessLink))
 	mux.HandleFunc("DELETE /admin/families/{id}/links/{token}", s.adminRequired(s.deleteAccessLink))
+	mux.HandleFunc("GET /admin/families/{id}/devices", s.adminRequired(s.listDevices))
+	mux.HandleFunc("GET /admin/families/{id}/devices/signed-in", s.adminRequired(s.listSignedInDevices))
+	mux.HandleFunc("GET /admin/ws", s.adminRequired(s.handleAdminWebSocket))
+	mux.HandleFunc("GET /admin/stats", s.adminRequired(s.getStats))
+	mux.HandleFunc("GET /admin/lifecycle", s.adminRequired(s.getLifecycle))
+	mux.HandleFunc("GET /admin/digest", s.adminRequired(s.getDigest))
+	mux.HandleFunc("POST /admin/reload", s.adminRequired(s.handleReload))
+	mux.HandleFunc("POST /admin/db/check", s.adminRequired(s.adminCheckDB))
+	mux.HandleFunc("GET /admin/orgs", s.adminRequired(s.listOrgs))
+	mux.HandleFunc("POST /admin/orgs", s.adminRequired(s.createOrg))
+	mux.HandleFunc("POST /admin/orgs/{org}/admins", s.adminRequired(s.createOrgAdmin))
+	mux.HandleFunc("PUT /admin/orgs/{org}/branding", s.adminRequired(s.setOrgBranding))
+	mux.HandleFunc("GET /admin/branding", s.adminRequired(s.getBranding))
+	mux.HandleFunc("PUT /admin/branding", s.adminRequired(s.setBranding))
+	mux.HandleFunc("GET /admin/config/default", s.adminRequired(s.getDefaultConfig))
+	mux.HandleFunc("PUT /admin/config/default", s.adminRequired(s.setDefaultConfig))
+	mux.HandleFunc("DELETE /admin/config/default", s.adminRequired(s.clearDefaultConfig))
+	mux.HandleFunc("POST /admin/announce", s.adminRequired(s.handleAnnounce))
+	mux.HandleFunc("GET /admin/maintenance", s.adminRequired(s.getMaintenance))
+	mux.HandleFunc("PUT /admin/maintenance", s.adminRequired(s.setMaintenance))
+	mux.HandleFunc("GET /admin/announcements", s.adminRequired(s.listAnnouncements))
+	mux.HandleFunc("DELETE /admin/announcements/{id}", s.adminRequired(s.deleteAnnouncement))
+	mux.HandleFunc("GET /admin/families/{id}/logs", s.adminRequired(s.listClientLogs))
+	mux.HandleFunc("GET /admin/families/{id}/activity", s.adminRequired(s.getFamilyActivity))
+	mux.HandleFunc("POST /admin/families/{id}/import", s.adminRequired(s.importEntries))
+	mux.HandleFunc("GET /admin/families/{id}/entries", s.adminRequired(s.listEntries))
+	mux.HandleFunc("POST /admin/families/{id}/entries/restore", s.adminRequired(s.restoreEntries))
+	mux.HandleFunc("POST /admin/families/{id}/erase", s.adminRequired(s.requestErasure))
+	mux.HandleFunc("POST /admin/families/{id}/erase/confirm", s.adminRequired(s.confirmErasure))
+	mux.HandleFunc("GET /admin/families/{id}/erasures", s.adminRequired(s.listErasures))
+	mux.HandleFunc("POST /admin/families/{id}/config/copy", s.adminRequired(s.copyConfig))
+	mux.HandleFunc("GET /admin/families/{id}/config/revisions", s.adminRequired(s.listConfigRevisions))
+	mux.HandleFunc("GET /admin/families/{id}/config/revisions/{rev}", s.adminRequired(s.getConfigRevision))
+	mux.HandleFunc("POST /admin/families/{id}/config/revisions/{rev}/restore", s.adminRequired(s.restoreConfigRevision))
+	mux.HandleFunc("GET /admin/families/{id}/settings", s.adminRequired(s.getFamilySettings))
+	mux.HandleFunc("PUT /admin/families/{id}/settings", s.adminRequired(s.updateFamilySettings))
+	mux.HandleFunc("GET /admin/families/{id}/quota", s.adminRequired(s.getFamilyQuota))
+	mux.HandleFunc("GET /admin/families/{id}/temperature", s.adminRequired(s.adminTemperature))
+	mux.HandleFunc("GET /admin/families/{id}/analytics/nappies", s.adminRequired(s.adminNappyAnalytics))
+	mux.HandleFunc("GET /admin/families/{id}/analytics/heatmap", s.adminRequired(s.adminHeatmap))
+	mux.HandleFunc("GET /admin/families/{id}/analytics/series", s.adminRequired(s.adminSeries))
+	mux.HandleFunc("GET /admin/families/{id}/timeline", s.adminRequired(s.adminTimeline))
+	mux.HandleFunc("GET /admin/families/{id}/calendar", s.adminRequired(s.getCalendar))
+	mux.HandleFunc("POST /admin/families/{id}/calendar", s.adminRequired(s.rotateCalendar))
+	mux.HandleFunc("DELETE /admin/families/{id}/calendar", s.adminRequired(s.disableCalendar))
+	mux.HandleFunc("POST /admin/families/{id}/share", s.adminRequired(s.adminCreateShare))
 
 	// Add session validation route
 	mux.HandleFunc("GET /admin/session", s.validateSession)
 
-	slog.Info("babytrackd starting", "version", version, "port", port)
-	if err := http.ListenAndServe(":"+port, loggingMiddleware(mux)); err != nil {
-		slog.Error("server error", "error", err)
-		os.Exit(1)
+	return mux
+}
+
+// apiLatest serves unversioned /api/... paths with the current API version,
+// so /api/health behaves like /api/v1/health.
+func apiLatest(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+			// Already versioned but unmatched; don't loop back into the mux
+			jsonError(w, http.StatusNotFound, errCodeNotFound, "not found")
+			return
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = apiPrefix + strings.TrimPrefix(r.URL.Path, "/api")
+		r2.URL.RawPath = ""
+		mux.ServeHTTP(w, r2)
+	})
+}
+
+// envInt reads an integer environment variable, falling back to def when it
+// is unset or invalid.
+func envInt(name string, def int) int {
+	v := setting(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("ignoring invalid integer env var", "name", name, "value", v)
+		return def
 	}
+	return n
 }
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok":true,"version":"` + version + `"}`))
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	jsonOK(w, map[string]any{"ok": true, "version": version, "maintenance": s.maintenance.State().Enabled})
 }
 
-func serveFile(name string) http.HandlerFunc {
+func (s *Server) serveFile(name string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "static/"+name)
+		http.ServeFile(w, r, s.staticPath(name))
+	}
+}
+
+// staticPath is where the named page, script or stylesheet is.
+func (s *Server) staticPath(name string) string {
+	dir := s.staticDir
+	if dir == "" {
+		dir = "static"
 	}
+	return filepath.Join(dir, name)
 }
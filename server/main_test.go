@@ -1,20 +1,23 @@
-package main
+package babytrack
 
 import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestHealthHandler(t *testing.T) {
 	req := httptest.NewRequest("GET", "/health", nil)
 	w := httptest.NewRecorder()
 
-	healthHandler(w, req)
+	(&Server{}).handleHealth(w, req)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("expected status 200, got %d", w.Code)
@@ -259,8 +262,8 @@ func TestDBMigrationIdempotent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to query version: %v", err)
 	}
-	if version != 2 {
-		t.Errorf("expected version 2, got %d", version)
+	if version != len(migrations) {
+		t.Errorf("expected version %d, got %d", len(migrations), version)
 	}
 }
 
@@ -279,8 +282,8 @@ func TestConfigHandling(t *testing.T) {
 			"category": "sleep",
 			"stateful": true,
 			"buttons": [
-				{"label": "sleeping", "timing": true, "counted": true},
-				{"label": "awake", "timing": true, "counted": false}
+				{"value": "sleeping", "label": "sleeping", "timing": true, "counted": true},
+				{"value": "awake", "label": "awake", "timing": true, "counted": false}
 			]
 		}
 	]`
@@ -302,6 +305,8 @@ func TestConfigHandling(t *testing.T) {
 
 func TestHandleClientLog(t *testing.T) {
 	initLogger()
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
 
 	tests := []struct {
 		name       string
@@ -346,7 +351,7 @@ func TestHandleClientLog(t *testing.T) {
 			req.Header.Set("Content-Type", "application/json")
 			w := httptest.NewRecorder()
 
-			handleClientLog(w, req)
+			s.handleClientLog(w, req)
 
 			if w.Code != tt.wantStatus {
 				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
@@ -354,3 +359,197 @@ func TestHandleClientLog(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIVersionedRoutes(t *testing.T) {
+	s := &Server{}
+	mux := s.routes()
+
+	for _, path := range []string{"/api/v1/health", "/api/health", "/health"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, w.Code)
+		}
+	}
+
+	// Unknown versioned paths must 404 rather than loop through apiLatest
+	req := httptest.NewRequest("GET", "/api/v1/nope", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown versioned path, got %d", w.Code)
+	}
+}
+
+func TestLogDeduper(t *testing.T) {
+	d := newLogDeduper(time.Minute)
+	now := time.Now()
+
+	if emit, _ := d.Check("k", now); !emit {
+		t.Fatal("expected first occurrence to be emitted")
+	}
+	for i := 0; i < 3; i++ {
+		if emit, _ := d.Check("k", now.Add(time.Second)); emit {
+			t.Fatal("expected duplicate within window to be suppressed")
+		}
+	}
+
+	emit, repeated := d.Check("k", now.Add(time.Minute))
+	if !emit || repeated != 3 {
+		t.Errorf("expected emit with repeated=3 after window, got emit=%v repeated=%d", emit, repeated)
+	}
+}
+
+func TestHandleClientLogRateLimit(t *testing.T) {
+	initLogger()
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	orig := clientLogIPLimiter
+	clientLogIPLimiter = newRateLimiter(1, time.Minute)
+	t.Cleanup(func() { clientLogIPLimiter = orig })
+
+	for i, want := range []int{http.StatusNoContent, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/log", bytes.NewBufferString(`[]`))
+		w := httptest.NewRecorder()
+
+		s.handleClientLog(w, req)
+
+		if w.Code != want {
+			t.Errorf("request %d: expected %d, got %d", i, want, w.Code)
+		}
+	}
+}
+
+func TestClientLogFamilyLimitKey(t *testing.T) {
+	initLogger()
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	orig := clientLogFamilyLimiter
+	clientLogFamilyLimiter = newRateLimiter(1, time.Minute)
+	t.Cleanup(func() { clientLogFamilyLimiter = orig })
+
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum phone", nil)
+
+	// An anonymous caller naming the family can't use up its limit
+	body := `[{"level":"error","message":"spam","family":"` + family.ID + `"}]`
+	s.handleClientLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/log", bytes.NewBufferString(body)))
+
+	// and a signed-in one can't dodge it by naming other families
+	body = `[{"level":"error","message":"sync stopped","family":"a"},{"level":"error","message":"still stopped","family":"b"}]`
+	req := httptest.NewRequest("POST", "/log", bytes.NewBufferString(body))
+	req.AddCookie(&http.Cookie{Name: "client_session", Value: link.Token})
+	s.handleClientLog(httptest.NewRecorder(), req)
+
+	var count int
+	s.db.(*DB).QueryRow("SELECT COUNT(*) FROM client_logs WHERE family_id = ?", family.ID).Scan(&count)
+	if count != 1 {
+		t.Errorf("expected 1 stored log within the family limit, got %d", count)
+	}
+}
+
+func TestClientLogPersistence(t *testing.T) {
+	initLogger()
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum phone", nil)
+
+	// Anonymous logs go to stdout only
+	body := `[{"level":"error","message":"anon","family":"` + family.ID + `"}]`
+	req := httptest.NewRequest("POST", "/log", bytes.NewBufferString(body))
+	s.handleClientLog(httptest.NewRecorder(), req)
+
+	// Authenticated logs are stored against the link's family
+	body = `[{"level":"error","message":"sync stopped","data":{"n":1}},{"level":"info","message":"connected"}]`
+	req = httptest.NewRequest("POST", "/log", bytes.NewBufferString(body))
+	req.AddCookie(&http.Cookie{Name: "client_session", Value: link.Token})
+	s.handleClientLog(httptest.NewRecorder(), req)
+
+	token, _ := s.db.CreateAdminSession("admin", 24*3600*1000)
+	cookie := &http.Cookie{Name: "admin_session", Value: token}
+
+	req = httptest.NewRequest("GET", "/admin/families/"+family.ID+"/logs?level=error", nil)
+	req.SetPathValue("id", family.ID)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+
+	s.adminRequired(s.listClientLogs)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var logs []ClientLog
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 stored error log, got %d: %+v", len(logs), logs)
+	}
+	if logs[0].Message != "sync stopped" || logs[0].Label != "Mum phone" || logs[0].Data != `{"n":1}` {
+		t.Errorf("unexpected log: %+v", logs[0])
+	}
+
+	// Invalid level filter
+	req = httptest.NewRequest("GET", "/admin/families/"+family.ID+"/logs?level=loud", nil)
+	req.SetPathValue("id", family.ID)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+
+	s.adminRequired(s.listClientLogs)(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid level, got %d", w.Code)
+	}
+}
+
+func TestClientLogCap(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	logs := make([]ClientLog, maxClientLogsPerFamily+10)
+	for i := range logs {
+		logs[i] = ClientLog{Ts: int64(i), Level: "info", Message: fmt.Sprint(i)}
+	}
+	if err := s.db.InsertClientLogs(family.ID, "", logs); err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	var count int
+	s.db.(*DB).QueryRow("SELECT COUNT(*) FROM client_logs WHERE family_id = ?", family.ID).Scan(&count)
+	if count != maxClientLogsPerFamily {
+		t.Errorf("expected %d rows after trim, got %d", maxClientLogsPerFamily, count)
+	}
+}
+
+func TestRedactAttr(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: redactAttr}))
+
+	log.Info("visit /t/0123456789abcdef",
+		"path", "/admin/families/f1/links/deadbeefcafe",
+		"referer", "https://x.example/invite/feedface1234",
+		"next", "/magic/0ddba11f00d",
+		"url", "https://x.example/?token=s3cret&family=f1",
+		"admin_session", "abc",
+		"password", "hunter2",
+		"family", "f1",
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"0123456789abcdef", "deadbeefcafe", "feedface1234", "0ddba11f00d", "s3cret", `"abc"`, "hunter2"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output leaked %q: %s", secret, out)
+		}
+	}
+	for _, keep := range []string{"/admin/families/f1/links/", "family=f1", `"family":"f1"`} {
+		if !strings.Contains(out, keep) {
+			t.Errorf("log output lost non-secret %q: %s", keep, out)
+		}
+	}
+}
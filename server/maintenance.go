@@ -0,0 +1,165 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Maintenance mode makes the server read-only while the admin migrates or
+// restores the database. HTTP writes get 503 with code "maintenance" and a
+// Retry-After; WebSocket clients are told, and the entries and config they
+// send meanwhile are neither saved nor acked, so they stay queued on the
+// device and are resent when maintenance ends.
+//
+// With other instances on a bus, each change is relayed to them, and every
+// instance relays its state again each RunExpiry interval, so one started
+// or cut off from the bus mid-maintenance catches up. The latest change
+// wins.
+
+// maintenanceRetryAfter is the Retry-After, in seconds, on refused writes.
+const maintenanceRetryAfter = "60"
+
+// MaintenanceState is whether the server is in maintenance mode. The zero
+// value is off.
+type MaintenanceState struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+	Since   int64  `json:"since,omitempty"` // ms
+}
+
+type maintenance struct {
+	mu      sync.RWMutex
+	state   MaintenanceState
+	changed int64 // ms; 0 if never set
+}
+
+func (m *maintenance) Set(state MaintenanceState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state, m.changed = state, max(time.Now().UnixMilli(), m.changed+1)
+}
+
+func (m *maintenance) State() MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// adopt takes another instance's state if it changed later than this one's,
+// and reports whether it did.
+func (m *maintenance) adopt(r maintenanceRelay) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r.Changed <= m.changed {
+		return false
+	}
+	m.state, m.changed = r.State, r.Changed
+	return true
+}
+
+// maintenanceRelay is an instance's maintenance state on the bus.
+type maintenanceRelay struct {
+	State   MaintenanceState `json:"state"`
+	Changed int64            `json:"changed"`
+}
+
+// relayMaintenance tells other instances this one's maintenance state, if
+// it has been set.
+func (h *Hub) relayMaintenance() {
+	if h.bus == nil || h.maintenance == nil {
+		return
+	}
+	h.maintenance.mu.RLock()
+	r := maintenanceRelay{State: h.maintenance.state, Changed: h.maintenance.changed}
+	h.maintenance.mu.RUnlock()
+	if r.Changed == 0 {
+		return
+	}
+	msg, _ := json.Marshal(r)
+	h.relay(busMessage{Kind: "maintenance", Msg: msg})
+}
+
+// receiveMaintenance adopts another instance's maintenance state if newer,
+// and tells this instance's clients.
+func (h *Hub) receiveMaintenance(msg []byte) {
+	var r maintenanceRelay
+	if h.maintenance == nil || json.Unmarshal(msg, &r) != nil {
+		return
+	}
+	if h.maintenance.adopt(r) {
+		h.broadcastAll(maintenanceMessage(r.State))
+	}
+}
+
+func maintenanceMessage(state MaintenanceState) []byte {
+	msg, _ := json.Marshal(map[string]any{
+		"type":    "maintenance",
+		"enabled": state.Enabled,
+		"message": state.Message,
+	})
+	return msg
+}
+
+// maintenanceGate refuses writes while in maintenance mode, apart from
+// signing in and out and turning maintenance off.
+func (s *Server) maintenanceGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		state := s.maintenance.State()
+		if state.Enabled {
+			switch r.URL.Path {
+			case "/admin/maintenance", "/admin/login", "/admin/logout":
+			default:
+				msg := "server is in maintenance; try again later"
+				if state.Message != "" {
+					msg = state.Message
+				}
+				w.Header().Set("Retry-After", maintenanceRetryAfter)
+				jsonError(w, http.StatusServiceUnavailable, errCodeMaintenance, msg)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// getMaintenance handles GET /admin/maintenance.
+func (s *Server) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	jsonOK(w, s.maintenance.State())
+}
+
+// setMaintenance handles PUT /admin/maintenance: {enabled, message?}.
+// Connected clients are told either way.
+func (s *Server) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled bool   `json:"enabled"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	if len(req.Message) > maxAnnouncementLen {
+		validationError(w, map[string]string{"message": "too long"})
+		return
+	}
+
+	state := MaintenanceState{}
+	if req.Enabled {
+		state = s.maintenance.State()
+		if !state.Enabled {
+			state.Since = time.Now().UnixMilli()
+		}
+		state.Enabled, state.Message = true, req.Message
+	}
+	s.maintenance.Set(state)
+	s.hub.broadcastAll(maintenanceMessage(state))
+	s.hub.relayMaintenance()
+	jsonOK(w, state)
+}
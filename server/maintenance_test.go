@@ -0,0 +1,112 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMaintenanceGate(t *testing.T) {
+	s := &Server{}
+	handler := s.maintenanceGate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := do("POST", "/api/v1/share"); w.Code != http.StatusNoContent {
+		t.Errorf("write outside maintenance: %d", w.Code)
+	}
+
+	s.maintenance.Set(MaintenanceState{Enabled: true, Message: "Restoring backup"})
+	w := do("POST", "/api/v1/share")
+	var resp struct{ Error APIError }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusServiceUnavailable || resp.Error.Code != errCodeMaintenance ||
+		resp.Error.Message != "Restoring backup" || w.Header().Get("Retry-After") == "" {
+		t.Errorf("write in maintenance: %d %s", w.Code, w.Body)
+	}
+	for _, req := range [][2]string{{"GET", "/api/v1/summary"}, {"PUT", "/admin/maintenance"}, {"POST", "/admin/login"}} {
+		if w := do(req[0], req[1]); w.Code != http.StatusNoContent {
+			t.Errorf("%s %s in maintenance: %d", req[0], req[1], w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	s.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	if !strings.Contains(w.Body.String(), `"maintenance":true`) {
+		t.Errorf("health = %s", w.Body)
+	}
+}
+
+func TestMaintenanceWebSocket(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+
+	setMaintenance := func(body string) {
+		req := httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.setMaintenance(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("set maintenance: %d %s", w.Code, w.Body)
+		}
+	}
+
+	setMaintenance(`{"enabled":true,"message":"Back at 2:30"}`)
+	if m := skipUntilType(t, conn, "maintenance"); m["enabled"] != true || m["message"] != "Back at 2:30" {
+		t.Errorf("got %v", m)
+	}
+	if !s.maintenance.State().Enabled || s.maintenance.State().Since == 0 {
+		t.Errorf("state = %+v", s.maintenance.State())
+	}
+
+	// Entries sent now aren't saved or acked
+	conn.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "e1", "ts": time.Now().UnixMilli(), "type": "feed", "value": "bf"}})
+	conn.WriteJSON(map[string]any{"type": "ping"})
+	skipUntilType(t, conn, "pong")
+	if db.EntryExists(family.ID, "e1") {
+		t.Error("entry saved during maintenance")
+	}
+
+	// Clients connecting meanwhile are told after init
+	late, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer late.Close()
+	skipUntilType(t, late, "init")
+	skipUntilType(t, late, "maintenance")
+
+	setMaintenance(`{"enabled":false}`)
+	if m := skipUntilType(t, conn, "maintenance"); m["enabled"] != false {
+		t.Errorf("got %v", m)
+	}
+	conn.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "e1", "ts": time.Now().UnixMilli(), "type": "feed", "value": "bf"}})
+	skipUntilType(t, conn, "entry_ack")
+}
@@ -0,0 +1,134 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Medication doses are "med" entries whose value is the drug (the button
+// value, e.g. "paracetamol") and whose data is MedData. A dose logged within
+// the drug's minimum interval of another dose is rejected unless the client
+// resends it with override set, in which case the rest of the family is
+// warned instead.
+
+// MedData is the structured payload of a "med" entry.
+type MedData struct {
+	Dose     float64 `json:"dose,omitempty"`
+	Unit     string  `json:"unit,omitempty"`
+	Override bool    `json:"override,omitempty"` // caregiver confirmed an early dose
+}
+
+// defaultMedIntervals apply when the family's config doesn't set
+// minIntervalMin on the drug's button.
+var defaultMedIntervals = map[string]time.Duration{
+	"paracetamol":   4 * time.Hour,
+	"acetaminophen": 4 * time.Hour,
+	"ibuprofen":     6 * time.Hour,
+}
+
+func validateMedData(e *Entry) error {
+	var m MedData
+	if err := json.Unmarshal(e.Data, &m); err != nil {
+		return errors.New("med data: " + err.Error())
+	}
+	if m.Dose < 0 {
+		return errors.New("med dose must not be negative")
+	}
+	return nil
+}
+
+// medIntervals reads per-drug minimum intervals from a family's button
+// config: buttons in the "med" group may carry minIntervalMin.
+func medIntervals(configJSON string) map[string]time.Duration {
+	var groups []struct {
+		Category string `json:"category"`
+		Buttons  []struct {
+			Value          string  `json:"value"`
+			MinIntervalMin float64 `json:"minIntervalMin"`
+		} `json:"buttons"`
+	}
+	intervals := make(map[string]time.Duration)
+	if json.Unmarshal([]byte(configJSON), &groups) != nil {
+		return intervals
+	}
+	for _, g := range groups {
+		if g.Category != "med" {
+			continue
+		}
+		for _, b := range g.Buttons {
+			if b.MinIntervalMin > 0 {
+				intervals[strings.ToLower(b.Value)] = time.Duration(b.MinIntervalMin * float64(time.Minute))
+			}
+		}
+	}
+	return intervals
+}
+
+// DoseConflict describes a dose logged too close to another dose of the
+// same drug.
+type DoseConflict struct {
+	Drug           string `json:"drug"`
+	LastDoseID     string `json:"last_dose_id"`
+	LastDoseTs     int64  `json:"last_dose_ts"`
+	MinIntervalMin int    `json:"min_interval_min"`
+}
+
+// doseConflict returns the nearest other dose of the same drug within the
+// drug's minimum interval of e (before or after, since doses can be
+// back-dated), or nil if e is safe or not a dose at all.
+func (s *Server) doseConflict(familyID string, e *Entry) (*DoseConflict, error) {
+	if e.Type != "med" || e.Deleted {
+		return nil, nil
+	}
+	drug := strings.ToLower(e.Value)
+
+	config, err := s.db.GetConfig(familyID)
+	if err != nil {
+		return nil, err
+	}
+	interval, ok := medIntervals(config)[drug]
+	if !ok {
+		interval, ok = defaultMedIntervals[drug]
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	last, err := s.db.NearestDose(familyID, e.Value, e.ID, e.Ts, interval)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &DoseConflict{
+		Drug:           e.Value,
+		LastDoseID:     last.ID,
+		LastDoseTs:     last.Ts,
+		MinIntervalMin: int(interval / time.Minute),
+	}, nil
+}
+
+// doseOverridden reports whether the caregiver confirmed an early dose.
+func doseOverridden(e *Entry) bool {
+	var m MedData
+	json.Unmarshal(e.Data, &m)
+	return m.Override
+}
+
+// NearestDose returns the live dose of drug closest in time to ts, strictly
+// within window of it, ignoring the entry excludeID itself.
+func (db *DB) NearestDose(familyID, drug, excludeID string, ts int64, window time.Duration) (*Entry, error) {
+	w := window.Milliseconds()
+	return scanEntry(db.QueryRow(
+		`SELECT `+entryColumns+`
+		 FROM entries
+		 WHERE family_id = ? AND type = 'med' AND value = ? COLLATE NOCASE AND deleted = 0
+		   AND id != ? AND ts > ? AND ts < ?
+		 ORDER BY ABS(ts - ?) LIMIT 1`,
+		familyID, drug, excludeID, ts-w, ts+w, ts,
+	))
+}
@@ -0,0 +1,91 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMedIntervals(t *testing.T) {
+	config := `[{"category":"feed","buttons":[{"value":"bf","minIntervalMin":5}]},
+		{"category":"med","buttons":[{"value":"Paracetamol","minIntervalMin":240},{"value":"vitamin-d"}]}]`
+	got := medIntervals(config)
+	if len(got) != 1 || got["paracetamol"] != 4*time.Hour {
+		t.Errorf("medIntervals = %v", got)
+	}
+	if len(medIntervals("not json")) != 0 {
+		t.Error("expected no intervals from bad config")
+	}
+}
+
+func TestDoseIntervalCheck(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	family, _ := db.CreateFamily("Test Baby", "")
+	mum, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	dad, _ := db.CreateAccessLink(family.ID, "Dad", nil)
+	db.SaveConfig(family.ID, `[{"category":"med","buttons":[{"value":"ibuprofen","minIntervalMin":360}]}]`)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+
+	dial := func(token string) *websocket.Conn {
+		header := http.Header{}
+		header.Add("Cookie", "client_session="+token)
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		skipUntilType(t, conn, "init")
+		return conn
+	}
+	mumConn := dial(mum.Token)
+	defer mumConn.Close()
+	dadConn := dial(dad.Token)
+	defer dadConn.Close()
+
+	now := time.Now().UnixMilli()
+	send := func(conn *websocket.Conn, id string, ts int64, data string) {
+		entry := `{"id":"` + id + `","ts":` + strconv.FormatInt(ts, 10) + `,"type":"med","value":"ibuprofen"`
+		if data != "" {
+			entry += `,"data":` + data
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"entry","action":"add","entry":`+entry+`}}`))
+	}
+
+	send(mumConn, "dose-1", now-2*time.Hour.Milliseconds(), `{"dose":5,"unit":"ml"}`)
+	skipUntilType(t, mumConn, "entry_ack")
+
+	// Dad doesn't know Mum already gave a dose
+	send(dadConn, "dose-2", now, `{"dose":5,"unit":"ml"}`)
+	rejected := skipUntilType(t, dadConn, "entry_rejected")
+	conflict := rejected["conflict"].(map[string]any)
+	if rejected["id"] != "dose-2" || conflict["last_dose_id"] != "dose-1" || conflict["min_interval_min"] != float64(360) {
+		t.Errorf("rejection = %v", rejected)
+	}
+	if _, err := db.NearestDose(family.ID, "ibuprofen", "dose-1", now, time.Hour); err == nil {
+		t.Fatal("rejected dose was saved")
+	}
+
+	// Confirmed: saved, and the rest of the family is warned
+	send(dadConn, "dose-2", now, `{"dose":5,"unit":"ml","override":true}`)
+	skipUntilType(t, dadConn, "entry_ack")
+	warning := skipUntilType(t, mumConn, "dose_warning")
+	if warning["id"] != "dose-2" || warning["label"] != "Dad" {
+		t.Errorf("warning = %v", warning)
+	}
+
+	// A dose outside the interval goes straight through
+	send(mumConn, "dose-3", now+7*time.Hour.Milliseconds(), "")
+	skipUntilType(t, mumConn, "entry_ack")
+}
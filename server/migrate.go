@@ -0,0 +1,200 @@
+package babytrack
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema migrations are the SQL files in migrations/, named NNN_name.sql and
+// embedded in the binary. They're applied in order at startup, each in its
+// own transaction together with its schema_version row, so one that fails
+// leaves the database as it was before it: startup stops naming it, and
+// once the cause is fixed the next start picks up from there. Append only:
+// never edit a migration that has shipped; add a new file.
+//
+// Startup code that needs Go rather than SQL (hashLinkTokens,
+// structureEntryValues) runs after the migrations, and must be safe to run
+// again.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+var migrations = loadMigrations(migrationFiles)
+
+// loadMigrations reads the migration files in order. A misnamed file or a
+// gap in the numbering is a build mistake, so it panics.
+func loadMigrations(fsys fs.FS) []migration {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		panic(err)
+	}
+	ms := make([]migration, 0, len(files))
+	for i, file := range files { // Glob sorts, and the numbers are zero-padded
+		num, name, ok := strings.Cut(strings.TrimSuffix(path.Base(file), ".sql"), "_")
+		v, err := strconv.Atoi(num)
+		if !ok || err != nil || v != i+1 || name == "" {
+			panic(fmt.Sprintf("migration %s: want %03d_name.sql", file, i+1))
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			panic(err)
+		}
+		ms = append(ms, migration{Version: v, Name: name, SQL: string(data)})
+	}
+	return ms
+}
+
+// ensureSchemaVersion creates the schema_version table, or adds the name and
+// applied_at columns to one from before they were recorded.
+func ensureSchemaVersion(q dbtx) error {
+	if _, err := q.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT,
+		applied_at INTEGER
+	)`); err != nil {
+		return err
+	}
+	var named int
+	if err := q.QueryRow("SELECT COUNT(*) FROM pragma_table_info('schema_version') WHERE name = 'name'").Scan(&named); err != nil {
+		return err
+	}
+	if named == 0 {
+		if _, err := q.Exec("ALTER TABLE schema_version ADD COLUMN name TEXT; ALTER TABLE schema_version ADD COLUMN applied_at INTEGER"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the latest applied migration, 0 for a new database.
+func schemaVersion(q dbtx) (int, error) {
+	var exists int
+	if err := q.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&exists); err != nil || exists == 0 {
+		return 0, err
+	}
+	var version int
+	err := q.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// applyMigrations applies the pending migrations and returns them. With
+// dryRun, they're all applied in one transaction that's then rolled back,
+// to show what would happen without changing anything.
+func applyMigrations(db *sql.DB, dryRun bool) ([]migration, error) {
+	var q dbtx = db
+	if dryRun {
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		q = tx
+	}
+
+	if err := ensureSchemaVersion(q); err != nil {
+		return nil, err
+	}
+	version, err := schemaVersion(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []migration
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		if dryRun {
+			err = applyMigration(q, m)
+		} else {
+			err = applyMigrationTx(db, m)
+		}
+		if err != nil {
+			return applied, fmt.Errorf("migration %03d_%s: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func applyMigrationTx(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := applyMigration(tx, m); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func applyMigration(q dbtx, m migration) error {
+	if _, err := q.Exec(m.SQL); err != nil {
+		return err
+	}
+	_, err := q.Exec(
+		"INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, time.Now().UnixMilli(),
+	)
+	return err
+}
+
+// MigrationStatus is a migration and when it was applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt int64 // ms; 0 if pending or applied before times were recorded
+}
+
+// migrationStatus lists every migration, without changing the database.
+func migrationStatus(db *sql.DB) ([]MigrationStatus, error) {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := map[int]int64{}
+	var timed int
+	if version > 0 {
+		if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('schema_version') WHERE name = 'applied_at'").Scan(&timed); err != nil {
+			return nil, err
+		}
+	}
+	if timed > 0 {
+		rows, err := db.Query("SELECT version, COALESCE(applied_at, 0) FROM schema_version")
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var v int
+			var at int64
+			if err := rows.Scan(&v, &at); err != nil {
+				return nil, err
+			}
+			appliedAt[v] = at
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i] = MigrationStatus{Version: m.Version, Name: m.Name, Applied: m.Version <= version, AppliedAt: appliedAt[m.Version]}
+	}
+	return status, nil
+}
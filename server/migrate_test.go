@@ -0,0 +1,148 @@
+package babytrack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	if len(migrations) == 0 || migrations[0].Name != "initial_schema" {
+		t.Fatalf("migrations = %d, first %+v", len(migrations), migrations[0])
+	}
+	ms := loadMigrations(fstest.MapFS{
+		"migrations/001_one.sql": {Data: []byte("SELECT 1")},
+		"migrations/002_two.sql": {Data: []byte("SELECT 2")},
+	})
+	if len(ms) != 2 || ms[1].Version != 2 || ms[1].Name != "two" || ms[1].SQL != "SELECT 2" {
+		t.Errorf("loaded %+v", ms)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("gap in numbering didn't panic")
+		}
+	}()
+	loadMigrations(fstest.MapFS{"migrations/002_two.sql": {Data: []byte("SELECT 2")}})
+}
+
+func TestMigrationFailureRollsBack(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db, err := openSQL(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	saved := migrations
+	defer func() { migrations = saved }()
+	migrations = []migration{
+		{Version: 1, Name: "one", SQL: "CREATE TABLE one (id INTEGER)"},
+		// Fails on the second statement, after the first has run
+		{Version: 2, Name: "two", SQL: "CREATE TABLE two (id INTEGER); INSERT INTO missing VALUES (1)"},
+	}
+	applied, err := applyMigrations(db, false)
+	if err == nil || !strings.Contains(err.Error(), "002_two") || len(applied) != 1 {
+		t.Fatalf("applied %+v, err %v", applied, err)
+	}
+	if v, _ := schemaVersion(db); v != 1 {
+		t.Errorf("version = %d", v)
+	}
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'two'").Scan(&n)
+	if n != 0 {
+		t.Error("failed migration left its first statement applied")
+	}
+
+	// Fixed, it applies on the next run
+	migrations[1].SQL = "CREATE TABLE two (id INTEGER)"
+	if applied, err := applyMigrations(db, false); err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("retry applied %+v, err %v", applied, err)
+	}
+}
+
+func TestMigrationDryRunAndStatus(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	run := func(args ...string) string {
+		var out bytes.Buffer
+		if err := runCLI(args, path, "", "", strings.NewReader(""), &out); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		return out.String()
+	}
+
+	out := run("db", "migrate", "--dry-run")
+	if strings.Count(out, "would apply") != len(migrations) || !strings.Contains(out, "001_initial_schema") {
+		t.Errorf("dry run = %q", out)
+	}
+	if out := run("db", "status"); strings.Count(out, "pending") != len(migrations) {
+		t.Errorf("status after dry run = %q", out)
+	}
+
+	run("db", "migrate")
+	if out := run("db", "migrate", "--dry-run"); out != "up to date\n" {
+		t.Errorf("dry run when current = %q", out)
+	}
+	if out := run("db", "status"); strings.Count(out, "applied 20") != len(migrations) {
+		t.Errorf("status = %q", out)
+	}
+}
+
+func TestMigrationUpgradesSchemaVersionTable(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db, err := openSQL(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A database from before migrations were named, stopped partway
+	db.Exec(migrations[0].SQL)
+	db.Exec("CREATE TABLE schema_version (version INTEGER PRIMARY KEY); INSERT INTO schema_version VALUES (1)")
+	if status, err := migrationStatus(db); err != nil || !status[0].Applied || status[0].AppliedAt != 0 || status[1].Applied {
+		t.Fatalf("status = %+v, %v", status[:2], err)
+	}
+	db.Close()
+
+	d, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	status, err := migrationStatus(d.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := status[len(status)-1]
+	if !last.Applied || last.AppliedAt == 0 || status[0].AppliedAt != 0 {
+		t.Errorf("status = %+v ... %+v", status[0], last)
+	}
+}
+
+func TestQueryPlansUseIndexes(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	for query, index := range map[string]string{
+		"SELECT * FROM entries WHERE family_id = ? AND ts >= ? AND ts < ? AND deleted = 0 ORDER BY ts ASC": "idx_entries_live_ts",
+		"SELECT MAX(ts) FROM entries WHERE family_id = ? AND deleted = 0":                                  "COVERING INDEX idx_entries_live_ts",
+		"SELECT * FROM entries WHERE family_id = ? AND type = ? AND ts >= ? AND ts < ? AND deleted = 0":    "idx_entries_live_type_ts",
+		"SELECT * FROM access_links WHERE family_id = ? ORDER BY created_at DESC":                          "idx_access_links_family",
+		"SELECT COUNT(*) FROM access_links WHERE family_id = ? AND (expires_at IS NULL OR expires_at > ?)": "idx_access_links_family",
+	} {
+		rows, err := s.db.(*DB).Query("EXPLAIN QUERY PLAN "+query, "f", 1, 2, 3, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var plan []string
+		for rows.Next() {
+			var id, parent, unused int
+			var detail string
+			rows.Scan(&id, &parent, &unused, &detail)
+			plan = append(plan, detail)
+		}
+		rows.Close()
+		if got := strings.Join(plan, "; "); !strings.Contains(got, index) || strings.Contains(got, "TEMP B-TREE") {
+			t.Errorf("%s\nplan: %s\nwant %s", query, got, index)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+-- Initial schema
+
+CREATE TABLE admins (
+	id TEXT PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE families (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	notes TEXT,
+	created_at INTEGER NOT NULL,
+	archived INTEGER DEFAULT 0
+);
+
+CREATE TABLE access_links (
+	token TEXT PRIMARY KEY,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	label TEXT,
+	expires_at INTEGER,
+	created_at INTEGER NOT NULL
+);
+
+CREATE TABLE admin_sessions (
+	token TEXT PRIMARY KEY,
+	admin_id TEXT NOT NULL REFERENCES admins(id),
+	expires_at INTEGER NOT NULL
+);
+
+CREATE TABLE entries (
+	id TEXT PRIMARY KEY,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	ts INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	value TEXT NOT NULL,
+	deleted INTEGER DEFAULT 0,
+	updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE configs (
+	family_id TEXT PRIMARY KEY REFERENCES families(id),
+	data TEXT NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_entries_family ON entries(family_id);
+CREATE INDEX idx_entries_updated ON entries(family_id, updated_at);
+CREATE INDEX idx_entries_ts ON entries(family_id, ts);
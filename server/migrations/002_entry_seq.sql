@@ -0,0 +1,7 @@
+-- Add seq columns for cursor-based sync
+
+ALTER TABLE families ADD COLUMN seq INTEGER DEFAULT 0;
+ALTER TABLE entries ADD COLUMN seq INTEGER DEFAULT 0;
+CREATE INDEX idx_entries_seq ON entries(family_id, seq);
+UPDATE entries SET seq = rowid;
+UPDATE families SET seq = COALESCE((SELECT MAX(seq) FROM entries WHERE family_id = families.id), 0);
@@ -0,0 +1,13 @@
+-- Persisted frontend logs, capped per family
+
+CREATE TABLE client_logs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	label TEXT,
+	ts INTEGER NOT NULL,
+	level TEXT NOT NULL,
+	message TEXT NOT NULL,
+	data TEXT,
+	url TEXT
+);
+CREATE INDEX idx_client_logs_family ON client_logs(family_id, ts);
@@ -0,0 +1,4 @@
+-- Per-link activity for presence and the admin links view
+
+ALTER TABLE access_links ADD COLUMN last_seen_at INTEGER;
+ALTER TABLE access_links ADD COLUMN last_entry_at INTEGER;
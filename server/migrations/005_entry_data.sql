@@ -0,0 +1,3 @@
+-- Structured payload for entry kinds that need more than a value
+
+ALTER TABLE entries ADD COLUMN data TEXT;
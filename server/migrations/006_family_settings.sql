@@ -0,0 +1,3 @@
+-- Per-family settings (JSON FamilySettings)
+
+ALTER TABLE families ADD COLUMN settings TEXT;
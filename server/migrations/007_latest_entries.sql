@@ -0,0 +1,3 @@
+-- Latest entry per type, for the quick-status endpoint
+
+CREATE INDEX idx_entries_type_ts ON entries(family_id, type, ts);
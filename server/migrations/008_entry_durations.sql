@@ -0,0 +1,4 @@
+-- First-class duration entries
+
+ALTER TABLE entries ADD COLUMN ended_ts INTEGER;
+ALTER TABLE entries ADD COLUMN ongoing INTEGER DEFAULT 0;
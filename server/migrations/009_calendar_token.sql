@@ -0,0 +1,4 @@
+-- Secret token for the family's read-only calendar feed
+
+ALTER TABLE families ADD COLUMN calendar_token TEXT;
+CREATE UNIQUE INDEX idx_families_calendar ON families(calendar_token);
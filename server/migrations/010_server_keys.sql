@@ -0,0 +1,6 @@
+-- Server-generated keys, e.g. for signing share links
+
+CREATE TABLE server_secrets (
+	name TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Access link permission level (full or summary)
+
+ALTER TABLE access_links ADD COLUMN role TEXT NOT NULL DEFAULT 'full';
@@ -0,0 +1,4 @@
+-- Which child of the family an entry is about; NULL = unspecified
+
+ALTER TABLE entries ADD COLUMN child_id TEXT;
+CREATE INDEX idx_entries_child_seq ON entries(family_id, child_id, seq);
@@ -0,0 +1,3 @@
+-- Label of the access link that first logged the entry
+
+ALTER TABLE entries ADD COLUMN author TEXT;
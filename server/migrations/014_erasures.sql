@@ -0,0 +1,10 @@
+-- Receipts for family data erasures
+
+CREATE TABLE erasures (
+	id TEXT PRIMARY KEY,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	admin_id TEXT,
+	erased_at INTEGER NOT NULL,
+	counts TEXT NOT NULL
+);
+CREATE INDEX idx_erasures_family ON erasures(family_id);
@@ -0,0 +1,4 @@
+-- Access link tokens are stored hashed; hashLinkTokens converts
+-- existing rows and sets the flag
+
+ALTER TABLE access_links ADD COLUMN hashed INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+-- Token rotation. token stays the link's ID; once rotated,
+-- token_hash is the current token's hash and the previous one is
+-- accepted until prev_expires_at
+
+ALTER TABLE access_links ADD COLUMN token_hash TEXT;
+ALTER TABLE access_links ADD COLUMN prev_token_hash TEXT;
+ALTER TABLE access_links ADD COLUMN prev_expires_at INTEGER;
+ALTER TABLE access_links ADD COLUMN rotated_at INTEGER;
+CREATE INDEX idx_access_links_hash ON access_links(token_hash);
+CREATE INDEX idx_access_links_prev ON access_links(prev_token_hash);
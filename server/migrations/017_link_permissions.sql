@@ -0,0 +1,5 @@
+-- Per-link capabilities for full links; existing links keep all
+
+ALTER TABLE access_links ADD COLUMN can_delete INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE access_links ADD COLUMN can_edit_config INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE access_links ADD COLUMN can_export INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,11 @@
+-- Admin announcements; family_id NULL is for every family
+
+CREATE TABLE announcements (
+	id TEXT PRIMARY KEY,
+	family_id TEXT REFERENCES families(id),
+	message TEXT NOT NULL,
+	admin_id TEXT,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX idx_announcements_expires ON announcements(expires_at);
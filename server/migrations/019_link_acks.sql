@@ -0,0 +1,4 @@
+-- The last sync cursor each link's devices acknowledged
+
+ALTER TABLE access_links ADD COLUMN acked_cursor INTEGER;
+ALTER TABLE access_links ADD COLUMN acked_at INTEGER;
@@ -0,0 +1,9 @@
+-- Per-family snapshots for bootstrapping new clients; see snapshot.go
+
+CREATE TABLE snapshots (
+	family_id TEXT PRIMARY KEY REFERENCES families(id),
+	cursor INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	entry_count INTEGER NOT NULL,
+	entries BLOB NOT NULL
+);
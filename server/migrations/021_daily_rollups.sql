@@ -0,0 +1,14 @@
+-- Per-day entry rollups in the family's timezone; see rollup.go.
+-- rollup_tz is the timezone they were built in, NULL until built.
+
+CREATE TABLE daily_rollups (
+	family_id TEXT NOT NULL REFERENCES families(id),
+	day TEXT NOT NULL,
+	child_id TEXT NOT NULL DEFAULT '',
+	type TEXT NOT NULL,
+	value TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	PRIMARY KEY (family_id, day, child_id, type, value)
+);
+ALTER TABLE families ADD COLUMN rollup_tz TEXT;
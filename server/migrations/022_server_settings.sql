@@ -0,0 +1,7 @@
+-- Server-wide settings set by the admin, e.g. the default config
+
+CREATE TABLE server_settings (
+	name TEXT PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at INTEGER NOT NULL
+);
@@ -0,0 +1,11 @@
+-- Every saved config, for rollback; see config_history.go
+
+CREATE TABLE config_revisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	data TEXT NOT NULL,
+	saved_at INTEGER NOT NULL,
+	saved_by TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX idx_config_revisions_family ON config_revisions(family_id, id);
+INSERT INTO config_revisions (family_id, data, saved_at) SELECT family_id, data, updated_at FROM configs;
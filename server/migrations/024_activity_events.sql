@@ -0,0 +1,12 @@
+-- Recent hub activity per family, for support; see activity.go
+
+CREATE TABLE activity_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	ts INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	label TEXT NOT NULL DEFAULT '',
+	message TEXT NOT NULL DEFAULT '',
+	clients INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX idx_activity_events_family ON activity_events(family_id, ts);
@@ -0,0 +1,10 @@
+-- Organizations grouping families, with admins scoped to one; see org.go
+
+CREATE TABLE orgs (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at INTEGER NOT NULL
+);
+ALTER TABLE families ADD COLUMN org_id TEXT REFERENCES orgs(id);
+ALTER TABLE admins ADD COLUMN org_id TEXT REFERENCES orgs(id);
+CREATE INDEX idx_families_org ON families(org_id);
@@ -0,0 +1,3 @@
+-- Per-org branding, JSON, over the instance's; see branding.go
+
+ALTER TABLE orgs ADD COLUMN branding TEXT;
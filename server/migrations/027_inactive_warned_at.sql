@@ -0,0 +1,3 @@
+-- When the lifecycle policy last warned about an idle family; see lifecycle.go
+
+ALTER TABLE families ADD COLUMN inactive_warned_at INTEGER;
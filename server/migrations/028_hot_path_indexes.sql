@@ -0,0 +1,7 @@
+-- Indexes for the summary and admin hot paths. The partial entry indexes
+-- skip deleted rows, so day ranges and MAX(ts) don't walk tombstones, and
+-- a family's links no longer need a scan of every link.
+
+CREATE INDEX idx_entries_live_ts ON entries(family_id, ts) WHERE deleted = 0;
+CREATE INDEX idx_entries_live_type_ts ON entries(family_id, type, ts) WHERE deleted = 0;
+CREATE INDEX idx_access_links_family ON access_links(family_id, created_at);
@@ -0,0 +1,19 @@
+-- Caregiver invitations: a one-time claim token, emailed, that mints an
+-- access link when opened; see invite.go. Like links, only the token's
+-- hash is stored.
+
+CREATE TABLE invites (
+	id TEXT PRIMARY KEY,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	email TEXT NOT NULL,
+	label TEXT NOT NULL,
+	role TEXT NOT NULL,
+	can_delete INTEGER NOT NULL,
+	can_edit_config INTEGER NOT NULL,
+	can_export INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	claimed_at INTEGER,
+	link_id TEXT
+);
+CREATE INDEX idx_invites_family ON invites(family_id, created_at);
@@ -0,0 +1,25 @@
+-- Signing back in by email; see magic.go. A link's email is the address
+-- its invitation was claimed from, so it's known to reach the caregiver.
+-- Magic links are one-time and short-lived, and each use issues a session
+-- token for the link, kept apart from the link's own token. Tokens are
+-- stored hashed, as ids.
+
+ALTER TABLE access_links ADD COLUMN email TEXT;
+CREATE INDEX idx_access_links_email ON access_links(email) WHERE email IS NOT NULL;
+
+CREATE TABLE magic_links (
+	id TEXT PRIMARY KEY,
+	link_id TEXT NOT NULL,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	used_at INTEGER
+);
+
+CREATE TABLE link_sessions (
+	id TEXT PRIMARY KEY,
+	link_id TEXT NOT NULL,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	issued_at INTEGER NOT NULL
+);
+CREATE INDEX idx_link_sessions_link ON link_sessions(link_id);
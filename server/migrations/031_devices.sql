@@ -0,0 +1,15 @@
+-- One row per signed-in device (browser), so a caregiver can see a family's
+-- phones and sign a lost one out without revoking its link; see devices.go.
+-- The id is the hash of the device's client_device cookie.
+
+CREATE TABLE devices (
+	id TEXT PRIMARY KEY,
+	link_id TEXT NOT NULL,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	platform TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	last_seen_at INTEGER NOT NULL,
+	revoked_at INTEGER
+);
+CREATE INDEX idx_devices_family ON devices(family_id, last_seen_at);
+CREATE INDEX idx_devices_link ON devices(link_id);
@@ -0,0 +1,9 @@
+-- Sessions for every device that signs in, not only by magic link; see
+-- sessions.go. Each belongs to a device and has a sliding expiry. Existing
+-- magic-link sessions get 30 days from when they were issued.
+
+ALTER TABLE link_sessions ADD COLUMN device_id TEXT;
+ALTER TABLE link_sessions ADD COLUMN expires_at INTEGER NOT NULL DEFAULT 0;
+UPDATE link_sessions SET expires_at = issued_at + 30 * 86400000;
+CREATE INDEX idx_link_sessions_device ON link_sessions(device_id);
+CREATE INDEX idx_link_sessions_expiry ON link_sessions(expires_at);
@@ -0,0 +1,4 @@
+-- Each device's own preferences (night mode, default child, ...), a JSON
+-- object kept apart from the family's shared config; see device_settings.go.
+
+ALTER TABLE devices ADD COLUMN settings TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,30 @@
+-- Optional caregiver accounts; see accounts.go. An account signs in by
+-- email and password and remembers links, at most one per family, so a
+-- caregiver who helps several families can move between them. Links, and
+-- their tokens, work as before without one. Session tokens are stored
+-- hashed, as ids.
+
+CREATE TABLE accounts (
+	id TEXT PRIMARY KEY,
+	email TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	last_login_at INTEGER
+);
+
+CREATE TABLE account_links (
+	account_id TEXT NOT NULL REFERENCES accounts(id),
+	family_id TEXT NOT NULL REFERENCES families(id),
+	link_id TEXT NOT NULL,
+	added_at INTEGER NOT NULL,
+	PRIMARY KEY (account_id, family_id)
+);
+CREATE INDEX idx_account_links_link ON account_links(link_id);
+
+CREATE TABLE account_sessions (
+	id TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL REFERENCES accounts(id),
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX idx_account_sessions_account ON account_sessions(account_id);
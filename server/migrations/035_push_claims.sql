@@ -0,0 +1,5 @@
+-- What scheduled pushes have gone out for each family, so that with
+-- several instances only one sends each; see reminders.go.
+
+ALTER TABLE families ADD COLUMN feed_pushed_ts INTEGER;
+ALTER TABLE families ADD COLUMN summary_pushed_date TEXT;
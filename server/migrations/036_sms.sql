@@ -0,0 +1,14 @@
+-- SMS alerts sent for each family, for its rate caps, and which outage
+-- and overdue feed it was last alerted about, so that with several
+-- instances only one alerts each; see sms.go.
+
+CREATE TABLE sms_sent (
+	id INTEGER PRIMARY KEY,
+	family_id TEXT NOT NULL REFERENCES families(id),
+	kind TEXT NOT NULL,
+	sent_at INTEGER NOT NULL
+);
+CREATE INDEX idx_sms_sent_family ON sms_sent(family_id, sent_at);
+
+ALTER TABLE families ADD COLUMN sync_alerted_seen INTEGER;
+ALTER TABLE families ADD COLUMN feed_escalated_ts INTEGER;
@@ -0,0 +1,4 @@
+-- How many texts each SMS alert took, one per number, so max_per_day caps
+-- messages rather than alerts; see sms.go.
+
+ALTER TABLE sms_sent ADD COLUMN messages INTEGER NOT NULL DEFAULT 1;
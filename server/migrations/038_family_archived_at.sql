@@ -0,0 +1,5 @@
+-- When each family was archived, so the lifecycle policy's purge waits
+-- for it; see lifecycle.go. Families already archived count from now.
+
+ALTER TABLE families ADD COLUMN archived_at INTEGER;
+UPDATE families SET archived_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000 WHERE archived = 1;
@@ -0,0 +1,8 @@
+-- Which instance runs each instance-wide background job, when several
+-- share the database; see lease.go.
+
+CREATE TABLE leases (
+  name TEXT PRIMARY KEY,
+  holder TEXT NOT NULL,
+  expires_at INTEGER NOT NULL
+);
@@ -0,0 +1,7 @@
+-- Days the daily digest has been sent for, so that with several instances
+-- only one sends it; see digest.go.
+
+CREATE TABLE digests (
+  date TEXT PRIMARY KEY,
+  sent_at INTEGER NOT NULL
+);
@@ -0,0 +1,146 @@
+package babytrack
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Nappy analytics: daily wet/dirty counts and the time since the last wet
+// nappy, which midwives use as a dehydration indicator. Days with fewer
+// nappies than the family's thresholds are flagged.
+
+const (
+	defaultNappyDays = 7
+	maxNappyDays     = 90
+)
+
+type NappyDay struct {
+	Date     string `json:"date"`
+	Wet      int    `json:"wet"`
+	Dirty    int    `json:"dirty"`
+	Partial  bool   `json:"partial,omitempty"` // today, still in progress; never flagged
+	LowWet   bool   `json:"low_wet,omitempty"`
+	LowDirty bool   `json:"low_dirty,omitempty"`
+}
+
+type NappyAnalytics struct {
+	MinWetPerDay    int        `json:"min_wet_per_day"`
+	MinDirtyPerDay  int        `json:"min_dirty_per_day"`
+	LastWetTs       int64      `json:"last_wet_ts,omitempty"`
+	MinutesSinceWet *int       `json:"minutes_since_wet"` // null if never
+	FlaggedDays     int        `json:"flagged_days"`
+	Days            []NappyDay `json:"days"` // oldest first
+}
+
+// nappyAnalytics counts nappies for the days days ending on the day starting
+// at lastDay, in lastDay's location.
+func nappyAnalytics(db EntryStore, familyID string, settings FamilySettings, lastDay time.Time, days int, now time.Time) (*NappyAnalytics, error) {
+	first := lastDay.AddDate(0, 0, -(days - 1))
+	a := &NappyAnalytics{Days: make([]NappyDay, days)}
+	a.MinWetPerDay, a.MinDirtyPerDay = settings.NappyThresholds()
+	byDate := make(map[string]*NappyDay, days)
+	for i := range a.Days {
+		d := first.AddDate(0, 0, i)
+		a.Days[i].Date = d.Format("2006-01-02")
+		a.Days[i].Partial = now.Before(d.AddDate(0, 0, 1))
+		byDate[a.Days[i].Date] = &a.Days[i]
+	}
+	count := func(date, value string, n int) {
+		if d := byDate[date]; d != nil {
+			switch value {
+			case "wet":
+				d.Wet += n
+			case "dirty":
+				d.Dirty += n
+			}
+		}
+	}
+	if loc := settings.Location(); sameDays(loc, first, days) {
+		// Days line up with the family's rollups
+		rollups, err := db.DailyRollups(familyID, "", "nappy", loc, a.Days[0].Date, a.Days[days-1].Date)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rollups {
+			count(r.Day, r.Value, r.Count)
+		}
+	} else {
+		entries, err := db.GetEntriesOfType(familyID, "nappy", first.UnixMilli(), lastDay.AddDate(0, 0, 1).UnixMilli())
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			count(time.UnixMilli(e.Ts).In(lastDay.Location()).Format("2006-01-02"), e.Value, 1)
+		}
+	}
+	for i := range a.Days {
+		d := &a.Days[i]
+		if d.Partial {
+			continue
+		}
+		d.LowWet = d.Wet < a.MinWetPerDay
+		d.LowDirty = d.Dirty < a.MinDirtyPerDay
+		if d.LowWet || d.LowDirty {
+			a.FlaggedDays++
+		}
+	}
+
+	last, err := db.GetLastEntry(familyID, "nappy", "wet")
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if last != nil {
+		a.LastWetTs = last.Ts
+		mins := int(now.Sub(time.UnixMilli(last.Ts)) / time.Minute)
+		a.MinutesSinceWet = &mins
+	}
+	return a, nil
+}
+
+// nappyReport writes nappy analytics for familyID. Query parameters follow
+// the summary endpoint (?date= is the last day, ?offset= the UTC offset in
+// minutes) plus ?days= for the window length.
+func (s *Server) nappyReport(w http.ResponseWriter, r *http.Request, familyID string) {
+	lastDay, _, ok := parseDayParams(w, r)
+	if !ok {
+		return
+	}
+	days := defaultNappyDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxNappyDays {
+			validationError(w, map[string]string{"days": "must be between 1 and " + strconv.Itoa(maxNappyDays)})
+			return
+		}
+		days = n
+	}
+
+	settings, err := s.db.GetFamilySettings(familyID)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to load family settings", err)
+		return
+	}
+	a, err := nappyAnalytics(s.db, familyID, settings, lastDay, days, time.Now())
+	if err != nil {
+		serverError(w, "failed to compute nappy analytics", err)
+		return
+	}
+	jsonOK(w, a)
+}
+
+// handleNappyAnalytics serves GET /api/v1/analytics/nappies for the caller's
+// family.
+func (s *Server) handleNappyAnalytics(w http.ResponseWriter, r *http.Request) {
+	s.nappyReport(w, r, accessLinkFrom(r.Context()).FamilyID)
+}
+
+// adminNappyAnalytics serves GET /admin/families/{id}/analytics/nappies.
+func (s *Server) adminNappyAnalytics(w http.ResponseWriter, r *http.Request) {
+	s.nappyReport(w, r, r.PathValue("id"))
+}
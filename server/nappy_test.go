@@ -0,0 +1,81 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNappyAnalytics(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+
+	loc := time.FixedZone("client", 10*60*60)
+	day := time.Date(2025, 6, 10, 0, 0, 0, 0, loc)
+	add := func(at time.Time, value string) {
+		e := &Entry{ID: generateToken(8), FamilyID: family.ID, Ts: at.UnixMilli(), Type: "nappy", Value: value}
+		if err := db.UpsertEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Yesterday: 6 wet, 1 dirty. Today so far: 2 wet.
+	for i := range 6 {
+		add(day.Add(time.Duration(-23+3*i)*time.Hour), "wet")
+	}
+	add(day.Add(-12*time.Hour), "dirty")
+	add(day.Add(2*time.Hour), "wet")
+	add(day.Add(5*time.Hour), "wet")
+
+	now := day.Add(8 * time.Hour)
+	a, err := nappyAnalytics(db, family.ID, FamilySettings{MinDirtyPerDay: 1}, day, 3, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Days) != 3 || a.Days[0].Date != "2025-06-08" || a.Days[2].Date != "2025-06-10" {
+		t.Fatalf("days = %+v", a.Days)
+	}
+	if d := a.Days[0]; d.Wet != 0 || !d.LowWet || !d.LowDirty {
+		t.Errorf("empty day = %+v", d)
+	}
+	if d := a.Days[1]; d.Wet != 6 || d.Dirty != 1 || d.LowWet || d.LowDirty {
+		t.Errorf("yesterday = %+v", d)
+	}
+	if d := a.Days[2]; d.Wet != 2 || !d.Partial || d.LowWet {
+		t.Errorf("today = %+v", d)
+	}
+	if a.FlaggedDays != 1 || a.MinWetPerDay != defaultMinWetPerDay {
+		t.Errorf("analytics = %+v", a)
+	}
+	if a.MinutesSinceWet == nil || *a.MinutesSinceWet != 180 {
+		t.Errorf("minutes since wet = %v", a.MinutesSinceWet)
+	}
+}
+
+func TestNappyAnalyticsEndpoint(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+
+	get := func(id, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/admin/families/"+id+"/analytics/nappies"+query, nil)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		s.adminNappyAnalytics(w, req)
+		return w
+	}
+
+	if w := get(family.ID, "?days=14&offset=600"); w.Code != http.StatusOK {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+	if w := get(family.ID, "?days=0"); w.Code != http.StatusBadRequest {
+		t.Errorf("days=0: status %d", w.Code)
+	}
+	if w := get("nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown family: status %d", w.Code)
+	}
+}
@@ -0,0 +1,154 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Notifications are short server-written messages meant to be shown or
+// buzzed, apart from the raw entry broadcasts the app syncs from: when a
+// caregiver logs an entry, the family's other devices are told "Dad logged
+// Feed: 120ml" in the family's language. Each device chooses what it hears
+// with its "notifications" setting (see device_settings.go): false mutes
+// them, a list of entry types limits them to those, and anything else or
+// no setting hears everything. Nothing is sent in the family's quiet hours
+// (see quiet.go). Connections without a device record (scripts, apps from
+// before hello) aren't sent them. Entries from batches and legacy sync are
+// catch-up, often hours old, and don't notify.
+
+// Notification is sent as {"type": "notification", "notification": {...}}.
+type Notification struct {
+	Kind      string `json:"kind"` // entry, reminder
+	Title     string `json:"title"`
+	Label     string `json:"label,omitempty"` // who logged it
+	EntryID   string `json:"entry_id,omitempty"`
+	EntryType string `json:"entry_type,omitempty"`
+	ChildID   string `json:"child_id,omitempty"`
+	Ts        int64  `json:"ts"`
+}
+
+func notificationMessage(n Notification) []byte {
+	msg, _ := json.Marshal(map[string]any{"type": "notification", "notification": n})
+	return msg
+}
+
+// notifyPrefs is a device's notifications setting. The zero value hears
+// everything; nil, for connections without a device record, nothing.
+type notifyPrefs struct {
+	muted bool
+	types map[string]bool // nil = all
+}
+
+// parseNotifyPrefs reads a notifications setting: a boolean, or a list of
+// entry types.
+func parseNotifyPrefs(v json.RawMessage) (*notifyPrefs, error) {
+	var on bool
+	if json.Unmarshal(v, &on) == nil {
+		return &notifyPrefs{muted: !on}, nil
+	}
+	var types []string
+	if err := json.Unmarshal(v, &types); err != nil {
+		return nil, settingsError("notifications must be true, false or a list of entry types")
+	}
+	p := &notifyPrefs{types: map[string]bool{}}
+	for _, t := range types {
+		p.types[t] = true
+	}
+	return p, nil
+}
+
+// notifyPrefsFrom returns the notifications setting in a device's settings.
+func notifyPrefsFrom(settings json.RawMessage) *notifyPrefs {
+	var s struct {
+		Notifications json.RawMessage `json:"notifications"`
+	}
+	json.Unmarshal(settings, &s)
+	if s.Notifications == nil {
+		return &notifyPrefs{}
+	}
+	p, err := parseNotifyPrefs(s.Notifications)
+	if err != nil {
+		return &notifyPrefs{} // saved before it was checked
+	}
+	return p
+}
+
+// wants reports whether the device hears about entries of the given type.
+func (p *notifyPrefs) wants(entryType string) bool {
+	if p == nil {
+		return false
+	}
+	return !p.muted && (p.types == nil || p.types[entryType])
+}
+
+// entryNotification describes e, logged by label, in the family's language.
+func entryNotification(settings FamilySettings, label string, e *Entry) Notification {
+	locale := locales[defaultLocale]
+	if l := lookupLocale(settings.Locale); l != nil {
+		locale = l
+	}
+	what := locale.TypeLabel(e.Type)
+	if v := locale.ValueLabel(e.Value); v != "" && v != what {
+		what += ": " + v
+	}
+	who := label
+	if who == "" {
+		who = locale.T("notify.someone", "Someone")
+	}
+	return Notification{
+		Kind:      "entry",
+		Title:     fmt.Sprintf(locale.T("notify.logged", "%s logged %s"), who, what),
+		Label:     label,
+		EntryID:   e.ID,
+		EntryType: e.Type,
+		ChildID:   e.ChildID,
+		Ts:        time.Now().UnixMilli(),
+	}
+}
+
+// notifyEntry tells the family's other devices that c logged e, outside
+// quiet hours.
+func (s *Server) notifyEntry(c *Client, e *Entry) {
+	if e.Deleted {
+		return
+	}
+	settings, err := s.db.GetFamilySettings(c.familyID)
+	if err != nil {
+		c.log().Error("failed to load family settings", "error", err)
+	}
+	if settings.quiet("entry", time.Now()) {
+		return
+	}
+	s.hub.Notify(c.familyID, c.deviceID, entryNotification(settings, c.linkLabel(), e), c)
+}
+
+// Notify sends n to the family's connections that want it, but for those
+// of fromDevice and exclude.
+func (h *Hub) Notify(familyID, fromDevice string, n Notification, exclude *Client) {
+	msg := notificationMessage(n)
+	h.notify(familyID, fromDevice, msg, exclude)
+	h.relay(busMessage{Kind: "notify", FamilyID: familyID, DeviceID: fromDevice, Msg: msg})
+}
+
+func (h *Hub) notify(familyID, fromDevice string, msg []byte, exclude *Client) {
+	var m struct {
+		Notification Notification `json:"notification"`
+	}
+	json.Unmarshal(msg, &m)
+	n := m.Notification
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.families[familyID] {
+		if c == exclude || (fromDevice != "" && c.deviceID == fromDevice) {
+			continue
+		}
+		if c.childID != "" && n.ChildID != c.childID {
+			continue
+		}
+		if c.notify.Load().wants(n.EntryType) {
+			c.trySend(msg)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNotifyPrefs(t *testing.T) {
+	tests := []struct {
+		settings string
+		want     map[string]bool
+	}{
+		{`{}`, map[string]bool{"feed": true, "nappy": true}},
+		{`{"notifications": true}`, map[string]bool{"feed": true}},
+		{`{"notifications": false}`, map[string]bool{"feed": false, "nappy": false}},
+		{`{"notifications": ["nappy"]}`, map[string]bool{"feed": false, "nappy": true}},
+	}
+	for _, tt := range tests {
+		p := notifyPrefsFrom(json.RawMessage(tt.settings))
+		for typ, want := range tt.want {
+			if got := p.wants(typ); got != want {
+				t.Errorf("%s wants %s = %v", tt.settings, typ, got)
+			}
+		}
+	}
+	if (*notifyPrefs)(nil).wants("feed") {
+		t.Error("connection without a device record notified")
+	}
+	if _, err := parseNotifyPrefs(json.RawMessage(`"feed"`)); err == nil {
+		t.Error("string accepted")
+	}
+}
+
+func TestEntryNotifications(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Smith", "")
+	dad, _ := s.db.CreateAccessLink(family.ID, "Dad", nil)
+	mum, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	// Each dial is a new device, as a browser opening the link
+	dial := func(token string) *websocket.Conn {
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, httptest.NewRequest("POST", "/t/"+token, nil))
+		header := http.Header{}
+		for _, c := range w.Result().Cookies() {
+			header.Add("Cookie", c.String())
+		}
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/ws", header)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		skipUntilType(t, conn, "init")
+		return conn
+	}
+	phone, tablet, dadConn := dial(mum.Token), dial(mum.Token), dial(dad.Token)
+	defer phone.Close()
+	defer tablet.Close()
+	defer dadConn.Close()
+
+	// The tablet only wants to hear about nappies
+	tablet.WriteJSON(map[string]any{"type": "device_settings", "data": map[string]any{"notifications": []string{"nappy"}}})
+	tablet.WriteJSON(map[string]any{"type": "ping"})
+	skipUntilType(t, tablet, "pong")
+
+	ts := time.Now().UnixMilli()
+	dadConn.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "bottle", "ts": ts, "type": "feed", "value": "120ml"}})
+	dadConn.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "nappy", "ts": ts, "type": "nappy", "value": "wet"}})
+
+	n := skipUntilType(t, phone, "notification")["notification"].(map[string]any)
+	if n["title"] != "Dad logged Feed: 120ml" || n["entry_id"] != "bottle" {
+		t.Errorf("phone notified %v", n)
+	}
+	if n := skipUntilType(t, tablet, "notification")["notification"].(map[string]any); n["entry_id"] != "nappy" {
+		t.Errorf("tablet notified %v", n)
+	}
+
+	// Nobody is told about their own entries
+	dadConn.WriteJSON(map[string]any{"type": "ping"})
+	for {
+		var m map[string]any
+		dadConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := dadConn.ReadJSON(&m); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if m["type"] == "notification" {
+			t.Errorf("sender notified: %v", m)
+		}
+		if m["type"] == "pong" {
+			break
+		}
+	}
+}
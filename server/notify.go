@@ -0,0 +1,80 @@
+package babytrack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Alerts are family-level notifications raised by the server (e.g. a fever
+// reading). They go to the family's connected clients over WS, to the admin
+// activity feed, and to the family's webhook, push targets (see push.go)
+// and SMS numbers (see sms.go) if it has them.
+
+type Alert struct {
+	FamilyID string `json:"family_id"`
+	Kind     string `json:"kind"` // fever, ...
+	Message  string `json:"message"`
+	Label    string `json:"label,omitempty"` // who logged the triggering entry
+	Ts       int64  `json:"ts"`
+	Data     any    `json:"data,omitempty"`
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendAlert delivers an alert on every channel. Webhook delivery runs in
+// the background; failures are logged, not retried. During quiet hours
+// the webhook, push targets and SMS are skipped (see quiet.go).
+func (s *Server) sendAlert(a Alert) {
+	if a.Ts == 0 {
+		a.Ts = time.Now().UnixMilli()
+	}
+	msg, _ := json.Marshal(map[string]any{"type": "alert", "alert": a})
+	s.hub.Broadcast(a.FamilyID, msg, nil)
+	s.hub.publishActivity(ActivityEvent{Type: "warning", FamilyID: a.FamilyID, Label: a.Label, Message: a.Message})
+
+	settings, err := s.db.GetFamilySettings(a.FamilyID)
+	if err != nil {
+		slog.Error("failed to load family settings for alert", "error", err, "family_id", a.FamilyID)
+		return
+	}
+	if settings.quiet(a.Kind, time.UnixMilli(a.Ts)) {
+		slog.Info("alert webhook held back for quiet hours", "family_id", a.FamilyID, "kind", a.Kind)
+		return
+	}
+	s.pushAlert(settings, a)
+	s.textAlert(settings, a)
+	if settings.WebhookURL != "" {
+		go func() {
+			if err := postWebhook(settings.WebhookURL, a); err != nil {
+				slog.Warn("webhook delivery failed", "error", err, "family_id", a.FamilyID, "kind", a.Kind)
+			}
+		}()
+	}
+}
+
+// postWebhook POSTs the alert as JSON and treats any non-2xx as failure.
+func postWebhook(url string, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "babytrackd/"+version)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Organizations let one instance serve several independent groups of
+// families, e.g. a doula's or a daycare's clients. An org admin signs in to
+// the same admin page but only sees and manages their org's families; admins
+// without an org manage the whole server, including the orgs themselves.
+// Families without an org are only visible to server admins.
+
+var errAdminExists = errors.New("admin already exists")
+
+type Org struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"created_at"`
+	Families  int    `json:"families"`
+	Admins    int    `json:"admins"`
+}
+
+func (db *DB) CreateOrg(name string) (*Org, error) {
+	org := &Org{ID: generateToken(4), Name: name, CreatedAt: time.Now().UnixMilli()}
+	_, err := db.Exec("INSERT INTO orgs (id, name, created_at) VALUES (?, ?, ?)", org.ID, org.Name, org.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+func (db *DB) ListOrgs() ([]Org, error) {
+	rows, err := db.Query(
+		`SELECT id, name, created_at,
+			(SELECT COUNT(*) FROM families WHERE org_id = orgs.id),
+			(SELECT COUNT(*) FROM admins WHERE org_id = orgs.id)
+		 FROM orgs ORDER BY created_at DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orgs := []Org{}
+	for rows.Next() {
+		var o Org
+		if err := rows.Scan(&o.ID, &o.Name, &o.CreatedAt, &o.Families, &o.Admins); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, rows.Err()
+}
+
+func (db *DB) GetOrg(id string) (*Org, error) {
+	var o Org
+	err := db.QueryRow("SELECT id, name, created_at FROM orgs WHERE id = ?", id).Scan(&o.ID, &o.Name, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// CreateOrgAdmin adds an admin who can only manage orgID's families.
+// Unlike EnsureAdmin it won't touch an existing admin, returning
+// errAdminExists instead, so an org can't take over a server admin's account.
+func (db *DB) CreateOrgAdmin(orgID, username, password string) (*Admin, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT 1 FROM admins WHERE username = ?", username).Scan(&exists); err == nil {
+		return nil, errAdminExists
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	admin := &Admin{ID: generateToken(8), Username: username, CreatedAt: time.Now().UnixMilli()}
+	_, err = db.Exec(
+		"INSERT INTO admins (id, username, password_hash, created_at, org_id) VALUES (?, ?, ?, ?, ?)",
+		admin.ID, username, string(hash), admin.CreatedAt, orgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return admin, nil
+}
+
+// AdminOrg returns the org an admin is limited to, or "" for a server admin.
+func (db *DB) AdminOrg(adminID string) (string, error) {
+	var orgID string
+	err := db.QueryRow("SELECT COALESCE(org_id, '') FROM admins WHERE id = ?", adminID).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		// Sessions reference admins, so only sessions made directly (as
+		// tests do) lack one
+		return "", nil
+	}
+	return orgID, err
+}
+
+// SetFamilyOrg moves a family into orgID, or out of any org if it's empty.
+func (db *DB) SetFamilyOrg(familyID, orgID string) error {
+	_, err := db.Exec("UPDATE families SET org_id = NULLIF(?, '') WHERE id = ?", orgID, familyID)
+	return err
+}
+
+// adminOrg returns the org of the admin making an adminRequired request, or
+// "" for a server admin.
+func adminOrg(r *http.Request) string {
+	return r.Header.Get("X-Admin-Org")
+}
+
+// orgAdminRoutes are the routes without a family in the path that org admins
+// may use; their handlers limit what they see. Everything else without a
+// family is server-wide and for server admins only.
+var orgAdminRoutes = map[string]bool{
+	"GET /admin/families":                   true,
+	"POST /admin/families":                  true,
+	"POST /admin/families/archive-inactive": true,
+	"GET /admin/export/families.csv":        true,
+	"POST /admin/announce":                  true,
+	"GET /admin/ws":                         true,
+	"GET /admin/branding":                   true,
+	"PUT /admin/branding":                   true,
+}
+
+// orgAllows reports whether an org admin may use the request's route,
+// writing an error if not. Another org's families are reported as not found
+// rather than forbidden, so their IDs can't be probed.
+func (s *Server) orgAllows(w http.ResponseWriter, r *http.Request, orgID string) bool {
+	if strings.Contains(r.Pattern, "/admin/families/{id}") {
+		if f, err := s.db.GetFamily(r.PathValue("id")); err != nil || f.OrgID != orgID {
+			jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+			return false
+		}
+		return true
+	}
+	if orgAdminRoutes[r.Pattern] {
+		return true
+	}
+	jsonError(w, http.StatusForbidden, errCodeForbidden, "server admins only")
+	return false
+}
+
+// familyInOrg reports whether an admin in orgID can see familyID. Server
+// admins (orgID "") can see every family.
+func (s *Server) familyInOrg(familyID, orgID string) bool {
+	if orgID == "" {
+		return true
+	}
+	f, err := s.db.GetFamily(familyID)
+	return err == nil && f.OrgID == orgID
+}
+
+// Org handlers, for server admins
+
+func (s *Server) listOrgs(w http.ResponseWriter, r *http.Request) {
+	orgs, err := s.db.ListOrgs()
+	if err != nil {
+		serverError(w, "failed to list orgs", err)
+		return
+	}
+	jsonOK(w, orgs)
+}
+
+func (s *Server) createOrg(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		validationError(w, map[string]string{"name": "required"})
+		return
+	}
+	org, err := s.db.CreateOrg(req.Name)
+	if err != nil {
+		serverError(w, "failed to create org", err)
+		return
+	}
+	slog.Info("org created", "org_id", org.ID, "admin_id", r.Header.Get("X-Admin-ID"))
+	jsonCreated(w, org)
+}
+
+// createOrgAdmin handles POST /admin/orgs/{org}/admins.
+func (s *Server) createOrgAdmin(w http.ResponseWriter, r *http.Request) {
+	orgID := r.PathValue("org")
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	fields := map[string]string{}
+	if req.Username == "" {
+		fields["username"] = "required"
+	}
+	if len(req.Password) < 8 {
+		fields["password"] = "at least 8 characters"
+	}
+	if len(fields) > 0 {
+		validationError(w, fields)
+		return
+	}
+	if _, err := s.db.GetOrg(orgID); err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "org not found")
+		return
+	}
+	admin, err := s.db.CreateOrgAdmin(orgID, req.Username, req.Password)
+	if err == errAdminExists {
+		jsonError(w, http.StatusConflict, errCodeConflict, "username is taken")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to create admin", err)
+		return
+	}
+	slog.Info("org admin created", "org_id", orgID, "username", admin.Username)
+	jsonCreated(w, map[string]any{"id": admin.ID, "username": admin.Username, "org_id": orgID})
+}
@@ -0,0 +1,194 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrgAdminScope(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	mux := s.routes()
+
+	org, _ := s.db.CreateOrg("Little Steps Daycare")
+	other, _ := s.db.CreateOrg("Other")
+	mine, _ := s.db.CreateOrgFamily(org.ID, "Mine", "")
+	theirs, _ := s.db.CreateOrgFamily(other.ID, "Theirs", "")
+	unorged, _ := s.db.CreateFamily("No org", "")
+
+	admin, err := s.db.CreateOrgAdmin(org.ID, "doula", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.CreateOrgAdmin(org.ID, "testadmin", "password1"); err != errAdminExists {
+		t.Errorf("taking over a server admin: %v", err)
+	}
+	orgToken, _ := s.db.CreateAdminSession(admin.ID, time.Hour)
+	serverToken, _ := s.db.CreateAdminSession("admin", time.Hour)
+
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: token})
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(orgToken, "GET", "/admin/families", "")
+	var families []FamilyWithStats
+	json.Unmarshal(w.Body.Bytes(), &families)
+	if len(families) != 1 || families[0].ID != mine.ID {
+		t.Errorf("org admin sees %+v", families)
+	}
+	w = do(serverToken, "GET", "/admin/families", "")
+	json.Unmarshal(w.Body.Bytes(), &families)
+	if len(families) != 3 {
+		t.Errorf("server admin sees %d families", len(families))
+	}
+
+	for _, id := range []string{theirs.ID, unorged.ID, "nope"} {
+		if w := do(orgToken, "GET", "/admin/families/"+id, ""); w.Code != http.StatusNotFound {
+			t.Errorf("org admin get %s: %d", id, w.Code)
+		}
+		if w := do(orgToken, "POST", "/admin/families/"+id+"/links", `{"label": "x"}`); w.Code != http.StatusNotFound {
+			t.Errorf("org admin link for %s: %d", id, w.Code)
+		}
+	}
+	if w := do(orgToken, "POST", "/admin/families/"+mine.ID+"/links", `{"label": "Mum"}`); w.Code != http.StatusCreated {
+		t.Errorf("org admin link for own family: %d %s", w.Code, w.Body)
+	}
+	if w := do(orgToken, "POST", "/admin/families/"+mine.ID+"/config/copy?from="+theirs.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("copy from another org: %d", w.Code)
+	}
+
+	for _, path := range []string{"/admin/stats", "/admin/orgs", "/admin/maintenance", "/admin/config/default"} {
+		if w := do(orgToken, "GET", path, ""); w.Code != http.StatusForbidden {
+			t.Errorf("org admin %s: %d", path, w.Code)
+		}
+	}
+	if w := do(orgToken, "POST", "/admin/announce", `{"message": "hi"}`); w.Code != http.StatusForbidden {
+		t.Errorf("org admin announce to all: %d", w.Code)
+	}
+	if w := do(orgToken, "POST", "/admin/announce", `{"message": "hi", "family_id": "`+theirs.ID+`"}`); w.Code != http.StatusNotFound {
+		t.Errorf("org admin announce to another org: %d", w.Code)
+	}
+	if w := do(orgToken, "PATCH", "/admin/families/"+mine.ID, `{"org_id": ""}`); w.Code != http.StatusForbidden {
+		t.Errorf("org admin moving family: %d", w.Code)
+	}
+
+	// New families land in the admin's org, whatever they ask for
+	w = do(orgToken, "POST", "/admin/families", `{"name": "New", "org_id": "`+other.ID+`"}`)
+	var created Family
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusCreated || created.OrgID != org.ID {
+		t.Errorf("org admin create: %d %+v", w.Code, created)
+	}
+
+	// Server admins can move families between orgs
+	if w := do(serverToken, "PATCH", "/admin/families/"+unorged.ID, `{"org_id": "`+org.ID+`"}`); w.Code != http.StatusOK {
+		t.Errorf("server admin move: %d %s", w.Code, w.Body)
+	}
+	if w := do(orgToken, "GET", "/admin/families/"+unorged.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("moved family: %d", w.Code)
+	}
+	if w := do(serverToken, "PATCH", "/admin/families/"+unorged.ID, `{"org_id": "nope"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("move to unknown org: %d", w.Code)
+	}
+
+	var session map[string]string
+	json.Unmarshal(do(orgToken, "GET", "/admin/session", "").Body.Bytes(), &session)
+	if session["org_id"] != org.ID {
+		t.Errorf("session = %v", session)
+	}
+}
+
+func TestOrgEndpoints(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	mux := s.routes()
+	token, _ := s.db.CreateAdminSession("admin", time.Hour)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "admin_session", Value: token})
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/admin/orgs", `{"name": " "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("blank name: %d", w.Code)
+	}
+	w := do("POST", "/admin/orgs", `{"name": "Doulas R Us"}`)
+	var org Org
+	json.Unmarshal(w.Body.Bytes(), &org)
+	if w.Code != http.StatusCreated || org.ID == "" {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+
+	if w := do("POST", "/admin/orgs/"+org.ID+"/admins", `{"username": "kim", "password": "short"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("short password: %d", w.Code)
+	}
+	if w := do("POST", "/admin/orgs/nope/admins", `{"username": "kim", "password": "long enough"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown org: %d", w.Code)
+	}
+	if w := do("POST", "/admin/orgs/"+org.ID+"/admins", `{"username": "kim", "password": "long enough"}`); w.Code != http.StatusCreated {
+		t.Errorf("add admin: %d %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/admin/orgs/"+org.ID+"/admins", `{"username": "kim", "password": "long enough"}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate admin: %d", w.Code)
+	}
+	if w := do("POST", "/admin/families", `{"name": "Client", "org_id": "`+org.ID+`"}`); w.Code != http.StatusCreated {
+		t.Errorf("create in org: %d", w.Code)
+	}
+
+	var orgs []Org
+	json.Unmarshal(do("GET", "/admin/orgs", "").Body.Bytes(), &orgs)
+	if len(orgs) != 1 || orgs[0].Families != 1 || orgs[0].Admins != 1 {
+		t.Errorf("orgs = %+v", orgs)
+	}
+}
+
+func TestOrgCLI(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	run := func(stdin string, args ...string) (string, error) {
+		var out strings.Builder
+		err := runCLI(args, path, "", "", strings.NewReader(stdin), &out)
+		return strings.TrimSpace(out.String()), err
+	}
+
+	orgID, err := run("", "org", "create", "Little", "Steps")
+	if err != nil {
+		t.Fatalf("org create: %v", err)
+	}
+	familyID, err := run("", "family", "create", "--org", orgID, "Smiths")
+	if err != nil {
+		t.Fatalf("family create: %v", err)
+	}
+	if _, err := run("", "family", "create", "--org", "nope", "Smiths"); err == nil {
+		t.Error("expected error for unknown org")
+	}
+	password, err := run("", "org", "add-admin", orgID, "kim")
+	if err != nil || password == "" {
+		t.Fatalf("add-admin: %q, %v", password, err)
+	}
+	if _, err := run("x\n", "org", "add-admin", orgID, "kim"); err == nil {
+		t.Error("expected error for existing admin")
+	}
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if f, _ := db.GetFamily(familyID); f.OrgID != orgID {
+		t.Errorf("family org = %q", f.OrgID)
+	}
+	admin, _ := db.GetAdminByUsername("kim")
+	if got, _ := db.AdminOrg(admin.ID); got != orgID {
+		t.Errorf("admin org = %q", got)
+	}
+}
@@ -0,0 +1,1367 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: babytrack.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Entry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Ts            int64                  `protobuf:"varint,2,opt,name=ts,proto3" json:"ts,omitempty"`
+	Type          string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	Value         string                 `protobuf:"bytes,4,opt,name=value,proto3" json:"value,omitempty"`
+	Deleted       bool                   `protobuf:"varint,5,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	UpdatedAt     int64                  `protobuf:"varint,6,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Seq           int64                  `protobuf:"varint,7,opt,name=seq,proto3" json:"seq,omitempty"`
+	DataJson      string                 `protobuf:"bytes,8,opt,name=data_json,json=dataJson,proto3" json:"data_json,omitempty"`
+	EndedTs       *int64                 `protobuf:"varint,9,opt,name=ended_ts,json=endedTs,proto3,oneof" json:"ended_ts,omitempty"`
+	Ongoing       bool                   `protobuf:"varint,10,opt,name=ongoing,proto3" json:"ongoing,omitempty"`
+	ChildId       string                 `protobuf:"bytes,11,opt,name=child_id,json=childId,proto3" json:"child_id,omitempty"`
+	Author        string                 `protobuf:"bytes,12,opt,name=author,proto3" json:"author,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Entry) Reset() {
+	*x = Entry{}
+	mi := &file_babytrack_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Entry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Entry) ProtoMessage() {}
+
+func (x *Entry) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Entry.ProtoReflect.Descriptor instead.
+func (*Entry) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Entry) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Entry) GetTs() int64 {
+	if x != nil {
+		return x.Ts
+	}
+	return 0
+}
+
+func (x *Entry) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Entry) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *Entry) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+func (x *Entry) GetUpdatedAt() int64 {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return 0
+}
+
+func (x *Entry) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Entry) GetDataJson() string {
+	if x != nil {
+		return x.DataJson
+	}
+	return ""
+}
+
+func (x *Entry) GetEndedTs() int64 {
+	if x != nil && x.EndedTs != nil {
+		return *x.EndedTs
+	}
+	return 0
+}
+
+func (x *Entry) GetOngoing() bool {
+	if x != nil {
+		return x.Ongoing
+	}
+	return false
+}
+
+func (x *Entry) GetChildId() string {
+	if x != nil {
+		return x.ChildId
+	}
+	return ""
+}
+
+func (x *Entry) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+type ListEntriesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cursor        int64                  `protobuf:"varint,1,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListEntriesRequest) Reset() {
+	*x = ListEntriesRequest{}
+	mi := &file_babytrack_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListEntriesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListEntriesRequest) ProtoMessage() {}
+
+func (x *ListEntriesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListEntriesRequest.ProtoReflect.Descriptor instead.
+func (*ListEntriesRequest) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListEntriesRequest) GetCursor() int64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+func (x *ListEntriesRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListEntriesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*Entry               `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	Cursor        int64                  `protobuf:"varint,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	HasMore       bool                   `protobuf:"varint,3,opt,name=has_more,json=hasMore,proto3" json:"has_more,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListEntriesResponse) Reset() {
+	*x = ListEntriesResponse{}
+	mi := &file_babytrack_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListEntriesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListEntriesResponse) ProtoMessage() {}
+
+func (x *ListEntriesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListEntriesResponse.ProtoReflect.Descriptor instead.
+func (*ListEntriesResponse) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListEntriesResponse) GetEntries() []*Entry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *ListEntriesResponse) GetCursor() int64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+func (x *ListEntriesResponse) GetHasMore() bool {
+	if x != nil {
+		return x.HasMore
+	}
+	return false
+}
+
+type PutEntryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entry         *Entry                 `protobuf:"bytes,1,opt,name=entry,proto3" json:"entry,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutEntryRequest) Reset() {
+	*x = PutEntryRequest{}
+	mi := &file_babytrack_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutEntryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutEntryRequest) ProtoMessage() {}
+
+func (x *PutEntryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutEntryRequest.ProtoReflect.Descriptor instead.
+func (*PutEntryRequest) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PutEntryRequest) GetEntry() *Entry {
+	if x != nil {
+		return x.Entry
+	}
+	return nil
+}
+
+type PutEntryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           int64                  `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutEntryResponse) Reset() {
+	*x = PutEntryResponse{}
+	mi := &file_babytrack_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutEntryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutEntryResponse) ProtoMessage() {}
+
+func (x *PutEntryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutEntryResponse.ProtoReflect.Descriptor instead.
+func (*PutEntryResponse) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PutEntryResponse) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+type DeleteEntryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteEntryRequest) Reset() {
+	*x = DeleteEntryRequest{}
+	mi := &file_babytrack_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteEntryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteEntryRequest) ProtoMessage() {}
+
+func (x *DeleteEntryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteEntryRequest.ProtoReflect.Descriptor instead.
+func (*DeleteEntryRequest) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeleteEntryRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteEntryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           int64                  `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteEntryResponse) Reset() {
+	*x = DeleteEntryResponse{}
+	mi := &file_babytrack_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteEntryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteEntryResponse) ProtoMessage() {}
+
+func (x *DeleteEntryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteEntryResponse.ProtoReflect.Descriptor instead.
+func (*DeleteEntryResponse) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteEntryResponse) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+type SyncRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cursor        int64                  `protobuf:"varint,1,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncRequest) Reset() {
+	*x = SyncRequest{}
+	mi := &file_babytrack_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncRequest) ProtoMessage() {}
+
+func (x *SyncRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncRequest.ProtoReflect.Descriptor instead.
+func (*SyncRequest) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SyncRequest) GetCursor() int64 {
+	if x != nil {
+		return x.Cursor
+	}
+	return 0
+}
+
+type SyncEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*SyncEvent_Entry
+	//	*SyncEvent_Deleted
+	//	*SyncEvent_ConfigJson
+	Event         isSyncEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SyncEvent) Reset() {
+	*x = SyncEvent{}
+	mi := &file_babytrack_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SyncEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SyncEvent) ProtoMessage() {}
+
+func (x *SyncEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SyncEvent.ProtoReflect.Descriptor instead.
+func (*SyncEvent) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SyncEvent) GetEvent() isSyncEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *SyncEvent) GetEntry() *Entry {
+	if x != nil {
+		if x, ok := x.Event.(*SyncEvent_Entry); ok {
+			return x.Entry
+		}
+	}
+	return nil
+}
+
+func (x *SyncEvent) GetDeleted() *Deletion {
+	if x != nil {
+		if x, ok := x.Event.(*SyncEvent_Deleted); ok {
+			return x.Deleted
+		}
+	}
+	return nil
+}
+
+func (x *SyncEvent) GetConfigJson() string {
+	if x != nil {
+		if x, ok := x.Event.(*SyncEvent_ConfigJson); ok {
+			return x.ConfigJson
+		}
+	}
+	return ""
+}
+
+type isSyncEvent_Event interface {
+	isSyncEvent_Event()
+}
+
+type SyncEvent_Entry struct {
+	Entry *Entry `protobuf:"bytes,1,opt,name=entry,proto3,oneof"`
+}
+
+type SyncEvent_Deleted struct {
+	Deleted *Deletion `protobuf:"bytes,2,opt,name=deleted,proto3,oneof"`
+}
+
+type SyncEvent_ConfigJson struct {
+	ConfigJson string `protobuf:"bytes,3,opt,name=config_json,json=configJson,proto3,oneof"`
+}
+
+func (*SyncEvent_Entry) isSyncEvent_Event() {}
+
+func (*SyncEvent_Deleted) isSyncEvent_Event() {}
+
+func (*SyncEvent_ConfigJson) isSyncEvent_Event() {}
+
+type Deletion struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Seq           int64                  `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"`
+	ChildId       string                 `protobuf:"bytes,3,opt,name=child_id,json=childId,proto3" json:"child_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Deletion) Reset() {
+	*x = Deletion{}
+	mi := &file_babytrack_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Deletion) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Deletion) ProtoMessage() {}
+
+func (x *Deletion) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Deletion.ProtoReflect.Descriptor instead.
+func (*Deletion) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Deletion) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Deletion) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Deletion) GetChildId() string {
+	if x != nil {
+		return x.ChildId
+	}
+	return ""
+}
+
+type Family struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Notes         string                 `protobuf:"bytes,3,opt,name=notes,proto3" json:"notes,omitempty"`
+	CreatedAt     int64                  `protobuf:"varint,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Archived      bool                   `protobuf:"varint,5,opt,name=archived,proto3" json:"archived,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Family) Reset() {
+	*x = Family{}
+	mi := &file_babytrack_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Family) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Family) ProtoMessage() {}
+
+func (x *Family) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Family.ProtoReflect.Descriptor instead.
+func (*Family) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Family) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Family) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Family) GetNotes() string {
+	if x != nil {
+		return x.Notes
+	}
+	return ""
+}
+
+func (x *Family) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+func (x *Family) GetArchived() bool {
+	if x != nil {
+		return x.Archived
+	}
+	return false
+}
+
+type AccessLink struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Token         string                 `protobuf:"bytes,2,opt,name=token,proto3" json:"token,omitempty"`
+	FamilyId      string                 `protobuf:"bytes,3,opt,name=family_id,json=familyId,proto3" json:"family_id,omitempty"`
+	Label         string                 `protobuf:"bytes,4,opt,name=label,proto3" json:"label,omitempty"`
+	Role          string                 `protobuf:"bytes,5,opt,name=role,proto3" json:"role,omitempty"`
+	ExpiresAt     *int64                 `protobuf:"varint,6,opt,name=expires_at,json=expiresAt,proto3,oneof" json:"expires_at,omitempty"`
+	CreatedAt     int64                  `protobuf:"varint,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AccessLink) Reset() {
+	*x = AccessLink{}
+	mi := &file_babytrack_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccessLink) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccessLink) ProtoMessage() {}
+
+func (x *AccessLink) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccessLink.ProtoReflect.Descriptor instead.
+func (*AccessLink) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *AccessLink) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AccessLink) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *AccessLink) GetFamilyId() string {
+	if x != nil {
+		return x.FamilyId
+	}
+	return ""
+}
+
+func (x *AccessLink) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *AccessLink) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *AccessLink) GetExpiresAt() int64 {
+	if x != nil && x.ExpiresAt != nil {
+		return *x.ExpiresAt
+	}
+	return 0
+}
+
+func (x *AccessLink) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+type LoginRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Username      string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Password      string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginRequest) Reset() {
+	*x = LoginRequest{}
+	mi := &file_babytrack_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginRequest) ProtoMessage() {}
+
+func (x *LoginRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginRequest.ProtoReflect.Descriptor instead.
+func (*LoginRequest) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *LoginRequest) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *LoginRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+type LoginResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	ExpiresAt     int64                  `protobuf:"varint,2,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginResponse) Reset() {
+	*x = LoginResponse{}
+	mi := &file_babytrack_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginResponse) ProtoMessage() {}
+
+func (x *LoginResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginResponse.ProtoReflect.Descriptor instead.
+func (*LoginResponse) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *LoginResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *LoginResponse) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+type ListFamiliesRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	IncludeArchived bool                   `protobuf:"varint,1,opt,name=include_archived,json=includeArchived,proto3" json:"include_archived,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ListFamiliesRequest) Reset() {
+	*x = ListFamiliesRequest{}
+	mi := &file_babytrack_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFamiliesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFamiliesRequest) ProtoMessage() {}
+
+func (x *ListFamiliesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFamiliesRequest.ProtoReflect.Descriptor instead.
+func (*ListFamiliesRequest) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ListFamiliesRequest) GetIncludeArchived() bool {
+	if x != nil {
+		return x.IncludeArchived
+	}
+	return false
+}
+
+type ListFamiliesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Families      []*Family              `protobuf:"bytes,1,rep,name=families,proto3" json:"families,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFamiliesResponse) Reset() {
+	*x = ListFamiliesResponse{}
+	mi := &file_babytrack_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFamiliesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFamiliesResponse) ProtoMessage() {}
+
+func (x *ListFamiliesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFamiliesResponse.ProtoReflect.Descriptor instead.
+func (*ListFamiliesResponse) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ListFamiliesResponse) GetFamilies() []*Family {
+	if x != nil {
+		return x.Families
+	}
+	return nil
+}
+
+type GetFamilyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetFamilyRequest) Reset() {
+	*x = GetFamilyRequest{}
+	mi := &file_babytrack_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetFamilyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFamilyRequest) ProtoMessage() {}
+
+func (x *GetFamilyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFamilyRequest.ProtoReflect.Descriptor instead.
+func (*GetFamilyRequest) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *GetFamilyRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CreateFamilyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Notes         string                 `protobuf:"bytes,2,opt,name=notes,proto3" json:"notes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateFamilyRequest) Reset() {
+	*x = CreateFamilyRequest{}
+	mi := &file_babytrack_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateFamilyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateFamilyRequest) ProtoMessage() {}
+
+func (x *CreateFamilyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateFamilyRequest.ProtoReflect.Descriptor instead.
+func (*CreateFamilyRequest) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *CreateFamilyRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CreateFamilyRequest) GetNotes() string {
+	if x != nil {
+		return x.Notes
+	}
+	return ""
+}
+
+type CreateAccessLinkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FamilyId      string                 `protobuf:"bytes,1,opt,name=family_id,json=familyId,proto3" json:"family_id,omitempty"`
+	Label         string                 `protobuf:"bytes,2,opt,name=label,proto3" json:"label,omitempty"`
+	Role          string                 `protobuf:"bytes,3,opt,name=role,proto3" json:"role,omitempty"`
+	ExpiresAt     *int64                 `protobuf:"varint,4,opt,name=expires_at,json=expiresAt,proto3,oneof" json:"expires_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateAccessLinkRequest) Reset() {
+	*x = CreateAccessLinkRequest{}
+	mi := &file_babytrack_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateAccessLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateAccessLinkRequest) ProtoMessage() {}
+
+func (x *CreateAccessLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_babytrack_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateAccessLinkRequest.ProtoReflect.Descriptor instead.
+func (*CreateAccessLinkRequest) Descriptor() ([]byte, []int) {
+	return file_babytrack_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *CreateAccessLinkRequest) GetFamilyId() string {
+	if x != nil {
+		return x.FamilyId
+	}
+	return ""
+}
+
+func (x *CreateAccessLinkRequest) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *CreateAccessLinkRequest) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *CreateAccessLinkRequest) GetExpiresAt() int64 {
+	if x != nil && x.ExpiresAt != nil {
+		return *x.ExpiresAt
+	}
+	return 0
+}
+
+var File_babytrack_proto protoreflect.FileDescriptor
+
+const file_babytrack_proto_rawDesc = "" +
+	"\n" +
+	"\x0fbabytrack.proto\x12\fbabytrack.v1\"\xb3\x02\n" +
+	"\x05Entry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x0e\n" +
+	"\x02ts\x18\x02 \x01(\x03R\x02ts\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x14\n" +
+	"\x05value\x18\x04 \x01(\tR\x05value\x12\x18\n" +
+	"\adeleted\x18\x05 \x01(\bR\adeleted\x12\x1d\n" +
+	"\n" +
+	"updated_at\x18\x06 \x01(\x03R\tupdatedAt\x12\x10\n" +
+	"\x03seq\x18\a \x01(\x03R\x03seq\x12\x1b\n" +
+	"\tdata_json\x18\b \x01(\tR\bdataJson\x12\x1e\n" +
+	"\bended_ts\x18\t \x01(\x03H\x00R\aendedTs\x88\x01\x01\x12\x18\n" +
+	"\aongoing\x18\n" +
+	" \x01(\bR\aongoing\x12\x19\n" +
+	"\bchild_id\x18\v \x01(\tR\achildId\x12\x16\n" +
+	"\x06author\x18\f \x01(\tR\x06authorB\v\n" +
+	"\t_ended_ts\"B\n" +
+	"\x12ListEntriesRequest\x12\x16\n" +
+	"\x06cursor\x18\x01 \x01(\x03R\x06cursor\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"w\n" +
+	"\x13ListEntriesResponse\x12-\n" +
+	"\aentries\x18\x01 \x03(\v2\x13.babytrack.v1.EntryR\aentries\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\x03R\x06cursor\x12\x19\n" +
+	"\bhas_more\x18\x03 \x01(\bR\ahasMore\"<\n" +
+	"\x0fPutEntryRequest\x12)\n" +
+	"\x05entry\x18\x01 \x01(\v2\x13.babytrack.v1.EntryR\x05entry\"$\n" +
+	"\x10PutEntryResponse\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x03R\x03seq\"$\n" +
+	"\x12DeleteEntryRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"'\n" +
+	"\x13DeleteEntryResponse\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x03R\x03seq\"%\n" +
+	"\vSyncRequest\x12\x16\n" +
+	"\x06cursor\x18\x01 \x01(\x03R\x06cursor\"\x98\x01\n" +
+	"\tSyncEvent\x12+\n" +
+	"\x05entry\x18\x01 \x01(\v2\x13.babytrack.v1.EntryH\x00R\x05entry\x122\n" +
+	"\adeleted\x18\x02 \x01(\v2\x16.babytrack.v1.DeletionH\x00R\adeleted\x12!\n" +
+	"\vconfig_json\x18\x03 \x01(\tH\x00R\n" +
+	"configJsonB\a\n" +
+	"\x05event\"G\n" +
+	"\bDeletion\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03seq\x18\x02 \x01(\x03R\x03seq\x12\x19\n" +
+	"\bchild_id\x18\x03 \x01(\tR\achildId\"}\n" +
+	"\x06Family\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05notes\x18\x03 \x01(\tR\x05notes\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\x03R\tcreatedAt\x12\x1a\n" +
+	"\barchived\x18\x05 \x01(\bR\barchived\"\xcb\x01\n" +
+	"\n" +
+	"AccessLink\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05token\x18\x02 \x01(\tR\x05token\x12\x1b\n" +
+	"\tfamily_id\x18\x03 \x01(\tR\bfamilyId\x12\x14\n" +
+	"\x05label\x18\x04 \x01(\tR\x05label\x12\x12\n" +
+	"\x04role\x18\x05 \x01(\tR\x04role\x12\"\n" +
+	"\n" +
+	"expires_at\x18\x06 \x01(\x03H\x00R\texpiresAt\x88\x01\x01\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\a \x01(\x03R\tcreatedAtB\r\n" +
+	"\v_expires_at\"F\n" +
+	"\fLoginRequest\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x12\x1a\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\"D\n" +
+	"\rLoginResponse\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x02 \x01(\x03R\texpiresAt\"@\n" +
+	"\x13ListFamiliesRequest\x12)\n" +
+	"\x10include_archived\x18\x01 \x01(\bR\x0fincludeArchived\"H\n" +
+	"\x14ListFamiliesResponse\x120\n" +
+	"\bfamilies\x18\x01 \x03(\v2\x14.babytrack.v1.FamilyR\bfamilies\"\"\n" +
+	"\x10GetFamilyRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"?\n" +
+	"\x13CreateFamilyRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05notes\x18\x02 \x01(\tR\x05notes\"\x93\x01\n" +
+	"\x17CreateAccessLinkRequest\x12\x1b\n" +
+	"\tfamily_id\x18\x01 \x01(\tR\bfamilyId\x12\x14\n" +
+	"\x05label\x18\x02 \x01(\tR\x05label\x12\x12\n" +
+	"\x04role\x18\x03 \x01(\tR\x04role\x12\"\n" +
+	"\n" +
+	"expires_at\x18\x04 \x01(\x03H\x00R\texpiresAt\x88\x01\x01B\r\n" +
+	"\v_expires_at2\xbf\x02\n" +
+	"\fEntryService\x12R\n" +
+	"\vListEntries\x12 .babytrack.v1.ListEntriesRequest\x1a!.babytrack.v1.ListEntriesResponse\x12I\n" +
+	"\bPutEntry\x12\x1d.babytrack.v1.PutEntryRequest\x1a\x1e.babytrack.v1.PutEntryResponse\x12R\n" +
+	"\vDeleteEntry\x12 .babytrack.v1.DeleteEntryRequest\x1a!.babytrack.v1.DeleteEntryResponse\x12<\n" +
+	"\x04Sync\x12\x19.babytrack.v1.SyncRequest\x1a\x17.babytrack.v1.SyncEvent0\x012\x88\x03\n" +
+	"\fAdminService\x12@\n" +
+	"\x05Login\x12\x1a.babytrack.v1.LoginRequest\x1a\x1b.babytrack.v1.LoginResponse\x12U\n" +
+	"\fListFamilies\x12!.babytrack.v1.ListFamiliesRequest\x1a\".babytrack.v1.ListFamiliesResponse\x12A\n" +
+	"\tGetFamily\x12\x1e.babytrack.v1.GetFamilyRequest\x1a\x14.babytrack.v1.Family\x12G\n" +
+	"\fCreateFamily\x12!.babytrack.v1.CreateFamilyRequest\x1a\x14.babytrack.v1.Family\x12S\n" +
+	"\x10CreateAccessLink\x12%.babytrack.v1.CreateAccessLinkRequest\x1a\x18.babytrack.v1.AccessLinkB\x0fZ\rbabytrackd/pbb\x06proto3"
+
+var (
+	file_babytrack_proto_rawDescOnce sync.Once
+	file_babytrack_proto_rawDescData []byte
+)
+
+func file_babytrack_proto_rawDescGZIP() []byte {
+	file_babytrack_proto_rawDescOnce.Do(func() {
+		file_babytrack_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_babytrack_proto_rawDesc), len(file_babytrack_proto_rawDesc)))
+	})
+	return file_babytrack_proto_rawDescData
+}
+
+var file_babytrack_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_babytrack_proto_goTypes = []any{
+	(*Entry)(nil),                   // 0: babytrack.v1.Entry
+	(*ListEntriesRequest)(nil),      // 1: babytrack.v1.ListEntriesRequest
+	(*ListEntriesResponse)(nil),     // 2: babytrack.v1.ListEntriesResponse
+	(*PutEntryRequest)(nil),         // 3: babytrack.v1.PutEntryRequest
+	(*PutEntryResponse)(nil),        // 4: babytrack.v1.PutEntryResponse
+	(*DeleteEntryRequest)(nil),      // 5: babytrack.v1.DeleteEntryRequest
+	(*DeleteEntryResponse)(nil),     // 6: babytrack.v1.DeleteEntryResponse
+	(*SyncRequest)(nil),             // 7: babytrack.v1.SyncRequest
+	(*SyncEvent)(nil),               // 8: babytrack.v1.SyncEvent
+	(*Deletion)(nil),                // 9: babytrack.v1.Deletion
+	(*Family)(nil),                  // 10: babytrack.v1.Family
+	(*AccessLink)(nil),              // 11: babytrack.v1.AccessLink
+	(*LoginRequest)(nil),            // 12: babytrack.v1.LoginRequest
+	(*LoginResponse)(nil),           // 13: babytrack.v1.LoginResponse
+	(*ListFamiliesRequest)(nil),     // 14: babytrack.v1.ListFamiliesRequest
+	(*ListFamiliesResponse)(nil),    // 15: babytrack.v1.ListFamiliesResponse
+	(*GetFamilyRequest)(nil),        // 16: babytrack.v1.GetFamilyRequest
+	(*CreateFamilyRequest)(nil),     // 17: babytrack.v1.CreateFamilyRequest
+	(*CreateAccessLinkRequest)(nil), // 18: babytrack.v1.CreateAccessLinkRequest
+}
+var file_babytrack_proto_depIdxs = []int32{
+	0,  // 0: babytrack.v1.ListEntriesResponse.entries:type_name -> babytrack.v1.Entry
+	0,  // 1: babytrack.v1.PutEntryRequest.entry:type_name -> babytrack.v1.Entry
+	0,  // 2: babytrack.v1.SyncEvent.entry:type_name -> babytrack.v1.Entry
+	9,  // 3: babytrack.v1.SyncEvent.deleted:type_name -> babytrack.v1.Deletion
+	10, // 4: babytrack.v1.ListFamiliesResponse.families:type_name -> babytrack.v1.Family
+	1,  // 5: babytrack.v1.EntryService.ListEntries:input_type -> babytrack.v1.ListEntriesRequest
+	3,  // 6: babytrack.v1.EntryService.PutEntry:input_type -> babytrack.v1.PutEntryRequest
+	5,  // 7: babytrack.v1.EntryService.DeleteEntry:input_type -> babytrack.v1.DeleteEntryRequest
+	7,  // 8: babytrack.v1.EntryService.Sync:input_type -> babytrack.v1.SyncRequest
+	12, // 9: babytrack.v1.AdminService.Login:input_type -> babytrack.v1.LoginRequest
+	14, // 10: babytrack.v1.AdminService.ListFamilies:input_type -> babytrack.v1.ListFamiliesRequest
+	16, // 11: babytrack.v1.AdminService.GetFamily:input_type -> babytrack.v1.GetFamilyRequest
+	17, // 12: babytrack.v1.AdminService.CreateFamily:input_type -> babytrack.v1.CreateFamilyRequest
+	18, // 13: babytrack.v1.AdminService.CreateAccessLink:input_type -> babytrack.v1.CreateAccessLinkRequest
+	2,  // 14: babytrack.v1.EntryService.ListEntries:output_type -> babytrack.v1.ListEntriesResponse
+	4,  // 15: babytrack.v1.EntryService.PutEntry:output_type -> babytrack.v1.PutEntryResponse
+	6,  // 16: babytrack.v1.EntryService.DeleteEntry:output_type -> babytrack.v1.DeleteEntryResponse
+	8,  // 17: babytrack.v1.EntryService.Sync:output_type -> babytrack.v1.SyncEvent
+	13, // 18: babytrack.v1.AdminService.Login:output_type -> babytrack.v1.LoginResponse
+	15, // 19: babytrack.v1.AdminService.ListFamilies:output_type -> babytrack.v1.ListFamiliesResponse
+	10, // 20: babytrack.v1.AdminService.GetFamily:output_type -> babytrack.v1.Family
+	10, // 21: babytrack.v1.AdminService.CreateFamily:output_type -> babytrack.v1.Family
+	11, // 22: babytrack.v1.AdminService.CreateAccessLink:output_type -> babytrack.v1.AccessLink
+	14, // [14:23] is the sub-list for method output_type
+	5,  // [5:14] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_babytrack_proto_init() }
+func file_babytrack_proto_init() {
+	if File_babytrack_proto != nil {
+		return
+	}
+	file_babytrack_proto_msgTypes[0].OneofWrappers = []any{}
+	file_babytrack_proto_msgTypes[8].OneofWrappers = []any{
+		(*SyncEvent_Entry)(nil),
+		(*SyncEvent_Deleted)(nil),
+		(*SyncEvent_ConfigJson)(nil),
+	}
+	file_babytrack_proto_msgTypes[11].OneofWrappers = []any{}
+	file_babytrack_proto_msgTypes[18].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_babytrack_proto_rawDesc), len(file_babytrack_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   19,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_babytrack_proto_goTypes,
+		DependencyIndexes: file_babytrack_proto_depIdxs,
+		MessageInfos:      file_babytrack_proto_msgTypes,
+	}.Build()
+	File_babytrack_proto = out.File
+	file_babytrack_proto_goTypes = nil
+	file_babytrack_proto_depIdxs = nil
+}
@@ -0,0 +1,138 @@
+package babytrack
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Nap prediction: the next nap is expected one wake window after the baby
+// last woke. The wake window is the median of recent daytime wake windows
+// when there are enough of them, otherwise the typical range for the
+// child's age.
+
+const (
+	predictionHistory = 3 * 24 * time.Hour
+	minWakeSamples    = 3
+	maxWakeWindow     = 6 * time.Hour // longer gaps are missed entries, not wake windows
+	recentWindowSlack = 15 * time.Minute
+)
+
+// ageWakeWindows lists typical wake windows by age, youngest first.
+var ageWakeWindows = []struct {
+	maxWeeks int
+	min, max time.Duration
+}{
+	{4, 35 * time.Minute, 60 * time.Minute},
+	{12, 60 * time.Minute, 90 * time.Minute},
+	{20, 75 * time.Minute, 2 * time.Hour},
+	{32, 2 * time.Hour, 3 * time.Hour},
+	{44, 150 * time.Minute, 210 * time.Minute},
+	{64, 3 * time.Hour, 4 * time.Hour},
+	{104, 5 * time.Hour, 6 * time.Hour},
+}
+
+// NapPrediction is the expected next nap. State is "awake", "asleep" or
+// "unknown" (no sleep entries); the window fields are only set when awake
+// and a wake window could be estimated.
+type NapPrediction struct {
+	State        string `json:"state"`
+	Since        int64  `json:"since,omitempty"` // ts of the last sleep entry
+	Basis        string `json:"basis,omitempty"` // "recent" or "age"
+	Samples      int    `json:"samples"`
+	AgeWeeks     *int   `json:"age_weeks,omitempty"`
+	WakeMinMin   int    `json:"wake_window_min_min,omitempty"`
+	WakeMaxMin   int    `json:"wake_window_max_min,omitempty"`
+	NextNapStart int64  `json:"next_nap_start,omitempty"`
+	NextNapEnd   int64  `json:"next_nap_end,omitempty"`
+}
+
+// recentWakeWindows returns the durations between each awake entry and the
+// following sleeping entry.
+func recentWakeWindows(entries []Entry) []time.Duration {
+	var windows []time.Duration
+	var wokeAt int64
+	for _, e := range entries {
+		switch e.Value {
+		case "awake":
+			wokeAt = e.Ts
+		case "sleeping":
+			if wokeAt != 0 {
+				if d := time.Duration(e.Ts-wokeAt) * time.Millisecond; d > 0 && d <= maxWakeWindow {
+					windows = append(windows, d)
+				}
+			}
+			wokeAt = 0
+		}
+	}
+	return windows
+}
+
+// predictNap estimates the family's next nap as of now.
+func predictNap(db EntryStore, familyID string, settings FamilySettings, now time.Time) (*NapPrediction, error) {
+	entries, err := db.GetEntriesOfType(familyID, "sleep", now.Add(-predictionHistory).UnixMilli(), now.UnixMilli()+1)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &NapPrediction{State: "unknown"}
+	if weeks, ok := settings.AgeWeeks(now); ok {
+		p.AgeWeeks = &weeks
+	}
+	if len(entries) == 0 {
+		return p, nil
+	}
+	last := entries[len(entries)-1]
+	p.Since = last.Ts
+	if last.Value != "awake" {
+		p.State = "asleep"
+		return p, nil
+	}
+	p.State = "awake"
+
+	var lo, hi time.Duration
+	windows := recentWakeWindows(entries)
+	p.Samples = len(windows)
+	switch {
+	case len(windows) >= minWakeSamples:
+		slices.Sort(windows)
+		median := windows[len(windows)/2]
+		lo, hi = median-recentWindowSlack, median+recentWindowSlack
+		p.Basis = "recent"
+	case p.AgeWeeks != nil:
+		for _, w := range ageWakeWindows {
+			lo, hi = w.min, w.max
+			if *p.AgeWeeks <= w.maxWeeks {
+				break
+			}
+		}
+		p.Basis = "age"
+	default:
+		return p, nil
+	}
+
+	p.WakeMinMin, p.WakeMaxMin = int(lo/time.Minute), int(hi/time.Minute)
+	woke := time.UnixMilli(last.Ts)
+	p.NextNapStart = woke.Add(lo).UnixMilli()
+	p.NextNapEnd = woke.Add(hi).UnixMilli()
+	return p, nil
+}
+
+// familyPrediction computes the current prediction for a family.
+func (s *Server) familyPrediction(familyID string) (*NapPrediction, error) {
+	settings, err := s.db.GetFamilySettings(familyID)
+	if err != nil {
+		return nil, err
+	}
+	return predictNap(s.db, familyID, settings, time.Now())
+}
+
+// handlePredictions serves GET /api/v1/predictions for the caller's family.
+func (s *Server) handlePredictions(w http.ResponseWriter, r *http.Request) {
+	p, err := s.familyPrediction(accessLinkFrom(r.Context()).FamilyID)
+	if err != nil {
+		serverError(w, "failed to compute predictions", err)
+		return
+	}
+	jsonOK(w, p)
+}
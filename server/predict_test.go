@@ -0,0 +1,74 @@
+package babytrack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPredictNap(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	add := func(at time.Time, value string) {
+		e := &Entry{ID: generateToken(8), FamilyID: family.ID, Ts: at.UnixMilli(), Type: "sleep", Value: value}
+		if err := db.UpsertEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := FamilySettings{BirthDate: "2025-04-01"} // 10 weeks old
+
+	p, err := predictNap(db, family.ID, settings, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.State != "unknown" || p.AgeWeeks == nil || *p.AgeWeeks != 10 {
+		t.Errorf("no entries: %+v", p)
+	}
+
+	// One wake window: falls back to the age table
+	add(now.Add(-3*time.Hour), "awake")
+	add(now.Add(-2*time.Hour), "sleeping")
+	add(now.Add(-time.Hour), "awake")
+	p, _ = predictNap(db, family.ID, settings, now)
+	if p.State != "awake" || p.Basis != "age" || p.WakeMinMin != 60 || p.WakeMaxMin != 90 {
+		t.Errorf("age basis: %+v", p)
+	}
+	if p.NextNapStart != now.UnixMilli() {
+		t.Errorf("next nap start = %v, want %v", time.UnixMilli(p.NextNapStart), now)
+	}
+
+	// Enough recent windows (60, 80, 100 min) to use their median
+	add(now.Add(-8*time.Hour), "awake")
+	add(now.Add(-8*time.Hour+80*time.Minute), "sleeping")
+	add(now.Add(-6*time.Hour), "awake")
+	add(now.Add(-6*time.Hour+100*time.Minute), "sleeping")
+	p, _ = predictNap(db, family.ID, FamilySettings{}, now)
+	if p.Basis != "recent" || p.Samples != 3 || p.WakeMinMin != 65 || p.WakeMaxMin != 95 || p.AgeWeeks != nil {
+		t.Errorf("recent basis: %+v", p)
+	}
+
+	add(now.Add(-time.Minute), "sleeping")
+	p, _ = predictNap(db, family.ID, settings, now)
+	if p.State != "asleep" || p.NextNapStart != 0 {
+		t.Errorf("asleep: %+v", p)
+	}
+}
+
+func TestRecentWakeWindows(t *testing.T) {
+	h := time.Hour.Milliseconds()
+	entries := []Entry{
+		{Ts: 0, Value: "sleeping"}, // no preceding awake
+		{Ts: 1 * h, Value: "awake"},
+		{Ts: 2 * h, Value: "sleeping"},
+		{Ts: 3 * h, Value: "awake"},
+		{Ts: 13 * h, Value: "sleeping"}, // missed entries, too long
+	}
+	if w := recentWakeWindows(entries); len(w) != 1 || w[0] != time.Hour {
+		t.Errorf("windows = %v", w)
+	}
+}
@@ -0,0 +1,141 @@
+package babytrack
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies lists the networks whose X-Forwarded-* headers are believed.
+// Empty means the server is reached directly and those headers are ignored.
+var trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses a comma-separated list of IPs and CIDRs, as given
+// in TRUSTED_PROXIES. Bare IPs are treated as single-host networks.
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", part)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy network %q: %w", part, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// isTrustedProxy reports whether addr (an IP without port) is a trusted proxy.
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost returns the TCP peer address of the request without the port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientIP returns the address of the client that made the request. When the
+// peer is a trusted proxy, X-Forwarded-For is walked right to left and the
+// first hop that isn't itself a trusted proxy wins; anything further left was
+// supplied by the client and can't be believed.
+func clientIP(r *http.Request) string {
+	ip := remoteHost(r)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// isSecure reports whether the client connected over HTTPS, either directly or
+// to a trusted proxy that says so in X-Forwarded-Proto.
+func isSecure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !isTrustedProxy(remoteHost(r)) {
+		return false
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// parseBasePath normalises BASE_PATH to a leading slash and no trailing slash,
+// so "babytrack/", "/babytrack" and "/babytrack/" all give "/babytrack".
+// The root ("" or "/") gives "".
+func parseBasePath(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), "/")
+	if s == "" {
+		return ""
+	}
+	return "/" + s
+}
+
+// withBasePath serves next under prefix, stripping it before routing. The bare
+// prefix redirects to prefix+"/" so relative URLs in the pages resolve.
+func withBasePath(prefix string, next http.Handler) http.Handler {
+	if prefix == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == prefix {
+			target := prefix + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			jsonError(w, http.StatusNotFound, errCodeNotFound, "not found")
+			return
+		}
+		http.StripPrefix(prefix, next).ServeHTTP(w, r)
+	})
+}
+
+// cookiePath scopes cookies to the deployment so other apps on the same host
+// never see them.
+func (s *Server) cookiePath() string {
+	return s.basePath + "/"
+}
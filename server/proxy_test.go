@@ -0,0 +1,140 @@
+package babytrack
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func withTrustedProxies(t *testing.T, spec string) {
+	t.Helper()
+	nets, err := parseTrustedProxies(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := trustedProxies
+	trustedProxies = nets
+	t.Cleanup(func() { trustedProxies = old })
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets, err := parseTrustedProxies(" 127.0.0.1, 10.0.0.0/8 ,::1,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 3 {
+		t.Fatalf("expected 3 networks, got %d", len(nets))
+	}
+	for _, bad := range []string{"nope", "10.0.0.0/33"} {
+		if _, err := parseTrustedProxies(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	withTrustedProxies(t, "127.0.0.1,10.0.0.0/8")
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"untrusted peer ignores header", "203.0.113.5:1234", "1.2.3.4", "203.0.113.5"},
+		{"trusted peer", "127.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"spoofed left hop ignored", "127.0.0.1:1234", "6.6.6.6, 198.51.100.7", "198.51.100.7"},
+		{"proxy chain", "127.0.0.1:1234", "198.51.100.7, 10.1.2.3", "198.51.100.7"},
+		{"garbage hop stops walk", "127.0.0.1:1234", "198.51.100.7, junk", "127.0.0.1"},
+		{"no header", "127.0.0.1:1234", "", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSecure(t *testing.T) {
+	withTrustedProxies(t, "127.0.0.1")
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	if isSecure(r) {
+		t.Error("plain request from proxy reported secure")
+	}
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if !isSecure(r) {
+		t.Error("X-Forwarded-Proto https from trusted proxy not honoured")
+	}
+	r.RemoteAddr = "203.0.113.5:1234"
+	if isSecure(r) {
+		t.Error("X-Forwarded-Proto honoured from untrusted peer")
+	}
+	r.TLS = &tls.ConnectionState{}
+	if !isSecure(r) {
+		t.Error("TLS request not reported secure")
+	}
+}
+
+func TestParseBasePath(t *testing.T) {
+	for in, want := range map[string]string{
+		"": "", "/": "", "babytrack": "/babytrack", "/babytrack/": "/babytrack", " /a/b ": "/a/b",
+	} {
+		if got := parseBasePath(in); got != want {
+			t.Errorf("parseBasePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	s.basePath = "/babytrack"
+	h := withBasePath(s.basePath, s.routes())
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/babytrack/api/v1/health"); w.Code != http.StatusOK {
+		t.Errorf("prefixed health: status %d", w.Code)
+	}
+	if w := get("/api/v1/health"); w.Code != http.StatusNotFound {
+		t.Errorf("unprefixed health: status %d, want 404", w.Code)
+	}
+	if w := get("/babytrack?family=x"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/babytrack/?family=x" {
+		t.Errorf("bare prefix: status %d location %q", w.Code, w.Header().Get("Location"))
+	}
+
+	family, _ := s.db.CreateFamily("Test", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "phone", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/babytrack/t/"+link.Token, nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("token redirect: status %d", w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "/babytrack/?family="+family.ID {
+		t.Errorf("token redirect location = %q", loc)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Error("no cookies set")
+	}
+	for _, c := range cookies {
+		if c.Path != "/babytrack/" {
+			t.Errorf("cookie path = %+v", c)
+		}
+	}
+}
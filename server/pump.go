@@ -0,0 +1,125 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Pumping sessions are "pump" entries whose value is the side (left, right
+// or both) and whose data is a PumpData object.
+
+const pumpTrendDays = 7
+
+var pumpSides = map[string]bool{"left": true, "right": true, "both": true}
+
+// PumpData is the structured payload of a "pump" entry.
+type PumpData struct {
+	DurationMin float64 `json:"duration_min"`
+	VolumeML    float64 `json:"volume_ml"`
+}
+
+// validateEntryData checks the structured payload of an entry. Data must be
+// a JSON object if present; kinds with a schema of their own are checked
+// against it, and the rest as an EntryValue.
+func validateEntryData(e *Entry) error {
+	if len(e.Data) == 0 {
+		return nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(e.Data, &obj); err != nil || obj == nil {
+		return errors.New("data must be a JSON object")
+	}
+	switch e.Type {
+	case "pump":
+		return validatePumpData(e)
+	case "med":
+		return validateMedData(e)
+	case "temp":
+		return validateTempData(e)
+	case "feed":
+		if err := validateFeedData(e); err != nil {
+			return err
+		}
+	}
+	return validateEntryValue(e)
+}
+
+// validatePumpSide checks a pump entry's value, which unlike its data
+// isn't dropped when invalid, so rejects the entry.
+func validatePumpSide(e *Entry) error {
+	if e.Type != "pump" || e.Deleted || pumpSides[e.Value] {
+		return nil
+	}
+	return errors.New("pump side must be left, right or both")
+}
+
+func validatePumpData(e *Entry) error {
+	var p PumpData
+	if err := json.Unmarshal(e.Data, &p); err != nil {
+		return errors.New("pump data: " + err.Error())
+	}
+	if p.DurationMin < 0 || p.DurationMin > 24*60 || p.VolumeML < 0 || p.VolumeML > 2000 {
+		return errors.New("pump duration or volume out of range")
+	}
+	return nil
+}
+
+// PumpingSummary aggregates pumping sessions for one day, with daily totals
+// for the week ending on that day so the admin can see the supply trend.
+type PumpingSummary struct {
+	Sessions int                `json:"sessions"`
+	TotalML  float64            `json:"total_ml"`
+	TotalMin float64            `json:"total_min"`
+	BySideML map[string]float64 `json:"by_side_ml"`
+	Trend    []PumpingDay       `json:"trend"` // oldest first
+}
+
+type PumpingDay struct {
+	Date     string  `json:"date"`
+	Sessions int     `json:"sessions"`
+	TotalML  float64 `json:"total_ml"`
+}
+
+// pumpingSummary returns pumping stats for the day starting at dayStart, or
+// nil if there were no sessions in the trend window.
+func pumpingSummary(db EntryStore, familyID string, dayStart time.Time) (*PumpingSummary, error) {
+	windowStart := dayStart.AddDate(0, 0, -(pumpTrendDays - 1))
+	entries, err := db.GetEntriesForDate(familyID, windowStart.UnixMilli(), dayStart.AddDate(0, 0, 1).UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+
+	sum := &PumpingSummary{BySideML: map[string]float64{}, Trend: make([]PumpingDay, pumpTrendDays)}
+	days := make(map[string]*PumpingDay, pumpTrendDays)
+	for i := range sum.Trend {
+		sum.Trend[i].Date = windowStart.AddDate(0, 0, i).Format("2006-01-02")
+		days[sum.Trend[i].Date] = &sum.Trend[i]
+	}
+
+	found := false
+	today := dayStart.Format("2006-01-02")
+	for _, e := range entries {
+		if e.Type != "pump" {
+			continue
+		}
+		found = true
+		var p PumpData
+		json.Unmarshal(e.Data, &p) // missing data counts as a session with no volume
+		date := time.UnixMilli(e.Ts).In(dayStart.Location()).Format("2006-01-02")
+		if d := days[date]; d != nil {
+			d.Sessions++
+			d.TotalML += p.VolumeML
+		}
+		if date == today {
+			sum.Sessions++
+			sum.TotalML += p.VolumeML
+			sum.TotalMin += p.DurationMin
+			sum.BySideML[e.Value] += p.VolumeML
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return sum, nil
+}
@@ -0,0 +1,89 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestValidateEntryData(t *testing.T) {
+	tests := []struct {
+		typ, value, data string
+		ok               bool
+	}{
+		{"feed", "bf", ``, true},
+		{"feed", "bf", `{"note":"x"}`, true},
+		{"feed", "bf", `[1,2]`, false},
+		{"feed", "bf", `null`, false},
+		{"pump", "left", `{"duration_min":15,"volume_ml":90}`, true},
+		{"pump", "middle", `{"duration_min":15,"volume_ml":90}`, false},
+		{"pump", "middle", ``, false},
+		{"pump", "middle", `not json`, false},
+		{"pump", "both", `{"duration_min":-1,"volume_ml":90}`, false},
+		{"pump", "both", `{"duration_min":20,"volume_ml":"lots"}`, false},
+	}
+	for _, tt := range tests {
+		e := &Entry{Type: tt.typ, Value: tt.value, Data: json.RawMessage(tt.data)}
+		err := validatePumpSide(e)
+		if err == nil {
+			err = validateEntryData(e)
+		}
+		if (err == nil) != tt.ok {
+			t.Errorf("%s/%s %s: err = %v, want ok=%v", tt.typ, tt.value, tt.data, err, tt.ok)
+		}
+	}
+}
+
+func TestPumpingSummary(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+
+	loc := time.FixedZone("client", 10*60*60)
+	day := time.Date(2025, 6, 10, 0, 0, 0, 0, loc)
+	add := func(at time.Time, side, data string) {
+		e := &Entry{ID: generateToken(8), FamilyID: family.ID, Ts: at.UnixMilli(), Type: "pump", Value: side, Data: json.RawMessage(data)}
+		if err := db.UpsertEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(day.Add(7*time.Hour), "left", `{"duration_min":15,"volume_ml":80}`)
+	add(day.Add(13*time.Hour), "right", `{"duration_min":10,"volume_ml":60.5}`)
+	add(day.Add(-20*time.Hour), "both", `{"duration_min":20,"volume_ml":150}`)
+	add(day.AddDate(0, 0, -10), "both", `{"duration_min":20,"volume_ml":999}`) // outside trend window
+
+	sum, err := pumpingSummary(db, family.ID, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum == nil {
+		t.Fatal("expected pumping summary")
+	}
+	if sum.Sessions != 2 || sum.TotalML != 140.5 || sum.TotalMin != 25 {
+		t.Errorf("day totals = %+v", sum)
+	}
+	if sum.BySideML["left"] != 80 || sum.BySideML["right"] != 60.5 {
+		t.Errorf("by side = %v", sum.BySideML)
+	}
+	if len(sum.Trend) != pumpTrendDays || sum.Trend[pumpTrendDays-1].Date != "2025-06-10" {
+		t.Fatalf("trend = %+v", sum.Trend)
+	}
+	if prev := sum.Trend[pumpTrendDays-2]; prev.Date != "2025-06-09" || prev.TotalML != 150 || prev.Sessions != 1 {
+		t.Errorf("previous day = %+v", prev)
+	}
+
+	// Data round-trips through the cursor sync
+	entries, _, _ := db.GetEntriesSinceCursor(family.ID, 0, 10)
+	var p PumpData
+	if err := json.Unmarshal(entries[0].Data, &p); err != nil || p.VolumeML != 80 {
+		t.Errorf("data = %s, %v", entries[0].Data, err)
+	}
+
+	other, _ := db.CreateFamily("Other", "")
+	if sum, _ := pumpingSummary(db, other.ID, day); sum != nil {
+		t.Errorf("expected nil summary without sessions, got %+v", sum)
+	}
+}
@@ -0,0 +1,261 @@
+package babytrack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Push targets deliver a family's alerts to phones and chats through
+// services it already uses, alongside the webhook: an ntfy topic, an
+// Apprise API server that fans out to whatever its URLs name (Telegram,
+// Matrix, Pushover, ...), or a Slack or Discord webhook. Each target's kind
+// picks a backend from pushBackends; adding a service is adding one there.
+// A target takes the events it lists, by default the alerts; feed
+// reminders and daily summaries are sent by reminders.go. Delivery is in
+// the background, once, like the webhook's, and quiet hours hold it back
+// the same way.
+
+const maxPushTargets = 10
+
+// PushTarget is one place a family's alerts are pushed to.
+type PushTarget struct {
+	Kind   string   `json:"kind"`             // ntfy, apprise, slack, discord
+	URL    string   `json:"url"`              // ntfy topic, Apprise API notify, or Slack or Discord webhook URL
+	Token  string   `json:"token,omitempty"`  // ntfy access token
+	Events []string `json:"events,omitempty"` // from pushEvents; empty for the alerts
+	// AppriseURLs are the Apprise URLs to notify, for its stateless
+	// /notify endpoint; empty for a /notify/{key} with its own.
+	AppriseURLs string `json:"apprise_urls,omitempty"`
+}
+
+// pushEvents are what a target can take, and whether it does by default.
+var pushEvents = map[string]bool{
+	"fever":         true,
+	"inactive":      true,
+	"feed_reminder": false,
+	"daily_summary": false,
+	"sync_failure":  false,
+	"feed_overdue":  false,
+}
+
+// wants reports whether the target takes events of the given kind.
+func (t PushTarget) wants(kind string) bool {
+	if len(t.Events) == 0 {
+		return pushEvents[kind]
+	}
+	return slices.Contains(t.Events, kind)
+}
+
+// pushes reports whether any of the family's push targets take kind.
+func (fs FamilySettings) pushes(kind string) bool {
+	return slices.ContainsFunc(fs.Push, func(t PushTarget) bool { return t.wants(kind) })
+}
+
+// pushMessage is what a backend delivers.
+type pushMessage struct {
+	Kind     string // event, e.g. fever
+	Title    string
+	Body     string
+	Priority int         // 1 (min) to 5 (urgent), as ntfy's; 3 is normal
+	Fields   []pushField // Body broken out, for backends that lay it out
+	Ts       time.Time
+}
+
+type pushField struct {
+	Name, Value string
+}
+
+// pushBackend delivers m to t, returning an error if it wasn't accepted.
+type pushBackend func(t PushTarget, m pushMessage) error
+
+var pushBackends = map[string]pushBackend{
+	"ntfy":    pushNtfy,
+	"apprise": pushApprise,
+	"slack":   pushSlack,
+	"discord": pushDiscord,
+}
+
+// pushEmoji heads chat messages by event.
+var pushEmoji = map[string]string{
+	"fever":         "🌡️",
+	"inactive":      "💤",
+	"feed_reminder": "🍼",
+	"daily_summary": "📋",
+	"sync_failure":  "📵",
+	"feed_overdue":  "🍼",
+}
+
+// discordColors are embed colours by priority: grey, blue, amber, red.
+var discordColors = map[int]int{1: 0x95a5a6, 2: 0x3498db, 3: 0x3498db, 4: 0xf39c12, 5: 0xe74c3c}
+
+// alertPriority is how urgently each alert kind is pushed.
+var alertPriority = map[string]int{"fever": 5, "sync_failure": 4, "feed_overdue": 5}
+
+// pushAlert sends the alert to the family's push targets.
+func (s *Server) pushAlert(settings FamilySettings, a Alert) {
+	m := pushMessage{Kind: a.Kind, Body: a.Message, Priority: 3}
+	if p, ok := alertPriority[a.Kind]; ok {
+		m.Priority = p
+	}
+	s.push(a.FamilyID, settings, m)
+}
+
+// push sends m to the family's push targets that take its kind, titled
+// with the family's name.
+func (s *Server) push(familyID string, settings FamilySettings, m pushMessage) {
+	if !settings.pushes(m.Kind) {
+		return
+	}
+	m.Title, m.Ts = "babytrack", time.Now()
+	if f, err := s.db.GetFamily(familyID); err == nil {
+		m.Title = f.Name
+	}
+	for _, t := range settings.Push {
+		if !t.wants(m.Kind) {
+			continue
+		}
+		go func() {
+			if err := pushBackends[t.Kind](t, m); err != nil {
+				slog.Warn("push delivery failed", "error", err, "family_id", familyID, "kind", m.Kind, "target", t.Kind)
+			}
+		}()
+	}
+}
+
+// pushNtfy publishes to an ntfy topic: the body is the message, with the
+// rest in headers.
+func pushNtfy(t PushTarget, m pushMessage) error {
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader([]byte(m.Body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", m.Title)
+	req.Header.Set("Priority", strconv.Itoa(m.Priority))
+	req.Header.Set("Tags", m.Kind)
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	return doPush(req)
+}
+
+// pushApprise posts to an Apprise API server.
+func pushApprise(t PushTarget, m pushMessage) error {
+	typ := "info"
+	if m.Priority >= 4 {
+		typ = "warning"
+	}
+	body, _ := json.Marshal(map[string]any{
+		"urls":  t.AppriseURLs,
+		"title": m.Title,
+		"body":  m.Body,
+		"type":  typ,
+		"tag":   "all",
+	})
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doPush(req)
+}
+
+// pushSlack posts to a Slack incoming webhook, with text for
+// notifications and a block for the channel.
+func pushSlack(t PushTarget, m pushMessage) error {
+	text := strings.TrimSpace(pushEmoji[m.Kind] + " *" + slackEscape(m.Title) + "*")
+	body, _ := json.Marshal(map[string]any{
+		"text": m.Title + ": " + m.Body,
+		"blocks": []any{map[string]any{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": text + "\n" + slackEscape(m.Body)},
+		}},
+	})
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doPush(req)
+}
+
+// pushDiscord posts an embed to a Discord webhook: the fields laid out
+// inline when there are some, else the body.
+func pushDiscord(t PushTarget, m pushMessage) error {
+	embed := map[string]any{
+		"title":     strings.TrimSpace(pushEmoji[m.Kind] + " " + m.Title),
+		"color":     discordColors[m.Priority],
+		"timestamp": m.Ts.UTC().Format(time.RFC3339),
+	}
+	if len(m.Fields) > 0 {
+		lines := strings.SplitN(m.Body, "\n", 2)
+		embed["description"] = lines[0] // the date, for summaries
+		fields := make([]map[string]any, len(m.Fields))
+		for i, f := range m.Fields {
+			fields[i] = map[string]any{"name": f.Name, "value": f.Value, "inline": true}
+		}
+		embed["fields"] = fields
+	} else {
+		embed["description"] = m.Body
+	}
+	body, _ := json.Marshal(map[string]any{
+		"username":         "babytrack",
+		"embeds":           []any{embed},
+		"allowed_mentions": map[string]any{"parse": []string{}},
+	})
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doPush(req)
+}
+
+// slackEscape escapes the characters Slack reads as markup.
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+
+// doPush sends req, treating any non-2xx as failure.
+func doPush(req *http.Request) error {
+	req.Header.Set("User-Agent", "babytrackd/"+version)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// validatePush adds push target problems to fields.
+func (fs FamilySettings) validatePush(fields map[string]string) {
+	if len(fs.Push) > maxPushTargets {
+		fields["push"] = fmt.Sprintf("at most %d targets", maxPushTargets)
+		return
+	}
+	for i, t := range fs.Push {
+		if pushBackends[t.Kind] == nil {
+			fields["push"] = fmt.Sprintf("target %d: unknown kind %q (use ntfy, apprise, slack or discord)", i+1, t.Kind)
+			return
+		}
+		for _, e := range t.Events {
+			if _, ok := pushEvents[e]; !ok {
+				fields["push"] = fmt.Sprintf("target %d: unknown event %q (use fever, inactive, feed_reminder, daily_summary, sync_failure or feed_overdue)", i+1, e)
+				return
+			}
+		}
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fields["push"] = fmt.Sprintf("target %d: url must be an http(s) URL", i+1)
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushAlert(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type push struct {
+		path   string
+		header http.Header
+		body   string
+	}
+	pushes := make(chan push, 2)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pushes <- push{r.URL.Path, r.Header, string(body)}
+	}))
+	defer target.Close()
+
+	family, _ := db.CreateFamily("Test Baby", "")
+	settings := FamilySettings{Push: []PushTarget{
+		{Kind: "ntfy", URL: target.URL + "/baby-alerts", Token: "tk_secret"},
+		{Kind: "apprise", URL: target.URL + "/notify", AppriseURLs: "tgram://bot/chat"},
+	}}
+	if fields := settings.validate(); fields != nil {
+		t.Fatalf("valid targets rejected: %v", fields)
+	}
+	s := &Server{db: db, hub: NewHub(db)}
+	s.pushAlert(settings, Alert{FamilyID: family.ID, Kind: "fever", Message: "Temperature 38.5°C"})
+
+	for range 2 {
+		select {
+		case p := <-pushes:
+			switch p.path {
+			case "/baby-alerts":
+				if p.body != "Temperature 38.5°C" || p.header.Get("Title") != "Test Baby" ||
+					p.header.Get("Priority") != "5" || p.header.Get("Authorization") != "Bearer tk_secret" {
+					t.Errorf("ntfy push = %+v", p)
+				}
+			case "/notify":
+				var m map[string]string
+				json.Unmarshal([]byte(p.body), &m)
+				if m["urls"] != "tgram://bot/chat" || m["title"] != "Test Baby" || m["type"] != "warning" {
+					t.Errorf("apprise push = %s", p.body)
+				}
+			default:
+				t.Errorf("pushed to %s", p.path)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("push not delivered")
+		}
+	}
+
+	for _, bad := range [][]PushTarget{
+		{{Kind: "pager", URL: target.URL}},
+		{{Kind: "ntfy", URL: "ntfy.sh/topic"}},
+	} {
+		if (FamilySettings{Push: bad}).validate()["push"] == "" {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+}
+
+func TestScheduledPushes(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	posts := make(chan map[string]any, 4)
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]any
+		json.NewDecoder(r.Body).Decode(&m)
+		posts <- m
+	}))
+	defer slack.Close()
+	next := func() string {
+		select {
+		case m := <-posts:
+			return m["text"].(string)
+		case <-time.After(2 * time.Second):
+			t.Fatal("nothing posted")
+			return ""
+		}
+	}
+
+	family, _ := db.CreateFamily("Smith", "")
+	db.SaveFamilySettings(family.ID, FamilySettings{
+		FeedReminderMin: 180,
+		Push:            []PushTarget{{Kind: "slack", URL: slack.URL, Events: []string{"feed_reminder", "daily_summary"}}},
+	})
+	now := time.Date(2025, 6, 10, 9, 0, 0, 0, time.UTC)
+	for _, ts := range []time.Time{now.Add(-27 * time.Hour), now.Add(-3 * time.Hour)} {
+		db.UpsertEntry(&Entry{ID: generateToken(8), FamilyID: family.ID, Ts: ts.UnixMilli(), Type: "feed", Value: "bf"})
+	}
+
+	// Both instances see the reminder and yesterday's summary due; only
+	// one sends each
+	a, b := &Server{db: db, hub: NewHub(db)}, &Server{db: db, hub: NewHub(db)}
+	a.sendReminders(now)
+	b.sendReminders(now)
+	got := []string{next(), next()}
+	slices.Sort(got)
+	if got[0] != "Smith: Feed due: last fed 3h 0m ago" || !strings.HasPrefix(got[1], "Smith: Monday 9 June 2025\nFeed 1") {
+		t.Errorf("posted %q", got)
+	}
+	a.sendReminders(now.Add(time.Minute))
+	select {
+	case m := <-posts:
+		t.Errorf("posted again: %v", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPushDiscord(t *testing.T) {
+	posts := make(chan map[string]any, 1)
+	discord := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]any
+		json.NewDecoder(r.Body).Decode(&m)
+		posts <- m
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer discord.Close()
+
+	err := pushDiscord(PushTarget{Kind: "discord", URL: discord.URL}, pushMessage{
+		Kind: "daily_summary", Title: "Smith", Body: "Monday 9 June 2025\nFeed 6", Priority: 2,
+		Fields: []pushField{{"Sleep", "14h 0m"}, {"Feed", "6"}}, Ts: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	embed := (<-posts)["embeds"].([]any)[0].(map[string]any)
+	fields := embed["fields"].([]any)
+	if embed["title"] != "📋 Smith" || embed["description"] != "Monday 9 June 2025" || len(fields) != 2 ||
+		fields[0].(map[string]any)["value"] != "14h 0m" {
+		t.Errorf("embed = %v", embed)
+	}
+}
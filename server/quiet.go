@@ -0,0 +1,84 @@
+package babytrack
+
+import (
+	"fmt"
+	"time"
+)
+
+// Quiet hours keep the server from waking anyone: between a family's
+// quiet_start and quiet_end, in its timezone, its webhook isn't posted
+// alerts, its devices aren't sent entry notifications, and inactivity
+// warnings wait for the first lifecycle run after. Alerts still reach the
+// app and the admin activity feed, where they're seen rather than heard.
+// quiet_overrides says per kind whether it goes out anyway; fever alerts
+// do unless turned off.
+
+// quietKinds are what quiet hours hold back, and whether each goes out
+// anyway by default.
+var quietKinds = map[string]bool{
+	"fever":         true,
+	"inactive":      false,
+	"entry":         false, // notifications; see notifications.go
+	"feed_reminder": false, // see reminders.go
+	"daily_summary": false,
+	"sync_failure":  false, // see devices.go
+	"feed_overdue":  false,
+}
+
+// parseClock reads "HH:MM" as minutes after midnight.
+func parseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// InQuietHours reports whether now is within the family's quiet hours,
+// which may run past midnight.
+func (fs FamilySettings) InQuietHours(now time.Time) bool {
+	start, ok1 := parseClock(fs.QuietStart)
+	end, ok2 := parseClock(fs.QuietEnd)
+	if !ok1 || !ok2 || start == end {
+		return false
+	}
+	local := now.In(fs.Location())
+	m := local.Hour()*60 + local.Minute()
+	if start < end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// quiet reports whether something of the given kind should be held back
+// at now.
+func (fs FamilySettings) quiet(kind string, now time.Time) bool {
+	if !fs.InQuietHours(now) {
+		return false
+	}
+	override, ok := fs.QuietOverrides[kind]
+	if !ok {
+		override = quietKinds[kind]
+	}
+	return !override
+}
+
+// validateQuiet adds quiet hours problems to fields.
+func (fs FamilySettings) validateQuiet(fields map[string]string) {
+	for kind := range fs.QuietOverrides {
+		if _, ok := quietKinds[kind]; !ok {
+			fields["quiet_overrides"] = fmt.Sprintf("unknown kind %q (use fever, inactive, entry, feed_reminder, daily_summary, sync_failure or feed_overdue)", kind)
+		}
+	}
+	if fs.QuietStart == "" && fs.QuietEnd == "" {
+		return
+	}
+	for name, v := range map[string]string{"quiet_start": fs.QuietStart, "quiet_end": fs.QuietEnd} {
+		if _, ok := parseClock(v); !ok {
+			fields[name] = "must be a time like 22:00, with quiet_start and quiet_end both set"
+		}
+	}
+	if fs.QuietStart == fs.QuietEnd {
+		fields["quiet_end"] = "must differ from quiet_start"
+	}
+}
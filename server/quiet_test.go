@@ -0,0 +1,51 @@
+package babytrack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHours(t *testing.T) {
+	fs := FamilySettings{QuietStart: "22:00", QuietEnd: "06:30", Timezone: "Australia/Sydney"}
+	sydney, _ := time.LoadLocation("Australia/Sydney")
+	at := func(hour, min int) time.Time {
+		return time.Date(2026, 3, 10, hour, min, 0, 0, sydney).UTC()
+	}
+	for _, tt := range []struct {
+		hour, min int
+		want      bool
+	}{
+		{21, 59, false}, {22, 0, true}, {2, 0, true}, {6, 29, true}, {6, 30, false}, {12, 0, false},
+	} {
+		if got := fs.InQuietHours(at(tt.hour, tt.min)); got != tt.want {
+			t.Errorf("%02d:%02d quiet = %v", tt.hour, tt.min, got)
+		}
+	}
+
+	// Fever gets through unless turned off; the rest waits
+	night := at(2, 0)
+	if fs.quiet("fever", night) || !fs.quiet("inactive", night) || !fs.quiet("entry", night) {
+		t.Error("default overrides not applied")
+	}
+	fs.QuietOverrides = map[string]bool{"fever": false, "entry": true}
+	if !fs.quiet("fever", night) || fs.quiet("entry", night) {
+		t.Error("overrides not applied")
+	}
+	if fs.quiet("inactive", at(12, 0)) {
+		t.Error("quiet at noon")
+	}
+
+	for _, bad := range []FamilySettings{
+		{QuietStart: "22:00"},
+		{QuietStart: "25:00", QuietEnd: "06:00"},
+		{QuietStart: "22:00", QuietEnd: "22:00"},
+		{QuietOverrides: map[string]bool{"digest": true}},
+	} {
+		if bad.validate() == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+	if fields := (FamilySettings{QuietStart: "22:00", QuietEnd: "06:00"}).validate(); fields != nil {
+		t.Errorf("valid quiet hours rejected: %v", fields)
+	}
+}
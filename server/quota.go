@@ -0,0 +1,154 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Quotas cap what one family can store, so a runaway script or client on a
+// shared instance can't fill the disk. Server-wide defaults come from the
+// environment; a family's settings may override each one. 0 means unlimited.
+type Quotas struct {
+	EntriesPerDay int   `json:"entries_per_day"` // entries written in any 24 hours
+	DataBytes     int64 `json:"data_bytes"`      // total size of entry data payloads
+	Links         int   `json:"links"`           // access links
+}
+
+// QuotaUsage is a family's current usage against its Quotas.
+type QuotaUsage struct {
+	EntriesPerDay int   `json:"entries_per_day"`
+	DataBytes     int64 `json:"data_bytes"`
+	Links         int   `json:"links"`
+}
+
+// QuotaError reports which quota a write would exceed.
+type QuotaError struct {
+	Quota string `json:"quota"` // as the Quotas JSON field name
+	Limit int64  `json:"limit"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of %d reached", e.Quota, e.Limit)
+}
+
+// quotasFor returns the family's effective quotas: the server defaults with
+// any per-family overrides applied. An override of -1 lifts the limit.
+func (s *Server) quotasFor(fs FamilySettings) Quotas {
+	s.tuning.RLock()
+	q := s.quotas
+	s.tuning.RUnlock()
+	override := func(limit *int, v int) {
+		if v != 0 {
+			*limit = max(v, 0)
+		}
+	}
+	override(&q.EntriesPerDay, fs.MaxEntriesPerDay)
+	override(&q.Links, fs.MaxLinks)
+	if fs.MaxDataMB != 0 {
+		q.DataBytes = int64(max(fs.MaxDataMB, 0)) << 20
+	}
+	return q
+}
+
+// QuotaUsage measures a family's usage as of now.
+func (db *DB) QuotaUsage(familyID string, now time.Time) (QuotaUsage, error) {
+	var u QuotaUsage
+	err := db.QueryRow(
+		`SELECT
+		   (SELECT COUNT(*) FROM entries WHERE family_id = ? AND updated_at > ?),
+		   (SELECT COALESCE(SUM(LENGTH(data)), 0) FROM entries WHERE family_id = ? AND data IS NOT NULL),
+		   (SELECT COUNT(*) FROM access_links WHERE family_id = ?)`,
+		familyID, now.Add(-24*time.Hour).UnixMilli(), familyID, familyID,
+	).Scan(&u.EntriesPerDay, &u.DataBytes, &u.Links)
+	return u, err
+}
+
+// checkEntryQuota returns a *QuotaError if saving e would take the family
+// over a quota. An update to an existing entry counts only any growth in
+// its data, so caregivers can always fix mistakes but can't grow entries
+// past data_bytes.
+func (s *Server) checkEntryQuota(familyID string, e *Entry) error {
+	settings, _ := s.db.GetFamilySettings(familyID)
+	q := s.quotasFor(settings)
+	if q.EntriesPerDay == 0 && q.DataBytes == 0 {
+		return nil
+	}
+	old, err := s.db.GetEntry(familyID, e.ID)
+	if err == sql.ErrNoRows {
+		old, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	u, err := s.db.QuotaUsage(familyID, time.Now())
+	if err != nil {
+		return err
+	}
+	if qe := (&batchQuota{quotas: q, usage: u}).add(old, e); qe != nil {
+		return qe
+	}
+	return nil
+}
+
+// dataGrowth is how many more bytes of data e stores than old, the entry
+// it replaces if any.
+func dataGrowth(old, e *Entry) int64 {
+	n := int64(len(e.Data))
+	if old != nil {
+		n -= int64(len(old.Data))
+	}
+	return n
+}
+
+// checkLinkQuota returns a *QuotaError if the family can't have another
+// access link.
+func (s *Server) checkLinkQuota(familyID string) error {
+	settings, _ := s.db.GetFamilySettings(familyID)
+	q := s.quotasFor(settings)
+	if q.Links == 0 {
+		return nil
+	}
+	u, err := s.db.QuotaUsage(familyID, time.Now())
+	if err != nil {
+		return err
+	}
+	if u.Links >= q.Links {
+		return &QuotaError{Quota: "links", Limit: int64(q.Links)}
+	}
+	return nil
+}
+
+// quotaRejection is the entry_rejected message for an entry over quota.
+func quotaRejection(id string, qe *QuotaError) []byte {
+	msg, _ := json.Marshal(map[string]any{
+		"type":   "entry_rejected",
+		"id":     id,
+		"reason": "quota_exceeded",
+		"quota":  qe,
+	})
+	return msg
+}
+
+// getFamilyQuota serves GET /admin/families/{id}/quota: the family's
+// effective limits and current usage.
+func (s *Server) getFamilyQuota(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	settings, err := s.db.GetFamilySettings(familyID)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to get family settings", err)
+		return
+	}
+	usage, err := s.db.QuotaUsage(familyID, time.Now())
+	if err != nil {
+		serverError(w, "failed to measure usage", err)
+		return
+	}
+	jsonOK(w, map[string]any{"limits": s.quotasFor(settings), "usage": usage})
+}
@@ -0,0 +1,128 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestQuotasFor(t *testing.T) {
+	s := &Server{quotas: Quotas{EntriesPerDay: 100, DataBytes: 1 << 20, Links: 5}}
+	q := s.quotasFor(FamilySettings{MaxEntriesPerDay: 10, MaxDataMB: -1})
+	if q != (Quotas{EntriesPerDay: 10, DataBytes: 0, Links: 5}) {
+		t.Errorf("quotas = %+v", q)
+	}
+	if fields := (FamilySettings{MaxLinks: -2}).validate(); fields["max_links"] == "" {
+		t.Errorf("expected max_links error, got %v", fields)
+	}
+}
+
+func TestEntryQuota(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Script", nil)
+
+	s := &Server{db: db, hub: NewHub(db), quotas: Quotas{EntriesPerDay: 2}}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+
+	add := func(id, value string) {
+		conn.WriteJSON(map[string]any{"type": "entry", "action": "add",
+			"entry": map[string]any{"id": id, "ts": time.Now().UnixMilli(), "type": "feed", "value": value}})
+	}
+	add("e1", "bf")
+	skipUntilType(t, conn, "entry_ack")
+	add("e2", "bf")
+	skipUntilType(t, conn, "entry_ack")
+	add("e3", "bf")
+	msg := skipUntilType(t, conn, "entry_rejected")
+	if msg["id"] != "e3" || msg["reason"] != "quota_exceeded" {
+		t.Errorf("rejection = %v", msg)
+	}
+	if db.EntryExists(family.ID, "e3") {
+		t.Error("entry over quota was saved")
+	}
+
+	// Fixing an existing entry is always allowed
+	add("e1", "bottle")
+	skipUntilType(t, conn, "entry_ack")
+}
+
+func TestEntryDataQuotaOnUpdate(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	s := &Server{db: db, hub: NewHub(db), quotas: Quotas{DataBytes: 40}}
+
+	small := &Entry{ID: "e1", FamilyID: family.ID, Ts: 1, Type: "feed", Value: "bf", Data: json.RawMessage(`{"note":"a"}`)}
+	if err := s.checkEntryQuota(family.ID, small); err != nil {
+		t.Fatalf("small entry: %v", err)
+	}
+	db.UpsertEntry(small)
+
+	// Re-sending it with bigger data counts the growth
+	big := *small
+	big.Data = json.RawMessage(`{"note":"` + strings.Repeat("x", 40) + `"}`)
+	if qe, ok := s.checkEntryQuota(family.ID, &big).(*QuotaError); !ok || qe.Quota != "data_bytes" {
+		t.Errorf("growing update: %v", qe)
+	}
+	edited := *small
+	edited.Data = json.RawMessage(`{"note":"b"}`)
+	if err := s.checkEntryQuota(family.ID, &edited); err != nil {
+		t.Errorf("same-size update: %v", err)
+	}
+}
+
+func TestLinkQuota(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	s.quotas.Links = 1
+	family, _ := s.db.CreateFamily("Test Baby", "")
+
+	create := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/families/"+family.ID+"/links", strings.NewReader(`{"label":"x"}`))
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.createAccessLink(w, req)
+		return w
+	}
+	if w := create(); w.Code != http.StatusCreated {
+		t.Fatalf("first link: %d", w.Code)
+	}
+	w := create()
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), errCodeQuota) {
+		t.Errorf("second link: %d %s", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/quota", nil)
+	req.SetPathValue("id", family.ID)
+	w = httptest.NewRecorder()
+	s.getFamilyQuota(w, req)
+	var resp struct {
+		Limits Quotas
+		Usage  QuotaUsage
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Limits.Links != 1 || resp.Usage.Links != 1 {
+		t.Errorf("quota = %+v", resp)
+	}
+}
@@ -0,0 +1,70 @@
+package babytrack
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a fixed-window counter keyed by an arbitrary string
+// (client IP, family ID). Windows reset lazily on the next Allow call.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	counts map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// maxRateKeys bounds memory use; expired windows are pruned past this size.
+const maxRateKeys = 10000
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		counts: make(map[string]*rateWindow),
+	}
+}
+
+// SetLimit changes the limit, from the current window on, and reports
+// whether it differs from the old one.
+func (rl *rateLimiter) SetLimit(limit int) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	changed := rl.limit != limit
+	rl.limit = limit
+	return changed
+}
+
+// Allow records one event for key and reports whether it is within the limit.
+func (rl *rateLimiter) Allow(key string) bool {
+	return rl.allowAt(key, time.Now())
+}
+
+func (rl *rateLimiter) allowAt(key string, now time.Time) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	w, ok := rl.counts[key]
+	if !ok || now.Sub(w.start) >= rl.window {
+		if !ok && len(rl.counts) >= maxRateKeys {
+			rl.pruneLocked(now)
+		}
+		w = &rateWindow{start: now}
+		rl.counts[key] = w
+	}
+	w.count++
+	return w.count <= rl.limit
+}
+
+func (rl *rateLimiter) pruneLocked(now time.Time) {
+	for k, w := range rl.counts {
+		if now.Sub(w.start) >= rl.window {
+			delete(rl.counts, k)
+		}
+	}
+}
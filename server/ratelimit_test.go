@@ -0,0 +1,40 @@
+package babytrack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(2, time.Minute)
+	now := time.Now()
+
+	if !rl.allowAt("a", now) || !rl.allowAt("a", now) {
+		t.Fatal("expected first two events to be allowed")
+	}
+	if rl.allowAt("a", now) {
+		t.Error("expected third event in window to be denied")
+	}
+	if !rl.allowAt("b", now) {
+		t.Error("expected independent key to be allowed")
+	}
+
+	// New window resets the count
+	if !rl.allowAt("a", now.Add(time.Minute)) {
+		t.Error("expected event in next window to be allowed")
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	rl := newRateLimiter(1, time.Minute)
+	now := time.Now()
+	for i := 0; i < maxRateKeys; i++ {
+		rl.allowAt(string(rune(i)), now)
+	}
+
+	rl.allowAt("fresh", now.Add(2*time.Minute))
+
+	if len(rl.counts) != 1 {
+		t.Errorf("expected expired windows to be pruned, have %d keys", len(rl.counts))
+	}
+}
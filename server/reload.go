@@ -0,0 +1,136 @@
+package babytrack
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Some settings can change without a restart, which would drop every
+// device's WebSocket: the log level, client log rate limits, connection
+// limits, health check limits, quotas, entry bounds, the lifecycle policy,
+// LIFECYCLE_WEBHOOK_URL and DIGEST_WEBHOOK_URL. A process's environment can't be changed from
+// outside, so babytrackd reads these from ENV_FILE, if set, as well as the
+// environment, and rereads the file on SIGHUP or when an admin calls POST
+// /admin/reload. Lowered connection limits apply to new connections only.
+// Everything else, such as the database, the bus or link rotation, still
+// needs a restart. Families' own webhooks are in their settings and never
+// need one.
+
+// Reload applies opts' runtime-tunable settings and returns the names of
+// those that changed. Other settings in opts are ignored.
+func (s *Server) Reload(opts Options) []string {
+	changed := s.tune(opts)
+	slog.Info("settings reloaded", "changed", strings.Join(changed, ","))
+	return changed
+}
+
+// tune applies the runtime-tunable settings, reporting which changed.
+func (s *Server) tune(opts Options) []string {
+	changed := []string{}
+	note := func(name string, differs bool) {
+		if differs {
+			changed = append(changed, name)
+		}
+	}
+
+	level := parseLogLevel(opts.LogLevel)
+	note("log_level", logLevel.Level() != level)
+	logLevel.Set(level)
+	note("client_log_ip_limit", clientLogIPLimiter.SetLimit(opts.ClientLogIPLimit))
+	note("client_log_family_limit", clientLogFamilyLimiter.SetLimit(opts.ClientLogFamilyLimit))
+	note("conn_limits", s.hub.setConnLimits(opts.MaxConnsPerFamily, opts.MaxConnsPerLink))
+
+	s.tuning.Lock()
+	defer s.tuning.Unlock()
+	health := healthLimits{maxWALBytes: opts.MaxWALBytes, minFreeBytes: opts.MinFreeBytes}
+	note("health_limits", s.health != health)
+	note("quotas", s.quotas != opts.Quotas)
+	note("entry_bounds", s.bounds != opts.Bounds)
+	note("lifecycle_policy", s.lifecycle.policy != opts.Lifecycle)
+	note("lifecycle_webhook", s.lifecycle.webhook != opts.LifecycleWebhook)
+	note("digest_webhook", s.digest != opts.DigestWebhook)
+	s.health = health
+	s.quotas = opts.Quotas
+	s.bounds = opts.Bounds
+	s.lifecycle = lifecycle{policy: opts.Lifecycle, webhook: opts.LifecycleWebhook}
+	s.digest = opts.DigestWebhook
+	return changed
+}
+
+func (s *Server) entryBounds() EntryBounds {
+	s.tuning.RLock()
+	defer s.tuning.RUnlock()
+	return s.bounds
+}
+
+// setConnLimits changes the connection limits, reporting whether they
+// changed. Connections over a lowered limit stay open.
+func (h *Hub) setConnLimits(perFamily, perLink int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changed := h.maxPerFamily != perFamily || h.maxPerToken != perLink
+	h.maxPerFamily, h.maxPerToken = perFamily, perLink
+	return changed
+}
+
+// loadEnvFile reads the variables in a file of KEY=value lines, where blank
+// lines and lines starting with # are skipped and values may be quoted.
+func loadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vars := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(strings.TrimPrefix(key, "export "))
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	return vars, sc.Err()
+}
+
+// optionsFromEnvFile rereads ENV_FILE, if set, and returns OptionsFromEnv.
+// A file that can't be read is logged and the settings last read from it
+// kept. Flags still take precedence; see flags.go.
+func optionsFromEnvFile() Options {
+	if err := loadSettings(); err != nil {
+		slog.Error("failed to read ENV_FILE", "error", err)
+	}
+	return OptionsFromEnv()
+}
+
+// reloadFromOptions rereads options with ReloadOptions and applies them.
+// Reports false if there's no ReloadOptions.
+func (s *Server) reloadFromOptions() ([]string, bool) {
+	if s.opts.ReloadOptions == nil {
+		return nil, false
+	}
+	return s.Reload(s.opts.ReloadOptions()), true
+}
+
+// handleReload handles POST /admin/reload.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	changed, ok := s.reloadFromOptions()
+	if !ok {
+		jsonError(w, http.StatusNotImplemented, errCodeUnavailable, "this server has no settings to reload from")
+		return
+	}
+	jsonOK(w, map[string]any{"changed": changed})
+}
@@ -0,0 +1,121 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	origLevel := logLevel.Level()
+	t.Cleanup(func() {
+		logLevel.Set(origLevel)
+		clientLogIPLimiter.SetLimit(clientLogIPLimit)
+		clientLogFamilyLimiter.SetLimit(clientLogFamilyLimit)
+	})
+
+	opts := DefaultOptions()
+	s.tune(opts)
+	if changed := s.Reload(opts); len(changed) != 0 {
+		t.Errorf("unchanged options: changed = %v", changed)
+	}
+
+	env := filepath.Join(t.TempDir(), "babytrack.env")
+	os.WriteFile(env, []byte(`# tunables
+LOG_LEVEL=debug
+export CLIENT_LOG_IP_LIMIT="5"
+MAX_CONNS_PER_LINK=1
+QUOTA_LINKS=2
+LIFECYCLE_WEBHOOK_URL='https://example.com/hook'
+DIGEST_WEBHOOK_URL=https://example.com/digest
+`), 0o600)
+	for _, name := range []string{"LOG_LEVEL", "CLIENT_LOG_IP_LIMIT", "MAX_CONNS_PER_LINK", "QUOTA_LINKS", "LIFECYCLE_WEBHOOK_URL", "DIGEST_WEBHOOK_URL"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("ENV_FILE", env)
+	t.Cleanup(func() { fileSettings.vars = nil })
+	s.opts.ReloadOptions = optionsFromEnvFile
+
+	// A client connected before the reload stays connected
+	c := &Client{hub: s.hub, send: make(chan []byte, 4), familyID: "f", linkID: "l"}
+	if err := s.hub.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleReload(w, httptest.NewRequest("POST", "/admin/reload", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("reload = %d: %s", w.Code, w.Body)
+	}
+	var resp struct{ Changed []string }
+	json.NewDecoder(w.Body).Decode(&resp)
+	slices.Sort(resp.Changed)
+	want := []string{"client_log_ip_limit", "conn_limits", "digest_webhook", "lifecycle_webhook", "log_level", "quotas"}
+	if !slices.Equal(resp.Changed, want) {
+		t.Errorf("changed = %v, want %v", resp.Changed, want)
+	}
+
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("log level = %v", logLevel.Level())
+	}
+	if s.digestWebhook() != "https://example.com/digest" {
+		t.Errorf("digest webhook = %q", s.digestWebhook())
+	}
+	if s.quotasFor(FamilySettings{}).Links != 2 || s.lifecycleConfig().webhook != "https://example.com/hook" {
+		t.Errorf("quotas = %+v, lifecycle = %+v", s.quotas, s.lifecycle)
+	}
+	if len(s.hub.Devices("f")) != 1 {
+		t.Error("reload dropped a connection")
+	}
+	if err := s.hub.Register(&Client{hub: s.hub, send: make(chan []byte, 4), familyID: "f", linkID: "l"}); err == nil {
+		t.Error("new connection allowed over the reloaded link limit")
+	}
+	for i := range 5 {
+		if !clientLogIPLimiter.Allow("reload-test") {
+			t.Fatalf("request %d limited", i+1)
+		}
+	}
+	if clientLogIPLimiter.Allow("reload-test") {
+		t.Error("reloaded client log limit not applied")
+	}
+
+	// A line taken out of the file goes back to the environment's value
+	t.Setenv("QUOTA_LINKS", "7")
+	os.WriteFile(env, []byte("LOG_LEVEL=debug\n"), 0o600)
+	if opts := optionsFromEnvFile(); opts.Quotas.Links != 7 || opts.LifecycleWebhook != "" {
+		t.Errorf("after removing lines: links = %d, lifecycle webhook = %q", opts.Quotas.Links, opts.LifecycleWebhook)
+	}
+	if os.Getenv("LOG_LEVEL") != "" {
+		t.Error("the process environment was changed")
+	}
+}
+
+func TestReloadNotConfigured(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	s.handleReload(w, httptest.NewRequest("POST", "/admin/reload", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("reload without ReloadOptions = %d", w.Code)
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	t.Setenv("QUOTA_LINKS", "")
+	path := filepath.Join(t.TempDir(), "bad.env")
+	os.WriteFile(path, []byte("QUOTA_LINKS=1\nnot a setting\n"), 0o600)
+	if _, err := loadEnvFile(path); err == nil || err.Error() != path+":2: expected KEY=value" {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := loadEnvFile(filepath.Join(t.TempDir(), "missing.env")); err == nil {
+		t.Error("missing file: no error")
+	}
+}
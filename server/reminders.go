@@ -0,0 +1,373 @@
+package babytrack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Feed reminders nudge the family's devices when a feed is due. A family
+// turns them on with feed_reminder_min: a fixed interval in minutes, or -1
+// to learn it from the median gap between its recent feeds, falling back to
+// defaultFeedInterval until there are enough. The reminder goes out as a
+// notification (see notifications.go) once per feed, when it falls due,
+// unless that's in quiet hours and feed_reminder isn't overridden, and to
+// push targets that take feed_reminder (see push.go). Each instance
+// reminds its own connections; pushes are claimed in the database so only
+// one instance sends each. Families with multiple children get one
+// reminder off the latest feed.
+//
+// With feed_escalate_min as well, a feed still not logged that long after
+// the reminder fell due raises a feed_overdue alert, once per feed, for
+// those who should hear about it by SMS (see sms.go).
+//
+// Push targets can also take a daily_summary of the day before, sent at
+// daily_summary_hour in the family's timezone, or once quiet hours end.
+
+const (
+	feedReminderAdaptive = -1
+	maxFeedReminderMin   = 12 * 60
+
+	feedHistory         = 3 * 24 * time.Hour
+	minFeedSamples      = 4
+	minFeedGap          = 20 * time.Minute // closer feeds are one feed, such as the second side
+	maxFeedGap          = 8 * time.Hour    // longer gaps are missed entries
+	defaultFeedInterval = 3 * time.Hour
+	// reminderLate stops reminders long past due, as after a restart, from
+	// going out out of the blue.
+	reminderLate = 30 * time.Minute
+
+	defaultDailySummaryHour = 7
+)
+
+// notFeeds are feed-group values that aren't feeds, from the default
+// buttons.
+var notFeeds = map[string]bool{"play": true, "spew": true}
+
+// FeedReminder is when the next feed is due.
+type FeedReminder struct {
+	Basis       string `json:"basis"` // fixed, recent or default
+	IntervalMin int    `json:"interval_min"`
+	Samples     int    `json:"samples"` // feed gaps the recent interval came from
+	LastFeed    int64  `json:"last_feed"`
+	DueAt       int64  `json:"due_at"`
+}
+
+// feedGaps returns the gaps between consecutive feeds, which are oldest
+// first.
+func feedGaps(entries []Entry) []time.Duration {
+	var gaps []time.Duration
+	var last int64
+	for _, e := range entries {
+		if last != 0 {
+			d := time.Duration(e.Ts-last) * time.Millisecond
+			if d < minFeedGap {
+				continue // part of the previous feed
+			}
+			if d <= maxFeedGap {
+				gaps = append(gaps, d)
+			}
+		}
+		last = e.Ts
+	}
+	return gaps
+}
+
+// planFeedReminder works out the family's next feed reminder as of now, or
+// nil if reminders are off or nothing has been fed yet.
+func planFeedReminder(db EntryStore, familyID string, settings FamilySettings, now time.Time) (*FeedReminder, error) {
+	if settings.FeedReminderMin == 0 {
+		return nil, nil
+	}
+	entries, err := db.GetEntriesOfType(familyID, "feed", now.Add(-feedHistory).UnixMilli(), now.UnixMilli()+1)
+	if err != nil {
+		return nil, err
+	}
+	entries = slices.DeleteFunc(entries, func(e Entry) bool { return notFeeds[e.Value] })
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	r := &FeedReminder{LastFeed: entries[len(entries)-1].Ts}
+	interval := time.Duration(settings.FeedReminderMin) * time.Minute
+	if settings.FeedReminderMin == feedReminderAdaptive {
+		gaps := feedGaps(entries)
+		r.Samples = len(gaps)
+		if len(gaps) >= minFeedSamples {
+			slices.Sort(gaps)
+			interval = gaps[len(gaps)/2]
+			r.Basis = "recent"
+		} else {
+			interval = defaultFeedInterval
+			r.Basis = "default"
+		}
+	} else {
+		r.Basis = "fixed"
+	}
+	r.IntervalMin = int(interval / time.Minute)
+	r.DueAt = time.UnixMilli(r.LastFeed).Add(interval).UnixMilli()
+	return r, nil
+}
+
+// dueAt reports whether the reminder is to go out at now: due, and not
+// long past.
+func (r *FeedReminder) dueAt(now time.Time) bool {
+	at := now.UnixMilli()
+	return at >= r.DueAt && at <= r.DueAt+reminderLate.Milliseconds()
+}
+
+// feedReminders remembers which feed each family was last reminded after.
+type feedReminders struct {
+	mu   sync.Mutex
+	sent map[string]int64 // family ID → last feed ts
+}
+
+// due reports whether the reminder r is to be sent to this instance's
+// connections now, marking it sent.
+func (fr *feedReminders) due(familyID string, r *FeedReminder, now time.Time) bool {
+	if !r.dueAt(now) {
+		return false
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.sent == nil {
+		fr.sent = map[string]int64{}
+	}
+	if fr.sent[familyID] == r.LastFeed {
+		return false
+	}
+	fr.sent[familyID] = r.LastFeed
+	return true
+}
+
+func (db *DB) claimFeedPush(familyID string, feedTs int64) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE families SET feed_pushed_ts = ? WHERE id = ? AND feed_pushed_ts IS NOT ?",
+		feedTs, familyID, feedTs)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (db *DB) claimFeedEscalation(familyID string, feedTs int64) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE families SET feed_escalated_ts = ? WHERE id = ? AND feed_escalated_ts IS NOT ?",
+		feedTs, familyID, feedTs)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (db *DB) claimSummaryPush(familyID, date string) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE families SET summary_pushed_date = ? WHERE id = ? AND COALESCE(summary_pushed_date, '') < ?",
+		date, familyID, date)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// RunReminders sends feed reminders, escalations and daily summaries as
+// they fall due, and checks primary devices are in sync, every interval
+// until ctx is done.
+func (s *Server) RunReminders(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		s.sendReminders(time.Now())
+	}
+}
+
+func (s *Server) sendReminders(now time.Time) {
+	families, err := s.db.ListFamilies(false)
+	if err != nil {
+		slog.Error("failed to list families for reminders", "error", err)
+		return
+	}
+	for _, f := range families {
+		settings, err := s.db.GetFamilySettings(f.ID)
+		if err != nil {
+			slog.Error("failed to load family settings", "error", err, "family_id", f.ID)
+			continue
+		}
+		s.remindFeed(f.ID, settings, now)
+		s.pushDailySummary(f.ID, settings, now)
+		s.checkPrimaryDevice(f.ID, settings, now)
+	}
+}
+
+func (s *Server) remindFeed(familyID string, settings FamilySettings, now time.Time) {
+	if settings.FeedReminderMin == 0 {
+		return
+	}
+	r, err := planFeedReminder(s.db, familyID, settings, now)
+	if err != nil {
+		slog.Error("failed to plan feed reminder", "error", err, "family_id", familyID)
+		return
+	}
+	if r == nil {
+		return
+	}
+	s.escalateFeed(familyID, settings, r, now)
+	if !r.dueAt(now) || settings.quiet("feed_reminder", now) {
+		return
+	}
+	n := feedReminderNotification(settings, r, now)
+	if s.reminders.due(familyID, r, now) {
+		s.hub.notify(familyID, "", notificationMessage(n), nil)
+	}
+	if settings.pushes("feed_reminder") {
+		if ok, err := s.db.claimFeedPush(familyID, r.LastFeed); err != nil {
+			slog.Error("failed to claim feed reminder push", "error", err, "family_id", familyID)
+		} else if ok {
+			s.push(familyID, settings, pushMessage{Kind: "feed_reminder", Body: n.Title, Priority: 4})
+		}
+	}
+}
+
+// escalateFeed raises a feed_overdue alert once the feed r is for is
+// feed_escalate_min past due, and not long past that.
+func (s *Server) escalateFeed(familyID string, settings FamilySettings, r *FeedReminder, now time.Time) {
+	if settings.FeedEscalateMin == 0 || settings.quiet("feed_overdue", now) {
+		return
+	}
+	escalation := *r
+	escalation.DueAt += (time.Duration(settings.FeedEscalateMin) * time.Minute).Milliseconds()
+	if !escalation.dueAt(now) {
+		return
+	}
+	ok, err := s.db.claimFeedEscalation(familyID, r.LastFeed)
+	if err != nil {
+		slog.Error("failed to claim feed escalation", "error", err, "family_id", familyID)
+	}
+	if !ok {
+		return
+	}
+	en := locales[defaultLocale] // alert messages are English, as fever's
+	since := int(now.Sub(time.UnixMilli(r.LastFeed)) / time.Minute)
+	s.sendAlert(Alert{
+		FamilyID: familyID,
+		Kind:     "feed_overdue",
+		Message:  fmt.Sprintf("No feed logged for %s (due every %s)", en.FormatDuration(since), en.FormatDuration(r.IntervalMin)),
+		Data:     map[string]any{"last_feed": r.LastFeed, "due_at": r.DueAt},
+		Ts:       now.UnixMilli(),
+	})
+}
+
+// pushDailySummary sends push targets that take daily_summary the
+// family's day before, once it's past the family's summary hour.
+func (s *Server) pushDailySummary(familyID string, settings FamilySettings, now time.Time) {
+	if !settings.pushes("daily_summary") || settings.quiet("daily_summary", now) {
+		return
+	}
+	local := now.In(settings.Location())
+	if local.Hour() < settings.SummaryHour() {
+		return
+	}
+	y, m, d := local.Date()
+	day := time.Date(y, m, d-1, 0, 0, 0, 0, local.Location())
+	ok, err := s.db.claimSummaryPush(familyID, day.Format("2006-01-02"))
+	if err != nil {
+		slog.Error("failed to claim daily summary push", "error", err, "family_id", familyID)
+	}
+	if !ok {
+		return
+	}
+	locale := locales[defaultLocale]
+	if l := lookupLocale(settings.Locale); l != nil {
+		locale = l
+	}
+	summary, err := s.dailySummary(familyID, "", day, locale)
+	if err != nil {
+		slog.Error("failed to build daily summary", "error", err, "family_id", familyID)
+		return
+	}
+	s.push(familyID, settings, pushMessage{
+		Kind:     "daily_summary",
+		Body:     summaryText(summary, locale),
+		Fields:   summaryFields(summary, locale),
+		Priority: 2,
+	})
+}
+
+// summaryFields is a day's summary as fields, for backends that lay them
+// out.
+func summaryFields(d *DailySummary, locale *Locale) []pushField {
+	fields := []pushField{{Name: locale.TypeLabel("sleep"), Value: d.TotalSleep}}
+	if f := d.Feeding; f != nil {
+		fields = append(fields, pushField{Name: locale.TypeLabel("feed") + " (ml)", Value: fmt.Sprintf("%.0f", f.TotalML)})
+	}
+	for _, typ := range slices.Sorted(maps.Keys(d.Totals)) {
+		fields = append(fields, pushField{Name: d.Labels[typ], Value: fmt.Sprint(d.Totals[typ])})
+	}
+	return fields
+}
+
+// summaryText is a day's summary as a few lines for a chat.
+func summaryText(d *DailySummary, locale *Locale) string {
+	types := slices.Sorted(maps.Keys(d.Totals))
+	counts := make([]string, len(types))
+	for i, typ := range types {
+		counts[i] = fmt.Sprintf("%s %d", d.Labels[typ], d.Totals[typ])
+	}
+	lines := []string{d.DateLabel}
+	if len(counts) == 0 {
+		lines = append(lines, locale.T("summary.nothing", "Nothing logged"))
+	} else {
+		lines = append(lines, strings.Join(counts, " · "))
+	}
+	lines = append(lines, fmt.Sprintf("%s: %s", locale.TypeLabel("sleep"), d.TotalSleep))
+	if f := d.Feeding; f != nil {
+		lines = append(lines, fmt.Sprintf("%s: %.0f ml", locale.TypeLabel("feed"), f.TotalML))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// feedReminderNotification says a feed is due, in the family's language.
+func feedReminderNotification(settings FamilySettings, r *FeedReminder, now time.Time) Notification {
+	locale := locales[defaultLocale]
+	if l := lookupLocale(settings.Locale); l != nil {
+		locale = l
+	}
+	since := int(now.Sub(time.UnixMilli(r.LastFeed)) / time.Minute)
+	return Notification{
+		Kind:      "reminder",
+		Title:     fmt.Sprintf(locale.T("notify.feed_due", "Feed due: last fed %s ago"), locale.FormatDuration(since)),
+		EntryType: "feed",
+		Ts:        now.UnixMilli(),
+	}
+}
+
+// handleFeedReminder serves GET /api/v1/reminders/feed: the next feed
+// reminder, or null if they're off or nothing has been fed.
+func (s *Server) handleFeedReminder(w http.ResponseWriter, r *http.Request) {
+	familyID := accessLinkFrom(r.Context()).FamilyID
+	settings, err := s.db.GetFamilySettings(familyID)
+	if err != nil {
+		serverError(w, "failed to load family settings", err)
+		return
+	}
+	reminder, err := planFeedReminder(s.db, familyID, settings, time.Now())
+	if err != nil {
+		serverError(w, "failed to plan feed reminder", err)
+		return
+	}
+	jsonOK(w, reminder)
+}
@@ -0,0 +1,73 @@
+package babytrack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanFeedReminder(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	add := func(at time.Time, value string) {
+		e := &Entry{ID: generateToken(8), FamilyID: family.ID, Ts: at.UnixMilli(), Type: "feed", Value: value}
+		if err := db.UpsertEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	adaptive := FamilySettings{FeedReminderMin: feedReminderAdaptive}
+
+	if r, _ := planFeedReminder(db, family.ID, FamilySettings{}, now); r != nil {
+		t.Errorf("off: %+v", r)
+	}
+	if r, _ := planFeedReminder(db, family.ID, adaptive, now); r != nil {
+		t.Errorf("no feeds: %+v", r)
+	}
+
+	// Too few feeds to learn from yet
+	add(now.Add(-5*time.Hour), "bf")
+	add(now.Add(-2*time.Hour), "bf")
+	r, _ := planFeedReminder(db, family.ID, adaptive, now)
+	if r.Basis != "default" || r.IntervalMin != 180 || r.DueAt != now.Add(time.Hour).UnixMilli() {
+		t.Errorf("default: %+v", r)
+	}
+	r, _ = planFeedReminder(db, family.ID, FamilySettings{FeedReminderMin: 150}, now)
+	if r.Basis != "fixed" || r.DueAt != now.Add(30*time.Minute).UnixMilli() {
+		t.Errorf("fixed: %+v", r)
+	}
+
+	// Gaps of 3h, 2h30, 2h, 2h30 and 3h give a median of 2h30. The second
+	// side, a spew and an overnight gap don't count.
+	add(now.Add(-5*time.Hour+10*time.Minute), "bf")
+	add(now.Add(-4*time.Hour), "spew")
+	add(now.Add(-7*time.Hour-30*time.Minute), "bf")
+	add(now.Add(-9*time.Hour-30*time.Minute), "bf")
+	add(now.Add(-12*time.Hour), "bf")
+	add(now.Add(-24*time.Hour), "bf")
+	add(now.Add(-27*time.Hour), "bf")
+	r, _ = planFeedReminder(db, family.ID, adaptive, now)
+	if r.Basis != "recent" || r.Samples != 5 || r.IntervalMin != 150 || r.LastFeed != now.Add(-2*time.Hour).UnixMilli() {
+		t.Errorf("recent: %+v", r)
+	}
+}
+
+func TestFeedRemindersDue(t *testing.T) {
+	var fr feedReminders
+	now := time.Now()
+	r := &FeedReminder{LastFeed: now.Add(-3 * time.Hour).UnixMilli(), DueAt: now.Add(-time.Minute).UnixMilli()}
+	if !fr.due("f", r, now) {
+		t.Error("not due")
+	}
+	if fr.due("f", r, now.Add(time.Minute)) {
+		t.Error("reminded twice for one feed")
+	}
+	late := &FeedReminder{LastFeed: 1, DueAt: now.Add(-time.Hour).UnixMilli()}
+	if fr.due("g", late, now) {
+		t.Error("reminded long after due")
+	}
+}
@@ -0,0 +1,173 @@
+package babytrack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// reporter forwards errors to a Sentry-compatible tracker (Sentry, GlitchTip)
+// when SENTRY_DSN is set. It is nil otherwise, and all methods are nil-safe.
+var reporter *errorReporter
+
+// ReportEvent is one error sent to the tracker.
+type ReportEvent struct {
+	Message string
+	Level   string            // error, warning, fatal
+	Tags    map[string]string // family, req_id, source
+	Extra   map[string]any
+}
+
+type errorReporter struct {
+	endpoint    string
+	dsn         string
+	auth        string
+	environment string
+	client      *http.Client
+	events      chan ReportEvent
+}
+
+func initReporter() {
+	dsn := setting("SENTRY_DSN")
+	if dsn == "" {
+		return
+	}
+	r, err := newErrorReporter(dsn, setting("SENTRY_ENVIRONMENT"))
+	if err != nil {
+		slog.Error("invalid SENTRY_DSN, error reporting disabled", "error", err)
+		return
+	}
+	reporter = r
+	slog.Info("error reporting enabled", "endpoint", r.endpoint)
+}
+
+// newErrorReporter parses a DSN of the form https://KEY@HOST/[PATH/]PROJECT
+// and starts a background sender.
+func newErrorReporter(dsn, environment string) (*errorReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	key := u.User.Username()
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	if key == "" || i < 0 || path[i+1:] == "" {
+		return nil, fmt.Errorf("dsn must look like https://KEY@HOST/PROJECT")
+	}
+
+	r := &errorReporter{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:i], path[i+1:]),
+		dsn:      dsn,
+		auth: fmt.Sprintf("Sentry sentry_version=7, sentry_key=%s, sentry_client=babytrackd/%s",
+			key, version),
+		environment: environment,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		events:      make(chan ReportEvent, 100),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Report queues an event for delivery. It never blocks; events are dropped
+// when the queue is full so a tracker outage can't stall request handling.
+func (r *errorReporter) Report(ev ReportEvent) {
+	if r == nil {
+		return
+	}
+	select {
+	case r.events <- ev:
+	default:
+		slog.Warn("error report queue full, dropping event", "message", ev.Message)
+	}
+}
+
+func (r *errorReporter) run() {
+	for ev := range r.events {
+		if err := r.send(ev); err != nil {
+			slog.Warn("failed to send error report", "error", err)
+		}
+	}
+}
+
+func (r *errorReporter) send(ev ReportEvent) error {
+	eventID := generateToken(16)
+	level := ev.Level
+	if level == "" {
+		level = "error"
+	}
+
+	event, err := json.Marshal(map[string]any{
+		"event_id":    eventID,
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"platform":    "go",
+		"level":       level,
+		"release":     "babytrackd@" + version,
+		"environment": r.environment,
+		"message":     map[string]string{"formatted": redactString(ev.Message)},
+		"tags":        ev.Tags,
+		"extra":       redactExtra(ev.Extra),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Envelope: header line, item header line, payload
+	var body bytes.Buffer
+	header, _ := json.Marshal(map[string]string{"event_id": eventID, "dsn": r.dsn})
+	body.Write(header)
+	body.WriteString("\n")
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(event))
+	body.Write(event)
+	body.WriteString("\n")
+
+	req, err := http.NewRequest("POST", r.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("tracker returned %s", resp.Status)
+	}
+	return nil
+}
+
+// redactExtra returns a copy of extra with the strings in it, including
+// those nested in frontend log data, passed through redactString.
+func redactExtra(extra map[string]any) map[string]any {
+	if extra == nil {
+		return nil
+	}
+	out := make(map[string]any, len(extra))
+	for k, v := range extra {
+		out[k] = redactValue(v)
+	}
+	return out
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case string:
+		return redactString(v)
+	case map[string]any:
+		return redactExtra(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = redactValue(e)
+		}
+		return out
+	}
+	return v
+}
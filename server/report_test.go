@@ -0,0 +1,170 @@
+package babytrack
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewErrorReporterDSN(t *testing.T) {
+	r, err := newErrorReporter("https://abc123@glitchtip.example/sub/42", "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.endpoint != "https://glitchtip.example/sub/api/42/envelope/" {
+		t.Errorf("unexpected endpoint %s", r.endpoint)
+	}
+	if !strings.Contains(r.auth, "sentry_key=abc123") {
+		t.Errorf("expected key in auth header, got %s", r.auth)
+	}
+
+	for _, dsn := range []string{"https://glitchtip.example/42", "https://key@host/", "::"} {
+		if _, err := newErrorReporter(dsn, ""); err == nil {
+			t.Errorf("expected error for dsn %q", dsn)
+		}
+	}
+}
+
+// captureReporter points the global reporter at a test tracker and returns
+// a channel of received event payloads.
+func captureReporter(t *testing.T) chan map[string]any {
+	t.Helper()
+	got := make(chan map[string]any, 10)
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("X-Sentry-Auth"), "Sentry ") {
+			t.Errorf("missing auth header")
+		}
+		sc := bufio.NewScanner(r.Body)
+		sc.Buffer(make([]byte, 1<<20), 1<<20)
+		sc.Scan() // envelope header
+		sc.Scan() // item header
+		sc.Scan()
+		var ev map[string]any
+		json.Unmarshal(sc.Bytes(), &ev)
+		got <- ev
+	}))
+
+	r, err := newErrorReporter("http://key@"+strings.TrimPrefix(tracker.URL, "http://")+"/1", "")
+	if err != nil {
+		t.Fatalf("failed to create reporter: %v", err)
+	}
+	orig := reporter
+	reporter = r
+	t.Cleanup(func() {
+		reporter = orig
+		tracker.Close()
+	})
+	return got
+}
+
+func waitEvent(t *testing.T, got chan map[string]any) map[string]any {
+	t.Helper()
+	select {
+	case ev := <-got:
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for error report")
+		return nil
+	}
+}
+
+func TestReportServerErrors(t *testing.T) {
+	initLogger()
+	got := captureReporter(t)
+
+	h := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		serverError(w, "failed to do thing", http.ErrNoCookie)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/fail", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Code)
+	}
+	ev := waitEvent(t, got)
+	msg := ev["message"].(map[string]any)["formatted"].(string)
+	if !strings.Contains(msg, "failed to do thing") {
+		t.Errorf("expected serverError message in report, got %q", msg)
+	}
+	if tags := ev["tags"].(map[string]any); tags["req_id"] == "" || tags["source"] != "server" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	// Panics are recovered into a 500 and reported as fatal
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 after panic, got %d", w.Code)
+	}
+	ev = waitEvent(t, got)
+	if ev["level"] != "fatal" {
+		t.Errorf("expected fatal level, got %v", ev["level"])
+	}
+	// Intentional 503s, such as a readiness check failing, aren't errors
+	unready := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jsonError(w, http.StatusServiceUnavailable, errCodeUnavailable, "server is draining")
+	}))
+	unready.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/readyz", nil))
+	select {
+	case ev := <-got:
+		t.Errorf("503 should not be reported: %v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReportFrontendErrors(t *testing.T) {
+	initLogger()
+	got := captureReporter(t)
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	body := `[{"level":"error","message":"report me","family":"fam1"},{"level":"warn","message":"not me"}]`
+	req := httptest.NewRequest("POST", "/log", strings.NewReader(body))
+	s.handleClientLog(httptest.NewRecorder(), req)
+
+	ev := waitEvent(t, got)
+	tags := ev["tags"].(map[string]any)
+	if tags["source"] != "frontend" || tags["family"] != "fam1" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	select {
+	case ev := <-got:
+		t.Errorf("warn-level log should not be reported: %v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestReportRedactsSecrets(t *testing.T) {
+	initLogger()
+	got := captureReporter(t)
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	h := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverError(w, "failed to render "+r.URL.Path, http.ErrNoCookie)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/cal/0123456789abcdef", nil))
+
+	body := `[{"level":"error","message":"failed /t/fedcba9876543210","url":"https://x.example/?token=s3cret","data":{"links":["/links/deadbeefcafe"]}}]`
+	s.handleClientLog(httptest.NewRecorder(), httptest.NewRequest("POST", "/log", strings.NewReader(body)))
+
+	for range 2 {
+		raw, _ := json.Marshal(waitEvent(t, got))
+		for _, secret := range []string{"0123456789abcdef", "fedcba9876543210", "s3cret", "deadbeefcafe"} {
+			if strings.Contains(string(raw), secret) {
+				t.Errorf("report leaked %q: %s", secret, raw)
+			}
+		}
+		if !strings.Contains(string(raw), redacted) {
+			t.Errorf("expected redacted values in report: %s", raw)
+		}
+	}
+}
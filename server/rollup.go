@@ -0,0 +1,194 @@
+package babytrack
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Trends over weeks or months would otherwise rescan every entry in the
+// window. daily_rollups keeps a count and total duration per local day,
+// child, type and value, in the family's timezone. Each write recomputes
+// the rollups of the days it touches, from that day's entries; bulk
+// writes (imports, demo reseeds, erasure) instead mark the family's
+// rollups stale, and they are rebuilt in full the next time they are
+// read, as they are after the family's timezone changes.
+
+// Rollup is one day's entries of one child, type and value.
+type Rollup struct {
+	Day        string `json:"day"` // YYYY-MM-DD
+	ChildID    string `json:"child_id,omitempty"`
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Count      int    `json:"count"`
+	DurationMs int64  `json:"duration_ms"` // of entries with an ended_ts
+}
+
+// dbtx is a *sql.DB or *sql.Tx.
+type dbtx interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// dayBounds returns the start and end (ms) of the local day containing ts.
+func dayBounds(ts int64, loc *time.Location) (day string, start, end int64) {
+	t := time.UnixMilli(ts).In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	return midnight.Format("2006-01-02"), midnight.UnixMilli(), midnight.AddDate(0, 0, 1).UnixMilli()
+}
+
+// touchRollups recomputes the family's rollups for the days containing
+// each ts, if they have been built.
+func touchRollups(q dbtx, familyID string, ts ...int64) error {
+	var tz sql.NullString
+	if err := q.QueryRow("SELECT rollup_tz FROM families WHERE id = ?", familyID).Scan(&tz); err != nil || !tz.Valid {
+		return err
+	}
+	loc, err := time.LoadLocation(tz.String)
+	if err != nil {
+		return invalidateRollups(q, familyID)
+	}
+	done := map[string]bool{}
+	for _, t := range ts {
+		day, start, end := dayBounds(t, loc)
+		if done[day] {
+			continue
+		}
+		done[day] = true
+		if _, err := q.Exec("DELETE FROM daily_rollups WHERE family_id = ? AND day = ?", familyID, day); err != nil {
+			return err
+		}
+		if _, err := q.Exec(
+			`INSERT INTO daily_rollups (family_id, day, child_id, type, value, count, duration_ms)
+			 SELECT family_id, ?, COALESCE(child_id, ''), type, value, COUNT(*), COALESCE(SUM(ended_ts - ts), 0)
+			 FROM entries
+			 WHERE family_id = ? AND deleted = 0 AND ts >= ? AND ts < ?
+			 GROUP BY COALESCE(child_id, ''), type, value`,
+			day, familyID, start, end,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invalidateRollups marks the family's rollups for a rebuild.
+func invalidateRollups(q dbtx, familyID string) error {
+	_, err := q.Exec("UPDATE families SET rollup_tz = NULL WHERE id = ?", familyID)
+	return err
+}
+
+// RebuildRollups replaces the family's rollups with ones computed from
+// all its entries in loc.
+func (db *DB) RebuildRollups(familyID string, loc *time.Location) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT ts, ended_ts, COALESCE(child_id, ''), type, value FROM entries
+		 WHERE family_id = ? AND deleted = 0`,
+		familyID,
+	)
+	if err != nil {
+		return err
+	}
+	sums := map[Rollup]*Rollup{} // keyed with Count and DurationMs zero
+	for rows.Next() {
+		var ts int64
+		var ended sql.NullInt64
+		var k Rollup
+		if err := rows.Scan(&ts, &ended, &k.ChildID, &k.Type, &k.Value); err != nil {
+			rows.Close()
+			return err
+		}
+		k.Day, _, _ = dayBounds(ts, loc)
+		r := sums[k]
+		if r == nil {
+			r = &Rollup{Day: k.Day, ChildID: k.ChildID, Type: k.Type, Value: k.Value}
+			sums[k] = r
+		}
+		r.Count++
+		if ended.Valid {
+			r.DurationMs += ended.Int64 - ts
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM daily_rollups WHERE family_id = ?", familyID); err != nil {
+		return err
+	}
+	for _, r := range sums {
+		if _, err := tx.Exec(
+			`INSERT INTO daily_rollups (family_id, day, child_id, type, value, count, duration_ms)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			familyID, r.Day, r.ChildID, r.Type, r.Value, r.Count, r.DurationMs,
+		); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE families SET rollup_tz = ? WHERE id = ?", loc.String(), familyID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureRollups rebuilds the family's rollups if they aren't current for
+// loc.
+func (db *DB) ensureRollups(familyID string, loc *time.Location) error {
+	var tz sql.NullString
+	if err := db.QueryRow("SELECT rollup_tz FROM families WHERE id = ?", familyID).Scan(&tz); err != nil {
+		return err
+	}
+	if tz.Valid && tz.String == loc.String() {
+		return nil
+	}
+	return db.RebuildRollups(familyID, loc)
+}
+
+// DailyRollups returns the family's rollups of type typ (all types if
+// empty) for the days from first to last inclusive, in the family's
+// timezone loc, building them first if need be. childID limits them to
+// one child.
+func (db *DB) DailyRollups(familyID, childID, typ string, loc *time.Location, first, last string) ([]Rollup, error) {
+	if err := db.ensureRollups(familyID, loc); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(
+		`SELECT day, child_id, type, value, count, duration_ms FROM daily_rollups
+		 WHERE family_id = ? AND day >= ? AND day <= ? AND (? = '' OR type = ?) AND (? = '' OR child_id = ?)
+		 ORDER BY day, type, value`,
+		familyID, first, last, typ, typ, childID, childID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rollups []Rollup
+	for rows.Next() {
+		var r Rollup
+		if err := rows.Scan(&r.Day, &r.ChildID, &r.Type, &r.Value, &r.Count, &r.DurationMs); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+// sameDays reports whether days from first through n days on start and end
+// at the same instants in loc as in first's location, so rollups built in
+// loc can answer a query made in the other.
+func sameDays(loc *time.Location, first time.Time, n int) bool {
+	for i := range n + 1 {
+		d := first.AddDate(0, 0, i)
+		if !time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc).Equal(d) {
+			return false
+		}
+	}
+	return true
+}
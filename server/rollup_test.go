@@ -0,0 +1,78 @@
+package babytrack
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestDailyRollups(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	loc, _ := time.LoadLocation("Australia/Sydney")
+	day := func(d int, h int) int64 { return time.Date(2026, 3, d, h, 0, 0, 0, loc).UnixMilli() }
+	ended := day(2, 3)
+
+	db.UpsertEntry(&Entry{ID: "n1", FamilyID: family.ID, Ts: day(1, 8), Type: "nappy", Value: "wet"})
+	db.UpsertEntry(&Entry{ID: "n2", FamilyID: family.ID, Ts: day(1, 6), Type: "nappy", Value: "wet"}) // still 28 Feb in UTC
+	db.UpsertEntry(&Entry{ID: "s1", FamilyID: family.ID, Ts: day(1, 22), EndedTs: &ended, Type: "sleep", Value: "sleeping"})
+
+	get := func() map[string]Rollup {
+		rollups, err := db.DailyRollups(family.ID, "", "", loc, "2026-03-01", "2026-03-03")
+		if err != nil {
+			t.Fatal(err)
+		}
+		byKey := map[string]Rollup{}
+		for _, r := range rollups {
+			byKey[r.Day+" "+r.Type+" "+r.Value] = r
+		}
+		return byKey
+	}
+	r := get() // built in full
+	if r["2026-03-01 nappy wet"].Count != 2 || r["2026-03-01 sleep sleeping"].DurationMs != 5*time.Hour.Milliseconds() {
+		t.Fatalf("rollups = %+v", r)
+	}
+
+	// Later writes update the days they touch
+	db.UpsertEntry(&Entry{ID: "n3", FamilyID: family.ID, Ts: day(2, 9), Type: "nappy", Value: "dirty"})
+	db.UpsertEntry(&Entry{ID: "n1", FamilyID: family.ID, Ts: day(3, 8), Type: "nappy", Value: "wet"}) // moved
+	db.DeleteEntry(family.ID, "n2")
+	r = get()
+	if r["2026-03-01 nappy wet"].Count != 0 || r["2026-03-02 nappy dirty"].Count != 1 || r["2026-03-03 nappy wet"].Count != 1 {
+		t.Errorf("after writes = %+v", r)
+	}
+	db.RestoreEntries(family.ID, []string{"n2"}, 0, 0)
+	if r = get(); r["2026-03-01 nappy wet"].Count != 1 {
+		t.Errorf("after restore = %+v", r)
+	}
+
+	// Imports mark them for a rebuild
+	db.ImportEntries(family.ID, []Entry{{ID: "i1", Ts: day(2, 10), Type: "nappy", Value: "dirty"}})
+	var tz sql.NullString
+	db.QueryRow("SELECT rollup_tz FROM families WHERE id = ?", family.ID).Scan(&tz)
+	if tz.Valid {
+		t.Errorf("rollups not invalidated by import: %v", tz)
+	}
+	if r = get(); r["2026-03-02 nappy dirty"].Count != 2 {
+		t.Errorf("after import = %+v", r)
+	}
+}
+
+func TestSameDays(t *testing.T) {
+	first := time.Date(2026, 3, 1, 0, 0, 0, 0, time.FixedZone("client", 0))
+	if !sameDays(time.UTC, first, 7) {
+		t.Error("UTC and +0 differ")
+	}
+	sydney, _ := time.LoadLocation("Australia/Sydney")
+	aedt := time.Date(2026, 3, 30, 0, 0, 0, 0, time.FixedZone("client", 11*3600))
+	if !sameDays(sydney, aedt, 3) {
+		t.Error("AEDT days differ from Sydney")
+	}
+	if sameDays(sydney, aedt, 7) { // daylight saving ends 5 April
+		t.Error("fixed offset matched across a DST change")
+	}
+}
@@ -0,0 +1,194 @@
+package babytrack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Optional access link rotation (LINK_ROTATION_HOURS). Links live for a
+// long time in browser history, chats and screenshots; with rotation a
+// copied URL stops working a while after its devices have moved on.
+//
+// When a link is due, the next device to present it is handed a
+// replacement token over the WebSocket and swaps its cookie via POST
+// /api/v1/session. The replacement is derived from the current token with
+// a server key, so every device of the link gets the same one, including
+// devices that only show up with the old token during the grace period,
+// and the database still holds no usable token.
+
+type linkRotation struct {
+	every time.Duration // 0 disables rotation
+	grace time.Duration // how long the previous token keeps working
+}
+
+// rotatedToken derives the token that replaces token.
+func rotatedToken(key []byte, token string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))[:32] // same length as generated tokens
+}
+
+// nextLinkToken returns the token a client that authenticated with token
+// should switch to, or "" to keep it, rotating the link if it is due.
+func (s *Server) nextLinkToken(link *AccessLink, token string, now time.Time) (string, error) {
+	if link.sess != nil {
+		// The device doesn't hold the link's token, so nobody needs the
+		// replacement: retire the token, so copied links still stop working
+		if !s.linkDue(link, now) {
+			return "", nil
+		}
+		return "", s.db.RotateAccessLink(link.ID, link.currentHash, hashToken(generateToken(16)),
+			now.Add(s.rotation.grace).UnixMilli(), now.UnixMilli())
+	}
+	if !link.superseded && !s.linkDue(link, now) {
+		return "", nil
+	}
+
+	key, err := s.db.Secret("link-rotation")
+	if err != nil {
+		return "", err
+	}
+	next := rotatedToken(key, token)
+	if link.superseded {
+		return next, nil // already rotated from this token
+	}
+	err = s.db.RotateAccessLink(link.ID, link.currentHash, hashToken(next),
+		now.Add(s.rotation.grace).UnixMilli(), now.UnixMilli())
+	return next, err
+}
+
+// linkDue reports whether the link's token is due to be rotated.
+func (s *Server) linkDue(link *AccessLink, now time.Time) bool {
+	if s.rotation.every == 0 || link.FamilyID == demoFamilyID {
+		return false
+	}
+	last := link.CreatedAt
+	if link.RotatedAt != nil {
+		last = *link.RotatedAt
+	}
+	return now.Sub(time.UnixMilli(last)) >= s.rotation.every
+}
+
+// offerRotation sends the client its link's replacement token, if due.
+func (s *Server) offerRotation(c *Client, link *AccessLink, token string) {
+	next, err := s.nextLinkToken(link, token, time.Now())
+	if err != nil {
+		c.log().Error("failed to rotate access link", "error", err)
+		return
+	}
+	if next != "" {
+		s.hub.SendRotation(link.ID, next)
+	}
+}
+
+// SendRotation hands every client of the link its new token, apart from
+// those on sessions, which don't hold the link's token.
+func (h *Hub) SendRotation(linkID, token string) {
+	h.relay(busMessage{Kind: "rotation", LinkID: linkID, Token: token})
+	h.sendRotation(linkID, token)
+}
+
+func (h *Hub) sendRotation(linkID, token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msg, _ := json.Marshal(map[string]any{"type": "token_rotated", "token": token})
+	for _, clients := range h.families {
+		for c := range clients {
+			if c.linkID == linkID && !c.session {
+				c.token = token
+				c.trySend(msg)
+			}
+		}
+	}
+}
+
+// RunLinkRotation rotates the links and sessions of connected clients as
+// they fall due, and purges expired sessions, checking every interval until
+// ctx is done.
+func (s *Server) RunLinkRotation(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		s.rotateConnected()
+	}
+}
+
+func (s *Server) rotateConnected() {
+	now := time.Now()
+	if _, err := s.db.PurgeLinkSessions(now.UnixMilli()); err != nil {
+		slog.Error("failed to purge expired sessions", "error", err)
+	}
+	if err := s.db.PurgeAccountSessions(now.UnixMilli()); err != nil {
+		slog.Error("failed to purge expired account sessions", "error", err)
+	}
+
+	tokens := map[string]string{} // token → link ID
+	s.hub.mu.RLock()
+	for _, clients := range s.hub.families {
+		for c := range clients {
+			if c.token != "" {
+				tokens[c.token] = c.linkID
+			}
+		}
+	}
+	s.hub.mu.RUnlock()
+
+	// One link token per link, as all of a link's clients get the result
+	rotated := map[string]bool{}
+	for token, linkID := range tokens {
+		link, err := s.db.ValidateAccessLink(token)
+		if err != nil {
+			continue // revoked or expired; ExpireSessions deals with it
+		}
+		if link.sess != nil {
+			next, err := s.renewSession(link, link.sess.deviceID, false, now)
+			if err != nil {
+				slog.Error("failed to renew session", "family", link.FamilyID, "label", link.Label, "error", err)
+			} else if next != "" {
+				s.hub.SendSessionToken(token, next)
+			}
+		}
+		if rotated[linkID] {
+			continue
+		}
+		rotated[linkID] = true
+		next, err := s.nextLinkToken(link, token, now)
+		if err != nil {
+			slog.Error("failed to rotate access link", "family", link.FamilyID, "label", link.Label, "error", err)
+			continue
+		}
+		if next != "" {
+			s.hub.SendRotation(linkID, next)
+		}
+	}
+}
+
+// handleSession serves POST /api/v1/session: {"token"} replaces the
+// client_session cookie, for a client switching to a rotated token.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	if _, err := s.db.ValidateAccessLink(req.Token); err != nil {
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid or expired link")
+		return
+	}
+	s.setClientSession(w, r, req.Token)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNextLinkToken(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	created, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	s := &Server{db: db, hub: NewHub(db), rotation: linkRotation{every: time.Hour, grace: time.Hour}}
+	now := time.Now()
+
+	link, _ := db.ValidateAccessLink(created.Token)
+	if next, err := s.nextLinkToken(link, created.Token, now); err != nil || next != "" {
+		t.Fatalf("fresh link rotated: %q, %v", next, err)
+	}
+
+	next, err := s.nextLinkToken(link, created.Token, now.Add(2*time.Hour))
+	if err != nil || next == "" || next == created.Token {
+		t.Fatalf("due link: %q, %v", next, err)
+	}
+	rotated, err := db.ValidateAccessLink(next)
+	if err != nil || rotated.ID != created.ID || rotated.superseded {
+		t.Fatalf("new token: %+v, %v", rotated, err)
+	}
+
+	// A device still on the old token gets the same replacement
+	old, err := db.ValidateAccessLink(created.Token)
+	if err != nil || !old.superseded {
+		t.Fatalf("old token in grace period: %+v, %v", old, err)
+	}
+	if again, _ := s.nextLinkToken(old, created.Token, now.Add(2*time.Hour)); again != next {
+		t.Errorf("old token offered %q, want %q", again, next)
+	}
+
+	// The next rotation ends the first token's grace period
+	s.rotation.grace = -5 * time.Hour // lapsed before the real now
+	third, err := s.nextLinkToken(rotated, next, now.Add(4*time.Hour))
+	if err != nil || third == "" || third == next {
+		t.Fatalf("second rotation: %q, %v", third, err)
+	}
+	if _, err := db.ValidateAccessLink(created.Token); err == nil {
+		t.Error("token from two rotations ago still works")
+	}
+	if _, err := db.ValidateAccessLink(next); err == nil {
+		t.Error("previous token works after its grace period")
+	}
+	if _, err := db.ValidateAccessLink(third); err != nil {
+		t.Errorf("current token: %v", err)
+	}
+	if id, err := db.DeleteAccessLink(family.ID, third); err != nil || id != created.ID {
+		t.Errorf("delete by rotated token = %q, %v", id, err)
+	}
+}
+
+func TestWebSocketTokenRotation(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+
+	s := &Server{db: db, hub: NewHub(db), rotation: linkRotation{every: time.Nanosecond, grace: time.Hour}}
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/ws", header)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	msg := skipUntilType(t, conn, "token_rotated")
+	token, _ := msg["token"].(string)
+	if token == "" || token == link.Token {
+		t.Fatalf("rotation message = %v", msg)
+	}
+
+	resp, err := http.Post(server.URL+"/api/v1/session", "application/json", strings.NewReader(`{"token": "`+token+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == "client_session" {
+			cookie = c
+		}
+	}
+	if resp.StatusCode != http.StatusNoContent || cookie == nil || cookie.Value != token || !cookie.HttpOnly {
+		t.Errorf("session swap: status %d, cookie %+v", resp.StatusCode, cookie)
+	}
+
+	resp, _ = http.Post(server.URL+"/api/v1/session", "application/json", strings.NewReader(`{"token": "nope"}`))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("bad token: status %d, want 401", resp.StatusCode)
+	}
+	resp.Body.Close()
+}
+
+func TestSendRotationSkipsSessions(t *testing.T) {
+	hub := NewHub(nil)
+	onToken := &Client{hub: hub, send: make(chan []byte, 16), familyID: "f1", linkID: "l1", token: "old", connectedAt: time.Now()}
+	onSession := &Client{hub: hub, send: make(chan []byte, 16), familyID: "f1", linkID: "l1", token: "sess", session: true, connectedAt: time.Now()}
+	hub.Register(onToken)
+	hub.Register(onSession)
+
+	hub.sendRotation("l1", "new")
+
+	rotated := func(c *Client) bool {
+		for {
+			select {
+			case msg := <-c.send:
+				if strings.Contains(string(msg), "token_rotated") {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	}
+	if !rotated(onToken) || onToken.token != "new" {
+		t.Errorf("client on the link's token wasn't rotated: %q", onToken.token)
+	}
+	if rotated(onSession) || onSession.token != "sess" {
+		t.Errorf("client on a session was sent the link's token: %q", onSession.token)
+	}
+}
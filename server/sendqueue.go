@@ -0,0 +1,96 @@
+package babytrack
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Broadcasts never wait for a slow client: a message that doesn't fit in
+// its send queue is dropped, and the client catches up on its next sync.
+// So drops aren't silent, each client counts the frames and bytes written
+// to it and the messages dropped, and the Hub keeps totals that include
+// clients since gone. A client's first drop, and then at most one a
+// dropWarnInterval, is logged and shown as a warning in the admin activity
+// feed. Totals are in /admin/stats, and per device in
+// /admin/families/{id}/devices.
+
+const dropWarnInterval = time.Minute
+
+// sendCounters counts a client's, or the Hub's, outgoing messages.
+type sendCounters struct {
+	frames  atomic.Int64
+	bytes   atomic.Int64
+	dropped atomic.Int64
+}
+
+// SendStats is outgoing WebSocket traffic.
+type SendStats struct {
+	Frames     int64 `json:"frames"`
+	Bytes      int64 `json:"bytes"`
+	Dropped    int64 `json:"dropped"`
+	QueueDepth int   `json:"queue_depth"` // messages waiting to be written now
+}
+
+func (s *SendStats) add(c *Client) {
+	s.Frames += c.sent.frames.Load()
+	s.Bytes += c.sent.bytes.Load()
+	s.Dropped += c.sent.dropped.Load()
+	s.QueueDepth += len(c.send)
+}
+
+// trySend queues msg for c, or drops it if c's queue is full. Reports
+// whether it was queued.
+func (c *Client) trySend(msg []byte) bool {
+	select {
+	case c.send <- msg:
+		return true
+	default:
+	}
+	n := c.sent.dropped.Add(1)
+	if c.hub != nil {
+		c.hub.sent.dropped.Add(1)
+	}
+
+	now := time.Now().UnixMilli()
+	last := c.dropWarnedAt.Load()
+	if now-last < dropWarnInterval.Milliseconds() || !c.dropWarnedAt.CompareAndSwap(last, now) {
+		return false
+	}
+	c.log().Warn("ws send queue full, dropping messages", "dropped", n)
+	if c.hub != nil {
+		c.hub.publishActivity(ActivityEvent{
+			Type: "warning", FamilyID: c.familyID, Label: c.linkLabel(),
+			Message: fmt.Sprintf("device isn't keeping up; dropping messages (%d so far)", n),
+		})
+	}
+	return false
+}
+
+// noteWritten counts a frame of n bytes written to c.
+func (c *Client) noteWritten(n int) {
+	c.sent.frames.Add(1)
+	c.sent.bytes.Add(int64(n))
+	if c.hub != nil {
+		c.hub.sent.frames.Add(1)
+		c.hub.sent.bytes.Add(int64(n))
+	}
+}
+
+// SendStats returns the Hub's outgoing traffic since it started, with the
+// messages now queued.
+func (h *Hub) SendStats() SendStats {
+	st := SendStats{
+		Frames:  h.sent.frames.Load(),
+		Bytes:   h.sent.bytes.Load(),
+		Dropped: h.sent.dropped.Load(),
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, clients := range h.families {
+		for c := range clients {
+			st.QueueDepth += len(c.send)
+		}
+	}
+	return st
+}
@@ -0,0 +1,60 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSendQueueDrops(t *testing.T) {
+	h := NewHub(nil)
+	activity := h.SubscribeActivity()
+	defer h.UnsubscribeActivity(activity)
+	c := withLabel(&Client{hub: h, send: make(chan []byte, 2), familyID: "f", linkID: "l"}, "Mum")
+	if err := h.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	// Presence fills one slot, a broadcast the other
+	h.Broadcast("f", []byte(`{"type":"entry"}`), nil)
+	h.Broadcast("f", []byte(`{"type":"entry"}`), nil)
+	h.Broadcast("f", []byte(`{"type":"entry"}`), nil)
+
+	if st := h.SendStats(); st.Dropped != 2 || st.QueueDepth != 2 {
+		t.Errorf("send stats = %+v", st)
+	}
+	devices := h.Devices("f")
+	if len(devices) != 1 || devices[0].Send.Dropped != 2 || devices[0].Send.QueueDepth != 2 {
+		t.Errorf("devices = %+v", devices)
+	}
+
+	// One warning for the first drop, not for the second
+	warnings := 0
+	for deadline := time.After(100 * time.Millisecond); ; {
+		select {
+		case msg := <-activity:
+			var ev ActivityEvent
+			json.Unmarshal(msg, &ev)
+			if ev.Type == "warning" {
+				warnings++
+				if ev.Message != "device isn't keeping up; dropping messages (1 so far)" {
+					t.Errorf("warning = %q", ev.Message)
+				}
+			}
+			continue
+		case <-deadline:
+		}
+		break
+	}
+	if warnings != 1 {
+		t.Errorf("%d warnings", warnings)
+	}
+
+	// Written frames count toward the client and the Hub, including once
+	// it's gone
+	<-c.send
+	c.noteWritten(10)
+	h.Unregister(c)
+	if st := h.SendStats(); st.Frames != 1 || st.Bytes != 10 || st.Dropped != 2 || st.QueueDepth != 0 {
+		t.Errorf("send stats after unregister = %+v", st)
+	}
+}
@@ -0,0 +1,152 @@
+package babytrack
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+)
+
+// Chart data: entry counts and durations per day, week or month, from the
+// daily rollups, so charts and dashboards needn't fetch and bucket raw
+// entries themselves. Buckets are calendar days in the family's timezone.
+
+const maxSeriesDays = 3 * 366
+
+var seriesBuckets = map[string]bool{"day": true, "week": true, "month": true}
+
+type SeriesBucket struct {
+	Start      string         `json:"start"` // YYYY-MM-DD, the bucket's first day
+	Count      int            `json:"count"`
+	DurationMs int64          `json:"duration_ms"`
+	Values     map[string]int `json:"values"` // count by value
+}
+
+type Series struct {
+	Type     string         `json:"type,omitempty"`
+	Value    string         `json:"value,omitempty"`
+	Bucket   string         `json:"bucket"`
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Timezone string         `json:"timezone"`
+	Buckets  []SeriesBucket `json:"buckets"` // oldest first, empty ones included
+}
+
+// bucketStart returns the first day of the bucket containing d.
+func bucketStart(d time.Time, bucket string) time.Time {
+	switch bucket {
+	case "week":
+		// Weeks start on Monday
+		return d.AddDate(0, 0, -(int(d.Weekday())+6)%7)
+	case "month":
+		return time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, d.Location())
+	}
+	return d
+}
+
+// buildSeries buckets the family's entries on the days from first to last
+// inclusive (midnights in the family's timezone). typ, value and childID
+// narrow the entries when set.
+func buildSeries(db EntryStore, familyID, childID, typ, value, bucket string, first, last time.Time) (*Series, error) {
+	s := &Series{
+		Type: typ, Value: value, Bucket: bucket,
+		From: first.Format("2006-01-02"), To: last.Format("2006-01-02"), Timezone: first.Location().String(),
+		Buckets: []SeriesBucket{},
+	}
+	index := map[string]int{}
+	for d := bucketStart(first, bucket); !d.After(last); {
+		index[d.Format("2006-01-02")] = len(s.Buckets)
+		s.Buckets = append(s.Buckets, SeriesBucket{Start: d.Format("2006-01-02"), Values: map[string]int{}})
+		switch bucket {
+		case "week":
+			d = d.AddDate(0, 0, 7)
+		case "month":
+			d = d.AddDate(0, 1, 0)
+		default:
+			d = d.AddDate(0, 0, 1)
+		}
+	}
+
+	rollups, err := db.DailyRollups(familyID, childID, typ, first.Location(), s.From, s.To)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rollups {
+		if value != "" && r.Value != value {
+			continue
+		}
+		day, err := time.ParseInLocation("2006-01-02", r.Day, first.Location())
+		if err != nil {
+			continue
+		}
+		b := &s.Buckets[index[bucketStart(day, bucket).Format("2006-01-02")]]
+		b.Count += r.Count
+		b.DurationMs += r.DurationMs
+		b.Values[r.Value] += r.Count
+	}
+	return s, nil
+}
+
+// seriesReport writes the series for ?type=&value=&child=&bucket=&from=&to=,
+// with from and to dates (YYYY-MM-DD) defaulting to the 30 days to today.
+func (s *Server) seriesReport(w http.ResponseWriter, r *http.Request, familyID string) {
+	q := r.URL.Query()
+	bucket := q.Get("bucket")
+	if bucket == "" {
+		bucket = "day"
+	}
+	if !seriesBuckets[bucket] {
+		validationError(w, map[string]string{"bucket": "must be day, week or month"})
+		return
+	}
+
+	settings, err := s.db.GetFamilySettings(familyID)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to load family settings", err)
+		return
+	}
+	loc := settings.Location()
+	now := time.Now().In(loc)
+	last := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	first := last.AddDate(0, 0, -29)
+	fields := map[string]string{}
+	for name, dst := range map[string]*time.Time{"from": &first, "to": &last} {
+		if v := q.Get(name); v != "" {
+			d, err := time.ParseInLocation("2006-01-02", v, loc)
+			if err != nil {
+				fields[name] = "invalid format (use YYYY-MM-DD)"
+				continue
+			}
+			*dst = d
+		}
+	}
+	if len(fields) == 0 && last.Before(first) {
+		fields["to"] = "must not be before from"
+	} else if len(fields) == 0 && last.Sub(first) > maxSeriesDays*24*time.Hour {
+		fields["from"] = "range must be at most 3 years"
+	}
+	if len(fields) > 0 {
+		validationError(w, fields)
+		return
+	}
+
+	series, err := buildSeries(s.db, familyID, q.Get("child"), q.Get("type"), q.Get("value"), bucket, first, last)
+	if err != nil {
+		serverError(w, "failed to build series", err)
+		return
+	}
+	jsonOK(w, series)
+}
+
+// handleSeries serves GET /api/v1/analytics/series for the caller's family.
+func (s *Server) handleSeries(w http.ResponseWriter, r *http.Request) {
+	s.seriesReport(w, r, accessLinkFrom(r.Context()).FamilyID)
+}
+
+// adminSeries serves GET /admin/families/{id}/analytics/series.
+func (s *Server) adminSeries(w http.ResponseWriter, r *http.Request) {
+	s.seriesReport(w, r, r.PathValue("id"))
+}
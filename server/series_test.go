@@ -0,0 +1,74 @@
+package babytrack
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSeries(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+
+	loc, _ := time.LoadLocation("Australia/Sydney")
+	day := func(d int) time.Time { return time.Date(2025, 6, d, 0, 0, 0, 0, loc) }
+	add := func(ts time.Time, value string, ended *int64) {
+		e := &Entry{ID: generateToken(8), FamilyID: family.ID, Ts: ts.UnixMilli(), EndedTs: ended, Type: "feed", Value: value}
+		if err := db.UpsertEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ended := day(2).Add(8*time.Hour + 20*time.Minute).UnixMilli()
+	add(day(2).Add(8*time.Hour), "bf", &ended) // Monday
+	add(day(5).Add(time.Hour), "bottle", nil)
+	add(day(9).Add(time.Hour), "bf", nil) // the next Monday
+
+	s, err := buildSeries(db, family.ID, "", "feed", "", "day", day(1), day(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Buckets) != 9 || s.Buckets[1].Start != "2025-06-02" || s.Buckets[1].Count != 1 || s.Buckets[1].DurationMs != 20*60*1000 {
+		t.Fatalf("days = %+v", s.Buckets)
+	}
+	// 1am on the 5th in Sydney, still the 4th in UTC
+	if s.Buckets[4].Values["bottle"] != 1 || s.Buckets[3].Count != 0 {
+		t.Errorf("4-5 June = %+v", s.Buckets[3:5])
+	}
+
+	s, _ = buildSeries(db, family.ID, "", "feed", "", "week", day(1), day(9))
+	if len(s.Buckets) != 3 || s.Buckets[0].Start != "2025-05-26" || s.Buckets[1].Count != 2 || s.Buckets[2].Count != 1 {
+		t.Errorf("weeks = %+v", s.Buckets)
+	}
+
+	s, _ = buildSeries(db, family.ID, "", "feed", "bf", "month", day(1), day(9))
+	if len(s.Buckets) != 1 || s.Buckets[0].Count != 2 || s.Buckets[0].Values["bottle"] != 0 {
+		t.Errorf("months = %+v", s.Buckets)
+	}
+}
+
+func TestSeriesReportValidation(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+
+	for _, q := range []string{"bucket=hour", "from=June", "from=2025-06-10&to=2025-06-01", "from=2020-01-01&to=2025-01-01"} {
+		req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/analytics/series?"+q, nil)
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.adminSeries(w, req)
+		if w.Code != 400 {
+			t.Errorf("%s: %d", q, w.Code)
+		}
+	}
+	req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/analytics/series?bucket=week", nil)
+	req.SetPathValue("id", family.ID)
+	w := httptest.NewRecorder()
+	s.adminSeries(w, req)
+	if w.Code != 200 {
+		t.Errorf("default: %d %s", w.Code, w.Body)
+	}
+}
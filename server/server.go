@@ -0,0 +1,232 @@
+package babytrack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Options configures a Server. Start from DefaultOptions, which are what
+// babytrackd runs with when no environment variables are set; Main reads
+// them from the environment with OptionsFromEnv.
+type Options struct {
+	// DBPath is the SQLite database, created and migrated as needed, and
+	// DBKey its SQLCipher key, if encrypted. Store, if set, is used instead
+	// and left open by Close.
+	DBPath string
+	DBKey  string
+	Store  Store
+
+	// DefaultConfigFile is a button config for families without one.
+	DefaultConfigFile string
+	// AdminUser and AdminPass, if both set, create or reset that admin.
+	AdminUser string
+	AdminPass string
+
+	// BasePath serves everything under a prefix, e.g. "/babytrack".
+	BasePath string
+	// BaseURL is the public origin, e.g. "https://babytrack.example", for
+	// URLs sent out of band; the request's origin is used if empty.
+	BaseURL string
+	// Mailer sends invitations; without one, email features are off.
+	Mailer Mailer
+	// SMS texts high-priority alerts; without one, SMS alerts are off.
+	SMS SMSSender
+	// StaticDir holds the pages, scripts and stylesheets; "static" if empty.
+	StaticDir string
+
+	// BusURL connects to other instances; see bus.go.
+	BusURL string
+	// Connection limits; 0 means unlimited.
+	MaxConnsPerFamily int
+	MaxConnsPerLink   int
+
+	// /healthz/ready fails above MaxWALBytes of WAL or below MinFreeBytes
+	// of free disk; 0 disables either check.
+	MaxWALBytes  int64
+	MinFreeBytes int64
+
+	Quotas Quotas
+	Bounds EntryBounds
+
+	// LinkRotation replaces link tokens this often, accepting the old one
+	// for LinkRotationGrace; 0 never rotates.
+	LinkRotation      time.Duration
+	LinkRotationGrace time.Duration
+
+	// SessionTTL is how long a device's session lasts unused, and
+	// SessionRotation how often one in use is replaced; see sessions.go.
+	SessionTTL      time.Duration
+	SessionRotation time.Duration
+
+	Lifecycle        LifecyclePolicy
+	LifecycleWebhook string
+
+	// DigestWebhook, if set, gets the daily digest at DigestHour (server
+	// time), listing families DigestQuietDays without entries; see
+	// digest.go.
+	DigestWebhook   string
+	DigestHour      int
+	DigestQuietDays int
+
+	// SnapshotInterval is how often large families' snapshots are rebuilt;
+	// 0 never.
+	SnapshotInterval time.Duration
+
+	// LogLevel is "debug" or "info", for the logger babytrackd sets up.
+	LogLevel string
+	// Client log rate limits per minute; see log.go.
+	ClientLogIPLimit     int
+	ClientLogFamilyLimit int
+
+	// ReloadOptions, if set, returns fresh options on SIGHUP or POST
+	// /admin/reload; see reload.go.
+	ReloadOptions func() Options
+
+	// Demo seeds a demo family at /t/demo, reseeded nightly with DemoReset.
+	Demo      bool
+	DemoReset bool
+}
+
+// DefaultOptions returns the options babytrackd uses when no environment
+// variables are set.
+func DefaultOptions() Options {
+	return Options{
+		DBPath:            "babytrack.db",
+		StaticDir:         "static",
+		MaxConnsPerFamily: 20,
+		MaxConnsPerLink:   5,
+		MaxWALBytes:       256 << 20,
+		MinFreeBytes:      100 << 20,
+		Quotas:            Quotas{EntriesPerDay: 2000, DataBytes: 50 << 20, Links: 50},
+		Bounds:            defaultEntryBounds,
+		LinkRotationGrace: 168 * time.Hour,
+		SessionTTL:        defaultSessionTTL,
+		SessionRotation:   defaultSessionRotation,
+		SnapshotInterval:  15 * time.Minute,
+		DigestHour:        7,
+		DigestQuietDays:   3,
+		LogLevel:          "info",
+
+		ClientLogIPLimit:     clientLogIPLimit,
+		ClientLogFamilyLimit: clientLogFamilyLimit,
+	}
+}
+
+// New returns a Server that isn't started yet: until Start returns, it
+// answers probes and turns other requests away with 503, so it can serve
+// while the database migrates.
+func New(opts Options) *Server {
+	s := &Server{opts: opts, basePath: opts.BasePath, staticDir: opts.StaticDir, instance: generateToken(8)}
+	s.ready.Set("starting")
+	s.handler = loggingMiddleware(withBasePath(s.basePath, s.startupGate(s.maintenanceGate(s.routes()))))
+	return s
+}
+
+// NewServer returns a started Server. Close it when done.
+func NewServer(opts Options) (*Server, error) {
+	s := New(opts)
+	if err := s.Start(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ServeHTTP serves the whole app: pages, the client and admin APIs, and
+// WebSockets.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Start opens and migrates the database, unless the options gave a Store,
+// and starts background work.
+func (s *Server) Start() error {
+	opts := s.opts
+	s.ready.Set("migrating")
+	db := opts.Store
+	if db == nil {
+		sqlDB, err := NewKeyedDB(opts.DBPath, opts.DBKey)
+		if err != nil {
+			return fmt.Errorf("open database: %w", err)
+		}
+		s.closers = append(s.closers, sqlDB.Close)
+		if opts.DefaultConfigFile != "" {
+			if err := sqlDB.LoadConfigFile(opts.DefaultConfigFile); err != nil {
+				return fmt.Errorf("load default config: %w", err)
+			}
+		}
+		db = sqlDB
+	}
+	if opts.AdminUser != "" && opts.AdminPass != "" {
+		if err := db.EnsureAdmin(opts.AdminUser, opts.AdminPass); err != nil {
+			return fmt.Errorf("create admin: %w", err)
+		}
+	}
+
+	s.db = db
+	s.hub = NewHub(db)
+	s.hub.maintenance = &s.maintenance
+	if opts.BusURL != "" {
+		bus, err := newBus(opts.BusURL)
+		if err != nil {
+			return fmt.Errorf("hub bus: %w", err)
+		}
+		s.closers = append(s.closers, bus.Close)
+		s.hub.UseBus(bus)
+		u, _ := url.Parse(opts.BusURL)
+		slog.Info("hub bus enabled", "url", u.Redacted())
+	}
+	s.tune(opts)
+	s.rotation = linkRotation{every: opts.LinkRotation, grace: opts.LinkRotationGrace}
+	s.sessions = sessionPolicy{ttl: opts.SessionTTL, rotateEvery: opts.SessionRotation}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stop = cancel
+	go s.hub.RunExpiry(ctx, time.Minute)
+	// Sessions rotate whether or not links do. Each instance rotates its
+	// own clients' tokens, which all derive the same replacements
+	go s.RunLinkRotation(ctx, time.Hour)
+	// Families can opt in with overrides, so this runs regardless. It and
+	// snapshots run on one instance at a time; see lease.go
+	go s.RunLifecycle(ctx, time.Hour)
+	go s.RunReminders(ctx, time.Minute)
+	if opts.SnapshotInterval > 0 {
+		go s.RunSnapshots(ctx, opts.SnapshotInterval)
+	}
+	// DIGEST_WEBHOOK_URL may be set on reload, so this runs regardless
+	go s.RunDigest(ctx, opts.DigestHour, opts.DigestQuietDays)
+	if opts.Demo {
+		if err := s.seedDemo(); err != nil {
+			return fmt.Errorf("seed demo family: %w", err)
+		}
+		if opts.DemoReset {
+			go s.runDemoReset(ctx)
+		}
+	}
+
+	s.ready.MarkStarted()
+	return nil
+}
+
+// Close stops background work, disconnects WebSocket clients, and closes
+// the bus and the database Start opened. Stop serving HTTP first.
+func (s *Server) Close() error {
+	if s.stop != nil {
+		s.stop()
+	}
+	if s.hub != nil {
+		s.hub.CloseAll()
+	}
+	var err error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if cerr := s.closers[i](); err == nil {
+			err = cerr
+		}
+	}
+	s.closers = nil
+	return err
+}
@@ -0,0 +1,98 @@
+package babytrack_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	babytrack "babytrackd"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestEmbeddedServer mounts a Server in another service's mux, as an
+// embedder would, and drives it end to end: admin login, a family and
+// link, and a client's WebSocket.
+func TestEmbeddedServer(t *testing.T) {
+	opts := babytrack.DefaultOptions()
+	opts.DBPath = filepath.Join(t.TempDir(), "embedded.db")
+	opts.AdminUser, opts.AdminPass = "jane", "secret"
+	opts.BasePath = "/babytrack"
+	s, err := babytrack.NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/babytrack/", s)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	call := func(method, path string, body any, out any) int {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, server.URL+"/babytrack"+path, bytes.NewReader(data))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	if code := call("POST", "/admin/login", map[string]string{"username": "jane", "password": "secret"}, nil); code != http.StatusOK {
+		t.Fatalf("login = %d", code)
+	}
+	var family struct{ ID string }
+	if code := call("POST", "/admin/families", map[string]string{"name": "Embedded"}, &family); code != http.StatusCreated {
+		t.Fatalf("create family = %d", code)
+	}
+	var link struct{ Token string }
+	if code := call("POST", "/admin/families/"+family.ID+"/links", map[string]string{"label": "Mum"}, &link); code != http.StatusCreated {
+		t.Fatalf("create link = %d", code)
+	}
+	if code := call("GET", "/", nil, nil); code != http.StatusOK {
+		t.Errorf("app page = %d", code)
+	}
+
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/babytrack/api/v1/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg map[string]any
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg["type"] == "init" {
+			break
+		}
+	}
+
+	// Close disconnects clients
+	s.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				t.Errorf("after Close: %v", err)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Client sessions. A device that signs in (/t/, /invite/, /magic/) gets a
+// session token of its own in its client_session cookie rather than the
+// link's token, so the cookie isn't a permanent credential: a session
+// expires SessionTTL after its device was last seen, and is replaced every
+// SessionRotation while in use. HTTP requests get the replacement as a new
+// cookie; connected devices get token_rotated and swap it via POST
+// /api/v1/session, as for link rotation. The replaced token keeps working
+// for sessionGrace, for requests already in flight.
+//
+// The app's devices still holding their link's token, from before
+// sessions, move to one when their WebSocket next connects. Scripts
+// presenting a link token are left alone.
+
+type sessionPolicy struct {
+	ttl         time.Duration // sliding expiry
+	rotateEvery time.Duration
+}
+
+const (
+	defaultSessionTTL      = 30 * 24 * time.Hour
+	defaultSessionRotation = 24 * time.Hour
+	sessionGrace           = 5 * time.Minute
+	// sessionExtendEvery limits how often a session's expiry is written.
+	sessionExtendEvery = time.Hour
+)
+
+// linkSession is the session a link was authenticated with.
+type linkSession struct {
+	id        string // hash of the token
+	deviceID  string
+	issuedAt  int64
+	expiresAt int64
+}
+
+func (s *Server) sessionTTL() time.Duration {
+	if s.sessions.ttl == 0 {
+		return defaultSessionTTL
+	}
+	return s.sessions.ttl
+}
+
+func (s *Server) sessionRotation() time.Duration {
+	if s.sessions.rotateEvery == 0 {
+		return defaultSessionRotation
+	}
+	return s.sessions.rotateEvery
+}
+
+// CreateLinkSession returns a new session token for the link, on the
+// device if deviceID isn't "".
+func (db *DB) CreateLinkSession(link *AccessLink, deviceID string, now, expiresAt int64) (string, error) {
+	token := generateToken(16)
+	_, err := db.Exec(
+		"INSERT INTO link_sessions (id, link_id, family_id, device_id, issued_at, expires_at) VALUES (?, ?, ?, NULLIF(?, ''), ?, ?)",
+		hashToken(token), link.ID, link.FamilyID, deviceID, now, expiresAt,
+	)
+	return token, err
+}
+
+// RotateLinkSession replaces the session with a new one expiring at
+// expiresAt, keeping the old token until graceUntil, and returns the new
+// token. Returns sql.ErrNoRows if the session has already been replaced,
+// e.g. by a concurrent request, or is gone.
+func (db *DB) RotateLinkSession(id string, now, expiresAt, graceUntil int64) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var linkID, familyID string
+	var deviceID *string
+	if err := tx.QueryRow(
+		`UPDATE link_sessions SET expires_at = ?
+		 WHERE id = ? AND expires_at > ?
+		 RETURNING link_id, family_id, device_id`,
+		graceUntil, id, graceUntil,
+	).Scan(&linkID, &familyID, &deviceID); err != nil {
+		return "", err
+	}
+	token := generateToken(16)
+	if _, err := tx.Exec(
+		"INSERT INTO link_sessions (id, link_id, family_id, device_id, issued_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		hashToken(token), linkID, familyID, deviceID, now, expiresAt,
+	); err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// ExtendLinkSession pushes the session's expiry out to expiresAt.
+func (db *DB) ExtendLinkSession(id string, expiresAt int64) error {
+	_, err := db.Exec("UPDATE link_sessions SET expires_at = ? WHERE id = ? AND expires_at < ?", expiresAt, id, expiresAt)
+	return err
+}
+
+// PurgeLinkSessions deletes sessions that expired before now.
+func (db *DB) PurgeLinkSessions(now int64) (int64, error) {
+	res, err := db.Exec("DELETE FROM link_sessions WHERE expires_at <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// startSession signs the device in with a new session for link and sets
+// its cookies.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, link *AccessLink) error {
+	now := time.Now()
+	deviceID := s.startDevice(w, r, link)
+	token, err := s.db.CreateLinkSession(link, deviceID, now.UnixMilli(), now.Add(s.sessionTTL()).UnixMilli())
+	if err != nil {
+		return err
+	}
+	s.setClientSession(w, r, token)
+	return nil
+}
+
+// renewSession returns the session token a device that authenticated with
+// link should use from now on, or "" to keep the one it has: a replacement
+// when its session is due to rotate, or with upgrade, a new session for a
+// device on the link's token. A session that is kept has its expiry
+// extended.
+func (s *Server) renewSession(link *AccessLink, deviceID string, upgrade bool, now time.Time) (string, error) {
+	expiresAt := now.Add(s.sessionTTL()).UnixMilli()
+	if link.sess == nil {
+		if !upgrade || link.FamilyID == demoFamilyID {
+			return "", nil
+		}
+		return s.db.CreateLinkSession(link, deviceID, now.UnixMilli(), expiresAt)
+	}
+	if now.Sub(time.UnixMilli(link.sess.issuedAt)) >= s.sessionRotation() {
+		next, err := s.db.RotateLinkSession(link.sess.id, now.UnixMilli(), expiresAt, now.Add(sessionGrace).UnixMilli())
+		if err != sql.ErrNoRows {
+			return next, err
+		}
+		return "", nil // replaced already; this token is in its grace period
+	}
+	if expiresAt-link.sess.expiresAt >= sessionExtendEvery.Milliseconds() {
+		return "", s.db.ExtendLinkSession(link.sess.id, expiresAt)
+	}
+	return "", nil
+}
+
+// renewHTTPSession renews the session a request authenticated with,
+// setting the replacement cookie if there is one.
+func (s *Server) renewHTTPSession(w http.ResponseWriter, r *http.Request, link *AccessLink, deviceID string) {
+	next, err := s.renewSession(link, deviceID, false, time.Now())
+	if err != nil {
+		loggerFromCtx(r.Context()).Error("failed to renew session", "error", err)
+		return
+	}
+	if next != "" {
+		s.setClientSession(w, r, next)
+	}
+}
+
+// SendSessionToken hands the clients connected with a session its
+// replacement. Only this instance's: a session is one device's.
+func (h *Hub) SendSessionToken(old, next string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msg, _ := json.Marshal(map[string]any{"type": "token_rotated", "token": next})
+	n := 0
+	for _, clients := range h.families {
+		for c := range clients {
+			if c.token == old {
+				c.token = next
+				c.trySend(msg)
+				n++
+			}
+		}
+	}
+	return n
+}
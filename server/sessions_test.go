@@ -0,0 +1,121 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestClientSessions(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	db := s.db.(*DB)
+	mux := s.routes()
+	family, _ := s.db.CreateFamily("Smith", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+
+	get := func(path, session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.AddCookie(&http.Cookie{Name: "client_session", Value: session})
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	sessionCookie := func(w *httptest.ResponseRecorder) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == "client_session" {
+				return c
+			}
+		}
+		return nil
+	}
+	expiresAt := func(token string) int64 {
+		var at int64
+		db.QueryRow("SELECT expires_at FROM link_sessions WHERE id = ?", hashToken(token)).Scan(&at)
+		return at
+	}
+
+	// Signing in sets a session, not the link's token
+	signIn := httptest.NewRecorder()
+	mux.ServeHTTP(signIn, httptest.NewRequest("POST", "/t/"+link.Token, nil))
+	cookie := sessionCookie(signIn)
+	if cookie == nil || cookie.Value == link.Token || cookie.MaxAge != int(defaultSessionTTL/time.Second) {
+		t.Fatalf("cookie = %+v", cookie)
+	}
+	session := cookie.Value
+	if got, err := s.db.ValidateAccessLink(session); err != nil || got.ID != link.ID || got.sess == nil {
+		t.Fatalf("session link = %+v, %v", got, err)
+	}
+
+	// Use extends it
+	db.Exec("UPDATE link_sessions SET expires_at = ? WHERE id = ?", time.Now().Add(time.Hour).UnixMilli(), hashToken(session))
+	if w := get("/api/v1/state", session); w.Code != http.StatusOK || sessionCookie(w) != nil {
+		t.Fatalf("state: %d, cookie %+v", w.Code, sessionCookie(w))
+	}
+	if until := time.UnixMilli(expiresAt(session)); time.Until(until) < defaultSessionTTL-time.Minute {
+		t.Errorf("extended to %v", until)
+	}
+
+	// Once due it is replaced, the old token working for a grace period
+	s.sessions.rotateEvery = time.Nanosecond
+	w := get("/api/v1/state", session)
+	next := sessionCookie(w)
+	if w.Code != http.StatusOK || next == nil || next.Value == session {
+		t.Fatalf("rotate: %d, cookie %+v", w.Code, next)
+	}
+	if until := time.UnixMilli(expiresAt(session)); time.Until(until) > sessionGrace {
+		t.Errorf("old session until %v", until)
+	}
+	if w := get("/api/v1/state", session); w.Code != http.StatusOK || sessionCookie(w) != nil {
+		t.Errorf("old session in grace: %d, cookie %+v", w.Code, sessionCookie(w))
+	}
+	s.sessions.rotateEvery = 0
+
+	// Expired sessions are refused, then purged
+	db.Exec("UPDATE link_sessions SET expires_at = 1 WHERE id = ?", hashToken(next.Value))
+	if w := get("/api/v1/state", next.Value); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired session: %d", w.Code)
+	}
+	if n, err := s.db.PurgeLinkSessions(time.Now().UnixMilli()); err != nil || n != 1 {
+		t.Errorf("purged %d, %v", n, err)
+	}
+
+	// The link's token still works, for scripts
+	if w := get("/api/v1/state", link.Token); w.Code != http.StatusOK || sessionCookie(w) != nil {
+		t.Errorf("link token: %d, cookie %+v", w.Code, sessionCookie(w))
+	}
+}
+
+func TestWebSocketSessionUpgrade(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Smith", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+
+	// The app, still on its link's token, is moved onto a session
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?hello=1", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]any{"type": "hello", "protocol_version": protocolVersion})
+	msg := skipUntilType(t, conn, "token_rotated")
+	token, _ := msg["token"].(string)
+	if got, err := s.db.ValidateAccessLink(token); err != nil || got.sess == nil || got.sess.deviceID == "" {
+		t.Errorf("upgraded to %+v, %v", got, err)
+	}
+	var device bool
+	for _, c := range resp.Cookies() {
+		device = device || c.Name == "client_device"
+	}
+	if !device {
+		t.Error("no device cookie")
+	}
+}
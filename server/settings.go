@@ -0,0 +1,249 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	_ "time/tzdata" // the runtime image has no zoneinfo
+)
+
+// FamilySettings holds per-family server-side options. Zero values mean
+// "use the default", so new fields can be added without a migration.
+type FamilySettings struct {
+	FeverThresholdC float64 `json:"fever_threshold_c,omitempty"`
+	WebhookURL      string  `json:"webhook_url,omitempty"`
+	MinWetPerDay    int     `json:"min_wet_per_day,omitempty"`
+	MinDirtyPerDay  int     `json:"min_dirty_per_day,omitempty"`
+	BirthDate       string  `json:"birth_date,omitempty"` // YYYY-MM-DD
+	Locale          string  `json:"locale,omitempty"`     // report language, e.g. "de"
+	Timezone        string  `json:"timezone,omitempty"`   // IANA name, e.g. "Europe/London"; default UTC
+
+	// Quota overrides; 0 uses the server default and -1 means unlimited.
+	MaxEntriesPerDay int `json:"max_entries_per_day,omitempty"`
+	MaxDataMB        int `json:"max_data_mb,omitempty"`
+	MaxLinks         int `json:"max_links,omitempty"`
+
+	// Lifecycle overrides in days without entries; 0 uses the server
+	// policy and -1 never. See lifecycle.go.
+	InactiveWarnDays    int `json:"inactive_warn_days,omitempty"`
+	InactiveArchiveDays int `json:"inactive_archive_days,omitempty"`
+	InactivePurgeDays   int `json:"inactive_purge_days,omitempty"`
+
+	Push []PushTarget `json:"push,omitempty"` // see push.go
+
+	// Feed reminder interval in minutes, -1 to learn it from recent feeds
+	// or 0 for none; see reminders.go.
+	FeedReminderMin int `json:"feed_reminder_min,omitempty"`
+	// Minutes past a feed reminder's due time without a feed before a
+	// feed_overdue alert, or 0 for none; see reminders.go.
+	FeedEscalateMin int `json:"feed_escalate_min,omitempty"`
+	// Hour of the day the daily summary is pushed, in Timezone; 0 is 7.
+	DailySummaryHour int `json:"daily_summary_hour,omitempty"`
+
+	// The device the family relies on, alerted about as sync_failure once
+	// it has missed entries for SyncFailureMin (0 is 60); see devices.go.
+	PrimaryDevice  string `json:"primary_device,omitempty"`
+	SyncFailureMin int    `json:"sync_failure_min,omitempty"`
+
+	SMS *SMSSettings `json:"sms,omitempty"` // see sms.go
+
+	// Quiet hours, "HH:MM" in Timezone; see quiet.go.
+	QuietStart     string          `json:"quiet_start,omitempty"`
+	QuietEnd       string          `json:"quiet_end,omitempty"`
+	QuietOverrides map[string]bool `json:"quiet_overrides,omitempty"` // kind → sent anyway
+}
+
+const (
+	defaultFeverThresholdC = 38.0
+	defaultMinWetPerDay    = 6 // fewer wet nappies than this is a dehydration sign
+)
+
+// FeverThreshold returns the temperature (°C) at or above which a reading
+// raises a fever alert.
+func (fs FamilySettings) FeverThreshold() float64 {
+	if fs.FeverThresholdC == 0 {
+		return defaultFeverThresholdC
+	}
+	return fs.FeverThresholdC
+}
+
+// NappyThresholds returns the minimum wet and dirty nappies per day below
+// which a day is flagged. A dirty minimum of 0 disables that check, since
+// older breastfed babies can go days without a dirty nappy.
+func (fs FamilySettings) NappyThresholds() (wet, dirty int) {
+	wet = fs.MinWetPerDay
+	if wet == 0 {
+		wet = defaultMinWetPerDay
+	}
+	return wet, fs.MinDirtyPerDay
+}
+
+// AgeWeeks returns the child's age in whole weeks at now, or false if the
+// birth date isn't set.
+func (fs FamilySettings) AgeWeeks(now time.Time) (int, bool) {
+	born, err := time.ParseInLocation("2006-01-02", fs.BirthDate, now.Location())
+	if err != nil {
+		return 0, false
+	}
+	return max(0, int(now.Sub(born).Hours()/(24*7))), true
+}
+
+// SummaryHour returns the hour of the day the daily summary is pushed.
+func (fs FamilySettings) SummaryHour() int {
+	if fs.DailySummaryHour == 0 {
+		return defaultDailySummaryHour
+	}
+	return fs.DailySummaryHour
+}
+
+// Location returns the family's timezone, where its days start and end for
+// rollups and analytics.
+func (fs FamilySettings) Location() *time.Location {
+	if loc, err := time.LoadLocation(fs.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// validate returns per-field problems, or nil if the settings are usable.
+func (fs FamilySettings) validate() map[string]string {
+	fields := map[string]string{}
+	if fs.FeverThresholdC != 0 && (fs.FeverThresholdC < 36 || fs.FeverThresholdC > 42) {
+		fields["fever_threshold_c"] = "must be between 36 and 42"
+	}
+	if fs.MinWetPerDay < 0 || fs.MinWetPerDay > 20 {
+		fields["min_wet_per_day"] = "must be between 0 and 20"
+	}
+	if fs.MinDirtyPerDay < 0 || fs.MinDirtyPerDay > 20 {
+		fields["min_dirty_per_day"] = "must be between 0 and 20"
+	}
+	if fs.BirthDate != "" {
+		if _, err := time.Parse("2006-01-02", fs.BirthDate); err != nil {
+			fields["birth_date"] = "invalid format (use YYYY-MM-DD)"
+		}
+	}
+	for name, v := range map[string]int{
+		"max_entries_per_day": fs.MaxEntriesPerDay, "max_data_mb": fs.MaxDataMB, "max_links": fs.MaxLinks,
+	} {
+		if v < -1 {
+			fields[name] = "must be -1 (unlimited), 0 (default) or a limit"
+		}
+	}
+	for name, v := range map[string]int{
+		"inactive_warn_days": fs.InactiveWarnDays, "inactive_archive_days": fs.InactiveArchiveDays, "inactive_purge_days": fs.InactivePurgeDays,
+	} {
+		if v < -1 || v > maxInactiveDays {
+			fields[name] = "must be -1 (never), 0 (default) or a number of days"
+		}
+	}
+	overrides := LifecyclePolicy{ArchiveDays: fs.InactiveArchiveDays, PurgeDays: fs.InactivePurgeDays}
+	if _, bad := fields["inactive_purge_days"]; !bad && !overrides.purgeAfterArchive() {
+		fields["inactive_purge_days"] = "must be more than inactive_archive_days"
+	}
+	if fs.Timezone != "" {
+		if _, err := time.LoadLocation(fs.Timezone); err != nil || fs.Timezone == "Local" {
+			fields["timezone"] = "unknown timezone (use an IANA name like Europe/London)"
+		}
+	}
+	if fs.FeedReminderMin < feedReminderAdaptive || fs.FeedReminderMin > maxFeedReminderMin {
+		fields["feed_reminder_min"] = fmt.Sprintf("must be -1 (learned), 0 (off) or up to %d minutes", maxFeedReminderMin)
+	}
+	if fs.FeedEscalateMin < 0 || fs.FeedEscalateMin > maxFeedReminderMin {
+		fields["feed_escalate_min"] = fmt.Sprintf("must be 0 (off) or up to %d minutes", maxFeedReminderMin)
+	} else if fs.FeedEscalateMin > 0 && fs.FeedReminderMin == 0 {
+		fields["feed_escalate_min"] = "needs feed_reminder_min"
+	}
+	if len(fs.PrimaryDevice) > 64 {
+		fields["primary_device"] = "must be a device ID"
+	}
+	if fs.SyncFailureMin < 0 || fs.SyncFailureMin > maxSyncFailureMin {
+		fields["sync_failure_min"] = fmt.Sprintf("must be up to %d minutes, or 0 for %d", maxSyncFailureMin, int(defaultSyncFailure/time.Minute))
+	}
+	if fs.DailySummaryHour < 0 || fs.DailySummaryHour > 23 {
+		fields["daily_summary_hour"] = "must be an hour from 1 to 23, or 0 for 7"
+	}
+	fs.validateQuiet(fields)
+	fs.validatePush(fields)
+	fs.validateSMS(fields)
+	if fs.Locale != "" && locales[fs.Locale] == nil {
+		fields["locale"] = "unsupported locale"
+	}
+	if fs.WebhookURL != "" {
+		u, err := url.Parse(fs.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fields["webhook_url"] = "must be an http(s) URL"
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+func (db *DB) GetFamilySettings(familyID string) (FamilySettings, error) {
+	var fs FamilySettings
+	var data sql.NullString
+	if err := db.QueryRow("SELECT settings FROM families WHERE id = ?", familyID).Scan(&data); err != nil {
+		return fs, err
+	}
+	if data.Valid {
+		if err := json.Unmarshal([]byte(data.String), &fs); err != nil {
+			return fs, err
+		}
+	}
+	return fs, nil
+}
+
+func (db *DB) SaveFamilySettings(familyID string, fs FamilySettings) error {
+	data, err := json.Marshal(fs)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec("UPDATE families SET settings = ? WHERE id = ?", string(data), familyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Server) getFamilySettings(w http.ResponseWriter, r *http.Request) {
+	fs, err := s.db.GetFamilySettings(r.PathValue("id"))
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to get family settings", err)
+		return
+	}
+	jsonOK(w, fs)
+}
+
+// updateFamilySettings replaces a family's settings wholesale.
+func (s *Server) updateFamilySettings(w http.ResponseWriter, r *http.Request) {
+	var fs FamilySettings
+	if err := json.NewDecoder(r.Body).Decode(&fs); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	if fields := fs.validate(); fields != nil {
+		validationError(w, fields)
+		return
+	}
+	err := s.db.SaveFamilySettings(r.PathValue("id"), fs)
+	if err == sql.ErrNoRows {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+	if err != nil {
+		serverError(w, "failed to save family settings", err)
+		return
+	}
+	jsonOK(w, fs)
+}
@@ -0,0 +1,177 @@
+package babytrack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Share snapshots are signed, expiring URLs to a read-only page showing
+// one day's summary, for relatives who shouldn't get a live access link.
+// Nothing is stored per share: the URL carries the family, day and expiry,
+// and an HMAC over them made with a key kept in server_secrets.
+
+const (
+	defaultShareTTL = 48 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+)
+
+// Secret returns the named server key, generating it on first use.
+func (db *DB) Secret(name string) ([]byte, error) {
+	if _, err := db.Exec(
+		"INSERT OR IGNORE INTO server_secrets (name, value) VALUES (?, ?)", name, generateToken(32),
+	); err != nil {
+		return nil, err
+	}
+	var value string
+	err := db.QueryRow("SELECT value FROM server_secrets WHERE name = ?", name).Scan(&value)
+	return []byte(value), err
+}
+
+func shareSignature(key []byte, familyID, date string, offset int, exp int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%d", familyID, date, offset, exp)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sharePath builds the signed path for a family's day.
+func (s *Server) sharePath(familyID, date string, offset int, exp time.Time) (string, error) {
+	key, err := s.db.Secret("share")
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"offset": {strconv.Itoa(offset)},
+		"exp":    {strconv.FormatInt(exp.Unix(), 10)},
+		"sig":    {shareSignature(key, familyID, date, offset, exp.Unix())},
+	}
+	return "/share/" + familyID + "/" + date + "?" + q.Encode(), nil
+}
+
+type shareRequest struct {
+	Date     string  `json:"date"`      // YYYY-MM-DD, default today
+	Offset   int     `json:"offset"`    // minutes east of UTC
+	TTLHours float64 `json:"ttl_hours"` // default 48, max 720
+}
+
+// createShare writes a new share link for familyID from a shareRequest body.
+func (s *Server) createShare(w http.ResponseWriter, r *http.Request, familyID string) {
+	var req shareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	fields := map[string]string{}
+	loc := time.FixedZone("client", req.Offset*60)
+	if req.Date == "" {
+		req.Date = time.Now().In(loc).Format("2006-01-02")
+	} else if _, err := time.ParseInLocation("2006-01-02", req.Date, loc); err != nil {
+		fields["date"] = "invalid format (use YYYY-MM-DD)"
+	}
+	ttl := defaultShareTTL
+	if req.TTLHours != 0 {
+		ttl = time.Duration(req.TTLHours * float64(time.Hour))
+		if ttl <= 0 || ttl > maxShareTTL {
+			fields["ttl_hours"] = "must be between 0 and 720"
+		}
+	}
+	if len(fields) > 0 {
+		validationError(w, fields)
+		return
+	}
+	if _, err := s.db.GetFamily(familyID); err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+
+	exp := time.Now().Add(ttl)
+	path, err := s.sharePath(familyID, req.Date, req.Offset, exp)
+	if err != nil {
+		serverError(w, "failed to sign share link", err)
+		return
+	}
+	jsonCreated(w, map[string]any{"path": path, "expires_at": exp.UnixMilli()})
+}
+
+// adminCreateShare serves POST /admin/families/{id}/share.
+func (s *Server) adminCreateShare(w http.ResponseWriter, r *http.Request) {
+	s.createShare(w, r, r.PathValue("id"))
+}
+
+// handleCreateShare serves POST /api/v1/share for the caller's family.
+func (s *Server) handleCreateShare(w http.ResponseWriter, r *http.Request) {
+	s.createShare(w, r, accessLinkFrom(r.Context()).FamilyID)
+}
+
+type sharePage struct {
+	Family  string
+	Summary *DailySummary
+	Expires string
+}
+
+// handleShare serves GET /share/{family}/{date}: the read-only page.
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	familyID, date := r.PathValue("family"), r.PathValue("date")
+	q := r.URL.Query()
+	offset, err1 := strconv.Atoi(q.Get("offset"))
+	exp, err2 := strconv.ParseInt(q.Get("exp"), 10, 64)
+	key, err := s.db.Secret("share")
+	if err != nil {
+		serverError(w, "failed to load share key", err)
+		return
+	}
+	if err1 != nil || err2 != nil ||
+		!hmac.Equal([]byte(q.Get("sig")), []byte(shareSignature(key, familyID, date, offset, exp))) {
+		http.Error(w, "This link is not valid.", http.StatusNotFound)
+		return
+	}
+	if time.Now().Unix() > exp {
+		http.Error(w, "This link has expired.", http.StatusGone)
+		return
+	}
+
+	family, err := s.db.GetFamily(familyID)
+	if err != nil || family.Archived {
+		http.Error(w, "This link is not valid.", http.StatusNotFound)
+		return
+	}
+	loc := time.FixedZone("client", offset*60)
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		http.Error(w, "This link is not valid.", http.StatusNotFound)
+		return
+	}
+	settings, _ := s.db.GetFamilySettings(familyID)
+	locale := resolveLocale(r, settings.Locale)
+	summary, err := s.dailySummary(familyID, "", day, locale)
+	if err != nil {
+		serverError(w, "failed to build summary", err)
+		return
+	}
+
+	tmpl, err := template.ParseFiles(s.staticPath("share.html"))
+	if err != nil {
+		serverError(w, "failed to load share page", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	page := sharePage{
+		Family:  family.Name,
+		Summary: summary,
+		Expires: locale.FormatDate(time.Unix(exp, 0).In(loc)) + " " + locale.FormatTime(time.Unix(exp, 0).In(loc)),
+	}
+	if err := tmpl.Execute(w, page); err != nil {
+		slog.Error("failed to render share page", "error", err)
+	}
+}
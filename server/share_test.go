@@ -0,0 +1,80 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareSnapshot(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Baby <Smith>", "")
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	day := time.Date(2026, 1, 25, 0, 0, 0, 0, time.UTC)
+	for _, e := range []*Entry{
+		{ID: "f1", Ts: day.Add(9 * time.Hour).UnixMilli(), Type: "feed", Value: "bf"},
+		{ID: "n1", Ts: day.Add(10 * time.Hour).UnixMilli(), Type: "nappy", Value: "wet"},
+	} {
+		e.FamilyID = family.ID
+		s.db.UpsertEntry(e)
+	}
+
+	create := func(body string) (int, string) {
+		req := httptest.NewRequest("POST", "/admin/families/"+family.ID+"/share", strings.NewReader(body))
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.adminCreateShare(w, req)
+		var resp struct{ Path string }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Path
+	}
+	fetch := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, path := create(`{"date":"2026-01-25","offset":0}`)
+	if code != http.StatusCreated {
+		t.Fatalf("create status %d", code)
+	}
+	code, body := fetch(path)
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %s", code, body)
+	}
+	for _, want := range []string{"Baby &lt;Smith&gt;", "Sunday 25 January 2026", "09:00"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page missing %q", want)
+		}
+	}
+
+	if code, _ := fetch(strings.Replace(path, "2026-01-25", "2026-01-24", 1)); code != http.StatusNotFound {
+		t.Errorf("tampered date: got %d, want 404", code)
+	}
+	if code, _ := fetch(path[:len(path)-2] + "xx"); code != http.StatusNotFound {
+		t.Errorf("tampered signature: got %d, want 404", code)
+	}
+
+	exp := time.Now().Add(-time.Minute)
+	expired, _ := s.sharePath(family.ID, "2026-01-25", 0, exp)
+	if code, _ := fetch(expired); code != http.StatusGone {
+		t.Errorf("expired: got %d, want 410", code)
+	}
+
+	for _, bad := range []string{`{"date":"25/01/2026"}`, `{"ttl_hours":1000}`} {
+		if code, _ := create(bad); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", bad, code)
+		}
+	}
+}
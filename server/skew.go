@@ -0,0 +1,162 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Devices stamp entries with their own clock, so one that is out skews every
+// summary it contributes to. The server estimates each connection's clock
+// offset from the client_time in its hello and pings, and from entries
+// logged ahead of the server's clock (people back-date entries, but never
+// log the future). A connection whose recent samples are consistently out
+// is sent time_skew, flagged in presence and the admin activity feed.
+// Init and pong carry server_time so clients can correct themselves.
+
+const (
+	// maxClockSkew is how far out a device's clock may be before it is
+	// flagged; below it, network delay and sloppy tapping dominate.
+	maxClockSkew = 2 * time.Minute
+
+	skewSamples    = 5 // recent samples kept per connection
+	minSkewSamples = 3 // samples needed before flagging
+)
+
+// clockSkew estimates a connection's clock offset. Only its readPump
+// touches it.
+type clockSkew struct {
+	samples []int64 // client minus server time, ms
+	flagged bool
+}
+
+// add records a sample, returning the estimated offset and whether the
+// connection has just become skewed or stopped being so. The estimate is
+// the median of recent samples, so one odd sample doesn't flip it.
+func (k *clockSkew) add(offset int64) (skew int64, changed bool) {
+	k.samples = append(k.samples, offset)
+	if len(k.samples) > skewSamples {
+		k.samples = k.samples[1:]
+	}
+	if len(k.samples) < minSkewSamples {
+		return 0, false
+	}
+	sorted := slices.Clone(k.samples)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+	skewed := median > maxClockSkew.Milliseconds() || median < -maxClockSkew.Milliseconds()
+	changed = skewed != k.flagged
+	k.flagged = skewed
+	if !skewed {
+		return 0, changed
+	}
+	return median, changed
+}
+
+// noteClientTime records that c's clock read clientTime just now.
+func (c *Client) noteClientTime(clientTime int64) {
+	c.noteSkew(clientTime - time.Now().UnixMilli())
+}
+
+// noteEntryTime records an entry c logged at ts, if it is in the future.
+func (c *Client) noteEntryTime(ts int64) {
+	if offset := ts - time.Now().UnixMilli(); offset > maxClockSkew.Milliseconds() {
+		c.noteSkew(offset)
+	}
+}
+
+func (c *Client) noteSkew(offset int64) {
+	skew, changed := c.skew.add(offset)
+	if !changed {
+		return
+	}
+	c.skewMs.Store(skew)
+	msg, _ := json.Marshal(map[string]any{
+		"type":        "time_skew",
+		"offset_ms":   skew,
+		"server_time": time.Now().UnixMilli(),
+	})
+	c.send <- msg
+
+	if skew != 0 {
+		c.log().Warn("client clock skewed", "offset_ms", skew)
+		c.hub.publishActivity(ActivityEvent{
+			Type: "warning", FamilyID: c.familyID, Label: c.linkLabel(),
+			Message: "device clock is " + describeSkew(skew),
+		})
+	}
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+	if c.hub.families[c.familyID][c] {
+		c.hub.broadcastPresenceLocked(c.familyID)
+	}
+}
+
+// describeSkew writes an offset as e.g. "7m ahead".
+func describeSkew(ms int64) string {
+	dir := "ahead"
+	if ms < 0 {
+		ms, dir = -ms, "behind"
+	}
+	d := time.Duration(ms) * time.Millisecond
+	if d >= time.Hour {
+		return fmt.Sprintf("%.1fh %s", d.Hours(), dir)
+	}
+	return fmt.Sprintf("%dm %s", int(d.Minutes()), dir)
+}
+
+// DeviceDiagnostics is a connected device as the admin sees it.
+type DeviceDiagnostics struct {
+	LinkID string `json:"link_id"`
+	PresenceDevice
+	// AckedCursor is the lowest cursor the link's connections have
+	// acknowledged: devices sharing a link overwrite each other's stored
+	// ack, so the one furthest behind only shows here. Behind counts the
+	// family's changes since.
+	AckedCursor int64     `json:"acked_cursor"`
+	Behind      int64     `json:"behind"`
+	Send        SendStats `json:"send"` // summed over the link's connections
+}
+
+// Devices returns the family's connected devices, one per access link.
+func (h *Hub) Devices(familyID string) []DeviceDiagnostics {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	byLink := h.presenceDevicesLocked(familyID)
+	devices := make([]DeviceDiagnostics, 0, len(byLink))
+	byKey := make(map[string]*DeviceDiagnostics, len(byLink))
+	for id, d := range byLink {
+		devices = append(devices, DeviceDiagnostics{LinkID: id, PresenceDevice: *d, AckedCursor: -1})
+	}
+	for i := range devices {
+		byKey[devices[i].LinkID] = &devices[i]
+	}
+	for c := range h.families[familyID] {
+		key := c.linkID
+		if key == "" {
+			key = c.linkLabel()
+		}
+		d := byKey[key]
+		if ack := c.ackedCursor.Load(); d.AckedCursor < 0 || ack < d.AckedCursor {
+			d.AckedCursor = ack
+		}
+		d.Send.add(c)
+	}
+	slices.SortFunc(devices, func(a, b DeviceDiagnostics) int { return strings.Compare(a.Label, b.Label) })
+	return devices
+}
+
+// listDevices handles GET /admin/families/{id}/devices.
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	devices := s.hub.Devices(familyID)
+	if seq, err := s.db.FamilySeq(familyID); err == nil {
+		for i := range devices {
+			devices[i].Behind = max(seq-devices[i].AckedCursor, 0)
+		}
+	}
+	jsonOK(w, devices)
+}
@@ -0,0 +1,94 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestClockSkewEstimate(t *testing.T) {
+	var k clockSkew
+	ahead := 7 * time.Minute.Milliseconds()
+	for i, tc := range []struct {
+		offset  int64
+		skew    int64
+		changed bool
+	}{
+		{ahead, 0, false}, // too few samples
+		{ahead, 0, false},
+		{200, ahead, true}, // mostly out
+		{ahead, ahead, false},
+		{0, ahead, false}, // one good sample doesn't clear it
+		{0, 0, true},
+	} {
+		skew, changed := k.add(tc.offset)
+		if skew != tc.skew || changed != tc.changed {
+			t.Errorf("sample %d: got %d %v, want %d %v", i, skew, changed, tc.skew, tc.changed)
+		}
+	}
+
+	if got := describeSkew(-90 * time.Minute.Milliseconds()); got != "1.5h behind" {
+		t.Errorf("describeSkew = %q", got)
+	}
+}
+
+func TestClockSkewWebSocket(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Dad", nil)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?hello=1", header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	ahead := 10 * time.Minute
+	conn.WriteJSON(map[string]any{"type": "hello", "protocol_version": 1, "client_time": time.Now().Add(ahead).UnixMilli()})
+	if m := skipUntilType(t, conn, "init"); m["server_time"] == nil {
+		t.Errorf("init without server_time: %v", m)
+	}
+
+	// A ping's clock and an entry logged in the future make three samples
+	conn.WriteJSON(map[string]any{"type": "ping", "client_time": time.Now().Add(ahead).UnixMilli()})
+	if m := skipUntilType(t, conn, "pong"); m["server_time"] == nil {
+		t.Errorf("pong without server_time: %v", m)
+	}
+	conn.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "e1", "ts": time.Now().Add(ahead).UnixMilli(), "type": "feed", "value": "bf"}})
+	m := skipUntilType(t, conn, "time_skew")
+	if offset := m["offset_ms"].(float64); offset < float64((ahead - time.Minute).Milliseconds()) {
+		t.Errorf("offset_ms = %v", offset)
+	}
+	if m := skipUntilType(t, conn, "presence"); !strings.Contains(mustJSON(m), "clock_skew_ms") {
+		t.Errorf("presence without skew: %v", m)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/devices", nil)
+	req.SetPathValue("id", family.ID)
+	w := httptest.NewRecorder()
+	s.listDevices(w, req)
+	var devices []DeviceDiagnostics
+	json.Unmarshal(w.Body.Bytes(), &devices)
+	if len(devices) != 1 || devices[0].LinkID != link.ID || devices[0].ClockSkewMs == 0 {
+		t.Errorf("devices = %s", w.Body)
+	}
+}
+
+func mustJSON(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,188 @@
+package babytrack
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SMS is for the alerts that mustn't wait for someone to look at a phone:
+// a fever, the family's primary device falling out of sync (see
+// devices.go), and a feed long overdue (see reminders.go). The server sends
+// through Twilio with the operator's account, so each family chooses only
+// the numbers and events, and is capped at max_per_day messages a day, one
+// per number an alert goes to, and one alert of each kind per smsKindGap,
+// counted in the database across instances. Alerts over a cap are logged
+// and dropped; they still reach the app, the webhook and push targets.
+
+const (
+	maxSMSNumbers    = 5
+	defaultSMSPerDay = 5
+	maxSMSPerDay     = 50
+	smsKindGap       = 30 * time.Minute
+	maxSMSLen        = 320 // two segments
+	defaultTwilioAPI = "https://api.twilio.com"
+)
+
+// SMSSender sends a text message. babytrackd sends through Twilio when
+// TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM are set; embedders
+// can supply their own in Options.
+type SMSSender interface {
+	SendSMS(to, body string) error
+}
+
+// twilioSender sends with Twilio's Messages API.
+type twilioSender struct {
+	api        string
+	accountSID string
+	authToken  string
+	from       string
+}
+
+func newTwilioSender(accountSID, authToken, from string) (*twilioSender, error) {
+	if accountSID == "" || authToken == "" {
+		return nil, errors.New("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are both required")
+	}
+	if !phoneNumberRe.MatchString(from) && !strings.HasPrefix(from, "MG") {
+		return nil, errors.New("TWILIO_FROM must be an E.164 number or a messaging service SID")
+	}
+	return &twilioSender{api: defaultTwilioAPI, accountSID: accountSID, authToken: authToken, from: from}, nil
+}
+
+func (t *twilioSender) SendSMS(to, body string) error {
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(t.from, "MG") {
+		form.Set("MessagingServiceSid", t.from)
+	} else {
+		form.Set("From", t.from)
+	}
+	req, err := http.NewRequest(http.MethodPost,
+		t.api+"/2010-04-01/Accounts/"+url.PathEscape(t.accountSID)+"/Messages.json",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.accountSID, t.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doPush(req)
+}
+
+// SMSSettings are where and how often a family's alerts are texted.
+type SMSSettings struct {
+	To        []string `json:"to"`                    // E.164, e.g. +61400000000
+	Events    []string `json:"events,omitempty"`      // from smsEvents; empty for all
+	MaxPerDay int      `json:"max_per_day,omitempty"` // 0 is defaultSMSPerDay
+}
+
+// smsEvents are the alerts that can be texted.
+var smsEvents = map[string]bool{"fever": true, "sync_failure": true, "feed_overdue": true}
+
+var phoneNumberRe = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+func (sms *SMSSettings) wants(kind string) bool {
+	if sms == nil || len(sms.To) == 0 || !smsEvents[kind] {
+		return false
+	}
+	return len(sms.Events) == 0 || slices.Contains(sms.Events, kind)
+}
+
+func (sms *SMSSettings) perDay() int {
+	if sms.MaxPerDay == 0 {
+		return defaultSMSPerDay
+	}
+	return sms.MaxPerDay
+}
+
+// textAlert texts the alert to the family's numbers if it takes its kind
+// and the caps allow.
+func (s *Server) textAlert(settings FamilySettings, a Alert) {
+	sms := settings.SMS
+	if s.opts.SMS == nil || !sms.wants(a.Kind) {
+		return
+	}
+	ok, err := s.db.claimSMS(a.FamilyID, a.Kind, len(sms.To), sms.perDay(), time.UnixMilli(a.Ts))
+	if err != nil {
+		slog.Error("failed to claim sms", "error", err, "family_id", a.FamilyID)
+		return
+	}
+	if !ok {
+		slog.Warn("sms alert over rate cap", "family_id", a.FamilyID, "kind", a.Kind)
+		return
+	}
+	body := a.Message
+	if f, err := s.db.GetFamily(a.FamilyID); err == nil {
+		body = f.Name + ": " + body
+	}
+	if r := []rune(body); len(r) > maxSMSLen {
+		body = string(r[:maxSMSLen-1]) + "…"
+	}
+	for _, to := range sms.To {
+		go func() {
+			if err := s.opts.SMS.SendSMS(to, body); err != nil {
+				slog.Warn("sms delivery failed", "error", err, "family_id", a.FamilyID, "kind", a.Kind)
+			}
+		}()
+	}
+}
+
+// claimSMS records an alert of kind texted to the family at now as
+// messages texts, unless that would take it over perDay texts in the last
+// day or be within smsKindGap of another alert of the kind.
+func (db *DB) claimSMS(familyID, kind string, messages, perDay int, now time.Time) (bool, error) {
+	at := now.UnixMilli()
+	res, err := db.Exec(
+		`INSERT INTO sms_sent (family_id, kind, sent_at, messages)
+		 SELECT ?, ?, ?, ?
+		 WHERE (SELECT COALESCE(SUM(messages), 0) FROM sms_sent WHERE family_id = ? AND sent_at > ?) + ? <= ?
+		   AND NOT EXISTS (SELECT 1 FROM sms_sent WHERE family_id = ? AND kind = ? AND sent_at > ?)`,
+		familyID, kind, at, messages,
+		familyID, at-(24*time.Hour).Milliseconds(), messages, perDay,
+		familyID, kind, at-smsKindGap.Milliseconds(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if n == 1 {
+		_, err = db.Exec("DELETE FROM sms_sent WHERE family_id = ? AND sent_at < ?", familyID, at-(48*time.Hour).Milliseconds())
+	}
+	return n == 1, err
+}
+
+// validateSMS adds SMS settings problems to fields.
+func (fs FamilySettings) validateSMS(fields map[string]string) {
+	sms := fs.SMS
+	if sms == nil {
+		return
+	}
+	if len(sms.To) > maxSMSNumbers {
+		fields["sms"] = fmt.Sprintf("at most %d numbers", maxSMSNumbers)
+		return
+	}
+	for _, n := range sms.To {
+		if !phoneNumberRe.MatchString(n) {
+			fields["sms"] = fmt.Sprintf("%q isn't an E.164 number, e.g. +61400000000", n)
+			return
+		}
+	}
+	for _, e := range sms.Events {
+		if !smsEvents[e] {
+			fields["sms"] = fmt.Sprintf("unknown event %q (use fever, sync_failure or feed_overdue)", e)
+			return
+		}
+	}
+	if sms.MaxPerDay < 0 || sms.MaxPerDay > maxSMSPerDay {
+		fields["sms"] = fmt.Sprintf("max_per_day must be up to %d, or 0 for %d", maxSMSPerDay, defaultSMSPerDay)
+		return
+	}
+	if sms.perDay() < len(sms.To) {
+		// An alert is a text to each number, so none would ever be sent
+		fields["sms"] = fmt.Sprintf("max_per_day must be at least the %d numbers", len(sms.To))
+	}
+}
@@ -0,0 +1,151 @@
+package babytrack
+
+import (
+	"cmp"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type smsSent struct{ to, body string }
+
+type fakeSMS chan smsSent
+
+func (f fakeSMS) SendSMS(to, body string) error {
+	f <- smsSent{to, body}
+	return nil
+}
+
+// texts collects what's sent within a moment, sorted.
+func (f fakeSMS) texts() []smsSent {
+	var got []smsSent
+	for {
+		select {
+		case m := <-f:
+			got = append(got, m)
+		case <-time.After(100 * time.Millisecond):
+			slices.SortFunc(got, func(a, b smsSent) int {
+				return cmp.Or(strings.Compare(a.body, b.body), strings.Compare(a.to, b.to))
+			})
+			return got
+		}
+	}
+}
+
+func TestTwilioSender(t *testing.T) {
+	var got *http.Request
+	twilio := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer twilio.Close()
+
+	sender, err := newTwilioSender("AC123", "secret", "+15005550006")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.api = twilio.URL
+	if err := sender.SendSMS("+61400000000", "Smith: Temperature 38.5°C"); err != nil {
+		t.Fatal(err)
+	}
+	user, pass, _ := got.BasicAuth()
+	if got.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" || user != "AC123" || pass != "secret" ||
+		got.PostForm.Get("To") != "+61400000000" || got.PostForm.Get("From") != "+15005550006" ||
+		got.PostForm.Get("Body") != "Smith: Temperature 38.5°C" {
+		t.Errorf("request = %s %v %v", got.URL.Path, got.Header, got.PostForm)
+	}
+	if _, err := newTwilioSender("AC123", "secret", "0400 000 000"); err == nil {
+		t.Error("local from number accepted")
+	}
+}
+
+func TestSMSAlerts(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	sms := make(fakeSMS, 20)
+	s := &Server{db: db, hub: NewHub(db), opts: Options{SMS: sms}}
+
+	family, _ := db.CreateFamily("Smith", "")
+	numbers := []string{"+61400000000", "+61400000001", "+61400000002"}
+	settings := FamilySettings{SMS: &SMSSettings{To: numbers, MaxPerDay: 6}}
+	if fields := settings.validate(); fields != nil {
+		t.Fatalf("valid settings rejected: %v", fields)
+	}
+	db.SaveFamilySettings(family.ID, settings)
+	now := time.Now()
+	alert := func(kind string, at time.Time) {
+		s.sendAlert(Alert{FamilyID: family.ID, Kind: kind, Message: kind + " alert", Ts: at.UnixMilli()})
+	}
+
+	// Each number gets it; the same kind again soon after, an alert that
+	// isn't texted, and anything over the day's cap of texts (not alerts)
+	// don't go
+	alert("fever", now)
+	if got := sms.texts(); len(got) != 3 || got[0] != (smsSent{"+61400000000", "Smith: fever alert"}) {
+		t.Errorf("texted %v", got)
+	}
+	alert("fever", now.Add(10*time.Minute))
+	alert("inactive", now.Add(11*time.Minute))
+	alert("sync_failure", now.Add(12*time.Minute))
+	alert("feed_overdue", now.Add(13*time.Minute))
+	if got := sms.texts(); len(got) != 3 || got[0].body != "Smith: sync_failure alert" || got[2].to != numbers[2] {
+		t.Errorf("texted %v", got)
+	}
+
+	for _, bad := range []*SMSSettings{
+		{To: []string{"0400 000 000"}},
+		{To: []string{"+61400000000"}, Events: []string{"inactive"}},
+		{To: []string{"+61400000000"}, MaxPerDay: 500},
+		{To: numbers, MaxPerDay: 2},
+	} {
+		if (FamilySettings{SMS: bad}).validate()["sms"] == "" {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+}
+
+func TestHighPriorityAlerts(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	sms := make(fakeSMS, 20)
+	s := &Server{db: db, hub: NewHub(db), opts: Options{SMS: sms}}
+
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	family, _ := db.CreateFamily("Smith", "")
+	link, _ := db.CreateAccessLinkWith(family.ID, "Cot tablet", roleFull, allPermissions, nil)
+	token, _ := db.CreateDevice(link, "android", now.Add(-2*time.Hour).UnixMilli())
+	db.SaveFamilySettings(family.ID, FamilySettings{
+		FeedReminderMin: 180,
+		FeedEscalateMin: 60,
+		PrimaryDevice:   hashToken(token),
+		SMS:             &SMSSettings{To: []string{"+61400000000"}},
+	})
+	// Fed 4h 10m ago, from another phone after the tablet was last seen
+	db.UpsertEntry(&Entry{ID: generateToken(8), FamilyID: family.ID, Ts: now.Add(-250 * time.Minute).UnixMilli(), Type: "feed", Value: "bf"})
+	db.UpsertEntry(&Entry{ID: generateToken(8), FamilyID: family.ID, Ts: now.Add(-time.Hour).UnixMilli(), Type: "nappy", Value: "wet"})
+
+	s.sendReminders(now)
+	s.sendReminders(now.Add(time.Minute))
+	got := sms.texts()
+	if len(got) != 2 || got[0].body != "Smith: No feed logged for 4h 10m (due every 3h 0m)" ||
+		got[1].body != "Smith: Primary device (Cot tablet) hasn't synced for 2h 0m and has missed entries" {
+		t.Errorf("texted %v", got)
+	}
+
+	// Back in touch, then gone quiet again without anything to miss
+	db.TouchDevice(hashToken(token), now.Add(2*time.Minute).UnixMilli())
+	s.sendReminders(now.Add(4 * time.Hour))
+	if got := sms.texts(); len(got) != 0 {
+		t.Errorf("texted %v", got)
+	}
+}
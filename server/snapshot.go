@@ -0,0 +1,212 @@
+package babytrack
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// A new device's init carries the family's whole history, which only grows.
+// Instead, the server keeps a snapshot per family: its entries that aren't
+// deleted, as of a cursor. New clients fetch it over HTTP, then connect
+// with its cursor in their hello so init only carries the changes since.
+// A compactor refreshes snapshots of large families in the background;
+// others are built when first asked for, or when too far behind to be
+// worth resuming from.
+
+const (
+	// snapshotMaxLag is how many changes a snapshot may be behind its
+	// family before it is rebuilt, well short of maxResumeEntries so the
+	// init after it is still a resume.
+	snapshotMaxLag = 500
+
+	// snapshotMinEntries is the size of family the compactor keeps
+	// snapshots fresh for.
+	snapshotMinEntries = 1000
+)
+
+// Snapshot is a family's entries that aren't deleted, as of Cursor.
+type Snapshot struct {
+	FamilyID   string
+	Cursor     int64
+	CreatedAt  int64
+	EntryCount int
+	Entries    json.RawMessage // JSON array of Entry, ordered by seq
+}
+
+// BuildSnapshot materializes and stores the family's current snapshot.
+func (db *DB) BuildSnapshot(familyID string, now time.Time) (*Snapshot, error) {
+	// One read transaction, so the entries are exactly those up to the seq
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	snap := &Snapshot{FamilyID: familyID, CreatedAt: now.UnixMilli()}
+	if err := tx.QueryRow("SELECT COALESCE(seq, 0) FROM families WHERE id = ?", familyID).Scan(&snap.Cursor); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(
+		`SELECT `+entryColumns+` FROM entries WHERE family_id = ? AND deleted = 0 ORDER BY seq ASC`,
+		familyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	tx.Rollback()
+
+	snap.EntryCount = len(entries)
+	if snap.Entries, err = json.Marshal(entries); err != nil {
+		return nil, err
+	}
+	// Never replace a newer snapshot built concurrently
+	_, err = db.Exec(
+		`INSERT INTO snapshots (family_id, cursor, created_at, entry_count, entries) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(family_id) DO UPDATE SET
+		   cursor = excluded.cursor, created_at = excluded.created_at,
+		   entry_count = excluded.entry_count, entries = excluded.entries
+		 WHERE excluded.cursor >= snapshots.cursor`,
+		familyID, snap.Cursor, snap.CreatedAt, snap.EntryCount, []byte(snap.Entries),
+	)
+	return snap, err
+}
+
+// GetSnapshot returns the family's stored snapshot, or sql.ErrNoRows.
+func (db *DB) GetSnapshot(familyID string) (*Snapshot, error) {
+	snap := &Snapshot{FamilyID: familyID}
+	var entries []byte
+	err := db.QueryRow(
+		"SELECT cursor, created_at, entry_count, entries FROM snapshots WHERE family_id = ?",
+		familyID,
+	).Scan(&snap.Cursor, &snap.CreatedAt, &snap.EntryCount, &entries)
+	if err != nil {
+		return nil, err
+	}
+	snap.Entries = entries
+	return snap, nil
+}
+
+// StaleSnapshotFamilies returns families with at least minEntries entries
+// whose snapshot is missing or at least maxLag changes behind.
+func (db *DB) StaleSnapshotFamilies(minEntries, maxLag int) ([]string, error) {
+	rows, err := db.Query(
+		`SELECT f.id FROM families f
+		 LEFT JOIN snapshots s ON s.family_id = f.id
+		 WHERE f.archived = 0
+		   AND COALESCE(f.seq, 0) - COALESCE(s.cursor, 0) >= ?
+		   AND (SELECT COUNT(*) FROM entries e WHERE e.family_id = f.id AND e.deleted = 0) >= ?`,
+		maxLag, minEntries,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RunSnapshots refreshes large families' stale snapshots every interval
+// until ctx is done.
+func (s *Server) RunSnapshots(ctx context.Context, interval time.Duration) {
+	for {
+		if s.holdsLease("snapshots", 2*interval) {
+			s.compactSnapshots()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *Server) compactSnapshots() {
+	ids, err := s.db.StaleSnapshotFamilies(snapshotMinEntries, snapshotMaxLag)
+	if err != nil {
+		slog.Error("failed to find stale snapshots", "error", err)
+		return
+	}
+	for _, id := range ids {
+		start := time.Now()
+		snap, err := s.db.BuildSnapshot(id, start)
+		if err != nil {
+			slog.Error("failed to build snapshot", "family_id", id, "error", err)
+			continue
+		}
+		slog.Info("built snapshot", "family_id", id, "cursor", snap.Cursor, "entries", snap.EntryCount,
+			"bytes", len(snap.Entries), "duration_ms", time.Since(start).Milliseconds())
+	}
+}
+
+// familySnapshot returns a snapshot of the family recent enough to resume
+// from, building one if need be.
+func (s *Server) familySnapshot(familyID string) (*Snapshot, error) {
+	snap, err := s.db.GetSnapshot(familyID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if snap != nil {
+		seq, err := s.db.FamilySeq(familyID)
+		if err != nil {
+			return nil, err
+		}
+		if seq-snap.Cursor < snapshotMaxLag {
+			return snap, nil
+		}
+	}
+	return s.db.BuildSnapshot(familyID, time.Now())
+}
+
+// handleSnapshot handles GET /api/v1/snapshot?child=.
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	childID := r.URL.Query().Get("child")
+	if len(childID) > maxChildIDLen {
+		validationError(w, map[string]string{"child": errChildIDTooLong.Error()})
+		return
+	}
+	snap, err := s.familySnapshot(accessLinkFrom(r.Context()).FamilyID)
+	if err != nil {
+		serverError(w, "failed to get snapshot", err)
+		return
+	}
+
+	entries := snap.Entries
+	if childID != "" {
+		var all []Entry
+		if err := json.Unmarshal(snap.Entries, &all); err != nil {
+			serverError(w, "failed to read snapshot", err)
+			return
+		}
+		entries, _ = json.Marshal(entriesForChild(all, childID))
+	}
+	jsonOK(w, map[string]any{
+		"cursor":     snap.Cursor,
+		"created_at": snap.CreatedAt,
+		"entries":    entries,
+	})
+}
@@ -0,0 +1,69 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	ts := time.Now().UnixMilli()
+	for _, e := range []Entry{
+		{ID: "e1", Type: "feed"},
+		{ID: "e2", Type: "nappy", ChildID: "twin-a"},
+		{ID: "e3", Type: "sleep"},
+	} {
+		e.FamilyID, e.Ts = family.ID, ts
+		s.db.UpsertEntry(&e)
+	}
+	s.db.DeleteEntry(family.ID, "e3")
+
+	handler := s.routes()
+	get := func(query string) (int, map[string]any) {
+		req := httptest.NewRequest("GET", "/api/v1/snapshot"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "client_session", Value: link.Token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	// Built on first request, without deleted entries
+	code, resp := get("")
+	if code != http.StatusOK || resp["cursor"] != 4.0 || len(resp["entries"].([]any)) != 2 {
+		t.Fatalf("snapshot: %d %v", code, resp)
+	}
+	if _, resp := get("?child=twin-a"); len(resp["entries"].([]any)) != 1 {
+		t.Errorf("child snapshot: %v", resp)
+	}
+
+	// Served as stored until it falls too far behind
+	s.db.UpsertEntry(&Entry{ID: "e4", FamilyID: family.ID, Ts: ts, Type: "feed"})
+	if _, resp := get(""); resp["cursor"] != 4.0 {
+		t.Errorf("rebuilt early: %v", resp)
+	}
+	if ids, _ := s.db.StaleSnapshotFamilies(1, 1); len(ids) != 1 {
+		t.Errorf("stale families = %v", ids)
+	}
+	s.compactSnapshots() // families this small are left alone
+	if snap, _ := s.db.GetSnapshot(family.ID); snap.Cursor != 4 {
+		t.Errorf("compacted small family: %+v", snap)
+	}
+
+	// A newer snapshot isn't replaced by an older one
+	if _, err := s.db.BuildSnapshot(family.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	s.db.(*DB).Exec("UPDATE families SET seq = 1 WHERE id = ?", family.ID)
+	s.db.BuildSnapshot(family.ID, time.Now())
+	if snap, _ := s.db.GetSnapshot(family.ID); snap.Cursor != 5 || snap.EntryCount != 3 {
+		t.Errorf("snapshot = %+v", snap)
+	}
+}
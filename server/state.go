@@ -0,0 +1,109 @@
+package babytrack
+
+import (
+	"cmp"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+// The current state is what the baby is doing now: the latest entry of each
+// stateful category (e.g. sleep: sleeping) plus any ongoing duration
+// entries. Clients get it in init and whenever it changes, so a second
+// device shows the right toggles without replaying history.
+
+type ActivityState struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Value   string `json:"value"`
+	Since   int64  `json:"since"`
+	Ongoing bool   `json:"ongoing,omitempty"` // a started duration entry
+}
+
+type CurrentState struct {
+	Sleeping   bool            `json:"sleeping"`
+	Feeding    bool            `json:"feeding"`
+	Activities []ActivityState `json:"activities"` // by type, then start
+}
+
+// sleepValues are the sleep-category values that mean the baby is asleep.
+var sleepValues = map[string]bool{"sleeping": true, "nap": true}
+
+func currentState(db Store, familyID string) (*CurrentState, error) {
+	config, err := db.GetConfig(familyID)
+	if err != nil {
+		return nil, err
+	}
+	st := &CurrentState{Activities: []ActivityState{}}
+	for typ, ok := range statefulTypes(config) {
+		if !ok {
+			continue
+		}
+		e, err := db.GetLastEntry(familyID, typ, "")
+		if err != nil || isDuration(e) {
+			continue // nothing logged yet; durations are covered below
+		}
+		st.Activities = append(st.Activities, ActivityState{ID: e.ID, Type: e.Type, Value: e.Value, Since: e.Ts})
+		if typ == "sleep" && sleepValues[e.Value] {
+			st.Sleeping = true
+		}
+	}
+
+	ongoing, err := db.GetOngoingEntries(familyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range ongoing {
+		st.Activities = append(st.Activities, ActivityState{ID: e.ID, Type: e.Type, Value: e.Value, Since: e.Ts, Ongoing: true})
+		switch e.Type {
+		case "sleep":
+			st.Sleeping = true
+		case "feed":
+			st.Feeding = true
+		}
+	}
+
+	slices.SortFunc(st.Activities, func(a, b ActivityState) int {
+		return cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.Since, b.Since), cmp.Compare(a.ID, b.ID))
+	})
+	return st, nil
+}
+
+// rememberState records st as the family's last known state and reports
+// whether it differs from the previous one.
+func (h *Hub) rememberState(familyID string, st *CurrentState) bool {
+	data, _ := json.Marshal(st)
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+	if h.states[familyID] == string(data) {
+		return false
+	}
+	h.states[familyID] = string(data)
+	return true
+}
+
+// publishState broadcasts the family's current state to every client if it
+// changed since it was last sent.
+func (s *Server) publishState(familyID string) {
+	st, err := currentState(s.db, familyID)
+	if err != nil {
+		slog.Error("failed to compute current state", "error", err, "family_id", familyID)
+		return
+	}
+	if !s.hub.rememberState(familyID, st) {
+		return
+	}
+	msg, _ := json.Marshal(map[string]any{"type": "state", "state": st})
+	s.hub.Broadcast(familyID, msg, nil)
+}
+
+// handleState serves GET /api/v1/state for the caller's family.
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	st, err := currentState(s.db, accessLinkFrom(r.Context()).FamilyID)
+	if err != nil {
+		serverError(w, "failed to get current state", err)
+		return
+	}
+	jsonOK(w, st)
+}
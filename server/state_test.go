@@ -0,0 +1,105 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCurrentState(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+
+	st, err := currentState(db, family.ID)
+	if err != nil || st.Sleeping || st.Feeding || len(st.Activities) != 0 {
+		t.Fatalf("empty state = %+v, %v", st, err)
+	}
+
+	now := time.Now().UnixMilli()
+	for _, e := range []*Entry{
+		{ID: "s1", Ts: now - 3600000, Type: "sleep", Value: "awake"},
+		{ID: "s2", Ts: now - 600000, Type: "sleep", Value: "sleeping"},
+		{ID: "n1", Ts: now - 300000, Type: "nappy", Value: "wet"},
+		{ID: "f1", Ts: now - 60000, Type: "feed", Value: "bf", Ongoing: true},
+	} {
+		e.FamilyID = family.ID
+		db.UpsertEntry(e)
+	}
+	st, _ = currentState(db, family.ID)
+	if !st.Sleeping || !st.Feeding || len(st.Activities) != 2 {
+		t.Fatalf("state = %+v", st)
+	}
+	if a := st.Activities[0]; a.ID != "f1" || !a.Ongoing {
+		t.Errorf("feed activity = %+v", a)
+	}
+	if a := st.Activities[1]; a.ID != "s2" || a.Value != "sleeping" || a.Ongoing {
+		t.Errorf("sleep activity = %+v", a)
+	}
+}
+
+func TestStateBroadcast(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+
+	dial := func() *websocket.Conn {
+		header := http.Header{}
+		header.Add("Cookie", "client_session="+link.Token)
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	phone := dial()
+	defer phone.Close()
+	if init := skipUntilType(t, phone, "init"); init["state"] == nil {
+		t.Errorf("init has no state: %v", init)
+	}
+	tablet := dial()
+	defer tablet.Close()
+	skipUntilType(t, tablet, "init")
+
+	ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	send := func(id, typ, value string) {
+		phone.WriteMessage(websocket.TextMessage, []byte(`{"type":"entry","action":"add","entry":{"id":"`+id+`","ts":`+ts+`,"type":"`+typ+`","value":"`+value+`"}}`))
+	}
+
+	send("s1", "sleep", "sleeping")
+	for _, conn := range []*websocket.Conn{phone, tablet} {
+		msg := skipUntilType(t, conn, "state")
+		var st CurrentState
+		data, _ := json.Marshal(msg["state"])
+		json.Unmarshal(data, &st)
+		if !st.Sleeping || len(st.Activities) != 1 || st.Activities[0].ID != "s1" {
+			t.Errorf("state = %+v", st)
+		}
+	}
+
+	// A point entry in a non-stateful category doesn't change the state,
+	// so the next state message is for the waking
+	send("n1", "nappy", "wet")
+	send("s2", "sleep", "awake")
+	msg := skipUntilType(t, tablet, "state")
+	if st := msg["state"].(map[string]any); st["sleeping"] != false {
+		t.Errorf("state after nappy and waking = %v", st)
+	}
+}
@@ -1,5 +1,5 @@
 /* exported init, switchTab, changeReportDate, goToToday, saveWithCustomTime,
-   closeConfigModal, downloadCSV, downloadHourlyReport, importCSV, resetConfig,
+   closeConfigModal, downloadCSV, downloadTakeout, downloadHourlyReport, importCSV, resetConfig,
    saveConfig, clearAllEntries, toggleGroupStateful, toggleButtonFlag,
    updateConfigButton, updateGroupCategory, addButtonToGroup, removeButton,
    generateTestData */
@@ -27,7 +27,7 @@ function setupErrorForwarding() {
   function flushLogs() {
     if (logQueue.length === 0) return;
     const toSend = logQueue.splice(0, logQueue.length);
-    fetch('/log', {
+    fetch('api/v1/log', { // relative, so it follows BASE_PATH
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify(toSend)
@@ -68,8 +68,25 @@ function setupErrorForwarding() {
   });
 };
 
+// The server injects the practice's branding, if any, as window.BRANDING
+function applyBranding() {
+  const b = window.BRANDING;
+  if (!b) return;
+  const title = document.getElementById('app-title');
+  if (b.app_name && b.app_name !== 'Baby Log') title.textContent = b.app_name;
+  if (b.logo_url) {
+    const img = document.createElement('img');
+    img.src = b.logo_url;
+    img.alt = '';
+    img.className = 'brand-logo';
+    title.prepend(img);
+  }
+}
+
 function init() {
 
+  applyBranding();
+
   // Initialize database on load
   initDB();
 
@@ -205,6 +222,17 @@ async function getEntryBySyncId(syncId) {
   });
 }
 
+// Write back an entry previously read from IndexedDB (no sync)
+async function putEntry(entry) {
+  if (!db) await initDB();
+  return new Promise((resolve, reject) => {
+    const transaction = db.transaction(['entries'], 'readwrite');
+    transaction.objectStore('entries').put(entry);
+    transaction.oncomplete = () => resolve();
+    transaction.onerror = () => reject(transaction.error);
+  });
+}
+
 // Debounced UI update - prevents rapid-fire updates during bulk sync
 let _uiUpdatePending = false;
 let _uiUpdateTimeout = null;
@@ -227,8 +255,9 @@ function scheduleUIUpdate() {
   }, 100); // 100ms debounce
 }
 
-// Add a single entry to the database
-async function addEntry(type, value, ts) {
+// Add a single entry to the database. data is an optional object of
+// structured details (e.g. pumping duration and volume).
+async function addEntry(type, value, ts, data) {
   if (!db) await initDB();
 
   const transaction = db.transaction(['entries'], 'readwrite');
@@ -244,6 +273,7 @@ async function addEntry(type, value, ts) {
     });
 
   const entry = { type, value, ts, deleted: false, updated: now, syncId };
+  if (data) entry.data = data;
   const request = objectStore.add(entry);
 
   return new Promise((resolve, reject) => {
@@ -257,7 +287,8 @@ async function addEntry(type, value, ts) {
           ts: new Date(ts).getTime(),
           type: entry.type,
           value: entry.value,
-          deleted: entry.deleted
+          deleted: entry.deleted,
+          data: entry.data
         });
       }
 
@@ -404,8 +435,56 @@ function _findLastSleepStart(entries) {
   return [...entries].reverse().find((e) => !e.deleted && e.type === 'sleep' && (e.value === 'sleeping' || e.value === 'nap'));
 }
 
+// Ask for pumping details; returns null if the user cancels.
+// Buttons in a "pump" group should use left/right/both as values.
+function promptPumpData() {
+  const volume = prompt('Volume pumped (ml)?', '');
+  if (volume === null) return null;
+  const duration = prompt('Duration (minutes)?', '');
+  if (duration === null) return null;
+  return {
+    volume_ml: Math.max(0, parseFloat(volume) || 0),
+    duration_min: Math.max(0, parseFloat(duration) || 0)
+  };
+}
+
+// Ask for a medication dose such as "5 ml"; returns null if the user cancels.
+// The server checks the drug's minimum interval (minIntervalMin on the button).
+function promptMedData() {
+  const dose = prompt('Dose (e.g. 5 ml)? Leave blank to skip.', '');
+  if (dose === null) return null;
+  const match = dose.trim().match(/^([\d.]+)\s*(\S*)$/);
+  return match ? { dose: parseFloat(match[1]), unit: match[2] } : {};
+}
+
+// Ask for a temperature such as "38.2" or "101 F"; returns null if the user
+// cancels. Readings above 50 are assumed to be Fahrenheit.
+function promptTempData() {
+  const reading = prompt('Temperature (°C or °F)?', '');
+  if (reading === null) return null;
+  const match = reading.trim().match(/^([\d.]+)\s*°?\s*([cCfF]?)$/);
+  if (!match) {
+    alert('Could not read that temperature.');
+    return null;
+  }
+  const value = parseFloat(match[1]);
+  const unit = match[2] ? match[2].toUpperCase() : (value > 50 ? 'F' : 'C');
+  return { value, unit };
+}
+
 async function save(type, value, btn, customTimestamp = null) {
   const ts = customTimestamp || nowIso();
+  let data;
+  if (type === 'pump') {
+    data = promptPumpData();
+    if (!data) return;
+  } else if (type === 'med') {
+    data = promptMedData();
+    if (!data) return;
+  } else if (type === 'temp') {
+    data = promptTempData();
+    if (!data) return;
+  }
   const eventTime = new Date(ts);
 
   // Add animation
@@ -417,7 +496,7 @@ async function save(type, value, btn, customTimestamp = null) {
   }
 
   // Persist this single entry
-  await addEntry(type, value, ts);
+  await addEntry(type, value, ts, data);
 
   updateTimestamp('Saved: ' + eventTime.toLocaleTimeString());
   updateDailyReport();
@@ -464,7 +543,9 @@ async function toggleEntryDeleted(entryId, shouldDelete) {
                 ts: new Date(entry.ts).getTime(),
                 type: entry.type,
                 value: entry.value,
-                deleted: entry.deleted
+                deleted: entry.deleted,
+                data: entry.data,
+                child_id: entry.childId
               });
             }
           }
@@ -527,7 +608,7 @@ async function downloadCSV() {
     return;
   }
 
-  const header = 'Timestamp,Type,Value';
+  const header = 'Timestamp,Type,Value,Author';
   const rows = exportEntries.map((e) => {
     // Convert UTC timestamp to ISO format with local timezone offset
     const date = new Date(e.ts);
@@ -544,7 +625,7 @@ async function downloadCSV() {
     const second = String(date.getSeconds()).padStart(2, '0');
 
     const localTime = `${year}-${month}-${day}T${hour}:${minute}:${second}${sign}${hours}:${mins}`;
-    return `"${localTime}","${e.type}","${e.value}"`;
+    return `"${localTime}","${e.type}","${e.value}","${(e.author || '').replace(/"/g, '""')}"`;
   });
   const csv = [header, ...rows].join('\n');
 
@@ -561,6 +642,122 @@ async function downloadCSV() {
   URL.revokeObjectURL(url);
 }
 
+// Server takeout: entries, config and daily summaries as a zip
+function downloadTakeout() {
+  window.location.href = `api/v1/takeout?offset=${-new Date().getTimezoneOffset()}`;
+}
+
+// List the family's signed-in devices and offer to sign one out, e.g. a
+// lost phone
+async function manageDevices() {
+  let devices;
+  try {
+    const res = await fetch('api/v1/devices');
+    if (!res.ok) throw new Error(res.status);
+    devices = await res.json();
+  } catch (err) {
+    alert('⚠️ Couldn\'t load devices. Try again when you\'re online.');
+    return;
+  }
+  if (devices.length === 0) {
+    alert('No devices are signed in.');
+    return;
+  }
+  const lines = devices.map((d, i) => {
+    const seen = d.connected ? 'online now' : 'last seen ' + new Date(d.last_seen_at).toLocaleString();
+    return `${i + 1}. ${d.label || 'Unnamed'} (${d.platform}), ${seen}${d.current ? ' (this device)' : ''}`;
+  });
+  const choice = prompt(lines.join('\n') + '\n\nEnter a number to sign that device out, or R to rename this one:');
+  if (choice && choice.trim().toUpperCase() === 'R') {
+    renameDevice(devices.find(d => d.current));
+    return;
+  }
+  const device = devices[parseInt(choice, 10) - 1];
+  if (!device) return;
+  if (!confirm(`Sign out ${device.label || 'this device'} (${device.platform})? It will need the link again to get back in.`)) return;
+  const res = await fetch(`api/v1/devices/${encodeURIComponent(device.id)}`, { method: 'DELETE' });
+  if (res.status === 204) {
+    if (!device.current) alert('Signed out.');
+  } else {
+    alert(`⚠️ Couldn't sign the device out (${res.status}).`);
+  }
+}
+
+// Rename this device's link, as others see it in presence
+async function renameDevice(current) {
+  const label = prompt('Name this device (e.g. "Dad\'s Pixel"):', current ? current.label : '');
+  if (!label || !label.trim()) return;
+  const res = await fetch('api/v1/link', {
+    method: 'PATCH',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ label: label.trim() })
+  });
+  if (!res.ok) {
+    const { error = {} } = await res.json().catch(() => ({}));
+    const reason = (error.fields && error.fields.label) || error.message || res.status;
+    alert(`⚠️ Couldn't rename: ${reason}`);
+  }
+}
+
+// Optional account, for caregivers who help several families: it remembers
+// each family's link, so this browser can move between them
+async function manageAccount() {
+  const res = await fetch('api/v1/account');
+  if (res.status === 401) {
+    const email = prompt('Sign in to your account, or create one, to move between the families you help.\n\nEmail address:');
+    if (!email) return;
+    const password = prompt('Password (at least 10 characters for a new account):');
+    if (!password) return;
+    const body = JSON.stringify({ email, password });
+    const headers = { 'Content-Type': 'application/json' };
+    let login = await fetch('api/v1/account/login', { method: 'POST', headers, body });
+    if (login.status === 401 && confirm(`No account matches. Create one for ${email}?`)) {
+      login = await fetch('api/v1/account', { method: 'POST', headers, body });
+    }
+    if (!login.ok) {
+      const { error = {} } = await login.json().catch(() => ({}));
+      const reason = error.fields ? Object.values(error.fields).join(', ') : error.message || login.status;
+      alert(`⚠️ Couldn't sign in: ${reason}`);
+      return;
+    }
+    return showAccount(await login.json());
+  }
+  if (!res.ok) {
+    alert('⚠️ Couldn\'t load your account. Try again when you\'re online.');
+    return;
+  }
+  showAccount(await res.json());
+}
+
+async function showAccount(account) {
+  const lines = account.families.map((f, i) => `${i + 1}. ${f.family_name}${f.current ? ' (open now)' : ''}`);
+  const choice = prompt(`Signed in as ${account.email}.\n\n${lines.join('\n') || 'No families yet.'}\n\n` +
+    'Enter a number to open that family, A to add this one, or O to sign out:');
+  if (!choice) return;
+  const c = choice.trim().toUpperCase();
+  if (c === 'A' || c === 'O') {
+    const res = await fetch(c === 'A' ? 'api/v1/account/families' : 'api/v1/account/logout', { method: 'POST' });
+    if (!res.ok) alert(`⚠️ That didn't work (${res.status}).`);
+    else if (c === 'A') alert('Added. Open it from your account on any device.');
+    return;
+  }
+  const family = account.families[parseInt(choice, 10) - 1];
+  if (!family || family.current) return;
+  if (window.syncClient && window.syncClient.getPendingCount() > 0) {
+    alert('⚠️ Some entries haven\'t reached the server yet. Try again once they have.');
+    return;
+  }
+  const res = await fetch(`api/v1/account/families/${encodeURIComponent(family.family_id)}/open`, { method: 'POST' });
+  if (!res.ok) {
+    alert(`⚠️ Couldn't open ${family.family_name} (${res.status}).`);
+    return;
+  }
+  // This device only keeps one family's entries; start afresh from the server
+  await clearAllEntries();
+  localStorage.removeItem('sync-cursor');
+  window.location.href = (await res.json()).url;
+}
+
 async function importCSV() {
   const input = document.createElement('input');
   input.type = 'file';
@@ -1027,6 +1224,10 @@ function createButtonRow(groupIndex, btnIndex, btn) {
                onchange="updateConfigButton(${groupIndex}, ${btnIndex}, 'label', this.value)">
         <button class="config-toggle-btn ${btn.countDaily ? 'active' : ''}" 
                 onclick="toggleButtonFlag(${groupIndex}, ${btnIndex}, 'countDaily', this)">📊</button>
+        ${buttonGroups[groupIndex].category === 'med' ? `
+        <input type="number" min="0" step="0.5" value="${btn.minIntervalMin ? btn.minIntervalMin / 60 : ''}" placeholder="min h"
+               title="Minimum hours between doses"
+               onchange="updateConfigButton(${groupIndex}, ${btnIndex}, 'minIntervalMin', Math.round(parseFloat(this.value) * 60) || 0)" style="width: 60px;">` : ''}
         <button class="remove-btn" onclick="removeButton(${groupIndex}, ${btnIndex})">×</button>
       `;
   return row;
@@ -1050,9 +1251,20 @@ function updateGroupCategory(groupIndex, value) {
   buttonGroups[groupIndex].category = value;
 }
 
+// uniqueName returns base, or base-2, base-3, ... if taken already has it,
+// since the server refuses configs with repeated categories or values.
+function uniqueName(base, taken) {
+  let name = base;
+  for (let n = 2; taken.includes(name); n++) {
+    name = `${base}-${n}`;
+  }
+  return name;
+}
+
 function addButtonToGroup(groupIndex) {
-  buttonGroups[groupIndex].buttons.push({
-    value: 'new',
+  const buttons = buttonGroups[groupIndex].buttons;
+  buttons.push({
+    value: uniqueName('new', buttons.map((b) => b.value)),
     label: 'New',
     emoji: '⭐',
   });
@@ -1070,7 +1282,7 @@ function removeButton(groupIndex, btnIndex) {
 
 function addNewGroup() {
   buttonGroups.push({
-    category: 'custom',
+    category: uniqueName('custom', buttonGroups.map((g) => g.category)),
     buttons: [{ value: 'new', label: 'New Button', emoji: '⭐' }],
   });
   openConfigModal(); // Refresh
@@ -1124,6 +1336,7 @@ function initWebSocketSync() {
   console.log('[WS Sync] Initializing WebSocket sync for family:', familyId);
 
   window.syncClient = new SyncClient({
+    childId: params.get('child'),
     onConnect: () => {
       console.log('[WS Sync] Connected');
       updateWsSyncIndicator('connected');
@@ -1135,6 +1348,8 @@ function initWebSocketSync() {
     onInit: async (entries, config) => {
       console.log('[WS Sync] Received init with', entries.length, 'entries');
       await mergeRemoteEntries(entries);
+      const perms = window.syncClient.permissions;
+      document.getElementById('download-takeout').style.display = perms && !perms.can_export ? 'none' : '';
       if (config && Object.keys(config).length > 0) {
         // Could merge config here if needed
       }
@@ -1145,9 +1360,89 @@ function initWebSocketSync() {
       await handleRemoteEntry(action, entry);
       scheduleUIUpdate(); // Debounced UI refresh
     },
-    onPresence: (members) => {
+    onConfigRejected: (msg) => {
+      alert(`⚠️ Buttons not saved to the server: ${msg.message}.`);
+    },
+    onDeviceSettings: (settings) => {
+      // This device's own preferences, kept apart from the family's buttons
+      localStorage.setItem('device-settings', JSON.stringify(settings));
+    },
+    onEntryRejected: async (msg) => {
+      if (msg.reason === 'quota_exceeded') {
+        alert(`⚠️ Not saved: this family has reached its ${msg.quota.quota.replace(/_/g, ' ')} limit. Ask your admin.`);
+        return;
+      }
+      if (msg.reason === 'out_of_bounds') {
+        // e.g. this device's clock is far out; resending won't help
+        alert(`⚠️ Not saved: ${msg.message}. Check this device's date and time.`);
+        return;
+      }
+      const entry = await getEntryBySyncId(msg.id);
+      if (entry && msg.reason === 'forbidden') {
+        // Our link can't delete; put the entry back
+        alert(`⚠️ Not deleted: ${msg.message}.`);
+        entry.deleted = false;
+        entry.updated = new Date().toISOString();
+        await putEntry(entry);
+        scheduleUIUpdate();
+        return;
+      }
+      if (!entry || msg.reason !== 'dose_interval') return;
+      const c = msg.conflict;
+      const hours = Math.round(c.min_interval_min / 6) / 10;
+      const override = confirm(
+        `⚠️ ${c.drug} was already given at ${new Date(c.last_dose_ts).toLocaleString()}.\n` +
+        `The minimum interval is ${hours} hours.\n\nLog this dose anyway?`);
+      if (override) {
+        entry.data = { ...(entry.data || {}), override: true };
+      } else {
+        entry.deleted = true;
+      }
+      entry.updated = new Date().toISOString();
+      await putEntry(entry);
+      if (override) {
+        window.syncClient.sendEntry('add', {
+          id: entry.syncId,
+          ts: new Date(entry.ts).getTime(),
+          type: entry.type,
+          value: entry.value,
+          deleted: false,
+          data: entry.data
+        });
+      }
+      scheduleUIUpdate();
+    },
+    onDoseWarning: (msg) => {
+      const c = msg.conflict;
+      alert(`⚠️ ${msg.label || 'Someone'} logged ${c.drug} at ${new Date(msg.ts).toLocaleString()}, ` +
+        `less than ${Math.round(c.min_interval_min / 6) / 10} hours after the previous dose ` +
+        `(${new Date(c.last_dose_ts).toLocaleString()}).`);
+    },
+    onAlert: (a) => {
+      alert(`🌡️ ${a.message}`);
+    },
+    onNotification: showNotification,
+    onAnnouncement: showAnnouncement,
+    onMaintenance: (msg) => {
+      const banner = document.getElementById('maintenance-banner');
+      banner.textContent = `🛠️ ${msg.message || 'Server maintenance in progress'}. Entries are kept on this device and sync when it's over.`;
+      banner.style.display = msg.enabled ? '' : 'none';
+    },
+    onTimeSkew: (msg) => {
+      const banner = document.getElementById('clock-banner');
+      const mins = Math.round(Math.abs(msg.offset_ms) / 60000);
+      banner.textContent = `🕐 This device's clock is ${mins} min ${msg.offset_ms > 0 ? 'ahead' : 'behind'}. ` +
+        'Entries are stamped with it, so set the date and time to automatic.';
+      banner.style.display = msg.offset_ms ? '' : 'none';
+    },
+    onSessionEnded: (reason) => {
+      updateWsSyncIndicator('disconnected');
+      if (reason === 'expired') requestMagicLink();
+      else if (reason === 'signed_out') alert('This device was signed out from another device. Open your link again to sign back in.');
+    },
+    onPresence: (members, devices) => {
       console.log('[WS Sync] Presence update:', members);
-      updatePresenceIndicator(members);
+      updatePresenceIndicator(devices);
     },
     onError: (err) => {
       console.error('[WS Sync] Error:', err);
@@ -1157,6 +1452,67 @@ function initWebSocketSync() {
   window.syncClient.connect();
 }
 
+// Admin announcements stay up until dismissed; dismissed ones are
+// remembered so reconnecting doesn't bring them back
+function showAnnouncement(a) {
+  const dismissed = JSON.parse(localStorage.getItem('dismissed-announcements') || '[]');
+  const container = document.getElementById('announcements');
+  if (dismissed.includes(a.id) || container.querySelector(`[data-id="${CSS.escape(a.id)}"]`)) return;
+  const el = document.createElement('div');
+  el.className = 'announcement';
+  el.dataset.id = a.id;
+  const text = document.createElement('span');
+  text.textContent = `📢 ${a.message}`;
+  const close = document.createElement('button');
+  close.textContent = '✕';
+  close.title = 'Dismiss';
+  close.onclick = () => {
+    el.remove();
+    // Expired ones will never be sent again, so only keep the recent few
+    localStorage.setItem('dismissed-announcements', JSON.stringify([...JSON.parse(localStorage.getItem('dismissed-announcements') || '[]'), a.id].slice(-50)));
+  };
+  el.append(text, close);
+  container.append(el);
+}
+
+// Another caregiver logged something: a system notification if the page
+// is out of sight and they're allowed, otherwise a buzz and a banner that
+// clears itself
+function showNotification(n) {
+  if (document.hidden && 'Notification' in window && Notification.permission === 'granted') {
+    new Notification('babytrack', { body: n.title, tag: n.entry_id });
+    return;
+  }
+  if (navigator.vibrate) navigator.vibrate(200);
+  const el = document.createElement('div');
+  el.className = 'announcement';
+  el.textContent = `🔔 ${n.title}`;
+  document.getElementById('announcements').append(el);
+  setTimeout(() => el.remove(), 8000);
+}
+
+// This device's session has lapsed; offer a sign-in link by email, which
+// works if the device's link came from an emailed invitation
+async function requestMagicLink() {
+  const email = prompt('You\'ve been signed out on this device. Enter the email address you were invited with to get a sign-in link:');
+  if (!email) return;
+  try {
+    const res = await fetch('api/v1/session/magic', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ email })
+    });
+    if (res.status === 202) {
+      alert('If that address was invited here, a sign-in link is on its way. Open it on this device.');
+    } else {
+      const { error = {} } = await res.json().catch(() => ({}));
+      alert(`⚠️ Couldn't send a sign-in link: ${error.message || res.status}. Ask your admin for a new link.`);
+    }
+  } catch (err) {
+    alert('⚠️ Couldn\'t reach the server. Try again when you\'re online.');
+  }
+}
+
 // Update sync status indicator (console only)
 function updateWsSyncIndicator(status) {
   if (status === 'connected') {
@@ -1167,9 +1523,16 @@ function updateWsSyncIndicator(status) {
 }
 
 // Update presence indicator (console only)
-function updatePresenceIndicator(members) {
-  if (members.length > 0) {
-    console.log('[Presence] 👥 Online:', members.join(', '));
+function updatePresenceIndicator(devices) {
+  if (devices.length > 0) {
+    const describe = (d) => {
+      let s = d.label || 'unknown';
+      if (d.connections > 1) s += ` ×${d.connections}`;
+      if (d.status && d.status !== 'active') s += `, ${d.status}`;
+      if (d.last_entry_at) s += ` (last entry ${Math.round((Date.now() - d.last_entry_at) / 60000)} min ago)`;
+      return s;
+    };
+    console.log('[Presence] 👥 Online:', devices.map(describe).join(', '));
   }
 }
 
@@ -1203,6 +1566,11 @@ async function mergeRemoteEntries(remoteEntries) {
         existing.ts = new Date(remote.ts).toISOString();
         existing.type = remote.type;
         existing.value = remote.value;
+        existing.data = remote.data;
+        existing.endedTs = remote.ended_ts ? new Date(remote.ended_ts).toISOString() : undefined;
+        existing.ongoing = remote.ongoing || false;
+        existing.childId = remote.child_id;
+        existing.author = remote.author;
         existing.deleted = remote.deleted;
         existing.updated = new Date(remoteUpdated).toISOString();
         objectStore.put(existing);
@@ -1214,6 +1582,11 @@ async function mergeRemoteEntries(remoteEntries) {
         ts: new Date(remote.ts).toISOString(),
         type: remote.type,
         value: remote.value,
+        data: remote.data,
+        endedTs: remote.ended_ts ? new Date(remote.ended_ts).toISOString() : undefined,
+        ongoing: remote.ongoing || false,
+        childId: remote.child_id,
+        author: remote.author,
         deleted: remote.deleted || false,
         updated: new Date(remote.updated_at || Date.now()).toISOString()
       };
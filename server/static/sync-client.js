@@ -10,6 +10,134 @@
  * - pendingQueue is persisted to localStorage
  */
 
+// WS protocol version this client was built against (see server protocolVersion)
+const PROTOCOL_VERSION = 1;
+
+// Reported to the server in hello; bump with client releases
+const APP_VERSION = '0.1.0';
+
+// How often to ping with our clock, so the server can spot a skewed one
+const TIME_SYNC_INTERVAL_MS = 5 * 60 * 1000;
+
+// How long without a tap or key before we tell the server we're idle;
+// the server's idleAfter
+const IDLE_AFTER_MS = 2 * 60 * 1000;
+
+// How long to let the cursor settle before acknowledging it to the server
+const SYNC_ACK_DELAY_MS = 2000;
+
+// Minimal CBOR (RFC 8949), offered in hello as a smaller, cheaper-to-parse
+// alternative to JSON frames. Covers what JSON can express; see the
+// server's cbor.go.
+function cborEncode(value) {
+  const out = [];
+  const utf8 = new TextEncoder();
+  const head = (major, n) => {
+    major <<= 5;
+    if (n < 24) out.push(major | n);
+    else if (n < 0x100) out.push(major | 24, n);
+    else if (n < 0x10000) out.push(major | 25, n >> 8, n & 0xff);
+    else if (n < 0x100000000) out.push(major | 26, n >>> 24, (n >> 16) & 0xff, (n >> 8) & 0xff, n & 0xff);
+    else {
+      const hi = Math.floor(n / 0x100000000), lo = n >>> 0;
+      out.push(major | 27, hi >>> 24, (hi >> 16) & 0xff, (hi >> 8) & 0xff, hi & 0xff,
+        lo >>> 24, (lo >> 16) & 0xff, (lo >> 8) & 0xff, lo & 0xff);
+    }
+  };
+  const write = (v) => {
+    if (v === null || v === undefined) out.push(0xf6);
+    else if (v === false) out.push(0xf4);
+    else if (v === true) out.push(0xf5);
+    else if (typeof v === 'number') {
+      if (Number.isSafeInteger(v)) {
+        if (v >= 0) head(0, v); else head(1, -1 - v);
+      } else {
+        const b = new Uint8Array(8);
+        new DataView(b.buffer).setFloat64(0, v);
+        out.push(0xfb, ...b);
+      }
+    } else if (typeof v === 'string') {
+      const b = utf8.encode(v);
+      head(3, b.length);
+      for (const c of b) out.push(c);
+    } else if (Array.isArray(v)) {
+      head(4, v.length);
+      v.forEach(write);
+    } else if (typeof v === 'object') {
+      const keys = Object.keys(v).filter(k => v[k] !== undefined);
+      head(5, keys.length);
+      for (const k of keys) {
+        write(k);
+        write(v[k]);
+      }
+    } else {
+      out.push(0xf6);
+    }
+  };
+  write(value);
+  return new Uint8Array(out);
+}
+
+function cborDecode(buffer) {
+  const view = new DataView(buffer);
+  const utf8 = new TextDecoder();
+  let pos = 0;
+  const arg = (info) => {
+    if (info < 24) return info;
+    const size = 1 << (info - 24);
+    let n = 0;
+    for (let i = 0; i < size; i++) n = n * 256 + view.getUint8(pos++);
+    return n;
+  };
+  const read = () => {
+    const b = view.getUint8(pos++);
+    const major = b >> 5, info = b & 0x1f;
+    if (major === 7) {
+      switch (info) {
+        case 20: return false;
+        case 21: return true;
+        case 22: case 23: return null;
+        case 25: {
+          const h = view.getUint16(pos);
+          pos += 2;
+          const exp = (h >> 10) & 0x1f, mant = h & 0x3ff;
+          const f = exp === 0 ? mant * 2 ** -24 : exp === 31 ? (mant ? NaN : Infinity) : (mant + 1024) * 2 ** (exp - 25);
+          return h & 0x8000 ? -f : f;
+        }
+        case 26: pos += 4; return view.getFloat32(pos - 4);
+        case 27: pos += 8; return view.getFloat64(pos - 8);
+      }
+      throw new Error('unsupported CBOR simple value');
+    }
+    if (info > 27) throw new Error('unsupported CBOR length');
+    const n = arg(info);
+    switch (major) {
+      case 0: return n;
+      case 1: return -1 - n;
+      case 2: case 3: {
+        const s = utf8.decode(new Uint8Array(buffer, pos, n));
+        pos += n;
+        return s;
+      }
+      case 4: {
+        const items = [];
+        for (let i = 0; i < n; i++) items.push(read());
+        return items;
+      }
+      case 5: {
+        const obj = {};
+        for (let i = 0; i < n; i++) {
+          const k = read();
+          obj[k] = read();
+        }
+        return obj;
+      }
+      case 6: return read(); // tag: keep the content
+    }
+  };
+  return read();
+}
+
 class SyncClient {
   constructor(options = {}) {
     this.serverUrl = options.serverUrl || this.detectServerUrl();
@@ -37,9 +165,41 @@ class SyncClient {
     this.onPresence = options.onPresence || (() => {});
     this.onInit = options.onInit || (() => {});
     this.onError = options.onError || (() => {});
+    this.onSessionEnded = options.onSessionEnded || (() => {});
+    this.onEntryRejected = options.onEntryRejected || (() => {});
+    this.onConfigRejected = options.onConfigRejected || (() => {});
+    this.onDoseWarning = options.onDoseWarning || (() => {});
+    this.onAlert = options.onAlert || (() => {});
+    this.onState = options.onState || (() => {});
+    this.onAnnouncement = options.onAnnouncement || (() => {});
+    this.onMaintenance = options.onMaintenance || (() => {});
+    this.onTimeSkew = options.onTimeSkew || (() => {});
+    this.onDeviceSettings = options.onDeviceSettings || (() => {});
+    this.onNotification = options.onNotification || (() => {});
+
+    // Server clock minus ours, ms, as of the last init or pong; network
+    // delay makes it approximate
+    this.serverTimeOffset = 0;
+    this.pingTimer = null;
+
+    // When the user last touched the page, for presence; see sendHeartbeat
+    this.lastInputAt = Date.now();
+    this.reportedIdle = false;
+    this.trackActivity();
+
+    // What our access link may do, from init; null until then
+    this.permissions = null;
+
+    // Set when the server revokes our session; stops auto-reconnect
+    this.sessionEnded = false;
     
-    // Cursor (seq) for incremental sync - highest seq received from server
-    this.cursor = parseInt(localStorage.getItem('sync-cursor') || '0', 10);
+    // Only follow one child of the family, if set
+    this.childId = options.childId || null;
+
+    // Cursor (seq) for incremental sync - highest seq received from server.
+    // Kept per child, since a scoped device only sees that child's entries.
+    this.cursorKey = this.childId ? `sync-cursor:${this.childId}` : 'sync-cursor';
+    this.cursor = parseInt(localStorage.getItem(this.cursorKey) || '0', 10);
   }
   
   detectServerUrl() {
@@ -55,17 +215,31 @@ class SyncClient {
     const stored = localStorage.getItem('sync-server');
     if (stored) return stored;
     
-    // Default: assume server is on same host
+    // Default: assume server is on same host, under the page's directory
+    // so deployments with a BASE_PATH work
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    return `${protocol}//${window.location.host}`;
+    const basePath = window.location.pathname.replace(/\/[^/]*$/, '');
+    return `${protocol}//${window.location.host}${basePath}`;
   }
   
   connect() {
     if (this.connecting || this.connected) return;
     this.connecting = true;
+    if (this.cursor === 0 && !this.snapshotTried) {
+      this.snapshotTried = true;
+      this.loadSnapshot().finally(() => {
+        this.connecting = false;
+        this.connect();
+      });
+      return;
+    }
     
     try {
-      this.ws = new WebSocket(`${this.serverUrl}/ws`);
+      const params = new URLSearchParams({ hello: '1' });
+      if (this.childId) params.set('child', this.childId);
+      this.ws = new WebSocket(`${this.serverUrl}/api/v1/ws?${params}`);
+      this.ws.binaryType = 'arraybuffer';
+      this.encoding = 'json'; // until the server's hello says otherwise
       
       this.ws.onopen = () => {
         this.connected = true;
@@ -74,16 +248,37 @@ class SyncClient {
         console.log('[Sync] Connected to server');
         this.onConnect();
         
-        // Send initial sync_request with current cursor
-        this.sendSyncRequest();
+        // Introduce ourselves; init then only carries what changed since
+        // our cursor
+        this.safeSend({
+          type: 'hello',
+          protocol_version: PROTOCOL_VERSION,
+          app_version: APP_VERSION,
+          cursor: this.cursor,
+          encodings: typeof TextDecoder === 'undefined' ? ['json'] : ['cbor', 'json'],
+          client_time: Date.now()
+        });
+        this.sendHeartbeat();
+        clearInterval(this.pingTimer);
+        this.pingTimer = setInterval(() => this.sendHeartbeat(), TIME_SYNC_INTERVAL_MS);
       };
       
-      this.ws.onclose = () => {
+      const ws = this.ws;
+      this.ws.onclose = async () => {
+        clearInterval(this.pingTimer);
+        const opened = this.connected;
         this.connected = false;
         this.connecting = false;
         console.log('[Sync] Disconnected from server');
         this.onDisconnect();
-        this.scheduleReconnect();
+        // A socket refused before opening may mean our session has lapsed
+        if (!opened && ws === this.ws && await this.sessionExpired()) {
+          console.warn('[Sync] Session expired');
+          this.sessionEnded = true;
+          this.onSessionEnded('expired');
+          return;
+        }
+        if (!this.sessionEnded) this.scheduleReconnect();
       };
       
       this.ws.onerror = (err) => {
@@ -124,13 +319,43 @@ class SyncClient {
     setTimeout(() => this.connect(), delay);
   }
   
+  // Ping with our clock and whether anyone is using the page, so the family
+  // can see who is actually watching (presence status)
+  sendHeartbeat() {
+    const idleMs = Date.now() - this.lastInputAt;
+    this.reportedIdle = idleMs > IDLE_AFTER_MS;
+    this.safeSend({
+      type: 'ping',
+      client_time: Date.now(),
+      idle_ms: idleMs,
+      hidden: typeof document !== 'undefined' && document.hidden
+    });
+  }
+
+  // Ping early when the page is hidden or shown, goes idle, or is used
+  // again after being idle
+  trackActivity() {
+    if (typeof document === 'undefined') return;
+    const onInput = () => {
+      this.lastInputAt = Date.now();
+      if (this.reportedIdle) this.sendHeartbeat();
+    };
+    for (const type of ['pointerdown', 'keydown', 'touchstart']) {
+      document.addEventListener(type, onInput, { passive: true });
+    }
+    document.addEventListener('visibilitychange', () => this.sendHeartbeat());
+    setInterval(() => {
+      if (!this.reportedIdle && Date.now() - this.lastInputAt > IDLE_AFTER_MS) this.sendHeartbeat();
+    }, 30 * 1000);
+  }
+
   // Safe send that catches errors
   safeSend(msg) {
     if (!this.connected || !this.ws) {
       return false;
     }
     try {
-      this.ws.send(JSON.stringify(msg));
+      this.ws.send(this.encoding === 'cbor' ? cborEncode(msg) : JSON.stringify(msg));
       return true;
     } catch (err) {
       console.error('[Sync] Send failed:', err);
@@ -140,9 +365,13 @@ class SyncClient {
   
   handleMessage(data) {
     try {
-      const msg = JSON.parse(data);
+      const msg = typeof data === 'string' ? JSON.parse(data) : cborDecode(data);
       
       switch (msg.type) {
+        case 'hello':
+          console.log('[Sync] Server', msg.server_version, 'speaking protocol', msg.protocol_version, 'in', msg.encoding);
+          this.encoding = msg.encoding || 'json';
+          break;
         case 'init':
           this.handleInit(msg);
           break;
@@ -157,7 +386,7 @@ class SyncClient {
           this.onConfig(msg.data);
           break;
         case 'presence':
-          this.onPresence(msg.members || []);
+          this.onPresence(msg.members || [], msg.devices || []);
           break;
         case 'sync':
           this.handleSync(msg);
@@ -165,8 +394,82 @@ class SyncClient {
         case 'sync_response':
           this.handleSyncResponse(msg);
           break;
+        case 'tombstones_response':
+          this.handleTombstones(msg);
+          break;
+        case 'session_revoked':
+          console.warn('[Sync] Session ended by server:', msg.reason);
+          this.sessionEnded = true;
+          this.onSessionEnded(msg.reason);
+          break;
+        case 'entry_rejected':
+          // Server refused the entry (e.g. a medication dose too soon after
+          // the last one); stop resending and let the app decide
+          console.warn('[Sync] Entry rejected:', msg.id, msg.reason);
+          this.pendingEntries.delete(msg.id);
+          this.savePendingQueue();
+          this.onEntryRejected(msg);
+          break;
+        case 'config_rejected':
+          // Our link can't change the buttons, or they were invalid;
+          // resending won't help
+          console.warn('[Sync] Config rejected:', msg.reason);
+          this.pendingConfig = null;
+          this.savePendingConfig();
+          this.onConfigRejected(msg);
+          break;
+        case 'dose_warning':
+          this.onDoseWarning(msg);
+          break;
+        case 'alert':
+          this.onAlert(msg.alert);
+          break;
+        case 'state':
+          // What the baby is doing now (sleeping, ongoing feed); sent on change
+          this.onState(msg.state);
+          break;
+        case 'maintenance':
+          // The server is read-only meanwhile and won't ack what we send;
+          // it stays queued and goes out again once maintenance ends
+          this.onMaintenance(msg);
+          if (!msg.enabled) this.flushPendingQueue();
+          break;
+        case 'announcement':
+          this.onAnnouncement(msg);
+          break;
+        case 'device_settings':
+          // Changed from another tab or over HTTP
+          this.onDeviceSettings(msg.settings || {});
+          break;
+        case 'notification':
+          // Another device logged something; muted per device by the
+          // "notifications" device setting
+          this.onNotification(msg.notification);
+          break;
+        case 'device_settings_rejected':
+          console.warn('[Sync] Device settings rejected:', msg.message);
+          break;
+        case 'label_set':
+          console.log('[Sync] Label set:', msg.label);
+          break;
+        case 'label_rejected':
+          console.warn('[Sync] Label rejected:', msg.message);
+          break;
+        case 'token_rotated':
+          this.handleTokenRotated(msg.token);
+          break;
+        case 'server_shutdown':
+          console.log('[Sync] Server restarting, will reconnect');
+          break;
         case 'pong':
           // Heartbeat response
+          if (msg.server_time) this.serverTimeOffset = msg.server_time - Date.now();
+          break;
+        case 'time_skew':
+          // Our clock is out by offset_ms (0 once it's back in line); the
+          // entries we log are stamped with it
+          this.serverTimeOffset = msg.server_time - Date.now();
+          this.onTimeSkew(msg);
           break;
         default:
           console.log('[Sync] Unknown message type:', msg.type);
@@ -176,11 +479,71 @@ class SyncClient {
     }
   }
   
+  // With nothing cached, start from the family's snapshot so init only
+  // has to carry the changes since it, rather than the whole history
+  async loadSnapshot() {
+    try {
+      const params = this.childId ? `?${new URLSearchParams({ child: this.childId })}` : '';
+      const res = await fetch(`${this.serverUrl.replace(/^ws/, 'http')}/api/v1/snapshot${params}`, {
+        credentials: 'include'
+      });
+      if (!res.ok) throw new Error(`HTTP ${res.status}`);
+      const snap = await res.json();
+      await this.onInit(snap.entries || [], {}, null);
+      this.cursor = snap.cursor;
+      this.saveCursor();
+      console.log('[Sync] Loaded snapshot with', snap.entries?.length || 0, 'entries at cursor', snap.cursor);
+    } catch (err) {
+      console.warn('[Sync] No snapshot, falling back to a full init:', err);
+    }
+  }
+
+  // Whether the server says our session cookie is no longer good, as
+  // opposed to being unreachable
+  async sessionExpired() {
+    try {
+      const res = await fetch(`${this.serverUrl.replace(/^ws/, 'http')}/api/v1/session`, {
+        credentials: 'include'
+      });
+      return res.status === 401;
+    } catch (err) {
+      return false;
+    }
+  }
+
+    // The server replaced our access link token; swap the session cookie
+  // (httpOnly, so only the server can set it) before the old one lapses
+  async handleTokenRotated(token) {
+    try {
+      const res = await fetch(`${this.serverUrl.replace(/^ws/, 'http')}/api/v1/session`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token }),
+        credentials: 'include'
+      });
+      if (!res.ok) throw new Error(`HTTP ${res.status}`);
+      console.log('[Sync] Session token rotated');
+    } catch (err) {
+      console.error('[Sync] Failed to rotate session token:', err);
+    }
+  }
+
   handleInit(msg) {
     console.log('[Sync] Received init with', msg.entries?.length || 0, 'entries');
+    if (msg.server_time) this.serverTimeOffset = msg.server_time - Date.now();
+    if (msg.protocol_version && msg.protocol_version !== PROTOCOL_VERSION) {
+      console.warn('[Sync] Server protocol version', msg.protocol_version, 'differs from client', PROTOCOL_VERSION);
+    }
+    if (msg.role === 'summary') {
+      // Summary-only links can't use the full app
+      window.location.replace('summary');
+      return;
+    }
     
-    // Track the highest seq received
+    // Track the highest seq received. The server may resume from an earlier
+    // cursor than ours, or send everything if ours is no good.
     if (msg.entries) {
+      this.cursor = msg.resumed_from || 0;
       for (const entry of msg.entries) {
         if (entry.seq > this.cursor) {
           this.cursor = entry.seq;
@@ -192,7 +555,10 @@ class SyncClient {
       this.savePendingQueue();
     }
     
-    this.onInit(msg.entries || [], msg.config || {});
+    this.permissions = msg.permissions || null;
+    this.onInit(msg.entries || [], msg.config || {}, msg.predictions || null);
+    if (msg.device_settings) this.onDeviceSettings(msg.device_settings);
+    if (msg.state) this.onState(msg.state);
     
     // After init, flush any pending entries
     this.flushPendingQueue();
@@ -309,10 +675,40 @@ class SyncClient {
     });
   }
   
+  // Confirm the cache against deletions since a cursor, without fetching
+  // everything else that changed. Doesn't move our cursor.
+  checkDeletions(since = 0) {
+    this.safeSend({ type: 'tombstones_request', cursor: since });
+  }
+
+  handleTombstones(msg) {
+    for (const id of msg.ids || []) {
+      this.onEntry('delete', { id });
+    }
+    if (msg.has_more) this.checkDeletions(msg.cursor);
+  }
+
   saveCursor() {
-    localStorage.setItem('sync-cursor', this.cursor.toString());
+    localStorage.setItem(this.cursorKey, this.cursor.toString());
+    // Tell the server what we have, so it can resume us from there even if
+    // local storage is lost, and show how far behind we are
+    clearTimeout(this.ackTimer);
+    this.ackTimer = setTimeout(() => {
+      this.safeSend({ type: 'sync_ack', cursor: this.cursor });
+    }, SYNC_ACK_DELAY_MS);
   }
   
+  // Start a duration activity (e.g. a feed); it stays ongoing until stopped
+  startActivity(entry) {
+    this.sendEntry('start', entry);
+  }
+
+  // Stop an ongoing activity. The whole entry is sent so the stop still
+  // works if it replaces a queued start that was never delivered.
+  stopActivity(entry, endedTs = Date.now()) {
+    this.sendEntry('stop', { ...entry, ongoing: false, ended_ts: endedTs });
+  }
+
   // Send entry to server - always queues first, then tries to send
   sendEntry(action, entry) {
     const entryId = entry.id;
@@ -361,7 +757,8 @@ class SyncClient {
         value: btn.value,
         label: btn.label,
         emoji: btn.emoji,
-        countDaily: btn.countDaily || false
+        countDaily: btn.countDaily || false,
+        ...(btn.minIntervalMin ? { minIntervalMin: btn.minIntervalMin } : {})
       }))
     }));
 
@@ -385,6 +782,12 @@ class SyncClient {
     }
   }
   
+  // Set this device's own settings; null removes one. Not queued: the
+  // server's copy is sent back on init
+  sendDeviceSettings(changes) {
+    return this.safeSend({ type: 'device_settings', data: changes });
+  }
+  
   // Pending queue management
   loadPendingQueue() {
     try {
@@ -0,0 +1,147 @@
+package babytrack
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FamilyStats is how much one family stores and how fast it is growing.
+// Growth counts entries written (added, edited or deleted), by server
+// time, as quotas do.
+type FamilyStats struct {
+	FamilyID    string `json:"family_id"`
+	Name        string `json:"name"`
+	Archived    bool   `json:"archived"`
+	Entries     int    `json:"entries"` // not deleted
+	Tombstones  int    `json:"tombstones"`
+	DataBytes   int64  `json:"data_bytes"`
+	Written7d   int    `json:"written_7d"`
+	Written30d  int    `json:"written_30d"`
+	OldestTs    *int64 `json:"oldest_ts"`
+	NewestTs    *int64 `json:"newest_ts"`
+	Connections int    `json:"connections"`
+}
+
+// StatsTotals sums FamilyStats over every family.
+type StatsTotals struct {
+	Families    int     `json:"families"`
+	Entries     int     `json:"entries"`
+	Tombstones  int     `json:"tombstones"`
+	DataBytes   int64   `json:"data_bytes"`
+	Written7d   int     `json:"written_7d"`
+	Written30d  int     `json:"written_30d"`
+	PerDay      float64 `json:"per_day"` // average over the last 30 days
+	OldestTs    *int64  `json:"oldest_ts"`
+	NewestTs    *int64  `json:"newest_ts"`
+	Connections int     `json:"connections"`
+}
+
+// StorageStats is the database's footprint on disk.
+type StorageStats struct {
+	DBBytes   int64 `json:"db_bytes"`
+	WALBytes  int64 `json:"wal_bytes"`
+	FreeBytes int64 `json:"free_bytes,omitempty"`
+}
+
+// FamilyStats returns every family's stats, biggest first. Connections
+// are left for the caller.
+func (db *DB) FamilyStats(now time.Time) ([]FamilyStats, error) {
+	rows, err := db.Query(
+		`SELECT f.id, f.name, f.archived,
+		   COALESCE(SUM(COALESCE(e.deleted, 0) = 0 AND e.id IS NOT NULL), 0),
+		   COALESCE(SUM(e.deleted = 1), 0),
+		   COALESCE(SUM(LENGTH(e.data)), 0),
+		   COALESCE(SUM(e.updated_at > ?), 0),
+		   COALESCE(SUM(e.updated_at > ?), 0),
+		   MIN(CASE WHEN COALESCE(e.deleted, 0) = 0 THEN e.ts END),
+		   MAX(CASE WHEN COALESCE(e.deleted, 0) = 0 THEN e.ts END)
+		 FROM families f LEFT JOIN entries e ON e.family_id = f.id
+		 GROUP BY f.id
+		 ORDER BY COUNT(e.id) DESC, f.created_at`,
+		now.Add(-7*24*time.Hour).UnixMilli(), now.Add(-30*24*time.Hour).UnixMilli(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []FamilyStats{}
+	for rows.Next() {
+		var f FamilyStats
+		var oldest, newest sql.NullInt64
+		if err := rows.Scan(&f.FamilyID, &f.Name, &f.Archived, &f.Entries, &f.Tombstones, &f.DataBytes,
+			&f.Written7d, &f.Written30d, &oldest, &newest); err != nil {
+			return nil, err
+		}
+		if oldest.Valid {
+			f.OldestTs, f.NewestTs = &oldest.Int64, &newest.Int64
+		}
+		stats = append(stats, f)
+	}
+	return stats, rows.Err()
+}
+
+// StorageStats measures the database file and its WAL.
+func (db *DB) StorageStats() (StorageStats, error) {
+	var st StorageStats
+	if err := db.QueryRow(
+		"SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()",
+	).Scan(&st.DBBytes); err != nil {
+		return st, err
+	}
+	if fi, err := os.Stat(db.path + "-wal"); err == nil {
+		st.WALBytes = fi.Size()
+	}
+	return st, nil
+}
+
+// getStats handles GET /admin/stats.
+func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	families, err := s.db.FamilyStats(now)
+	if err != nil {
+		serverError(w, "failed to get family stats", err)
+		return
+	}
+	storage, err := s.db.StorageStats()
+	if err != nil {
+		serverError(w, "failed to get storage stats", err)
+		return
+	}
+	if path := s.db.Path(); path != "" {
+		if free, err := diskFreeBytes(filepath.Dir(path)); err == nil {
+			storage.FreeBytes = free
+		}
+	}
+
+	conns := s.hub.ConnectionCounts()
+	t := StatsTotals{Families: len(families)}
+	for i := range families {
+		f := &families[i]
+		f.Connections = conns[f.FamilyID]
+		t.Entries += f.Entries
+		t.Tombstones += f.Tombstones
+		t.DataBytes += f.DataBytes
+		t.Written7d += f.Written7d
+		t.Written30d += f.Written30d
+		t.Connections += f.Connections
+		if f.OldestTs != nil && (t.OldestTs == nil || *f.OldestTs < *t.OldestTs) {
+			t.OldestTs = f.OldestTs
+		}
+		if f.NewestTs != nil && (t.NewestTs == nil || *f.NewestTs > *t.NewestTs) {
+			t.NewestTs = f.NewestTs
+		}
+	}
+	t.PerDay = float64(t.Written30d) / 30
+
+	jsonOK(w, map[string]any{
+		"generated_at": now.UnixMilli(),
+		"totals":       t,
+		"storage":      storage,
+		"send":         s.hub.SendStats(),
+		"families":     families,
+	})
+}
@@ -0,0 +1,50 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	big, _ := s.db.CreateFamily("Big", "")
+	small, _ := s.db.CreateFamily("Small", "")
+	now := time.Now()
+	old := now.Add(-400 * 24 * time.Hour).UnixMilli()
+	for _, e := range []Entry{
+		{ID: "b1", FamilyID: big.ID, Ts: old, Type: "feed"},
+		{ID: "b2", FamilyID: big.ID, Ts: now.UnixMilli(), Type: "pump", Data: json.RawMessage(`{"volume_ml":90}`)},
+		{ID: "b3", FamilyID: big.ID, Ts: now.UnixMilli(), Type: "feed"},
+		{ID: "s1", FamilyID: small.ID, Ts: now.UnixMilli(), Type: "feed"},
+	} {
+		s.db.UpsertEntry(&e)
+	}
+	s.db.DeleteEntry(big.ID, "b3")
+
+	w := httptest.NewRecorder()
+	s.getStats(w, httptest.NewRequest("GET", "/admin/stats", nil))
+	var resp struct {
+		Totals   StatsTotals   `json:"totals"`
+		Storage  StorageStats  `json:"storage"`
+		Families []FamilyStats `json:"families"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("stats: %v %s", err, w.Body)
+	}
+	if len(resp.Families) != 2 || resp.Families[0].FamilyID != big.ID {
+		t.Fatalf("families = %+v", resp.Families)
+	}
+	f := resp.Families[0]
+	if f.Entries != 2 || f.Tombstones != 1 || f.DataBytes != 16 || f.Written7d != 3 || *f.OldestTs != old {
+		t.Errorf("big family = %+v", f)
+	}
+	if tot := resp.Totals; tot.Families != 2 || tot.Entries != 3 || tot.Written30d != 4 || *tot.OldestTs != old {
+		t.Errorf("totals = %+v", tot)
+	}
+	if resp.Storage.DBBytes == 0 {
+		t.Errorf("storage = %+v", resp.Storage)
+	}
+}
@@ -0,0 +1,62 @@
+package babytrack
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Quick status: the latest entry of each type and how long ago it was, so
+// widgets and lock-screen views can show "last feed 2h 15m ago" without
+// syncing the history.
+
+type TypeStatus struct {
+	Entry      *Entry `json:"entry"`
+	ElapsedMin int    `json:"elapsed_min"`
+	Elapsed    string `json:"elapsed"` // e.g. "2h 15m"
+}
+
+type QuickStatus struct {
+	Now   int64                 `json:"now"`
+	Types map[string]TypeStatus `json:"types"`
+}
+
+// quickStatus returns the latest entry for each of types, or for every type
+// the family has used if types is empty. Types with no entries are omitted.
+func quickStatus(db EntryStore, familyID string, types []string, now time.Time) (*QuickStatus, error) {
+	if len(types) == 0 {
+		var err error
+		if types, err = db.GetEntryTypes(familyID); err != nil {
+			return nil, err
+		}
+	}
+	status := &QuickStatus{Now: now.UnixMilli(), Types: make(map[string]TypeStatus, len(types))}
+	for _, typ := range types {
+		e, err := db.GetLastEntry(familyID, typ, "")
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		mins := max(0, int(now.Sub(time.UnixMilli(e.Ts))/time.Minute))
+		status.Types[typ] = TypeStatus{Entry: e, ElapsedMin: mins, Elapsed: formatDuration(mins)}
+	}
+	return status, nil
+}
+
+// handleStatus serves GET /api/v1/status[?types=feed,nappy] for the caller's
+// family.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var types []string
+	if v := r.URL.Query().Get("types"); v != "" {
+		types = strings.Split(v, ",")
+	}
+	status, err := quickStatus(s.db, accessLinkFrom(r.Context()).FamilyID, types, time.Now())
+	if err != nil {
+		serverError(w, "failed to get status", err)
+		return
+	}
+	jsonOK(w, status)
+}
@@ -0,0 +1,54 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuickStatus(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+
+	now := time.Now()
+	add := func(ago time.Duration, typ, value string, deleted bool) {
+		e := &Entry{ID: generateToken(8), FamilyID: family.ID, Ts: now.Add(-ago).UnixMilli(), Type: typ, Value: value, Deleted: deleted}
+		if err := s.db.UpsertEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(5*time.Hour, "feed", "bf", false)
+	add(135*time.Minute, "feed", "bf", false)
+	add(time.Hour, "feed", "bf", true) // deleted, ignored
+	add(30*time.Minute, "nappy", "wet", false)
+
+	st, err := quickStatus(s.db, family.ID, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Types) != 2 {
+		t.Fatalf("types = %v", st.Types)
+	}
+	if f := st.Types["feed"]; f.ElapsedMin != 135 || f.Elapsed != "2h 15m" {
+		t.Errorf("feed = %+v", f)
+	}
+
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/status?types=nappy,sleep", nil)
+	req.Header.Set("Cookie", "client_session="+link.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got QuickStatus
+	json.NewDecoder(resp.Body).Decode(&got)
+	if resp.StatusCode != http.StatusOK || len(got.Types) != 1 || got.Types["nappy"].Entry.Value != "wet" {
+		t.Errorf("status %d: %+v", resp.StatusCode, got)
+	}
+}
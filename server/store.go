@@ -0,0 +1,213 @@
+package babytrack
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"time"
+)
+
+// Store is what the server needs from storage. *DB, on SQLite, is the
+// implementation; the interface lets handlers be tested against fakes (embed
+// Store in a struct and override the methods a test cares about) and leaves
+// room for other backends. Maintenance that only makes sense for SQLite
+// (migrations, Rekey, rollup rebuilds) stays on *DB, as do the CLI
+// commands using it. Lookups of a single row return sql.ErrNoRows when
+// there isn't one, as handlers expect.
+type Store interface {
+	EntryStore
+	FamilyStore
+	LinkStore
+	AccountStore
+	ConfigStore
+	AdminStore
+	ServerStore
+}
+
+var _ Store = (*DB)(nil)
+
+// EntryStore holds a family's entries and the queries summaries are built
+// from. Writes assign the family's next seq.
+type EntryStore interface {
+	UpsertEntry(e *Entry) error
+	UpsertEntries(entries []Entry) error
+	ImportEntries(familyID string, entries []Entry) (int, error)
+	DeleteEntry(familyID, id string) (int64, error)
+	RestoreEntries(familyID string, ids []string, from, to int64) (int, error)
+	EntryExists(familyID, id string) bool
+	FamilySeq(familyID string) (int64, error)
+	stoppedEntry(familyID string, stop *Entry) (*Entry, error)
+
+	GetEntry(familyID, id string) (*Entry, error)
+	GetEntries(familyID string, sinceUpdatedAt int64) ([]Entry, error)
+	GetEntriesSinceCursor(familyID string, cursor int64, limit int) ([]Entry, bool, error)
+	GetChildEntriesSinceCursor(familyID, childID string, cursor int64, limit int) ([]Entry, bool, error)
+	GetDeletedSinceCursor(familyID, childID string, cursor int64, limit int) (ids []string, lastSeq int64, hasMore bool, err error)
+	ListEntries(familyID string, deleted bool, from, to, beforeSeq int64, limit int) ([]Entry, bool, error)
+	GetEntriesForDate(familyID string, startMs, endMs int64) ([]Entry, error)
+	GetEntriesOfType(familyID, typ string, startMs, endMs int64) ([]Entry, error)
+	GetEntryCount(familyID string) (int, error)
+	GetEntryTypes(familyID string) ([]string, error)
+	GetLatestActivity(familyID string) (int64, error)
+	GetLastEntry(familyID, typ, value string) (*Entry, error)
+	GetLastEntryBefore(familyID, typ string, beforeMs int64) (*Entry, error)
+	GetLastChildEntryBefore(familyID, childID, typ string, beforeMs int64) (*Entry, error)
+	GetLastSleepEventBefore(familyID string, beforeMs int64) (*Entry, error)
+	GetFirstEntryFrom(familyID, typ string, fromMs int64) (*Entry, error)
+	GetOngoingEntries(familyID string) ([]Entry, error)
+	GetDurationEntriesSpanning(familyID string, ms int64) ([]Entry, error)
+	NearestDose(familyID, drug, excludeID string, ts int64, window time.Duration) (*Entry, error)
+	DailyRollups(familyID, childID, typ string, loc *time.Location, first, last string) ([]Rollup, error)
+}
+
+// FamilyStore holds families, their settings and what's kept about them
+// beyond entries: calendar feeds, erasures, activity and snapshots.
+type FamilyStore interface {
+	CreateFamily(name, notes string) (*Family, error)
+	CreateOrgFamily(orgID, name, notes string) (*Family, error)
+	GetFamily(id string) (*Family, error)
+	ListFamilies(includeArchived bool) ([]Family, error)
+	UpdateFamily(id string, name, notes *string, archived *bool) error
+	SetFamilyOrg(familyID, orgID string) error
+	GetFamilySettings(familyID string) (FamilySettings, error)
+	SaveFamilySettings(familyID string, fs FamilySettings) error
+
+	FamilyStats(now time.Time) ([]FamilyStats, error)
+	QuotaUsage(familyID string, now time.Time) (QuotaUsage, error)
+	InactiveFamilies(cutoff int64, orgID string) ([]InactiveFamily, error)
+	DigestFamilies(from, to int64) ([]DigestFamily, error)
+	lifecycleState(familyID string) (warnedAt, archivedAt, erasedAt int64, err error)
+	setInactiveWarned(familyID string, at int64) error
+	claimFeedPush(familyID string, feedTs int64) (bool, error)
+	claimSummaryPush(familyID, date string) (bool, error)
+	claimFeedEscalation(familyID string, feedTs int64) (bool, error)
+	claimSyncAlert(familyID string, lastSeen int64) (bool, error)
+	claimSMS(familyID, kind string, messages, perDay int, now time.Time) (bool, error)
+
+	EraseFamily(familyID, adminID string) (*Erasure, error)
+	ErasureCounts(familyID string) (ErasureCounts, error)
+	ListErasures(familyID string) ([]Erasure, error)
+
+	CalendarToken(familyID string, create bool) (string, error)
+	RotateCalendarToken(familyID string) (string, error)
+	DisableCalendar(familyID string) error
+	FamilyByCalendarToken(token string) (*Family, error)
+
+	RecordActivity(ev ActivityEvent) error
+	FamilyActivity(familyID string, from, to int64, limit int) ([]ActivityItem, error)
+
+	BuildSnapshot(familyID string, now time.Time) (*Snapshot, error)
+	GetSnapshot(familyID string) (*Snapshot, error)
+	StaleSnapshotFamilies(minEntries, maxLag int) ([]string, error)
+}
+
+// LinkStore holds access links and the invitations that mint them. Tokens
+// are only ever stored hashed; the link ID is the hash.
+type LinkStore interface {
+	CreateAccessLink(familyID, label string, expiresAt *int64) (*AccessLink, error)
+	CreateAccessLinkRole(familyID, label, role string, expiresAt *int64) (*AccessLink, error)
+	CreateAccessLinkWith(familyID, label, role string, perms LinkPermissions, expiresAt *int64) (*AccessLink, error)
+	ValidateAccessLink(token string) (*AccessLink, error)
+	ListAccessLinks(familyID string) ([]AccessLink, error)
+	GetLinkCount(familyID string) (int, error)
+	DeleteAccessLink(familyID, id string) (string, error)
+	SetLinkPermissions(id string, perms LinkPermissions) error
+	RenameAccessLink(id, label string) error
+	RotateAccessLink(id, fromHash, newHash string, graceUntil, now int64) error
+	TouchAccessLink(id string, ts int64) error
+	RecordLinkEntry(id string, ts int64) error
+	AckLinkCursor(id string, cursor, ts int64) (bool, error)
+
+	CreateInvite(inv *Invite) (string, error)
+	DeleteInvite(id string) error
+	ClaimInvite(token string, now int64) (*Invite, *AccessLink, error)
+	LinksByEmail(email string, now int64) ([]AccessLink, error)
+	CreateMagicLink(link *AccessLink, now time.Time) (string, error)
+	UseMagicLink(token string, now int64) (*AccessLink, error)
+	CreateLinkSession(link *AccessLink, deviceID string, now, expiresAt int64) (string, error)
+	RotateLinkSession(id string, now, expiresAt, graceUntil int64) (string, error)
+	ExtendLinkSession(id string, expiresAt int64) error
+	PurgeLinkSessions(now int64) (int64, error)
+
+	CreateDevice(link *AccessLink, platform string, now int64) (string, error)
+	GetDevice(token string) (*Device, error)
+	TouchDevice(id string, now int64) error
+	ListDevices(familyID string) ([]Device, error)
+	RevokeDevice(familyID, id string, now int64) error
+	GetDeviceSettings(id string) (json.RawMessage, error)
+	UpdateDeviceSettings(id string, patch json.RawMessage) (json.RawMessage, error)
+}
+
+// AccountStore holds caregivers' optional accounts, their sessions and the
+// links they remember; see accounts.go.
+type AccountStore interface {
+	CreateAccount(email, password string) (*Account, error)
+	GetAccount(id string) (*Account, error)
+	GetAccountByEmail(email string) (*Account, string, error)
+	DeleteAccount(id string) error
+	CreateAccountSession(accountID string, now time.Time) (string, error)
+	ValidateAccountSession(token string, now int64) (string, error)
+	DeleteAccountSessions(token string, everywhere bool) error
+	PurgeAccountSessions(now int64) error
+	AddAccountLink(accountID string, link *AccessLink, now int64) error
+	RemoveAccountLink(accountID, familyID string) error
+	AccountFamilies(accountID string, now int64) ([]AccountFamily, error)
+	AccountLink(accountID, familyID string, now int64) (*AccessLink, error)
+}
+
+// ConfigStore holds button configs: each family's, with its revisions, and
+// the default for families without one.
+type ConfigStore interface {
+	GetConfig(familyID string) (string, error)
+	HasConfig(familyID string) (bool, error)
+	SaveConfig(familyID, data string) error
+	SaveConfigBy(familyID, data, savedBy string) error
+	ListConfigRevisions(familyID string) ([]ConfigRevision, error)
+	GetConfigRevision(familyID string, id int64) (*ConfigRevision, error)
+	DefaultConfig() (config, source string, err error)
+	SetDefaultConfig(config string) error
+}
+
+// AdminStore holds admins, their sessions, orgs and branding.
+type AdminStore interface {
+	EnsureAdmin(username, password string) error
+	GetAdminByUsername(username string) (*Admin, error)
+	SetAdminPassword(username, password string) error
+	CreateAdminSession(adminID string, duration time.Duration) (string, error)
+	ValidateAdminSession(token string) (string, error)
+	DeleteAdminSession(token string) error
+	AdminOrg(adminID string) (string, error)
+
+	CreateOrg(name string) (*Org, error)
+	CreateOrgAdmin(orgID, username, password string) (*Admin, error)
+	GetOrg(id string) (*Org, error)
+	ListOrgs() ([]Org, error)
+
+	InstanceBranding() (Branding, error)
+	SetInstanceBranding(b Branding) error
+	OrgBranding(orgID string) (Branding, error)
+	SetOrgBranding(orgID string, b Branding) error
+}
+
+// ServerStore is everything instance-wide: announcements, client logs,
+// server keys, demo data and the store's own health.
+type ServerStore interface {
+	CreateAnnouncement(a *Announcement) error
+	ActiveAnnouncements(familyID string, now int64) ([]Announcement, error)
+	DeleteAnnouncement(id string) error
+
+	InsertClientLogs(familyID, label string, logs []ClientLog) error
+	ListClientLogs(familyID string, levels []string, startMs, endMs int64, limit int) ([]ClientLog, error)
+
+	Secret(name string) ([]byte, error)
+	claimLease(name, holder string, now, until int64) (bool, error)
+	claimDigest(date string, now int64) (bool, error)
+	SeedDemo(now time.Time, rng *rand.Rand) (int, error)
+
+	// Ready reports whether the store can serve queries.
+	Ready(ctx context.Context) error
+	CheckDB(repair bool) (*DBCheck, error)
+	StorageStats() (StorageStats, error)
+	// Path is the database file, for disk checks; "" if there isn't one.
+	Path() string
+}
@@ -0,0 +1,65 @@
+package babytrack
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeStore stands in for the database: it passes through to Store except
+// where a test sets a failure.
+type fakeStore struct {
+	Store
+	err error
+}
+
+func (f *fakeStore) GetLastEntry(familyID, typ, value string) (*Entry, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.Store.GetLastEntry(familyID, typ, value)
+}
+
+func (f *fakeStore) Ready(ctx context.Context) error { return f.err }
+
+func (f *fakeStore) Path() string { return "" }
+
+func TestHandlersWithFakeStore(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	fake := &fakeStore{Store: s.db}
+	s.db = fake
+
+	status := func() int {
+		req := httptest.NewRequest("GET", "/api/v1/status?types=feed", nil)
+		req.Header.Set("Cookie", "client_session="+link.Token)
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := status(); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	fake.err = errors.New("disk on fire")
+	if code := status(); code != http.StatusInternalServerError {
+		t.Errorf("status with a failing store = %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleReadyHealth(w, httptest.NewRequest("GET", "/healthz/ready", nil))
+	var resp struct {
+		Checks map[string]map[string]any `json:"checks"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusServiceUnavailable || resp.Checks["db"]["error"] != "disk on fire" {
+		t.Errorf("ready = %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := resp.Checks["wal"]; ok {
+		t.Errorf("WAL checked for a store without a file: %v", resp.Checks)
+	}
+}
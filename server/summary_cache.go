@@ -0,0 +1,109 @@
+package babytrack
+
+import (
+	"sync"
+	"time"
+)
+
+// Dashboards poll the daily summary, and each build rescans the day's
+// entries. Every write bumps the family's seq, so a summary built at one
+// seq stays right until the seq moves: the cache keys on it and needs no
+// hooks into the many write paths. Only erasure, which removes entries
+// without bumping seq, has to invalidate explicitly. A day still in
+// progress is also kept only briefly, since an ongoing sleep counts up to
+// now.
+
+const (
+	maxCachedSummaries = 1000
+	openDaySummaryTTL  = time.Minute
+)
+
+type summaryKey struct {
+	familyID string
+	childID  string
+	locale   string
+	start    int64 // ms; with offset, the date and timezone
+	offset   int   // seconds east of UTC
+}
+
+type cachedSummary struct {
+	seq     int64
+	expires time.Time // zero for days that are over
+	summary *DailySummary
+}
+
+// summaryCache holds built DailySummaries. The zero value is ready to use.
+type summaryCache struct {
+	mu      sync.Mutex
+	entries map[summaryKey]cachedSummary
+}
+
+func (c *summaryCache) get(key summaryKey, seq int64, now time.Time) *DailySummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[key]
+	if !ok || cached.seq != seq || (!cached.expires.IsZero() && now.After(cached.expires)) {
+		return nil
+	}
+	return cached.summary
+}
+
+func (c *summaryCache) put(key summaryKey, cached cachedSummary) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[summaryKey]cachedSummary)
+	}
+	if len(c.entries) >= maxCachedSummaries {
+		// Summaries from before the family's last write can't be hit again
+		for k, v := range c.entries {
+			if k.familyID == key.familyID && v.seq != cached.seq {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= maxCachedSummaries {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[key] = cached
+}
+
+// invalidate drops the family's summaries.
+func (c *summaryCache) invalidate(familyID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if k.familyID == familyID {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// dailySummary is buildDailySummary, cached while the family is unchanged.
+func (s *Server) dailySummary(familyID, childID string, startTime time.Time, locale *Locale) (*DailySummary, error) {
+	seq, err := s.db.FamilySeq(familyID)
+	if err != nil {
+		// Unknown family: nothing to cache
+		return buildDailySummary(s.db, familyID, childID, startTime, locale)
+	}
+	_, offset := startTime.Zone()
+	key := summaryKey{familyID: familyID, childID: childID, locale: locale.Tag, start: startTime.UnixMilli(), offset: offset}
+	now := time.Now()
+	if summary := s.summaries.get(key, seq, now); summary != nil {
+		return summary, nil
+	}
+
+	summary, err := buildDailySummary(s.db, familyID, childID, startTime, locale)
+	if err != nil {
+		return nil, err
+	}
+	cached := cachedSummary{seq: seq, summary: summary}
+	if startTime.Add(24 * time.Hour).After(now) {
+		cached.expires = now.Add(openDaySummaryTTL)
+	}
+	s.summaries.put(key, cached)
+	return summary, nil
+}
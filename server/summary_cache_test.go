@@ -0,0 +1,51 @@
+package babytrack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummaryCache(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	day := time.Now().Add(-48 * time.Hour).Truncate(24 * time.Hour)
+	s.db.UpsertEntry(&Entry{ID: "e1", FamilyID: family.ID, Ts: day.Add(time.Hour).UnixMilli(), Type: "feed", Value: "bf"})
+
+	locale := locales[defaultLocale]
+	first, err := s.dailySummary(family.ID, "", day, locale)
+	if err != nil || first.Totals["feed"] != 1 {
+		t.Fatalf("summary = %+v, %v", first, err)
+	}
+
+	// Served from the cache while seq is unchanged
+	s.db.(*DB).Exec("DELETE FROM entries WHERE id = 'e1'")
+	if again, _ := s.dailySummary(family.ID, "", day, locale); again != first {
+		t.Error("past day not cached")
+	}
+
+	// Any write moves seq on
+	s.db.UpsertEntry(&Entry{ID: "e2", FamilyID: family.ID, Ts: day.Add(2 * time.Hour).UnixMilli(), Type: "nappy", Value: "wet"})
+	fresh, _ := s.dailySummary(family.ID, "", day, locale)
+	if fresh == first || fresh.Totals["feed"] != 0 || fresh.Totals["nappy"] != 1 {
+		t.Errorf("stale summary: %+v", fresh.Totals)
+	}
+
+	s.summaries.invalidate(family.ID)
+	if len(s.summaries.entries) != 0 {
+		t.Errorf("invalidate left %d", len(s.summaries.entries))
+	}
+
+	// Today's summary only lives for a minute
+	today := time.Now().Truncate(24 * time.Hour)
+	s.dailySummary(family.ID, "", today, locale)
+	seq, _ := s.db.FamilySeq(family.ID)
+	_, offset := today.Zone()
+	key := summaryKey{familyID: family.ID, locale: locale.Tag, start: today.UnixMilli(), offset: offset}
+	if s.summaries.get(key, seq, time.Now()) == nil {
+		t.Fatal("today not cached")
+	}
+	if s.summaries.get(key, seq, time.Now().Add(2*openDaySummaryTTL)) != nil {
+		t.Error("today cached past its TTL")
+	}
+}
@@ -0,0 +1,85 @@
+package babytrack
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// systemd integration without libsystemd: socket activation via LISTEN_FDS
+// and readiness/watchdog notifications via NOTIFY_SOCKET. Both are no-ops
+// when not running under systemd.
+
+// listenFDsStart is the first passed file descriptor (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+// activationFDCount returns how many sockets systemd passed to this process.
+func activationFDCount(pid int, listenPID, listenFDs string) int {
+	if p, err := strconv.Atoi(listenPID); err != nil || p != pid {
+		return 0
+	}
+	n, err := strconv.Atoi(listenFDs)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// systemdListener returns the first socket-activated listener, or nil if the
+// process wasn't socket activated.
+func systemdListener() (net.Listener, error) {
+	n := activationFDCount(os.Getpid(), os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"))
+	// Don't leak activation state into child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n == 0 {
+		return nil, nil
+	}
+
+	f := os.NewFile(uintptr(listenFDsStart), "LISTEN_FD_3")
+	ln, err := net.FileListener(f)
+	f.Close() // FileListener dups the descriptor
+	if err != nil {
+		return nil, fmt.Errorf("socket activation fd %d: %w", listenFDsStart, err)
+	}
+	return ln, nil
+}
+
+// sdNotify sends a state string such as "READY=1" to the service manager.
+// It reports false without error when NOTIFY_SOCKET is unset.
+func sdNotify(state string) (bool, error) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return false, nil
+	}
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:] // abstract namespace
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// sdWatchdogInterval returns how often to send WATCHDOG=1, or 0 if the
+// service has no watchdog configured.
+func sdWatchdogInterval() time.Duration {
+	if p := os.Getenv("WATCHDOG_PID"); p != "" && p != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	// Ping at half the timeout, as recommended by sd_watchdog_enabled(3)
+	return time.Duration(usec) * time.Microsecond / 2
+}
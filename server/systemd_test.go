@@ -0,0 +1,75 @@
+package babytrack
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestActivationFDCount(t *testing.T) {
+	tests := []struct {
+		pid       int
+		listenPID string
+		listenFDs string
+		want      int
+	}{
+		{42, "42", "1", 1},
+		{42, "42", "2", 2},
+		{42, "41", "1", 0}, // meant for another process
+		{42, "", "1", 0},
+		{42, "42", "x", 0},
+	}
+	for _, tt := range tests {
+		if got := activationFDCount(tt.pid, tt.listenPID, tt.listenFDs); got != tt.want {
+			t.Errorf("activationFDCount(%d, %q, %q) = %d, want %d", tt.pid, tt.listenPID, tt.listenFDs, got, tt.want)
+		}
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := sdNotify("READY=1"); sent || err != nil {
+		t.Errorf("expected no-op without NOTIFY_SOCKET, got %v %v", sent, err)
+	}
+
+	path := t.TempDir() + "/notify.sock"
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	if sent, err := sdNotify("READY=1"); !sent || err != nil {
+		t.Fatalf("expected notification to be sent, got %v %v", sent, err)
+	}
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read notification: %v", err)
+	}
+	if string(buf[:n]) != "READY=1" {
+		t.Errorf("expected READY=1, got %q", buf[:n])
+	}
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "")
+	if got := sdWatchdogInterval(); got != 0 {
+		t.Errorf("expected 0 without watchdog, got %v", got)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	if got := sdWatchdogInterval(); got != 15*time.Second {
+		t.Errorf("expected 15s, got %v", got)
+	}
+
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(1))
+	if got := sdWatchdogInterval(); got != 0 {
+		t.Errorf("expected 0 for another process's watchdog, got %v", got)
+	}
+}
@@ -0,0 +1,145 @@
+package babytrack
+
+import (
+	"archive/zip"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// A takeout is everything a family has logged, as a zip a caregiver can
+// keep when they stop using the server:
+//
+//	manifest.json          family, export time and counts
+//	entries.json           every live entry, oldest first, data payloads inline
+//	config.json            the button config, if one was saved
+//	summaries/DATE.json    the daily summary for each day with entries
+//
+// Days are split in the ?offset= given (minutes east of UTC), as for
+// summaries.
+
+type takeoutManifest struct {
+	FamilyID   string `json:"family_id"`
+	FamilyName string `json:"family_name"`
+	ExportedAt int64  `json:"exported_at"`
+	Offset     int    `json:"offset"`
+	Entries    int    `json:"entries"`
+	Days       int    `json:"days"`
+}
+
+// takeoutFile is one file in the zip, marshalled as indented JSON unless raw
+// is set.
+type takeoutFile struct {
+	name string
+	v    any
+	raw  []byte
+}
+
+// buildTakeout collects the files for a family's takeout.
+func buildTakeout(db Store, familyID string, loc *time.Location, locale *Locale, now time.Time) ([]takeoutFile, error) {
+	family, err := db.GetFamily(familyID)
+	if err != nil {
+		return nil, err
+	}
+	all, err := db.GetEntries(familyID, 0)
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for _, e := range all {
+		if !e.Deleted {
+			entries = append(entries, e)
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b Entry) int { return cmp.Compare(a.Ts, b.Ts) })
+
+	var days []time.Time
+	for _, e := range entries {
+		t := time.UnixMilli(e.Ts).In(loc)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		if len(days) == 0 || !days[len(days)-1].Equal(day) {
+			days = append(days, day)
+		}
+	}
+
+	_, offset := now.In(loc).Zone()
+	files := []takeoutFile{
+		{name: "manifest.json", v: takeoutManifest{
+			FamilyID:   familyID,
+			FamilyName: family.Name,
+			ExportedAt: now.UnixMilli(),
+			Offset:     offset / 60,
+			Entries:    len(entries),
+			Days:       len(days),
+		}},
+		{name: "entries.json", v: entries},
+	}
+	config, err := db.GetConfig(familyID)
+	if err != nil {
+		return nil, err
+	}
+	if config != "" {
+		files = append(files, takeoutFile{name: "config.json", raw: []byte(config)})
+	}
+	for _, day := range days {
+		summary, err := buildDailySummary(db, familyID, "", day, locale)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, takeoutFile{name: "summaries/" + day.Format("2006-01-02") + ".json", v: summary})
+	}
+	return files, nil
+}
+
+// handleTakeout serves GET /api/v1/takeout as a zip download.
+func (s *Server) handleTakeout(w http.ResponseWriter, r *http.Request) {
+	link := accessLinkFrom(r.Context())
+	if !link.CanExport {
+		jsonError(w, http.StatusForbidden, errCodeForbidden, "this link can't export data")
+		return
+	}
+	familyID := link.FamilyID
+	_, loc, ok := parseDayParams(w, r)
+	if !ok {
+		return
+	}
+	settings, _ := s.db.GetFamilySettings(familyID)
+	now := time.Now()
+	files, err := buildTakeout(s.db, familyID, loc, resolveLocale(r, settings.Locale), now)
+	if err != nil {
+		serverError(w, "failed to build takeout", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="babytrack-%s.zip"`, now.In(loc).Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		data := f.raw
+		if data == nil {
+			if data, err = json.MarshalIndent(f.v, "", "  "); err != nil {
+				break
+			}
+		}
+		var fw io.Writer
+		if fw, err = zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now}); err != nil {
+			break
+		}
+		if _, err = fw.Write(data); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		// Headers are sent; the truncated zip won't open
+		slog.Error("failed to write takeout", "family", familyID, "error", err)
+	}
+}
@@ -0,0 +1,79 @@
+package babytrack
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTakeout(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	grandma, _ := s.db.CreateAccessLinkRole(family.ID, "Grandma", roleSummary, nil)
+	day := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	s.db.UpsertEntry(&Entry{ID: "e1", FamilyID: family.ID, Ts: day.UnixMilli(), Type: "feed", Value: "bf"})
+	s.db.UpsertEntry(&Entry{ID: "e2", FamilyID: family.ID, Ts: day.Add(24 * time.Hour).UnixMilli(), Type: "nappy", Value: "wet"})
+	s.db.UpsertEntry(&Entry{ID: "e3", FamilyID: family.ID, Ts: day.UnixMilli(), Type: "feed", Value: "bottle"})
+	s.db.DeleteEntry(family.ID, "e3")
+	s.db.SaveConfig(family.ID, `[{"category":"feed"}]`)
+	handler := s.routes()
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/takeout?offset=0", nil)
+		req.AddCookie(&http.Cookie{Name: "client_session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	if w := get(grandma.Token); w.Code != http.StatusForbidden {
+		t.Errorf("summary link: status %d, want 403", w.Code)
+	}
+	w := get(link.Token)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	want := []string{"config.json", "entries.json", "manifest.json", "summaries/2024-05-01.json", "summaries/2024-05-02.json"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("files = %v, want %v", names, want)
+	}
+
+	var entries []Entry
+	json.Unmarshal(files["entries.json"], &entries)
+	if len(entries) != 2 || entries[0].ID != "e1" || entries[1].ID != "e2" {
+		t.Errorf("entries = %+v", entries)
+	}
+	var summary DailySummary
+	json.Unmarshal(files["summaries/2024-05-01.json"], &summary)
+	if summary.Totals["feed"] != 1 {
+		t.Errorf("summary totals = %v", summary.Totals)
+	}
+	var manifest takeoutManifest
+	json.Unmarshal(files["manifest.json"], &manifest)
+	if manifest.FamilyName != "Test Baby" || manifest.Entries != 2 || manifest.Days != 2 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+}
@@ -0,0 +1,136 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Temperature readings are "temp" entries whose data is TempData. Readings
+// at or above the family's fever threshold raise a fever alert. Symptoms
+// are ordinary entries (e.g. type "symptom", value "cough") and need no
+// server support.
+
+// TempData is the structured payload of a "temp" entry.
+type TempData struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`           // "C" or "F"
+	Site  string  `json:"site,omitempty"` // ear, forehead, armpit, ...
+}
+
+// Celsius returns the reading in °C.
+func (t TempData) Celsius() float64 {
+	if strings.EqualFold(t.Unit, "F") {
+		return (t.Value - 32) * 5 / 9
+	}
+	return t.Value
+}
+
+func validateTempData(e *Entry) error {
+	var t TempData
+	if err := json.Unmarshal(e.Data, &t); err != nil {
+		return errors.New("temp data: " + err.Error())
+	}
+	if !strings.EqualFold(t.Unit, "C") && !strings.EqualFold(t.Unit, "F") {
+		return errors.New("temp unit must be C or F")
+	}
+	if c := t.Celsius(); c < 30 || c > 45 {
+		return errors.New("temperature out of range")
+	}
+	return nil
+}
+
+// feverAlertMaxAge stops readings synced long after the fact from alerting.
+const feverAlertMaxAge = 24 * time.Hour
+
+// checkFever raises a fever alert if e is a recent temperature reading at or
+// above the family's threshold.
+func (s *Server) checkFever(familyID, label string, e *Entry) {
+	if e.Type != "temp" || e.Deleted || len(e.Data) == 0 {
+		return
+	}
+	if time.Since(time.UnixMilli(e.Ts)) > feverAlertMaxAge {
+		return
+	}
+	var t TempData
+	if json.Unmarshal(e.Data, &t) != nil {
+		return
+	}
+	settings, err := s.db.GetFamilySettings(familyID)
+	if err != nil {
+		slog.Error("failed to load family settings", "error", err, "family_id", familyID)
+		return
+	}
+	c, threshold := t.Celsius(), settings.FeverThreshold()
+	if c < threshold {
+		return
+	}
+	s.sendAlert(Alert{
+		FamilyID: familyID,
+		Kind:     "fever",
+		Message:  fmt.Sprintf("Temperature %.1f°C (fever threshold %.1f°C)", c, threshold),
+		Label:    label,
+		Data:     map[string]any{"entry_id": e.ID, "entry_ts": e.Ts, "celsius": c, "threshold_c": threshold},
+	})
+}
+
+type TempPoint struct {
+	Ts      int64   `json:"ts"`
+	Celsius float64 `json:"celsius"`
+	Value   float64 `json:"value"`
+	Unit    string  `json:"unit"`
+	Site    string  `json:"site,omitempty"`
+	Fever   bool    `json:"fever"`
+}
+
+type TempSeries struct {
+	ThresholdC float64     `json:"threshold_c"`
+	Points     []TempPoint `json:"points"`
+}
+
+// temperatureSeries writes the family's readings between ?from= and ?to=
+// (ms, default the last 7 days), oldest first.
+func (s *Server) temperatureSeries(w http.ResponseWriter, r *http.Request, familyID string) {
+	from, to, ok := parseRangeParams(w, r, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+
+	settings, err := s.db.GetFamilySettings(familyID)
+	if err != nil {
+		serverError(w, "failed to load family settings", err)
+		return
+	}
+	entries, err := s.db.GetEntriesOfType(familyID, "temp", from, to)
+	if err != nil {
+		serverError(w, "failed to get temperature entries", err)
+		return
+	}
+
+	series := TempSeries{ThresholdC: settings.FeverThreshold(), Points: []TempPoint{}}
+	for _, e := range entries {
+		var t TempData
+		if json.Unmarshal(e.Data, &t) != nil {
+			continue
+		}
+		series.Points = append(series.Points, TempPoint{
+			Ts: e.Ts, Celsius: t.Celsius(), Value: t.Value, Unit: strings.ToUpper(t.Unit), Site: t.Site,
+			Fever: t.Celsius() >= series.ThresholdC,
+		})
+	}
+	jsonOK(w, series)
+}
+
+// handleTemperature serves GET /api/v1/temperature for the caller's family.
+func (s *Server) handleTemperature(w http.ResponseWriter, r *http.Request) {
+	s.temperatureSeries(w, r, accessLinkFrom(r.Context()).FamilyID)
+}
+
+// adminTemperature serves GET /admin/families/{id}/temperature.
+func (s *Server) adminTemperature(w http.ResponseWriter, r *http.Request) {
+	s.temperatureSeries(w, r, r.PathValue("id"))
+}
@@ -0,0 +1,152 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTempData(t *testing.T) {
+	if c := (TempData{Value: 100.4, Unit: "F"}).Celsius(); c < 37.99 || c > 38.01 {
+		t.Errorf("100.4F = %.2fC", c)
+	}
+	tests := []struct {
+		data string
+		ok   bool
+	}{
+		{`{"value":37.2,"unit":"C"}`, true},
+		{`{"value":101,"unit":"f","site":"ear"}`, true},
+		{`{"value":37.2,"unit":"K"}`, false},
+		{`{"value":372,"unit":"C"}`, false},
+	}
+	for _, tt := range tests {
+		e := &Entry{Type: "temp", Value: "temp", Data: json.RawMessage(tt.data)}
+		if err := validateEntryData(e); (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok=%v", tt.data, err, tt.ok)
+		}
+	}
+}
+
+func TestFeverAlert(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hooks := make(chan Alert, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		json.NewDecoder(r.Body).Decode(&a)
+		hooks <- a
+	}))
+	defer hook.Close()
+
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	db.SaveFamilySettings(family.ID, FamilySettings{FeverThresholdC: 37.8, WebhookURL: hook.URL})
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	header := http.Header{}
+	header.Add("Cookie", "client_session="+link.Token)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+
+	now := time.Now().UnixMilli()
+	send := func(id string, data string) {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"entry","action":"add","entry":{"id":"`+id+
+			`","ts":`+strconv.FormatInt(now, 10)+`,"type":"temp","value":"temp","data":`+data+`}}`))
+	}
+
+	send("t1", `{"value":37.5,"unit":"C"}`)
+	skipUntilType(t, conn, "entry_ack")
+	send("t2", `{"value":100.6,"unit":"F"}`)
+	alert := skipUntilType(t, conn, "alert")["alert"].(map[string]any)
+	if alert["kind"] != "fever" || alert["label"] != "Mum" {
+		t.Errorf("alert = %v", alert)
+	}
+	select {
+	case a := <-hooks:
+		if a.Kind != "fever" || a.FamilyID != family.ID {
+			t.Errorf("webhook alert = %+v", a)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not called")
+	}
+	select {
+	case a := <-hooks:
+		t.Errorf("unexpected second webhook: %+v", a)
+	default:
+	}
+
+	// Time series, as the client sees it
+	req, _ := http.NewRequest("GET", server.URL+"/api/v1/temperature?from="+strconv.FormatInt(now-1000, 10), nil)
+	req.Header.Set("Cookie", "client_session="+link.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	var series TempSeries
+	json.Unmarshal(body, &series)
+	if resp.StatusCode != http.StatusOK || series.ThresholdC != 37.8 || len(series.Points) != 2 {
+		t.Fatalf("series: %d %s", resp.StatusCode, body)
+	}
+	if series.Points[0].Fever || !series.Points[1].Fever || series.Points[1].Unit != "F" {
+		t.Errorf("points = %+v", series.Points)
+	}
+
+	resp, _ = http.Get(server.URL + "/api/v1/temperature")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unauthenticated series: status %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+}
+
+func TestFamilySettingsEndpoints(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+
+	put := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/admin/families/"+id+"/settings", strings.NewReader(body))
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		s.updateFamilySettings(w, req)
+		return w
+	}
+
+	if w := put(family.ID, `{"fever_threshold_c":45,"webhook_url":"ftp://x"}`); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "fever_threshold_c") || !strings.Contains(w.Body.String(), "webhook_url") {
+		t.Errorf("invalid settings: %d %s", w.Code, w.Body)
+	}
+	if w := put("nope", `{}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown family: %d", w.Code)
+	}
+	if w := put(family.ID, `{"fever_threshold_c":38.5,"webhook_url":"https://example.com/hook"}`); w.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", w.Code, w.Body)
+	}
+
+	fs, err := s.db.GetFamilySettings(family.ID)
+	if err != nil || fs.FeverThreshold() != 38.5 || fs.WebhookURL != "https://example.com/hook" {
+		t.Errorf("settings = %+v, %v", fs, err)
+	}
+	if fs := (FamilySettings{}); fs.FeverThreshold() != defaultFeverThresholdC {
+		t.Errorf("default threshold = %v", fs.FeverThreshold())
+	}
+}
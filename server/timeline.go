@@ -0,0 +1,185 @@
+package babytrack
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// The timeline pairs entries server-side so clients and reports don't each
+// reimplement it. Duration entries (started and stopped) are blocks as they
+// stand. Other entries in stateful categories (sleep, by default) set a
+// state that lasts until the next entry of the same type, and also become
+// blocks; everything else is a point event.
+
+const maxTimelineSpan = 92 * 24 * time.Hour
+
+type TimelineItem struct {
+	Kind        string          `json:"kind"` // "point" or "block"
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Value       string          `json:"value"`
+	Start       int64           `json:"start"`
+	End         *int64          `json:"end,omitempty"` // blocks only; nil while ongoing
+	DurationMin *int            `json:"duration_min,omitempty"`
+	Ongoing     bool            `json:"ongoing,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+}
+
+type Timeline struct {
+	From  int64          `json:"from"`
+	To    int64          `json:"to"`
+	Items []TimelineItem `json:"items"` // by start time
+}
+
+// statefulTypes returns the entry types whose categories are stateful in a
+// family's button config. Sleep is stateful unless the config says
+// otherwise, matching the app's default buttons.
+func statefulTypes(configJSON string) map[string]bool {
+	types := map[string]bool{"sleep": true}
+	var groups []struct {
+		Category string `json:"category"`
+		Stateful bool   `json:"stateful"`
+	}
+	if json.Unmarshal([]byte(configJSON), &groups) == nil {
+		for _, g := range groups {
+			types[g.Category] = g.Stateful
+		}
+	}
+	return types
+}
+
+// buildTimeline returns the items overlapping [from, to). A block that
+// started before from is included with its real start.
+func buildTimeline(db Store, familyID string, from, to int64, now time.Time) (*Timeline, error) {
+	config, err := db.GetConfig(familyID)
+	if err != nil {
+		return nil, err
+	}
+	stateful := statefulTypes(config)
+	entries, err := db.GetEntriesForDate(familyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group state changes by type, including the state in force at from
+	// and the change that ends the last one.
+	states := map[string][]Entry{}
+	for typ, ok := range stateful {
+		if !ok {
+			continue
+		}
+		if e, err := db.GetLastEntryBefore(familyID, typ, from); err == nil {
+			if !isDuration(e) {
+				states[typ] = append(states[typ], *e)
+			}
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	spanning, err := db.GetDurationEntriesSpanning(familyID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	tl := &Timeline{From: from, To: to, Items: []TimelineItem{}}
+	for _, e := range spanning {
+		tl.Items = append(tl.Items, durationItem(e, now))
+	}
+	for _, e := range entries {
+		if isDuration(&e) {
+			tl.Items = append(tl.Items, durationItem(e, now))
+			continue
+		}
+		if stateful[e.Type] {
+			states[e.Type] = append(states[e.Type], e)
+			continue
+		}
+		tl.Items = append(tl.Items, TimelineItem{
+			Kind: "point", ID: e.ID, Type: e.Type, Value: e.Value, Start: e.Ts, Data: e.Data,
+		})
+	}
+
+	for typ, changes := range states {
+		next, err := db.GetFirstEntryFrom(familyID, typ, to)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		for i, e := range changes {
+			item := TimelineItem{Kind: "block", ID: e.ID, Type: e.Type, Value: e.Value, Start: e.Ts, Data: e.Data}
+			var end int64
+			switch {
+			case i+1 < len(changes):
+				end = changes[i+1].Ts
+			case next != nil:
+				end = next.Ts
+			default:
+				item.Ongoing = true
+				end = now.UnixMilli()
+			}
+			mins := int(time.Duration(end-e.Ts) * time.Millisecond / time.Minute)
+			item.DurationMin = &mins
+			if !item.Ongoing {
+				item.End = &end
+			}
+			tl.Items = append(tl.Items, item)
+		}
+	}
+
+	slices.SortFunc(tl.Items, func(a, b TimelineItem) int {
+		return cmp.Or(cmp.Compare(a.Start, b.Start), cmp.Compare(a.ID, b.ID))
+	})
+	return tl, nil
+}
+
+func isDuration(e *Entry) bool {
+	return e.Ongoing || e.EndedTs != nil
+}
+
+// durationItem makes a block from a started/stopped duration entry.
+func durationItem(e Entry, now time.Time) TimelineItem {
+	item := TimelineItem{
+		Kind: "block", ID: e.ID, Type: e.Type, Value: e.Value, Start: e.Ts, Data: e.Data,
+		End: e.EndedTs, Ongoing: e.EndedTs == nil,
+	}
+	end := now.UnixMilli()
+	if e.EndedTs != nil {
+		end = *e.EndedTs
+	}
+	mins := int(time.Duration(end-e.Ts) * time.Millisecond / time.Minute)
+	item.DurationMin = &mins
+	return item
+}
+
+// timelineReport writes the timeline for ?from=&to= (ms, default the last
+// 24 hours).
+func (s *Server) timelineReport(w http.ResponseWriter, r *http.Request, familyID string) {
+	from, to, ok := parseRangeParams(w, r, 24*time.Hour)
+	if !ok {
+		return
+	}
+	if to-from > maxTimelineSpan.Milliseconds() {
+		validationError(w, map[string]string{"from": "range must be at most 92 days"})
+		return
+	}
+	tl, err := buildTimeline(s.db, familyID, from, to, time.Now())
+	if err != nil {
+		serverError(w, "failed to build timeline", err)
+		return
+	}
+	jsonOK(w, tl)
+}
+
+// handleTimeline serves GET /api/v1/timeline for the caller's family.
+func (s *Server) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	s.timelineReport(w, r, accessLinkFrom(r.Context()).FamilyID)
+}
+
+// adminTimeline serves GET /admin/families/{id}/timeline.
+func (s *Server) adminTimeline(w http.ResponseWriter, r *http.Request) {
+	s.timelineReport(w, r, r.PathValue("id"))
+}
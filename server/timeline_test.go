@@ -0,0 +1,97 @@
+package babytrack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	family, _ := db.CreateFamily("Test", "")
+
+	base := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	add := func(id string, at time.Duration, typ, value string) {
+		e := &Entry{ID: id, FamilyID: family.ID, Ts: base.Add(at).UnixMilli(), Type: typ, Value: value}
+		if err := db.UpsertEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("s1", -time.Hour, "sleep", "sleeping") // before the range, still in force at from
+	add("s2", 65*time.Minute, "sleep", "awake")
+	add("f1", 70*time.Minute, "feed", "bf")
+	add("s3", 3*time.Hour, "sleep", "sleeping")
+	add("s4", 5*time.Hour, "sleep", "awake") // after the range, ends s3
+
+	from, to := base.UnixMilli(), base.Add(4*time.Hour).UnixMilli()
+	tl, err := buildTimeline(db, family.ID, from, to, base.Add(6*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, it := range tl.Items {
+		ids = append(ids, it.ID)
+	}
+	if len(tl.Items) != 4 {
+		t.Fatalf("items = %v", ids)
+	}
+	s1, s2, f1, s3 := tl.Items[0], tl.Items[1], tl.Items[2], tl.Items[3]
+	if s1.ID != "s1" || s1.Kind != "block" || *s1.DurationMin != 125 || *s1.End != base.Add(65*time.Minute).UnixMilli() {
+		t.Errorf("s1 = %+v", s1)
+	}
+	if s2.ID != "s2" || *s2.DurationMin != 115 {
+		t.Errorf("s2 = %+v", s2)
+	}
+	if f1.Kind != "point" || f1.End != nil || f1.DurationMin != nil {
+		t.Errorf("f1 = %+v", f1)
+	}
+	if s3.Ongoing || *s3.DurationMin != 120 {
+		t.Errorf("s3 = %+v", s3)
+	}
+
+	// A family whose config makes feed stateful, with the last state ongoing
+	db.SaveConfig(family.ID, `[{"category":"feed","stateful":true,"buttons":[]}]`)
+	tl, _ = buildTimeline(db, family.ID, base.Add(4*time.Hour).UnixMilli(), base.Add(7*time.Hour).UnixMilli(), base.Add(6*time.Hour))
+	var feed, awake *TimelineItem
+	for i := range tl.Items {
+		switch tl.Items[i].ID {
+		case "f1":
+			feed = &tl.Items[i]
+		case "s4":
+			awake = &tl.Items[i]
+		}
+	}
+	if feed == nil || !feed.Ongoing || feed.End != nil || *feed.DurationMin != 290 {
+		t.Errorf("feed = %+v", feed)
+	}
+	if awake == nil || !awake.Ongoing || *awake.DurationMin != 60 {
+		t.Errorf("awake = %+v", awake)
+	}
+}
+
+func TestTimelineRange(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test", "")
+
+	for query, want := range map[string]int{
+		"":                            http.StatusOK,
+		"?from=abc":                   http.StatusBadRequest,
+		"?from=2000&to=1000":          http.StatusBadRequest,
+		"?from=0&to=99999999999":      http.StatusBadRequest, // more than 92 days
+		"?from=0&to=9000000000000000": http.StatusBadRequest, // would overflow a Duration
+	} {
+		req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/timeline"+query, nil)
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.adminTimeline(w, req)
+		if w.Code != want {
+			t.Errorf("%q: status %d, want %d", query, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// A client with the whole history cached only needs to hear about
+// deletions to check it is still right, so it can ask for just the IDs of
+// entries deleted since a cursor rather than every change. The returned
+// cursor only covers deletions: it must not replace the client's sync
+// cursor, or it would skip the adds and updates in between.
+
+// maxTombstones caps one page of deleted IDs.
+const maxTombstones = 5000
+
+// tombstonesResponse is the page of entries deleted after cursor that
+// clients get over WS and HTTP.
+func (s *Server) tombstonesResponse(familyID, childID string, cursor int64, limit int) (map[string]any, error) {
+	if limit <= 0 || limit > maxTombstones {
+		limit = maxTombstones
+	}
+	ids, last, hasMore, err := s.db.GetDeletedSinceCursor(familyID, childID, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"type":     "tombstones_response",
+		"ids":      ids,
+		"cursor":   last,
+		"has_more": hasMore,
+	}, nil
+}
+
+// handleTombstonesMessage answers {"type":"tombstones_request","cursor":N}.
+func (s *Server) handleTombstonesMessage(c *Client, msg WSMessage) {
+	resp, err := s.tombstonesResponse(c.familyID, c.childID, msg.Cursor, msg.Limit)
+	if err != nil {
+		c.log().Error("failed to get deleted entries", "error", err)
+		return
+	}
+	data, _ := json.Marshal(resp)
+	c.send <- data
+}
+
+// handleTombstones handles GET /api/v1/tombstones?cursor=&limit=&child=.
+func (s *Server) handleTombstones(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var cursor int64
+	var limit int
+	fields := map[string]string{}
+	if v := q.Get("cursor"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			fields["cursor"] = "must be a non-negative integer"
+		}
+		cursor = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			fields["limit"] = "must be a positive integer"
+		}
+		limit = n
+	}
+	childID := q.Get("child")
+	if len(childID) > maxChildIDLen {
+		fields["child"] = errChildIDTooLong.Error()
+	}
+	if len(fields) > 0 {
+		validationError(w, fields)
+		return
+	}
+
+	resp, err := s.tombstonesResponse(accessLinkFrom(r.Context()).FamilyID, childID, cursor, limit)
+	if err != nil {
+		serverError(w, "failed to get deleted entries", err)
+		return
+	}
+	delete(resp, "type")
+	jsonOK(w, resp)
+}
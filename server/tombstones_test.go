@@ -0,0 +1,65 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTombstones(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	ts := time.Now().UnixMilli()
+	for _, id := range []string{"e1", "e2", "e3", "e4"} {
+		s.db.UpsertEntry(&Entry{ID: id, FamilyID: family.ID, Ts: ts, Type: "feed"})
+	}
+	s.db.DeleteEntry(family.ID, "e2")
+	s.db.DeleteEntry(family.ID, "e4")
+	s.db.UpsertEntry(&Entry{ID: "e5", FamilyID: family.ID, Ts: ts, Type: "feed"})
+
+	handler := s.routes()
+	get := func(query string) (int, map[string]any) {
+		req := httptest.NewRequest("GET", "/api/v1/tombstones"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "client_session", Value: link.Token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := get("?cursor=0")
+	if code != http.StatusOK || mustJSON(resp["ids"]) != `["e2","e4"]` || resp["cursor"] != 6.0 || resp["has_more"] != false {
+		t.Fatalf("tombstones: %d %v", code, resp)
+	}
+	if _, resp := get("?cursor=0&limit=1"); mustJSON(resp["ids"]) != `["e2"]` || resp["cursor"] != 5.0 || resp["has_more"] != true {
+		t.Errorf("first page: %v", resp)
+	}
+	if _, resp := get("?cursor=6"); mustJSON(resp["ids"]) != `[]` || resp["cursor"] != 6.0 {
+		t.Errorf("caught up: %v", resp)
+	}
+	if code, _ := get("?cursor=x"); code != http.StatusBadRequest {
+		t.Errorf("bad cursor: %d", code)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	skipUntilType(t, conn, "init")
+	conn.WriteJSON(map[string]any{"type": "tombstones_request", "cursor": 5})
+	if m := skipUntilType(t, conn, "tombstones_response"); mustJSON(m["ids"]) != `["e4"]` {
+		t.Errorf("ws tombstones: %v", m)
+	}
+}
@@ -0,0 +1,217 @@
+package babytrack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Deleted entries are tombstones (deleted = 1) so the deletion syncs, which
+// also means a buggy client can wipe a family's history in one burst. The
+// admin can browse tombstones newest-first and restore them in bulk; a
+// restore bumps each entry's seq so every device picks it up on resync.
+
+const (
+	defaultEntryPageSize = 100
+	maxEntryPageSize     = 1000
+	maxRestoreIDs        = 1000
+)
+
+// ListEntries returns a family's entries, most recently changed first. With
+// deleted set only tombstones are returned, otherwise only live entries.
+// from/to bound updated_at (to exclusive, 0 for no bound) and beforeSeq
+// continues from a previous page (0 for the first). Also returns whether
+// there are more.
+func (db *DB) ListEntries(familyID string, deleted bool, from, to, beforeSeq int64, limit int) ([]Entry, bool, error) {
+	rows, err := db.Query(
+		`SELECT `+entryColumns+`
+		 FROM entries
+		 WHERE family_id = ? AND deleted = ?
+		   AND updated_at >= ? AND (? = 0 OR updated_at < ?)
+		   AND (? = 0 OR seq < ?)
+		 ORDER BY seq DESC
+		 LIMIT ?`,
+		familyID, deleted, from, to, to, beforeSeq, beforeSeq, limit+1,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		entries = append(entries, *e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+	return entries, hasMore, nil
+}
+
+// RestoreEntries undeletes the family's tombstoned entries with the given
+// IDs, or if ids is empty those deleted between from and to (updated_at, to
+// exclusive). Returns the number restored.
+func (db *DB) RestoreEntries(familyID string, ids []string, from, to int64) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if len(ids) == 0 {
+		rows, err := tx.Query(
+			`SELECT id FROM entries
+			 WHERE family_id = ? AND deleted = 1 AND updated_at >= ? AND updated_at < ?
+			 ORDER BY seq`,
+			familyID, from, to,
+		)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	var seq int64
+	if err := tx.QueryRow("SELECT seq FROM families WHERE id = ?", familyID).Scan(&seq); err != nil {
+		return 0, err
+	}
+	now := time.Now().UnixMilli()
+	restored := 0
+	var days []int64 // ts of each restored entry
+	for _, id := range ids {
+		var ts int64
+		err := tx.QueryRow(
+			`UPDATE entries SET deleted = 0, updated_at = ?, seq = ?
+			 WHERE id = ? AND family_id = ? AND deleted = 1
+			 RETURNING ts`,
+			now, seq+1, id, familyID,
+		).Scan(&ts)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		seq++
+		restored++
+		days = append(days, ts)
+	}
+	if _, err := tx.Exec("UPDATE families SET seq = ? WHERE id = ?", seq, familyID); err != nil {
+		return 0, err
+	}
+	if err := touchRollups(tx, familyID, days...); err != nil {
+		return 0, err
+	}
+	return restored, tx.Commit()
+}
+
+// listEntries handles GET /admin/families/{id}/entries. ?deleted=true lists
+// tombstones instead of live entries; ?from= and ?to= (ms) bound when they
+// last changed; ?limit= sets the page size and ?before= takes the previous
+// page's next_before.
+func (s *Server) listEntries(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	q := r.URL.Query()
+	fields := map[string]string{}
+	ints := map[string]int64{}
+	for _, name := range []string{"from", "to", "before", "limit"} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				fields[name] = "must be a non-negative integer"
+				continue
+			}
+			ints[name] = n
+		}
+	}
+	limit := int(ints["limit"])
+	if limit == 0 {
+		limit = defaultEntryPageSize
+	} else if limit > maxEntryPageSize {
+		fields["limit"] = "must be at most " + strconv.Itoa(maxEntryPageSize)
+	}
+	if len(fields) > 0 {
+		validationError(w, fields)
+		return
+	}
+	if _, err := s.db.GetFamily(familyID); err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+
+	entries, hasMore, err := s.db.ListEntries(familyID, q.Get("deleted") == "true", ints["from"], ints["to"], ints["before"], limit)
+	if err != nil {
+		serverError(w, "failed to list entries", err)
+		return
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	resp := map[string]any{"entries": entries}
+	if hasMore {
+		resp["next_before"] = entries[len(entries)-1].Seq
+	}
+	jsonOK(w, resp)
+}
+
+type restoreRequest struct {
+	IDs  []string `json:"ids"`
+	From int64    `json:"from"` // deleted at or after, ms; used when ids is empty
+	To   int64    `json:"to"`   // deleted before, ms
+}
+
+// restoreEntries handles POST /admin/families/{id}/entries/restore.
+func (s *Server) restoreEntries(w http.ResponseWriter, r *http.Request) {
+	familyID := r.PathValue("id")
+	var req restoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	switch {
+	case len(req.IDs) > maxRestoreIDs:
+		validationError(w, map[string]string{"ids": "at most " + strconv.Itoa(maxRestoreIDs) + " per request"})
+		return
+	case len(req.IDs) == 0 && req.To <= req.From:
+		validationError(w, map[string]string{"ids": "give ids, or from and to"})
+		return
+	}
+	if _, err := s.db.GetFamily(familyID); err != nil {
+		jsonError(w, http.StatusNotFound, errCodeNotFound, "family not found")
+		return
+	}
+
+	restored, err := s.db.RestoreEntries(familyID, req.IDs, req.From, req.To)
+	if err != nil {
+		serverError(w, "failed to restore entries", err)
+		return
+	}
+	if restored > 0 {
+		// Connected clients resync from their cursor on reconnect
+		s.hub.CloseFamily(familyID, websocket.CloseServiceRestart, "entries restored")
+	}
+	jsonOK(w, map[string]int{"restored": restored})
+}
@@ -0,0 +1,87 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListAndRestoreDeletedEntries(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+
+	for i := range 5 {
+		s.db.UpsertEntry(&Entry{ID: fmt.Sprintf("e%d", i), FamilyID: family.ID, Ts: int64(i), Type: "feed", Value: "bf"})
+	}
+	for i := range 4 {
+		s.db.DeleteEntry(family.ID, fmt.Sprintf("e%d", i))
+	}
+
+	list := func(query string) map[string]any {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/admin/families/"+family.ID+"/entries?"+query, nil)
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.listEntries(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list %q: status %d: %s", query, w.Code, w.Body.String())
+		}
+		var resp map[string]any
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	// Newest deletion first, paged by seq
+	page := list("deleted=true&limit=3")
+	entries := page["entries"].([]any)
+	if len(entries) != 3 || entries[0].(map[string]any)["id"] != "e3" {
+		t.Fatalf("first page = %v", entries)
+	}
+	next := page["next_before"]
+	if next == nil {
+		t.Fatal("expected next_before")
+	}
+	page = list(fmt.Sprintf("deleted=true&limit=3&before=%.0f", next))
+	if entries := page["entries"].([]any); len(entries) != 1 || entries[0].(map[string]any)["id"] != "e0" || page["next_before"] != nil {
+		t.Errorf("second page = %v", page)
+	}
+	if entries := list("")["entries"].([]any); len(entries) != 1 || entries[0].(map[string]any)["id"] != "e4" {
+		t.Errorf("live entries = %v", entries)
+	}
+
+	restore := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest("POST", "/admin/families/"+family.ID+"/entries/restore", strings.NewReader(body))
+		req.SetPathValue("id", family.ID)
+		w := httptest.NewRecorder()
+		s.restoreEntries(w, req)
+		var resp map[string]any
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+	if code, _ := restore(`{}`); code != http.StatusBadRequest {
+		t.Errorf("empty restore: status %d, want 400", code)
+	}
+
+	before, _ := s.db.GetEntry(family.ID, "e1")
+	code, resp := restore(`{"ids": ["e1", "e4", "missing"]}`)
+	if code != http.StatusOK || resp["restored"] != float64(1) {
+		t.Fatalf("restore by id: %d %v", code, resp)
+	}
+	after, _ := s.db.GetEntry(family.ID, "e1")
+	if after.Deleted || after.Seq <= before.Seq {
+		t.Errorf("e1 after restore = %+v, want undeleted with a new seq", after)
+	}
+
+	// Everything deleted in a window
+	code, resp = restore(fmt.Sprintf(`{"from": 0, "to": %d}`, after.UpdatedAt+1))
+	if code != http.StatusOK || resp["restored"] != float64(3) {
+		t.Fatalf("restore by range: %d %v", code, resp)
+	}
+	if entries := list("deleted=true")["entries"].([]any); len(entries) != 0 {
+		t.Errorf("still deleted: %v", entries)
+	}
+}
@@ -0,0 +1,329 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// POST /api/v1/voice logs an entry from something said to a voice
+// assistant, such as "log a wet nappy" or "start nap", so an Alexa skill or
+// Google Assistant action can be pointed at it. The utterance is matched
+// against the family's buttons by their label, value and category, with a
+// few everyday words (diaper, nap, poo, ...) mapped onto the default
+// buttons' and misheard words a letter off still counting. Assistants can't
+// keep a cookie, so the link's token may be sent as a Bearer token instead.
+// The response carries speech for the assistant to say back.
+
+const maxUtteranceLen = 200
+
+// voiceFillers say nothing about what to log.
+var voiceFillers = map[string]bool{
+	"log": true, "record": true, "add": true, "note": true, "track": true,
+	"a": true, "an": true, "the": true, "some": true, "please": true,
+	"baby": true, "just": true, "had": true, "has": true, "did": true, "was": true, "is": true, "now": true,
+	"he": true, "she": true, "they": true, "of": true, "for": true, "to": true, "and": true,
+}
+
+// voiceVerbs start or stop a stateful category; "stop nap" logs awake.
+var voiceVerbs = map[string]string{
+	"start": "start", "starting": "start", "started": "start", "begin": "start", "began": "start",
+	"stop": "stop", "stopped": "stop", "end": "stop", "ended": "stop", "finish": "stop", "finished": "stop",
+}
+
+// voiceSynonyms are words people say for the default buttons'.
+var voiceSynonyms = map[string]string{
+	"nap": "sleeping", "napping": "sleeping", "asleep": "sleeping", "sleep": "sleeping", "bed": "sleeping",
+	"woke": "awake", "wake": "awake", "waking": "awake",
+	"diaper": "nappy", "nappies": "nappy", "diapers": "nappy", "change": "nappy",
+	"pee": "wet", "wee": "wet", "poo": "dirty", "poop": "dirty", "pooey": "dirty", "soiled": "dirty",
+	"bottle": "feed", "fed": "feed", "feeding": "feed", "breastfeed": "bf", "nursed": "bf", "nursing": "bf",
+	"vomit": "spew", "sick": "spew", "spit": "spew",
+}
+
+var voiceQuantityRe = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(ml|mls|millilitres|milliliters|oz|ounces|g|grams)\b`)
+
+// voiceUnits spell out the units parseQuantity reads.
+var voiceUnits = strings.NewReplacer("millilitres", "ml", "milliliters", "ml", "ounces", "oz", "grams", "g")
+
+// voiceMatch is a button an utterance names.
+type voiceMatch struct {
+	Category string
+	Value    string
+	Label    string
+	Amount   float64
+	Unit     string
+}
+
+// voiceWords splits s into lowercase words.
+func voiceWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// wordsMatch reports whether a said word is a button's word, or a letter
+// off one long enough for that to be a mishearing.
+func wordsMatch(said, word string) bool {
+	if said == word {
+		return true
+	}
+	return len(said) >= 4 && len(word) >= 4 && editDistance(said, word) <= 1
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// matchUtterance finds the button in groups that text names, or nil. Each
+// said word naming a button's label or value scores 2 and its category 1;
+// the highest score wins, the first button in the config on a tie, so "log
+// a feed" is the feed group's first button.
+func matchUtterance(groups []configGroup, text string) *voiceMatch {
+	text = strings.ToLower(text)
+	m := &voiceMatch{}
+	if q := voiceQuantityRe.FindStringSubmatch(text); q != nil {
+		if amount, unit, ok := parseQuantity(q[1] + voiceUnits.Replace(q[2])); ok {
+			m.Amount, m.Unit = amount, unit
+		}
+		text = strings.Replace(text, q[0], " ", 1)
+	}
+	var verb string
+	var said []string
+	for _, w := range voiceWords(text) {
+		if v, ok := voiceVerbs[w]; ok {
+			verb = v
+			continue
+		}
+		if voiceFillers[w] {
+			continue
+		}
+		said = append(said, w)
+		if syn, ok := voiceSynonyms[w]; ok {
+			said = append(said, syn)
+		}
+	}
+	if len(said) == 0 {
+		return nil
+	}
+
+	best, bestGroup, bestButton := 0, -1, -1
+	for gi, g := range groups {
+		if g.Buttons == nil {
+			continue
+		}
+		category := voiceWords(g.Category)
+		for bi, b := range *g.Buttons {
+			names := append(voiceWords(b.Label), voiceWords(b.Value)...)
+			score := 0
+			for _, w := range said {
+				switch {
+				case containsMatch(names, w):
+					score += 2
+				case containsMatch(category, w):
+					score++
+				}
+			}
+			if score > best {
+				best, bestGroup, bestButton = score, gi, bi
+			}
+		}
+	}
+	if best == 0 {
+		return nil
+	}
+
+	g := groups[bestGroup]
+	buttons := *g.Buttons
+	b := buttons[bestButton]
+	// "stop nap" in a two-state category such as sleep is the other state
+	if verb == "stop" && g.Stateful && len(buttons) == 2 {
+		b = buttons[1-bestButton]
+	}
+	m.Category, m.Value, m.Label = g.Category, b.Value, b.Label
+	return m
+}
+
+func containsMatch(words []string, said string) bool {
+	for _, w := range words {
+		if wordsMatch(said, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerSession lets a request authenticate with its link token as a
+// Bearer token, for callers that can't keep the session cookie.
+func bearerSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("client_session"); err != nil {
+			if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+				r.AddCookie(&http.Cookie{Name: "client_session", Value: token})
+			}
+		}
+		next(w, r)
+	}
+}
+
+// handleVoice handles POST /api/v1/voice: {"utterance": "log a wet nappy",
+// "child_id": "..."}. It answers 201 with the saved entry and speech, 422
+// with speech saying what could be logged, or 409 with the dose conflict
+// for a medicine given too recently.
+func (s *Server) handleVoice(w http.ResponseWriter, r *http.Request) {
+	link := accessLinkFrom(r.Context())
+	var req struct {
+		Utterance string `json:"utterance"`
+		ChildID   string `json:"child_id"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid request")
+		return
+	}
+	req.Utterance = strings.TrimSpace(req.Utterance)
+	if req.Utterance == "" || len(req.Utterance) > maxUtteranceLen {
+		validationError(w, map[string]string{"utterance": fmt.Sprintf("must be 1-%d characters", maxUtteranceLen)})
+		return
+	}
+
+	config, err := s.db.GetConfig(link.FamilyID)
+	if err != nil {
+		serverError(w, "failed to load config", err)
+		return
+	}
+	var groups []configGroup
+	json.Unmarshal([]byte(config), &groups)
+	settings, _ := s.db.GetFamilySettings(link.FamilyID)
+	locale := locales[defaultLocale]
+	if l := lookupLocale(settings.Locale); l != nil {
+		locale = l
+	}
+
+	match := matchUtterance(groups, req.Utterance)
+	if match == nil {
+		jsonResponse(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":  APIError{Code: errCodeValidation, Message: "no button matches the utterance"},
+			"speech": voiceOptions(groups, locale),
+		})
+		return
+	}
+
+	e := Entry{
+		ID:       generateToken(8),
+		FamilyID: link.FamilyID,
+		Ts:       time.Now().UnixMilli(),
+		Type:     match.Category,
+		Value:    match.Value,
+		Author:   link.Label,
+		ChildID:  req.ChildID,
+	}
+	if match.Unit != "" && !ownDataTypes[e.Type] {
+		e.Data, _ = json.Marshal(EntryValue{Amount: &match.Amount, Unit: match.Unit})
+	}
+	if err := s.checkBatchEntry(&e, link); err != nil {
+		validationError(w, map[string]string{"entry": err.Error()})
+		return
+	}
+	normalizeEntryValue(&e)
+	if err := s.checkEntryQuota(link.FamilyID, &e); err != nil {
+		if qe, ok := err.(*QuotaError); ok {
+			jsonError(w, http.StatusForbidden, errCodeQuota, qe.Error())
+			return
+		}
+		serverError(w, "failed to check entry quota", err)
+		return
+	}
+	label := match.Label
+	if label == "" {
+		label = e.Value
+	}
+	// There's no asking the caregiver to confirm an early dose here, so
+	// it isn't saved
+	conflict, err := s.doseConflict(link.FamilyID, &e)
+	if err != nil {
+		serverError(w, "failed to check dose interval", err)
+		return
+	}
+	if conflict != nil {
+		last := time.UnixMilli(conflict.LastDoseTs).In(settings.Location())
+		jsonResponse(w, http.StatusConflict, map[string]any{
+			"error":    APIError{Code: errCodeConflict, Message: "too soon after the last dose"},
+			"conflict": conflict,
+			"speech":   fmt.Sprintf(locale.T("voice.dose_conflict", "%s was last given at %s"), locale.T("value."+e.Value, label), locale.FormatTime(last)),
+		})
+		return
+	}
+	if err := s.db.UpsertEntry(&e); err != nil {
+		serverError(w, "failed to save entry", err)
+		return
+	}
+
+	slog.Info("voice entry saved", "family_id", link.FamilyID, "label", link.Label, "type", e.Type, "value", e.Value)
+	s.hub.publishActivity(ActivityEvent{
+		Type: "entry", FamilyID: link.FamilyID, Label: link.Label,
+		Action: "voice", EntryType: e.Type, Seq: e.Seq,
+	})
+	if err := s.db.RecordLinkEntry(link.ID, time.Now().UnixMilli()); err != nil {
+		slog.Error("failed to record link entry", "error", err, "family_id", link.FamilyID)
+	}
+	s.broadcastBatch(link.FamilyID, []Entry{e})
+	s.checkFever(link.FamilyID, link.Label, &e)
+	if !settings.quiet("entry", time.Now()) {
+		s.hub.Notify(link.FamilyID, deviceIDFrom(r.Context()), entryNotification(settings, link.Label, &e), nil)
+	}
+	s.publishState(link.FamilyID)
+
+	what := locale.TypeLabel(e.Type)
+	if v := locale.T("value."+e.Value, label); v != "" && v != what {
+		what += ": " + v
+	}
+	if match.Unit != "" {
+		what += " " + formatQuantity(match.Amount, match.Unit)
+	}
+	jsonCreated(w, map[string]any{
+		"entry":  e,
+		"speech": fmt.Sprintf(locale.T("voice.logged", "Logged %s"), what),
+	})
+}
+
+// voiceOptions is speech for an utterance that matched nothing, naming a
+// few of the buttons it could have.
+func voiceOptions(groups []configGroup, locale *Locale) string {
+	var names []string
+	for _, g := range groups {
+		if g.Buttons == nil {
+			continue
+		}
+		for _, b := range *g.Buttons {
+			if len(names) < 4 && b.Label != "" {
+				names = append(names, strings.ToLower(b.Label))
+			}
+		}
+	}
+	if len(names) == 0 {
+		return locale.T("voice.no_buttons", "There are no buttons to log yet")
+	}
+	return fmt.Sprintf(locale.T("voice.unmatched", "Sorry, I didn't catch that. Try saying %s"), strings.Join(names, ", "))
+}
@@ -0,0 +1,107 @@
+package babytrack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const voiceTestConfig = `[
+	{"category": "feed", "buttons": [{"value": "bf", "label": "Feed"}, {"value": "bottle", "label": "Bottle"}, {"value": "spew", "label": "Spew"}]},
+	{"category": "sleep", "stateful": true, "buttons": [{"value": "awake", "label": "Awake"}, {"value": "sleeping", "label": "Sleeping"}]},
+	{"category": "nappy", "buttons": [{"value": "wet", "label": "Wet"}, {"value": "dirty", "label": "Dirty"}]},
+	{"category": "med", "buttons": [{"value": "paracetamol", "label": "Paracetamol"}]}
+]`
+
+func TestMatchUtterance(t *testing.T) {
+	var groups []configGroup
+	if err := json.Unmarshal([]byte(voiceTestConfig), &groups); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		text, category, value string
+	}{
+		{"log a wet nappy", "nappy", "wet"},
+		{"Dirty diaper please", "nappy", "dirty"},
+		{"poo", "nappy", "dirty"},
+		{"start nap", "sleep", "sleeping"},
+		{"stop nap", "sleep", "awake"},
+		{"baby woke up", "sleep", "awake"},
+		{"log a feed", "feed", "bf"},
+		{"log a 120 ml bottle", "feed", "bottle"},
+		{"log a dirt nappy", "nappy", "dirty"},
+	} {
+		m := matchUtterance(groups, tt.text)
+		if m == nil || m.Category != tt.category || m.Value != tt.value {
+			t.Errorf("%q matched %+v, want %s/%s", tt.text, m, tt.category, tt.value)
+		}
+	}
+	if m := matchUtterance(groups, "log 4 oz bottle"); m == nil || m.Amount != 4 || m.Unit != "oz" {
+		t.Errorf("amount = %+v", m)
+	}
+	for _, text := range []string{"log a", "what's the weather", ""} {
+		if m := matchUtterance(groups, text); m != nil {
+			t.Errorf("%q matched %+v", text, m)
+		}
+	}
+}
+
+func TestVoice(t *testing.T) {
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	s.db.SaveConfig(family.ID, voiceTestConfig)
+	link, _ := s.db.CreateAccessLinkWith(family.ID, "Kitchen speaker", roleFull, allPermissions, nil)
+	handler := s.routes()
+	post := func(token, body string) (int, map[string]any) {
+		req := httptest.NewRequest("POST", "/api/voice", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := post(link.Token, `{"utterance": "log a 120ml bottle"}`)
+	if code != http.StatusCreated || resp["speech"] != "Logged Feed: Bottle 120ml" {
+		t.Fatalf("voice: %d %v", code, resp)
+	}
+	id := resp["entry"].(map[string]any)["id"].(string)
+	e, err := s.db.GetEntry(family.ID, id)
+	if err != nil || e.Type != "feed" || e.Value != "bottle" || e.Author != "Kitchen speaker" || string(e.Data) != `{"amount":120,"unit":"ml"}` {
+		t.Errorf("saved %+v, %v", e, err)
+	}
+
+	// A second dose too soon isn't saved
+	if code, resp = post(link.Token, `{"utterance": "log paracetamol"}`); code != http.StatusCreated {
+		t.Fatalf("first dose: %d %v", code, resp)
+	}
+	first := int64(resp["entry"].(map[string]any)["ts"].(float64))
+	code, resp = post(link.Token, `{"utterance": "log paracetamol"}`)
+	want := "Paracetamol was last given at " + time.UnixMilli(first).UTC().Format("15:04")
+	if code != http.StatusConflict || resp["speech"] != want || resp["conflict"].(map[string]any)["last_dose_ts"] != float64(first) {
+		t.Errorf("second dose: %d %v", code, resp)
+	}
+	var doses int
+	s.db.(*DB).QueryRow("SELECT COUNT(*) FROM entries WHERE family_id = ? AND type = 'med'", family.ID).Scan(&doses)
+	if doses != 1 {
+		t.Errorf("%d doses saved", doses)
+	}
+
+	if code, resp = post(link.Token, `{"utterance": "play some jazz"}`); code != http.StatusUnprocessableEntity ||
+		!strings.HasPrefix(resp["speech"].(string), "Sorry, I didn't catch that. Try saying feed, bottle") {
+		t.Errorf("unmatched: %d %v", code, resp)
+	}
+	if code, _ = post("", `{"utterance": "start nap"}`); code != http.StatusUnauthorized {
+		t.Errorf("no token: %d", code)
+	}
+	if code, _ = post("not-a-token", `{"utterance": "start nap"}`); code != http.StatusUnauthorized {
+		t.Errorf("bad token: %d", code)
+	}
+}
@@ -1,10 +1,18 @@
-package main
+package babytrack
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -15,40 +23,128 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// Application close codes (4000-4999 are reserved for applications).
+// Clients should not auto-reconnect after these.
+const (
+	closeSessionRevoked     = 4001
+	closeTooManyConnections = 4002
+)
+
+// ErrTooManyConnections is returned by Register when a connection limit is hit.
+var ErrTooManyConnections = errors.New("too many connections")
+
 // Hub maintains connected clients grouped by family
 type Hub struct {
 	mu       sync.RWMutex
 	families map[string]map[*Client]bool
-	db       *DB
+	db       Store
+
+	activityMu sync.Mutex
+	activity   map[chan []byte]bool // admin dashboard subscribers
+
+	stateMu sync.Mutex
+	states  map[string]string // family → last CurrentState sent, as JSON
+
+	// Connection limits; 0 means unlimited. Set before serving.
+	maxPerFamily int
+	maxPerToken  int
+
+	// Other instances, if any; see bus.go
+	bus    Bus
+	node   string // this instance, to skip its own relayed messages
+	busOut chan []byte
+
+	maintenance *maintenance // the Server's, relayed to other instances; see maintenance.go
+
+	presenceMu sync.Mutex
+	remote     map[string]map[string]remotePresence // family → node → its devices
+
+	sent sendCounters // every client's, including those gone; see sendqueue.go
 }
 
 // Client represents a WebSocket connection
 type Client struct {
-	hub      *Hub
-	conn     *websocket.Conn
-	send     chan []byte
-	familyID string
-	label    string // from access link
+	hub         *Hub
+	conn        *websocket.Conn
+	send        chan []byte
+	familyID    string
+	role        string // access link role; roleSummary gets a pared-down feed
+	childID     string // from ?child=; only that child's entries are sent
+	linkID      string // access link ID, groups a device's connections
+	deviceID    string // the device's record, if it has one; see devices.go
+	token       string // the link token it authenticated with; see rotate.go
+	session     bool   // token is a session's, not the link's; see sessions.go
+	perms       LinkPermissions
+	platform    string // coarse OS from User-Agent
+	protocol    int    // WS protocol version in use; see handshake.go
+	appVersion  string // from hello; empty for clients without one
+	encoding    string // frame encoding from hello: encodingCBOR, or JSON if empty
+	connectedAt time.Time
+	expiresAt   int64                       // ms; link expiry, 0 = never
+	lastEntryAt atomic.Int64                // ms; last entry written via this link
+	skew        clockSkew                   // see skew.go
+	skewMs      atomic.Int64                // clock offset once flagged, else 0
+	ackedCursor atomic.Int64                // last sync_ack recorded, or the link's at connect
+	activity    connActivity                // see idle.go
+	notify      atomic.Pointer[notifyPrefs] // see notifications.go
+	label       atomic.Pointer[string]      // from access link; renames change it, see label.go
+
+	sent         sendCounters // see sendqueue.go
+	dropWarnedAt atomic.Int64 // ms; last warning about dropped messages
+	logger       *slog.Logger // tagged with the upgrade's request ID, family and label
+
+	// Set once before a nil sentinel is queued on send; writePump then sends
+	// a close frame with this code and reason.
+	closeOnce   sync.Once
+	closeCode   int
+	closeReason string
 }
 
-func NewHub(db *DB) *Hub {
+func NewHub(db Store) *Hub {
 	return &Hub{
 		families: make(map[string]map[*Client]bool),
 		db:       db,
+		activity: make(map[chan []byte]bool),
+		states:   make(map[string]string),
 	}
 }
 
-// Register adds a client to its family room
-func (h *Hub) Register(c *Client) {
+// Register adds a client to its family room, or returns ErrTooManyConnections
+// if the family or the client's access link is already at its limit.
+func (h *Hub) Register(c *Client) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	clients := h.families[c.familyID]
+	if h.maxPerFamily > 0 && len(clients) >= h.maxPerFamily {
+		return fmt.Errorf("%w: family limit is %d", ErrTooManyConnections, h.maxPerFamily)
+	}
+	if h.maxPerToken > 0 && c.linkID != "" {
+		n := 0
+		for other := range clients {
+			if other.linkID == c.linkID {
+				n++
+			}
+		}
+		if n >= h.maxPerToken {
+			return fmt.Errorf("%w: link limit is %d", ErrTooManyConnections, h.maxPerToken)
+		}
+	}
+
 	if h.families[c.familyID] == nil {
 		h.families[c.familyID] = make(map[*Client]bool)
 	}
 	h.families[c.familyID][c] = true
+	c.activity.status = c.presenceStatus(time.Now().UnixMilli())
 
 	h.broadcastPresenceLocked(c.familyID)
+	h.publishActivity(ActivityEvent{
+		Type:     "connect",
+		FamilyID: c.familyID,
+		Label:    c.linkLabel(),
+		Clients:  len(h.families[c.familyID]),
+	})
+	return nil
 }
 
 // Unregister removes a client
@@ -60,52 +156,460 @@ func (h *Hub) Unregister(c *Client) {
 		delete(clients, c)
 		if len(clients) == 0 {
 			delete(h.families, c.familyID)
+			h.relayPresence(c.familyID, nil, nil)
 		} else {
 			h.broadcastPresenceLocked(c.familyID)
 		}
+		h.publishActivity(ActivityEvent{
+			Type:     "disconnect",
+			FamilyID: c.familyID,
+			Label:    c.linkLabel(),
+			Clients:  len(clients),
+		})
 	}
 	close(c.send)
 }
 
 // Broadcast sends a message to all clients in a family
 func (h *Hub) Broadcast(familyID string, msg []byte, exclude *Client) {
+	h.broadcast(familyID, msg, exclude)
+	h.relay(busMessage{Kind: "broadcast", FamilyID: familyID, Msg: msg})
+}
+
+func (h *Hub) broadcast(familyID string, msg []byte, exclude *Client) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
+	var head *broadcastHead // parsed on first use
 	clients := h.families[familyID]
 	for c := range clients {
-		if c != exclude {
-			select {
-			case c.send <- msg:
-			default:
-				// Client buffer full, skip
+		if c == exclude {
+			continue
+		}
+		out := msg
+		if c.role == roleSummary || c.childID != "" {
+			if head == nil {
+				head = parseBroadcastHead(msg)
+			}
+			if c.childID != "" && head.Type == "entry" && head.childID() != c.childID {
+				continue
+			}
+			if c.role == roleSummary {
+				if out = head.summary(msg); out == nil {
+					continue
+				}
 			}
 		}
+		c.trySend(out)
+	}
+}
+
+// broadcastHead is the part of a broadcast that decides which clients get
+// it and in what form.
+type broadcastHead struct {
+	Type    string `json:"type"`
+	ChildID string `json:"child_id"` // deletes
+	Entry   struct {
+		ChildID string `json:"child_id"`
+	} `json:"entry"`
+}
+
+func parseBroadcastHead(msg []byte) *broadcastHead {
+	var h broadcastHead
+	json.Unmarshal(msg, &h)
+	return &h
+}
+
+// childID is the child an entry broadcast is about.
+func (h *broadcastHead) childID() string {
+	if h.Entry.ChildID != "" {
+		return h.Entry.ChildID
 	}
+	return h.ChildID
 }
 
+// summary returns what summary links see of the broadcast msg: state
+// changes, announcements and maintenance as they are, entry and config
+// changes as a bare {"type":"changed"} so the page knows to refetch its
+// summary, and nothing else.
+func (h *broadcastHead) summary(msg []byte) []byte {
+	switch h.Type {
+	case "state", "announcement", "maintenance":
+		return msg
+	case "entry", "config":
+		return []byte(`{"type":"changed"}`)
+	}
+	return nil
+}
+
+// disconnect queues msg followed by a close frame, so the client sees why it
+// was dropped. Must be called with h.mu held on a registered client.
+func (c *Client) disconnect(msg []byte, code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeCode, c.closeReason = code, reason
+		c.trySend(msg)
+		select {
+		case c.send <- nil:
+		default:
+			// Buffer full; drop the connection without the courtesy message
+			if c.conn != nil {
+				c.conn.Close()
+			}
+		}
+	})
+}
+
+// RevokeLink disconnects every client authenticated with the given access
+// link, sending a session_revoked message first. Returns the number of
+// clients disconnected.
+func (h *Hub) RevokeLink(linkID, reason string) int {
+	h.relay(busMessage{Kind: "revoke_link", LinkID: linkID, Reason: reason})
+	return h.revokeLink(linkID, reason)
+}
+
+func (h *Hub) revokeLink(linkID, reason string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	msg, _ := json.Marshal(map[string]any{"type": "session_revoked", "reason": reason})
+	n := 0
+	for _, clients := range h.families {
+		for c := range clients {
+			if c.linkID == linkID {
+				c.disconnect(msg, closeSessionRevoked, reason)
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// CloseLink disconnects every client of the given access link with the
+// given close code. Returns the number of clients disconnected.
+func (h *Hub) CloseLink(linkID string, code int, reason string) int {
+	h.relay(busMessage{Kind: "close_link", LinkID: linkID, Code: code, Reason: reason})
+	return h.closeLink(linkID, code, reason)
+}
+
+func (h *Hub) closeLink(linkID string, code int, reason string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	msg, _ := json.Marshal(map[string]any{"type": "server_shutdown", "reason": reason})
+	n := 0
+	for _, clients := range h.families {
+		for c := range clients {
+			if c.linkID == linkID {
+				c.disconnect(msg, code, reason)
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// ExpireSessions disconnects clients whose access link expired before now.
+func (h *Hub) ExpireSessions(now time.Time) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	msg, _ := json.Marshal(map[string]any{"type": "session_revoked", "reason": "expired"})
+	n := 0
+	for _, clients := range h.families {
+		for c := range clients {
+			if c.expiresAt != 0 && now.UnixMilli() > c.expiresAt {
+				c.disconnect(msg, closeSessionRevoked, "expired")
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// CloseFamily disconnects every client of a family with the given close code,
+// e.g. so they reconnect and resync after the family's data changed under them.
+func (h *Hub) CloseFamily(familyID string, code int, reason string) int {
+	h.relay(busMessage{Kind: "close_family", FamilyID: familyID, Code: code, Reason: reason})
+	return h.closeFamily(familyID, code, reason)
+}
+
+func (h *Hub) closeFamily(familyID string, code int, reason string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	msg, _ := json.Marshal(map[string]any{"type": "server_shutdown", "reason": reason})
+	n := 0
+	for c := range h.families[familyID] {
+		c.disconnect(msg, code, reason)
+		n++
+	}
+	return n
+}
+
+// CloseAll sends a going-away close frame to every client, for shutdown.
+func (h *Hub) CloseAll() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	msg, _ := json.Marshal(map[string]any{"type": "server_shutdown"})
+	for _, clients := range h.families {
+		for c := range clients {
+			c.disconnect(msg, websocket.CloseGoingAway, "server shutting down")
+		}
+	}
+}
+
+// RunExpiry calls ExpireSessions every interval, and refreshes this
+// instance's presence on the bus, until ctx is done.
+func (h *Hub) RunExpiry(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-t.C:
+		}
+		if n := h.ExpireSessions(now); n > 0 {
+			slog.Info("disconnected clients with expired links", "count", n)
+		}
+		h.refreshAllStatuses(now.UnixMilli())
+		h.refreshPresence()
+		h.relayMaintenance()
+	}
+}
+
+// PresenceDevice describes one access link's live connections.
+type PresenceDevice struct {
+	Label          string `json:"label"`
+	Platform       string `json:"platform,omitempty"`
+	Connections    int    `json:"connections"`
+	ConnectedSince int64  `json:"connected_since"`
+	LastEntryAt    int64  `json:"last_entry_at,omitempty"`
+	Status         string `json:"status"`                   // the most present of its connections: active, idle or away; see idle.go
+	LastActiveAt   int64  `json:"last_active_at,omitempty"` // last input or entry, as reported
+	ClockSkewMs    int64  `json:"clock_skew_ms,omitempty"`  // a connection's clock is out by this; see skew.go
+}
+
+// broadcastPresenceLocked tells the family's clients, here and on other
+// instances, who is connected. Must be called with h.mu held.
 func (h *Hub) broadcastPresenceLocked(familyID string) {
+	members, devices := h.localPresenceLocked(familyID)
+	h.relayPresence(familyID, members, devices)
+	h.sendPresenceLocked(familyID, members, devices)
+}
+
+// localPresenceLocked lists this instance's connections to the family.
+func (h *Hub) localPresenceLocked(familyID string) ([]string, []PresenceDevice) {
 	clients := h.families[familyID]
 	members := make([]string, 0, len(clients))
 	for c := range clients {
-		if c.label != "" {
-			members = append(members, c.label)
+		if label := c.linkLabel(); label != "" {
+			members = append(members, label)
 		}
 	}
+	byLink := h.presenceDevicesLocked(familyID)
+	devices := make([]PresenceDevice, 0, len(byLink))
+	for _, d := range byLink {
+		devices = append(devices, *d)
+	}
+	return members, devices
+}
+
+// sendPresenceLocked sends the family's clients on this instance its
+// connections, with those on other instances added.
+func (h *Hub) sendPresenceLocked(familyID string, members []string, devices []PresenceDevice) {
+	members, devices = h.withRemotePresence(familyID, members, devices)
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Label < devices[j].Label })
 
 	msg, _ := json.Marshal(map[string]any{
 		"type":    "presence",
 		"members": members,
+		"devices": devices,
 	})
 
-	for c := range clients {
+	for c := range h.families[familyID] {
+		if c.role == roleSummary {
+			continue
+		}
+		c.trySend(msg)
+	}
+}
+
+// presenceDevicesLocked groups a family's clients by access link (or label,
+// for clients without one).
+func (h *Hub) presenceDevicesLocked(familyID string) map[string]*PresenceDevice {
+	now := time.Now().UnixMilli()
+	byLink := make(map[string]*PresenceDevice)
+	for c := range h.families[familyID] {
+		key := c.linkID
+		if key == "" {
+			key = c.linkLabel()
+		}
+		d := byLink[key]
+		if d == nil {
+			d = &PresenceDevice{Label: c.linkLabel(), ConnectedSince: c.connectedAt.UnixMilli(), Status: statusAway}
+			byLink[key] = d
+		}
+		d.Connections++
+		if c.platform != "" {
+			d.Platform = c.platform
+		}
+		if since := c.connectedAt.UnixMilli(); since < d.ConnectedSince {
+			d.ConnectedSince = since
+		}
+		d.LastEntryAt = max(d.LastEntryAt, c.lastEntryAt.Load())
+		if status := c.presenceStatus(now); statusRank[status] > statusRank[d.Status] {
+			d.Status = status
+		}
+		d.LastActiveAt = max(d.LastActiveAt, c.lastActiveAt())
+		if skew := c.skewMs.Load(); skew != 0 {
+			d.ClockSkewMs = skew
+		}
+	}
+	return byLink
+}
+
+// ActivityEvent is a per-family event streamed to admin dashboards over /admin/ws.
+type ActivityEvent struct {
+	Type      string `json:"type"` // connect, disconnect, entry, error, warning
+	FamilyID  string `json:"family_id"`
+	Label     string `json:"label,omitempty"`
+	Ts        int64  `json:"ts"`
+	Clients   int    `json:"clients,omitempty"`    // connect/disconnect: family clients after the event
+	Action    string `json:"action,omitempty"`     // entry: add, update, delete
+	EntryType string `json:"entry_type,omitempty"` // entry: feed, sleep, ...
+	Seq       int64  `json:"seq,omitempty"`        // entry: family seq after the write
+	Message   string `json:"message,omitempty"`    // error, warning
+}
+
+// SubscribeActivity returns a channel receiving JSON-encoded ActivityEvents.
+// Call UnsubscribeActivity to stop; it closes the channel.
+func (h *Hub) SubscribeActivity() chan []byte {
+	ch := make(chan []byte, 64)
+	h.activityMu.Lock()
+	h.activity[ch] = true
+	h.activityMu.Unlock()
+	return ch
+}
+
+func (h *Hub) UnsubscribeActivity(ch chan []byte) {
+	h.activityMu.Lock()
+	defer h.activityMu.Unlock()
+	if h.activity[ch] {
+		delete(h.activity, ch)
+		close(ch)
+	}
+}
+
+// publishActivity fans an event out to admin subscribers, dropping it for any
+// subscriber that isn't keeping up, and records it for the family's activity
+// feed unless it's an entry (entries are their own record). Safe to call
+// with h.mu held.
+func (h *Hub) publishActivity(ev ActivityEvent) {
+	if ev.Ts == 0 {
+		ev.Ts = time.Now().UnixMilli()
+	}
+	msg, _ := json.Marshal(ev)
+	if ev.Type != "entry" && ev.FamilyID != "" && h.db != nil {
+		// Off the caller's path: some hold h.mu
+		go func() {
+			if err := h.db.RecordActivity(ev); err != nil {
+				slog.Error("failed to record activity", "error", err, "family_id", ev.FamilyID)
+			}
+		}()
+	}
+
+	h.fanOutActivity(msg)
+	h.relay(busMessage{Kind: "activity", FamilyID: ev.FamilyID, Msg: msg})
+}
+
+func (h *Hub) fanOutActivity(msg []byte) {
+	h.activityMu.Lock()
+	defer h.activityMu.Unlock()
+	for ch := range h.activity {
 		select {
-		case c.send <- msg:
+		case ch <- msg:
 		default:
 		}
 	}
 }
 
+// ConnectionCounts returns the number of connected clients per family.
+func (h *Hub) ConnectionCounts() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	counts := make(map[string]int, len(h.families))
+	for id, clients := range h.families {
+		counts[id] = len(clients)
+	}
+	return counts
+}
+
+// handleAdminWebSocket streams Hub activity to an admin dashboard. It starts
+// with a snapshot of connection counts, then sends ActivityEvents as they occur.
+func (s *Server) handleAdminWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		loggerFromCtx(r.Context()).Error("admin websocket upgrade failed", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	events := s.hub.SubscribeActivity()
+
+	// Reader only detects disconnects; admins don't send anything
+	go func() {
+		defer s.hub.UnsubscribeActivity(events)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Org admins only hear about their own families
+	orgID := adminOrg(r)
+	inOrg := map[string]bool{}
+	visible := func(familyID string) bool {
+		if orgID == "" {
+			return true
+		}
+		in, ok := inOrg[familyID]
+		if !ok {
+			in = s.familyInOrg(familyID, orgID)
+			inOrg[familyID] = in
+		}
+		return in
+	}
+
+	counts := s.hub.ConnectionCounts()
+	for id := range counts {
+		if !visible(id) {
+			delete(counts, id)
+		}
+	}
+	snapshot, _ := json.Marshal(map[string]any{
+		"type":     "snapshot",
+		"families": counts,
+	})
+	if err := conn.WriteMessage(websocket.TextMessage, snapshot); err != nil {
+		return
+	}
+
+	for msg := range events {
+		if orgID != "" {
+			var ev ActivityEvent
+			if json.Unmarshal(msg, &ev) != nil || !visible(ev.FamilyID) {
+				continue
+			}
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			return
+		}
+	}
+}
+
 // WebSocket message types
 type WSMessage struct {
 	Type        string          `json:"type"`
@@ -117,6 +621,9 @@ type WSMessage struct {
 	SinceUpdate int64           `json:"since_update,omitempty"` // deprecated: for old clients
 	Cursor      int64           `json:"cursor,omitempty"`       // seq cursor for sync
 	Limit       int             `json:"limit,omitempty"`        // batch size for sync
+	ClientTime  int64           `json:"client_time,omitempty"`  // ping: the client's clock, ms
+	IdleMs      *int64          `json:"idle_ms,omitempty"`      // ping: since the user's last input; see idle.go
+	Hidden      bool            `json:"hidden,omitempty"`       // ping: the page isn't visible
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -126,64 +633,255 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("client_session")
 	if err != nil {
 		log.Debug("ws auth failed: no cookie", "error", err)
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
 		return
 	}
 
 	link, err := s.db.ValidateAccessLink(cookie.Value)
 	if err != nil {
-		log.Debug("ws auth failed: invalid token", "token_prefix", cookie.Value[:min(8, len(cookie.Value))], "error", err)
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		log.Debug("ws auth failed: invalid token", "error", err)
+		jsonError(w, http.StatusUnauthorized, errCodeUnauthorized, "unauthorized")
 		return
 	}
 
-	log.Debug("ws auth success", "family", link.FamilyID, "label", link.Label)
+	deviceID, ok := s.checkDevice(w, r, link)
+	if !ok {
+		return
+	}
+	// The app's devices from before device records get one as they connect;
+	// it says hello, where scripts generally don't
+	app := r.URL.Query().Get("hello") == "1"
+	var upgradeHeader http.Header
+	if deviceID == "" && app {
+		token, err := s.db.CreateDevice(link, platformFromUserAgent(r.UserAgent()), time.Now().UnixMilli())
+		if err != nil {
+			log.Error("failed to record device", "error", err)
+		} else {
+			deviceID = hashToken(token)
+			upgradeHeader = http.Header{"Set-Cookie": {s.deviceCookie(r, token, deviceCookieMaxAge).String()}}
+		}
+	}
+
+	log = log.With("family_id", link.FamilyID, "label", link.Label)
+	log.Debug("ws auth success")
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	childID := r.URL.Query().Get("child")
+	if len(childID) > maxChildIDLen {
+		jsonError(w, http.StatusBadRequest, errCodeBadRequest, errChildIDTooLong.Error())
+		return
+	}
+	// Clients without the handshake can resume with ?cursor=N instead
+	var cursor int64
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		if cursor, err = strconv.ParseInt(v, 10, 64); err != nil || cursor < 0 {
+			jsonError(w, http.StatusBadRequest, errCodeBadRequest, "invalid cursor")
+			return
+		}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, upgradeHeader)
 	if err != nil {
 		loggerFromCtx(r.Context()).Error("websocket upgrade failed", "error", err)
 		return
 	}
 
+	// Clients that asked for the handshake say who they are before init
+	var hello *helloMessage
+	var first []byte
+	if app {
+		if hello, first, err = readHello(conn); err != nil {
+			log.Debug("ws hello failed", "error", err)
+			conn.Close()
+			return
+		}
+	}
+	protocol := minProtocolVersion // clients from before the handshake
+	if hello != nil {
+		if protocol = negotiateProtocol(hello.ProtocolVersion); protocol == 0 {
+			log.Info("ws client protocol unsupported", "protocol_version", hello.ProtocolVersion, "app_version", hello.AppVersion)
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(closeProtocolUnsupported, "protocol version unsupported"), time.Now().Add(time.Second))
+			conn.Close()
+			return
+		}
+		log.Info("ws hello", "protocol_version", hello.ProtocolVersion,
+			"app_version", hello.AppVersion, "platform", platformFromUserAgent(r.UserAgent()))
+	}
+
 	client := &Client{
-		hub:      s.hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		familyID: link.FamilyID,
-		label:    link.Label,
+		hub:         s.hub,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		familyID:    link.FamilyID,
+		role:        link.Role,
+		childID:     childID,
+		linkID:      link.ID,
+		deviceID:    deviceID,
+		token:       cookie.Value,
+		session:     link.sess != nil,
+		perms:       link.LinkPermissions,
+		platform:    platformFromUserAgent(r.UserAgent()),
+		protocol:    protocol,
+		connectedAt: time.Now(),
+		logger:      log,
+	}
+	if hello != nil {
+		client.appVersion = hello.AppVersion
+		if hello.Cursor > 0 {
+			cursor = hello.Cursor
+		}
+		client.encoding = negotiateEncoding(hello.Encodings)
+		if hello.ClientTime > 0 {
+			client.noteClientTime(hello.ClientTime)
+		}
+	}
+	if cursor > 0 {
+		seq, _ := s.db.FamilySeq(link.FamilyID)
+		cursor = resumeCursor(cursor, seq, link)
+	}
+	client.setLabel(link.Label)
+	if link.AckedCursor != nil {
+		client.ackedCursor.Store(*link.AckedCursor)
+	}
+	if link.LastEntryAt != nil {
+		client.lastEntryAt.Store(*link.LastEntryAt)
+	}
+	if link.ExpiresAt != nil {
+		client.expiresAt = *link.ExpiresAt
+	}
+	if err := s.db.TouchAccessLink(link.ID, client.connectedAt.UnixMilli()); err != nil {
+		log.Error("failed to record link last seen", "error", err)
+	}
+	if deviceID != "" {
+		settings, err := s.db.GetDeviceSettings(deviceID)
+		if err != nil {
+			log.Error("failed to get device settings", "error", err)
+		}
+		client.notify.Store(notifyPrefsFrom(settings))
+	}
+
+	if err := s.hub.Register(client); err != nil {
+		log.Warn("ws connection rejected", "error", err)
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(closeTooManyConnections, "too many connections"), time.Now().Add(time.Second))
+		conn.Close()
+		return
 	}
 
-	s.hub.Register(client)
+	log.Info("ws connected", "protocol_version", protocol, "app_version", client.appVersion,
+		"platform", client.platform, "child_id", childID, "cursor", cursor)
 
 	// Send initial state
-	s.sendInit(client)
+	if hello != nil {
+		client.sendHello()
+	}
+	s.sendInit(client, cursor)
+	s.sendAnnouncements(client)
+	if state := s.maintenance.State(); state.Enabled {
+		client.send <- maintenanceMessage(state)
+	}
+	// Move a device still on its link's token onto a session, or its session
+	// onto a new token if due; it swaps its cookie as for link rotation
+	if next, err := s.renewSession(link, deviceID, app, time.Now()); err != nil {
+		log.Error("failed to renew session", "error", err)
+	} else if next != "" {
+		// Registered, so rotations and session renewals read these under h.mu
+		s.hub.mu.Lock()
+		client.token, client.session = next, true
+		s.hub.mu.Unlock()
+		msg, _ := json.Marshal(map[string]any{"type": "token_rotated", "token": next})
+		client.trySend(msg)
+	} else {
+		s.offerRotation(client, link, cookie.Value)
+	}
 
 	go client.writePump()
-	go client.readPump(s)
+	go client.readPump(s, first)
 }
 
-func (s *Server) sendInit(c *Client) {
-	entries, _ := s.db.GetEntries(c.familyID, 0)
-	config, _ := s.db.GetConfig(c.familyID)
+// sendInit sends the client everything it needs to start. With a cursor
+// from its hello or the URL, entries are only those changed since, if there
+// aren't too many.
+func (s *Server) sendInit(c *Client, cursor int64) {
+	predictions, _ := s.familyPrediction(c.familyID)
+	state, err := currentState(s.db, c.familyID)
+	if err == nil {
+		s.hub.rememberState(c.familyID, state)
+	}
+	init := map[string]any{
+		"type":             "init",
+		"protocol_version": protocolVersion,
+		"server_time":      time.Now().UnixMilli(),
+		"role":             c.role,
+		"predictions":      predictions,
+		"state":            state,
+	}
+	if c.role != roleSummary {
+		resumed := false
+		if cursor > 0 {
+			entries, hasMore, err := s.db.GetChildEntriesSinceCursor(c.familyID, c.childID, cursor, maxResumeEntries)
+			if err == nil && !hasMore {
+				if entries == nil {
+					entries = []Entry{}
+				}
+				init["entries"], init["resumed_from"] = entries, cursor
+				resumed = true
+			}
+		}
+		if !resumed {
+			entries, _ := s.db.GetEntries(c.familyID, 0)
+			init["entries"] = entriesForChild(entries, c.childID)
+		}
+		init["config"], _ = s.db.GetConfig(c.familyID)
+		init["permissions"] = c.perms
+	}
+	if c.deviceID != "" {
+		if settings, err := s.db.GetDeviceSettings(c.deviceID); err == nil {
+			init["device_settings"] = settings
+		}
+	}
 
-	msg, _ := json.Marshal(map[string]any{
-		"type":    "init",
-		"entries": entries,
-		"config":  config,
-	})
+	msg, _ := json.Marshal(init)
 	c.send <- msg
 }
 
-func (c *Client) readPump(s *Server) {
+// log is the client's logger; see logger.
+func (c *Client) log() *slog.Logger {
+	if c.logger == nil {
+		return slog.Default()
+	}
+	return c.logger
+}
+
+// readPump handles the client's messages until it disconnects, starting
+// with first if the handshake already read one.
+func (c *Client) readPump(s *Server, first []byte) {
 	defer func() {
 		c.hub.Unregister(c)
 		c.conn.Close()
+		s.db.TouchAccessLink(c.linkID, time.Now().UnixMilli())
+		c.log().Info("ws disconnected", "duration_ms", time.Since(c.connectedAt).Milliseconds(),
+			"frames", c.sent.frames.Load(), "bytes", c.sent.bytes.Load(), "dropped", c.sent.dropped.Load())
 	}()
 
 	for {
-		_, message, err := c.conn.ReadMessage()
-		if err != nil {
-			break
+		message := first
+		if first != nil {
+			first = nil
+		} else {
+			typ, data, err := c.conn.ReadMessage()
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+					c.log().Debug("ws read failed", "error", err)
+				}
+				break
+			}
+			message = data
+			if typ == websocket.BinaryMessage {
+				if message, err = cborToJSON(data); err != nil {
+					continue
+				}
+			}
 		}
 
 		var msg WSMessage
@@ -191,15 +889,63 @@ func (c *Client) readPump(s *Server) {
 			continue
 		}
 
+		if c.role == roleSummary && msg.Type != "ping" && msg.Type != "set_label" && msg.Type != "device_settings" {
+			// Read-only: no history, no writes
+			if msg.Type == "entry" {
+				var e Entry
+				if json.Unmarshal(msg.Entry, &e) != nil || e.ID == "" {
+					e.ID = msg.ID // deletes carry the id on the message
+				}
+				reject, _ := json.Marshal(map[string]any{
+					"type":   "entry_rejected",
+					"id":     e.ID,
+					"reason": "read-only link",
+				})
+				c.send <- reject
+			}
+			continue
+		}
+
+		if s.maintenance.State().Enabled {
+			// Read-only: leave writes unacked so the client keeps them queued
+			switch msg.Type {
+			case "entry", "config", "set_label", "device_settings":
+				continue
+			case "sync", "sync_request":
+				msg.Entries = nil
+			}
+		}
+
 		switch msg.Type {
 		case "entry":
 			s.handleEntryMessage(c, msg)
 		case "sync", "sync_request":
 			s.handleSyncMessage(c, msg)
+		case "sync_ack":
+			s.handleSyncAck(c, msg)
+		case "tombstones_request":
+			s.handleTombstonesMessage(c, msg)
 		case "config":
 			s.handleConfigMessage(c, msg)
+		case "set_label":
+			s.handleLabelMessage(c, msg)
+		case "device_settings":
+			s.handleDeviceSettingsMessage(c, msg)
 		case "ping":
-			c.send <- []byte(`{"type":"pong"}`)
+			pong, _ := json.Marshal(map[string]any{"type": "pong", "server_time": time.Now().UnixMilli()})
+			c.send <- pong
+			if msg.ClientTime > 0 {
+				c.noteClientTime(msg.ClientTime)
+			}
+			if msg.IdleMs != nil {
+				c.noteActivity(*msg.IdleMs, msg.Hidden)
+			}
+			if c.deviceID != "" {
+				// Keeps last_seen_at current for sync_failure; see devices.go
+				if err := s.db.TouchDevice(c.deviceID, time.Now().UnixMilli()); err != nil {
+					c.log().Error("failed to record device last seen", "error", err)
+				}
+			}
 		}
 	}
 }
@@ -208,25 +954,145 @@ func (c *Client) writePump() {
 	defer c.conn.Close()
 
 	for msg := range c.send {
-		if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		if msg == nil {
+			// Sentinel from disconnect
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(c.closeCode, c.closeReason), time.Now().Add(time.Second))
 			break
 		}
+		typ := websocket.TextMessage
+		if c.encoding == encodingCBOR {
+			if b, err := jsonToCBOR(msg); err == nil {
+				typ, msg = websocket.BinaryMessage, b
+			}
+		}
+		if err := c.conn.WriteMessage(typ, msg); err != nil {
+			c.log().Debug("ws write failed", "error", err)
+			break
+		}
+		c.noteWritten(len(msg))
 	}
 }
 
+// rejectForbidden tells c its link may not make the change to entry id.
+func (c *Client) rejectForbidden(id, message string) {
+	rejected, _ := json.Marshal(map[string]any{
+		"type":    "entry_rejected",
+		"id":      id,
+		"reason":  "forbidden",
+		"message": message,
+	})
+	c.send <- rejected
+}
+
+// rejectInvalid tells the client entry id was refused as invalid.
+func (c *Client) rejectInvalid(id string, err error) {
+	rejected, _ := json.Marshal(map[string]any{
+		"type":    "entry_rejected",
+		"id":      id,
+		"reason":  "invalid",
+		"message": err.Error(),
+	})
+	c.send <- rejected
+}
+
 func (s *Server) handleEntryMessage(c *Client, msg WSMessage) {
 	switch msg.Action {
-	case "add", "update":
+	case "add", "update", "start", "stop":
 		var entry Entry
 		if err := json.Unmarshal(msg.Entry, &entry); err != nil {
 			return
 		}
+		if entry.Deleted && !c.perms.CanDelete {
+			c.rejectForbidden(entry.ID, "this link can't delete entries")
+			return
+		}
 		entry.FamilyID = c.familyID
+		entry.Author = c.linkLabel()
+		if msg.Action == "add" || msg.Action == "start" {
+			c.noteEntryTime(entry.Ts)
+		}
+
+		// Starts and stops reach other clients as plain adds and updates
+		action := msg.Action
+		switch msg.Action {
+		case "start":
+			entry.Ongoing, entry.EndedTs = true, nil
+			action = "add"
+		case "stop":
+			stopped, err := s.db.stoppedEntry(c.familyID, &entry)
+			if err != nil {
+				if err != errNotOngoing && err != errEndedEarly {
+					c.log().Error("failed to stop entry", "error", err)
+					return
+				}
+				rejected, _ := json.Marshal(map[string]any{
+					"type":   "entry_rejected",
+					"id":     entry.ID,
+					"reason": err.Error(),
+				})
+				c.send <- rejected
+				return
+			}
+			entry = *stopped
+			action = "update"
+		}
+		if be := s.entryBounds().check(&entry, time.Now()); be != nil {
+			c.log().Warn("rejecting entry out of bounds", "error", be)
+			c.send <- boundsRejection(entry.ID, be)
+			return
+		}
+		if err := validateDuration(&entry); err != nil {
+			c.log().Warn("dropping invalid ended_ts", "error", err, "type", entry.Type)
+			entry.EndedTs = nil
+		}
+		if err := validateChildID(&entry, c.childID); err != nil {
+			c.log().Warn("dropping invalid child_id", "error", err, "type", entry.Type)
+			entry.ChildID = c.childID
+		}
+		if err := validatePumpSide(&entry); err != nil {
+			c.log().Warn("rejecting invalid entry", "error", err, "type", entry.Type)
+			c.rejectInvalid(entry.ID, err)
+			return
+		}
+		if err := validateEntryData(&entry); err != nil {
+			// Keep the entry itself so the client's queue drains
+			c.log().Warn("dropping invalid entry data", "error", err, "type", entry.Type)
+			entry.Data = nil
+		}
+		normalizeEntryValue(&entry)
+
+		if !s.entryWithinQuota(c, &entry) {
+			return
+		}
+
+		conflict, err := s.doseConflict(c.familyID, &entry)
+		if err != nil {
+			c.log().Error("failed to check dose interval", "error", err)
+		}
+		if conflict != nil && !doseOverridden(&entry) {
+			// Not saved: the client asks the caregiver and resends with
+			// override, or discards the dose.
+			rejected, _ := json.Marshal(map[string]any{
+				"type":     "entry_rejected",
+				"id":       entry.ID,
+				"reason":   "dose_interval",
+				"conflict": conflict,
+			})
+			c.send <- rejected
+			return
+		}
 
 		if err := s.db.UpsertEntry(&entry); err != nil {
-			slog.Error("failed to upsert entry", "error", err, "family_id", c.familyID)
+			c.log().Error("failed to upsert entry", "error", err)
+			s.hub.publishActivity(ActivityEvent{Type: "error", FamilyID: c.familyID, Label: c.linkLabel(), Message: "failed to save entry"})
 			return
 		}
+		s.hub.publishActivity(ActivityEvent{
+			Type: "entry", FamilyID: c.familyID, Label: c.linkLabel(),
+			Action: msg.Action, EntryType: entry.Type, Seq: entry.Seq,
+		})
+		c.recordEntry(s)
 
 		// Send entry_ack to the submitting client
 		ack, _ := json.Marshal(map[string]any{
@@ -239,17 +1105,37 @@ func (s *Server) handleEntryMessage(c *Client, msg WSMessage) {
 		// Broadcast to other clients
 		broadcast, _ := json.Marshal(map[string]any{
 			"type":   "entry",
-			"action": msg.Action,
+			"action": action,
 			"entry":  entry,
 		})
 		s.hub.Broadcast(c.familyID, broadcast, c)
 
+		if conflict != nil {
+			// The sender already confirmed the override
+			s.warnDose(c, entry, conflict, c)
+		}
+		if action == "add" {
+			s.checkFever(c.familyID, c.linkLabel(), &entry)
+			s.notifyEntry(c, &entry)
+		}
+		s.publishState(c.familyID)
+
 	case "delete":
+		if !c.perms.CanDelete {
+			c.rejectForbidden(msg.ID, "this link can't delete entries")
+			return
+		}
 		seq, err := s.db.DeleteEntry(c.familyID, msg.ID)
 		if err != nil {
-			slog.Error("failed to delete entry", "error", err, "family_id", c.familyID, "entry_id", msg.ID)
+			c.log().Error("failed to delete entry", "error", err, "entry_id", msg.ID)
+			s.hub.publishActivity(ActivityEvent{Type: "error", FamilyID: c.familyID, Label: c.linkLabel(), Message: "failed to delete entry"})
 			return
 		}
+		s.hub.publishActivity(ActivityEvent{
+			Type: "entry", FamilyID: c.familyID, Label: c.linkLabel(),
+			Action: "delete", Seq: seq,
+		})
+		c.recordEntry(s)
 
 		// Send entry_ack to the submitting client
 		ack, _ := json.Marshal(map[string]any{
@@ -259,27 +1145,112 @@ func (s *Server) handleEntryMessage(c *Client, msg WSMessage) {
 		})
 		c.send <- ack
 
+		var childID string
+		if e, err := s.db.GetEntry(c.familyID, msg.ID); err == nil {
+			childID = e.ChildID
+		}
 		broadcast, _ := json.Marshal(map[string]any{
-			"type":   "entry",
-			"action": "delete",
-			"id":     msg.ID,
-			"seq":    seq,
+			"type":     "entry",
+			"action":   "delete",
+			"id":       msg.ID,
+			"seq":      seq,
+			"child_id": childID,
 		})
 		s.hub.Broadcast(c.familyID, broadcast, c)
+		s.publishState(c.familyID)
+	}
+}
+
+// recordEntry notes that this device just wrote an entry, for presence.
+func (c *Client) recordEntry(s *Server) {
+	now := time.Now().UnixMilli()
+	c.lastEntryAt.Store(now)
+	c.activity.activeAt.Store(now)
+	if err := s.db.RecordLinkEntry(c.linkID, now); err != nil {
+		c.log().Error("failed to record link entry", "error", err)
 	}
 }
 
+// platformFromUserAgent reduces a User-Agent to a coarse platform name.
+func platformFromUserAgent(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		return "ios"
+	case strings.Contains(ua, "Android"):
+		return "android"
+	case strings.Contains(ua, "Mac OS X"):
+		return "macos"
+	case strings.Contains(ua, "Windows"):
+		return "windows"
+	case strings.Contains(ua, "Linux"):
+		return "linux"
+	case ua == "":
+		return ""
+	}
+	return "other"
+}
+
 func (s *Server) handleConfigMessage(c *Client, msg WSMessage) {
-	if err := s.db.SaveConfig(c.familyID, string(msg.Data)); err != nil {
-		slog.Error("failed to save config", "error", err, "family_id", c.familyID)
+	if !c.perms.CanEditConfig {
+		rejected, _ := json.Marshal(map[string]any{
+			"type":    "config_rejected",
+			"reason":  "forbidden",
+			"message": "this link can't change the buttons",
+		})
+		c.send <- rejected
+		return
+	}
+	if err := validateConfig(msg.Data); err != nil {
+		c.log().Warn("rejecting invalid config", "error", err)
+		rejected, _ := json.Marshal(map[string]any{
+			"type":    "config_rejected",
+			"reason":  "invalid",
+			"message": err.Error(),
+		})
+		c.send <- rejected
 		return
 	}
+	if err := s.db.SaveConfigBy(c.familyID, string(msg.Data), c.linkLabel()); err != nil {
+		c.log().Error("failed to save config", "error", err)
+		s.hub.publishActivity(ActivityEvent{Type: "error", FamilyID: c.familyID, Label: c.linkLabel(), Message: "failed to save config"})
+		return
+	}
+	s.publishConfig(c.familyID, msg.Data, c)
+}
+
+// entryWithinQuota checks an entry from c against the family's quotas.
+// If it's over, c is sent an entry_rejected and the admin feed warned.
+// Errors measuring usage let the entry through.
+func (s *Server) entryWithinQuota(c *Client, e *Entry) bool {
+	err := s.checkEntryQuota(c.familyID, e)
+	qe, ok := err.(*QuotaError)
+	if !ok {
+		if err != nil {
+			c.log().Error("failed to check entry quota", "error", err)
+		}
+		return true
+	}
+	c.log().Warn("entry over quota", "quota", qe.Quota)
+	c.send <- quotaRejection(e.ID, qe)
+	s.hub.publishActivity(ActivityEvent{Type: "warning", FamilyID: c.familyID, Label: c.linkLabel(), EntryType: e.Type, Message: qe.Error()})
+	return false
+}
 
-	broadcast, _ := json.Marshal(map[string]any{
-		"type": "config",
-		"data": msg.Data,
+// warnDose tells the family that an early dose was recorded by c, skipping
+// exclude, and flags it in the admin activity feed.
+func (s *Server) warnDose(c *Client, e Entry, conflict *DoseConflict, exclude *Client) {
+	msg, _ := json.Marshal(map[string]any{
+		"type":     "dose_warning",
+		"id":       e.ID,
+		"ts":       e.Ts,
+		"label":    c.linkLabel(),
+		"conflict": conflict,
+	})
+	s.hub.Broadcast(c.familyID, msg, exclude)
+	s.hub.publishActivity(ActivityEvent{
+		Type: "warning", FamilyID: c.familyID, Label: c.linkLabel(), EntryType: e.Type,
+		Message: fmt.Sprintf("%s dose within %d min of previous dose", conflict.Drug, conflict.MinIntervalMin),
 	})
-	s.hub.Broadcast(c.familyID, broadcast, c)
 }
 
 // handleSyncMessage handles sync requests from clients
@@ -290,12 +1261,58 @@ func (s *Server) handleSyncMessage(c *Client, msg WSMessage) {
 	if len(msg.Entries) > 0 {
 		var clientEntries []Entry
 		if err := json.Unmarshal(msg.Entries, &clientEntries); err == nil {
+			saved := 0
 			for _, e := range clientEntries {
 				e.FamilyID = c.familyID
+				e.Author = c.linkLabel()
+				if e.Deleted && !c.perms.CanDelete {
+					c.rejectForbidden(e.ID, "this link can't delete entries")
+					continue
+				}
+				if be := s.entryBounds().check(&e, time.Now()); be != nil {
+					c.log().Warn("rejecting sync entry out of bounds", "error", be)
+					c.send <- boundsRejection(e.ID, be)
+					continue
+				}
+				if err := validateDuration(&e); err != nil {
+					c.log().Warn("dropping invalid ended_ts", "error", err, "type", e.Type)
+					e.EndedTs = nil
+				}
+				if err := validateChildID(&e, c.childID); err != nil {
+					c.log().Warn("dropping invalid child_id", "error", err, "type", e.Type)
+					e.ChildID = c.childID
+				}
+				if err := validatePumpSide(&e); err != nil {
+					c.log().Warn("rejecting invalid sync entry", "error", err, "type", e.Type)
+					c.rejectInvalid(e.ID, err)
+					continue
+				}
+				if err := validateEntryData(&e); err != nil {
+					c.log().Warn("dropping invalid entry data", "error", err, "type", e.Type)
+					e.Data = nil
+				}
+				normalizeEntryValue(&e)
+				// Bulk sync can't be interactively confirmed, so early
+				// doses are saved and the family warned. Entries the server
+				// already has were checked when first received.
+				isNew := !s.db.EntryExists(c.familyID, e.ID)
+				if !s.entryWithinQuota(c, &e) {
+					continue
+				}
+				var conflict *DoseConflict
+				if isNew {
+					conflict, _ = s.doseConflict(c.familyID, &e)
+				}
 				if err := s.db.UpsertEntry(&e); err != nil {
-					slog.Error("failed to upsert sync entry", "error", err, "family_id", c.familyID)
+					c.log().Error("failed to upsert sync entry", "error", err)
+					s.hub.publishActivity(ActivityEvent{Type: "error", FamilyID: c.familyID, Label: c.linkLabel(), Message: "failed to save synced entry"})
 					continue
 				}
+				s.hub.publishActivity(ActivityEvent{
+					Type: "entry", FamilyID: c.familyID, Label: c.linkLabel(),
+					Action: "sync", EntryType: e.Type, Seq: e.Seq,
+				})
+				saved++
 
 				// Send entry_ack for each entry
 				ack, _ := json.Marshal(map[string]any{
@@ -309,10 +1326,11 @@ func (s *Server) handleSyncMessage(c *Client, msg WSMessage) {
 				var broadcast []byte
 				if e.Deleted {
 					broadcast, _ = json.Marshal(map[string]any{
-						"type":   "entry",
-						"action": "delete",
-						"id":     e.ID,
-						"seq":    e.Seq,
+						"type":     "entry",
+						"action":   "delete",
+						"id":       e.ID,
+						"seq":      e.Seq,
+						"child_id": e.ChildID,
 					})
 				} else {
 					broadcast, _ = json.Marshal(map[string]any{
@@ -322,14 +1340,24 @@ func (s *Server) handleSyncMessage(c *Client, msg WSMessage) {
 					})
 				}
 				s.hub.Broadcast(c.familyID, broadcast, c)
+				if conflict != nil {
+					s.warnDose(c, e, conflict, nil)
+				}
+				if isNew {
+					s.checkFever(c.familyID, c.linkLabel(), &e)
+				}
+			}
+			if saved > 0 {
+				c.recordEntry(s)
+				s.publishState(c.familyID)
 			}
 		}
 	}
 
 	// Use cursor-based sync with GetEntriesSinceCursor
-	entries, hasMore, err := s.db.GetEntriesSinceCursor(c.familyID, msg.Cursor, msg.Limit)
+	entries, hasMore, err := s.db.GetChildEntriesSinceCursor(c.familyID, c.childID, msg.Cursor, msg.Limit)
 	if err != nil {
-		slog.Error("failed to get entries for sync", "error", err, "family_id", c.familyID)
+		c.log().Error("failed to get entries for sync", "error", err)
 		return
 	}
 
@@ -1,11 +1,15 @@
-package main
+package babytrack
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -200,20 +204,20 @@ func TestHubBroadcast(t *testing.T) {
 		hub:      hub,
 		send:     make(chan []byte, 10),
 		familyID: "family1",
-		label:    "Client 1",
 	}
+	client1.setLabel("Client 1")
 	client2 := &Client{
 		hub:      hub,
 		send:     make(chan []byte, 10),
 		familyID: "family1",
-		label:    "Client 2",
 	}
+	client2.setLabel("Client 2")
 	client3 := &Client{
 		hub:      hub,
 		send:     make(chan []byte, 10),
 		familyID: "family2", // different family
-		label:    "Client 3",
 	}
+	client3.setLabel("Client 3")
 
 	hub.Register(client1)
 	hub.Register(client2)
@@ -724,3 +728,428 @@ func TestSyncRequest(t *testing.T) {
 		t.Errorf("expected has_more=false, got %v", resp2["has_more"])
 	}
 }
+
+func TestAdminActivityFeed(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Dad", nil)
+	adminToken, _ := db.CreateAdminSession("admin", time.Hour)
+
+	s := &Server{db: db, hub: NewHub(db)}
+
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+	wsBase := "ws" + strings.TrimPrefix(server.URL, "http")
+	dialer := websocket.Dialer{}
+
+	// Admin session is required
+	if _, resp, err := dialer.Dial(wsBase+"/admin/ws", nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without admin session, got %v", resp)
+	}
+
+	header := http.Header{}
+	header.Add("Cookie", "admin_session="+adminToken)
+	admin, _, err := dialer.Dial(wsBase+"/admin/ws", header)
+	if err != nil {
+		t.Fatalf("admin failed to connect: %v", err)
+	}
+	defer admin.Close()
+
+	skipUntilType(t, admin, "snapshot")
+
+	header = http.Header{}
+	header.Add("Cookie", "client_session="+link.Token)
+	client, _, err := dialer.Dial(wsBase+"/api/v1/ws", header)
+	if err != nil {
+		t.Fatalf("client failed to connect: %v", err)
+	}
+
+	ev := skipUntilType(t, admin, "connect")
+	if ev["family_id"] != family.ID || ev["label"] != "Dad" || ev["clients"] != float64(1) {
+		t.Errorf("unexpected connect event: %v", ev)
+	}
+
+	entryJSON, _ := json.Marshal(map[string]any{
+		"type":   "entry",
+		"action": "add",
+		"entry":  map[string]any{"id": "e1", "ts": time.Now().UnixMilli(), "type": "feed", "value": "bf"},
+	})
+	client.WriteMessage(websocket.TextMessage, entryJSON)
+
+	ev = skipUntilType(t, admin, "entry")
+	if ev["entry_type"] != "feed" || ev["action"] != "add" {
+		t.Errorf("unexpected entry event: %v", ev)
+	}
+
+	client.Close()
+	ev = skipUntilType(t, admin, "disconnect")
+	if ev["family_id"] != family.ID {
+		t.Errorf("unexpected disconnect event: %v", ev)
+	}
+}
+
+func TestPresenceDevices(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Dad's phone", nil)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	header := http.Header{}
+	header.Add("Cookie", "client_session="+link.Token)
+	header.Add("User-Agent", "Mozilla/5.0 (Linux; Android 14; Pixel 8)")
+
+	conn1, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn1.Close()
+	skipUntilType(t, conn1, "init")
+
+	entryJSON, _ := json.Marshal(map[string]any{
+		"type":   "entry",
+		"action": "add",
+		"entry":  map[string]any{"id": "e1", "ts": time.Now().UnixMilli(), "type": "feed", "value": "bf"},
+	})
+	conn1.WriteMessage(websocket.TextMessage, entryJSON)
+	skipUntilType(t, conn1, "entry_ack")
+
+	// Second connection on the same link is grouped into one device
+	conn2, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn2.Close()
+
+	presence := skipUntilType(t, conn1, "presence")
+	devices := presence["devices"].([]any)
+	if len(devices) != 1 {
+		t.Fatalf("expected 1 device, got %v", devices)
+	}
+	d := devices[0].(map[string]any)
+	if d["label"] != "Dad's phone" || d["connections"] != float64(2) || d["platform"] != "android" {
+		t.Errorf("unexpected device: %v", d)
+	}
+	if d["connected_since"].(float64) == 0 || d["last_entry_at"] == nil {
+		t.Errorf("expected connected_since and last_entry_at, got %v", d)
+	}
+
+	links, _ := db.ListAccessLinks(family.ID)
+	if links[0].LastSeenAt == nil || links[0].LastEntryAt == nil {
+		t.Errorf("expected last seen and last entry to be persisted, got %+v", links[0])
+	}
+}
+
+func TestPlatformFromUserAgent(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)": "ios",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0)":           "macos",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64)":              "windows",
+		"Go-http-client/1.1":                                     "other",
+		"":                                                       "",
+	}
+	for ua, want := range tests {
+		if got := platformFromUserAgent(ua); got != want {
+			t.Errorf("platformFromUserAgent(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestRevokedLinkDisconnects(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	family, _ := db.CreateFamily("Test Baby", "")
+	revoked, _ := db.CreateAccessLink(family.ID, "Babysitter", nil)
+	kept, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	adminToken, _ := db.CreateAdminSession("admin", time.Hour)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(s.routes())
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/ws"
+	dial := func(token string) *websocket.Conn {
+		header := http.Header{}
+		header.Add("Cookie", "client_session="+token)
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		skipUntilType(t, conn, "init")
+		return conn
+	}
+	revokedConn := dial(revoked.Token)
+	defer revokedConn.Close()
+	keptConn := dial(kept.Token)
+	defer keptConn.Close()
+
+	req, _ := http.NewRequest("DELETE", server.URL+"/admin/families/"+family.ID+"/links/"+revoked.Token, nil)
+	req.AddCookie(&http.Cookie{Name: "admin_session", Value: adminToken})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("revoke failed: %v %v", err, resp)
+	}
+
+	msg := skipUntilType(t, revokedConn, "session_revoked")
+	if msg["reason"] != "revoked" {
+		t.Errorf("expected reason=revoked, got %v", msg["reason"])
+	}
+	_, _, err = revokedConn.ReadMessage()
+	if !websocket.IsCloseError(err, closeSessionRevoked) {
+		t.Errorf("expected close code %d, got %v", closeSessionRevoked, err)
+	}
+
+	// Other links stay connected and see the revoked device leave
+	presence := skipUntilType(t, keptConn, "presence")
+	if members := presence["members"].([]any); len(members) != 1 || members[0] != "Mum" {
+		t.Errorf("expected only Mum in presence, got %v", members)
+	}
+}
+
+func TestExpireSessions(t *testing.T) {
+	hub := NewHub(nil)
+	expiring := &Client{hub: hub, send: make(chan []byte, 10), familyID: "f", linkID: "a", expiresAt: 1000}
+	forever := &Client{hub: hub, send: make(chan []byte, 10), familyID: "f", linkID: "b"}
+	hub.Register(expiring)
+	hub.Register(forever)
+
+	if n := hub.ExpireSessions(time.UnixMilli(2000)); n != 1 {
+		t.Fatalf("expected 1 client expired, got %d", n)
+	}
+
+	// Drain presence, then expect the revoke message and close sentinel
+	var got []string
+	for len(expiring.send) > 0 {
+		got = append(got, string(<-expiring.send))
+	}
+	if len(got) < 2 || !strings.Contains(got[len(got)-2], `"expired"`) || got[len(got)-1] != "" {
+		t.Errorf("expected session_revoked then close sentinel, got %q", got)
+	}
+	if expiring.closeCode != closeSessionRevoked {
+		t.Errorf("expected close code %d, got %d", closeSessionRevoked, expiring.closeCode)
+	}
+}
+
+func TestHubConnectionLimits(t *testing.T) {
+	hub := NewHub(nil)
+	hub.maxPerFamily = 3
+	hub.maxPerToken = 2
+
+	newClient := func(family, token string) *Client {
+		return &Client{hub: hub, send: make(chan []byte, 10), familyID: family, linkID: token}
+	}
+
+	if err := hub.Register(newClient("f1", "a")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := hub.Register(newClient("f1", "a")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := hub.Register(newClient("f1", "a")); !errors.Is(err, ErrTooManyConnections) {
+		t.Errorf("expected per-link limit error, got %v", err)
+	}
+	if err := hub.Register(newClient("f1", "b")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := hub.Register(newClient("f1", "c")); !errors.Is(err, ErrTooManyConnections) {
+		t.Errorf("expected per-family limit error, got %v", err)
+	}
+	if err := hub.Register(newClient("f2", "d")); err != nil {
+		t.Errorf("other families should be unaffected, got %v", err)
+	}
+}
+
+func TestWebSocketConnectionLimitCloseCode(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	family, _ := db.CreateFamily("Test Baby", "")
+	link, _ := db.CreateAccessLink(family.ID, "Leaked", nil)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	s.hub.maxPerToken = 1
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	header := http.Header{}
+	header.Add("Cookie", "client_session="+link.Token)
+
+	first, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer first.Close()
+	skipUntilType(t, first, "init")
+
+	second, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer second.Close()
+
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = second.ReadMessage()
+	if !websocket.IsCloseError(err, closeTooManyConnections) {
+		t.Errorf("expected close code %d, got %v", closeTooManyConnections, err)
+	}
+}
+
+func TestWebSocketEntryAuthor(t *testing.T) {
+	db, err := NewDB(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	family, _ := db.CreateFamily("Test Baby", "")
+	mum, _ := db.CreateAccessLink(family.ID, "Mum", nil)
+	dad, _ := db.CreateAccessLink(family.ID, "Dad", nil)
+
+	s := &Server{db: db, hub: NewHub(db)}
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	defer server.Close()
+	dial := func(token string) *websocket.Conn {
+		header := http.Header{"Cookie": {"client_session=" + token}}
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		skipUntilType(t, conn, "init")
+		return conn
+	}
+	mumConn, dadConn := dial(mum.Token), dial(dad.Token)
+	defer mumConn.Close()
+	defer dadConn.Close()
+
+	// Clients can't claim someone else logged it
+	ts := time.Now().UnixMilli()
+	dadConn.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "bottle", "ts": ts, "type": "feed", "value": "bottle", "author": "Mum"}})
+	msg := skipUntilType(t, mumConn, "entry")
+	if author := msg["entry"].(map[string]any)["author"]; author != "Dad" {
+		t.Errorf("broadcast author = %v, want Dad", author)
+	}
+
+	// Editing keeps the original author
+	mumConn.WriteJSON(map[string]any{"type": "entry", "action": "update",
+		"entry": map[string]any{"id": "bottle", "ts": ts, "type": "feed", "value": "bf"}})
+	msg = skipUntilType(t, dadConn, "entry")
+	if author := msg["entry"].(map[string]any)["author"]; author != "Dad" {
+		t.Errorf("after update, broadcast author = %v, want Dad", author)
+	}
+	if e, _ := db.GetEntry(family.ID, "bottle"); e.Author != "Dad" || e.Value != "bf" {
+		t.Errorf("stored entry = %+v", e)
+	}
+}
+
+// syncBuffer is a log destination safe to write from several goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// lines returns the JSON log lines so far.
+func (b *syncBuffer) lines() []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lines []map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var m map[string]any
+		if json.Unmarshal([]byte(l), &m) == nil {
+			lines = append(lines, m)
+		}
+	}
+	return lines
+}
+
+func TestWebSocketSessionLogging(t *testing.T) {
+	var logs syncBuffer
+	orig := logger
+	logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	t.Cleanup(func() { logger = orig })
+
+	s, cleanup := setupTestServer(t)
+	defer cleanup()
+	family, _ := s.db.CreateFamily("Test Baby", "")
+	link, _ := s.db.CreateAccessLink(family.ID, "Mum", nil)
+	server := httptest.NewServer(loggingMiddleware(http.HandlerFunc(s.handleWebSocket)))
+	defer server.Close()
+
+	header := http.Header{"Cookie": {"client_session=" + link.Token}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipUntilType(t, conn, "init")
+	conn.WriteJSON(map[string]any{"type": "entry", "action": "add",
+		"entry": map[string]any{"id": "e1", "ts": time.Now().UnixMilli(), "type": "feed", "child_id": strings.Repeat("x", maxChildIDLen+1)}})
+	skipUntilType(t, conn, "entry_ack")
+	conn.Close()
+
+	// Connect, handler and disconnect logs all carry the session's tags
+	want := map[string]bool{"ws connected": false, "dropping invalid child_id": false, "ws disconnected": false}
+	var reqID any
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		for _, l := range logs.lines() {
+			msg, _ := l["msg"].(string)
+			if _, ok := want[msg]; !ok {
+				continue
+			}
+			want[msg] = true
+			if reqID == nil {
+				reqID = l["req_id"]
+			}
+			if l["req_id"] == nil || l["req_id"] != reqID || l["family_id"] != family.ID || l["label"] != "Mum" {
+				t.Errorf("%q not tagged: %v", msg, l)
+			}
+			if msg == "ws disconnected" && l["duration_ms"] == nil {
+				t.Errorf("disconnect without duration: %v", l)
+			}
+		}
+		if want["ws disconnected"] || time.Now().After(deadline) {
+			break
+		}
+	}
+	for msg, seen := range want {
+		if !seen {
+			t.Errorf("no %q log", msg)
+		}
+	}
+}
+
+// withLabel sets c's link label, for clients made without a connection.
+func withLabel(c *Client, label string) *Client {
+	c.setLabel(label)
+	return c
+}